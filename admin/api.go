@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"youtrack-calendar-sync/config"
+)
+
+// Errors returned by a Registry, answered with 404, 409 and 400.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	ErrInvalid  = errors.New("invalid")
+)
+
+// Registry changes the tenants and mappings of a running instance. Changes
+// are stored, so that they survive restarts.
+type Registry interface {
+	// Mappings returns every mapping, including those of the configuration.
+	Mappings() []config.Mapping
+	// CreateMapping starts a validated mapping whose name is not taken.
+	CreateMapping(m config.Mapping) error
+	// UpdateMapping restarts a mapping created through the API with m.
+	UpdateMapping(m config.Mapping) error
+	// DeleteMapping stops a mapping created through the API. Its sync
+	// state is kept, so that recreating it resumes where it stopped.
+	DeleteMapping(name string) error
+	// Tenants returns every tenant, including those of the configuration.
+	Tenants() []config.Tenant
+	// CreateTenant adds a validated tenant whose name is not taken.
+	CreateTenant(t config.Tenant) error
+	// DeleteTenant removes a tenant created through the API that has no
+	// mappings left.
+	DeleteTenant(name string) error
+}
+
+// tenantInfo describes a tenant without its tokens.
+type tenantInfo struct {
+	Name     string `json:"name"`
+	Mappings int    `json:"mappings"`
+}
+
+func (s *Server) handleListMappings(w http.ResponseWriter, r *http.Request) {
+	tenant, restricted := requestTenant(r)
+	mappings := []config.Mapping{}
+	for _, m := range s.Registry.Mappings() {
+		if !restricted || m.Tenant == tenant {
+			mappings = append(mappings, m)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"mappings": mappings})
+}
+
+func (s *Server) handleCreateMapping(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.decodeMapping(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Registry.CreateMapping(m); err != nil {
+		writeRegistryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, m)
+}
+
+// handleUpdateMapping replaces the mapping named in the path; the name in
+// the body may be left out.
+func (s *Server) handleUpdateMapping(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.visibleMapping(r, name) {
+		http.Error(w, "unknown mapping", http.StatusNotFound)
+		return
+	}
+	m, ok := s.decodeMapping(w, r)
+	if !ok {
+		return
+	}
+	if m.Name != name {
+		http.Error(w, "mapping name does not match the path", http.StatusBadRequest)
+		return
+	}
+	if err := s.Registry.UpdateMapping(m); err != nil {
+		writeRegistryError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+func (s *Server) handleDeleteMapping(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.visibleMapping(r, name) {
+		http.Error(w, "unknown mapping", http.StatusNotFound)
+		return
+	}
+	if err := s.Registry.DeleteMapping(name); err != nil {
+		writeRegistryError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeMapping reads and validates the mapping in the body of r. Tenants
+// may only send mappings of their own, which default to them.
+func (s *Server) decodeMapping(w http.ResponseWriter, r *http.Request) (config.Mapping, bool) {
+	var m config.Mapping
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "invalid mapping: "+err.Error(), http.StatusBadRequest)
+		return m, false
+	}
+	if m.Name == "" && r.PathValue("name") != "" {
+		m.Name = r.PathValue("name")
+	}
+	if tenant, restricted := requestTenant(r); restricted {
+		if m.Tenant != "" && m.Tenant != tenant {
+			http.Error(w, "mappings can only be registered for your own tenant", http.StatusForbidden)
+			return m, false
+		}
+		m.Tenant = tenant
+	}
+	if err := config.ValidateMapping(&m); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return m, false
+	}
+	return m, true
+}
+
+// visibleMapping reports whether the mapping called name exists and may be
+// accessed by r.
+func (s *Server) visibleMapping(r *http.Request, name string) bool {
+	tenant, restricted := requestTenant(r)
+	for _, m := range s.Registry.Mappings() {
+		if m.Name == name {
+			return !restricted || m.Tenant == tenant
+		}
+	}
+	return false
+}
+
+func (s *Server) handleListTenants(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	counts := make(map[string]int)
+	for _, m := range s.Registry.Mappings() {
+		counts[m.Tenant]++
+	}
+	tenants := []tenantInfo{}
+	for _, t := range s.Registry.Tenants() {
+		tenants = append(tenants, tenantInfo{Name: t.Name, Mappings: counts[t.Name]})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tenants": tenants})
+}
+
+func (s *Server) handleCreateTenant(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var t config.Tenant
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, "invalid tenant: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.ValidateTenant(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(t.Mappings) > 0 {
+		http.Error(w, "register the mappings of a tenant through "+MappingsPath, http.StatusBadRequest)
+		return
+	}
+	if t.AdminToken != "" && t.AdminToken == s.Token {
+		http.Error(w, "admin_token must differ from the admin token", http.StatusBadRequest)
+		return
+	}
+	if err := s.Registry.CreateTenant(t); err != nil {
+		writeRegistryError(w, r, err)
+		return
+	}
+	if t.AdminToken != "" {
+		s.mu.Lock()
+		if s.TenantTokens == nil {
+			s.TenantTokens = make(map[string]string)
+		}
+		s.TenantTokens[t.Name] = t.AdminToken
+		s.mu.Unlock()
+	}
+	writeJSON(w, http.StatusCreated, tenantInfo{Name: t.Name})
+}
+
+func (s *Server) handleDeleteTenant(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	name := r.PathValue("name")
+	if err := s.Registry.DeleteTenant(name); err != nil {
+		writeRegistryError(w, r, err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.TenantTokens, name)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireAdmin refuses requests authenticated by a tenant token. API tokens
+// only reach it with sync.ScopeManageTenants.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if _, restricted := requestTenant(r); restricted {
+		http.Error(w, "tenants cannot manage tenants", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func writeRegistryError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Error on %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "failed to apply the change", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
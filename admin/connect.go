@@ -0,0 +1,130 @@
+package admin
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"youtrack-calendar-sync/sync"
+)
+
+// tokenCookie carries the admin or tenant token of a browser that opened
+// ConnectPath, so that its links need not repeat the token.
+const tokenCookie = "admin_token"
+
+// connectAccount is a Google account listed by ConnectPath.
+type connectAccount struct {
+	Name     string
+	Mappings []string
+	// AuthError is set while the account is not authorized.
+	AuthError string
+}
+
+var connectPage = template.Must(template.New("connect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Connect Google Calendar</title>
+</head>
+<body>
+<h1>Connect Google Calendar</h1>
+{{if .Connected}}<p><strong>Google account {{.Connected}} connected, synchronization started.</strong></p>
+{{end}}{{if .Accounts}}<table>
+<tr><th>Account</th><th>Mappings</th><th>Status</th><th></th></tr>
+{{range .Accounts}}<tr>
+<td>{{or .Name "default"}}</td>
+<td>{{range $i, $m := .Mappings}}{{if $i}}, {{end}}{{$m}}{{end}}</td>
+<td>{{if .AuthError}}Not connected{{else}}Connected{{end}}</td>
+<td><a href="?account={{.Name}}">{{if .AuthError}}Connect{{else}}Connect again{{end}}</a></td>
+</tr>
+{{end}}</table>
+{{else}}<p>No mappings are registered yet.</p>
+{{end}}</body>
+</html>
+`))
+
+// handleConnect serves the page on which a tenant connects their Google
+// accounts in the browser. Opened with the "token" query parameter, it
+// checks the token, stores it in a cookie and redirects to the bare page,
+// keeping the token out of the history; with the "account" query
+// parameter, it starts the authorization of that account, which returns to
+// the page.
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	if token := query.Get("token"); token != "" {
+		if _, err := s.authenticate(r, token, sync.ScopeManageMappings); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil || strings.HasPrefix(s.OAuth.RedirectURL, "https://"),
+			// Lax keeps the cookie when Google redirects back.
+			SameSite: http.SameSiteLaxMode,
+		})
+		// A link may carry the token of someone else: the browser must not
+		// go on to authorize an account under it without a click on the
+		// page, which lists whose accounts these are.
+		http.Redirect(w, r, ConnectPath, http.StatusSeeOther)
+		return
+	}
+	s.authenticatedBy(connectToken, sync.ScopeManageMappings, func(w http.ResponseWriter, r *http.Request) {
+		if query.Has("account") {
+			s.startAuth(w, r, query.Get("account"), true)
+			return
+		}
+		s.writeConnectPage(w, r, query.Get("connected"))
+	})(w, r)
+}
+
+func (s *Server) writeConnectPage(w http.ResponseWriter, r *http.Request, connected string) {
+	accounts := make(map[string]*connectAccount)
+	for _, m := range s.mappings(r) {
+		account, ok := accounts[m.Account]
+		if !ok {
+			account = &connectAccount{Name: m.Account}
+			accounts[m.Account] = account
+		}
+		account.Mappings = append(account.Mappings, m.Name)
+		if err := m.Syncer.AuthError(); err != nil {
+			account.AuthError = err.Error()
+		}
+	}
+	data := struct {
+		Connected string
+		Accounts  []*connectAccount
+	}{Connected: connected}
+	for _, account := range accounts {
+		data.Accounts = append(data.Accounts, account)
+	}
+	sort.Slice(data.Accounts, func(i, j int) bool { return data.Accounts[i].Name < data.Accounts[j].Name })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The consent screen must not learn where it was opened from.
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if err := connectPage.Execute(w, data); err != nil {
+		log.Printf("Error rendering %s: %v", ConnectPath, err)
+	}
+}
+
+// connectToken returns the bearer token of r or, as only ConnectPath
+// accepts, the token of the cookie it set.
+func connectToken(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(tokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// handleDebugHTTP reports whether HTTP requests and responses are logged
+// and, for POST, turns it on or off with the "enabled" query parameter.
+// The log covers every tenant, so tenants cannot use it.
+func (s *Server) handleDebugHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, restricted := requestTenant(r); restricted {
+		http.Error(w, "tenants cannot log HTTP traffic", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodPost {
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+			return
+		}
+		s.BodyLog.SetEnabled(enabled)
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": s.BodyLog.Enabled()})
+}
@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"youtrack-calendar-sync/sync"
+)
+
+// handleGetItem returns the stored state of a sync item of the mapping
+// given as the "mapping" query parameter, which may be left out when there
+// is only one.
+func (s *Server) handleGetItem(w http.ResponseWriter, r *http.Request) {
+	m, id, ok := s.itemMapping(w, r)
+	if !ok {
+		return
+	}
+	item, err := m.Syncer.Item(id)
+	if err != nil {
+		writeItemError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// handleEditItem applies the sync.ItemEdit in the body to a sync item, and
+// answers with its new state, or 204 No Content once unlinked.
+func (s *Server) handleEditItem(w http.ResponseWriter, r *http.Request) {
+	m, id, ok := s.itemMapping(w, r)
+	if !ok {
+		return
+	}
+	var edit sync.ItemEdit
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&edit); err != nil {
+		http.Error(w, "invalid edit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	item, err := m.Syncer.EditItem(id, edit)
+	if err != nil {
+		writeItemError(w, r, err)
+		return
+	}
+	if edit.Unlink {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// itemMapping returns the mapping and the item ID a request for a sync item
+// is for.
+func (s *Server) itemMapping(w http.ResponseWriter, r *http.Request) (Mapping, int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item ID", http.StatusBadRequest)
+		return Mapping{}, 0, false
+	}
+	mappings := s.mappings(r)
+	name := r.URL.Query().Get("mapping")
+	if name == "" && len(mappings) > 1 {
+		http.Error(w, "mapping not set (required with several mappings)", http.StatusBadRequest)
+		return Mapping{}, 0, false
+	}
+	for _, m := range mappings {
+		if name == "" || m.Name == name {
+			return m, id, true
+		}
+	}
+	http.Error(w, "unknown mapping", http.StatusNotFound)
+	return Mapping{}, 0, false
+}
+
+func writeItemError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, sync.ErrInvalidEdit):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sync.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, sync.ErrLinked), errors.Is(err, sync.ErrStale), errors.Is(err, sync.ErrPaused), errors.Is(err, sync.ErrReauthRequired):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error on %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
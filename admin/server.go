@@ -0,0 +1,500 @@
+// Package admin serves the administration HTTP API: synchronization status,
+// starting a pass, pausing for maintenance, re-authorization of Google
+// accounts whose token was revoked, a page to connect the Google accounts of
+// a tenant in the browser and, with a Registry, tenants and mappings managed
+// at runtime.
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"youtrack-calendar-sync/httpclient"
+	"youtrack-calendar-sync/sync"
+)
+
+// Endpoints served by Server.
+const (
+	StatusPath   = "/status"
+	PausePath    = "/pause"
+	ResumePath   = "/resume"
+	SyncPath     = "/sync"
+	AuthPath     = "/auth/google"
+	CallbackPath = "/auth/google/callback"
+	ConnectPath  = "/connect/google"
+	MappingsPath = "/api/mappings"
+	TenantsPath  = "/api/tenants"
+	ItemsPath    = "/api/items"
+	// DebugHTTPPath toggles the logging of HTTP requests and responses.
+	DebugHTTPPath = "/debug/http"
+)
+
+// stateTTL bounds how long a started authorization can be completed.
+const stateTTL = 10 * time.Minute
+
+// Syncer is the part of a synchronizer exposed by the API.
+type Syncer interface {
+	LastResult() sync.RunResult
+	AuthError() error
+	PauseState() (sync.PauseState, error)
+	Pause(reason string) error
+	Resume() error
+	Sync() (sync.RunResult, error)
+	// PushChannelStatus returns nil without push notifications.
+	PushChannelStatus() *sync.PushChannelStatus
+	Item(id int) (sync.ItemInfo, error)
+	EditItem(id int, edit sync.ItemEdit) (sync.ItemInfo, error)
+}
+
+// APITokens checks the scopes of API tokens.
+type APITokens interface {
+	APITokenHasScope(token string, scope sync.Scope) (bool, error)
+}
+
+// Mapping is a synchronizer with the names it is known by.
+type Mapping struct {
+	Name    string
+	Account string
+	// Tenant is the tenant owning the mapping, if any.
+	Tenant string
+	Syncer Syncer
+}
+
+// Server handles the admin API.
+type Server struct {
+	// Token authenticates requests, sent as "Authorization: Bearer <token>".
+	// A browser opens ConnectPath with it as the "token" query parameter,
+	// which is turned into a cookie only ConnectPath accepts.
+	Token string
+	// TenantTokens maps tenants to tokens that authenticate requests like
+	// Token, but only give access to the mappings of the tenant.
+	TenantTokens map[string]string
+	// OAuth starts re-authorization; its RedirectURL must lead to CallbackPath.
+	OAuth *oauth2.Config
+	// Context is used for token exchanges, e.g. to carry oauth2.HTTPClient.
+	Context context.Context
+	// Mappings are the mappings served; AddMapping and RemoveMapping change
+	// them while the server runs.
+	Mappings []Mapping
+	// APITokens, if set, authenticates API tokens, which give access to the
+	// endpoints of their scopes only.
+	APITokens APITokens
+	// Registry, if set, serves MappingsPath and TenantsPath to change the
+	// mappings and tenants at runtime.
+	Registry Registry
+	// Backup, if set, reports the scheduled backups in the status.
+	Backup func() BackupStatus
+	// BodyLog, if set, is toggled through DebugHTTPPath.
+	BodyLog *httpclient.BodyLog
+	// Breakers, if set, reports the circuits of the YouTrack and Google
+	// clients in the status.
+	Breakers func() []httpclient.BreakerStatus
+	// Authorized receives the token obtained for a Google account.
+	Authorized func(account string, token *oauth2.Token) error
+
+	mu     gosync.Mutex
+	states map[string]pendingAuth
+
+	// syncing holds the mappings with a pass started through SyncPath
+	// running, true when another one was requested meanwhile.
+	syncing map[string]bool
+}
+
+// pendingAuth is an authorization started by AuthPath or ConnectPath.
+type pendingAuth struct {
+	account  string
+	verifier string
+	expires  time.Time
+	// connect returns the browser to ConnectPath once authorized.
+	connect bool
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(StatusPath, s.authenticated(sync.ScopeReadStatus, s.handleStatus))
+	mux.HandleFunc(PausePath, s.authenticated(sync.ScopeTriggerSync, s.handlePause))
+	mux.HandleFunc(ResumePath, s.authenticated(sync.ScopeTriggerSync, s.handleResume))
+	mux.HandleFunc(SyncPath, s.authenticated(sync.ScopeTriggerSync, s.handleSync))
+	mux.HandleFunc(AuthPath, s.authenticated(sync.ScopeManageMappings, s.handleAuth))
+	mux.HandleFunc(ConnectPath, s.handleConnect)
+	// The callback is authenticated by its state parameter.
+	mux.HandleFunc(CallbackPath, s.handleCallback)
+	mux.HandleFunc("GET "+ItemsPath+"/{id}", s.authenticated(sync.ScopeReadStatus, s.handleGetItem))
+	mux.HandleFunc("PATCH "+ItemsPath+"/{id}", s.authenticated(sync.ScopeManageMappings, s.handleEditItem))
+	if s.BodyLog != nil {
+		mux.HandleFunc("GET "+DebugHTTPPath, s.authenticated(sync.ScopeReadStatus, s.handleDebugHTTP))
+		mux.HandleFunc("POST "+DebugHTTPPath, s.authenticated(sync.ScopeManageMappings, s.handleDebugHTTP))
+	}
+	if s.Registry != nil {
+		mux.HandleFunc("GET "+MappingsPath, s.authenticated(sync.ScopeReadStatus, s.handleListMappings))
+		mux.HandleFunc("POST "+MappingsPath, s.authenticated(sync.ScopeManageMappings, s.handleCreateMapping))
+		mux.HandleFunc("PUT "+MappingsPath+"/{name}", s.authenticated(sync.ScopeManageMappings, s.handleUpdateMapping))
+		mux.HandleFunc("DELETE "+MappingsPath+"/{name}", s.authenticated(sync.ScopeManageMappings, s.handleDeleteMapping))
+		mux.HandleFunc("GET "+TenantsPath, s.authenticated(sync.ScopeManageTenants, s.handleListTenants))
+		mux.HandleFunc("POST "+TenantsPath, s.authenticated(sync.ScopeManageTenants, s.handleCreateTenant))
+		mux.HandleFunc("DELETE "+TenantsPath+"/{name}", s.authenticated(sync.ScopeManageTenants, s.handleDeleteTenant))
+	}
+	return mux
+}
+
+// ReauthURL returns the path that starts re-authorization of account in a
+// browser that opened ConnectPath with its token.
+func ReauthURL(account string) string {
+	return ConnectPath + "?account=" + url.QueryEscape(account)
+}
+
+// tenantKey is the context key of the tenant a request is restricted to.
+type tenantKey struct{}
+
+// errUnauthorized is returned by authenticate for unknown tokens.
+var errUnauthorized = errors.New("unauthorized")
+
+// authenticated lets requests through whose bearer token is the admin
+// token, a tenant token or an API token with scope.
+func (s *Server) authenticated(scope sync.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return s.authenticatedBy(bearerToken, scope, next)
+}
+
+// authenticatedBy is authenticated with the token read by token.
+func (s *Server) authenticatedBy(token func(*http.Request) string, scope sync.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, err := s.authenticate(r, token(r), scope)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authenticate returns r carrying the restrictions of token, or
+// errUnauthorized when token gives no access to scope.
+func (s *Server) authenticate(r *http.Request, token string, scope sync.Scope) (*http.Request, error) {
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1 {
+		return r, nil
+	}
+	if tenant, ok := s.tokenTenant(token); ok {
+		return r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)), nil
+	}
+	if token != "" && s.APITokens != nil {
+		ok, err := s.APITokens.APITokenHasScope(token, scope)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	return nil, errUnauthorized
+}
+
+// writeAuthError answers a request that authenticate refused.
+func writeAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnauthorized) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	log.Printf("Error checking API token: %v", err)
+	http.Error(w, "failed to check token", http.StatusInternalServerError)
+}
+
+// bearerToken returns the token sent with r as "Authorization: Bearer".
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// tokenTenant returns the tenant whose admin token is token.
+func (s *Server) tokenTenant(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for tenant, tenantToken := range s.TenantTokens {
+		if tenantToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(tenantToken)) == 1 {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+// mappings returns the mappings r may access: all of them, or those of the
+// tenant whose token authenticated it.
+func (s *Server) mappings(r *http.Request) []Mapping {
+	tenant, restricted := requestTenant(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var mappings []Mapping
+	for _, m := range s.Mappings {
+		if !restricted || m.Tenant == tenant {
+			mappings = append(mappings, m)
+		}
+	}
+	return mappings
+}
+
+// requestTenant returns the tenant r is restricted to, if any.
+func requestTenant(r *http.Request) (string, bool) {
+	tenant, ok := r.Context().Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// AddMapping starts serving m.
+func (s *Server) AddMapping(m Mapping) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Mappings = append(s.Mappings, m)
+}
+
+// RemoveMapping stops serving the mapping called name.
+func (s *Server) RemoveMapping(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, m := range s.Mappings {
+		if m.Name == name {
+			s.Mappings = append(s.Mappings[:i:i], s.Mappings[i+1:]...)
+			return
+		}
+	}
+}
+
+// mappingStatus is an entry of the StatusPath response.
+type mappingStatus struct {
+	Name           string         `json:"name"`
+	Account        string         `json:"account"`
+	Tenant         string         `json:"tenant,omitempty"`
+	ReauthRequired bool           `json:"reauthRequired"`
+	AuthError      string         `json:"authError,omitempty"`
+	ReauthURL      string         `json:"reauthUrl,omitempty"`
+	LastSync       sync.RunResult `json:"lastSync"`
+	// Pause is omitted when the pause state could not be read.
+	Pause *sync.PauseState `json:"pause,omitempty"`
+	// Push describes the Google push notification channel, if any.
+	Push *sync.PushChannelStatus `json:"push,omitempty"`
+}
+
+// BackupStatus describes the scheduled backups of the state.
+type BackupStatus struct {
+	// LastSuccess is zero before the first backup.
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	// AgeSeconds is the age of the last successful backup, or -1 without one.
+	AgeSeconds int64  `json:"ageSeconds"`
+	LastError  string `json:"lastError,omitempty"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	mappings := s.mappings(r)
+	statuses := make([]mappingStatus, len(mappings))
+	for i, m := range mappings {
+		statuses[i] = mappingStatus{Name: m.Name, Account: m.Account, Tenant: m.Tenant, LastSync: m.Syncer.LastResult(), Push: m.Syncer.PushChannelStatus()}
+		if err := m.Syncer.AuthError(); err != nil {
+			statuses[i].ReauthRequired = true
+			statuses[i].AuthError = err.Error()
+			statuses[i].ReauthURL = ReauthURL(m.Account)
+		}
+		if state, err := m.Syncer.PauseState(); err != nil {
+			log.Printf("Error reading pause of mapping %s: %v", m.Name, err)
+		} else {
+			statuses[i].Pause = &state
+		}
+	}
+	response := map[string]interface{}{"mappings": statuses}
+	// Backups and circuits cover every tenant, so tenants do not see them.
+	_, restricted := requestTenant(r)
+	if s.Backup != nil && !restricted {
+		response["backup"] = s.Backup()
+	}
+	if s.Breakers != nil && !restricted {
+		response["breakers"] = s.Breakers()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handlePause pauses the mapping given as the "mapping" query parameter, or
+// all of them, with the "reason" query parameter.
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	reason := r.URL.Query().Get("reason")
+	s.eachMapping(w, r, func(m Mapping) error { return m.Syncer.Pause(reason) })
+}
+
+// handleResume resumes the mapping given as the "mapping" query parameter,
+// or all of them.
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.eachMapping(w, r, func(m Mapping) error { return m.Syncer.Resume() })
+}
+
+// handleSync starts a pass of the mapping given as the "mapping" query
+// parameter, or of all of them, in the background.
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	s.eachMapping(w, r, func(m Mapping) error {
+		s.startSync(m)
+		return nil
+	})
+}
+
+// startSync runs a pass of m in the background. Requests arriving while one
+// runs are coalesced into a single pass after it.
+func (s *Server) startSync(m Mapping) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, running := s.syncing[m.Name]; running {
+		s.syncing[m.Name] = true
+		return
+	}
+	if s.syncing == nil {
+		s.syncing = make(map[string]bool)
+	}
+	s.syncing[m.Name] = false
+	go func() {
+		for {
+			if _, err := m.Syncer.Sync(); err != nil {
+				log.Printf("Error on synchronization of mapping %s started through %s: %v", m.Name, SyncPath, err)
+			}
+			s.mu.Lock()
+			again := s.syncing[m.Name]
+			if again {
+				s.syncing[m.Name] = false
+			} else {
+				delete(s.syncing, m.Name)
+			}
+			s.mu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// eachMapping applies a POSTed action to the selected mappings and answers
+// with 204 No Content, or with the first error.
+func (s *Server) eachMapping(w http.ResponseWriter, r *http.Request, action func(Mapping) error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("mapping")
+	found := false
+	for _, m := range s.mappings(r) {
+		if name != "" && m.Name != name {
+			continue
+		}
+		found = true
+		if err := action(m); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, sync.ErrPausedByConfig) {
+				status = http.StatusConflict
+			} else {
+				log.Printf("Error on %s of mapping %s: %v", r.URL.Path, m.Name, err)
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	if !found {
+		http.Error(w, "unknown mapping", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	s.startAuth(w, r, r.URL.Query().Get("account"), false)
+}
+
+// startAuth redirects to the consent screen of Google to authorize account.
+func (s *Server) startAuth(w http.ResponseWriter, r *http.Request, account string, connect bool) {
+	if !s.knownAccount(r, account) {
+		http.Error(w, "unknown account", http.StatusNotFound)
+		return
+	}
+	state, err := randomState()
+	if err != nil {
+		http.Error(w, "failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	if s.states == nil {
+		s.states = make(map[string]pendingAuth)
+	}
+	now := time.Now()
+	for key, pending := range s.states {
+		if now.After(pending.expires) {
+			delete(s.states, key)
+		}
+	}
+	verifier := oauth2.GenerateVerifier()
+	s.states[state] = pendingAuth{account: account, verifier: verifier, expires: now.Add(stateTTL), connect: connect}
+	s.mu.Unlock()
+
+	// Force the consent screen so Google issues a new refresh token.
+	authURL := s.OAuth.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mu.Lock()
+	pending, ok := s.states[query.Get("state")]
+	delete(s.states, query.Get("state"))
+	s.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		http.Error(w, "unknown or expired authorization, start again", http.StatusBadRequest)
+		return
+	}
+	if msg := query.Get("error"); msg != "" {
+		http.Error(w, "authorization denied: "+msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx := s.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	token, err := s.OAuth.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		log.Printf("Error exchanging Google authorization code: %v", err)
+		http.Error(w, "failed to exchange authorization code", http.StatusBadGateway)
+		return
+	}
+	if err := s.Authorized(pending.account, token); err != nil {
+		log.Printf("Error storing Google token: %v", err)
+		http.Error(w, "failed to store token", http.StatusInternalServerError)
+		return
+	}
+	if pending.connect {
+		http.Redirect(w, r, ConnectPath+"?connected="+url.QueryEscape(pending.account), http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Google account authorized, synchronization resumed.\n"))
+}
+
+func (s *Server) knownAccount(r *http.Request, account string) bool {
+	for _, m := range s.mappings(r) {
+		if m.Account == account {
+			return true
+		}
+	}
+	return false
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
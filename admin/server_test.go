@@ -0,0 +1,739 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"youtrack-calendar-sync/config"
+	"youtrack-calendar-sync/httpclient"
+	"youtrack-calendar-sync/sync"
+)
+
+type fakeSyncer struct {
+	authErr error
+	pause   sync.PauseState
+	synced  chan struct{}
+	items   map[int]sync.ItemInfo
+}
+
+func (f *fakeSyncer) LastResult() sync.RunResult { return sync.RunResult{Errors: []string{}} }
+func (f *fakeSyncer) AuthError() error           { return f.authErr }
+
+func (f *fakeSyncer) PauseState() (sync.PauseState, error) { return f.pause, nil }
+
+func (f *fakeSyncer) Pause(reason string) error {
+	f.pause = sync.PauseState{Paused: true, Reason: reason}
+	return nil
+}
+
+func (f *fakeSyncer) Sync() (sync.RunResult, error) {
+	if f.synced != nil {
+		f.synced <- struct{}{}
+	}
+	return sync.RunResult{}, nil
+}
+
+func (f *fakeSyncer) PushChannelStatus() *sync.PushChannelStatus { return nil }
+
+func (f *fakeSyncer) Item(id int) (sync.ItemInfo, error) {
+	item, ok := f.items[id]
+	if !ok {
+		return sync.ItemInfo{}, sync.ErrNotFound
+	}
+	return item, nil
+}
+
+func (f *fakeSyncer) EditItem(id int, edit sync.ItemEdit) (sync.ItemInfo, error) {
+	item, ok := f.items[id]
+	if !ok {
+		return sync.ItemInfo{}, sync.ErrNotFound
+	}
+	if edit.Unlink {
+		delete(f.items, id)
+		return sync.ItemInfo{}, nil
+	}
+	if edit.YTID != "" {
+		for _, other := range f.items {
+			if other.YTID == edit.YTID {
+				return sync.ItemInfo{}, sync.ErrLinked
+			}
+		}
+		item.YTID = edit.YTID
+	}
+	f.items[id] = item
+	return item, nil
+}
+
+func (f *fakeSyncer) Resume() error {
+	if f.pause.Configured {
+		return sync.ErrPausedByConfig
+	}
+	f.pause = sync.PauseState{}
+	return nil
+}
+
+func newTestServer(tokenURL string) (*Server, map[string]*oauth2.Token) {
+	authorized := make(map[string]*oauth2.Token)
+	s := &Server{
+		Token: "secret",
+		OAuth: &oauth2.Config{
+			ClientID:    "client",
+			RedirectURL: "https://sync.example.com" + CallbackPath,
+			Endpoint:    oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth", TokenURL: tokenURL},
+		},
+		Mappings: []Mapping{
+			{Name: "work", Account: "work", Syncer: &fakeSyncer{authErr: errors.New("invalid_grant")}},
+			{Name: "home", Account: "", Syncer: &fakeSyncer{}},
+		},
+		Authorized: func(account string, token *oauth2.Token) error {
+			authorized[account] = token
+			return nil
+		},
+	}
+	return s, authorized
+}
+
+func TestStatus(t *testing.T) {
+	s, _ := newTestServer("")
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, StatusPath, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, StatusPath, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Mappings []mappingStatus `json:"mappings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if len(body.Mappings) != 2 || !body.Mappings[0].ReauthRequired || body.Mappings[1].ReauthRequired {
+		t.Fatalf("unexpected status %+v", body.Mappings)
+	}
+	if body.Mappings[0].ReauthURL != "/connect/google?account=work" {
+		t.Errorf("expected re-auth URL for account work, got %s", body.Mappings[0].ReauthURL)
+	}
+}
+
+func TestStatusBackup(t *testing.T) {
+	s, _ := newTestServer("")
+	s.Backup = func() BackupStatus { return BackupStatus{AgeSeconds: 3600, LastError: "disk full"} }
+	s.TenantTokens = map[string]string{"alice": "alice-secret"}
+	handler := s.Handler()
+	status := func(token string) map[string]json.RawMessage {
+		req := httptest.NewRequest(http.MethodGet, StatusPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode status: %v", err)
+		}
+		return body
+	}
+
+	var backup BackupStatus
+	if err := json.Unmarshal(status("secret")["backup"], &backup); err != nil {
+		t.Fatalf("failed to decode backup status: %v", err)
+	}
+	if backup.AgeSeconds != 3600 || backup.LastError != "disk full" {
+		t.Errorf("unexpected backup status %+v", backup)
+	}
+	if _, ok := status("alice-secret")["backup"]; ok {
+		t.Error("expected tenants not to see the backup status")
+	}
+}
+
+func TestDebugHTTP(t *testing.T) {
+	s, _ := newTestServer("")
+	s.BodyLog = &httpclient.BodyLog{}
+	s.TenantTokens = map[string]string{"alice": "alice-secret"}
+	handler := s.Handler()
+	do := func(method, target, token string) (int, string) {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	if code, body := do(http.MethodPost, DebugHTTPPath+"?enabled=true", "secret"); code != http.StatusOK || body != `{"enabled":true}` {
+		t.Fatalf("expected logging to be enabled, got %d %s", code, body)
+	}
+	if !s.BodyLog.Enabled() {
+		t.Error("expected the body log to be enabled")
+	}
+	if code, _ := do(http.MethodPost, DebugHTTPPath+"?enabled=maybe", "secret"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid value, got %d", code)
+	}
+	if code, _ := do(http.MethodPost, DebugHTTPPath+"?enabled=false", "alice-secret"); code != http.StatusForbidden {
+		t.Errorf("expected tenants to be refused, got %d", code)
+	}
+	if code, body := do(http.MethodGet, DebugHTTPPath, "secret"); code != http.StatusOK || body != `{"enabled":true}` {
+		t.Errorf("expected logging to still be enabled, got %d %s", code, body)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	s, _ := newTestServer("")
+	handler := s.Handler()
+	do := func(method, target string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodGet, PausePath); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", code)
+	}
+	if code := do(http.MethodPost, PausePath+"?mapping=other"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown mapping, got %d", code)
+	}
+	if code := do(http.MethodPost, PausePath+"?mapping=work&reason=migration"); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	work, home := s.Mappings[0].Syncer.(*fakeSyncer), s.Mappings[1].Syncer.(*fakeSyncer)
+	if !work.pause.Paused || work.pause.Reason != "migration" || home.pause.Paused {
+		t.Fatalf("expected only mapping work to be paused, got %+v and %+v", work.pause, home.pause)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, StatusPath, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var body struct {
+		Mappings []mappingStatus `json:"mappings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if p := body.Mappings[0].Pause; p == nil || !p.Paused || p.Reason != "migration" {
+		t.Errorf("expected the pause in the status, got %+v", p)
+	}
+
+	if code := do(http.MethodPost, ResumePath); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	if work.pause.Paused {
+		t.Error("expected mapping work to be resumed")
+	}
+
+	home.pause = sync.PauseState{Paused: true, Configured: true}
+	if code := do(http.MethodPost, ResumePath+"?mapping=home"); code != http.StatusConflict {
+		t.Errorf("expected 409 for a configured pause, got %d", code)
+	}
+}
+
+func TestSyncCoalescesRequests(t *testing.T) {
+	s, _ := newTestServer("")
+	handler := s.Handler()
+	synced := make(chan struct{})
+	s.Mappings[1].Syncer.(*fakeSyncer).synced = synced
+	post := func() {
+		req := httptest.NewRequest(http.MethodPost, SyncPath+"?mapping=home", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+	}
+
+	post()
+	// The first pass is now blocked on synced; the requests below arrive
+	// while it runs.
+	for i := 0; i < 3; i++ {
+		post()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-synced:
+		case <-time.After(time.Second):
+			t.Fatalf("expected pass %d to run", i+1)
+		}
+	}
+	select {
+	case <-synced:
+		t.Error("expected the requests made during a pass to be coalesced into one")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReauthorization(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("code"); got != "auth-code" {
+			t.Errorf("expected code 'auth-code', got '%s'", got)
+		}
+		if r.FormValue("code_verifier") == "" {
+			t.Error("expected a PKCE code verifier")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"fresh","token_type":"Bearer","refresh_token":"new-refresh"}`)
+	}))
+	defer tokenServer.Close()
+
+	s, authorized := newTestServer(tokenServer.URL)
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, AuthPath+"?account=work&token=secret", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the token query parameter to be refused, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, AuthPath+"?account=work", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected a redirect, got %d", rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	state := location.Query().Get("state")
+	if state == "" || location.Query().Get("prompt") != "consent" || location.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected a state, forced consent and a PKCE challenge, got %s", location)
+	}
+
+	callback := CallbackPath + "?code=auth-code&state=" + state
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if token := authorized["work"]; token == nil || token.RefreshToken != "new-refresh" {
+		t.Errorf("expected the new token for account work, got %+v", token)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a reused state to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestReauthorizationUnknownAccount(t *testing.T) {
+	s, _ := newTestServer("")
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, AuthPath+"?account=other", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestTenantTokens(t *testing.T) {
+	s, _ := newTestServer("")
+	s.Mappings = []Mapping{
+		{Name: "alice-work", Account: "alice", Tenant: "alice", Syncer: &fakeSyncer{}},
+		{Name: "bob-work", Account: "bob", Tenant: "bob", Syncer: &fakeSyncer{}},
+	}
+	s.TenantTokens = map[string]string{"alice": "alice-secret", "bob": "bob-secret"}
+	handler := s.Handler()
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, StatusPath, "alice-secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Mappings []mappingStatus `json:"mappings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if len(body.Mappings) != 1 || body.Mappings[0].Name != "alice-work" || body.Mappings[0].Tenant != "alice" {
+		t.Fatalf("expected only the mapping of tenant alice, got %+v", body.Mappings)
+	}
+
+	if rec := do(http.MethodPost, PausePath+"?mapping=bob-work", "alice-secret"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for the mapping of another tenant, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, AuthPath+"?account=bob", "alice-secret"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for the account of another tenant, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, PausePath, "alice-secret"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	alice, bob := s.Mappings[0].Syncer.(*fakeSyncer), s.Mappings[1].Syncer.(*fakeSyncer)
+	if !alice.pause.Paused || bob.pause.Paused {
+		t.Errorf("expected only the mappings of tenant alice to be paused, got %+v and %+v", alice.pause, bob.pause)
+	}
+	if rec := do(http.MethodGet, StatusPath, "secret"); rec.Code != http.StatusOK {
+		t.Errorf("expected the admin token to keep working, got %d", rec.Code)
+	}
+}
+
+func TestItemsAPI(t *testing.T) {
+	s, _ := newTestServer("")
+	s.Mappings = []Mapping{
+		{Name: "work", Syncer: &fakeSyncer{items: map[int]sync.ItemInfo{
+			1: {ID: 1, GCalID: "event-1", YTID: "PRJ-1"},
+			2: {ID: 2, GCalID: "event-2", YTID: "PRJ-2"},
+		}}},
+		{Name: "home", Syncer: &fakeSyncer{}},
+	}
+	s.APITokens = fakeAPITokens{"reader": {sync.ScopeReadStatus}}
+	handler := s.Handler()
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, ItemsPath+"/1", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a mapping, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, ItemsPath+"/1?mapping=other", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown mapping, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, ItemsPath+"/3?mapping=work", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown item, got %d", rec.Code)
+	}
+	rec := do(http.MethodGet, ItemsPath+"/1?mapping=work", "reader", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var item sync.ItemInfo
+	if err := json.NewDecoder(rec.Body).Decode(&item); err != nil {
+		t.Fatalf("failed to decode item: %v", err)
+	}
+	if item.GCalID != "event-1" || item.YTID != "PRJ-1" {
+		t.Errorf("unexpected item %+v", item)
+	}
+
+	if rec := do(http.MethodPatch, ItemsPath+"/1?mapping=work", "reader", `{"ytId":"PRJ-3"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a read-only token, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPatch, ItemsPath+"/1?mapping=work", "secret", `{"issue":"PRJ-3"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown field, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPatch, ItemsPath+"/1?mapping=work", "secret", `{"ytId":"PRJ-2"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an issue linked to another item, got %d", rec.Code)
+	}
+	rec = do(http.MethodPatch, ItemsPath+"/1?mapping=work", "secret", `{"ytId":"PRJ-3"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ytId":"PRJ-3"`) {
+		t.Errorf("expected the relinked item, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPatch, ItemsPath+"/1?mapping=work", "secret", `{"unlink":true}`); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204 on unlink, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, ItemsPath+"/1?mapping=work", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 once unlinked, got %d", rec.Code)
+	}
+}
+
+type fakeRegistry struct {
+	mappings []config.Mapping
+	tenants  []config.Tenant
+}
+
+func (f *fakeRegistry) Mappings() []config.Mapping { return f.mappings }
+func (f *fakeRegistry) Tenants() []config.Tenant   { return f.tenants }
+
+func (f *fakeRegistry) CreateMapping(m config.Mapping) error {
+	for _, other := range f.mappings {
+		if other.Name == m.Name {
+			return fmt.Errorf("%w: mapping %q exists", ErrConflict, m.Name)
+		}
+	}
+	f.mappings = append(f.mappings, m)
+	return nil
+}
+
+func (f *fakeRegistry) UpdateMapping(m config.Mapping) error {
+	for i, other := range f.mappings {
+		if other.Name == m.Name {
+			f.mappings[i] = m
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (f *fakeRegistry) DeleteMapping(name string) error {
+	for i, other := range f.mappings {
+		if other.Name == name {
+			f.mappings = append(f.mappings[:i], f.mappings[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (f *fakeRegistry) CreateTenant(t config.Tenant) error {
+	f.tenants = append(f.tenants, t)
+	return nil
+}
+
+func (f *fakeRegistry) DeleteTenant(name string) error {
+	for i, t := range f.tenants {
+		if t.Name == name {
+			f.tenants = append(f.tenants[:i], f.tenants[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func TestMappingsAPI(t *testing.T) {
+	s, _ := newTestServer("")
+	registry := &fakeRegistry{
+		mappings: []config.Mapping{{Name: "bob-work", GoogleAccount: "bob", YouTrackProjectID: "0-2", Tenant: "bob"}},
+		tenants:  []config.Tenant{{Name: "alice"}, {Name: "bob"}},
+	}
+	s.Registry = registry
+	s.TenantTokens = map[string]string{"alice": "alice-secret", "bob": "bob-secret"}
+	handler := s.Handler()
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, MappingsPath, "", `{}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, MappingsPath, "alice-secret", `{"name":"work","youtrack_project_id":"0-1"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a name outside the tenant, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, MappingsPath, "alice-secret", `{"name":"alice-work","google_account":"alice","youtrack_project_id":"0-1","tenant":"bob"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a mapping of another tenant, got %d", rec.Code)
+	}
+	rec := do(http.MethodPost, MappingsPath, "alice-secret", `{"name":"alice-work","google_account":"alice","youtrack_project_id":"0-1"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	if got := registry.mappings[1]; got.Tenant != "alice" || got.YouTrackQueryProjectID != "0-1" {
+		t.Errorf("expected the mapping to be qualified and completed, got %+v", got)
+	}
+	if rec := do(http.MethodPost, MappingsPath, "alice-secret", `{"name":"alice-work","google_account":"alice","youtrack_project_id":"0-1"}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an existing mapping, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodGet, MappingsPath, "alice-secret", "")
+	var body struct {
+		Mappings []config.Mapping `json:"mappings"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode mappings: %v", err)
+	}
+	if len(body.Mappings) != 1 || body.Mappings[0].Name != "alice-work" {
+		t.Errorf("expected only the mapping of tenant alice, got %+v", body.Mappings)
+	}
+
+	if rec := do(http.MethodPut, MappingsPath+"/alice-work", "alice-secret", `{"google_account":"alice","youtrack_project_id":"0-3"}`); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if got := registry.mappings[1].YouTrackProjectID; got != "0-3" {
+		t.Errorf("expected the mapping to be updated, got project %s", got)
+	}
+	if rec := do(http.MethodDelete, MappingsPath+"/bob-work", "alice-secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for the mapping of another tenant, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, MappingsPath+"/alice-work", "alice-secret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if len(registry.mappings) != 1 {
+		t.Errorf("expected the mapping to be deleted, got %+v", registry.mappings)
+	}
+}
+
+func TestTenantsAPI(t *testing.T) {
+	s, _ := newTestServer("")
+	registry := &fakeRegistry{}
+	s.Registry = registry
+	handler := s.Handler()
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, TenantsPath, "secret", `{"name":"carol","youtrack_token":"perm:x","admin_token":"secret"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for the admin token, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, TenantsPath, "secret", `{"name":"carol","youtrack_token":"perm:x","admin_token":"carol-secret"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, TenantsPath, "carol-secret", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a tenant token, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, MappingsPath, "carol-secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected the new tenant token to work, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, TenantsPath+"/carol", "secret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, MappingsPath, "carol-secret", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the tenant token to be revoked, got %d", rec.Code)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"fresh","token_type":"Bearer","refresh_token":"new-refresh"}`)
+	}))
+	defer tokenServer.Close()
+
+	s, authorized := newTestServer(tokenServer.URL)
+	s.Mappings = []Mapping{
+		{Name: "alice-work", Account: "alice", Tenant: "alice", Syncer: &fakeSyncer{authErr: errors.New("not authorized yet")}},
+		{Name: "bob-work", Account: "bob", Tenant: "bob", Syncer: &fakeSyncer{}},
+	}
+	s.TenantTokens = map[string]string{"alice": "alice-secret"}
+	handler := s.Handler()
+	get := func(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get(ConnectPath, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rec.Code)
+	}
+	rec := get(ConnectPath+"?token=forged", nil)
+	if rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("expected an unknown token to be refused without a cookie, got %d with %+v", rec.Code, rec.Result().Cookies())
+	}
+	rec = get(ConnectPath+"?token=alice-secret&account=alice", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != ConnectPath {
+		t.Fatalf("expected a redirect dropping the token and account, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "alice-secret" || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("expected a secure token cookie, got %+v", cookies)
+	}
+	cookie := cookies[0]
+	if rec := get(StatusPath, cookie); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the cookie to be refused outside %s, got %d", ConnectPath, rec.Code)
+	}
+	if rec := get(StatusPath+"?token=alice-secret", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the token query parameter to be refused outside %s, got %d", ConnectPath, rec.Code)
+	}
+
+	rec = get(ConnectPath, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if page := rec.Body.String(); !strings.Contains(page, "alice-work") || !strings.Contains(page, "Not connected") || strings.Contains(page, "bob") {
+		t.Errorf("expected only the accounts of tenant alice, got %s", page)
+	}
+	if rec := get(ConnectPath+"?account=bob", cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for the account of another tenant, got %d", rec.Code)
+	}
+
+	rec = get(ConnectPath+"?account=alice", cookie)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to Google, got %d", rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	rec = get(CallbackPath+"?code=auth-code&state="+location.Query().Get("state"), nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != ConnectPath+"?connected=alice" {
+		t.Fatalf("expected a redirect back to the page, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if token := authorized["alice"]; token == nil || token.RefreshToken != "new-refresh" {
+		t.Errorf("expected the new token for account alice, got %+v", token)
+	}
+}
+
+type fakeAPITokens map[string][]sync.Scope
+
+func (f fakeAPITokens) APITokenHasScope(token string, scope sync.Scope) (bool, error) {
+	for _, s := range f[token] {
+		if s == scope {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestAPITokens(t *testing.T) {
+	s, _ := newTestServer("")
+	s.Registry = &fakeRegistry{}
+	s.APITokens = fakeAPITokens{
+		"reader":  {sync.ScopeReadStatus},
+		"trigger": {sync.ScopeTriggerSync},
+		"mapper":  {sync.ScopeManageMappings},
+		"tenants": {sync.ScopeManageTenants},
+	}
+	synced := make(chan struct{}, 1)
+	s.Mappings[1].Syncer.(*fakeSyncer).synced = synced
+	handler := s.Handler()
+	do := func(method, target, token string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tc := range []struct {
+		method, target, token string
+		want                  int
+	}{
+		{http.MethodGet, StatusPath, "reader", http.StatusOK},
+		{http.MethodGet, MappingsPath, "reader", http.StatusOK},
+		{http.MethodPost, PausePath, "reader", http.StatusUnauthorized},
+		{http.MethodPost, MappingsPath, "reader", http.StatusUnauthorized},
+		{http.MethodGet, TenantsPath, "reader", http.StatusUnauthorized},
+		{http.MethodPost, TenantsPath, "mapper", http.StatusUnauthorized},
+		{http.MethodDelete, TenantsPath + "/carol", "mapper", http.StatusUnauthorized},
+		{http.MethodGet, TenantsPath, "tenants", http.StatusOK},
+		{http.MethodGet, StatusPath, "trigger", http.StatusUnauthorized},
+		{http.MethodGet, AuthPath + "?account=work", "trigger", http.StatusUnauthorized},
+		{http.MethodPost, SyncPath + "?mapping=home", "trigger", http.StatusNoContent},
+		{http.MethodGet, StatusPath, "unknown", http.StatusUnauthorized},
+	} {
+		if got := do(tc.method, tc.target, tc.token); got != tc.want {
+			t.Errorf("%s %s with token %s: expected %d, got %d", tc.method, tc.target, tc.token, tc.want, got)
+		}
+	}
+	select {
+	case <-synced:
+	case <-time.After(time.Second):
+		t.Error("expected a pass of mapping home to start")
+	}
+}
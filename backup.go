@@ -0,0 +1,436 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"youtrack-calendar-sync/admin"
+	"youtrack-calendar-sync/config"
+	"youtrack-calendar-sync/schedule"
+	"youtrack-calendar-sync/sync"
+)
+
+// Directories of a backup archive: SQLite files are restored next to the
+// database, token files into the data directory.
+const (
+	backupDBDir     = "db"
+	backupTokensDir = "tokens"
+	backupManifest  = "manifest.json"
+)
+
+// backupPrefix and backupSuffix make up the names of backup archives,
+// which sort by creation time.
+const (
+	backupPrefix = "youtrack-calendar-sync-"
+	backupSuffix = ".tar.gz"
+)
+
+// backupManifestInfo is written first to every backup archive.
+type backupManifestInfo struct {
+	Created time.Time `json:"created"`
+	Files   []string  `json:"files"`
+	// Checksums holds the hex SHA-256 of every file, verified on restore.
+	Checksums map[string]string `json:"checksums"`
+}
+
+// backupName returns the name of an archive created at t.
+func backupName(t time.Time) string {
+	return backupPrefix + t.UTC().Format("20060102T150405Z") + backupSuffix
+}
+
+// runBackup creates or restores a backup of the local state as given by
+// args and returns the process exit code. client uploads and downloads
+// archives given as URLs.
+func runBackup(dataDir, dataSource string, client *http.Client, args []string, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	if sync.IsRemoteDSN(dataSource) {
+		log.Printf("Error: backup only covers SQLite state; back up the PostgreSQL database with its own tools")
+		return exitSyncFailed
+	}
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("backup create", flag.ContinueOnError)
+		output := flags.String("output", backupName(time.Now()), "archive to write")
+		upload := flags.String("upload", "", "pre-signed S3 or GCS URL to PUT the archive to")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 0 {
+			fmt.Fprintln(flag.CommandLine.Output(), usage)
+			return exitSyncFailed
+		}
+		manifest, err := createBackup(*output, dataDir, dataSource)
+		if err != nil {
+			log.Printf("Error creating backup: %v", err)
+			return exitSyncFailed
+		}
+		fmt.Fprintf(out, "Backed up %d files to %s\n", len(manifest.Files), *output)
+		if *upload != "" {
+			if err := uploadBackup(client, *upload, *output, ""); err != nil {
+				log.Printf("Error uploading backup: %v", err)
+				return exitSyncFailed
+			}
+			fmt.Fprintln(out, "Uploaded the backup")
+		}
+	case "restore":
+		if len(args) != 2 {
+			fmt.Fprintln(flag.CommandLine.Output(), usage)
+			return exitSyncFailed
+		}
+		manifest, err := restoreBackup(client, args[1], dataDir, dataSource)
+		if err != nil {
+			log.Printf("Error restoring backup: %v", err)
+			return exitSyncFailed
+		}
+		fmt.Fprintf(out, "Restored %d files from the backup of %s\n", len(manifest.Files), manifest.Created.Format(time.RFC3339))
+	default:
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	return exitOK
+}
+
+// stateFiles returns the SQLite files of the state, the main database and
+// those of the mappings, and the Google token files.
+func stateFiles(dataDir, dataSource string) (databases, tokens []string, err error) {
+	ext := filepath.Ext(dataSource)
+	mappingDBs, err := filepath.Glob(strings.TrimSuffix(dataSource, ext) + "-*" + ext)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range append([]string{dataSource}, mappingDBs...) {
+		if _, err := os.Stat(file); err == nil {
+			databases = append(databases, file)
+		}
+	}
+	tokens, err = filepath.Glob(filepath.Join(dataDir, "token*.json"))
+	return databases, tokens, err
+}
+
+// createBackup writes a gzipped tar archive of the state to output. The
+// databases are copied with the SQLite backup API, so the synchronizer may
+// keep running.
+func createBackup(output, dataDir, dataSource string) (*backupManifestInfo, error) {
+	databases, tokens, err := stateFiles(dataDir, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	if len(databases) == 0 {
+		return nil, fmt.Errorf("no state found at %s", dataSource)
+	}
+	tmpDir, err := os.MkdirTemp("", "youtrack-calendar-sync-backup")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest := &backupManifestInfo{Created: time.Now().UTC(), Checksums: make(map[string]string)}
+	sources := make(map[string]string)
+	for _, file := range databases {
+		name := path.Join(backupDBDir, filepath.Base(file))
+		sources[name] = filepath.Join(tmpDir, filepath.Base(file))
+		if err := sync.CopySQLite(sources[name], file); err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+	for _, file := range tokens {
+		name := path.Join(backupTokensDir, filepath.Base(file))
+		sources[name] = file
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	contents := make(map[string][]byte)
+	for _, name := range manifest.Files {
+		if contents[name], err = os.ReadFile(sources[name]); err != nil {
+			return nil, err
+		}
+		manifest.Checksums[name] = checksum(contents[name])
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, backupManifest, data); err != nil {
+		return nil, err
+	}
+	for _, name := range manifest.Files {
+		if err := writeTarFile(tw, name, contents[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, f.Close()
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// restoreBackup replaces the state with the archive at source, a file or an
+// http(s) URL. The synchronizer must be stopped while it runs.
+func restoreBackup(client *http.Client, source, dataDir, dataSource string) (*backupManifestInfo, error) {
+	var r io.Reader
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to download %s: %s", source, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp("", "youtrack-calendar-sync-restore")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Unpack and verify everything first, so that a truncated or corrupt
+	// archive changes nothing. Archives of older versions have no checksums
+	// and only get the SQLite integrity check.
+	var manifest *backupManifestInfo
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		if header.Name == backupManifest {
+			manifest = &backupManifestInfo{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("invalid backup manifest: %w", err)
+			}
+			continue
+		}
+		dir, name := path.Split(header.Name)
+		if (dir != backupDBDir+"/" && dir != backupTokensDir+"/") || name == "" || name == "." || name == ".." {
+			return nil, fmt.Errorf("unexpected file %q in backup archive", header.Name)
+		}
+		if manifest == nil {
+			return nil, fmt.Errorf("not a backup archive: %s missing", backupManifest)
+		}
+		if want, ok := manifest.Checksums[header.Name]; ok && checksum(data) != want {
+			return nil, fmt.Errorf("backup archive is corrupt: checksum of %s does not match", header.Name)
+		}
+		files[header.Name] = filepath.Join(tmpDir, strings.ReplaceAll(header.Name, "/", "-"))
+		if err := os.WriteFile(files[header.Name], data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("not a backup archive: %s missing", backupManifest)
+	}
+	for _, name := range manifest.Files {
+		if _, ok := files[name]; !ok {
+			return nil, fmt.Errorf("backup archive is incomplete: %s missing", name)
+		}
+		if path.Dir(name) == backupDBDir {
+			if err := sync.CheckSQLite(files[name]); err != nil {
+				return nil, fmt.Errorf("backup archive is corrupt: %w", err)
+			}
+		}
+	}
+
+	for _, name := range manifest.Files {
+		dir, base := path.Split(name)
+		if dir == backupDBDir+"/" {
+			if err := sync.CopySQLite(filepath.Join(filepath.Dir(dataSource), base), files[name]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, err := os.ReadFile(files[name])
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dataDir, base), data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// uploadBackup PUTs the archive at file to url: a pre-signed URL, which S3
+// and GCS both accept without further credentials, or an object store
+// endpoint authenticated by token, if set.
+func uploadBackup(client *http.Client, url, file, token string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, url, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/gzip")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// backupScheduler creates the scheduled backups of BACKUP_DIR.
+type backupScheduler struct {
+	cfg        *config.Config
+	dataDir    string
+	dataSource string
+	client     *http.Client
+
+	mu          gosync.Mutex
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// run creates a backup whenever cron fires. The last successful backup is
+// taken from BACKUP_DIR, so that its age survives restarts.
+func (b *backupScheduler) run(cron *schedule.Cron) {
+	if archives, err := b.archives(); err == nil && len(archives) > 0 {
+		if info, err := os.Stat(archives[len(archives)-1]); err == nil {
+			b.mu.Lock()
+			b.lastSuccess = info.ModTime()
+			b.mu.Unlock()
+		}
+	}
+	log.Printf("Backing up the state to %s on schedule %q, keeping %d backups", b.cfg.BackupDir, b.cfg.BackupSchedule, b.cfg.BackupKeep)
+	for {
+		time.Sleep(time.Until(cron.Next(time.Now())))
+		err := b.backup()
+		b.mu.Lock()
+		b.lastErr = err
+		if err == nil {
+			b.lastSuccess = time.Now()
+		}
+		b.mu.Unlock()
+		if err != nil {
+			log.Printf("Error creating scheduled backup: %v", err)
+		}
+	}
+}
+
+// backup creates, uploads and prunes one backup.
+func (b *backupScheduler) backup() error {
+	name := backupName(time.Now())
+	file := filepath.Join(b.cfg.BackupDir, name)
+	// The partial name keeps unfinished archives out of archives().
+	partial := file + ".partial"
+	if _, err := createBackup(partial, b.dataDir, b.dataSource); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(partial, file); err != nil {
+		return err
+	}
+	if b.cfg.BackupUploadURL != "" {
+		url := strings.ReplaceAll(b.cfg.BackupUploadURL, "{name}", name)
+		if err := uploadBackup(b.client, url, file, b.cfg.BackupUploadToken); err != nil {
+			return err
+		}
+	}
+	archives, err := b.archives()
+	if err != nil {
+		return err
+	}
+	for len(archives) > b.cfg.BackupKeep {
+		if err := os.Remove(archives[0]); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		archives = archives[1:]
+	}
+	log.Printf("Backed up the state to %s", file)
+	return nil
+}
+
+// archives returns the backups in BACKUP_DIR, oldest first.
+func (b *backupScheduler) archives() ([]string, error) {
+	archives, err := filepath.Glob(filepath.Join(b.cfg.BackupDir, backupPrefix+"*"+backupSuffix))
+	sort.Strings(archives)
+	return archives, err
+}
+
+// status reports the scheduled backups to the admin API.
+func (b *backupScheduler) status() admin.BackupStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := admin.BackupStatus{LastSuccess: b.lastSuccess, AgeSeconds: -1}
+	if !b.lastSuccess.IsZero() {
+		status.AgeSeconds = int64(time.Since(b.lastSuccess).Seconds())
+	}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	return status
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/sync"
+	"youtrack-calendar-sync/webhook"
+)
+
+// Exit codes of --once, --observe, resync, doctor, link, unlink, import,
+// pause, resume, planned, acl, token, backup and workflow.
+const (
+	exitOK          = 0
+	exitSyncFailed  = 1
+	exitItemsFailed = 2
+)
+
+const usage = `usage:
+  youtrack-calendar-sync                         run the synchronizer
+  youtrack-calendar-sync --once                  run a single pass and print a JSON summary
+  youtrack-calendar-sync --observe [--changes F] run a single pass that writes nothing and
+                                                 print the changes it would make as NDJSON
+  youtrack-calendar-sync sync item <ISSUE-ID>    sync a single YouTrack issue
+  youtrack-calendar-sync sync event <EVENT-ID>   sync a single Google Calendar event
+  youtrack-calendar-sync resync [--full]         discard the sync cursors and sync again; --full
+                                                 also links existing matching pairs first
+  youtrack-calendar-sync doctor [--fix]          check every link against both APIs, report
+                                                 broken ones and, with --fix, repair them
+  youtrack-calendar-sync link <ISSUE-ID> <EVENT-ID>
+                                                 link an existing issue and event, neither of
+                                                 which is linked yet, and print the item ID
+  youtrack-calendar-sync unlink <ITEM-ID>        remove a link, leaving its issue and event
+  youtrack-calendar-sync import gcal --from DATE [--to DATE] [--project ID]
+                                                 create and link an issue for every past event
+                                                 from DATE to DATE (default today), each
+                                                 occurrence of a recurring event on its own,
+                                                 in project ID (default YOUTRACK_PROJECT_ID)
+  youtrack-calendar-sync pause [--reason TEXT]   stop all writes, only recording the changes
+                                                 each pass would make
+  youtrack-calendar-sync resume                  lift a pause; the next pass applies the changes
+  youtrack-calendar-sync planned                 print the changes recorded by the last paused
+                                                 pass as NDJSON
+  youtrack-calendar-sync acl grant ADDRESS[=ROLE]...
+                                                 share the synced calendar with users, or
+                                                 Google Groups given as group:ADDRESS, as
+                                                 reader (the default) or writer
+  youtrack-calendar-sync acl revoke ADDRESS...   remove the access of users or groups
+  youtrack-calendar-sync acl list                list the users and groups with access
+  youtrack-calendar-sync token create --name N --scopes S
+                                                 create an API token with the comma-separated
+                                                 scopes read-status, trigger-sync,
+                                                 manage-mappings and manage-tenants, and
+                                                 print it once
+  youtrack-calendar-sync token revoke NAME       revoke the API token called NAME
+  youtrack-calendar-sync backup create [--output F] [--upload URL]
+                                                 write a consistent snapshot of the databases
+                                                 and Google tokens, optionally uploading it to
+                                                 a pre-signed S3 or GCS URL
+  youtrack-calendar-sync backup restore F|URL    replace the state with a backup; stop the
+                                                 synchronizer first
+  youtrack-calendar-sync workflow --url URL [--output F]
+                                                 write a YouTrack workflow package that posts
+                                                 issue changes to the webhook served at URL,
+                                                 signed with WEBHOOK_SECRET; F defaults to
+                                                 youtrack-calendar-sync-workflow.zip, - is
+                                                 standard output
+
+With several mappings, --mapping <name> (given before the command) restricts
+any of these to one mapping; the sync, resync, link, unlink and import
+commands require it. resync also accepts --mapping after the command.`
+
+// runCommand executes a one-shot command given on the command line.
+func runCommand(synchronizer *sync.Synchronizer, args []string) error {
+	if len(args) == 3 && args[0] == "sync" {
+		switch args[1] {
+		case "item":
+			return synchronizer.SyncIssue(args[2])
+		case "event":
+			return synchronizer.SyncEvent(args[2])
+		}
+	}
+	return fmt.Errorf("unknown command %q\n%s", args, usage)
+}
+
+// onceSummary is the JSON summary printed by --once.
+type onceSummary struct {
+	OK              bool        `json:"ok"`
+	Error           string      `json:"error,omitempty"`
+	Started         string      `json:"started"`
+	DurationSeconds float64     `json:"durationSeconds"`
+	Counts          sync.Counts `json:"counts"`
+	Errors          []string    `json:"errors"`
+}
+
+// runOnce performs a single sync pass of every mapping, prints the combined
+// summary to stdout and returns the process exit code. With several mappings,
+// errors are prefixed with the mapping name.
+func runOnce(mappings []*mapping) int {
+	summary := onceSummary{Errors: []string{}}
+	code := exitOK
+	var syncErrors []string
+	for _, m := range mappings {
+		result, err := m.synchronizer.Sync()
+
+		prefix := ""
+		if len(mappings) > 1 {
+			prefix = m.label() + ": "
+		}
+		if summary.Started == "" {
+			summary.Started = result.Started.Format("2006-01-02T15:04:05Z07:00")
+		}
+		summary.DurationSeconds += result.Duration.Seconds()
+		summary.Counts = summary.Counts.Plus(result.Counts)
+		for _, itemErr := range result.Errors {
+			summary.Errors = append(summary.Errors, prefix+itemErr)
+		}
+		if err != nil {
+			syncErrors = append(syncErrors, prefix+err.Error())
+			code = exitSyncFailed
+		} else if result.Failed() && code == exitOK {
+			code = exitItemsFailed
+		}
+	}
+	summary.OK = code == exitOK
+	summary.Error = strings.Join(syncErrors, "; ")
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summary); err != nil {
+		return exitSyncFailed
+	}
+	return code
+}
+
+// runObserve performs a read-only pass of every mapping, writing the changes
+// it would have made as NDJSON to path, or to stdout when path is empty, and
+// returns the process exit code.
+func runObserve(mappings []*mapping, path string) int {
+	out := os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Printf("Error creating change feed: %v", err)
+			return exitSyncFailed
+		}
+		defer f.Close()
+		out = f
+	}
+
+	feed := sync.NewChangeFeed(out)
+	code := exitOK
+	for _, m := range mappings {
+		if err := m.synchronizer.Observe(feed.ForMapping(m.Name)); err != nil {
+			log.Printf("Error observing mapping %s: %v", m.label(), err)
+			code = exitSyncFailed
+			continue
+		}
+		if result, err := m.synchronizer.Sync(); err != nil {
+			log.Printf("Observation of mapping %s failed: %v", m.label(), err)
+			code = exitSyncFailed
+		} else if result.Failed() && code == exitOK {
+			code = exitItemsFailed
+		}
+	}
+	return code
+}
+
+// runResync discards the sync cursors of one mapping and syncs it again,
+// with a reconciling full pass when --full is among args. It returns the
+// process exit code.
+func runResync(mappings []*mapping, args []string) int {
+	flags := flag.NewFlagSet("resync", flag.ContinueOnError)
+	name := flags.String("mapping", "", "mapping to resync")
+	full := flags.Bool("full", false, "link existing matching events and issues, then sync every event and issue")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	if *name != "" {
+		var selected []*mapping
+		for _, m := range mappings {
+			if m.Name == *name {
+				selected = append(selected, m)
+			}
+		}
+		if len(selected) == 0 {
+			log.Printf("Error: unknown mapping %q", *name)
+			return exitSyncFailed
+		}
+		mappings = selected
+	}
+	if len(mappings) > 1 {
+		log.Printf("Error: several mappings are configured, choose one with --mapping")
+		return exitSyncFailed
+	}
+
+	m := mappings[0]
+	var err error
+	if *full {
+		err = m.synchronizer.Resync()
+	} else if err = m.db.ResetCursors(); err == nil {
+		_, err = m.synchronizer.Sync()
+	}
+	if err != nil {
+		log.Printf("Error resyncing mapping %s: %v", m.label(), err)
+		return exitSyncFailed
+	}
+	if m.synchronizer.LastResult().Failed() {
+		return exitItemsFailed
+	}
+	return exitOK
+}
+
+// runDoctor checks the links of every mapping against both APIs, writes a
+// drift report listing the broken links to out and, with --fix among args,
+// repairs them. It returns the process exit code: exitItemsFailed when
+// broken links remain.
+func runDoctor(mappings []*mapping, args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "recreate missing events and issues from their counterparts and prune links with neither")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+
+	code := exitOK
+	for _, m := range mappings {
+		previous, err := m.db.LatestMetrics()
+		if err != nil && !errors.Is(err, sync.ErrNotFound) {
+			log.Printf("Error reading metrics of mapping %s: %v", m.label(), err)
+		}
+		metrics, broken, err := m.synchronizer.Check()
+		if err != nil {
+			log.Printf("Error checking mapping %s: %v", m.label(), err)
+			code = exitSyncFailed
+			continue
+		}
+		writeDoctorReport(out, m.label(), metrics, previous)
+
+		remaining := 0
+		for _, link := range broken {
+			line := fmt.Sprintf("  item %d, event %s, issue %s: %s", link.Item.ID, orNone(link.Item.GCalID.String), orNone(link.Item.YTID.String), link.Problem)
+			if *fix {
+				action, err := m.synchronizer.Repair(link)
+				if err != nil {
+					line += ", repair failed: " + err.Error()
+					remaining++
+				} else {
+					line += ", " + action
+				}
+			} else {
+				remaining++
+			}
+			fmt.Fprintln(out, line)
+		}
+		if len(broken) > 0 && !*fix {
+			fmt.Fprintln(out, "  Run \"doctor --fix\" to recreate the missing events and issues from their counterparts and prune links with neither, or reconcile single pairs with \"sync item <ISSUE-ID>\" or \"sync event <EVENT-ID>\".")
+		}
+		if remaining > 0 && code == exitOK {
+			code = exitItemsFailed
+		}
+	}
+	return code
+}
+
+// writeDoctorReport describes the metrics of one mapping, compared with the
+// previous check when there is one.
+func writeDoctorReport(out io.Writer, label string, metrics sync.Metrics, previous *sync.Metrics) {
+	fmt.Fprintf(out, "%s: %d links, %d events, %d issues, %d broken", label, metrics.Links, metrics.Events, metrics.Issues, metrics.Drift())
+	if previous != nil {
+		fmt.Fprintf(out, " (%d broken at the previous check, %s)", previous.Drift(), previous.RecordedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintln(out)
+	if metrics.Drift() == 0 {
+		fmt.Fprintln(out, "  No drift.")
+		return
+	}
+	if missing := metrics.Links - metrics.Events; missing > 0 {
+		fmt.Fprintf(out, "  %d linked events no longer exist in Google Calendar: their deletion was not applied to YouTrack.\n", missing)
+	}
+	if missing := metrics.Links - metrics.Issues; missing > 0 {
+		fmt.Fprintf(out, "  %d linked issues no longer exist in YouTrack: their deletion was not applied to Google Calendar.\n", missing)
+	}
+}
+
+// runLink links the issue and the event given by args in the only mapping,
+// writing the new item to out, and returns the process exit code.
+func runLink(mappings []*mapping, args []string, out io.Writer) int {
+	if len(args) != 2 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	if len(mappings) > 1 {
+		log.Printf("Error: several mappings are configured, choose one with --mapping")
+		return exitSyncFailed
+	}
+
+	m := mappings[0]
+	item, err := m.synchronizer.Link(args[0], args[1])
+	if err != nil {
+		log.Printf("Error linking issue %s to event %s in mapping %s: %v", args[0], args[1], m.label(), err)
+		return exitSyncFailed
+	}
+	fmt.Fprintf(out, "%s: linked issue %s to event %s as item %d\n", m.label(), args[0], item.GCalID, item.ID)
+	return exitOK
+}
+
+// runUnlink removes the sync item given by args from the only mapping,
+// writing what it unlinked to out, and returns the process exit code.
+func runUnlink(mappings []*mapping, args []string, out io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		log.Printf("Error: invalid item ID %q", args[0])
+		return exitSyncFailed
+	}
+	if len(mappings) > 1 {
+		log.Printf("Error: several mappings are configured, choose one with --mapping")
+		return exitSyncFailed
+	}
+
+	m := mappings[0]
+	item, err := m.synchronizer.Item(id)
+	if err == nil {
+		_, err = m.synchronizer.EditItem(id, sync.ItemEdit{Unlink: true})
+	}
+	if err != nil {
+		log.Printf("Error unlinking item %d of mapping %s: %v", id, m.label(), err)
+		return exitSyncFailed
+	}
+	fmt.Fprintf(out, "%s: unlinked issue %s from event %s\n", m.label(), orNone(item.YTID), orNone(item.GCalID))
+	return exitOK
+}
+
+// runImport imports the past events of the only mapping into YouTrack as
+// given by args, drawing a progress bar on progress and writing a summary
+// to out, and returns the process exit code: exitItemsFailed when events
+// failed to import.
+func runImport(mappings []*mapping, args []string, out, progress io.Writer) int {
+	if len(args) == 0 || args[0] != "gcal" {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	fromDate := flags.String("from", "", "first day of the events to import, as YYYY-MM-DD")
+	toDate := flags.String("to", "", "last day of the events to import, as YYYY-MM-DD; defaults to today")
+	project := flags.String("project", "", "YouTrack project ID to create the issues in; defaults to YOUTRACK_PROJECT_ID")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 0 || *fromDate == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	from, err := time.ParseInLocation(time.DateOnly, *fromDate, time.Local)
+	if err != nil {
+		log.Printf("Error: invalid --from: %v", err)
+		return exitSyncFailed
+	}
+	// Upcoming events are left to the ongoing sync.
+	to := time.Now()
+	if *toDate != "" {
+		day, err := time.ParseInLocation(time.DateOnly, *toDate, time.Local)
+		if err != nil {
+			log.Printf("Error: invalid --to: %v", err)
+			return exitSyncFailed
+		}
+		if end := day.AddDate(0, 0, 1); end.Before(to) {
+			to = end
+		}
+	}
+	if !from.Before(to) {
+		log.Printf("Error: --from must be before --to and today")
+		return exitSyncFailed
+	}
+	if len(mappings) > 1 {
+		log.Printf("Error: several mappings are configured, choose one with --mapping")
+		return exitSyncFailed
+	}
+
+	m := mappings[0]
+	result, err := m.synchronizer.ImportEvents(from, to, *project, func(done, total int) {
+		drawProgress(progress, done, total)
+	})
+	if result.Events > 0 {
+		fmt.Fprintln(progress)
+	}
+	if err != nil {
+		log.Printf("Error importing events of mapping %s: %v", m.label(), err)
+		return exitSyncFailed
+	}
+	fmt.Fprintf(out, "%s: imported %d of %d events, %d skipped, %d failed\n", m.label(), result.Imported, result.Events, result.Skipped, len(result.Errors))
+	for _, itemErr := range result.Errors {
+		fmt.Fprintf(out, "  %s\n", itemErr)
+	}
+	if len(result.Errors) > 0 {
+		return exitItemsFailed
+	}
+	return exitOK
+}
+
+// drawProgress redraws a progress bar of done out of total on w.
+func drawProgress(w io.Writer, done, total int) {
+	const width = 40
+	filled := width * done / total
+	fmt.Fprintf(w, "\r[%s%s] %d/%d", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), done, total)
+}
+
+// runPause pauses every mapping with the --reason among args and returns
+// the process exit code.
+func runPause(mappings []*mapping, args []string) int {
+	flags := flag.NewFlagSet("pause", flag.ContinueOnError)
+	reason := flags.String("reason", "", "why synchronization is paused, shown in the status")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+
+	code := exitOK
+	for _, m := range mappings {
+		if err := m.synchronizer.Pause(*reason); err != nil {
+			log.Printf("Error pausing mapping %s: %v", m.label(), err)
+			code = exitSyncFailed
+		}
+	}
+	return code
+}
+
+// runResume lifts the pause of every mapping, writing how many planned
+// changes the next pass will apply to out, and returns the process exit code.
+func runResume(mappings []*mapping, args []string, out io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+
+	code := exitOK
+	for _, m := range mappings {
+		state, err := m.synchronizer.PauseState()
+		if err == nil {
+			err = m.synchronizer.Resume()
+		}
+		if err != nil {
+			log.Printf("Error resuming mapping %s: %v", m.label(), err)
+			code = exitSyncFailed
+			continue
+		}
+		if !state.Paused {
+			fmt.Fprintf(out, "%s: not paused\n", m.label())
+			continue
+		}
+		fmt.Fprintf(out, "%s: resumed, the next sync applies %d planned changes\n", m.label(), state.PlannedChanges)
+	}
+	return code
+}
+
+// runPlanned writes the changes recorded by the last paused pass of every
+// mapping to out as NDJSON and returns the process exit code.
+func runPlanned(mappings []*mapping, args []string, out io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+
+	enc := json.NewEncoder(out)
+	code := exitOK
+	for _, m := range mappings {
+		changes, err := m.synchronizer.PlannedChanges()
+		if err != nil {
+			log.Printf("Error reading planned changes of mapping %s: %v", m.label(), err)
+			code = exitSyncFailed
+			continue
+		}
+		for _, change := range changes {
+			change.Mapping = m.Name
+			if err := enc.Encode(change); err != nil {
+				return exitSyncFailed
+			}
+		}
+	}
+	return code
+}
+
+// runACL grants, revokes or lists access to the calendar of every mapping,
+// as given by args, writing what it did to out, and returns the process exit
+// code.
+func runACL(mappings []*mapping, args []string, out io.Writer) int {
+	if len(args) == 0 || (args[0] == "list") != (len(args) == 1) {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	shares, err := sync.ParseCalendarShares(args[1:])
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitSyncFailed
+	}
+
+	code := exitOK
+	for _, m := range mappings {
+		switch args[0] {
+		case "grant":
+			if err = m.synchronizer.Grant(shares); err == nil {
+				for _, share := range shares {
+					fmt.Fprintf(out, "%s: granted %s\n", m.label(), share)
+				}
+			}
+		case "revoke":
+			var missing []sync.CalendarShare
+			missing, err = m.synchronizer.Revoke(shares)
+			for _, share := range missing {
+				fmt.Fprintf(out, "%s: %s had no access\n", m.label(), share.Email)
+			}
+		case "list":
+			var access []sync.CalendarShare
+			access, err = m.synchronizer.Access()
+			for _, share := range access {
+				fmt.Fprintf(out, "%s: %s\n", m.label(), share)
+			}
+		default:
+			fmt.Fprintln(flag.CommandLine.Output(), usage)
+			return exitSyncFailed
+		}
+		if err != nil {
+			log.Printf("Error managing access to the calendar of mapping %s: %v", m.label(), err)
+			code = exitSyncFailed
+		}
+	}
+	return code
+}
+
+// runToken creates or revokes an API token stored in db, as given by args,
+// and returns the process exit code.
+func runToken(db *sync.DB, args []string, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the token, used to revoke it")
+		scopeList := flags.String("scopes", "", "comma-separated scopes of the token")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 0 || *name == "" {
+			fmt.Fprintln(flag.CommandLine.Output(), usage)
+			return exitSyncFailed
+		}
+		scopes, err := sync.ParseScopes(*scopeList)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return exitSyncFailed
+		}
+		token, err := db.CreateAPIToken(*name, scopes)
+		if err != nil {
+			log.Printf("Error creating API token %s: %v", *name, err)
+			return exitSyncFailed
+		}
+		fmt.Fprintln(out, token)
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprintln(flag.CommandLine.Output(), usage)
+			return exitSyncFailed
+		}
+		revoked, err := db.DeleteAPIToken(args[1])
+		if err != nil {
+			log.Printf("Error revoking API token %s: %v", args[1], err)
+			return exitSyncFailed
+		}
+		if !revoked {
+			log.Printf("Error: unknown API token %q", args[1])
+			return exitSyncFailed
+		}
+	default:
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	return exitOK
+}
+
+// orNone returns id, or "(none)" when it is empty.
+func orNone(id string) string {
+	if id == "" {
+		return "(none)"
+	}
+	return id
+}
+
+// runWorkflow writes the YouTrack workflow package calling the webhook as
+// given by args and returns the process exit code.
+func runWorkflow(secret string, args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("workflow", flag.ContinueOnError)
+	baseURL := flags.String("url", "", "public URL of the webhook server")
+	output := flags.String("output", webhook.WorkflowName+"-workflow.zip", "package to write, - for standard output")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 || *baseURL == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		return exitSyncFailed
+	}
+	if secret == "" {
+		log.Printf("Error: WEBHOOK_SECRET not set (required by workflow)")
+		return exitSyncFailed
+	}
+	if *output == "-" {
+		if err := webhook.WriteWorkflow(out, *baseURL, secret); err != nil {
+			log.Printf("Error writing workflow: %v", err)
+			return exitSyncFailed
+		}
+		return exitOK
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Printf("Error writing workflow: %v", err)
+		return exitSyncFailed
+	}
+	err = webhook.WriteWorkflow(f, *baseURL, secret)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		log.Printf("Error writing workflow: %v", err)
+		return exitSyncFailed
+	}
+	fmt.Fprintf(out, "Wrote the workflow to %s; import it under Administration > Workflows and attach it to the synced projects\n", *output)
+	return exitOK
+}
@@ -3,9 +3,10 @@ package config
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -13,18 +14,255 @@ type Config struct {
 	YouTrackPermanentToken string
 	YouTrackProjectID      string
 	YouTrackQueryProjectID string
-	GoogleClientID         string
-	GoogleClientSecret     string
-	GoogleRedirectURL      string
-	GoogleCalendarId       string
+	// YouTrackSavedSearch replaces YouTrackQueryProjectID with a saved search.
+	YouTrackSavedSearch   string
+	GoogleClientID        string
+	GoogleClientSecret    string
+	GoogleRedirectURL     string
+	GoogleCalendarId      string
+	YouTrackManagedFields []string
+	GoogleManagedFields   []string
+	DescriptionTemplate   string
+	IncludeDrafts         bool
+	IncludeResolved       bool
+	ResolvedAction        string
+	// SubtaskMode is how subtasks appear in the calendar: event, prefix or skip.
+	SubtaskMode            string
+	LinkRecurringInstances bool
+	// DependencyCheck and ConflictCheck are off, warn or comment.
+	DependencyCheck string
+	ConflictCheck   string
+	// GoogleEventCopies is skip or create, see sync.EventCopies.
+	GoogleEventCopies       string
+	GoogleArchiveCalendarID string
+	// GoogleCreateCalendar creates the calendar of a mapping named
+	// GoogleCalendarName, shared with GoogleCalendarShareWith, when its
+	// configured ID does not exist.
+	GoogleCreateCalendar    bool
+	GoogleCalendarName      string
+	GoogleCalendarShareWith []string
+	// GoogleSkipEventTypes is nil when unset, so the synchronizer default applies.
+	GoogleSkipEventTypes []string
+	// GoogleIgnoreSenders and GoogleIgnoreProperties select events of other
+	// automations that never become issues, see sync.IgnoredEvents.
+	GoogleIgnoreSenders    []string
+	GoogleIgnoreProperties []string
+	// YouTrackResponseField receives the user's own attendee response.
+	YouTrackResponseField string
+	// YouTrackResponseValues maps response statuses to field values, as
+	// "status:value" pairs.
+	YouTrackResponseValues map[string]string
+	// YouTrackResponseStates maps response statuses to issue states, as
+	// "tentative:Waiting,declined:Won't do".
+	YouTrackResponseStates map[string]string
+	DeclinedPriority       string
+	DeclinedClearsDueDate  bool
+	// DeclinedAction selects how declined events are synced, see
+	// sync.ParseDeclinedAction.
+	DeclinedAction string
+	// YouTrackConferenceField receives the event's conference join URL.
+	YouTrackConferenceField string
+	// YouTrackLocationField is mirrored with the event location.
+	YouTrackLocationField string
+	// WebhookAddr is the listen address of the YouTrack webhook receiver;
+	// empty disables it.
+	WebhookAddr   string
+	WebhookSecret string
+	// GooglePushURL, if set, is the public HTTPS URL of the webhook
+	// receiver, to which Google sends push notifications of calendar
+	// changes through channels lasting GooglePushTTL.
+	GooglePushURL         string
+	GooglePushTTL         time.Duration
+	GooglePushRenewBefore time.Duration
+	// YouTrackIssueType and YouTrackIssueTypeRules select the Type of issues
+	// created from calendar events.
+	YouTrackIssueType      string
+	YouTrackIssueTypeRules string
+	// HookCreateIssue, HookUpdateIssue, HookCreateEvent and HookUpdateEvent
+	// are expr expressions transforming items before they are written, see
+	// sync.ExprHook.
+	HookCreateIssue string
+	HookUpdateIssue string
+	HookCreateEvent string
+	HookUpdateEvent string
+	// YouTrackDefaultFields holds "Name[:kind]=value" entries applied to
+	// issues created from events.
+	YouTrackDefaultFields string
+	YouTrackDefaultTags   []string
+	AssignOrganizer       bool
+	AssigneeFallback      string
+	// YouTrackTagHashtags lists the tags shown as hashtags in event
+	// summaries, YouTrackTagColors holds "tag=color" entries and
+	// YouTrackHashtagTags turns hashtags in event summaries into tags.
+	YouTrackTagHashtags []string
+	YouTrackTagColors   string
+	YouTrackHashtagTags bool
+	// ProvenanceComment comments on issues created from events where they
+	// came from.
+	ProvenanceComment bool
+	// GoogleEventPrefix and GoogleEventSuffix mark the summary of events
+	// written by the synchronizer.
+	GoogleEventPrefix string
+	GoogleEventSuffix string
+	// GoogleEventVisibility and GoogleEventTransparency apply to events
+	// written from issues.
+	GoogleEventVisibility   string
+	GoogleEventTransparency string
+	// HTTP settings shared by both clients, and per-client timeouts.
+	HTTPCAFile             string
+	HTTPInsecureSkipVerify bool
+	HTTPDebug              bool
+	// HTTPDebugBodies starts with request and response bodies logged; the
+	// admin API toggles it at runtime.
+	HTTPDebugBodies     bool
+	YouTrackHTTPTimeout time.Duration
+	GoogleHTTPTimeout   time.Duration
+	// OTLPTracing exports the spans of API requests over OTLP, as configured
+	// by the standard OTEL_EXPORTER_OTLP_* variables.
+	OTLPTracing bool
+	// HTTPBreakerThreshold consecutive failures open the circuit of a
+	// backend for HTTPBreakerCooldown; zero disables the breakers.
+	HTTPBreakerThreshold int
+	HTTPBreakerCooldown  time.Duration
+	// HTTPRecordDir receives youtrack.json and google.json fixtures of every
+	// API exchange; HTTPReplayDir answers requests from such fixtures
+	// instead of the network.
+	HTTPRecordDir string
+	HTTPReplayDir string
+	// SyncSchedule is an optional cron expression replacing the fixed
+	// periodic sync.
+	SyncSchedule string
+	// DatabaseURL overrides the local SQLite file; a postgres:// URL keeps
+	// all state, including the Google token, on a PostgreSQL server.
+	DatabaseURL string
+	// DataDir holds the token file and SQLite database; empty selects
+	// DefaultDataDir.
+	DataDir string
+	// GoogleTokens holds OAuth tokens in JSON form by Google account, used
+	// instead of stored ones.
+	GoogleTokens map[string]string
+	// AdminAddr is the listen address of the admin API; empty disables it.
+	AdminAddr  string
+	AdminToken string
+	// GoogleAuthFlow is "web" (the default) or "device".
+	GoogleAuthFlow string
+	// Mappings lists the project/calendar pairs to synchronize.
+	Mappings []Mapping
+	// Tenants lists the users served by the instance, whose mappings are
+	// included in Mappings; it is empty without TENANTS_FILE.
+	Tenants []Tenant
+	// DriftThreshold is the number of broken links above which a warning is
+	// logged; zero disables the periodic drift check, which runs at most
+	// once per DriftCheckInterval.
+	DriftThreshold     int
+	DriftCheckInterval time.Duration
+	// EchoWindow is how long after a write of the synchronizer updates to
+	// the written item are taken as its echo, see sync.Synchronizer.
+	EchoWindow time.Duration
+	// ClockSkew is how far apart update times are too close to order, see
+	// sync.Synchronizer.
+	ClockSkew time.Duration
+	// Paused pauses every mapping's writes, see sync.Synchronizer.Pause.
+	Paused bool
+	// StartDate is the default start date of mappings, see ParseStartDate.
+	StartDate string
+	// EventTiming, EventTime and EventDuration are the defaults of the
+	// mapping settings of the same names.
+	EventTiming   string
+	EventTime     string
+	EventDuration string
+	// PriorityDurations and TypeDurations hold "value=duration" entries
+	// overriding the event duration, see sync.ParseEventDurations.
+	PriorityDurations string
+	TypeDurations     string
+	// DueDateBoundary is the default of the mapping setting of the same
+	// name: "start" or "end".
+	DueDateBoundary string
+	// SyncDescriptions is the default of the mapping setting of the same
+	// name.
+	SyncDescriptions bool
+	// MinAttendees is the default of the mapping setting of the same name.
+	MinAttendees int
+	// WorkingHours, such as 09:00-17:00, confine timed events; SkipWeekends
+	// also moves them off weekends.
+	WorkingHours string
+	SkipWeekends bool
+	// HolidayCalendar and HolidayAction are the defaults of the mapping
+	// settings of the same names.
+	HolidayCalendar string
+	HolidayAction   string
+	// PlannerEstimateField names the period field holding issue estimates;
+	// setting it places work blocks for upcoming issues due within
+	// PlannerHorizon, lasting at most PlannerBlockLength each.
+	PlannerEstimateField string
+	PlannerHorizon       time.Duration
+	PlannerBlockLength   time.Duration
+	// DeadlineRollup lists the deadlines of the issues due within
+	// RollupHorizon in one all-day event per day, naming RollupTitleIssues
+	// of them in its title.
+	DeadlineRollup    bool
+	RollupHorizon     time.Duration
+	RollupTitleIssues int
+	// WeeklyDigest keeps a recurring event at WeeklyDigestTime on Sundays,
+	// in WeeklyDigestTimeZone, listing the issues due the following week.
+	WeeklyDigest         bool
+	WeeklyDigestTime     string
+	WeeklyDigestTimeZone string
+	// MorningAgendaTime, if set, sends the synced issues due each day after
+	// that time of day, in MorningAgendaTimeZone, through the Notify sinks.
+	MorningAgendaTime     string
+	MorningAgendaTimeZone string
+	// NotifySlackWebhookURL, NotifyNtfyURL and NotifyEmailTo select where
+	// notifications are sent; email goes through NotifySMTPAddr.
+	NotifySlackWebhookURL string
+	NotifyNtfyURL         string
+	NotifyNtfyToken       string
+	NotifyEmailTo         []string
+	NotifyEmailFrom       string
+	NotifySMTPAddr        string
+	NotifySMTPUsername    string
+	NotifySMTPPassword    string
+	// YouTrackOutbox queues YouTrack writes while YouTrack is unreachable,
+	// dropping those older than YouTrackOutboxMaxAge.
+	YouTrackOutbox       bool
+	YouTrackOutboxMaxAge time.Duration
+	// YouTrackIssueFields replaces the fields requested for issues, and
+	// YouTrackPageSize the number of issues requested at a time.
+	YouTrackIssueFields string
+	YouTrackPageSize    int
+	// YouTrackLightPolling fetches issue details only for changed issues.
+	YouTrackLightPolling bool
+	// YouTrackHTTPCache revalidates cached YouTrack GET responses instead
+	// of downloading them again.
+	YouTrackHTTPCache bool
+	// BackupDir, if set, receives a backup of the local state whenever
+	// BackupSchedule fires, keeping the newest BackupKeep. Each backup is
+	// also PUT to BackupUploadURL, with "{name}" replaced by the file name
+	// and BackupUploadToken as bearer token, if set.
+	BackupDir         string
+	BackupSchedule    string
+	BackupKeep        int
+	BackupUploadURL   string
+	BackupUploadToken string
 }
 
-func SetENV() {
+// SetENV loads ./.env into the environment, see LoadEnvFile.
+func SetENV() error {
+	return LoadEnvFile("./.env")
+}
+
+// LoadEnvFile sets the KEY=value lines of the file at path as environment
+// variables. A missing file is not an error.
+func LoadEnvFile(path string) error {
 	// Open the .env file
-	envFile, err := os.Open("./.env")
+	envFile, err := os.Open(path)
+	// the file is optional when everything is set in the environment
+	if os.IsNotExist(err) {
+		return nil
+	}
 	// check for errors
 	if err != nil {
-		log.Fatalln(err)
+		return fmt.Errorf("failed to open %s: %w", path, err)
 	}
 	//	defer closing the file until the function exits
 	defer envFile.Close()
@@ -53,35 +291,278 @@ func SetENV() {
 	}
 	// check for errors with scanner.Scan
 	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to read %s: %w", path, err)
 	}
+	return nil
 }
 
 func LoadConfig() (*Config, error) {
-	SetENV()
+	if err := SetENV(); err != nil {
+		return nil, err
+	}
 
 	cfg := &Config{
-		YouTrackBaseURL:        os.Getenv("YOUTRACK_BASE_URL"),
-		YouTrackPermanentToken: os.Getenv("YOUTRACK_PERMANENT_TOKEN"),
-		YouTrackProjectID:      os.Getenv("YOUTRACK_PROJECT_ID"),
-		YouTrackQueryProjectID: os.Getenv("YOUTRACK_QUERY_PROJECT_ID"),
-		GoogleClientID:         os.Getenv("GOOGLE_CLIENT_ID"),
-		GoogleClientSecret:     os.Getenv("GOOGLE_CLIENT_SECRET"),
-		GoogleRedirectURL:      os.Getenv("GOOGLE_REDIRECT_URL"),
-		GoogleCalendarId:       os.Getenv("GOOGLE_CALENDAR_ID"),
+		YouTrackBaseURL:         os.Getenv("YOUTRACK_BASE_URL"),
+		YouTrackPermanentToken:  os.Getenv("YOUTRACK_PERMANENT_TOKEN"),
+		YouTrackProjectID:       os.Getenv("YOUTRACK_PROJECT_ID"),
+		YouTrackQueryProjectID:  os.Getenv("YOUTRACK_QUERY_PROJECT_ID"),
+		YouTrackSavedSearch:     os.Getenv("YOUTRACK_SAVED_SEARCH"),
+		GoogleClientID:          os.Getenv("GOOGLE_CLIENT_ID"),
+		GoogleClientSecret:      os.Getenv("GOOGLE_CLIENT_SECRET"),
+		GoogleRedirectURL:       os.Getenv("GOOGLE_REDIRECT_URL"),
+		GoogleCalendarId:        os.Getenv("GOOGLE_CALENDAR_ID"),
+		GoogleCalendarName:      os.Getenv("GOOGLE_CALENDAR_NAME"),
+		GoogleCalendarShareWith: splitList(os.Getenv("GOOGLE_CALENDAR_SHARE_WITH")),
+		YouTrackManagedFields:   splitList(os.Getenv("YOUTRACK_MANAGED_FIELDS")),
+		GoogleManagedFields:     splitList(os.Getenv("GOOGLE_MANAGED_FIELDS")),
+		DescriptionTemplate:     os.Getenv("EVENT_DESCRIPTION_TEMPLATE"),
+		ResolvedAction:          os.Getenv("YOUTRACK_RESOLVED_ACTION"),
+		SubtaskMode:             os.Getenv("YOUTRACK_SUBTASKS"),
+		DependencyCheck:         os.Getenv("YOUTRACK_DEPENDENCY_CHECK"),
+		ConflictCheck:           os.Getenv("YOUTRACK_CONFLICT_CHECK"),
+		GoogleEventCopies:       os.Getenv("GOOGLE_EVENT_COPIES"),
+		GoogleArchiveCalendarID: os.Getenv("GOOGLE_ARCHIVE_CALENDAR_ID"),
+		YouTrackResponseField:   os.Getenv("YOUTRACK_RESPONSE_FIELD"),
+		DeclinedPriority:        os.Getenv("YOUTRACK_DECLINED_PRIORITY"),
+		DeclinedAction:          os.Getenv("GOOGLE_DECLINED_ACTION"),
+		YouTrackConferenceField: os.Getenv("YOUTRACK_CONFERENCE_FIELD"),
+		YouTrackLocationField:   os.Getenv("YOUTRACK_LOCATION_FIELD"),
+		WebhookAddr:             os.Getenv("WEBHOOK_ADDR"),
+		WebhookSecret:           os.Getenv("WEBHOOK_SECRET"),
+		GooglePushURL:           os.Getenv("GOOGLE_PUSH_URL"),
+		YouTrackIssueType:       os.Getenv("YOUTRACK_ISSUE_TYPE"),
+		YouTrackIssueTypeRules:  os.Getenv("YOUTRACK_ISSUE_TYPE_RULES"),
+		HookCreateIssue:         os.Getenv("SYNC_HOOK_CREATE_ISSUE"),
+		HookUpdateIssue:         os.Getenv("SYNC_HOOK_UPDATE_ISSUE"),
+		HookCreateEvent:         os.Getenv("SYNC_HOOK_CREATE_EVENT"),
+		HookUpdateEvent:         os.Getenv("SYNC_HOOK_UPDATE_EVENT"),
+		YouTrackDefaultFields:   os.Getenv("YOUTRACK_DEFAULT_FIELDS"),
+		YouTrackDefaultTags:     splitList(os.Getenv("YOUTRACK_DEFAULT_TAGS")),
+		YouTrackTagHashtags:     splitList(os.Getenv("YOUTRACK_TAG_HASHTAGS")),
+		YouTrackTagColors:       os.Getenv("YOUTRACK_TAG_COLORS"),
+		GoogleEventPrefix:       os.Getenv("GOOGLE_EVENT_PREFIX"),
+		GoogleEventSuffix:       os.Getenv("GOOGLE_EVENT_SUFFIX"),
+		GoogleEventVisibility:   os.Getenv("GOOGLE_EVENT_VISIBILITY"),
+		GoogleEventTransparency: os.Getenv("GOOGLE_EVENT_TRANSPARENCY"),
+		AssigneeFallback:        os.Getenv("YOUTRACK_ASSIGNEE_FALLBACK"),
+		HTTPCAFile:              os.Getenv("HTTP_CA_FILE"),
+		HTTPRecordDir:           os.Getenv("HTTP_RECORD_DIR"),
+		HTTPReplayDir:           os.Getenv("HTTP_REPLAY_DIR"),
+		SyncSchedule:            os.Getenv("SYNC_SCHEDULE"),
+		StartDate:               os.Getenv("SYNC_START_DATE"),
+		EventTiming:             os.Getenv("GOOGLE_EVENT_TIMING"),
+		EventTime:               os.Getenv("GOOGLE_EVENT_TIME"),
+		EventDuration:           os.Getenv("GOOGLE_EVENT_DURATION"),
+		PriorityDurations:       os.Getenv("GOOGLE_EVENT_DURATION_BY_PRIORITY"),
+		TypeDurations:           os.Getenv("GOOGLE_EVENT_DURATION_BY_TYPE"),
+		DueDateBoundary:         os.Getenv("GOOGLE_DUE_DATE_BOUNDARY"),
+		WorkingHours:            os.Getenv("GOOGLE_WORKING_HOURS"),
+		HolidayCalendar:         os.Getenv("GOOGLE_HOLIDAY_CALENDAR"),
+		HolidayAction:           os.Getenv("GOOGLE_HOLIDAY_ACTION"),
+		PlannerEstimateField:    os.Getenv("PLANNER_ESTIMATE_FIELD"),
+		WeeklyDigestTime:        os.Getenv("GOOGLE_WEEKLY_DIGEST_TIME"),
+		WeeklyDigestTimeZone:    os.Getenv("GOOGLE_WEEKLY_DIGEST_TIME_ZONE"),
+		MorningAgendaTime:       os.Getenv("MORNING_AGENDA_TIME"),
+		MorningAgendaTimeZone:   os.Getenv("MORNING_AGENDA_TIME_ZONE"),
+		NotifySlackWebhookURL:   os.Getenv("NOTIFY_SLACK_WEBHOOK_URL"),
+		NotifyNtfyURL:           os.Getenv("NOTIFY_NTFY_URL"),
+		NotifyNtfyToken:         os.Getenv("NOTIFY_NTFY_TOKEN"),
+		NotifyEmailTo:           splitList(os.Getenv("NOTIFY_EMAIL_TO")),
+		NotifyEmailFrom:         os.Getenv("NOTIFY_EMAIL_FROM"),
+		NotifySMTPAddr:          os.Getenv("NOTIFY_SMTP_ADDR"),
+		NotifySMTPUsername:      os.Getenv("NOTIFY_SMTP_USERNAME"),
+		NotifySMTPPassword:      os.Getenv("NOTIFY_SMTP_PASSWORD"),
+		DatabaseURL:             os.Getenv("DATABASE_URL"),
+		DataDir:                 os.Getenv("DATA_DIR"),
+		GoogleAuthFlow:          strings.ToLower(os.Getenv("GOOGLE_AUTH_FLOW")),
+		AdminAddr:               os.Getenv("ADMIN_ADDR"),
+		AdminToken:              os.Getenv("ADMIN_TOKEN"),
+		BackupDir:               os.Getenv("BACKUP_DIR"),
+		BackupSchedule:          os.Getenv("BACKUP_SCHEDULE"),
+		BackupUploadURL:         os.Getenv("BACKUP_UPLOAD_URL"),
+		BackupUploadToken:       os.Getenv("BACKUP_UPLOAD_TOKEN"),
+	}
+	if value, ok := os.LookupEnv("GOOGLE_SKIP_EVENT_TYPES"); ok {
+		cfg.GoogleSkipEventTypes = append([]string{}, splitList(value)...)
+	}
+	cfg.GoogleIgnoreSenders = splitList(os.Getenv("GOOGLE_IGNORE_SENDERS"))
+	cfg.GoogleIgnoreProperties = splitList(os.Getenv("GOOGLE_IGNORE_PROPERTIES"))
+
+	var err error
+	if cfg.IncludeDrafts, err = parseBool("YOUTRACK_INCLUDE_DRAFTS"); err != nil {
+		return nil, err
+	}
+	if cfg.IncludeResolved, err = parseBool("YOUTRACK_INCLUDE_RESOLVED"); err != nil {
+		return nil, err
+	}
+	if cfg.LinkRecurringInstances, err = parseBool("YOUTRACK_LINK_RECURRING"); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPInsecureSkipVerify, err = parseBool("HTTP_INSECURE_SKIP_VERIFY"); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPDebug, err = parseBool("HTTP_DEBUG"); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPDebugBodies, err = parseBool("HTTP_DEBUG_BODIES"); err != nil {
+		return nil, err
+	}
+	cfg.OTLPTracing = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+	if cfg.YouTrackHTTPTimeout, err = parseDuration("YOUTRACK_HTTP_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.GoogleHTTPTimeout, err = parseDuration("GOOGLE_HTTP_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPBreakerThreshold, err = parseInt("HTTP_BREAKER_THRESHOLD"); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPBreakerCooldown, err = parseDuration("HTTP_BREAKER_COOLDOWN", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.DriftThreshold, err = parseInt("DRIFT_THRESHOLD"); err != nil {
+		return nil, err
+	}
+	if cfg.DriftCheckInterval, err = parseDuration("DRIFT_CHECK_INTERVAL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.EchoWindow, err = parseDuration("SYNC_ECHO_WINDOW", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ClockSkew, err = parseDuration("SYNC_CLOCK_SKEW", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.GooglePushTTL, err = parseDuration("GOOGLE_PUSH_TTL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.GooglePushRenewBefore, err = parseDuration("GOOGLE_PUSH_RENEW_BEFORE", time.Hour); err != nil {
+		return nil, err
+	}
+	cfg.YouTrackIssueFields = os.Getenv("YOUTRACK_ISSUE_FIELDS")
+	if cfg.YouTrackPageSize, err = parseInt("YOUTRACK_PAGE_SIZE"); err != nil {
+		return nil, err
+	}
+	if cfg.YouTrackLightPolling, err = parseBool("YOUTRACK_LIGHT_POLLING"); err != nil {
+		return nil, err
+	}
+	if cfg.Paused, err = parseBool("SYNC_PAUSED"); err != nil {
+		return nil, err
+	}
+	if cfg.GoogleCreateCalendar, err = parseBool("GOOGLE_CREATE_CALENDAR"); err != nil {
+		return nil, err
+	}
+	if cfg.SkipWeekends, err = parseBool("GOOGLE_SKIP_WEEKENDS"); err != nil {
+		return nil, err
+	}
+	if cfg.SkipWeekends && cfg.WorkingHours == "" {
+		return nil, fmt.Errorf("GOOGLE_WORKING_HOURS not set (required by GOOGLE_SKIP_WEEKENDS)")
+	}
+	if cfg.PlannerHorizon, err = parseDuration("PLANNER_HORIZON", 14*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.PlannerBlockLength, err = parseDuration("PLANNER_BLOCK_LENGTH", 2*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.DeadlineRollup, err = parseBool("GOOGLE_DEADLINE_ROLLUP"); err != nil {
+		return nil, err
+	}
+	if cfg.RollupHorizon, err = parseDuration("GOOGLE_ROLLUP_HORIZON", 14*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.RollupTitleIssues, err = parseInt("GOOGLE_ROLLUP_TITLE_ISSUES"); err != nil {
+		return nil, err
+	}
+	if cfg.WeeklyDigest, err = parseBool("GOOGLE_WEEKLY_DIGEST"); err != nil {
+		return nil, err
+	}
+	if cfg.YouTrackHTTPCache, err = parseBool("YOUTRACK_HTTP_CACHE"); err != nil {
+		return nil, err
+	}
+	if cfg.YouTrackOutbox, err = parseBool("YOUTRACK_OUTBOX"); err != nil {
+		return nil, err
+	}
+	if cfg.YouTrackOutboxMaxAge, err = parseDuration("YOUTRACK_OUTBOX_MAX_AGE", 72*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.AssignOrganizer, err = parseBool("YOUTRACK_ASSIGN_ORGANIZER"); err != nil {
+		return nil, err
+	}
+	if cfg.YouTrackHashtagTags, err = parseBool("YOUTRACK_HASHTAG_TAGS"); err != nil {
+		return nil, err
+	}
+	if cfg.ProvenanceComment, err = parseBool("YOUTRACK_PROVENANCE_COMMENT"); err != nil {
+		return nil, err
+	}
+	if cfg.SyncDescriptions, err = parseBool("SYNC_DESCRIPTIONS"); err != nil {
+		return nil, err
+	}
+	if cfg.DeclinedClearsDueDate, err = parseBool("YOUTRACK_DECLINED_CLEARS_DUE_DATE"); err != nil {
+		return nil, err
+	}
+	if cfg.YouTrackResponseValues, err = parseMap("YOUTRACK_RESPONSE_VALUES"); err != nil {
+		return nil, err
+	}
+	if cfg.YouTrackResponseStates, err = parseMap("YOUTRACK_RESPONSE_STATES"); err != nil {
+		return nil, err
+	}
+	if cfg.MinAttendees, err = parseInt("GOOGLE_MIN_ATTENDEES"); err != nil {
+		return nil, err
+	}
+	if cfg.BackupKeep, err = parseInt("BACKUP_KEEP"); err != nil {
+		return nil, err
 	}
 
 	if cfg.YouTrackBaseURL == "" {
 		return nil, fmt.Errorf("YOUTRACK_BASE_URL not set")
 	}
-	if cfg.YouTrackPermanentToken == "" {
+	tenantsFile, mappingsFile := os.Getenv("TENANTS_FILE"), os.Getenv("MAPPINGS_FILE")
+	if tenantsFile == "" && cfg.YouTrackPermanentToken == "" {
 		return nil, fmt.Errorf("YOUTRACK_PERMANENT_TOKEN not set")
 	}
-	if cfg.YouTrackProjectID == "" {
-		return nil, fmt.Errorf("YOUTRACK_PROJECT_ID not set")
+	switch {
+	case tenantsFile != "":
+		if mappingsFile != "" {
+			return nil, fmt.Errorf("TENANTS_FILE and MAPPINGS_FILE cannot both be set")
+		}
+		if cfg.Tenants, err = LoadTenants(tenantsFile); err != nil {
+			return nil, err
+		}
+		for _, t := range cfg.Tenants {
+			cfg.Mappings = append(cfg.Mappings, t.Mappings...)
+		}
+	case mappingsFile != "":
+		if cfg.Mappings, err = LoadMappings(mappingsFile); err != nil {
+			return nil, err
+		}
+	default:
+		if cfg.YouTrackProjectID == "" {
+			return nil, fmt.Errorf("YOUTRACK_PROJECT_ID not set")
+		}
+		if cfg.YouTrackSavedSearch != "" && cfg.YouTrackQueryProjectID != "" {
+			return nil, fmt.Errorf("YOUTRACK_SAVED_SEARCH and YOUTRACK_QUERY_PROJECT_ID cannot both be set")
+		}
+		if cfg.YouTrackQueryProjectID == "" {
+			cfg.YouTrackQueryProjectID = cfg.YouTrackProjectID
+		}
+		cfg.Mappings = []Mapping{{
+			YouTrackProjectID:      cfg.YouTrackProjectID,
+			YouTrackQueryProjectID: cfg.YouTrackQueryProjectID,
+			YouTrackSavedSearch:    cfg.YouTrackSavedSearch,
+			GoogleCalendarID:       cfg.GoogleCalendarId,
+			GoogleCalendarName:     cfg.GoogleCalendarName,
+		}}
+	}
+	if _, err := ParseStartDate(cfg.StartDate); err != nil {
+		return nil, fmt.Errorf("SYNC_START_DATE: %w", err)
 	}
-	if cfg.YouTrackQueryProjectID == "" {
-		cfg.YouTrackQueryProjectID = cfg.YouTrackProjectID
+	for i := range cfg.Mappings {
+		cfg.ApplyMappingDefaults(&cfg.Mappings[i])
+	}
+	cfg.GoogleTokens = make(map[string]string)
+	for _, m := range cfg.Mappings {
+		if token := os.Getenv(AccountTokenEnv(m.GoogleAccount)); token != "" {
+			cfg.GoogleTokens[m.GoogleAccount] = token
+		}
 	}
 	if cfg.GoogleClientID == "" {
 		return nil, fmt.Errorf("GOOGLE_CLIENT_ID not set")
@@ -89,9 +570,174 @@ func LoadConfig() (*Config, error) {
 	if cfg.GoogleClientSecret == "" {
 		return nil, fmt.Errorf("GOOGLE_CLIENT_SECRET not set")
 	}
-	if cfg.GoogleRedirectURL == "" {
+	switch cfg.GoogleAuthFlow {
+	case "":
+		cfg.GoogleAuthFlow = "web"
+	case "web", "device":
+	default:
+		return nil, fmt.Errorf("GOOGLE_AUTH_FLOW must be web or device, got %q", cfg.GoogleAuthFlow)
+	}
+	if cfg.GoogleRedirectURL == "" && cfg.GoogleAuthFlow == "web" {
 		return nil, fmt.Errorf("GOOGLE_REDIRECT_URL not set")
 	}
+	if strings.EqualFold(cfg.ResolvedAction, "archive") && cfg.GoogleArchiveCalendarID == "" {
+		return nil, fmt.Errorf("GOOGLE_ARCHIVE_CALENDAR_ID not set (required by YOUTRACK_RESOLVED_ACTION=archive)")
+	}
+	if len(cfg.NotifyEmailTo) > 0 && cfg.NotifySMTPAddr == "" {
+		return nil, fmt.Errorf("NOTIFY_SMTP_ADDR not set (required by NOTIFY_EMAIL_TO)")
+	}
+	if len(cfg.NotifyEmailTo) > 0 && cfg.NotifyEmailFrom == "" {
+		return nil, fmt.Errorf("NOTIFY_EMAIL_FROM not set (required by NOTIFY_EMAIL_TO)")
+	}
+	if cfg.MorningAgendaTime != "" && cfg.NotifySlackWebhookURL == "" && cfg.NotifyNtfyURL == "" && len(cfg.NotifyEmailTo) == 0 {
+		return nil, fmt.Errorf("NOTIFY_SLACK_WEBHOOK_URL, NOTIFY_NTFY_URL or NOTIFY_EMAIL_TO not set (required by MORNING_AGENDA_TIME)")
+	}
+	if cfg.WebhookAddr != "" && cfg.WebhookSecret == "" {
+		return nil, fmt.Errorf("WEBHOOK_SECRET not set (required by WEBHOOK_ADDR)")
+	}
+	if cfg.GooglePushURL != "" {
+		if cfg.WebhookAddr == "" {
+			return nil, fmt.Errorf("WEBHOOK_ADDR not set (required by GOOGLE_PUSH_URL)")
+		}
+		if !strings.HasPrefix(cfg.GooglePushURL, "https://") {
+			return nil, fmt.Errorf("GOOGLE_PUSH_URL must be an https URL, got %q", cfg.GooglePushURL)
+		}
+		if ttl := cfg.GooglePushTTL; ttl > 0 && ttl <= cfg.GooglePushRenewBefore {
+			return nil, fmt.Errorf("GOOGLE_PUSH_TTL must exceed GOOGLE_PUSH_RENEW_BEFORE (%s), got %s", cfg.GooglePushRenewBefore, ttl)
+		}
+	}
+	if cfg.HTTPRecordDir != "" && cfg.HTTPReplayDir != "" {
+		return nil, fmt.Errorf("HTTP_RECORD_DIR and HTTP_REPLAY_DIR cannot be used together")
+	}
+	if cfg.AdminAddr != "" && cfg.AdminToken == "" {
+		return nil, fmt.Errorf("ADMIN_TOKEN not set (required by ADMIN_ADDR)")
+	}
+	if cfg.BackupDir != "" {
+		if strings.HasPrefix(cfg.DatabaseURL, "postgres://") || strings.HasPrefix(cfg.DatabaseURL, "postgresql://") {
+			return nil, fmt.Errorf("BACKUP_DIR only backs up SQLite state, back up DATABASE_URL with pg_dump")
+		}
+		if cfg.BackupSchedule == "" {
+			cfg.BackupSchedule = "0 3 * * *"
+		}
+		if cfg.BackupKeep < 0 {
+			return nil, fmt.Errorf("BACKUP_KEEP must not be negative, got %d", cfg.BackupKeep)
+		}
+		if cfg.BackupKeep == 0 {
+			cfg.BackupKeep = 7
+		}
+	} else if cfg.BackupUploadURL != "" {
+		return nil, fmt.Errorf("BACKUP_DIR not set (required by BACKUP_UPLOAD_URL)")
+	}
+	for _, t := range cfg.Tenants {
+		if t.AdminToken != "" && t.AdminToken == cfg.AdminToken {
+			return nil, fmt.Errorf("tenant %q: admin_token must differ from ADMIN_TOKEN", t.Name)
+		}
+	}
 
 	return cfg, nil
 }
+
+// ApplyMappingDefaults fills the settings m leaves unset with the global
+// ones of cfg, as LoadConfig does for the mappings it loads.
+func (cfg *Config) ApplyMappingDefaults(m *Mapping) {
+	if m.StartDate == "" {
+		m.StartDate = cfg.StartDate
+	}
+	if m.EventTiming == "" {
+		m.EventTiming = cfg.EventTiming
+	}
+	if m.EventTime == "" {
+		m.EventTime = cfg.EventTime
+	}
+	if m.EventDuration == "" {
+		m.EventDuration = cfg.EventDuration
+	}
+	if m.DueDateBoundary == "" {
+		m.DueDateBoundary = cfg.DueDateBoundary
+	}
+	if m.SyncDescriptions == nil {
+		syncDescriptions := cfg.SyncDescriptions
+		m.SyncDescriptions = &syncDescriptions
+	}
+	if m.MinAttendees == nil {
+		minAttendees := cfg.MinAttendees
+		m.MinAttendees = &minAttendees
+	}
+	if m.GoogleCalendarShareWith == nil {
+		m.GoogleCalendarShareWith = cfg.GoogleCalendarShareWith
+	}
+	if m.HolidayCalendar == "" {
+		m.HolidayCalendar = cfg.HolidayCalendar
+	}
+	if m.HolidayAction == "" {
+		m.HolidayAction = cfg.HolidayAction
+	}
+}
+
+// splitList splits a comma-separated value into its trimmed, non-empty parts.
+func splitList(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// parseBool reads an optional boolean environment variable, defaulting to false.
+func parseBool(key string) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean, got %q", key, value)
+	}
+	return b, nil
+}
+
+// parseInt reads an optional non-negative integer environment variable,
+// defaulting to zero.
+func parseInt(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", key, value)
+	}
+	return n, nil
+}
+
+// parseDuration reads an optional duration environment variable such as "30s".
+func parseDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration such as 30s, got %q", key, value)
+	}
+	return d, nil
+}
+
+// parseMap reads an optional comma-separated list of "key:value" pairs.
+func parseMap(key string) (map[string]string, error) {
+	pairs := splitList(os.Getenv(key))
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s entries must be key:value pairs, got %q", key, pair)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m, nil
+}
@@ -58,4 +58,4 @@ GOOGLE_REDIRECT_URL=https://localhost:8080
 	if cfg.GoogleRedirectURL != "https://localhost:8080" {
 		t.Errorf("expected google redirect url to be 'https://localhost:8080', got %s", cfg.GoogleRedirectURL)
 	}
-}
\ No newline at end of file
+}
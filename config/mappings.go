@@ -0,0 +1,150 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Mapping pairs a YouTrack project with a Google calendar. Settings other
+// than these are shared by all mappings.
+type Mapping struct {
+	// Name identifies the mapping in logs, commands and state. It is empty
+	// for the single mapping configured through environment variables.
+	Name                   string `json:"name"`
+	YouTrackProjectID      string `json:"youtrack_project_id"`
+	YouTrackQueryProjectID string `json:"youtrack_query_project_id"`
+	// YouTrackSavedSearch names a saved search selecting the synced issues
+	// instead of YouTrackQueryProjectID.
+	YouTrackSavedSearch string `json:"youtrack_saved_search"`
+	GoogleCalendarID    string `json:"google_calendar_id"`
+	// GoogleAccount names the Google account whose token is used; empty
+	// selects the default account.
+	GoogleAccount string `json:"google_account"`
+	// GoogleCalendarName names the calendar created with
+	// GOOGLE_CREATE_CALENDAR, and GoogleCalendarShareWith overrides the
+	// global GOOGLE_CALENDAR_SHARE_WITH.
+	GoogleCalendarName      string   `json:"google_calendar_name"`
+	GoogleCalendarShareWith []string `json:"google_calendar_share_with"`
+	// SyncSchedule overrides the global SYNC_SCHEDULE.
+	SyncSchedule string `json:"sync_schedule"`
+	// Disabled leaves the mapping out unless it is selected by name.
+	Disabled bool `json:"disabled"`
+	// Tenant names the tenant the mapping belongs to, see LoadTenants. It
+	// cannot be set in MAPPINGS_FILE.
+	Tenant string `json:"tenant,omitempty"`
+	// StartDate overrides the global SYNC_START_DATE, see ParseStartDate.
+	StartDate string `json:"start_date"`
+	// EventTiming, EventTime and EventDuration override the global
+	// GOOGLE_EVENT_TIMING, GOOGLE_EVENT_TIME and GOOGLE_EVENT_DURATION.
+	EventTiming   string `json:"event_timing"`
+	EventTime     string `json:"event_time"`
+	EventDuration string `json:"event_duration"`
+	// DueDateBoundary overrides the global GOOGLE_DUE_DATE_BOUNDARY.
+	DueDateBoundary string `json:"due_date_boundary"`
+	// SyncDescriptions overrides the global SYNC_DESCRIPTIONS.
+	SyncDescriptions *bool `json:"sync_descriptions"`
+	// MinAttendees overrides the global GOOGLE_MIN_ATTENDEES.
+	MinAttendees *int `json:"min_attendees"`
+	// HolidayCalendar and HolidayAction override the global
+	// GOOGLE_HOLIDAY_CALENDAR and GOOGLE_HOLIDAY_ACTION.
+	HolidayCalendar string `json:"holiday_calendar"`
+	HolidayAction   string `json:"holiday_action"`
+}
+
+// namePattern restricts mapping and account names, which are used in file
+// and schema names.
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// LoadMappings reads a JSON array of mappings from path.
+func LoadMappings(path string) ([]Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mappings: %w", err)
+	}
+	var mappings []Mapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse mappings %s: %w", path, err)
+	}
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("mappings file %s has no mappings", path)
+	}
+	for _, m := range mappings {
+		if m.Tenant != "" {
+			return nil, fmt.Errorf("mapping %q: tenant can only be set through TENANTS_FILE", m.Name)
+		}
+	}
+	if err := validateMappings(mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// validateMappings checks the mappings of a file and fills in defaults.
+func validateMappings(mappings []Mapping) error {
+	seen := make(map[string]bool)
+	for i := range mappings {
+		m := &mappings[i]
+		if !namePattern.MatchString(m.Name) {
+			return fmt.Errorf("mapping %d: name %q must be lowercase letters, digits, '-' or '_'", i+1, m.Name)
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("mapping %q is defined twice", m.Name)
+		}
+		seen[m.Name] = true
+		if m.GoogleAccount != "" && !namePattern.MatchString(m.GoogleAccount) {
+			return fmt.Errorf("mapping %q: google_account %q must be lowercase letters, digits, '-' or '_'", m.Name, m.GoogleAccount)
+		}
+		if m.YouTrackProjectID == "" {
+			return fmt.Errorf("mapping %q: youtrack_project_id not set", m.Name)
+		}
+		if m.YouTrackSavedSearch != "" && m.YouTrackQueryProjectID != "" {
+			return fmt.Errorf("mapping %q: youtrack_saved_search and youtrack_query_project_id cannot both be set", m.Name)
+		}
+		if m.YouTrackQueryProjectID == "" {
+			m.YouTrackQueryProjectID = m.YouTrackProjectID
+		}
+		if _, err := ParseStartDate(m.StartDate); err != nil {
+			return fmt.Errorf("mapping %q: start_date: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// ParseStartDate parses the date before which unsynced events and issues
+// are ignored: a day such as 2024-01-31, starting at local midnight, or an
+// RFC 3339 time. An empty value yields the zero time, ignoring nothing.
+func ParseStartDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date such as 2024-01-31 or an RFC 3339 time, got %q", value)
+	}
+	return t, nil
+}
+
+// AccountTokenEnv returns the environment variable holding the token of a
+// Google account: GOOGLE_TOKEN for the default account, GOOGLE_TOKEN_WORK
+// for "work".
+func AccountTokenEnv(account string) string {
+	if account == "" {
+		return "GOOGLE_TOKEN"
+	}
+	return "GOOGLE_TOKEN_" + strings.ToUpper(strings.ReplaceAll(account, "-", "_"))
+}
+
+// AccountTokenFile returns the token file name of a Google account.
+func AccountTokenFile(account string) string {
+	if account == "" {
+		return TokenFile
+	}
+	return "token-" + account + ".json"
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeMappings(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "mappings.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write mappings: %v", err)
+	}
+	return path
+}
+
+func TestLoadMappings(t *testing.T) {
+	path := writeMappings(t, `[
+		{"name": "work", "youtrack_project_id": "WORK", "google_calendar_id": "primary", "google_account": "work"},
+		{"name": "home", "youtrack_project_id": "HOME", "youtrack_query_project_id": "HOME-ALL", "google_calendar_id": "family@group.calendar.google.com", "sync_schedule": "0 8 * * *"}
+	]`)
+	mappings, err := LoadMappings(path)
+	if err != nil {
+		t.Fatalf("LoadMappings() error = %v", err)
+	}
+	if len(mappings) != 2 {
+		t.Fatalf("expected 2 mappings, got %d", len(mappings))
+	}
+	if mappings[0].YouTrackQueryProjectID != "WORK" {
+		t.Errorf("expected query project to default to 'WORK', got %s", mappings[0].YouTrackQueryProjectID)
+	}
+	if mappings[0].GoogleAccount != "work" || mappings[1].GoogleAccount != "" {
+		t.Errorf("unexpected accounts %q and %q", mappings[0].GoogleAccount, mappings[1].GoogleAccount)
+	}
+	if mappings[1].SyncSchedule != "0 8 * * *" {
+		t.Errorf("expected schedule '0 8 * * *', got %s", mappings[1].SyncSchedule)
+	}
+}
+
+func TestApplyMappingDefaults(t *testing.T) {
+	cfg := &Config{StartDate: "2024-01-01", EventTiming: "timed", HolidayAction: "flag", SyncDescriptions: true, MinAttendees: 2}
+	m := Mapping{Name: "work", EventTiming: "all-day"}
+	cfg.ApplyMappingDefaults(&m)
+	if m.StartDate != "2024-01-01" || m.HolidayAction != "flag" {
+		t.Errorf("expected the global settings, got start date %q and holiday action %q", m.StartDate, m.HolidayAction)
+	}
+	if m.EventTiming != "all-day" {
+		t.Errorf("expected the mapping's own event timing to be kept, got %q", m.EventTiming)
+	}
+	if m.SyncDescriptions == nil || !*m.SyncDescriptions || m.MinAttendees == nil || *m.MinAttendees != 2 {
+		t.Errorf("expected the global descriptions and attendee settings, got %v and %v", m.SyncDescriptions, m.MinAttendees)
+	}
+}
+
+func TestLoadMappingsErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":        `[]`,
+		"missing name": `[{"youtrack_project_id": "P"}]`,
+		"bad name":     `[{"name": "Work Calendar", "youtrack_project_id": "P"}]`,
+		"duplicate":    `[{"name": "a", "youtrack_project_id": "P"}, {"name": "a", "youtrack_project_id": "Q"}]`,
+		"bad account":  `[{"name": "a", "youtrack_project_id": "P", "google_account": "../x"}]`,
+		"no project":   `[{"name": "a"}]`,
+	} {
+		if _, err := LoadMappings(writeMappings(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAccountTokenNames(t *testing.T) {
+	if got := AccountTokenEnv(""); got != "GOOGLE_TOKEN" {
+		t.Errorf("expected GOOGLE_TOKEN, got %s", got)
+	}
+	if got := AccountTokenEnv("side-project"); got != "GOOGLE_TOKEN_SIDE_PROJECT" {
+		t.Errorf("expected GOOGLE_TOKEN_SIDE_PROJECT, got %s", got)
+	}
+	if got := AccountTokenFile(""); got != "token.json" {
+		t.Errorf("expected token.json, got %s", got)
+	}
+	if got := AccountTokenFile("work"); got != "token-work.json" {
+		t.Errorf("expected token-work.json, got %s", got)
+	}
+}
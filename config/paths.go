@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// appName names the application's directory under the XDG data home.
+const appName = "youtrack-gcal-sync"
+
+// LegacyDataDir is where older versions kept their state, relative to the
+// working directory.
+const LegacyDataDir = "data"
+
+// Files kept in the data directory.
+const (
+	TokenFile = "token.json"
+	DBFile    = "sync.db"
+)
+
+// dataFiles lists the files moved out of LegacyDataDir, including SQLite's
+// journal and write-ahead log.
+var dataFiles = []string{TokenFile, DBFile, DBFile + "-journal", DBFile + "-wal", DBFile + "-shm"}
+
+// DefaultDataDir returns $XDG_DATA_HOME/youtrack-gcal-sync, falling back to
+// ~/.local/share/youtrack-gcal-sync.
+func DefaultDataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine the data directory, set DATA_DIR: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", appName), nil
+}
+
+// PrepareDataDir creates dir if needed and moves state files left in
+// LegacyDataDir into it, unless dir already has a file of the same name.
+func PrepareDataDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if same, err := samePath(dir, LegacyDataDir); err != nil || same {
+		return err
+	}
+	for _, name := range dataFiles {
+		from, to := filepath.Join(LegacyDataDir, name), filepath.Join(dir, name)
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(to); err == nil {
+			log.Printf("Not migrating %s: %s already exists", from, to)
+			continue
+		}
+		if err := moveFile(from, to); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", from, err)
+		}
+		log.Printf("Migrated %s to %s", from, to)
+	}
+	return nil
+}
+
+func samePath(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return absA == absB, nil
+}
+
+// moveFile renames from to to, copying when they are on different devices.
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
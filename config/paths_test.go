@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultDataDir(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	dir, err := DefaultDataDir()
+	if err != nil {
+		t.Fatalf("DefaultDataDir() error = %v", err)
+	}
+	if dir != "/xdg/data/youtrack-gcal-sync" {
+		t.Errorf("expected '/xdg/data/youtrack-gcal-sync', got %s", dir)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", "/home/user")
+	dir, err = DefaultDataDir()
+	if err != nil {
+		t.Fatalf("DefaultDataDir() error = %v", err)
+	}
+	if dir != "/home/user/.local/share/youtrack-gcal-sync" {
+		t.Errorf("expected '/home/user/.local/share/youtrack-gcal-sync', got %s", dir)
+	}
+}
+
+func TestPrepareDataDirMigratesLegacyFiles(t *testing.T) {
+	work := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.Mkdir(LegacyDataDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{TokenFile, DBFile} {
+		if err := os.WriteFile(filepath.Join(LegacyDataDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := filepath.Join(work, "state", "nested")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, DBFile), []byte("newer"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PrepareDataDir(dir); err != nil {
+		t.Fatalf("PrepareDataDir() error = %v", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, TokenFile)); err != nil || string(data) != TokenFile {
+		t.Errorf("expected token to be migrated, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(LegacyDataDir, TokenFile)); !os.IsNotExist(err) {
+		t.Errorf("expected legacy token to be removed, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, DBFile)); string(data) != "newer" {
+		t.Errorf("expected existing database to be kept, got %q", data)
+	}
+}
+
+func TestPrepareDataDirLegacyDirUnchanged(t *testing.T) {
+	work := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := PrepareDataDir(LegacyDataDir); err != nil {
+		t.Fatalf("PrepareDataDir() error = %v", err)
+	}
+	if _, err := os.Stat(LegacyDataDir); err != nil {
+		t.Errorf("expected data directory to be created, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Tenant is a user served by a shared instance: their mappings sync with
+// their own YouTrack token and Google accounts, and keep their own state.
+type Tenant struct {
+	// Name identifies the tenant; it prefixes the names of its mappings and
+	// Google accounts, see LoadTenants.
+	Name string `json:"name"`
+	// YouTrackToken is the permanent token the mappings of the tenant use.
+	YouTrackToken string `json:"youtrack_token"`
+	// AdminToken, if set, authenticates the tenant on the admin API, which
+	// then only shows the tenant's own mappings.
+	AdminToken string    `json:"admin_token"`
+	Mappings   []Mapping `json:"mappings"`
+}
+
+// tenantPattern restricts tenant names. Without '-' or '_', the tenant
+// prefix of a mapping or account name cannot be confused with another's.
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// LoadTenants reads a JSON array of tenants from path. The mappings of each
+// tenant are validated like those of LoadMappings and then qualified with
+// the tenant: mapping "work" of tenant "alice" is named "alice-work" and
+// its Google account "home" becomes "alice-home", or "alice" when unset.
+// Mappings thereby keep apart the state and tokens of different tenants.
+func LoadTenants(path string) ([]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants: %w", err)
+	}
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants %s: %w", path, err)
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("tenants file %s has no tenants", path)
+	}
+
+	seen := make(map[string]bool)
+	adminTokens := make(map[string]bool)
+	for i := range tenants {
+		t := &tenants[i]
+		if err := ValidateTenant(*t); err != nil {
+			return nil, fmt.Errorf("tenant %d: %w", i+1, err)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("tenant %q is defined twice", t.Name)
+		}
+		seen[t.Name] = true
+		if t.AdminToken != "" {
+			if adminTokens[t.AdminToken] {
+				return nil, fmt.Errorf("tenant %q: admin_token is used by another tenant", t.Name)
+			}
+			adminTokens[t.AdminToken] = true
+		}
+		if len(t.Mappings) == 0 {
+			return nil, fmt.Errorf("tenant %q has no mappings", t.Name)
+		}
+		if err := validateMappings(t.Mappings); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", t.Name, err)
+		}
+		for j := range t.Mappings {
+			m := &t.Mappings[j]
+			m.Tenant = t.Name
+			m.Name = t.Name + "-" + m.Name
+			m.GoogleAccount = TenantAccount(t.Name, m.GoogleAccount)
+		}
+	}
+	return tenants, nil
+}
+
+// ValidateTenant checks the name and YouTrack token of t.
+func ValidateTenant(t Tenant) error {
+	if !tenantPattern.MatchString(t.Name) {
+		return fmt.Errorf("name %q must be lowercase letters or digits", t.Name)
+	}
+	if t.YouTrackToken == "" {
+		return fmt.Errorf("youtrack_token not set")
+	}
+	return nil
+}
+
+// ValidateMapping checks a single mapping like LoadMappings and fills in
+// defaults. The mapping of a tenant must already be qualified: its name and
+// Google account must start with the tenant, as LoadTenants names them.
+func ValidateMapping(m *Mapping) error {
+	mappings := []Mapping{*m}
+	if err := validateMappings(mappings); err != nil {
+		return err
+	}
+	*m = mappings[0]
+	if m.Tenant == "" {
+		return nil
+	}
+	prefix := m.Tenant + "-"
+	if !strings.HasPrefix(m.Name, prefix) {
+		return fmt.Errorf("mapping %q: name must start with %q", m.Name, prefix)
+	}
+	if m.GoogleAccount != m.Tenant && !strings.HasPrefix(m.GoogleAccount, prefix) {
+		return fmt.Errorf("mapping %q: google_account must be %q or start with %q", m.Name, m.Tenant, prefix)
+	}
+	return nil
+}
+
+// TenantAccount returns the name of a Google account of tenant.
+func TenantAccount(tenant, account string) string {
+	if account == "" {
+		return tenant
+	}
+	return tenant + "-" + account
+}
@@ -0,0 +1,49 @@
+package config
+
+import "testing"
+
+func TestLoadTenants(t *testing.T) {
+	path := writeMappings(t, `[
+		{"name": "alice", "youtrack_token": "perm:alice", "admin_token": "a", "mappings": [
+			{"name": "work", "youtrack_project_id": "WORK", "google_calendar_id": "primary"},
+			{"name": "home", "youtrack_project_id": "HOME", "google_calendar_id": "primary", "google_account": "home"}
+		]},
+		{"name": "bob", "youtrack_token": "perm:bob", "mappings": [
+			{"name": "work", "youtrack_project_id": "WORK", "google_calendar_id": "primary"}
+		]}
+	]`)
+	tenants, err := LoadTenants(path)
+	if err != nil {
+		t.Fatalf("LoadTenants() error = %v", err)
+	}
+	if len(tenants) != 2 || len(tenants[0].Mappings) != 2 || len(tenants[1].Mappings) != 1 {
+		t.Fatalf("unexpected tenants %+v", tenants)
+	}
+	work, home, bob := tenants[0].Mappings[0], tenants[0].Mappings[1], tenants[1].Mappings[0]
+	if work.Name != "alice-work" || work.GoogleAccount != "alice" || work.Tenant != "alice" {
+		t.Errorf("expected mapping alice-work of account alice, got %+v", work)
+	}
+	if home.Name != "alice-home" || home.GoogleAccount != "alice-home" {
+		t.Errorf("expected mapping alice-home of account alice-home, got %+v", home)
+	}
+	if bob.Name != "bob-work" || bob.GoogleAccount != "bob" || bob.YouTrackQueryProjectID != "WORK" {
+		t.Errorf("expected mapping bob-work of account bob, got %+v", bob)
+	}
+}
+
+func TestLoadTenantsErrors(t *testing.T) {
+	mapping := `{"name": "work", "youtrack_project_id": "WORK"}`
+	for name, content := range map[string]string{
+		"empty":        `[]`,
+		"bad name":     `[{"name": "al-ice", "youtrack_token": "t", "mappings": [` + mapping + `]}]`,
+		"duplicate":    `[{"name": "a", "youtrack_token": "t", "mappings": [` + mapping + `]}, {"name": "a", "youtrack_token": "u", "mappings": [` + mapping + `]}]`,
+		"no token":     `[{"name": "a", "mappings": [` + mapping + `]}]`,
+		"no mappings":  `[{"name": "a", "youtrack_token": "t"}]`,
+		"bad mapping":  `[{"name": "a", "youtrack_token": "t", "mappings": [{"name": "work"}]}]`,
+		"shared admin": `[{"name": "a", "youtrack_token": "t", "admin_token": "x", "mappings": [` + mapping + `]}, {"name": "b", "youtrack_token": "u", "admin_token": "x", "mappings": [` + mapping + `]}]`,
+	} {
+		if _, err := LoadTenants(writeMappings(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
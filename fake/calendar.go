@@ -0,0 +1,623 @@
+// Package fake provides in-memory YouTrack and Google Calendar servers that
+// implement the parts of both APIs used by the synchronizer, for integration
+// tests that exercise the real clients end to end.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const calendarPrefix = "/calendar/v3/calendars/{calendar}/events"
+
+// Calendar is a fake Google Calendar API. Every change bumps a sequence
+// number, and sync tokens list the events changed after the sequence they
+// were issued at, deleted events included.
+type Calendar struct {
+	*httptest.Server
+
+	mu        gosync.Mutex
+	calendars map[string]map[string]*storedEvent
+	seq       int
+	minSeq    int
+	nextID    int
+	stored    int
+	clock     clock
+	// summaries names the calendars created through the API, and acl
+	// holds the rules they were shared with.
+	summaries map[string]string
+	acl       map[string][]*calendar.AclRule
+	// channels holds the open push notification channels by ID.
+	channels map[string]*calendar.Channel
+}
+
+type storedEvent struct {
+	event *calendar.Event
+	seq   int
+	// order is the position of the event in the order of creation.
+	order int
+}
+
+// NewCalendar starts a fake Google Calendar server. Close it when done.
+func NewCalendar() *Calendar {
+	c := &Calendar{calendars: make(map[string]map[string]*storedEvent), summaries: make(map[string]string), acl: make(map[string][]*calendar.AclRule), channels: make(map[string]*calendar.Channel)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /calendar/v3/calendars", c.insertCalendar)
+	mux.HandleFunc("GET /calendar/v3/calendars/{calendar}", c.getCalendar)
+	mux.HandleFunc("GET /calendar/v3/calendars/{calendar}/acl", c.listRules)
+	mux.HandleFunc("POST /calendar/v3/calendars/{calendar}/acl", c.insertRule)
+	mux.HandleFunc("DELETE /calendar/v3/calendars/{calendar}/acl/{rule}", c.deleteRule)
+	mux.HandleFunc("GET "+calendarPrefix, c.list)
+	mux.HandleFunc("POST "+calendarPrefix, c.insert)
+	mux.HandleFunc("GET "+calendarPrefix+"/{id}", c.get)
+	mux.HandleFunc("PATCH "+calendarPrefix+"/{id}", c.patch)
+	mux.HandleFunc("DELETE "+calendarPrefix+"/{id}", c.delete)
+	mux.HandleFunc("POST "+calendarPrefix+"/{id}/move", c.move)
+	mux.HandleFunc("POST "+calendarPrefix+"/watch", c.watch)
+	mux.HandleFunc("POST /calendar/v3/channels/stop", c.stopChannel)
+	mux.HandleFunc("POST /calendar/v3/freeBusy", c.freeBusy)
+	c.Server = httptest.NewServer(mux)
+	return c
+}
+
+// Client returns an HTTP client that sends requests for Google APIs to the
+// fake server. Use it as the oauth2.HTTPClient of a googlecalendar.Client.
+func (c *Calendar) Client() *http.Client {
+	target, _ := url.Parse(c.URL)
+	return &http.Client{Transport: &redirectTransport{target: target, base: c.Server.Client().Transport}}
+}
+
+// AddEvent stores a copy of event in calendarID, assigning an ID when it has
+// none, and returns the stored event.
+func (c *Calendar) AddEvent(calendarID string, event *calendar.Event) *calendar.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := c.store(calendarID, copyEvent(event))
+	return copyEvent(stored.event)
+}
+
+// ModifyEvent applies modify to an event, as if it had been edited in the
+// calendar UI. It reports whether the event exists.
+func (c *Calendar) ModifyEvent(calendarID, eventID string, modify func(*calendar.Event)) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := c.lookup(calendarID, eventID)
+	if stored == nil {
+		return false
+	}
+	modify(stored.event)
+	c.touch(stored)
+	return true
+}
+
+// DeleteEvent cancels an event, as if it had been deleted in the calendar UI.
+func (c *Calendar) DeleteEvent(calendarID, eventID string) bool {
+	return c.ModifyEvent(calendarID, eventID, func(e *calendar.Event) { e.Status = "cancelled" })
+}
+
+// Event returns a copy of an event, including cancelled ones, or nil.
+func (c *Calendar) Event(calendarID, eventID string) *calendar.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stored := c.calendars[calendarID][eventID]; stored != nil {
+		return copyEvent(stored.event)
+	}
+	return nil
+}
+
+// Events returns copies of the events of calendarID that are not cancelled,
+// in the order they were created.
+func (c *Calendar) Events(calendarID string) []*calendar.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var events []*calendar.Event
+	for _, stored := range c.sorted(calendarID) {
+		if stored.event.Status != "cancelled" {
+			events = append(events, copyEvent(stored.event))
+		}
+	}
+	return events
+}
+
+// Calendars returns the IDs and names of the calendars created through the
+// API.
+func (c *Calendar) Calendars() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calendars := make(map[string]string, len(c.summaries))
+	for id, summary := range c.summaries {
+		calendars[id] = summary
+	}
+	return calendars
+}
+
+// ACL returns the rules calendarID was shared with.
+func (c *Calendar) ACL(calendarID string) []*calendar.AclRule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*calendar.AclRule(nil), c.acl[calendarID]...)
+}
+
+// Channels returns copies of the open push notification channels. Like
+// Google, the fake never posts to them.
+func (c *Calendar) Channels() []*calendar.Channel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channels := make([]*calendar.Channel, 0, len(c.channels))
+	for _, channel := range c.channels {
+		copied := *channel
+		channels = append(channels, &copied)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Id < channels[j].Id })
+	return channels
+}
+
+// ExpireSyncTokens invalidates every sync token issued so far; using one
+// fails with 410 Gone, as Google does after a while.
+func (c *Calendar) ExpireSyncTokens() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.minSeq = c.seq + 1
+}
+
+func (c *Calendar) list(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	query := r.URL.Query()
+
+	since := -1
+	if token := query.Get("syncToken"); token != "" {
+		seq, err := strconv.Atoi(strings.TrimPrefix(token, "sync-"))
+		if err != nil || seq < c.minSeq {
+			writeGoogleError(w, http.StatusGone, "Sync token is no longer valid, a full sync is required.")
+			return
+		}
+		since = seq
+	}
+	var timeMin, timeMax time.Time
+	if value := query.Get("timeMin"); value != "" {
+		timeMin, _ = time.Parse(time.RFC3339, value)
+	}
+	if value := query.Get("timeMax"); value != "" {
+		timeMax, _ = time.Parse(time.RFC3339, value)
+	}
+	showDeleted := query.Get("showDeleted") == "true" || since >= 0
+
+	events := &calendar.Events{Items: []*calendar.Event{}, NextSyncToken: fmt.Sprintf("sync-%d", c.seq)}
+	for _, stored := range c.sorted(r.PathValue("calendar")) {
+		switch {
+		case since >= 0 && stored.seq <= since:
+			continue
+		case stored.event.Status == "cancelled" && !showDeleted:
+			continue
+		case since < 0 && !timeMin.IsZero() && eventEnd(stored.event).Before(timeMin):
+			continue
+		case since < 0 && !timeMax.IsZero() && !localTime(stored.event.Start).Before(timeMax):
+			continue
+		}
+		events.Items = append(events.Items, stored.event)
+	}
+	writeJSON(w, events)
+}
+
+func (c *Calendar) insertCalendar(w http.ResponseWriter, r *http.Request) {
+	var cal calendar.Calendar
+	if err := json.NewDecoder(r.Body).Decode(&cal); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	cal.Id = fmt.Sprintf("calendar%d@group.calendar.google.com", c.nextID)
+	c.summaries[cal.Id] = cal.Summary
+	c.calendars[cal.Id] = make(map[string]*storedEvent)
+	writeJSON(w, &cal)
+}
+
+// getCalendar finds the primary calendar, created calendars and those
+// events were added to.
+func (c *Calendar) getCalendar(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := r.PathValue("calendar")
+	if _, ok := c.calendars[id]; !ok && id != "primary" {
+		writeGoogleError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, &calendar.Calendar{Id: id, Summary: c.summaries[id]})
+}
+
+func (c *Calendar) insertRule(w http.ResponseWriter, r *http.Request) {
+	var rule calendar.AclRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := r.PathValue("calendar")
+	if _, ok := c.calendars[id]; !ok && id != "primary" {
+		writeGoogleError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	// Like Google, sharing with a user or group again changes its role.
+	rule.Id = rule.Scope.Type + ":" + rule.Scope.Value
+	rules := c.acl[id]
+	for i, existing := range rules {
+		if existing.Id == rule.Id {
+			rules = append(rules[:i:i], rules[i+1:]...)
+			break
+		}
+	}
+	c.acl[id] = append(rules, &rule)
+	writeJSON(w, &rule)
+}
+
+func (c *Calendar) listRules(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := r.PathValue("calendar")
+	if _, ok := c.calendars[id]; !ok && id != "primary" {
+		writeGoogleError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, &calendar.Acl{Items: append([]*calendar.AclRule{}, c.acl[id]...)})
+}
+
+func (c *Calendar) deleteRule(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := r.PathValue("calendar")
+	for i, rule := range c.acl[id] {
+		if rule.Id == r.PathValue("rule") {
+			c.acl[id] = append(c.acl[id][:i:i], c.acl[id][i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeGoogleError(w, http.StatusNotFound, "Not Found")
+}
+
+// watch opens a channel for the events of a calendar, for the requested
+// ttl or a week.
+func (c *Calendar) watch(w http.ResponseWriter, r *http.Request) {
+	var channel calendar.Channel
+	if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if channel.Id == "" || channel.Type != "web_hook" || !strings.HasPrefix(channel.Address, "https://") {
+		writeGoogleError(w, http.StatusBadRequest, "Invalid channel")
+		return
+	}
+	if _, ok := c.channels[channel.Id]; ok {
+		writeGoogleError(w, http.StatusBadRequest, "Channel id not unique")
+		return
+	}
+	ttl := 7 * 24 * time.Hour
+	if seconds, err := strconv.Atoi(channel.Params["ttl"]); err == nil {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	channel.ResourceId = "events-" + r.PathValue("calendar")
+	channel.Expiration = time.Now().Add(ttl).UnixMilli()
+	c.channels[channel.Id] = &channel
+	writeJSON(w, &channel)
+}
+
+func (c *Calendar) stopChannel(w http.ResponseWriter, r *http.Request) {
+	var channel calendar.Channel
+	if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	open, ok := c.channels[channel.Id]
+	if !ok || open.ResourceId != channel.ResourceId {
+		writeGoogleError(w, http.StatusNotFound, "Channel not found")
+		return
+	}
+	delete(c.channels, channel.Id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Calendar) insert(w http.ResponseWriter, r *http.Request) {
+	var event calendar.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Like Google, IDs chosen by the client are taken once, even by events
+	// that were deleted since.
+	if event.Id != "" && c.lookup(r.PathValue("calendar"), event.Id) != nil {
+		writeGoogleError(w, http.StatusConflict, "The requested identifier already exists.")
+		return
+	}
+	stored := c.store(r.PathValue("calendar"), &event)
+	writeJSON(w, stored.event)
+}
+
+func (c *Calendar) get(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := c.lookup(r.PathValue("calendar"), r.PathValue("id"))
+	if stored == nil {
+		writeGoogleError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, stored.event)
+}
+
+// patch merges the top-level fields of the request, and the keys of its
+// extended properties, into the event.
+func (c *Calendar) patch(w http.ResponseWriter, r *http.Request) {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := c.lookup(r.PathValue("calendar"), r.PathValue("id"))
+	if stored == nil || stored.event.Status == "cancelled" {
+		writeGoogleError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	current, _ := json.Marshal(stored.event)
+	var merged map[string]json.RawMessage
+	json.Unmarshal(current, &merged)
+	for name, value := range fields {
+		merged[name] = value
+	}
+	data, _ := json.Marshal(merged)
+	var event calendar.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if previous := stored.event.ExtendedProperties; previous != nil && event.ExtendedProperties != nil {
+		// Like Google, patching extended properties only sets the given keys.
+		event.ExtendedProperties.Private = mergeProperties(previous.Private, event.ExtendedProperties.Private)
+		event.ExtendedProperties.Shared = mergeProperties(previous.Shared, event.ExtendedProperties.Shared)
+	}
+	stored.event = &event
+	c.touch(stored)
+	writeJSON(w, stored.event)
+}
+
+// mergeProperties returns the properties of previous updated with patch.
+func mergeProperties(previous, patch map[string]string) map[string]string {
+	if previous == nil {
+		return patch
+	}
+	merged := make(map[string]string, len(previous)+len(patch))
+	for key, value := range previous {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		merged[key] = value
+	}
+	return merged
+}
+
+func (c *Calendar) delete(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := c.lookup(r.PathValue("calendar"), r.PathValue("id"))
+	if stored == nil || stored.event.Status == "cancelled" {
+		writeGoogleError(w, http.StatusGone, "Resource has been deleted")
+		return
+	}
+	stored.event.Status = "cancelled"
+	c.touch(stored)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// move cancels the event in its calendar and stores it under the same ID in
+// the destination calendar.
+func (c *Calendar) move(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := c.lookup(r.PathValue("calendar"), r.PathValue("id"))
+	if stored == nil || stored.event.Status == "cancelled" {
+		writeGoogleError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	moved := copyEvent(stored.event)
+	stored.event.Status = "cancelled"
+	c.touch(stored)
+	writeJSON(w, c.store(r.URL.Query().Get("destination"), moved).event)
+}
+
+// freeBusy reports the periods covered by events that are not cancelled or
+// transparent, merged where they overlap. All-day events cover local days.
+func (c *Calendar) freeBusy(w http.ResponseWriter, r *http.Request) {
+	var request calendar.FreeBusyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	timeMin, _ := time.Parse(time.RFC3339, request.TimeMin)
+	timeMax, _ := time.Parse(time.RFC3339, request.TimeMax)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	response := &calendar.FreeBusyResponse{Calendars: make(map[string]calendar.FreeBusyCalendar)}
+	for _, item := range request.Items {
+		type period struct{ start, end time.Time }
+		var periods []period
+		for _, stored := range c.sorted(item.Id) {
+			event := stored.event
+			if event.Status == "cancelled" || event.Transparency == "transparent" {
+				continue
+			}
+			start, end := localTime(event.Start), localTime(event.End)
+			if !start.Before(timeMax) || !end.After(timeMin) {
+				continue
+			}
+			periods = append(periods, period{maxTime(start, timeMin), minTime(end, timeMax)})
+		}
+		sort.Slice(periods, func(i, j int) bool { return periods[i].start.Before(periods[j].start) })
+
+		busy := []*calendar.TimePeriod{}
+		var last period
+		for i, p := range periods {
+			if i > 0 && !p.start.After(last.end) {
+				last.end = maxTime(last.end, p.end)
+				busy[len(busy)-1].End = last.end.Format(time.RFC3339)
+				continue
+			}
+			last = p
+			busy = append(busy, &calendar.TimePeriod{Start: p.start.Format(time.RFC3339), End: p.end.Format(time.RFC3339)})
+		}
+		response.Calendars[item.Id] = calendar.FreeBusyCalendar{Busy: busy}
+	}
+	writeJSON(w, response)
+}
+
+// store adds event to a calendar; the caller holds c.mu.
+func (c *Calendar) store(calendarID string, event *calendar.Event) *storedEvent {
+	if event.Id == "" {
+		c.nextID++
+		event.Id = fmt.Sprintf("event%d", c.nextID)
+	}
+	if event.Status == "" {
+		event.Status = "confirmed"
+	}
+	if event.EventType == "" {
+		event.EventType = "default"
+	}
+	if c.calendars[calendarID] == nil {
+		c.calendars[calendarID] = make(map[string]*storedEvent)
+	}
+	c.stored++
+	stored := &storedEvent{event: event, order: c.stored}
+	c.calendars[calendarID][event.Id] = stored
+	c.touch(stored)
+	return stored
+}
+
+func (c *Calendar) lookup(calendarID, eventID string) *storedEvent {
+	return c.calendars[calendarID][eventID]
+}
+
+// touch records a change of stored; the caller holds c.mu.
+func (c *Calendar) touch(stored *storedEvent) {
+	c.seq++
+	stored.seq = c.seq
+	stored.event.Updated = c.clock.next().Format("2006-01-02T15:04:05.000Z")
+}
+
+func (c *Calendar) sorted(calendarID string) []*storedEvent {
+	var events []*storedEvent
+	for _, stored := range c.calendars[calendarID] {
+		events = append(events, stored)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].order < events[j].order })
+	return events
+}
+
+// eventEnd returns the end of an event, or the zero time when it has none.
+func eventEnd(event *calendar.Event) time.Time {
+	if event.End == nil {
+		return time.Time{}
+	}
+	if event.End.DateTime != "" {
+		t, _ := time.Parse(time.RFC3339, event.End.DateTime)
+		return t
+	}
+	t, _ := time.Parse("2006-01-02", event.End.Date)
+	return t
+}
+
+// localTime returns a start or end time; dates are local midnight.
+func localTime(dateTime *calendar.EventDateTime) time.Time {
+	if dateTime == nil {
+		return time.Time{}
+	}
+	if dateTime.DateTime != "" {
+		t, _ := time.Parse(time.RFC3339, dateTime.DateTime)
+		return t
+	}
+	t, _ := time.ParseInLocation("2006-01-02", dateTime.Date, time.Local)
+	return t
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func copyEvent(event *calendar.Event) *calendar.Event {
+	data, _ := json.Marshal(event)
+	var copied calendar.Event
+	json.Unmarshal(data, &copied)
+	return &copied
+}
+
+func writeGoogleError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"code": code, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// redirectTransport sends every request to target, keeping its path and
+// query.
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return t.base.RoundTrip(req)
+}
+
+// clock hands out strictly increasing timestamps, so that every change is
+// seen as newer than the previous one even within the same millisecond.
+type clock struct {
+	last time.Time
+}
+
+func (c *clock) next() time.Time {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(c.last) {
+		now = c.last.Add(time.Millisecond)
+	}
+	c.last = now
+	return now
+}
@@ -0,0 +1,717 @@
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"youtrack-calendar-sync/youtrack"
+)
+
+// YouTrack is a fake YouTrack REST API. Issues are matched by the project,
+// updated, summary, resolved, due date and issue id terms of the queries sent
+// by the client; other query terms and the fields parameter are ignored.
+type YouTrack struct {
+	*httptest.Server
+
+	mu      gosync.Mutex
+	issues  map[string]*youtrack.Issue
+	deleted []deletion
+	// created holds the creation times of the issues.
+	created map[string]int64
+	fields  map[string][]youtrack.ProjectCustomField
+	users   []youtrack.User
+	me      youtrack.User
+	tags    []youtrack.Tag
+	saved   []youtrack.SavedQuery
+	// dependsOn maps an issue ID to the IDs of the issues it depends on.
+	dependsOn map[string][]string
+	comments  map[string][]string
+	commands  map[string][]string
+	nextID    int
+	clock     clock
+	// unavailable answers every request with 503, see SetUnavailable.
+	unavailable bool
+}
+
+type deletion struct {
+	issue     youtrack.Issue
+	timestamp int64
+}
+
+// NewYouTrack starts a fake YouTrack server; its URL is the base URL for
+// youtrack.NewClient. Close it when done.
+func NewYouTrack() *YouTrack {
+	y := &YouTrack{
+		issues:    make(map[string]*youtrack.Issue),
+		created:   make(map[string]int64),
+		fields:    make(map[string][]youtrack.ProjectCustomField),
+		dependsOn: make(map[string][]string),
+		comments:  make(map[string][]string),
+		commands:  make(map[string][]string),
+		me:        youtrack.User{ID: "1-1", Login: "admin"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/issues", y.listIssues)
+	mux.HandleFunc("POST /api/issues", y.createIssue)
+	mux.HandleFunc("GET /api/issues/{id}", y.getIssue)
+	mux.HandleFunc("POST /api/issues/{id}", y.updateIssue)
+	mux.HandleFunc("POST /api/issues/{id}/tags", y.addTag)
+	mux.HandleFunc("GET /api/issues/{id}/links", y.links)
+	mux.HandleFunc("POST /api/issues/{id}/links/{link}/issues", y.addLink)
+	mux.HandleFunc("POST /api/issues/{id}/comments", y.addComment)
+	mux.HandleFunc("POST /api/commands", y.applyCommand)
+	mux.HandleFunc("GET /api/issueLinkTypes", y.linkTypes)
+	mux.HandleFunc("GET /api/activitiesPage", y.activitiesPage)
+	mux.HandleFunc("GET /api/users/me", y.currentUser)
+	mux.HandleFunc("GET /api/users", y.findUsers)
+	mux.HandleFunc("GET /api/tags", y.findTags)
+	mux.HandleFunc("GET /api/savedQueries", y.savedQueries)
+	mux.HandleFunc("GET /api/admin/projects/{project}/customFields", y.projectFields)
+	y.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		y.mu.Lock()
+		unavailable := y.unavailable
+		y.mu.Unlock()
+		if unavailable {
+			http.Error(w, "YouTrack is under maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return y
+}
+
+// SetUnavailable makes the server answer every request with 503 Service
+// Unavailable, as during maintenance, until it is called with false.
+func (y *YouTrack) SetUnavailable(unavailable bool) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.unavailable = unavailable
+}
+
+// AddIssue stores a copy of issue in projectID, assigning its IDs and update
+// time, and returns the stored issue.
+func (y *YouTrack) AddIssue(projectID string, issue youtrack.Issue) youtrack.Issue {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return copyIssue(y.store(projectID, &issue))
+}
+
+// ModifyIssue applies modify to an issue and bumps its update time, as if it
+// had been edited in YouTrack. It reports whether the issue exists.
+func (y *YouTrack) ModifyIssue(issueID string, modify func(*youtrack.Issue)) bool {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := y.lookup(issueID)
+	if issue == nil {
+		return false
+	}
+	modify(issue)
+	issue.Updated = y.clock.next().UnixMilli()
+	return true
+}
+
+// DeleteIssue removes an issue and records the deletion activity.
+func (y *YouTrack) DeleteIssue(issueID string) bool {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := y.lookup(issueID)
+	if issue == nil {
+		return false
+	}
+	delete(y.issues, issue.ID)
+	y.deleted = append(y.deleted, deletion{issue: *issue, timestamp: y.clock.next().UnixMilli()})
+	return true
+}
+
+// Issue returns a copy of an issue by database or readable ID, or nil.
+func (y *YouTrack) Issue(issueID string) *youtrack.Issue {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if issue := y.lookup(issueID); issue != nil {
+		copied := copyIssue(issue)
+		return &copied
+	}
+	return nil
+}
+
+// Issues returns copies of all issues, ordered by database ID.
+func (y *YouTrack) Issues() []youtrack.Issue {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return y.sorted()
+}
+
+// Tags returns the names of the tags added to an issue.
+func (y *YouTrack) Tags(issueID string) []string {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if issue := y.lookup(issueID); issue != nil {
+		return issue.TagNames()
+	}
+	return nil
+}
+
+// SetProjectFields sets the custom field schema of a project, mapping field
+// names to type IDs such as "date" or "enum[1]".
+func (y *YouTrack) SetProjectFields(projectID string, fields map[string]string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	var schema []youtrack.ProjectCustomField
+	for name, typeID := range fields {
+		var field youtrack.ProjectCustomField
+		field.Field.Name = name
+		field.Field.FieldType.ID = typeID
+		schema = append(schema, field)
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Name() < schema[j].Name() })
+	y.fields[projectID] = schema
+}
+
+// AddUser makes a user findable by email.
+func (y *YouTrack) AddUser(user youtrack.User) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.users = append(y.users, user)
+}
+
+// AddTag creates a tag that can be added to issues.
+func (y *YouTrack) AddTag(name string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.tags = append(y.tags, youtrack.Tag{ID: fmt.Sprintf("6-%d", len(y.tags)+1), Name: name})
+}
+
+// AddSavedQuery creates a saved search visible to the token owner.
+func (y *YouTrack) AddSavedQuery(name, query string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.saved = append(y.saved, youtrack.SavedQuery{ID: fmt.Sprintf("7-%d", len(y.saved)+1), Name: name, Query: query})
+}
+
+var (
+	projectTerm  = regexp.MustCompile(`project:\s*([^\s,()]+(?:\s*,\s*[^\s,()]+)*)`)
+	updatedTerm  = regexp.MustCompile(`updated:\s*(\S+)\s*\.\.`)
+	summaryTerm  = regexp.MustCompile(`summary:\s*"([^"]*)"`)
+	resolvedTerm = regexp.MustCompile(`State:\s*-Resolved|#Unresolved`)
+	dueTerm      = regexp.MustCompile(`Due Date:\s*(\S+)\s*\.\.\s*(\S+)`)
+	issueIDTerm  = regexp.MustCompile(`issue id:\s*([^\s,()]+(?:\s*,\s*[^\s,()]+)*)`)
+)
+
+func (y *YouTrack) listIssues(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	query := r.URL.Query().Get("query")
+
+	issues := []youtrack.Issue{}
+	for _, issue := range y.sorted() {
+		ok, err := matches(&issue, query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			issues = append(issues, issue)
+		}
+	}
+	writeJSON(w, page(issues, r.URL.Query()))
+}
+
+// matches reports whether issue matches the supported terms of query.
+func matches(issue *youtrack.Issue, query string) (bool, error) {
+	if m := projectTerm.FindStringSubmatch(query); m != nil && !inProject(issue, m[1]) {
+		return false, nil
+	}
+	if m := updatedTerm.FindStringSubmatch(query); m != nil {
+		since, err := time.ParseInLocation("2006-01-02T15:04:05", m[1], time.Local)
+		if err != nil {
+			return false, errors.New("invalid updated term")
+		}
+		if issue.Updated < since.UnixMilli() {
+			return false, nil
+		}
+	}
+	if m := summaryTerm.FindStringSubmatch(query); m != nil && issue.Summary != m[1] {
+		return false, nil
+	}
+	if resolvedTerm.MatchString(query) && issue.IsResolved() {
+		return false, nil
+	}
+	if m := issueIDTerm.FindStringSubmatch(query); m != nil && !hasID(issue, m[1]) {
+		return false, nil
+	}
+	if m := dueTerm.FindStringSubmatch(query); m != nil && !dueBetween(issue, m[1], m[2]) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (y *YouTrack) createIssue(w http.ResponseWriter, r *http.Request) {
+	var wrapper youtrack.IssueWrapper
+	if err := json.NewDecoder(r.Body).Decode(&wrapper); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if wrapper.Project == nil || wrapper.Project.ID == "" {
+		http.Error(w, "project is required", http.StatusBadRequest)
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := &youtrack.Issue{Summary: wrapper.Summary, Description: wrapper.Description}
+	setFields(issue, wrapper.CustomFields)
+	writeJSON(w, y.store(wrapper.Project.ID, issue))
+}
+
+func (y *YouTrack) getIssue(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := y.lookup(r.PathValue("id"))
+	if issue == nil {
+		http.Error(w, "issue not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, issue)
+}
+
+// updateIssue applies the summary, description and custom fields present in
+// the request.
+func (y *YouTrack) updateIssue(w http.ResponseWriter, r *http.Request) {
+	var update struct {
+		Summary      *string                       `json:"summary"`
+		Description  *string                       `json:"description"`
+		CustomFields []youtrack.CustomFieldWrapper `json:"customFields"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := y.lookup(r.PathValue("id"))
+	if issue == nil {
+		http.Error(w, "issue not found", http.StatusNotFound)
+		return
+	}
+	if update.Summary != nil {
+		issue.Summary = *update.Summary
+	}
+	if update.Description != nil {
+		issue.Description = *update.Description
+	}
+	setFields(issue, update.CustomFields)
+	issue.Updated = y.clock.next().UnixMilli()
+	writeJSON(w, issue)
+}
+
+func (y *YouTrack) addTag(w http.ResponseWriter, r *http.Request) {
+	var tag youtrack.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := y.lookup(r.PathValue("id"))
+	if issue == nil {
+		http.Error(w, "issue not found", http.StatusNotFound)
+		return
+	}
+	for _, known := range y.tags {
+		if known.ID == tag.ID {
+			if !slices.Contains(issue.TagNames(), known.Name) {
+				issue.Tags = append(issue.Tags, known)
+			}
+			writeJSON(w, known)
+			return
+		}
+	}
+	http.Error(w, "tag not found", http.StatusNotFound)
+}
+
+// The link types the fake knows.
+var (
+	subtaskLinkType = youtrack.IssueLinkType{ID: "82-0", Name: "Subtask", Directed: true, SourceToTarget: "parent for", TargetToSource: "subtask of"}
+	dependLinkType  = youtrack.IssueLinkType{ID: "82-2", Name: "Depend", Directed: true, SourceToTarget: "depends on", TargetToSource: "is required for"}
+)
+
+// AddDependency links issueID as depending on dependsOnID.
+func (y *YouTrack) AddDependency(issueID, dependsOnID string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	y.dependsOn[issueID] = append(y.dependsOn[issueID], dependsOnID)
+}
+
+// Comments returns the texts of the comments posted to an issue.
+func (y *YouTrack) Comments(issueID string) []string {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return append([]string(nil), y.comments[issueID]...)
+}
+
+// Commands returns the commands applied to an issue, in order.
+func (y *YouTrack) Commands(issueID string) []string {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return append([]string(nil), y.commands[issueID]...)
+}
+
+func (y *YouTrack) linkTypes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, []youtrack.IssueLinkType{subtaskLinkType, dependLinkType})
+}
+
+// links lists the dependencies of an issue; other links are not reported.
+func (y *YouTrack) links(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := y.lookup(r.PathValue("id"))
+	if issue == nil {
+		http.Error(w, "issue not found", http.StatusNotFound)
+		return
+	}
+	link := youtrack.IssueLink{Direction: "OUTWARD", LinkType: &dependLinkType, Issues: []youtrack.Issue{}}
+	for _, id := range y.dependsOn[issue.ID] {
+		if dependency := y.lookup(id); dependency != nil {
+			link.Issues = append(link.Issues, copyIssue(dependency))
+		}
+	}
+	writeJSON(w, []youtrack.IssueLink{link})
+}
+
+// addLink links the issue in the path to the posted issue: the posted issue
+// becomes a subtask of, or a dependency of, the issue in the path.
+func (y *YouTrack) addLink(w http.ResponseWriter, r *http.Request) {
+	var target youtrack.Issue
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	source, linked := y.lookup(r.PathValue("id")), y.lookup(target.ID)
+	if source == nil || linked == nil {
+		http.Error(w, "issue not found", http.StatusNotFound)
+		return
+	}
+	switch r.PathValue("link") {
+	case subtaskLinkType.ID + "s":
+		linked.Parent = &youtrack.IssueLink{Issues: []youtrack.Issue{{ID: source.ID, IDReadable: source.IDReadable}}}
+		linked.Updated = y.clock.next().UnixMilli()
+	case dependLinkType.ID + "s":
+		y.dependsOn[source.ID] = append(y.dependsOn[source.ID], linked.ID)
+	default:
+		http.Error(w, "link not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, youtrack.Issue{ID: linked.ID})
+}
+
+func (y *YouTrack) addComment(w http.ResponseWriter, r *http.Request) {
+	var comment struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	issue := y.lookup(r.PathValue("id"))
+	if issue == nil {
+		http.Error(w, "issue not found", http.StatusNotFound)
+		return
+	}
+	y.comments[issue.ID] = append(y.comments[issue.ID], comment.Text)
+	writeJSON(w, map[string]string{"id": fmt.Sprintf("4-%d", len(y.comments[issue.ID]))})
+}
+
+// applyCommand records commands and applies those of the form "Field value"
+// or "Field {value}", setting an enum or, for State, a state field.
+func (y *YouTrack) applyCommand(w http.ResponseWriter, r *http.Request) {
+	var command struct {
+		Query  string `json:"query"`
+		Issues []struct {
+			IDReadable string `json:"idReadable"`
+		} `json:"issues"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	for _, ref := range command.Issues {
+		issue := y.lookup(ref.IDReadable)
+		if issue == nil {
+			http.Error(w, "issue not found", http.StatusNotFound)
+			return
+		}
+		y.commands[issue.ID] = append(y.commands[issue.ID], command.Query)
+		if name, value, ok := strings.Cut(command.Query, " "); ok {
+			field := youtrack.EnumField(name, strings.TrimSuffix(strings.TrimPrefix(value, "{"), "}"))
+			if name == "State" {
+				field.Type = "StateIssueCustomField"
+			}
+			setFields(issue, []youtrack.CustomFieldWrapper{field})
+			issue.Updated = y.clock.next().UnixMilli()
+		}
+	}
+	writeJSON(w, map[string]any{})
+}
+
+// activitiesPage lists the activities of the requested categories on the
+// issues matching issueQuery since start, oldest first: the creation,
+// resolution and latest update of each issue, and the deletions. Deleted
+// issues are only matched by project. The cursor is the offset of the page.
+func (y *YouTrack) activitiesPage(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	params := r.URL.Query()
+	since, _ := strconv.ParseInt(params.Get("start"), 10, 64)
+	query := params.Get("issueQuery")
+	categories := make(map[string]bool)
+	for _, category := range strings.Split(params.Get("categories"), ",") {
+		categories[category] = true
+	}
+
+	type activity struct {
+		Timestamp int64          `json:"timestamp"`
+		Category  map[string]any `json:"category"`
+		Target    youtrack.Issue `json:"target"`
+	}
+	var activities []activity
+	add := func(category string, timestamp int64, issue youtrack.Issue) {
+		if categories[category] && timestamp >= since {
+			activities = append(activities, activity{Timestamp: timestamp, Category: map[string]any{"id": category}, Target: issue})
+		}
+	}
+	for _, issue := range y.sorted() {
+		ok, err := matches(&issue, query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			continue
+		}
+		created := y.created[issue.ID]
+		add(youtrack.CategoryIssueCreated, created, issue)
+		if issue.IsResolved() {
+			add(youtrack.CategoryIssueResolved, issue.Resolved, issue)
+		}
+		if issue.Updated != created {
+			add("CustomFieldCategory", issue.Updated, issue)
+		}
+	}
+	project := projectTerm.FindStringSubmatch(query)
+	for _, d := range y.deleted {
+		if project == nil || inProject(&d.issue, project[1]) {
+			add(youtrack.CategoryIssueDeleted, d.timestamp, youtrack.Issue{ID: d.issue.ID, IDReadable: d.issue.IDReadable})
+		}
+	}
+	sort.SliceStable(activities, func(i, j int) bool { return activities[i].Timestamp < activities[j].Timestamp })
+
+	offset, _ := strconv.Atoi(params.Get("cursor"))
+	offset = min(offset, len(activities))
+	end := len(activities)
+	if top, err := strconv.Atoi(params.Get("$top")); err == nil && top > 0 {
+		end = min(offset+top, end)
+	}
+	writeJSON(w, map[string]any{
+		"activities":  append([]activity{}, activities[offset:end]...),
+		"afterCursor": strconv.Itoa(end),
+		"hasAfter":    end < len(activities),
+	})
+}
+
+func (y *YouTrack) currentUser(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	writeJSON(w, y.me)
+}
+
+func (y *YouTrack) findUsers(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	query := strings.ToLower(r.URL.Query().Get("query"))
+	users := []youtrack.User{}
+	for _, user := range y.users {
+		if strings.Contains(strings.ToLower(user.Email), query) || strings.Contains(strings.ToLower(user.Login), query) {
+			users = append(users, user)
+		}
+	}
+	writeJSON(w, users)
+}
+
+func (y *YouTrack) findTags(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	query := r.URL.Query().Get("query")
+	tags := []youtrack.Tag{}
+	for _, tag := range y.tags {
+		if strings.Contains(tag.Name, query) {
+			tags = append(tags, tag)
+		}
+	}
+	writeJSON(w, tags)
+}
+
+func (y *YouTrack) savedQueries(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	writeJSON(w, append([]youtrack.SavedQuery{}, y.saved...))
+}
+
+// projectFields returns the schema set with SetProjectFields, or a due date
+// field only.
+func (y *YouTrack) projectFields(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	fields, ok := y.fields[r.PathValue("project")]
+	if !ok {
+		var dueDate youtrack.ProjectCustomField
+		dueDate.Field.Name = "Due Date"
+		dueDate.Field.FieldType.ID = "date"
+		fields = []youtrack.ProjectCustomField{dueDate}
+	}
+	writeJSON(w, fields)
+}
+
+// store adds issue to a project; the caller holds y.mu.
+func (y *YouTrack) store(projectID string, issue *youtrack.Issue) *youtrack.Issue {
+	y.nextID++
+	issue.ID = fmt.Sprintf("2-%d", y.nextID)
+	issue.IDReadable = fmt.Sprintf("%s-%d", projectID, y.nextID)
+	issue.Project = &youtrack.Project{YouTrackType: youtrack.YouTrackType{Type: "Project"}, ID: projectID, ShortName: projectID}
+	issue.Updated = y.clock.next().UnixMilli()
+	y.issues[issue.ID] = issue
+	y.created[issue.ID] = issue.Updated
+	return issue
+}
+
+func (y *YouTrack) lookup(issueID string) *youtrack.Issue {
+	if issue, ok := y.issues[issueID]; ok {
+		return issue
+	}
+	for _, issue := range y.issues {
+		if issue.IDReadable == issueID {
+			return issue
+		}
+	}
+	return nil
+}
+
+func (y *YouTrack) sorted() []youtrack.Issue {
+	var issues []youtrack.Issue
+	for _, issue := range y.issues {
+		issues = append(issues, copyIssue(issue))
+	}
+	sort.Slice(issues, func(i, j int) bool { return issueNumber(issues[i].ID) < issueNumber(issues[j].ID) })
+	return issues
+}
+
+func copyIssue(issue *youtrack.Issue) youtrack.Issue {
+	copied := *issue
+	copied.CustomFields = append([]youtrack.CustomField(nil), issue.CustomFields...)
+	copied.Tags = append([]youtrack.Tag(nil), issue.Tags...)
+	return copied
+}
+
+func issueNumber(id string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "2-"))
+	return n
+}
+
+// hasID reports whether issue is one of the comma-separated IDs of an
+// issue id term.
+func hasID(issue *youtrack.Issue, ids string) bool {
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if issue.ID == id || issue.IDReadable == id {
+			return true
+		}
+	}
+	return false
+}
+
+// dueBetween reports whether the due date of issue falls on a day from from
+// to to, both formatted as 2006-01-02.
+func dueBetween(issue *youtrack.Issue, from, to string) bool {
+	for _, cf := range issue.CustomFields {
+		if cf.Name != "Due Date" {
+			continue
+		}
+		millis, ok := cf.Value.(float64)
+		if !ok {
+			return false
+		}
+		day := time.UnixMilli(int64(millis)).Format("2006-01-02")
+		return day >= from && day <= to
+	}
+	return false
+}
+
+// page applies the $skip and $top parameters of a list request.
+func page(issues []youtrack.Issue, query url.Values) []youtrack.Issue {
+	if skip, err := strconv.Atoi(query.Get("$skip")); err == nil {
+		issues = issues[min(skip, len(issues)):]
+	}
+	if top, err := strconv.Atoi(query.Get("$top")); err == nil && top >= 0 {
+		issues = issues[:min(top, len(issues))]
+	}
+	return issues
+}
+
+// inProject reports whether issue belongs to one of the comma-separated
+// projects of a project term.
+func inProject(issue *youtrack.Issue, projects string) bool {
+	if issue.Project == nil {
+		return false
+	}
+	for _, project := range strings.Split(projects, ",") {
+		project = strings.TrimSpace(project)
+		if issue.Project.ID == project || issue.Project.ShortName == project {
+			return true
+		}
+	}
+	return false
+}
+
+// setFields sets or, for a nil value, clears custom fields of issue.
+func setFields(issue *youtrack.Issue, fields []youtrack.CustomFieldWrapper) {
+	for _, field := range fields {
+		value := field.Value
+		// Round-trip the value so that it reads back as the client decodes it.
+		if data, err := json.Marshal(map[string]any{"$type": field.Type, "name": field.Name, "value": value}); err == nil {
+			var decoded youtrack.CustomField
+			if json.Unmarshal(data, &decoded) == nil {
+				value = decoded.Value
+			}
+		}
+		replaced := false
+		for i := range issue.CustomFields {
+			if issue.CustomFields[i].Name == field.Name {
+				issue.CustomFields[i].Type = field.Type
+				issue.CustomFields[i].Value = value
+				replaced = true
+			}
+		}
+		if !replaced {
+			issue.CustomFields = append(issue.CustomFields, youtrack.CustomField{
+				YouTrackType: field.YouTrackType,
+				Name:         field.Name,
+				Value:        value,
+			})
+		}
+	}
+}
@@ -2,45 +2,188 @@ package googlecalendar
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"sync"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
+// Scopes of GetConfig: EventsScope covers events only, while CalendarScope
+// is also needed to create and share calendars.
+const (
+	EventsScope   = "https://www.googleapis.com/auth/calendar.events"
+	CalendarScope = "https://www.googleapis.com/auth/calendar"
+)
+
 // GetConfig returns an OAuth2 config for Google Calendar API.
 func GetConfig(clientID, clientSecret, redirectURL string) *oauth2.Config {
 	return &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL,
-		Scopes:       []string{"https://www.googleapis.com/auth/calendar.events"},
+		Scopes:       []string{EventsScope},
 		Endpoint:     google.Endpoint,
 	}
 }
 
-// GetTokenFromWeb uses a web flow to retrieve a token.
-func GetTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+// GetTokenFromWeb uses a web flow to retrieve a token. The token exchange uses
+// the HTTP client stored in ctx under oauth2.HTTPClient, if any.
+//
+// The request carries a random state and a PKCE challenge. When the redirect
+// URL points to localhost, the callback is received on that address;
+// otherwise the user pastes the code, or the whole URL they were redirected
+// to, whose state is then checked.
+func GetTokenFromWeb(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	state, err := randomState()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate state: %v", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
 	fmt.Printf("Go to the following link in your browser: \n%v\n", authURL)
 
 	var authCode string
-	fmt.Print("Enter authorization code: ")
-	_, err := fmt.Scan(&authCode)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read authorization code: %v", err)
+	if addr, path, ok := localCallback(config.RedirectURL); ok {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to listen for the authorization callback: %v", err)
+		}
+		fmt.Printf("Waiting for the authorization callback on %s...\n", config.RedirectURL)
+		authCode, err = receiveCallback(ctx, listener, path, state)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Print("Enter authorization code or the URL you were redirected to: ")
+		authCode, err = readCode(os.Stdin, state)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	token, err := config.Exchange(context.Background(), authCode)
+	token, err := config.Exchange(ctx, authCode, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve token from web: %v", err)
 	}
 	return token, nil
 }
 
+// localCallback returns the listen address and path of a redirect URL on
+// localhost, where the callback can be received directly.
+func localCallback(redirectURL string) (addr, path string, ok bool) {
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Scheme != "http" {
+		return "", "", false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+	default:
+		return "", "", false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+	path = u.Path
+	if path == "" {
+		path = "/"
+	}
+	return net.JoinHostPort(u.Hostname(), port), path, true
+}
+
+// receiveCallback serves the redirect on listener until a request with the
+// expected state arrives, and returns its authorization code.
+func receiveCallback(ctx context.Context, listener net.Listener, path, state string) (string, error) {
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		if msg := query.Get("error"); msg != "" {
+			http.Error(w, "authorization denied: "+msg, http.StatusBadRequest)
+			select {
+			case errs <- fmt.Errorf("authorization denied: %s", msg):
+			default:
+			}
+			return
+		}
+		fmt.Fprintln(w, "Authorization complete, you can close this window.")
+		select {
+		case codes <- query.Get("code"):
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	select {
+	case code := <-codes:
+		return code, nil
+	case err := <-errs:
+		return "", err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// readCode reads an authorization code from r. The input may also be the
+// full redirect URL, in which case its state must match.
+func readCode(r io.Reader, state string) (string, error) {
+	var input string
+	if _, err := fmt.Fscan(r, &input); err != nil {
+		return "", fmt.Errorf("unable to read authorization code: %v", err)
+	}
+	u, err := url.Parse(input)
+	if err != nil || !u.Query().Has("code") {
+		return input, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(u.Query().Get("state")), []byte(state)) != 1 {
+		return "", fmt.Errorf("authorization state mismatch, start again")
+	}
+	return u.Query().Get("code"), nil
+}
+
+// randomState returns an unguessable OAuth state value.
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetTokenFromDevice uses the OAuth device flow to retrieve a token: the user
+// enters a code on another device, so no redirect to this machine is needed.
+// The OAuth client must be of the "TVs and Limited Input devices" type.
+func GetTokenFromDevice(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	response, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start device authorization: %v", err)
+	}
+	fmt.Printf("On any device, go to %v and enter the code: %v\n", response.VerificationURI, response.UserCode)
+
+	token, err := config.DeviceAccessToken(ctx, response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve token from device authorization: %v", err)
+	}
+	return token, nil
+}
+
 // SaveToken saves a token to a file.
 func SaveToken(path string, token *oauth2.Token) error {
 	fmt.Printf("Saving credential file to: %s\n", path)
@@ -64,6 +207,35 @@ func LoadToken(path string) (*oauth2.Token, error) {
 	return token, err
 }
 
+// SavingTokenSource returns a TokenSource refreshing token with config and
+// passing each refreshed token to save, so that it outlives the process. The
+// refresh uses the HTTP client stored in ctx under oauth2.HTTPClient, if any.
+func SavingTokenSource(ctx context.Context, config *oauth2.Config, token *oauth2.Token, save func(*oauth2.Token)) oauth2.TokenSource {
+	return &savingTokenSource{base: config.TokenSource(ctx, token), save: save, last: token.AccessToken}
+}
+
+type savingTokenSource struct {
+	base oauth2.TokenSource
+	save func(*oauth2.Token)
+
+	mu   sync.Mutex
+	last string // access token saved or loaded last
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		s.save(token)
+		s.last = token.AccessToken
+	}
+	return token, nil
+}
+
 // GetClient returns an HTTP client with the given token.
 func GetClient(config *oauth2.Config, token *oauth2.Token) *http.Client {
 	return config.Client(context.Background(), token)
@@ -2,23 +2,97 @@ package googlecalendar
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+
+	"youtrack-calendar-sync/httpclient"
 )
 
+// ErrNotFound is wrapped by the errors of requests for missing events.
+var ErrNotFound = errors.New("not found")
+
+// ErrExists is wrapped by the error of CreateEvent when an event with the
+// given ID exists, e.g. because an earlier attempt created it.
+var ErrExists = errors.New("event exists")
+
+// rateLimitReasons are the reasons Google gives for answering 403 when a
+// quota is exceeded rather than access denied.
+var rateLimitReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+}
+
+// apiError returns the error of the failed request op as one of the
+// httpclient error types, see httpclient.APIError. Errors for missing
+// events wrap ErrNotFound, and a revoked token is an AuthError wrapping the
+// error of the token refresh, see IsTokenRevoked.
+func apiError(op string, err error) error {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		body := googleErr.Message
+		if body == "" {
+			body = googleErr.Body
+		}
+		for _, item := range googleErr.Errors {
+			if googleErr.Code == http.StatusForbidden && rateLimitReasons[item.Reason] {
+				return &httpclient.RateLimitError{APIError: httpclient.APIError{Service: "google", Op: op, Status: googleErr.Code, Body: body, Err: err}}
+			}
+		}
+		apiErr := httpclient.NewAPIError("google", op, googleErr.Code, googleErr.Header, body, err)
+		var notFound *httpclient.NotFoundError
+		if errors.As(apiErr, &notFound) {
+			notFound.Err = ErrNotFound
+		}
+		return apiErr
+	}
+	if IsTokenRevoked(err) {
+		status := http.StatusUnauthorized
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.Response != nil {
+			status = retrieveErr.Response.StatusCode
+		}
+		return &httpclient.AuthError{APIError: httpclient.APIError{Service: "google", Op: op, Status: status, Body: "invalid_grant", Err: err}}
+	}
+	return fmt.Errorf("failed to %s: %w", op, err)
+}
+
+// IsTokenRevoked reports whether err was caused by Google rejecting the
+// refresh token (invalid_grant), i.e. the authorization expired or was
+// revoked and the user has to authorize the application again.
+func IsTokenRevoked(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
+
 // Client wraps the Google Calendar service.
 type Client struct {
 	srv *calendar.Service
 }
 
-// NewClient creates a new Google Calendar client.
+// NewClient creates a new Google Calendar client. Requests are sent through
+// the HTTP client stored in ctx under oauth2.HTTPClient, if any, keeping its
+// timeout.
 func NewClient(ctx context.Context, token *oauth2.Token, config *oauth2.Config) (*Client, error) {
-	httpClient := config.Client(ctx, token)
+	return NewClientFromTokenSource(ctx, config.TokenSource(ctx, token))
+}
+
+// NewClientFromTokenSource is NewClient with the tokens of ts, such as a
+// SavingTokenSource.
+func NewClientFromTokenSource(ctx context.Context, ts oauth2.TokenSource) (*Client, error) {
+	httpClient := oauth2.NewClient(ctx, ts)
+	if base, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		httpClient.Timeout = base.Timeout
+	}
 	srv, err := calendar.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
@@ -26,10 +100,20 @@ func NewClient(ctx context.Context, token *oauth2.Token, config *oauth2.Config)
 	return &Client{srv: srv}, nil
 }
 
+// Google Calendar event types reported in Event.EventType.
+const (
+	EventTypeDefault         = "default"
+	EventTypeFocusTime       = "focusTime"
+	EventTypeOutOfOffice     = "outOfOffice"
+	EventTypeWorkingLocation = "workingLocation"
+)
+
 // Event represents a simplified Google Calendar event.
 type Event struct {
-	ID               string
-	Summary          string
+	ID      string
+	Summary string
+	// Description is the HTML, or plain text, description of the event.
+	Description      string
 	HTMLLink         string
 	Start            time.Time
 	End              time.Time
@@ -38,6 +122,68 @@ type Event struct {
 	Recurrence       []string
 	RecurringEventID string
 	Updated          time.Time
+	// EventType is the Google event type, e.g. "default", "focusTime",
+	// "outOfOffice" or "workingLocation".
+	EventType string
+	// ResponseStatus is the authenticated user's own attendee response
+	// ("accepted", "declined", "tentative" or "needsAction"), or empty when
+	// the user is not on the guest list.
+	ResponseStatus string
+	// Attendees is the number of guests on the guest list, resources such
+	// as rooms left out; events without a guest list have none.
+	Attendees int
+	// OrganizedBySelf is set when the authenticated user organizes the
+	// event.
+	OrganizedBySelf bool
+	// ConferenceURL is the video join link from the event's conference data
+	// (Google Meet, Zoom, ...), or empty when the event has none.
+	ConferenceURL string
+	// Location is the free-form event location.
+	Location string
+	// Attachments lists the Drive files attached to the event.
+	Attachments []Attachment
+	// AllDay is set for events that span whole days rather than a time.
+	// Start and End then fall at midnight UTC of their dates.
+	AllDay bool
+	// TimeZone is the IANA time zone the event is scheduled in, from its
+	// start or else its calendar, or empty when Google reports none. Start
+	// and End of timed events are expressed in it.
+	TimeZone string
+	// Transparency is "transparent" for events that do not block time.
+	Transparency string
+	// ColorID is the event color, "1" to "11", or empty for the color of
+	// its calendar.
+	ColorID string
+	// IssueID is the YouTrack issue the event was linked to, see SetIssueID.
+	// Google keeps it on copies of the event.
+	IssueID string
+	// Creator is the email of whoever created the event, which may differ
+	// from the organizer for events added by other applications.
+	Creator string
+	// Properties holds the private and shared extended properties of the
+	// event, which other applications use to tag the events they write.
+	Properties map[string]string
+	// WrittenAt is when CreateEvent or UpdateEvent last wrote the event, or
+	// the zero time if they never did.
+	WrittenAt time.Time
+	// Raw is the API event the Event was simplified from, for fields the
+	// Event leaves out. Changing it changes nothing on Google; use
+	// PatchEvent.
+	Raw *calendar.Event
+}
+
+// IssueIDProperty is the private extended property holding the ID of the
+// issue an event is linked to.
+const IssueIDProperty = "youtrackIssueId"
+
+// WrittenAtProperty is the private extended property marking events written
+// by the synchronizer with the time of the write, see Event.WrittenAt.
+const WrittenAtProperty = "youtrackSyncWrittenAt"
+
+// Attachment is a file attached to a Google Calendar event.
+type Attachment struct {
+	Title   string
+	FileURL string
 }
 
 // FetchEvents fetches events from the specified calendar ID.
@@ -57,7 +203,7 @@ func (c *Client) FetchEvents(calendarID, syncToken string) ([]*Event, string, er
 			eventsCall.SyncToken(syncToken)
 		} else {
 			// Initial sync, fetch all events
-			eventsCall.TimeMin(time.Now().Format(time.RFC3339)) 
+			eventsCall.TimeMin(time.Now().Format(time.RFC3339))
 		}
 
 		events, err := eventsCall.Do()
@@ -66,30 +212,11 @@ func (c *Client) FetchEvents(calendarID, syncToken string) ([]*Event, string, er
 			if googleErr, ok := err.(*googleapi.Error); ok && googleErr.Code == 410 {
 				return c.FetchEvents(calendarID, "")
 			}
-			return nil, "", fmt.Errorf("unable to retrieve events from calendar: %v", err)
+			return nil, "", apiError("retrieve events from calendar", err)
 		}
 
 		for _, item := range events.Items {
-			var organizer string
-			if item.Organizer != nil {
-				organizer = item.Organizer.Email
-			}
-			start := parseDateTime(item.Start)
-			end := parseDateTime(item.End)
-			updated, _ := time.Parse(time.RFC3339, item.Updated)
-
-			simplifiedEvents = append(simplifiedEvents, &Event{
-				ID:               item.Id,
-				Summary:          item.Summary,
-				HTMLLink:         item.HtmlLink,
-				Start:            start,
-				End:              end,
-				Status:           item.Status,
-				Organizer:        organizer,
-				Recurrence:       item.Recurrence,
-				RecurringEventID: item.RecurringEventId,
-				Updated:          updated,
-			})
+			simplifiedEvents = append(simplifiedEvents, newEvent(item, events.TimeZone))
 		}
 
 		if events.NextPageToken == "" {
@@ -99,12 +226,191 @@ func (c *Client) FetchEvents(calendarID, syncToken string) ([]*Event, string, er
 	}
 }
 
-func parseDateTime(dateTime *calendar.EventDateTime) time.Time {
+// ListEvents returns the events of calendarID that overlap from to to, with
+// recurring events expanded into their occurrences.
+func (c *Client) ListEvents(calendarID string, from, to time.Time) ([]*Event, error) {
+	var events []*Event
+	pageToken := ""
+	for {
+		items, err := c.srv.Events.List(calendarID).
+			SingleEvents(true).
+			TimeMin(from.Format(time.RFC3339)).
+			TimeMax(to.Format(time.RFC3339)).
+			PageToken(pageToken).
+			Do()
+		if err != nil {
+			return nil, apiError("retrieve events from calendar", err)
+		}
+		for _, item := range items.Items {
+			events = append(events, newEvent(item, items.TimeZone))
+		}
+		if items.NextPageToken == "" {
+			return events, nil
+		}
+		pageToken = items.NextPageToken
+	}
+}
+
+// GetEvent fetches a single event by ID. Its error wraps ErrNotFound when
+// the event does not exist.
+func (c *Client) GetEvent(calendarID, eventID string) (*Event, error) {
+	item, err := c.srv.Events.Get(calendarID, eventID).Do()
+	if err != nil {
+		return nil, apiError("retrieve event "+eventID, err)
+	}
+	return newEvent(item, ""), nil
+}
+
+// newEvent simplifies an API event of a calendar in calendarTimeZone.
+func newEvent(item *calendar.Event, calendarTimeZone string) *Event {
+	var organizer, creator string
+	if item.Organizer != nil {
+		organizer = item.Organizer.Email
+	}
+	if item.Creator != nil {
+		creator = item.Creator.Email
+	}
+	updated, _ := time.Parse(time.RFC3339, item.Updated)
+	timeZone := calendarTimeZone
+	if item.Start != nil && item.Start.TimeZone != "" {
+		timeZone = item.Start.TimeZone
+	}
+	// An unknown zone keeps the offsets Google sent.
+	loc, err := time.LoadLocation(timeZone)
+	if timeZone == "" || err != nil {
+		loc = nil
+	}
+
+	return &Event{
+		ID:               item.Id,
+		Summary:          item.Summary,
+		Description:      item.Description,
+		HTMLLink:         item.HtmlLink,
+		Start:            parseDateTime(item.Start, loc),
+		End:              parseDateTime(item.End, loc),
+		Status:           item.Status,
+		Organizer:        organizer,
+		Recurrence:       item.Recurrence,
+		RecurringEventID: item.RecurringEventId,
+		Updated:          updated,
+		EventType:        item.EventType,
+		ResponseStatus:   selfResponseStatus(item.Attendees),
+		Attendees:        attendeeCount(item.Attendees),
+		OrganizedBySelf:  item.Organizer != nil && item.Organizer.Self,
+		ConferenceURL:    conferenceURL(item),
+		Location:         item.Location,
+		Attachments:      attachments(item.Attachments),
+		AllDay:           item.Start != nil && item.Start.DateTime == "" && item.Start.Date != "",
+		Transparency:     item.Transparency,
+		ColorID:          item.ColorId,
+		TimeZone:         timeZone,
+		IssueID:          issueID(item),
+		Creator:          creator,
+		Properties:       properties(item),
+		WrittenAt:        writtenAt(item),
+		Raw:              item,
+	}
+}
+
+// writtenAt returns the WrittenAtProperty of an API event.
+func writtenAt(item *calendar.Event) time.Time {
+	if item.ExtendedProperties == nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339Nano, item.ExtendedProperties.Private[WrittenAtProperty])
+	return t
+}
+
+// writeMark returns the extended properties marking an event as written
+// now.
+func writeMark() *calendar.EventExtendedProperties {
+	return &calendar.EventExtendedProperties{
+		Private: map[string]string{WrittenAtProperty: time.Now().UTC().Format(time.RFC3339Nano)},
+	}
+}
+
+// properties merges the shared and private extended properties of an API
+// event, or returns nil when it has none.
+func properties(item *calendar.Event) map[string]string {
+	if item.ExtendedProperties == nil {
+		return nil
+	}
+	var merged map[string]string
+	for _, props := range []map[string]string{item.ExtendedProperties.Shared, item.ExtendedProperties.Private} {
+		for key, value := range props {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// issueID returns the IssueIDProperty of an API event.
+func issueID(item *calendar.Event) string {
+	if item.ExtendedProperties == nil {
+		return ""
+	}
+	return item.ExtendedProperties.Private[IssueIDProperty]
+}
+
+// selfResponseStatus returns the response of the attendee representing the
+// authenticated user.
+func selfResponseStatus(attendees []*calendar.EventAttendee) string {
+	for _, attendee := range attendees {
+		if attendee.Self {
+			return attendee.ResponseStatus
+		}
+	}
+	return ""
+}
+
+// attendeeCount returns the number of guests among attendees, leaving out
+// resources such as rooms.
+func attendeeCount(attendees []*calendar.EventAttendee) int {
+	n := 0
+	for _, attendee := range attendees {
+		if !attendee.Resource {
+			n++
+		}
+	}
+	return n
+}
+
+// attachments converts the attachments of an API event.
+func attachments(items []*calendar.EventAttachment) []Attachment {
+	var result []Attachment
+	for _, item := range items {
+		result = append(result, Attachment{Title: item.Title, FileURL: item.FileUrl})
+	}
+	return result
+}
+
+// conferenceURL returns the video entry point of the event's conference,
+// falling back to the legacy Hangouts link.
+func conferenceURL(item *calendar.Event) string {
+	if item.ConferenceData != nil {
+		for _, entryPoint := range item.ConferenceData.EntryPoints {
+			if entryPoint.EntryPointType == "video" {
+				return entryPoint.Uri
+			}
+		}
+	}
+	return item.HangoutLink
+}
+
+// parseDateTime parses the start or end of an event: a time, converted to
+// loc if set, or a date at midnight UTC.
+func parseDateTime(dateTime *calendar.EventDateTime, loc *time.Location) time.Time {
 	if dateTime == nil {
 		return time.Time{}
 	}
 	if dateTime.DateTime != "" {
 		t, _ := time.Parse(time.RFC3339, dateTime.DateTime)
+		if loc != nil {
+			t = t.In(loc)
+		}
 		return t
 	}
 	if dateTime.Date != "" {
@@ -114,29 +420,406 @@ func parseDateTime(dateTime *calendar.EventDateTime) time.Time {
 	return time.Time{}
 }
 
-// CreateEvent creates a new Google Calendar event.
-func (c *Client) CreateEvent(calendarID, summary, description string, start, end time.Time) (*calendar.Event, error) {
+// CreateEvent creates a new Google Calendar event. An all-day event covers
+// the days from start to end; otherwise the event runs from start to end.
+// Empty visibility and transparency keep the calendar's defaults. The event
+// is marked as written, see Event.WrittenAt.
+//
+// A non-empty eventID, of 5 to 1024 lowercase letters a-v and digits, is
+// used as the ID of the event, making retries of the same creation fail
+// with an error wrapping ErrExists instead of creating a duplicate; empty
+// lets Google choose.
+func (c *Client) CreateEvent(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	event := &calendar.Event{
+		Id:                 eventID,
+		Summary:            summary,
+		Description:        description,
+		Location:           location,
+		Start:              eventStart(start, allDay),
+		End:                eventEnd(end, allDay),
+		Visibility:         visibility,
+		Transparency:       transparency,
+		ExtendedProperties: writeMark(),
+	}
+	created, err := c.srv.Events.Insert(calendarID, event).Do()
+	if err != nil {
+		err = apiError("create event", err)
+		var exists *httpclient.ValidationError
+		if errors.As(err, &exists) && exists.Status == http.StatusConflict && eventID != "" {
+			exists.Err = ErrExists
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateEvent patches an existing Google Calendar event.
+// Nil texts, zero times and empty visibility and transparency are left
+// untouched on the event, which is marked as written, see Event.WrittenAt.
+// Empty texts clear the field.
+func (c *Client) UpdateEvent(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	event := &calendar.Event{
+		Visibility:         visibility,
+		Transparency:       transparency,
+		ExtendedProperties: writeMark(),
+	}
+	if summary != nil {
+		event.Summary = *summary
+		event.ForceSendFields = append(event.ForceSendFields, "Summary")
+	}
+	if description != nil {
+		event.Description = *description
+		event.ForceSendFields = append(event.ForceSendFields, "Description")
+	}
+	if location != nil {
+		event.Location = *location
+		event.ForceSendFields = append(event.ForceSendFields, "Location")
+	}
+	if !start.IsZero() {
+		event.Start = eventStart(start, allDay)
+	}
+	if !end.IsZero() {
+		event.End = eventEnd(end, allDay)
+	}
+	updated, err := c.srv.Events.Patch(calendarID, eventID, event).Do()
+	if err != nil {
+		return nil, apiError("update event "+eventID, err)
+	}
+	return updated, nil
+}
+
+// SetIssueID records on an event the ID of the YouTrack issue it is linked
+// to, so that copies of the event made in Google Calendar can be told apart.
+func (c *Client) SetIssueID(calendarID, eventID, issueID string) (*calendar.Event, error) {
 	event := &calendar.Event{
-		Summary:     summary,
-		Description: description,
-		Start:       &calendar.EventDateTime{Date: start.Format("2006-01-02")},
-		End:         &calendar.EventDateTime{Date: end.AddDate(0, 0, 1).Format("2006-01-02")},
+		ExtendedProperties: &calendar.EventExtendedProperties{
+			Private: map[string]string{IssueIDProperty: issueID},
+		},
+	}
+	updated, err := c.srv.Events.Patch(calendarID, eventID, event).Do()
+	if err != nil {
+		return nil, apiError("record issue on event "+eventID, err)
 	}
-	return c.srv.Events.Insert(calendarID, event).Do()
+	return updated, nil
 }
 
-// UpdateEvent updates an existing Google Calendar event.
-func (c *Client) UpdateEvent(calendarID, eventID, summary, description string, start, end time.Time) (*calendar.Event, error) {
+// SetColor sets the color of an event to colorID, see Event.ColorID; empty
+// resets it to the color of the calendar. The event is marked as written.
+func (c *Client) SetColor(calendarID, eventID, colorID string) (*calendar.Event, error) {
 	event := &calendar.Event{
-		Summary:     summary,
-		Description: description,
-		Start:       &calendar.EventDateTime{Date: start.Format("2006-01-02")},
-		End:         &calendar.EventDateTime{Date: end.AddDate(0, 0, 1).Format("2006-01-02")},
+		ColorId:            colorID,
+		ExtendedProperties: writeMark(),
+		ForceSendFields:    []string{"ColorId"},
+	}
+	updated, err := c.srv.Events.Patch(calendarID, eventID, event).Do()
+	if err != nil {
+		return nil, apiError("set color of event "+eventID, err)
+	}
+	return updated, nil
+}
+
+// PatchEvent writes the fields set on patch to an event, for fields the
+// other methods do not write. Zero values are left untouched unless named
+// in patch.ForceSendFields or patch.NullFields. The event is marked as
+// written.
+func (c *Client) PatchEvent(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error) {
+	event := *patch
+	mark := writeMark()
+	if patch.ExtendedProperties != nil {
+		props := *patch.ExtendedProperties
+		props.Private = make(map[string]string, len(patch.ExtendedProperties.Private)+1)
+		for key, value := range patch.ExtendedProperties.Private {
+			props.Private[key] = value
+		}
+		props.Private[WrittenAtProperty] = mark.Private[WrittenAtProperty]
+		mark = &props
+	}
+	event.ExtendedProperties = mark
+	updated, err := c.srv.Events.Patch(calendarID, eventID, &event).Do()
+	if err != nil {
+		return nil, apiError("patch event "+eventID, err)
+	}
+	return updated, nil
+}
+
+// SetRecurrence makes an event that runs from start to end repeat by the
+// RRULE lines of recurrence. The time zone of the repetition is that of the
+// location of start, or UTC when it has no IANA name. The event is marked as
+// written.
+func (c *Client) SetRecurrence(calendarID, eventID string, start, end time.Time, recurrence []string) (*calendar.Event, error) {
+	timeZone := start.Location().String()
+	if timeZone == "Local" {
+		start, end, timeZone = start.UTC(), end.UTC(), "UTC"
+	}
+	event := &calendar.Event{
+		Start:              &calendar.EventDateTime{DateTime: start.Format(time.RFC3339), TimeZone: timeZone},
+		End:                &calendar.EventDateTime{DateTime: end.Format(time.RFC3339), TimeZone: timeZone},
+		Recurrence:         recurrence,
+		ExtendedProperties: writeMark(),
+	}
+	updated, err := c.srv.Events.Patch(calendarID, eventID, event).Do()
+	if err != nil {
+		return nil, apiError("set recurrence of event "+eventID, err)
+	}
+	return updated, nil
+}
+
+// GetCalendar returns the calendar calendarID. A calendar that does not
+// exist, or cannot be accessed, wraps ErrNotFound.
+func (c *Client) GetCalendar(calendarID string) (*calendar.Calendar, error) {
+	cal, err := c.srv.Calendars.Get(calendarID).Do()
+	if err != nil {
+		return nil, apiError("get calendar "+calendarID, err)
+	}
+	return cal, nil
+}
+
+// CreateCalendar creates a secondary calendar named summary, owned by the
+// authorized account.
+func (c *Client) CreateCalendar(summary string) (*calendar.Calendar, error) {
+	created, err := c.srv.Calendars.Insert(&calendar.Calendar{Summary: summary}).Do()
+	if err != nil {
+		return nil, apiError("create calendar "+summary, err)
+	}
+	return created, nil
+}
+
+// ShareCalendar gives the user or group (scopeType) with the email address
+// the role, such as reader or writer, on the calendar calendarID, without
+// notifying them. Sharing again changes the role.
+func (c *Client) ShareCalendar(calendarID, scopeType, address, role string) error {
+	rule := &calendar.AclRule{Role: role, Scope: &calendar.AclRuleScope{Type: scopeType, Value: address}}
+	if _, err := c.srv.Acl.Insert(calendarID, rule).SendNotifications(false).Do(); err != nil {
+		return apiError("share calendar "+calendarID+" with "+address, err)
+	}
+	return nil
+}
+
+// UnshareCalendar removes the access of the user or group (scopeType) with
+// the email address to the calendar calendarID. Without access, the error
+// wraps ErrNotFound.
+func (c *Client) UnshareCalendar(calendarID, scopeType, address string) error {
+	if err := c.srv.Acl.Delete(calendarID, scopeType+":"+address).Do(); err != nil {
+		return apiError("unshare calendar "+calendarID+" with "+address, err)
+	}
+	return nil
+}
+
+// CalendarACL returns the access rules of the calendar calendarID.
+func (c *Client) CalendarACL(calendarID string) ([]*calendar.AclRule, error) {
+	var rules []*calendar.AclRule
+	pageToken := ""
+	for {
+		acl, err := c.srv.Acl.List(calendarID).PageToken(pageToken).Do()
+		if err != nil {
+			return nil, apiError("list access to calendar "+calendarID, err)
+		}
+		rules = append(rules, acl.Items...)
+		if pageToken = acl.NextPageToken; pageToken == "" {
+			return rules, nil
+		}
+	}
+}
+
+// eventStart returns the start of an event beginning at start.
+func eventStart(start time.Time, allDay bool) *calendar.EventDateTime {
+	if allDay {
+		return &calendar.EventDateTime{Date: start.Format("2006-01-02")}
+	}
+	return &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)}
+}
+
+// eventEnd returns the end of an event ending at end. All-day events end
+// on the day after their last day.
+func eventEnd(end time.Time, allDay bool) *calendar.EventDateTime {
+	if allDay {
+		return &calendar.EventDateTime{Date: end.AddDate(0, 0, 1).Format("2006-01-02")}
+	}
+	return &calendar.EventDateTime{DateTime: end.Format(time.RFC3339)}
+}
+
+// MoveEvent moves an event to another calendar, changing its organizer.
+func (c *Client) MoveEvent(calendarID, eventID, destinationCalendarID string) (*calendar.Event, error) {
+	moved, err := c.srv.Events.Move(calendarID, eventID, destinationCalendarID).Do()
+	if err != nil {
+		return nil, apiError("move event "+eventID, err)
 	}
-	return c.srv.Events.Update(calendarID, eventID, event).Do()
+	return moved, nil
+}
+
+// Busy is a period in which a calendar has events that show as busy.
+type Busy struct {
+	CalendarID string
+	Start      time.Time
+	End        time.Time
 }
 
-// DeleteEvent deletes a Google Calendar event.
+// FreeBusy returns the busy periods of calendarIDs between from and to, in
+// chronological order. It fails if Google reports an error for any of the
+// calendars, such as one that is not shared with the user.
+func (c *Client) FreeBusy(calendarIDs []string, from, to time.Time) ([]Busy, error) {
+	request := &calendar.FreeBusyRequest{
+		TimeMin: from.Format(time.RFC3339),
+		TimeMax: to.Format(time.RFC3339),
+	}
+	for _, id := range calendarIDs {
+		request.Items = append(request.Items, &calendar.FreeBusyRequestItem{Id: id})
+	}
+	response, err := c.srv.Freebusy.Query(request).Do()
+	if err != nil {
+		return nil, apiError("query free/busy information", err)
+	}
+
+	var busy []Busy
+	for _, id := range calendarIDs {
+		result, ok := response.Calendars[id]
+		if !ok {
+			return nil, fmt.Errorf("no free/busy information for calendar %s", id)
+		}
+		if len(result.Errors) > 0 {
+			return nil, fmt.Errorf("unable to query free/busy information for calendar %s: %s", id, result.Errors[0].Reason)
+		}
+		for _, period := range result.Busy {
+			start, _ := time.Parse(time.RFC3339, period.Start)
+			end, _ := time.Parse(time.RFC3339, period.End)
+			busy = append(busy, Busy{CalendarID: id, Start: start, End: end})
+		}
+	}
+	sort.SliceStable(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+	return busy, nil
+}
+
+// Color is a color calendars or events can take.
+type Color struct {
+	// ID is the color ID, such as Event.ColorID.
+	ID string
+	// Background and Foreground are hex colors such as "#a4bdfc".
+	Background string
+	Foreground string
+}
+
+// Colors lists the colors of calendars and events, by ascending ID.
+type Colors struct {
+	Calendar []Color
+	Event    []Color
+}
+
+// GetColors returns the colors calendars and events can take.
+func (c *Client) GetColors() (*Colors, error) {
+	colors, err := c.srv.Colors.Get().Do()
+	if err != nil {
+		return nil, apiError("get colors", err)
+	}
+	return &Colors{Calendar: sortedColors(colors.Calendar), Event: sortedColors(colors.Event)}, nil
+}
+
+// sortedColors returns definitions as colors, by ascending numeric ID.
+func sortedColors(definitions map[string]calendar.ColorDefinition) []Color {
+	colors := make([]Color, 0, len(definitions))
+	for id, definition := range definitions {
+		colors = append(colors, Color{ID: id, Background: definition.Background, Foreground: definition.Foreground})
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		a, errA := strconv.Atoi(colors[i].ID)
+		b, errB := strconv.Atoi(colors[j].ID)
+		if errA != nil || errB != nil {
+			return colors[i].ID < colors[j].ID
+		}
+		return a < b
+	})
+	return colors
+}
+
+// CalendarEntry is a calendar in the calendar list of the authorized user.
+type CalendarEntry struct {
+	ID          string
+	Summary     string
+	Description string
+	// TimeZone is the IANA time zone of the calendar.
+	TimeZone string
+	// AccessRole is the role of the user: freeBusyReader, reader, writer
+	// or owner.
+	AccessRole string
+	// ColorID and BackgroundColor are the color the user gave the calendar.
+	ColorID         string
+	BackgroundColor string
+	Primary         bool
+	// Hidden and Selected tell whether the calendar is hidden from, or
+	// shown in, the Google Calendar UI.
+	Hidden   bool
+	Selected bool
+}
+
+// ListCalendars returns the calendar list of the authorized user, hidden
+// calendars included.
+func (c *Client) ListCalendars() ([]CalendarEntry, error) {
+	var entries []CalendarEntry
+	pageToken := ""
+	for {
+		list, err := c.srv.CalendarList.List().ShowHidden(true).PageToken(pageToken).Do()
+		if err != nil {
+			return nil, apiError("list calendars", err)
+		}
+		for _, item := range list.Items {
+			entries = append(entries, CalendarEntry{
+				ID:              item.Id,
+				Summary:         item.Summary,
+				Description:     item.Description,
+				TimeZone:        item.TimeZone,
+				AccessRole:      item.AccessRole,
+				ColorID:         item.ColorId,
+				BackgroundColor: item.BackgroundColor,
+				Primary:         item.Primary,
+				Hidden:          item.Hidden,
+				Selected:        item.Selected,
+			})
+		}
+		if pageToken = list.NextPageToken; pageToken == "" {
+			return entries, nil
+		}
+	}
+}
+
+// DeleteEvent deletes a Google Calendar event. Its error wraps ErrNotFound
+// when the event does not exist or was deleted already.
 func (c *Client) DeleteEvent(calendarID, eventID string) error {
-	return c.srv.Events.Delete(calendarID, eventID).Do()
+	if err := c.srv.Events.Delete(calendarID, eventID).Do(); err != nil {
+		return apiError("delete event "+eventID, err)
+	}
+	return nil
+}
+
+// Channel is a push notification channel, through which Google announces
+// changes to the events of a calendar by posting to an address.
+type Channel struct {
+	ID string
+	// ResourceID identifies the watched calendar to Google; StopChannel
+	// needs it.
+	ResourceID string
+	Expiration time.Time
+}
+
+// WatchEvents opens the channel id, notifying the HTTPS URL address of
+// every change to the events of calendarID. Google sends token back with
+// every notification. It keeps the channel open for ttl, or its default of
+// a week when ttl is zero, and may shorten it.
+func (c *Client) WatchEvents(calendarID, id, address, token string, ttl time.Duration) (*Channel, error) {
+	request := &calendar.Channel{Id: id, Type: "web_hook", Address: address, Token: token}
+	if ttl > 0 {
+		request.Params = map[string]string{"ttl": strconv.FormatInt(int64(ttl/time.Second), 10)}
+	}
+	channel, err := c.srv.Events.Watch(calendarID, request).Do()
+	if err != nil {
+		return nil, apiError("watch calendar "+calendarID, err)
+	}
+	return &Channel{ID: channel.Id, ResourceID: channel.ResourceId, Expiration: time.UnixMilli(channel.Expiration)}, nil
+}
+
+// StopChannel closes a channel opened by WatchEvents. Its error wraps
+// ErrNotFound when the channel is closed already or expired.
+func (c *Client) StopChannel(id, resourceID string) error {
+	if err := c.srv.Channels.Stop(&calendar.Channel{Id: id, ResourceId: resourceID}).Do(); err != nil {
+		return apiError("stop channel "+id, err)
+	}
+	return nil
 }
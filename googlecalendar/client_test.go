@@ -3,17 +3,22 @@ package googlecalendar
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/option"
+
+	"youtrack-calendar-sync/httpclient"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -56,6 +61,145 @@ func TestSaveLoadToken(t *testing.T) {
 	}
 }
 
+func TestLocalCallback(t *testing.T) {
+	tests := []struct {
+		redirectURL string
+		addr, path  string
+		ok          bool
+	}{
+		{"http://localhost:8080", "localhost:8080", "/", true},
+		{"http://127.0.0.1:9000/oauth/callback", "127.0.0.1:9000", "/oauth/callback", true},
+		{"https://localhost:8080", "", "", false},
+		{"https://sync.example.com/auth/google/callback", "", "", false},
+	}
+	for _, tt := range tests {
+		addr, path, ok := localCallback(tt.redirectURL)
+		if addr != tt.addr || path != tt.path || ok != tt.ok {
+			t.Errorf("localCallback(%q) = %q, %q, %v, want %q, %q, %v", tt.redirectURL, addr, path, ok, tt.addr, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestReadCode(t *testing.T) {
+	code, err := readCode(strings.NewReader("4/plain-code\n"), "state")
+	if err != nil || code != "4/plain-code" {
+		t.Errorf("expected the plain code, got %q (%v)", code, err)
+	}
+	code, err = readCode(strings.NewReader("http://localhost:8080/?state=state&code=from-url\n"), "state")
+	if err != nil || code != "from-url" {
+		t.Errorf("expected the code from the URL, got %q (%v)", code, err)
+	}
+	if _, err := readCode(strings.NewReader("http://localhost:8080/?state=forged&code=x\n"), "state"); err == nil {
+		t.Error("expected a state mismatch error")
+	}
+}
+
+func TestReceiveCallback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	base := "http://" + listener.Addr().String() + "/callback"
+
+	go func() {
+		resp, err := http.Get(base + "?state=forged&code=bad")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("expected a forged state to be rejected, got %d", resp.StatusCode)
+			}
+		}
+		resp, err = http.Get(base + "?state=expected&code=good")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	code, err := receiveCallback(ctx, listener, "/callback", "expected")
+	if err != nil {
+		t.Fatalf("receiveCallback() error = %v", err)
+	}
+	if code != "good" {
+		t.Errorf("expected code 'good', got '%s'", code)
+	}
+}
+
+func TestGetTokenFromDevice(t *testing.T) {
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/device/code":
+			fmt.Fprint(w, `{"device_code":"dev","user_code":"ABCD-EFGH","verification_url":"https://www.google.com/device","expires_in":60,"interval":1}`)
+		case "/token":
+			if got := r.FormValue("device_code"); got != "dev" {
+				t.Errorf("expected device code 'dev', got '%s'", got)
+			}
+			polls++
+			if polls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"authorization_pending"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"device-token","token_type":"Bearer","refresh_token":"refresh"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := &oauth2.Config{
+		ClientID: "test-id",
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: ts.URL + "/device/code",
+			TokenURL:      ts.URL + "/token",
+		},
+	}
+	token, err := GetTokenFromDevice(context.Background(), config)
+	if err != nil {
+		t.Fatalf("GetTokenFromDevice() error = %v", err)
+	}
+	if token.AccessToken != "device-token" {
+		t.Errorf("expected access token 'device-token', got '%s'", token.AccessToken)
+	}
+	if polls != 2 {
+		t.Errorf("expected 2 token polls, got %d", polls)
+	}
+}
+
+func TestSavingTokenSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"access_token": "refreshed", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer ts.Close()
+
+	config := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: ts.URL}}
+	var saved []*oauth2.Token
+	save := func(token *oauth2.Token) { saved = append(saved, token) }
+
+	valid := &oauth2.Token{AccessToken: "valid", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	if _, err := SavingTokenSource(context.Background(), config, valid, save).Token(); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if len(saved) != 0 {
+		t.Errorf("saved %d tokens, want none for a valid token", len(saved))
+	}
+
+	expired := &oauth2.Token{AccessToken: "expired", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)}
+	source := SavingTokenSource(context.Background(), config, expired, save)
+	for i := 0; i < 2; i++ {
+		if _, err := source.Token(); err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+	}
+	if len(saved) != 1 || saved[0].AccessToken != "refreshed" || saved[0].RefreshToken != "refresh" {
+		t.Errorf("saved = %v, want the refreshed token once, keeping the refresh token", saved)
+	}
+}
+
 func TestNewClient(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "{}")
@@ -76,6 +220,35 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestIsTokenRevoked(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+			return
+		}
+		t.Errorf("Unexpected API request to %s", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	config := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: ts.URL + "/token"}}
+	expired := &oauth2.Token{AccessToken: "old", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(ts.URL), option.WithHTTPClient(config.Client(context.Background(), expired)))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+
+	c := &Client{srv: srv}
+	_, _, err = c.FetchEvents("primary", "")
+	if !IsTokenRevoked(err) {
+		t.Errorf("Expected a revoked token error, got %v", err)
+	}
+	if IsTokenRevoked(ErrNotFound) {
+		t.Error("Expected ErrNotFound not to be a revoked token error")
+	}
+}
+
 func TestFetchEvents(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/calendars/primary/events" {
@@ -84,8 +257,22 @@ func TestFetchEvents(t *testing.T) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(&calendar.Events{
 			Items: []*calendar.Event{
-				{Id: "1", Summary: "Event 1"},
+				{Id: "1", Summary: "Event 1", EventType: "focusTime", ConferenceData: &calendar.ConferenceData{
+					EntryPoints: []*calendar.EntryPoint{
+						{EntryPointType: "phone", Uri: "tel:+1-555-0100"},
+						{EntryPointType: "video", Uri: "https://meet.google.com/abc-defg-hij"},
+					},
+				}, Attachments: []*calendar.EventAttachment{
+					{Title: "Agenda", FileUrl: "https://drive.google.com/file/d/agenda"},
+				}, Attendees: []*calendar.EventAttendee{
+					{Email: "me@example.com", Self: true}, {Email: "jane@example.com"}, {Email: "room@example.com", Resource: true},
+				}, Organizer: &calendar.EventOrganizer{Email: "me@example.com", Self: true},
+					Start: &calendar.EventDateTime{DateTime: "2024-01-01T10:00:00Z"}},
+				{Id: "2", Summary: "Event 2", Start: &calendar.EventDateTime{Date: "2024-01-02"}, ExtendedProperties: &calendar.EventExtendedProperties{
+					Private: map[string]string{IssueIDProperty: "PRJ-1"},
+				}},
 			},
+			TimeZone:      "Europe/Berlin",
 			NextSyncToken: "new-sync-token",
 		})
 	}))
@@ -103,12 +290,37 @@ func TestFetchEvents(t *testing.T) {
 		t.Fatalf("FetchEvents() error = %v", err)
 	}
 
-	if len(events) != 1 {
-		t.Fatalf("expected 1 event, got %d", len(events))
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
 	}
 	if events[0].Summary != "Event 1" {
 		t.Errorf("expected event summary to be 'Event 1', got '%s'", events[0].Summary)
 	}
+	if events[0].EventType != EventTypeFocusTime {
+		t.Errorf("expected event type to be '%s', got '%s'", EventTypeFocusTime, events[0].EventType)
+	}
+	if events[0].ConferenceURL != "https://meet.google.com/abc-defg-hij" {
+		t.Errorf("expected conference url to be the video entry point, got '%s'", events[0].ConferenceURL)
+	}
+	if want := []Attachment{{Title: "Agenda", FileURL: "https://drive.google.com/file/d/agenda"}}; !reflect.DeepEqual(events[0].Attachments, want) {
+		t.Errorf("expected attachments %v, got %v", want, events[0].Attachments)
+	}
+	if events[0].AllDay || events[0].TimeZone != "Europe/Berlin" {
+		t.Errorf("expected a timed event in Europe/Berlin, got all-day %v in %q", events[0].AllDay, events[0].TimeZone)
+	}
+	if hour := events[0].Start.Hour(); hour != 11 {
+		t.Errorf("expected the start in the calendar's time zone at 11:00, got %v", events[0].Start)
+	}
+	if !events[1].AllDay || !events[1].Start.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected an all-day event on 2024-01-02, got all-day %v at %v", events[1].AllDay, events[1].Start)
+	}
+	if events[0].Attendees != 2 || !events[0].OrganizedBySelf || events[1].Attendees != 0 || events[1].OrganizedBySelf {
+		t.Errorf("expected 2 guests on the first event, organized by the user, got %d, %v and %d, %v",
+			events[0].Attendees, events[0].OrganizedBySelf, events[1].Attendees, events[1].OrganizedBySelf)
+	}
+	if events[0].IssueID != "" || events[1].IssueID != "PRJ-1" {
+		t.Errorf("expected only the second event to carry issue PRJ-1, got %q and %q", events[0].IssueID, events[1].IssueID)
+	}
 	if syncToken != "new-sync-token" {
 		t.Errorf("expected sync token to be 'new-sync-token', got '%s'", syncToken)
 	}
@@ -134,7 +346,7 @@ func TestCreateEvent(t *testing.T) {
 	}
 
 	c := &Client{srv: srv}
-	event, err := c.CreateEvent("primary", "New Event", "Description", time.Now(), time.Now().Add(time.Hour))
+	event, err := c.CreateEvent("primary", "", "New Event", "Description", "Room 1", time.Now(), time.Now().Add(time.Hour), true, "", "")
 	if err != nil {
 		t.Fatalf("CreateEvent() error = %v", err)
 	}
@@ -146,8 +358,21 @@ func TestCreateEvent(t *testing.T) {
 
 func TestUpdateEvent(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "PUT" {
-			t.Errorf("Expected 'PUT' request, got '%s'", r.Method)
+		if r.Method != "PATCH" {
+			t.Errorf("Expected 'PATCH' request, got '%s'", r.Method)
+		}
+		var patch map[string]json.RawMessage
+		json.NewDecoder(r.Body).Decode(&patch)
+		var start calendar.EventDateTime
+		json.Unmarshal(patch["start"], &start)
+		if start.DateTime == "" || start.Date != "" {
+			t.Errorf("Expected a timed start, got %s", patch["start"])
+		}
+		if string(patch["location"]) != `""` {
+			t.Errorf("Expected the location to be cleared, got %s", patch["location"])
+		}
+		if _, ok := patch["description"]; ok {
+			t.Errorf("Expected the description to be left alone, got %s", patch["description"])
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(&calendar.Event{
@@ -164,7 +389,8 @@ func TestUpdateEvent(t *testing.T) {
 	}
 
 	c := &Client{srv: srv}
-	event, err := c.UpdateEvent("primary", "event-id", "Updated Event", "Description", time.Now(), time.Now().Add(time.Hour))
+	summary, location := "Updated Event", ""
+	event, err := c.UpdateEvent("primary", "event-id", &summary, nil, &location, time.Now(), time.Now().Add(time.Hour), false, "", "")
 	if err != nil {
 		t.Fatalf("UpdateEvent() error = %v", err)
 	}
@@ -174,10 +400,105 @@ func TestUpdateEvent(t *testing.T) {
 	}
 }
 
+func TestSetColor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var patch map[string]json.RawMessage
+		json.NewDecoder(r.Body).Decode(&patch)
+		if string(patch["colorId"]) != `""` {
+			t.Errorf("Expected the color to be reset, got %s", patch["colorId"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&calendar.Event{Id: "event-id"})
+	}))
+	defer server.Close()
+
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+	c := &Client{srv: srv}
+	if _, err := c.SetColor("primary", "event-id", ""); err != nil {
+		t.Fatalf("SetColor() error = %v", err)
+	}
+}
+
+func TestSetRecurrence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var patch calendar.Event
+		json.NewDecoder(r.Body).Decode(&patch)
+		if patch.Start.TimeZone != "UTC" || patch.End.TimeZone != "UTC" || patch.Start.DateTime != "2026-10-18T18:00:00Z" {
+			t.Errorf("Expected a start and end in UTC, got %+v and %+v", patch.Start, patch.End)
+		}
+		if len(patch.Recurrence) != 1 || patch.Recurrence[0] != "RRULE:FREQ=WEEKLY;BYDAY=SU" {
+			t.Errorf("Expected the weekly rule, got %v", patch.Recurrence)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&calendar.Event{Id: "event-id"})
+	}))
+	defer server.Close()
+
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+	c := &Client{srv: srv}
+	start := time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC)
+	if _, err := c.SetRecurrence("primary", "event-id", start, start.Add(30*time.Minute), []string{"RRULE:FREQ=WEEKLY;BYDAY=SU"}); err != nil {
+		t.Fatalf("SetRecurrence() error = %v", err)
+	}
+}
+
+func TestCreateAndShareCalendar(t *testing.T) {
+	var shared calendar.AclRule
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/calendars"):
+			var cal calendar.Calendar
+			json.NewDecoder(r.Body).Decode(&cal)
+			json.NewEncoder(w).Encode(&calendar.Calendar{Id: "cal@group.calendar.google.com", Summary: cal.Summary})
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/calendars/cal@group.calendar.google.com/acl"):
+			if r.URL.Query().Get("sendNotifications") != "false" {
+				t.Errorf("Expected sharing without notifications, got %s", r.URL.RawQuery)
+			}
+			json.NewDecoder(r.Body).Decode(&shared)
+			json.NewEncoder(w).Encode(&shared)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Not Found"}})
+		}
+	}))
+	defer server.Close()
+
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+	c := &Client{srv: srv}
+	if _, err := c.GetCalendar("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetCalendar() error = %v, want ErrNotFound", err)
+	}
+	cal, err := c.CreateCalendar("YouTrack")
+	if err != nil || cal.Summary != "YouTrack" {
+		t.Fatalf("CreateCalendar() = %+v, %v", cal, err)
+	}
+	if err := c.ShareCalendar(cal.Id, "user", "alice@example.com", "reader"); err != nil {
+		t.Fatalf("ShareCalendar() error = %v", err)
+	}
+	if shared.Role != "reader" || shared.Scope == nil || shared.Scope.Type != "user" || shared.Scope.Value != "alice@example.com" {
+		t.Errorf("Expected a reader rule for alice@example.com, got %+v", shared)
+	}
+}
+
 func TestParseDateTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
 	testCases := []struct {
 		name     string
 		input    *calendar.EventDateTime
+		loc      *time.Location
 		expected time.Time
 	}{
 		{
@@ -199,14 +520,318 @@ func TestParseDateTime(t *testing.T) {
 			},
 			expected: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
 		},
+		{
+			name: "DateTime in time zone",
+			input: &calendar.EventDateTime{
+				DateTime: "2024-01-01T10:00:00Z",
+			},
+			loc:      berlin,
+			expected: time.Date(2024, 1, 1, 11, 0, 0, 0, berlin),
+		},
+		{
+			name: "Date in time zone",
+			input: &calendar.EventDateTime{
+				Date: "2024-01-01",
+			},
+			loc:      berlin,
+			expected: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := parseDateTime(tc.input)
-			if !reflect.DeepEqual(result, tc.expected) {
+			result := parseDateTime(tc.input, tc.loc)
+			if !result.Equal(tc.expected) || result.Location().String() != tc.expected.Location().String() {
 				t.Errorf("expected %v, got %v", tc.expected, result)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestMoveEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected 'POST' request, got '%s'", r.Method)
+		}
+		if r.URL.Path != "/calendars/primary/events/event-id/move" {
+			t.Errorf("Expected to request '/calendars/primary/events/event-id/move', got: %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("destination"); got != "archive" {
+			t.Errorf("Expected destination 'archive', got '%s'", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&calendar.Event{Id: "event-id"})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	srv, err := calendar.NewService(ctx, option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+
+	c := &Client{srv: srv}
+	event, err := c.MoveEvent("primary", "event-id", "archive")
+	if err != nil {
+		t.Fatalf("MoveEvent() error = %v", err)
+	}
+	if event.Id != "event-id" {
+		t.Errorf("expected event id to be 'event-id', got '%s'", event.Id)
+	}
+}
+
+func TestGetEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendars/primary/events/event-id" {
+			http.Error(w, `{"error":{"code":404,"message":"Not Found"}}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&calendar.Event{Id: "event-id", Summary: "Single", Location: "Room 1"})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	srv, err := calendar.NewService(ctx, option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+
+	c := &Client{srv: srv}
+	event, err := c.GetEvent("primary", "event-id")
+	if err != nil {
+		t.Fatalf("GetEvent() error = %v", err)
+	}
+	if event.Summary != "Single" || event.Location != "Room 1" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	if _, err := c.GetEvent("primary", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestClassifiesErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/calendars/primary/events/quota":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error":{"code":403,"message":"Rate Limit Exceeded","errors":[{"reason":"rateLimitExceeded"}]}}`)
+		case "/calendars/primary/events/denied":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error":{"code":403,"message":"Forbidden","errors":[{"reason":"forbidden"}]}}`)
+		default:
+			w.WriteHeader(http.StatusGone)
+			fmt.Fprint(w, `{"error":{"code":410,"message":"Resource has been deleted"}}`)
+		}
+	}))
+	defer server.Close()
+
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+	c := &Client{srv: srv}
+
+	if err := c.DeleteEvent("primary", "quota"); !errors.As(err, new(*httpclient.RateLimitError)) {
+		t.Errorf("Expected a rate limit error for an exceeded quota, got %#v", err)
+	}
+	if err := c.DeleteEvent("primary", "denied"); !errors.As(err, new(*httpclient.AuthError)) {
+		t.Errorf("Expected an auth error for a denied request, got %#v", err)
+	}
+	err = c.DeleteEvent("primary", "deleted")
+	if !errors.As(err, new(*httpclient.NotFoundError)) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a not found error wrapping ErrNotFound, got %#v", err)
+	}
+}
+
+func TestFreeBusy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/freeBusy" {
+			t.Errorf("Expected 'POST /freeBusy', got '%s %s'", r.Method, r.URL.Path)
+		}
+		var request calendar.FreeBusyRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		calendars := map[string]calendar.FreeBusyCalendar{
+			"primary": {Busy: []*calendar.TimePeriod{{Start: "2024-05-01T13:00:00Z", End: "2024-05-01T14:00:00Z"}}},
+			"team":    {Busy: []*calendar.TimePeriod{{Start: "2024-05-01T09:00:00Z", End: "2024-05-01T10:30:00Z"}}},
+			"private": {Errors: []*calendar.Error{{Domain: "global", Reason: "notFound"}}},
+		}
+		response := &calendar.FreeBusyResponse{Calendars: map[string]calendar.FreeBusyCalendar{}}
+		for _, item := range request.Items {
+			response.Calendars[item.Id] = calendars[item.Id]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	srv, err := calendar.NewService(ctx, option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+
+	c := &Client{srv: srv}
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	busy, err := c.FreeBusy([]string{"primary", "team"}, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("FreeBusy() error = %v", err)
+	}
+	want := []Busy{
+		{CalendarID: "team", Start: from.Add(9 * time.Hour), End: from.Add(10*time.Hour + 30*time.Minute)},
+		{CalendarID: "primary", Start: from.Add(13 * time.Hour), End: from.Add(14 * time.Hour)},
+	}
+	if !reflect.DeepEqual(busy, want) {
+		t.Errorf("FreeBusy() = %+v, want %+v", busy, want)
+	}
+
+	if _, err := c.FreeBusy([]string{"primary", "private"}, from, from.AddDate(0, 0, 1)); err == nil || !strings.Contains(err.Error(), "notFound") {
+		t.Errorf("Expected an error for the private calendar, got %v", err)
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("singleEvents") != "true" || query.Get("timeMin") != "2024-05-01T00:00:00Z" || query.Get("timeMax") != "2024-05-02T00:00:00Z" {
+			t.Errorf("Expected expanded events of May 1, got %s", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&calendar.Events{Items: []*calendar.Event{
+			{Id: "1", Start: &calendar.EventDateTime{Date: "2024-05-01"}, Transparency: "transparent"},
+			{Id: "2", Start: &calendar.EventDateTime{DateTime: "2024-05-01T09:00:00Z"}},
+		}})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	srv, err := calendar.NewService(ctx, option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+
+	c := &Client{srv: srv}
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	events, err := c.ListEvents("primary", from, from.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("ListEvents() error = %v", err)
+	}
+	if len(events) != 2 || !events[0].AllDay || events[0].Transparency != "transparent" || events[1].AllDay {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
+
+func TestGetColors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&calendar.Colors{
+			Calendar: map[string]calendar.ColorDefinition{"1": {Background: "#ac725e", Foreground: "#1d1d1d"}},
+			Event: map[string]calendar.ColorDefinition{
+				"10": {Background: "#51b749", Foreground: "#1d1d1d"},
+				"2":  {Background: "#7ae7bf", Foreground: "#1d1d1d"},
+				"1":  {Background: "#a4bdfc", Foreground: "#1d1d1d"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+	c := &Client{srv: srv}
+	colors, err := c.GetColors()
+	if err != nil {
+		t.Fatalf("GetColors() error = %v", err)
+	}
+	if len(colors.Calendar) != 1 || colors.Calendar[0] != (Color{ID: "1", Background: "#ac725e", Foreground: "#1d1d1d"}) {
+		t.Errorf("Calendar colors = %+v", colors.Calendar)
+	}
+	var ids []string
+	for _, color := range colors.Event {
+		ids = append(ids, color.ID)
+	}
+	if strings.Join(ids, ",") != "1,2,10" {
+		t.Errorf("Event color IDs = %v, want 1,2,10", ids)
+	}
+}
+
+func TestListCalendars(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("showHidden") != "true" {
+			t.Errorf("Expected hidden calendars to be listed, got %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			json.NewEncoder(w).Encode(&calendar.CalendarList{
+				Items:         []*calendar.CalendarListEntry{{Id: "me@example.com", Summary: "Me", AccessRole: "owner", Primary: true, Selected: true, TimeZone: "Europe/Berlin"}},
+				NextPageToken: "next",
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(&calendar.CalendarList{
+			Items: []*calendar.CalendarListEntry{{Id: "team@group.calendar.google.com", Summary: "Team", AccessRole: "reader", ColorId: "7", BackgroundColor: "#42d692", Hidden: true}},
+		})
+	}))
+	defer server.Close()
+
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+	c := &Client{srv: srv}
+	entries, err := c.ListCalendars()
+	if err != nil {
+		t.Fatalf("ListCalendars() error = %v", err)
+	}
+	want := []CalendarEntry{
+		{ID: "me@example.com", Summary: "Me", TimeZone: "Europe/Berlin", AccessRole: "owner", Primary: true, Selected: true},
+		{ID: "team@group.calendar.google.com", Summary: "Team", AccessRole: "reader", ColorID: "7", BackgroundColor: "#42d692", Hidden: true},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("ListCalendars() = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("ListCalendars()[%d] = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestPatchEvent(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPatch || !strings.HasSuffix(r.URL.Path, "/events/event-1") {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(&calendar.Event{Id: "event-1"})
+	}))
+	defer server.Close()
+
+	srv, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatalf("Unable to create calendar service: %v", err)
+	}
+	c := &Client{srv: srv}
+	patch := &calendar.Event{
+		AnyoneCanAddSelf:   false,
+		ForceSendFields:    []string{"AnyoneCanAddSelf"},
+		ExtendedProperties: &calendar.EventExtendedProperties{Private: map[string]string{"team": "ops"}},
+	}
+	if _, err := c.PatchEvent("primary", "event-1", patch); err != nil {
+		t.Fatalf("PatchEvent() error = %v", err)
+	}
+	if invite, ok := body["anyoneCanAddSelf"]; !ok || invite != false {
+		t.Errorf("Expected the forced false field to be sent, got %v", body)
+	}
+	private, _ := body["extendedProperties"].(map[string]interface{})["private"].(map[string]interface{})
+	if private["team"] != "ops" || private[WrittenAtProperty] == nil {
+		t.Errorf("Expected the patched properties and the write mark, got %v", private)
+	}
+	if len(patch.ExtendedProperties.Private) != 1 {
+		t.Errorf("Expected the patch to be left unchanged, got %v", patch.ExtendedProperties.Private)
+	}
+}
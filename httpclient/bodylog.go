@@ -0,0 +1,130 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// maxLoggedBody bounds the part of a body BodyLog logs.
+const maxLoggedBody = 64 << 10
+
+// BodyLog logs complete requests and responses, headers and bodies, while
+// enabled, to diagnose requests a service rejects, e.g. with 400 because of
+// a field mapping. Credentials and email addresses are redacted. It can be
+// toggled at runtime and is safe for concurrent use; one BodyLog may be
+// shared by several clients through Options.BodyLog.
+type BodyLog struct {
+	enabled atomic.Bool
+}
+
+// Enabled reports whether requests are logged.
+func (l *BodyLog) Enabled() bool {
+	return l != nil && l.enabled.Load()
+}
+
+// SetEnabled starts or stops logging.
+func (l *BodyLog) SetEnabled(enabled bool) {
+	switch previous := l.enabled.Swap(enabled); {
+	case enabled && !previous:
+		log.Println("Logging of HTTP requests and responses enabled")
+	case !enabled && previous:
+		log.Println("Logging of HTTP requests and responses disabled")
+	}
+}
+
+// wrap returns base logging through l, or base itself for a nil BodyLog.
+func (l *BodyLog) wrap(name string, base http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return base
+	}
+	return &bodyLoggingTransport{name: name, log: l, base: base}
+}
+
+// bodyLoggingTransport logs the requests and responses of a BodyLog.
+type bodyLoggingTransport struct {
+	name string
+	log  *BodyLog
+	base http.RoundTripper
+}
+
+func (t *bodyLoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.log.Enabled() {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		log.Printf("[%s] request %s %s\n%s\n%s", t.name, req.Method, redact(redactedURL(req)), redactHeader(req.Header), redactBody(body))
+	} else {
+		log.Printf("[%s] request %s %s\n%s", t.name, req.Method, redact(redactedURL(req)), redactHeader(req.Header))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	log.Printf("[%s] response %s %s -> %d\n%s\n%s", t.name, req.Method, redact(redactedURL(req)), resp.StatusCode, redactHeader(resp.Header), redactBody(body))
+	return resp, nil
+}
+
+// secretHeaders are logged as "[redacted]".
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Goog-Api-Key":      true,
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// secretFieldPattern and secretParamPattern match JSON fields and form
+	// or query parameters carrying credentials.
+	secretFieldPattern = regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|client_secret|token|password|secret|api_?key)"\s*:\s*)"[^"]*"`)
+	secretParamPattern = regexp.MustCompile(`(?i)\b((?:access_token|refresh_token|id_token|client_secret|token|password|key|code)=)[^&\s"]*`)
+	bearerPattern      = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=\-]+`)
+)
+
+// redact replaces credentials and email addresses in s.
+func redact(s string) string {
+	s = secretFieldPattern.ReplaceAllString(s, `$1"[redacted]"`)
+	s = secretParamPattern.ReplaceAllString(s, `$1[redacted]`)
+	s = bearerPattern.ReplaceAllString(s, "Bearer [redacted]")
+	return emailPattern.ReplaceAllString(s, "[email]")
+}
+
+// redactBody returns body for the log, redacted and cut to maxLoggedBody.
+func redactBody(body []byte) string {
+	if len(body) > maxLoggedBody {
+		return redact(string(body[:maxLoggedBody])) + "… (truncated)"
+	}
+	return redact(string(body))
+}
+
+// redactHeader formats h for the log, without the values of secretHeaders.
+func redactHeader(h http.Header) string {
+	var b strings.Builder
+	h = h.Clone()
+	for name := range h {
+		if secretHeaders[http.CanonicalHeaderKey(name)] {
+			h[name] = []string{"[redacted]"}
+		}
+	}
+	h.Write(&b)
+	return redact(strings.TrimRight(b.String(), "\r\n"))
+}
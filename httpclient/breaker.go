@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	gosync "sync"
+	"time"
+)
+
+// Circuit states of a Breaker.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitOpenError is returned without contacting the backend while its
+// circuit is open. It is a network error to callers, like the failures that
+// opened the circuit.
+type CircuitOpenError struct {
+	Service string
+	// RetryIn is how long until the circuit lets a probe through.
+	RetryIn time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit of %s is open after repeated failures, retrying in %s", e.Service, e.RetryIn.Round(time.Second))
+}
+
+func (e *CircuitOpenError) Timeout() bool   { return false }
+func (e *CircuitOpenError) Temporary() bool { return true }
+
+// BreakerStatus describes the circuit of a backend.
+type BreakerStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Failures counts the consecutive failed requests.
+	Failures  int       `json:"failures"`
+	OpenedAt  time.Time `json:"openedAt,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Breaker is a circuit breaker for the requests to one backend. After
+// Threshold consecutive failures, network errors or 5xx responses, the
+// circuit opens and requests fail with a CircuitOpenError. Once Cooldown
+// has passed, it is half-open: the next request goes through as a probe,
+// and closes the circuit if it succeeds or opens it again if it fails.
+//
+// A Breaker is safe for concurrent use. Set it as Options.Breaker.
+type Breaker struct {
+	Name      string
+	Threshold int
+	Cooldown  time.Duration
+
+	// now is replaced in tests.
+	now func() time.Time
+
+	mu       gosync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+	lastErr  string
+}
+
+// NewBreaker returns a closed Breaker for the backend name.
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Name: name, Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Status returns the current state of the circuit.
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStatus{Name: b.Name, State: b.state(), Failures: b.failures, OpenedAt: b.openedAt, LastError: b.lastErr}
+}
+
+// state must be called with mu held.
+func (b *Breaker) state() string {
+	switch {
+	case b.openedAt.IsZero():
+		return BreakerClosed
+	case b.probing || b.now().Sub(b.openedAt) >= b.Cooldown:
+		return BreakerHalfOpen
+	default:
+		return BreakerOpen
+	}
+}
+
+// allow reports whether a request may go through, and whether it is the
+// probe of a half-open circuit.
+func (b *Breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state() {
+	case BreakerClosed:
+		return false, nil
+	case BreakerHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return true, nil
+		}
+		// Another request is probing already.
+		return false, &CircuitOpenError{Service: b.Name}
+	default:
+		return false, &CircuitOpenError{Service: b.Name, RetryIn: b.Cooldown - b.now().Sub(b.openedAt)}
+	}
+}
+
+// record counts the outcome of a request that went through.
+func (b *Breaker) record(probe bool, failure error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if failure == nil {
+		if !b.openedAt.IsZero() {
+			log.Printf("Circuit of %s closed, the probe succeeded", b.Name)
+		}
+		b.failures, b.openedAt, b.lastErr = 0, time.Time{}, ""
+		return
+	}
+	b.failures++
+	b.lastErr = failure.Error()
+	switch {
+	case probe:
+		log.Printf("Circuit of %s opened again, the probe failed: %v", b.Name, failure)
+		b.openedAt = b.now()
+	case b.openedAt.IsZero() && b.failures >= b.Threshold:
+		log.Printf("Circuit of %s opened after %d consecutive failures: %v", b.Name, b.failures, failure)
+		b.openedAt = b.now()
+	}
+}
+
+// wrap returns base guarded by the breaker, or base itself for a nil
+// breaker.
+func (b *Breaker) wrap(base http.RoundTripper) http.RoundTripper {
+	if b == nil || b.Threshold <= 0 {
+		return base
+	}
+	return &breakerTransport{breaker: b, base: base}
+}
+
+// breakerTransport lets requests through a Breaker.
+type breakerTransport struct {
+	breaker *Breaker
+	base    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	probe, err := t.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case errors.Is(err, context.Canceled):
+		// Given up by the caller, which says nothing about the backend. A
+		// probe cut short is retried by the next request.
+		t.breaker.mu.Lock()
+		if probe {
+			t.breaker.probing = false
+		}
+		t.breaker.mu.Unlock()
+	case err != nil:
+		t.breaker.record(probe, err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		t.breaker.record(probe, fmt.Errorf("status %s", resp.Status))
+	default:
+		t.breaker.record(probe, nil)
+	}
+	return resp, err
+}
@@ -0,0 +1,115 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	gosync "sync"
+)
+
+// maxCacheEntries bounds the number of responses a cachingTransport keeps;
+// the oldest are evicted first.
+const maxCacheEntries = 1000
+
+// cachingTransport keeps GET responses that carry an ETag or Last-Modified
+// header and revalidates them with a conditional request. When the server
+// answers 304 Not Modified the cached response is returned, so an unchanged
+// resource costs the server no more than the validator check.
+type cachingTransport struct {
+	base http.RoundTripper
+
+	mu      gosync.Mutex
+	entries map[string]*cacheEntry
+	order   []string
+}
+
+type cacheEntry struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newCachingTransport(base http.RoundTripper) *cachingTransport {
+	return &cachingTransport{base: base, entries: make(map[string]*cacheEntry)}
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests carrying their own validators are left to the caller.
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// Responses are kept per credentials, so that clients with different
+	// tokens sharing the transport never see each other's responses.
+	key := req.Header.Get("Authorization") + " " + req.URL.String()
+
+	t.mu.Lock()
+	entry := t.entries[key]
+	t.mu.Unlock()
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if etag := entry.header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.header.Get("Last-Modified"); modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		return entry.response(req), nil
+	}
+	if resp.StatusCode != http.StatusOK || !cacheable(resp.Header) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	t.store(key, &cacheEntry{status: resp.StatusCode, header: resp.Header.Clone(), body: body})
+	return resp, nil
+}
+
+// cacheable reports whether a response has a validator and may be stored.
+func cacheable(header http.Header) bool {
+	if strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-store") {
+		return false
+	}
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+func (t *cachingTransport) store(key string, entry *cacheEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.entries[key]; !ok {
+		t.order = append(t.order, key)
+	}
+	t.entries[key] = entry
+	for len(t.order) > maxCacheEntries {
+		delete(t.entries, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// response returns a fresh copy of the cached response for req.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
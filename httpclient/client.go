@@ -0,0 +1,95 @@
+// Package httpclient builds the HTTP clients used to talk to YouTrack and
+// Google, applying proxy, TLS and timeout settings.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Options configures an HTTP client.
+type Options struct {
+	// Name identifies the backend in debug logs and trace spans, e.g. "youtrack".
+	Name string
+	// Debug logs the method, URL, status and latency of every request.
+	Debug bool
+	// Timeout bounds each request, including reading the body. Zero means no timeout.
+	Timeout time.Duration
+	// CAFile is a PEM bundle of additional root certificates to trust.
+	CAFile string
+	// InsecureSkipVerify disables TLS certificate verification.
+	InsecureSkipVerify bool
+	// Record saves every request and response to this fixture file.
+	Record string
+	// Replay answers requests from this fixture file instead of the network.
+	Replay string
+	// Cache keeps GET responses with an ETag or Last-Modified header in
+	// memory and revalidates them with conditional requests.
+	Cache bool
+	// Breaker, if set, fails requests fast while the backend keeps failing.
+	Breaker *Breaker
+	// BodyLog, if set, logs complete requests and responses while enabled.
+	BodyLog *BodyLog
+}
+
+// New creates an HTTP client with the given options. Proxies are taken from
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. Every
+// request is traced with OpenTelemetry.
+//
+// With Replay set, no request leaves the process; with Record set, the
+// exchanges are saved so that they can be replayed later.
+func New(opts Options) (*http.Client, error) {
+	if opts.Replay != "" {
+		fixture, err := LoadFixture(opts.Replay)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: cache(instrument(opts.Name, opts.Breaker.wrap(opts.BodyLog.wrap(opts.Name, newReplayTransport(fixture))), opts.Debug), opts.Cache), Timeout: opts.Timeout}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if opts.CAFile != "" || opts.InsecureSkipVerify {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.CAFile != "" {
+			pem, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if opts.InsecureSkipVerify {
+			log.Println("WARNING: TLS certificate verification is DISABLED. Connections can be intercepted; use a CA bundle instead.")
+			tlsConfig.InsecureSkipVerify = true
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	var base http.RoundTripper = transport
+	if opts.Record != "" {
+		base = &recordingTransport{path: opts.Record, base: transport}
+	}
+	return &http.Client{Transport: cache(instrument(opts.Name, opts.Breaker.wrap(opts.BodyLog.wrap(opts.Name, base)), opts.Debug), opts.Cache), Timeout: opts.Timeout}, nil
+}
+
+// cache wraps rt with a cachingTransport when enabled. It sits outside the
+// instrumentation, so that debug logs and spans show revalidations as 304.
+func cache(rt http.RoundTripper, enabled bool) http.RoundTripper {
+	if !enabled {
+		return rt
+	}
+	return newCachingTransport(rt)
+}
@@ -0,0 +1,396 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestNew_TrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+
+	client, err := New(Options{Timeout: 5 * time.Second, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if client.Timeout != 5*time.Second {
+		t.Errorf("Expected timeout 5s, got %s", client.Timeout)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the CA bundle to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+
+	plain, _ := New(Options{})
+	if _, err := plain.Get(server.URL); err == nil {
+		t.Error("Expected an unknown CA to be rejected without a bundle")
+	}
+}
+
+func TestNew_MissingCABundle(t *testing.T) {
+	if _, err := New(Options{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("Expected an error for a missing CA bundle")
+	}
+}
+
+func TestNew_DebugLogsRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	client, err := New(Options{Name: "youtrack", Debug: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	resp, err := client.Get(server.URL + "/api/issues")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if got := buf.String(); !strings.Contains(got, "[youtrack] GET "+server.URL+"/api/issues -> 418") {
+		t.Errorf("Expected the request to be logged, got %q", got)
+	}
+}
+
+func TestNew_RecordsRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			// Dropping the kept-alive connection makes net/http send the
+			// request again on a new one.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	client, err := New(Options{Name: "youtrack", Debug: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for range 2 {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	if got := buf.String(); !strings.Contains(got, "-> 200") || !strings.Contains(got, "1 attempt)") || !strings.Contains(got, "2 attempts)") {
+		t.Errorf("Expected the attempts to be logged, got %q", got)
+	}
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(ended))
+	}
+	var resent int64
+	for _, kv := range ended[1].Attributes() {
+		if kv.Key == "http.request.resend_count" {
+			resent = kv.Value.AsInt64()
+		}
+	}
+	if resent != 1 {
+		t.Errorf("Expected the span to record 1 resend, got %d", resent)
+	}
+}
+
+func TestNew_LogsRedactedBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=s3cret")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"bad field","echo":%s}`, body)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	bodyLog := &BodyLog{}
+	client, err := New(Options{Name: "google", BodyLog: bodyLog})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	post := func() string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/events?key=abc123&maxResults=5", strings.NewReader(`{"summary":"Review","attendee":"jane@example.com","access_token":"ya29.tok"}`))
+		req.Header.Set("Authorization", "Bearer ya29.tok")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	post()
+	if buf.Len() != 0 {
+		t.Fatalf("Expected nothing to be logged while disabled, got %q", buf.String())
+	}
+	bodyLog.SetEnabled(true)
+	if got := post(); !strings.Contains(got, "jane@example.com") {
+		t.Errorf("Expected the caller to receive the unredacted body, got %q", got)
+	}
+	got := buf.String()
+	for _, want := range []string{`"summary":"Review"`, `"error":"bad field"`, "-> 400", "key=[redacted]&maxResults=5", `"attendee":"[email]"`, `"access_token":"[redacted]"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected the log to contain %q, got %q", want, got)
+		}
+	}
+	for _, secret := range []string{"ya29.tok", "jane@example.com", "abc123", "s3cret"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("Expected %q to be redacted, got %q", secret, got)
+		}
+	}
+}
+
+func TestNew_RecordsAndReplays(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"call":%d}`, calls)
+	}))
+	defer server.Close()
+
+	fixture := filepath.Join(t.TempDir(), "youtrack.json")
+	recorder, err := New(Options{Record: fixture})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, query := range []string{"?since=1", "?since=2"} {
+		req, _ := http.NewRequest("GET", server.URL+"/api/issues"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := recorder.Do(req)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := recorder.Post(server.URL+"/api/issues", "application/json", strings.NewReader(`{"summary":"Task"}`))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	resp.Body.Close()
+
+	recorded, err := LoadFixture(fixture)
+	if err != nil {
+		t.Fatalf("LoadFixture() error = %v", err)
+	}
+	if len(recorded.Interactions) != 3 {
+		t.Fatalf("Expected 3 recorded interactions, got %d", len(recorded.Interactions))
+	}
+	if got := recorded.Interactions[2].RequestBody; got != `{"summary":"Task"}` {
+		t.Errorf("Expected the request body to be recorded, got %q", got)
+	}
+	if data, _ := os.ReadFile(fixture); strings.Contains(string(data), "secret") {
+		t.Error("Expected request headers not to be recorded")
+	}
+	if got := redactTokens([]byte(`{"access_token":"ya29.secret","expires_in":3599}`)); strings.Contains(got, "secret") || !strings.Contains(got, "3599") {
+		t.Errorf("Expected only the token to be redacted, got %s", got)
+	}
+
+	server.Close()
+	replayer, err := New(Options{Replay: fixture})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// Query parameters differ between runs and are ignored; repeated
+	// requests are answered in recorded order.
+	for _, want := range []string{`{"call":1}`, `{"call":2}`} {
+		resp, err := replayer.Get(server.URL + "/api/issues?since=3")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("Expected %s, got %s", want, body)
+		}
+		if resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected the recorded content type, got %q", resp.Header.Get("Content-Type"))
+		}
+	}
+	if _, err := replayer.Get(server.URL + "/api/issues"); err == nil {
+		t.Error("Expected an error once the recorded responses are used up")
+	}
+	if _, err := replayer.Get(server.URL + "/api/users"); err == nil {
+		t.Error("Expected an error for a request that was not recorded")
+	}
+}
+
+func TestNew_CachesValidatedResponses(t *testing.T) {
+	var conditional, full int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				conditional++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/modified":
+			if r.Header.Get("If-Modified-Since") == "Mon, 01 Jan 2024 00:00:00 GMT" {
+				conditional++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		case "/no-store":
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		full++
+		fmt.Fprint(w, "body of "+r.URL.Path)
+	}))
+	defer server.Close()
+
+	client, err := New(Options{Name: "youtrack", Cache: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	get := func(path string) string {
+		t.Helper()
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	for _, path := range []string{"/etag", "/modified", "/no-store"} {
+		for i := 0; i < 2; i++ {
+			if got := get(path); got != "body of "+path {
+				t.Errorf("GET %s #%d = %q", path, i+1, got)
+			}
+		}
+	}
+	if conditional != 2 || full != 4 {
+		t.Errorf("Expected 2 revalidations and 4 full responses, got %d and %d", conditional, full)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/etag", nil)
+	req.Header.Set("Authorization", "Bearer other")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	if conditional != 2 || full != 5 {
+		t.Errorf("Expected a request with other credentials not to use the cache, got %d revalidations and %d full responses", conditional, full)
+	}
+}
+
+func TestNew_BreakerOpensAndProbes(t *testing.T) {
+	var requests int
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewBreaker("youtrack", 2, time.Minute)
+	breaker.now = func() time.Time { return now }
+	client, err := New(Options{Name: "youtrack", Breaker: breaker})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	get := func() error {
+		t.Helper()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("Get() #%d error = %v", i+1, err)
+		}
+	}
+	var openErr *CircuitOpenError
+	if err := get(); !errors.As(err, &openErr) || openErr.RetryIn != time.Minute {
+		t.Fatalf("Expected the open circuit to fail fast, got %v", err)
+	}
+	if got := breaker.Status(); got.State != BreakerOpen || got.Failures != 2 || requests != 2 {
+		t.Fatalf("Expected an open circuit after 2 requests, got %+v after %d", got, requests)
+	}
+
+	// The failed probe opens the circuit again.
+	now = now.Add(time.Minute)
+	if got := breaker.Status().State; got != BreakerHalfOpen {
+		t.Errorf("Expected a half-open circuit after the cooldown, got %s", got)
+	}
+	if err := get(); err != nil || requests != 3 {
+		t.Fatalf("Expected the probe to go through, got %v after %d requests", err, requests)
+	}
+	if err := get(); !errors.As(err, &openErr) {
+		t.Fatalf("Expected the circuit to open again, got %v", err)
+	}
+
+	// The successful probe closes it.
+	now = now.Add(time.Minute)
+	status = http.StatusOK
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("Get() after recovery error = %v", err)
+		}
+	}
+	if got := breaker.Status(); got.State != BreakerClosed || got.Failures != 0 || requests != 5 {
+		t.Errorf("Expected a closed circuit after 5 requests, got %+v after %d", got, requests)
+	}
+}
@@ -0,0 +1,102 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is a request YouTrack or Google answered with an error status.
+// Depending on the status it is returned as one of the error types below,
+// which tell callers what to do about it with errors.As:
+//
+//   - AuthError: the credentials were rejected; authorize again.
+//   - RateLimitError: too many requests; retry later.
+//   - NotFoundError: the item does not exist; skip it.
+//   - ValidationError: the request was rejected; retrying will not help.
+//
+// Other statuses, such as server errors, are returned as *APIError.
+type APIError struct {
+	// Service is "youtrack" or "google".
+	Service string
+	// Op describes the request, e.g. "update issue".
+	Op     string
+	Status int
+	// Body is the response body, or the message of the service.
+	Body string
+	// Err is the underlying error, if any, e.g. a not found sentinel of the
+	// client.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	status := strconv.Itoa(e.Status)
+	if text := http.StatusText(e.Status); text != "" {
+		status += " " + text
+	}
+	return fmt.Sprintf("failed to %s, status: %s, body: %s", e.Op, status, e.Body)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// AuthError is returned when the credentials were rejected or lack a
+// permission (401, 403).
+type AuthError struct{ APIError }
+
+// RateLimitError is returned when the service asks to slow down (429).
+type RateLimitError struct {
+	APIError
+	// RetryAfter is how long the service asked to wait, or zero.
+	RetryAfter time.Duration
+}
+
+// NotFoundError is returned when the requested item does not exist (404,
+// 410).
+type NotFoundError struct{ APIError }
+
+// ValidationError is returned when the service rejected the request as
+// invalid (400, 409, 422).
+type ValidationError struct{ APIError }
+
+// NewAPIError returns the error for a response with an error status,
+// wrapping cause, which may be nil.
+func NewAPIError(service, op string, status int, header http.Header, body string, cause error) error {
+	e := APIError{Service: service, Op: op, Status: status, Body: body, Err: cause}
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{e}
+	case http.StatusTooManyRequests:
+		return &RateLimitError{APIError: e, RetryAfter: retryAfter(header)}
+	case http.StatusNotFound, http.StatusGone:
+		return &NotFoundError{e}
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+		return &ValidationError{e}
+	default:
+		return &e
+	}
+}
+
+// ResponseError returns the error for resp, whose status is an error, and
+// its body.
+func ResponseError(service, op string, resp *http.Response, body []byte) error {
+	return NewAPIError(service, op, resp.StatusCode, resp.Header, strings.TrimSpace(string(body)), nil)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
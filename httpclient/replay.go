@@ -0,0 +1,192 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	gosync "sync"
+)
+
+// Fixture is a recorded sequence of HTTP exchanges with one backend.
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request and its response. Request headers are
+// not recorded and OAuth tokens in response bodies are redacted, so fixtures
+// never contain credentials.
+type Interaction struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"requestBody,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body"`
+}
+
+// key identifies the requests an interaction answers. Query parameters are
+// ignored: they carry timestamps and sync tokens that differ between runs.
+func (i Interaction) key() string {
+	u := i.URL
+	if n := strings.IndexByte(u, '?'); n >= 0 {
+		u = u[:n]
+	}
+	return i.Method + " " + u
+}
+
+func requestKey(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	return req.Method + " " + u.String()
+}
+
+// LoadFixture reads a fixture written by a recording client.
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// recordingTransport saves every exchange to a fixture file. The file is
+// rewritten after each response, so it is complete even if the process is
+// killed.
+type recordingTransport struct {
+	path    string
+	base    http.RoundTripper
+	mu      gosync.Mutex
+	fixture Fixture
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			requestBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	u := *req.URL
+	u.User = nil
+	header := http.Header{}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fixture.Interactions = append(t.fixture.Interactions, Interaction{
+		Method:      req.Method,
+		URL:         u.String(),
+		RequestBody: string(requestBody),
+		Status:      resp.StatusCode,
+		Header:      header,
+		Body:        string(body),
+	})
+	data, err := json.MarshalIndent(&t.fixture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(t.path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// replayTransport answers requests from a fixture without touching the
+// network. Requests with the same method and URL path are answered in the
+// order they were recorded.
+type replayTransport struct {
+	mu      gosync.Mutex
+	pending map[string][]Interaction
+}
+
+func newReplayTransport(fixture *Fixture) *replayTransport {
+	t := &replayTransport{pending: make(map[string][]Interaction)}
+	for _, interaction := range fixture.Interactions {
+		key := interaction.key()
+		t.pending[key] = append(t.pending[key], interaction)
+	}
+	return t
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := requestKey(req)
+
+	t.mu.Lock()
+	queue := t.pending[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no recorded response for %s", key)
+	}
+	interaction := queue[0]
+	t.pending[key] = queue[1:]
+	t.mu.Unlock()
+
+	header := interaction.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(interaction.Body)),
+		ContentLength: int64(len(interaction.Body)),
+		Request:       req,
+	}, nil
+}
+
+// redactTokens replaces the OAuth tokens in a token endpoint response.
+func redactTokens(body []byte) string {
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) != nil {
+		return string(body)
+	}
+	redacted := false
+	for _, name := range []string{"access_token", "refresh_token", "id_token"} {
+		if _, ok := fields[name]; ok {
+			fields[name] = "REDACTED"
+			redacted = true
+		}
+	}
+	if !redacted {
+		return string(body)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return string(body)
+	}
+	return string(data)
+}
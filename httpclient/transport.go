@@ -0,0 +1,72 @@
+package httpclient
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// attemptsTransport counts the attempts net/http makes to send each request,
+// which retries idempotent requests whose connection broke, and records the
+// resends on the request's span. With debug set, it also logs every request
+// with its status, latency and attempts.
+type attemptsTransport struct {
+	name  string
+	base  http.RoundTripper
+	debug bool
+}
+
+func (t *attemptsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var attempts atomic.Int32
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GetConn: func(string) { attempts.Add(1) },
+	})
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	latency := time.Since(start).Round(time.Millisecond)
+	// Transports that do not dial, such as replays, make one attempt.
+	n := max(int(attempts.Load()), 1)
+	if n > 1 {
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.Int("http.request.resend_count", n-1))
+	}
+	if !t.debug {
+		return resp, err
+	}
+	if err != nil {
+		log.Printf("[%s] %s %s failed after %s, %s: %v\n", t.name, req.Method, redactedURL(req), latency, attemptCount(n), err)
+		return nil, err
+	}
+	log.Printf("[%s] %s %s -> %d (%s, %s)\n", t.name, req.Method, redactedURL(req), resp.StatusCode, latency, attemptCount(n))
+	return resp, nil
+}
+
+func attemptCount(n int) string {
+	if n == 1 {
+		return "1 attempt"
+	}
+	return fmt.Sprintf("%d attempts", n)
+}
+
+// redactedURL returns the request URL without credentials in the userinfo.
+func redactedURL(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	return u.String()
+}
+
+// instrument wraps base with OpenTelemetry spans, reported to the global
+// tracer provider, and with debug request logging when enabled.
+func instrument(name string, base http.RoundTripper, debug bool) http.RoundTripper {
+	return otelhttp.NewTransport(&attemptsTransport{name: name, base: base, debug: debug},
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return name + " " + r.Method
+		}),
+	)
+}
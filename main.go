@@ -2,74 +2,390 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"golang.org/x/oauth2"
 
+	"youtrack-calendar-sync/admin"
 	"youtrack-calendar-sync/config"
 	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/httpclient"
+	"youtrack-calendar-sync/schedule"
 	"youtrack-calendar-sync/sync"
+	"youtrack-calendar-sync/systemd"
+	"youtrack-calendar-sync/webhook"
 	"youtrack-calendar-sync/youtrack"
 )
 
-const (
-	tokenFile    = "data/token.json"
-	dbFile       = "data/sync.db"
-	syncInterval = 24 * time.Hour // Synchronize every 24 hours
-)
+const syncInterval = 24 * time.Hour // Synchronize every 24 hours
+
+// pauseCommands only touch the sync state.
+var pauseCommands = map[string]bool{"pause": true, "resume": true, "planned": true}
 
 func main() {
+	once := flag.Bool("once", false, "perform a single synchronization, print a JSON summary and exit")
+	mappingName := flag.String("mapping", "", "only use the named mapping")
+	observe := flag.Bool("observe", false, "perform a single read-only synchronization and print the changes it would make")
+	changesFile := flag.String("changes", "", "write the changes of --observe to this file instead of stdout")
+	flag.Usage = func() { fmt.Fprintln(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
 
-	// Google Calendar Setup
-	gcalConfig := googlecalendar.GetConfig(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL)
+	if flag.Arg(0) == "workflow" {
+		os.Exit(runWorkflow(cfg.WebhookSecret, flag.Args()[1:], os.Stdout))
+	}
 
-	var token *oauth2.Token
-	if _, err := os.Stat(tokenFile); os.IsNotExist(err) {
-		token, err = googlecalendar.GetTokenFromWeb(gcalConfig)
+	// Spans of API requests, exported when an OTLP endpoint is configured
+	flushTraces := func() {}
+	if cfg.OTLPTracing {
+		shutdown, err := startTracing(context.Background())
 		if err != nil {
-			log.Fatalf("Error getting Google Calendar token from web: %v", err)
+			log.Fatalf("Error setting up tracing: %v", err)
 		}
-		if err := googlecalendar.SaveToken(tokenFile, token); err != nil {
-			log.Fatalf("Error saving Google Calendar token: %v", err)
-		}
-	} else {
-		token, err = googlecalendar.LoadToken(tokenFile)
-		if err != nil {
-			log.Fatalf("Error loading Google Calendar token: %v", err)
+		flushTraces = func() {
+			if err := shutdown(context.Background()); err != nil {
+				log.Printf("Error exporting spans: %v", err)
+			}
 		}
+		defer flushTraces()
 	}
 
-	ctx := context.Background()
-	gcalClient, err := googlecalendar.NewClient(ctx, token, gcalConfig)
+	// HTTP clients
+	if cfg.HTTPRecordDir != "" {
+		if err := os.MkdirAll(cfg.HTTPRecordDir, 0700); err != nil {
+			log.Fatalf("Error creating HTTP record directory: %v", err)
+		}
+	}
+	bodyLog := &httpclient.BodyLog{}
+	bodyLog.SetEnabled(cfg.HTTPDebugBodies)
+	breakers := []*httpclient.Breaker{
+		httpclient.NewBreaker("youtrack", cfg.HTTPBreakerThreshold, cfg.HTTPBreakerCooldown),
+		httpclient.NewBreaker("google", cfg.HTTPBreakerThreshold, cfg.HTTPBreakerCooldown),
+	}
+	ytHTTPClient, err := httpclient.New(httpclient.Options{
+		Name:               "youtrack",
+		Debug:              cfg.HTTPDebug,
+		Record:             fixtureFile(cfg.HTTPRecordDir, "youtrack"),
+		Replay:             fixtureFile(cfg.HTTPReplayDir, "youtrack"),
+		Timeout:            cfg.YouTrackHTTPTimeout,
+		Cache:              cfg.YouTrackHTTPCache,
+		CAFile:             cfg.HTTPCAFile,
+		InsecureSkipVerify: cfg.HTTPInsecureSkipVerify,
+		Breaker:            breakers[0],
+		BodyLog:            bodyLog,
+	})
 	if err != nil {
-		log.Fatalf("Error creating Google Calendar client: %v", err)
+		log.Fatalf("Error creating YouTrack HTTP client: %v", err)
 	}
+	gcalHTTPClient, err := httpclient.New(httpclient.Options{
+		Name:               "google",
+		Debug:              cfg.HTTPDebug,
+		Record:             fixtureFile(cfg.HTTPRecordDir, "google"),
+		Replay:             fixtureFile(cfg.HTTPReplayDir, "google"),
+		Timeout:            cfg.GoogleHTTPTimeout,
+		CAFile:             cfg.HTTPCAFile,
+		InsecureSkipVerify: cfg.HTTPInsecureSkipVerify,
+		Breaker:            breakers[1],
+		BodyLog:            bodyLog,
+	})
+	if err != nil {
+		log.Fatalf("Error creating Google HTTP client: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalHTTPClient)
 
-	// YouTrack Setup
-	ytClient := youtrack.NewClient(cfg.YouTrackBaseURL, cfg.YouTrackPermanentToken)
+	// Data directory, unless all state is remote
+	dataDir := cfg.DataDir
+	if !sync.IsRemoteDSN(cfg.DatabaseURL) {
+		if dataDir == "" {
+			if dataDir, err = config.DefaultDataDir(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		}
+		if err := config.PrepareDataDir(dataDir); err != nil {
+			log.Fatalf("Error preparing data directory: %v", err)
+		}
+	}
 
 	// Database Setup
-	db, err := sync.NewDB(dbFile)
+	dataSource := filepath.Join(dataDir, config.DBFile)
+	if cfg.DatabaseURL != "" {
+		dataSource = cfg.DatabaseURL
+	}
+	backupHTTPClient, err := httpclient.New(httpclient.Options{
+		Name:               "backup",
+		Debug:              cfg.HTTPDebug,
+		CAFile:             cfg.HTTPCAFile,
+		InsecureSkipVerify: cfg.HTTPInsecureSkipVerify,
+	})
+	if err != nil {
+		log.Fatalf("Error creating backup HTTP client: %v", err)
+	}
+	if flag.Arg(0) == "backup" {
+		os.Exit(runBackup(dataDir, dataSource, backupHTTPClient, flag.Args()[1:], os.Stdout))
+	}
+
+	// Remote state also holds the Google tokens.
+	var tokenDB *sync.DB
+	if sync.IsRemoteDSN(dataSource) {
+		if tokenDB, err = sync.NewDB(dataSource); err != nil {
+			log.Fatalf("Error initializing database: %v", err)
+		}
+		defer tokenDB.Close()
+	}
+
+	// Tenants and mappings registered through the admin API are stored
+	// next to the state.
+	store := tokenDB
+	if store == nil {
+		if store, err = sync.NewDB(dataSource); err != nil {
+			log.Fatalf("Error initializing database: %v", err)
+		}
+		defer store.Close()
+	}
+	if flag.Arg(0) == "token" {
+		code := runToken(store, flag.Args()[1:], os.Stdout)
+		store.Close()
+		os.Exit(code)
+	}
+	gcalConfig := googlecalendar.GetConfig(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL)
+	if cfg.GoogleCreateCalendar {
+		gcalConfig.Scopes = []string{googlecalendar.CalendarScope}
+	}
+	reg := &registry{
+		cfg:          cfg,
+		ctx:          ctx,
+		gcalConfig:   gcalConfig,
+		ytHTTPClient: ytHTTPClient,
+		dataDir:      dataDir,
+		dataSource:   dataSource,
+		tokenDB:      tokenDB,
+		store:        store,
+	}
+	if err := reg.load(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Synchronizer Setup, one per mapping
+	selected, err := selectMappings(reg.definitions, *mappingName)
 	if err != nil {
-		log.Fatalf("Error initializing database: %v", err)
+		log.Fatalf("Error: %v", err)
+	}
+	var mappings []*mapping
+	for _, mc := range selected {
+		m, err := reg.open(mc)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer m.db.Close()
+		// Pausing must work while YouTrack is unavailable for maintenance.
+		if !pauseCommands[flag.Arg(0)] {
+			if err := m.synchronizer.ValidateFields(); errors.Is(err, sync.ErrSchemaMismatch) {
+				log.Fatalf("Error validating YouTrack fields of mapping %s: %v", m.label(), err)
+			} else if err != nil {
+				log.Printf("WARNING: could not validate YouTrack fields of mapping %s: %v", m.label(), err)
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	linkSiblings(mappings)
+
+	// One-shot commands
+	if flag.Arg(0) == "resync" {
+		code := runResync(mappings, flag.Args()[1:])
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		os.Exit(code)
+	}
+	if flag.Arg(0) == "doctor" {
+		code := runDoctor(mappings, flag.Args()[1:], os.Stdout)
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		os.Exit(code)
+	}
+	if flag.Arg(0) == "import" {
+		code := runImport(mappings, flag.Args()[1:], os.Stdout, os.Stderr)
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		os.Exit(code)
+	}
+	if flag.Arg(0) == "link" || flag.Arg(0) == "unlink" {
+		var code int
+		if flag.Arg(0) == "link" {
+			code = runLink(mappings, flag.Args()[1:], os.Stdout)
+		} else {
+			code = runUnlink(mappings, flag.Args()[1:], os.Stdout)
+		}
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		os.Exit(code)
+	}
+	if flag.Arg(0) == "acl" {
+		code := runACL(mappings, flag.Args()[1:], os.Stdout)
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		os.Exit(code)
+	}
+	if pauseCommands[flag.Arg(0)] {
+		var code int
+		switch flag.Arg(0) {
+		case "pause":
+			code = runPause(mappings, flag.Args()[1:])
+		case "resume":
+			code = runResume(mappings, flag.Args()[1:], os.Stdout)
+		case "planned":
+			code = runPlanned(mappings, flag.Args()[1:], os.Stdout)
+		}
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		os.Exit(code)
+	}
+	if flag.NArg() > 0 {
+		if len(mappings) > 1 {
+			log.Fatalf("Error: several mappings are configured, choose one with --mapping")
+		}
+		if err := runCommand(mappings[0].synchronizer, flag.Args()); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	if *observe {
+		code := runObserve(mappings, *changesFile)
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		os.Exit(code)
+	}
+	if *once {
+		code := runOnce(mappings)
+		for _, m := range mappings {
+			m.db.Close()
+		}
+		flushTraces()
+		os.Exit(code)
 	}
-	defer db.Close()
 
-	// Synchronizer Setup and Start
-	synchronizer := sync.NewSynchronizer(gcalClient, ytClient, db, cfg.YouTrackProjectID, cfg.YouTrackQueryProjectID, cfg.GoogleCalendarId) // "primary" for user's primary calendar
+	// Webhook receiver for YouTrack workflow notifications
+	if cfg.WebhookAddr != "" {
+		handler := webhook.NewHandler(cfg.WebhookSecret)
+		handler.APITokens = store
+		for _, m := range mappings {
+			query, err := m.synchronizer.IssueQuery()
+			if err != nil {
+				log.Printf("Mapping %s will not receive webhooks: %v", m.label(), err)
+				continue
+			}
+			projects := youtrack.QueryProjects(query)
+			if len(projects) == 0 {
+				log.Printf("Query %q of mapping %s names no project; webhooks will not reach it", query, m.label())
+			}
+			for _, project := range projects {
+				handler.Register(project, m.synchronizer)
+			}
+		}
+		mux := http.NewServeMux()
+		mux.Handle(webhook.Path, handler)
+		if cfg.GooglePushURL != "" {
+			startPushChannels(cfg, mappings, mux)
+		}
+		go func() {
+			log.Printf("Listening for YouTrack webhooks on %s%s", cfg.WebhookAddr, webhook.Path)
+			if err := http.ListenAndServe(cfg.WebhookAddr, mux); err != nil {
+				log.Fatalf("Webhook server failed: %v", err)
+			}
+		}()
+	}
 
-	// Perform an initial sync
-	if err := synchronizer.Sync(); err != nil {
-		log.Printf("Initial synchronization failed: %v", err)
+	// Scheduled backups of the local state
+	var backups *backupScheduler
+	if cfg.BackupDir != "" {
+		cron, err := schedule.Parse(cfg.BackupSchedule)
+		if err != nil {
+			log.Fatalf("Error loading configuration: BACKUP_SCHEDULE: %v", err)
+		}
+		if err := os.MkdirAll(cfg.BackupDir, 0700); err != nil {
+			log.Fatalf("Error creating backup directory: %v", err)
+		}
+		backups = &backupScheduler{cfg: cfg, dataDir: dataDir, dataSource: dataSource, client: backupHTTPClient}
+		go backups.run(cron)
 	}
 
-	// Start periodic sync
-	log.Printf("Starting periodic synchronization every %s...", syncInterval)
-	synchronizer.StartSyncLoop(syncInterval)
+	// Admin API for status and Google re-authorization
+	if cfg.AdminAddr != "" {
+		server := &admin.Server{
+			Token:      cfg.AdminToken,
+			OAuth:      reg.gcalConfig,
+			Context:    ctx,
+			Authorized: reg.authorized,
+			Registry:   reg,
+			APITokens:  store,
+			BodyLog:    bodyLog,
+		}
+		reg.server = server
+		if backups != nil {
+			server.Backup = backups.status
+		}
+		if cfg.HTTPBreakerThreshold > 0 {
+			server.Breakers = func() []httpclient.BreakerStatus {
+				statuses := make([]httpclient.BreakerStatus, len(breakers))
+				for i, b := range breakers {
+					statuses[i] = b.Status()
+				}
+				return statuses
+			}
+		}
+		for _, m := range mappings {
+			server.Mappings = append(server.Mappings, admin.Mapping{Name: m.label(), Account: m.GoogleAccount, Tenant: m.Tenant, Syncer: m.synchronizer})
+		}
+		for _, t := range cfg.Tenants {
+			if t.AdminToken != "" {
+				if server.TenantTokens == nil {
+					server.TenantTokens = make(map[string]string)
+				}
+				server.TenantTokens[t.Name] = t.AdminToken
+			}
+		}
+		go func() {
+			log.Printf("Serving the admin API on %s", cfg.AdminAddr)
+			if err := http.ListenAndServe(cfg.AdminAddr, server.Handler()); err != nil {
+				log.Fatalf("Admin server failed: %v", err)
+			}
+		}()
+	}
+
+	// Preflight passed: tell systemd we are up and keep it informed.
+	if err := systemd.Notify(systemd.Ready); err != nil {
+		log.Printf("Error notifying systemd: %v", err)
+	}
+	startWatchdog(reg.runningMappings)
+
+	for _, m := range mappings {
+		reg.run(m)
+	}
+	reg.wait()
+}
+
+// fixtureFile returns the path of the named backend's HTTP fixture in dir,
+// or "" when dir is not set.
+func fixtureFile(dir, name string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name+".json")
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"youtrack-calendar-sync/config"
+	"youtrack-calendar-sync/notify"
+	"youtrack-calendar-sync/schedule"
+	"youtrack-calendar-sync/sync"
+)
+
+// mapping is a configured mapping with its synchronizer.
+type mapping struct {
+	config.Mapping
+	synchronizer *sync.Synchronizer
+	db           *sync.DB
+	// schedule is nil for the fixed syncInterval.
+	schedule *schedule.Cron
+}
+
+// label names the mapping in log messages.
+func (m *mapping) label() string {
+	if m.Name == "" {
+		return "default"
+	}
+	return m.Name
+}
+
+// newSynchronizer creates the synchronizer of m with the settings shared by
+// all mappings.
+func newSynchronizer(cfg *config.Config, m config.Mapping, gcalClient sync.GCalClient, ytClient sync.YTClient, db *sync.DB) (*sync.Synchronizer, error) {
+	var err error
+	synchronizer := sync.NewSynchronizer(gcalClient, ytClient, db,
+		sync.WithProject(m.YouTrackProjectID),
+		sync.WithQueryProject(m.YouTrackQueryProjectID),
+		sync.WithCalendar(m.GoogleCalendarID),
+	)
+	synchronizer.SavedSearch = m.YouTrackSavedSearch
+	synchronizer.ManagedFields, err = sync.NewManagedFields(cfg.YouTrackManagedFields, cfg.GoogleManagedFields)
+	if err != nil {
+		return nil, fmt.Errorf("error loading managed fields: %w", err)
+	}
+	synchronizer.DescriptionTemplate, err = sync.LoadDescriptionTemplate(cfg.DescriptionTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("error loading description template: %w", err)
+	}
+	synchronizer.IncludeDrafts = cfg.IncludeDrafts
+	synchronizer.IncludeResolved = cfg.IncludeResolved
+	synchronizer.ResolvedAction, err = sync.ParseResolvedAction(cfg.ResolvedAction)
+	if err != nil {
+		return nil, err
+	}
+	synchronizer.ArchiveCalendarID = cfg.GoogleArchiveCalendarID
+	synchronizer.SubtaskMode, err = sync.ParseSubtaskMode(cfg.SubtaskMode)
+	if err != nil {
+		return nil, err
+	}
+	synchronizer.LinkRecurringInstances = cfg.LinkRecurringInstances
+	synchronizer.DependencyCheck, err = sync.ParseDependencyCheck(cfg.DependencyCheck)
+	if err != nil {
+		return nil, err
+	}
+	synchronizer.ConflictCheck, err = sync.ParseConflictCheck(cfg.ConflictCheck)
+	if err != nil {
+		return nil, err
+	}
+	synchronizer.EventCopies, err = sync.ParseEventCopies(cfg.GoogleEventCopies)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.GoogleSkipEventTypes != nil {
+		synchronizer.SkippedEventTypes = sync.EventTypeSet(cfg.GoogleSkipEventTypes)
+	}
+	if len(cfg.GoogleIgnoreSenders) > 0 || len(cfg.GoogleIgnoreProperties) > 0 {
+		synchronizer.IgnoredEvents = &sync.IgnoredEvents{
+			Senders:    cfg.GoogleIgnoreSenders,
+			Properties: cfg.GoogleIgnoreProperties,
+		}
+	}
+	synchronizer.Response = sync.ResponsePolicy{
+		Field:                 cfg.YouTrackResponseField,
+		Values:                cfg.YouTrackResponseValues,
+		DeclinedPriority:      cfg.DeclinedPriority,
+		DeclinedClearsDueDate: cfg.DeclinedClearsDueDate,
+		States:                cfg.YouTrackResponseStates,
+	}
+	if synchronizer.Response.Declined, err = sync.ParseDeclinedAction(cfg.DeclinedAction); err != nil {
+		return nil, err
+	}
+	synchronizer.ConferenceField = cfg.YouTrackConferenceField
+	synchronizer.LocationField = cfg.YouTrackLocationField
+	synchronizer.IssueType = cfg.YouTrackIssueType
+	synchronizer.IssueTypeRules, err = sync.ParseIssueTypeRules(cfg.YouTrackIssueTypeRules)
+	if err != nil {
+		return nil, err
+	}
+	hook, err := sync.NewExprHook(sync.ExprHookSources{
+		CreateIssue: cfg.HookCreateIssue,
+		UpdateIssue: cfg.HookUpdateIssue,
+		CreateEvent: cfg.HookCreateEvent,
+		UpdateEvent: cfg.HookUpdateEvent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if hook != nil {
+		synchronizer.Hooks = append(synchronizer.Hooks, hook)
+	}
+	synchronizer.DefaultFields, err = sync.ParseDefaultFields(cfg.YouTrackDefaultFields)
+	if err != nil {
+		return nil, err
+	}
+	synchronizer.DefaultTags = cfg.YouTrackDefaultTags
+	synchronizer.Tags = sync.TagSync{Hashtags: cfg.YouTrackTagHashtags, ParseHashtags: cfg.YouTrackHashtagTags}
+	if synchronizer.Tags.Colors, err = sync.ParseTagColors(cfg.YouTrackTagColors); err != nil {
+		return nil, err
+	}
+	synchronizer.EventMarker = sync.EventMarker{Prefix: cfg.GoogleEventPrefix, Suffix: cfg.GoogleEventSuffix}
+	if synchronizer.EventVisibility, err = sync.ParseVisibility(cfg.GoogleEventVisibility); err != nil {
+		return nil, err
+	}
+	if synchronizer.EventTransparency, err = sync.ParseTransparency(cfg.GoogleEventTransparency); err != nil {
+		return nil, err
+	}
+	synchronizer.AssignOrganizer = cfg.AssignOrganizer
+	synchronizer.ProvenanceComment = cfg.ProvenanceComment
+	synchronizer.AssigneeFallback = cfg.AssigneeFallback
+	synchronizer.DriftThreshold = cfg.DriftThreshold
+	synchronizer.DriftCheckInterval = cfg.DriftCheckInterval
+	synchronizer.EchoWindow = cfg.EchoWindow
+	synchronizer.ClockSkew = cfg.ClockSkew
+	synchronizer.LightPolling = cfg.YouTrackLightPolling
+	synchronizer.Paused = cfg.Paused
+	if synchronizer.StartDate, err = config.ParseStartDate(m.StartDate); err != nil {
+		return nil, err
+	}
+	if synchronizer.EventTiming, err = sync.ParseEventTiming(m.EventTiming); err != nil {
+		return nil, err
+	}
+	if synchronizer.DueDateBoundary, err = sync.ParseDueDateBoundary(m.DueDateBoundary); err != nil {
+		return nil, err
+	}
+	synchronizer.DescriptionSync = m.SyncDescriptions != nil && *m.SyncDescriptions
+	if m.MinAttendees != nil {
+		if *m.MinAttendees < 0 {
+			return nil, fmt.Errorf("minimum number of attendees must not be negative, got %d", *m.MinAttendees)
+		}
+		synchronizer.MinAttendees = *m.MinAttendees
+	}
+	if synchronizer.EventTime, err = sync.ParseTimeOfDay(m.EventTime); err != nil {
+		return nil, fmt.Errorf("event time: %w", err)
+	}
+	if synchronizer.WorkingHours, err = sync.ParseWorkingHours(cfg.WorkingHours); err != nil {
+		return nil, err
+	}
+	if synchronizer.WorkingHours != nil {
+		synchronizer.WorkingHours.SkipWeekends = cfg.SkipWeekends
+	}
+	if cfg.PlannerEstimateField != "" {
+		synchronizer.Planner = &sync.Planner{
+			EstimateField: cfg.PlannerEstimateField,
+			Horizon:       cfg.PlannerHorizon,
+			BlockLength:   cfg.PlannerBlockLength,
+		}
+	}
+	if cfg.DeadlineRollup {
+		synchronizer.Rollup = &sync.Rollup{Horizon: cfg.RollupHorizon, TitleIssues: cfg.RollupTitleIssues}
+	}
+	if cfg.GoogleCreateCalendar {
+		shares, err := sync.ParseCalendarShares(m.GoogleCalendarShareWith)
+		if err != nil {
+			return nil, err
+		}
+		name := m.GoogleCalendarName
+		if name == "" {
+			name = "YouTrack"
+			if m.Name != "" {
+				name += " " + m.Name
+			}
+		}
+		synchronizer.CalendarSetup = &sync.CalendarSetup{Name: name, Shares: shares}
+	}
+	if cfg.WeeklyDigest {
+		digest := &sync.WeeklyDigest{At: sync.DefaultDigestTime}
+		if cfg.WeeklyDigestTime != "" {
+			if digest.At, err = sync.ParseTimeOfDay(cfg.WeeklyDigestTime); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.WeeklyDigestTimeZone != "" {
+			if digest.Location, err = time.LoadLocation(cfg.WeeklyDigestTimeZone); err != nil {
+				return nil, fmt.Errorf("invalid weekly digest time zone %q: %w", cfg.WeeklyDigestTimeZone, err)
+			}
+		}
+		synchronizer.WeeklyDigest = digest
+	}
+	if cfg.MorningAgendaTime != "" {
+		agenda := &sync.MorningAgenda{Sink: notifySinks(cfg)}
+		if agenda.At, err = sync.ParseTimeOfDay(cfg.MorningAgendaTime); err != nil {
+			return nil, err
+		}
+		if cfg.MorningAgendaTimeZone != "" {
+			if agenda.Location, err = time.LoadLocation(cfg.MorningAgendaTimeZone); err != nil {
+				return nil, fmt.Errorf("invalid morning agenda time zone %q: %w", cfg.MorningAgendaTimeZone, err)
+			}
+		}
+		synchronizer.MorningAgenda = agenda
+	}
+	if cfg.YouTrackOutbox {
+		synchronizer.Outbox = &sync.Outbox{MaxAge: cfg.YouTrackOutboxMaxAge}
+	}
+	if synchronizer.PriorityDurations, err = sync.ParseEventDurations(cfg.PriorityDurations); err != nil {
+		return nil, err
+	}
+	if synchronizer.TypeDurations, err = sync.ParseEventDurations(cfg.TypeDurations); err != nil {
+		return nil, err
+	}
+	if m.HolidayCalendar != "" {
+		action, err := sync.ParseHolidayAction(m.HolidayAction)
+		if err != nil {
+			return nil, err
+		}
+		synchronizer.Holidays = &sync.Holidays{CalendarID: m.HolidayCalendar, Action: action}
+	}
+	if m.EventDuration != "" {
+		if synchronizer.EventDuration, err = time.ParseDuration(m.EventDuration); err != nil || synchronizer.EventDuration <= 0 {
+			return nil, fmt.Errorf("event duration must be a positive duration such as 1h, got %q", m.EventDuration)
+		}
+	}
+	return synchronizer, nil
+}
+
+// notifySinks returns the configured notification sinks.
+func notifySinks(cfg *config.Config) notify.Sinks {
+	var sinks notify.Sinks
+	if cfg.NotifySlackWebhookURL != "" {
+		sinks = append(sinks, &notify.Slack{WebhookURL: cfg.NotifySlackWebhookURL})
+	}
+	if cfg.NotifyNtfyURL != "" {
+		sinks = append(sinks, &notify.Ntfy{TopicURL: cfg.NotifyNtfyURL, Token: cfg.NotifyNtfyToken})
+	}
+	if len(cfg.NotifyEmailTo) > 0 {
+		sinks = append(sinks, &notify.Email{
+			Addr:     cfg.NotifySMTPAddr,
+			From:     cfg.NotifyEmailFrom,
+			To:       cfg.NotifyEmailTo,
+			Username: cfg.NotifySMTPUsername,
+			Password: cfg.NotifySMTPPassword,
+		})
+	}
+	return sinks
+}
+
+// selectMappings returns the mapping called name, even when it is disabled,
+// or all enabled mappings when name is empty.
+func selectMappings(mappings []config.Mapping, name string) ([]config.Mapping, error) {
+	if name == "" {
+		var enabled []config.Mapping
+		for _, m := range mappings {
+			if m.Disabled {
+				log.Printf("Mapping %s is disabled", m.Name)
+				continue
+			}
+			enabled = append(enabled, m)
+		}
+		if len(enabled) == 0 {
+			return nil, fmt.Errorf("every mapping is disabled, select one with --mapping")
+		}
+		return enabled, nil
+	}
+	for _, m := range mappings {
+		if m.Name == name {
+			return []config.Mapping{m}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown mapping %q", name)
+}
+
+// linkSiblings lets every synchronizer take over events from the others of
+// the same tenant when an issue moves between mappings.
+func linkSiblings(mappings []*mapping) {
+	for _, m := range mappings {
+		var siblings []*sync.Synchronizer
+		for _, other := range mappings {
+			if other != m && other.Tenant == m.Tenant {
+				siblings = append(siblings, other.synchronizer)
+			}
+		}
+		m.synchronizer.SetSiblings(siblings)
+	}
+}
+
+// scheduleOf returns the cron expression of m, falling back to SYNC_SCHEDULE.
+func scheduleOf(cfg *config.Config, m config.Mapping) string {
+	if m.SyncSchedule != "" {
+		return m.SyncSchedule
+	}
+	return cfg.SyncSchedule
+}
+
+// runLoop runs the sync loop of m until it is stopped.
+func runLoop(m *mapping) {
+	// With a schedule, the first sync waits for the first activation.
+	if m.schedule != nil {
+		log.Printf("Starting scheduled synchronization of mapping %s...", m.label())
+		m.synchronizer.StartScheduledSyncLoop(m.schedule)
+		return
+	}
+
+	// Perform an initial sync
+	if _, err := m.synchronizer.Sync(); err != nil {
+		log.Printf("Initial synchronization of mapping %s failed: %v", m.label(), err)
+	}
+
+	// Start periodic sync
+	log.Printf("Starting periodic synchronization of mapping %s every %s...", m.label(), syncInterval)
+	m.synchronizer.StartSyncLoop(syncInterval)
+}
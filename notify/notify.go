@@ -0,0 +1,132 @@
+// Package notify sends short messages to people through chat, push or
+// email services, e.g. the morning agenda of the synchronizer.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+)
+
+// Sink delivers messages of a title and a plain text body.
+type Sink interface {
+	Notify(title, body string) error
+}
+
+// Sinks delivers each message to all of its sinks.
+type Sinks []Sink
+
+// Notify sends the message to every sink, even when some fail, and returns
+// their errors joined.
+func (s Sinks) Notify(title, body string) error {
+	var errs []error
+	for _, sink := range s {
+		if err := sink.Notify(title, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Slack posts messages to a Slack incoming webhook.
+type Slack struct {
+	WebhookURL string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Notify posts the message, its title in bold.
+func (s *Slack) Notify(title, body string) error {
+	payload, err := json.Marshal(map[string]string{"text": "*" + title + "*\n" + body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create Slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send("Slack", s.HTTPClient, req)
+}
+
+// Ntfy publishes messages to an ntfy topic, such as https://ntfy.sh/mytopic.
+type Ntfy struct {
+	TopicURL string
+	// Token, if set, is the access token of a protected topic.
+	Token string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Notify publishes the message.
+func (n *Ntfy) Notify(title, body string) error {
+	req, err := http.NewRequest("POST", n.TopicURL, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create ntfy request: %w", err)
+	}
+	req.Header.Set("Title", title)
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return send("ntfy", n.HTTPClient, req)
+}
+
+// send sends req to service and checks that it succeeded.
+func send(service string, client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to notify through %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to notify through %s: status %s: %s", service, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Email sends messages as plain text email through an SMTP server.
+type Email struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	From string
+	To   []string
+	// Username and Password, if set, authenticate with PLAIN auth, which
+	// the server must offer over TLS.
+	Username string
+	Password string
+
+	// sendMail is replaced in tests.
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Notify sends the message with the title as subject.
+func (e *Email) Notify(title, body string) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := strings.Cut(e.Addr, ":")
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(title))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	sendMail := e.sendMail
+	if sendMail == nil {
+		sendMail = smtp.SendMail
+	}
+	if err := sendMail(e.Addr, auth, e.From, e.To, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to notify by email: %w", err)
+	}
+	return nil
+}
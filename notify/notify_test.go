@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestSinks_DeliverToEverySink(t *testing.T) {
+	var slackText, ntfyTitle, ntfyBody, ntfyAuth string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		slackText = payload.Text
+	}))
+	defer slack.Close()
+	ntfy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ntfyTitle, ntfyBody, ntfyAuth = r.Header.Get("Title"), string(body), r.Header.Get("Authorization")
+	}))
+	defer ntfy.Close()
+	var mailTo []string
+	var mail string
+	email := &Email{Addr: "smtp.example.com:587", From: "sync@example.com", To: []string{"me@example.com"},
+		sendMail: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			mailTo, mail = to, string(msg)
+			return nil
+		}}
+
+	sinks := Sinks{&Slack{WebhookURL: slack.URL}, &Ntfy{TopicURL: ntfy.URL, Token: "tk"}, email}
+	if err := sinks.Notify("Due today", "PRJ-1 Ship it"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if slackText != "*Due today*\nPRJ-1 Ship it" {
+		t.Errorf("Unexpected Slack message %q", slackText)
+	}
+	if ntfyTitle != "Due today" || ntfyBody != "PRJ-1 Ship it" || ntfyAuth != "Bearer tk" {
+		t.Errorf("Unexpected ntfy message %q %q %q", ntfyTitle, ntfyBody, ntfyAuth)
+	}
+	if len(mailTo) != 1 || !strings.Contains(mail, "Subject: Due today\r\n") || !strings.HasSuffix(mail, "\r\n\r\nPRJ-1 Ship it") {
+		t.Errorf("Unexpected email to %v: %q", mailTo, mail)
+	}
+}
+
+func TestSinks_ReportFailuresAndKeepSending(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such topic", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	sent := false
+	email := &Email{Addr: "smtp.example.com:25", sendMail: func(string, smtp.Auth, string, []string, []byte) error {
+		sent = true
+		return errors.New("connection refused")
+	}}
+
+	err := Sinks{&Ntfy{TopicURL: failing.URL}, email}.Notify("Due today", "")
+	if err == nil || !strings.Contains(err.Error(), "no such topic") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Expected the errors of both sinks, got %v", err)
+	}
+	if !sent {
+		t.Error("Expected the email to be sent after ntfy failed")
+	}
+}
@@ -0,0 +1,242 @@
+// Package calsync runs the YouTrack and Google Calendar synchronization
+// inside another program. Unlike the command, it reads no environment
+// variables or files of its own and never exits the process: everything is
+// passed as options to New, and failures are returned as errors.
+//
+//	engine, err := calsync.New(
+//		calsync.WithYouTrack("https://example.youtrack.cloud", token),
+//		calsync.WithGoogle(ctx, oauthConfig, oauthToken),
+//		calsync.WithDatabase("/var/lib/myapp/sync.db"),
+//		calsync.WithProject("PRJ"),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	defer engine.Close()
+//	result, err := engine.Sync()
+package calsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/sync"
+	"youtrack-calendar-sync/youtrack"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultCalendarID is the calendar synced unless WithCalendar is given.
+const DefaultCalendarID = "primary"
+
+// Option configures an Engine, see New.
+type Option func(*options) error
+
+type options struct {
+	youtrack     sync.YTClient
+	google       sync.GCalClient
+	db           *sync.DB
+	dsn          string
+	projectID    string
+	queryProject string
+	calendarID   string
+	configure    []func(*sync.Synchronizer)
+}
+
+// WithYouTrack syncs the YouTrack instance at baseURL, authenticating with a
+// permanent token.
+func WithYouTrack(baseURL, token string) Option {
+	return func(o *options) error {
+		if baseURL == "" || token == "" {
+			return errors.New("YouTrack base URL and token are required")
+		}
+		o.youtrack = youtrack.NewClient(baseURL, token)
+		return nil
+	}
+}
+
+// WithYouTrackHTTP is WithYouTrack sending requests through httpClient.
+func WithYouTrackHTTP(baseURL, token string, httpClient *http.Client) Option {
+	return func(o *options) error {
+		if err := WithYouTrack(baseURL, token)(o); err != nil {
+			return err
+		}
+		o.youtrack.(*youtrack.Client).HTTPClient = httpClient
+		return nil
+	}
+}
+
+// WithYouTrackClient syncs through client, e.g. a configured
+// *youtrack.Client.
+func WithYouTrackClient(client sync.YTClient) Option {
+	return func(o *options) error {
+		o.youtrack = client
+		return nil
+	}
+}
+
+// WithGoogle syncs the Google account token authorizes for. Requests are
+// sent through the HTTP client stored in ctx under oauth2.HTTPClient, if
+// any. Refreshed tokens are not saved; use WithGoogleClient with a token
+// source of your own to keep them.
+func WithGoogle(ctx context.Context, config *oauth2.Config, token *oauth2.Token) Option {
+	return func(o *options) error {
+		client, err := googlecalendar.NewClient(ctx, token, config)
+		if err != nil {
+			return err
+		}
+		o.google = client
+		return nil
+	}
+}
+
+// WithGoogleClient syncs through client, e.g. a *googlecalendar.Client.
+func WithGoogleClient(client sync.GCalClient) Option {
+	return func(o *options) error {
+		o.google = client
+		return nil
+	}
+}
+
+// WithDatabase keeps the sync state in the database at dataSourceName: a
+// SQLite file path, or a PostgreSQL URL. The Engine closes it.
+func WithDatabase(dataSourceName string) Option {
+	return func(o *options) error {
+		o.dsn = dataSourceName
+		return nil
+	}
+}
+
+// WithDB keeps the sync state in db, which the caller closes.
+func WithDB(db *sync.DB) Option {
+	return func(o *options) error {
+		o.db = db
+		return nil
+	}
+}
+
+// WithProject creates issues in the YouTrack project projectID and, unless
+// WithQueryProject is given, syncs the issues of that project.
+func WithProject(projectID string) Option {
+	return func(o *options) error {
+		o.projectID = projectID
+		return nil
+	}
+}
+
+// WithQueryProject syncs the issues of projectID rather than those of the
+// project of WithProject.
+func WithQueryProject(projectID string) Option {
+	return func(o *options) error {
+		o.queryProject = projectID
+		return nil
+	}
+}
+
+// WithCalendar syncs the Google calendar calendarID instead of
+// DefaultCalendarID.
+func WithCalendar(calendarID string) Option {
+	return func(o *options) error {
+		o.calendarID = calendarID
+		return nil
+	}
+}
+
+// WithSynchronizer calls configure with the synchronizer before it is used,
+// to set the settings that have no option of their own, e.g. EventTiming.
+func WithSynchronizer(configure func(*sync.Synchronizer)) Option {
+	return func(o *options) error {
+		o.configure = append(o.configure, configure)
+		return nil
+	}
+}
+
+// Engine synchronizes one YouTrack project with one Google calendar.
+type Engine struct {
+	s *sync.Synchronizer
+	// db is closed by Close, unless it was passed with WithDB.
+	db *sync.DB
+}
+
+// New returns an Engine configured by opts. YouTrack, Google, the database
+// and the project are required.
+func New(opts ...Option) (*Engine, error) {
+	o := options{calendarID: DefaultCalendarID}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case o.youtrack == nil:
+		return nil, errors.New("a YouTrack client is required, see WithYouTrack")
+	case o.google == nil:
+		return nil, errors.New("a Google Calendar client is required, see WithGoogle")
+	case o.db == nil && o.dsn == "":
+		return nil, errors.New("a database is required, see WithDatabase")
+	case o.projectID == "":
+		return nil, errors.New("a YouTrack project is required, see WithProject")
+	}
+	if o.queryProject == "" {
+		o.queryProject = o.projectID
+	}
+
+	e := &Engine{}
+	db := o.db
+	if db == nil {
+		var err error
+		if db, err = sync.NewDB(o.dsn); err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		e.db = db
+	}
+	e.s = sync.NewSynchronizer(o.google, o.youtrack, db,
+		sync.WithProject(o.projectID),
+		sync.WithQueryProject(o.queryProject),
+		sync.WithCalendar(o.calendarID),
+	)
+	for _, configure := range o.configure {
+		configure(e.s)
+	}
+	return e, nil
+}
+
+// Sync performs a single synchronization pass, see sync.Synchronizer.Sync.
+func (e *Engine) Sync() (sync.RunResult, error) {
+	return e.s.Sync()
+}
+
+// Run synchronizes every interval until ctx is done, then waits for a
+// running pass to finish. The Engine cannot run again afterwards.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			e.s.Stop()
+		case <-done:
+		}
+	}()
+	e.s.StartSyncLoop(interval)
+	return ctx.Err()
+}
+
+// Synchronizer returns the synchronizer of e, for the operations the Engine
+// does not wrap, such as SyncIssue.
+func (e *Engine) Synchronizer() *sync.Synchronizer {
+	return e.s
+}
+
+// Close stops e and closes the database it opened.
+func (e *Engine) Close() error {
+	e.s.Stop()
+	if e.db == nil {
+		return nil
+	}
+	return e.db.Close()
+}
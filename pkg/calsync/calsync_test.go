@@ -0,0 +1,108 @@
+package calsync
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"youtrack-calendar-sync/fake"
+	"youtrack-calendar-sync/sync"
+	"youtrack-calendar-sync/youtrack"
+
+	"golang.org/x/oauth2"
+)
+
+func TestNew_RequiresOptions(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"youtrack", nil, "YouTrack client"},
+		{"google", []Option{WithYouTrack("http://youtrack.example.com", "token")}, "Google Calendar client"},
+		{"database", []Option{
+			WithYouTrack("http://youtrack.example.com", "token"),
+			WithGoogle(ctx, &oauth2.Config{}, &oauth2.Token{AccessToken: "fake"}),
+		}, "database"},
+		{"project", []Option{
+			WithYouTrack("http://youtrack.example.com", "token"),
+			WithGoogle(ctx, &oauth2.Config{}, &oauth2.Token{AccessToken: "fake"}),
+			WithDatabase(filepath.Join(t.TempDir(), "sync.db")),
+		}, "project"},
+		{"token", []Option{WithYouTrack("http://youtrack.example.com", "")}, "token"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts...); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("New() error = %v, want one about %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_Sync(t *testing.T) {
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Write report", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+
+	var configured bool
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	engine, err := New(
+		WithYouTrack(ytServer.URL, "token"),
+		WithGoogle(ctx, &oauth2.Config{}, &oauth2.Token{AccessToken: "fake"}),
+		WithDatabase(filepath.Join(t.TempDir(), "sync.db")),
+		WithProject("PRJ"),
+		WithSynchronizer(func(s *sync.Synchronizer) { configured = s.CalendarID == DefaultCalendarID }),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer engine.Close()
+	if !configured {
+		t.Error("Expected WithSynchronizer to see the default calendar")
+	}
+
+	result, err := engine.Sync()
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Counts.EventsCreated != 1 {
+		t.Errorf("Expected an event to be created, got %+v", result.Counts)
+	}
+	if events := gcalServer.Events(DefaultCalendarID); len(events) != 1 || events[0].Summary != "Write report" {
+		t.Errorf("Expected the issue to get an event, got %d events", len(events))
+	}
+}
+
+func TestEngine_RunStopsWithContext(t *testing.T) {
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	engine, err := New(
+		WithYouTrack(ytServer.URL, "token"),
+		WithGoogle(ctx, &oauth2.Config{}, &oauth2.Token{AccessToken: "fake"}),
+		WithDatabase(filepath.Join(t.TempDir(), "sync.db")),
+		WithProject("PRJ"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer engine.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := engine.Run(ctx, 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("Run() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"youtrack-calendar-sync/config"
+	"youtrack-calendar-sync/sync"
+	"youtrack-calendar-sync/webhook"
+)
+
+// startPushChannels keeps a Google push channel open for every mapping,
+// serving their notifications on mux, and stops the channels when the
+// process is interrupted or terminated.
+func startPushChannels(cfg *config.Config, mappings []*mapping, mux *http.ServeMux) {
+	address, err := webhook.URL(cfg.GooglePushURL, webhook.GooglePath)
+	if err != nil {
+		log.Fatalf("Error loading configuration: GOOGLE_PUSH_URL: %v", err)
+	}
+	handler := &webhook.GoogleHandler{}
+	for _, m := range mappings {
+		m.synchronizer.PushNotifications = &sync.PushNotifications{
+			Address:     address,
+			TTL:         cfg.GooglePushTTL,
+			RenewBefore: cfg.GooglePushRenewBefore,
+		}
+		handler.Syncers = append(handler.Syncers, m.synchronizer)
+		go m.synchronizer.StartPushChannelLoop()
+	}
+	mux.Handle(webhook.GooglePath, handler)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, stopping the push channels", sig)
+		for _, m := range mappings {
+			m.synchronizer.Stop()
+			if err := m.synchronizer.StopPushChannel(); err != nil {
+				log.Printf("Error stopping the push channel of mapping %s: %v", m.label(), err)
+			}
+		}
+		os.Exit(exitOK)
+	}()
+}
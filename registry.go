@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	gosync "sync"
+
+	"golang.org/x/oauth2"
+
+	"youtrack-calendar-sync/admin"
+	"youtrack-calendar-sync/config"
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/schedule"
+	"youtrack-calendar-sync/sync"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// registry opens the mappings of the configuration and those registered
+// through the admin API, sharing one Google client per account and one
+// YouTrack client per tenant. It implements admin.Registry.
+type registry struct {
+	cfg          *config.Config
+	ctx          context.Context
+	gcalConfig   *oauth2.Config
+	ytHTTPClient *http.Client
+	dataDir      string
+	dataSource   string
+	// tokenDB holds the Google tokens with remote state, see googleToken.
+	tokenDB *sync.DB
+	// store keeps the tenants and mappings registered at runtime.
+	store *sync.DB
+	// server, if set, is told about started and stopped mappings.
+	server *admin.Server
+
+	mu          gosync.Mutex
+	gcalClients map[string]*googlecalendar.Client
+	ytClients   map[string]*youtrack.Client
+	tenants     []config.Tenant
+	definitions []config.Mapping
+	// stored marks the tenants and mappings registered at runtime, which
+	// are the only ones that can be changed.
+	storedTenants  map[string]bool
+	storedMappings map[string]bool
+	// running lists the mappings whose sync loop is started.
+	running []*mapping
+	loops   gosync.WaitGroup
+}
+
+// load adds the configured and stored tenants and mappings.
+func (r *registry) load() error {
+	r.gcalClients = make(map[string]*googlecalendar.Client)
+	r.ytClients = make(map[string]*youtrack.Client)
+	r.storedTenants = make(map[string]bool)
+	r.storedMappings = make(map[string]bool)
+	r.tenants = append(r.tenants, r.cfg.Tenants...)
+	r.definitions = append(r.definitions, r.cfg.Mappings...)
+
+	tenants, err := r.store.GetStoredTenants()
+	if err != nil {
+		return fmt.Errorf("failed to load stored tenants: %w", err)
+	}
+	for _, definition := range tenants {
+		var t config.Tenant
+		if err := json.Unmarshal([]byte(definition), &t); err != nil {
+			return fmt.Errorf("failed to load stored tenant: %w", err)
+		}
+		r.tenants = append(r.tenants, t)
+		r.storedTenants[t.Name] = true
+	}
+	mappings, err := r.store.GetStoredMappings()
+	if err != nil {
+		return fmt.Errorf("failed to load stored mappings: %w", err)
+	}
+	for _, definition := range mappings {
+		var m config.Mapping
+		if err := json.Unmarshal([]byte(definition), &m); err != nil {
+			return fmt.Errorf("failed to load stored mapping: %w", err)
+		}
+		r.cfg.ApplyMappingDefaults(&m)
+		r.definitions = append(r.definitions, m)
+		r.storedMappings[m.Name] = true
+	}
+	return nil
+}
+
+// open creates the synchronizer of mc and opens its state. A missing Google
+// token is obtained interactively for configured mappings; mappings
+// registered at runtime, and those of tenants when the admin API is
+// served, wait until their account is connected through the admin API.
+func (r *registry) open(mc config.Mapping) (*mapping, error) {
+	m := &mapping{Mapping: mc}
+	interactive := !r.storedMappings[mc.Name] && (mc.Tenant == "" || r.cfg.AdminAddr == "")
+	gcalClient, err := r.googleClient(mc.GoogleAccount, interactive)
+	if err != nil {
+		return nil, err
+	}
+	ytClient, err := r.youTrackClient(mc.Tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.db, err = sync.NewMappingDB(r.dataSource, mc.Name); err != nil {
+		return nil, fmt.Errorf("failed to initialize database of mapping %s: %w", m.label(), err)
+	}
+	// A nil *googlecalendar.Client must not become a non-nil GCalClient.
+	var client sync.GCalClient
+	if gcalClient != nil {
+		client = gcalClient
+	}
+	if m.synchronizer, err = newSynchronizer(r.cfg, mc, client, ytClient, m.db); err != nil {
+		m.db.Close()
+		return nil, err
+	}
+	if expr := scheduleOf(r.cfg, mc); expr != "" {
+		if m.schedule, err = schedule.Parse(expr); err != nil {
+			m.db.Close()
+			return nil, fmt.Errorf("schedule of mapping %s: %w", m.label(), err)
+		}
+	}
+	if gcalClient == nil {
+		log.Printf("Connect the Google account of mapping %s by opening %s on the admin API", m.label(), admin.ConnectPath)
+		m.synchronizer.AwaitAuthorization(fmt.Errorf("google account %q is not authorized yet", mc.GoogleAccount))
+	}
+	m.synchronizer.OnReauthRequired = func(error) {
+		if r.cfg.AdminAddr != "" {
+			log.Printf("Re-authorize Google account of mapping %s by opening %s on the admin API", m.label(), admin.ReauthURL(mc.GoogleAccount))
+		} else {
+			log.Printf("Re-authorize Google account of mapping %s by removing its stored token and restarting", m.label())
+		}
+	}
+	return m, nil
+}
+
+// googleClient returns the client of account, or nil when it has no token
+// and interactive is false.
+func (r *registry) googleClient(account string, interactive bool) (*googlecalendar.Client, error) {
+	if client, ok := r.gcalClients[account]; ok {
+		return client, nil
+	}
+	tokenFile := filepath.Join(r.dataDir, config.AccountTokenFile(account))
+	var token *oauth2.Token
+	var err error
+	if interactive {
+		token, err = googleToken(r.ctx, r.gcalConfig, r.cfg, account, r.tokenDB, tokenFile)
+	} else {
+		token, err = storedGoogleToken(r.cfg, account, r.tokenDB, tokenFile)
+	}
+	if err != nil || token == nil {
+		return nil, err
+	}
+	client, err := googlecalendar.NewClientFromTokenSource(r.ctx, r.tokenSource(account, token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Calendar client: %w", err)
+	}
+	r.gcalClients[account] = client
+	return client, nil
+}
+
+// tokenSource refreshes token of account, saving refreshed tokens where they
+// are looked up on the next start. Tokens from the environment are not
+// saved, as they would be looked up there.
+func (r *registry) tokenSource(account string, token *oauth2.Token) oauth2.TokenSource {
+	if _, ok := r.cfg.GoogleTokens[account]; ok || r.cfg.HTTPReplayDir != "" {
+		return r.gcalConfig.TokenSource(r.ctx, token)
+	}
+	tokenFile := filepath.Join(r.dataDir, config.AccountTokenFile(account))
+	return googlecalendar.SavingTokenSource(r.ctx, r.gcalConfig, token, func(refreshed *oauth2.Token) {
+		if err := saveGoogleToken(account, r.tokenDB, tokenFile, refreshed); err != nil {
+			log.Printf("WARNING: Refreshed Google token of account %q not saved: %v", account, err)
+		}
+	})
+}
+
+// youTrackClient returns the client of tenant.
+func (r *registry) youTrackClient(tenant string) (*youtrack.Client, error) {
+	if client, ok := r.ytClients[tenant]; ok {
+		return client, nil
+	}
+	token := r.cfg.YouTrackPermanentToken
+	if tenant != "" {
+		t := r.tenant(tenant)
+		if t == nil {
+			return nil, fmt.Errorf("%w: unknown tenant %q", admin.ErrInvalid, tenant)
+		}
+		token = t.YouTrackToken
+	}
+	client := youtrack.NewClient(r.cfg.YouTrackBaseURL, token)
+	client.HTTPClient = r.ytHTTPClient
+	client.IssueFields = r.cfg.YouTrackIssueFields
+	client.PageSize = r.cfg.YouTrackPageSize
+	r.ytClients[tenant] = client
+	return client, nil
+}
+
+func (r *registry) tenant(name string) *config.Tenant {
+	for i := range r.tenants {
+		if r.tenants[i].Name == name {
+			return &r.tenants[i]
+		}
+	}
+	return nil
+}
+
+// run starts the sync loop of m.
+func (r *registry) run(m *mapping) {
+	r.mu.Lock()
+	r.running = append(r.running, m)
+	r.mu.Unlock()
+	r.loops.Add(1)
+	go func() {
+		defer r.loops.Done()
+		runLoop(m)
+	}()
+}
+
+// wait blocks until every sync loop ended and, with the admin API, forever,
+// as mappings may still be registered.
+func (r *registry) wait() {
+	r.loops.Wait()
+	if r.server != nil {
+		select {}
+	}
+}
+
+// runningMappings returns the mappings whose sync loop is started.
+func (r *registry) runningMappings() []*mapping {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*mapping(nil), r.running...)
+}
+
+// start runs a mapping opened at runtime, after those of its tenant learned
+// about it.
+func (r *registry) start(m *mapping) {
+	r.running = append(r.running, m)
+	linkSiblings(r.running)
+	r.loops.Add(1)
+	go func() {
+		defer r.loops.Done()
+		runLoop(m)
+	}()
+	if r.server != nil {
+		r.server.AddMapping(admin.Mapping{Name: m.label(), Account: m.GoogleAccount, Tenant: m.Tenant, Syncer: m.synchronizer})
+	}
+}
+
+// stop ends the sync loop of the running mapping called name, if any, and
+// closes its state.
+func (r *registry) stop(name string) {
+	for i, m := range r.running {
+		if m.Name != name {
+			continue
+		}
+		if r.server != nil {
+			r.server.RemoveMapping(m.label())
+		}
+		m.synchronizer.Stop()
+		if m.synchronizer.PushNotifications != nil {
+			if err := m.synchronizer.StopPushChannel(); err != nil {
+				log.Printf("Error stopping the push channel of mapping %s: %v", m.label(), err)
+			}
+		}
+		m.db.Close()
+		r.running = append(r.running[:i:i], r.running[i+1:]...)
+		linkSiblings(r.running)
+		return
+	}
+}
+
+// authorized switches the mappings of account to a client with token.
+func (r *registry) authorized(account string, token *oauth2.Token) error {
+	tokenFile := filepath.Join(r.dataDir, config.AccountTokenFile(account))
+	if err := saveGoogleToken(account, r.tokenDB, tokenFile, token); err != nil {
+		return err
+	}
+	if _, ok := r.cfg.GoogleTokens[account]; ok {
+		log.Printf("Update %s, which still holds the revoked token", config.AccountTokenEnv(account))
+	}
+	client, err := googlecalendar.NewClientFromTokenSource(r.ctx, r.tokenSource(account, token))
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gcalClients[account] = client
+	for _, m := range r.running {
+		if m.GoogleAccount == account {
+			m.synchronizer.Reauthorized(client)
+		}
+	}
+	return nil
+}
+
+// Mappings implements admin.Registry.
+func (r *registry) Mappings() []config.Mapping {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]config.Mapping(nil), r.definitions...)
+}
+
+// CreateMapping implements admin.Registry.
+func (r *registry) CreateMapping(mc config.Mapping) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.definitions {
+		if d.Name == mc.Name {
+			return fmt.Errorf("%w: mapping %q exists", admin.ErrConflict, mc.Name)
+		}
+	}
+	return r.save(mc, len(r.definitions))
+}
+
+// UpdateMapping implements admin.Registry.
+func (r *registry) UpdateMapping(mc config.Mapping) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, d := range r.definitions {
+		if d.Name != mc.Name {
+			continue
+		}
+		if !r.storedMappings[mc.Name] {
+			return fmt.Errorf("%w: mapping %q is defined in the configuration", admin.ErrConflict, mc.Name)
+		}
+		return r.save(mc, i)
+	}
+	return fmt.Errorf("%w: mapping %q", admin.ErrNotFound, mc.Name)
+}
+
+// save opens, stores and starts mc as the i-th definition, replacing the
+// running mapping of the same name once the new one is ready. mc is stored
+// as given, so that it follows changes to the global settings it leaves
+// unset.
+func (r *registry) save(mc config.Mapping, i int) error {
+	definition, err := json.Marshal(mc)
+	if err != nil {
+		return err
+	}
+	r.cfg.ApplyMappingDefaults(&mc)
+	r.storedMappings[mc.Name] = true
+	m, err := r.open(mc)
+	if err == nil && !mc.Disabled {
+		if err = m.synchronizer.ValidateFields(); errors.Is(err, sync.ErrSchemaMismatch) {
+			m.db.Close()
+			err = fmt.Errorf("%w: %v", admin.ErrInvalid, err)
+		} else if err != nil {
+			log.Printf("WARNING: could not validate YouTrack fields of mapping %s: %v", m.label(), err)
+			err = nil
+		}
+	} else if err == nil {
+		m.db.Close()
+	}
+	if err != nil {
+		if i == len(r.definitions) {
+			delete(r.storedMappings, mc.Name)
+		}
+		return err
+	}
+
+	if err := r.store.SetStoredMapping(mc.Name, string(definition)); err != nil {
+		if !mc.Disabled {
+			m.db.Close()
+		}
+		return fmt.Errorf("failed to store mapping: %w", err)
+	}
+	if i == len(r.definitions) {
+		r.definitions = append(r.definitions, mc)
+	} else {
+		r.definitions[i] = mc
+	}
+	r.stop(mc.Name)
+	if !mc.Disabled {
+		r.start(m)
+	}
+	log.Printf("Registered mapping %s", m.label())
+	return nil
+}
+
+// DeleteMapping implements admin.Registry.
+func (r *registry) DeleteMapping(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, d := range r.definitions {
+		if d.Name != name {
+			continue
+		}
+		if !r.storedMappings[name] {
+			return fmt.Errorf("%w: mapping %q is defined in the configuration", admin.ErrConflict, name)
+		}
+		if _, err := r.store.DeleteStoredMapping(name); err != nil {
+			return fmt.Errorf("failed to delete stored mapping: %w", err)
+		}
+		r.stop(name)
+		r.definitions = append(r.definitions[:i:i], r.definitions[i+1:]...)
+		delete(r.storedMappings, name)
+		log.Printf("Removed mapping %s", name)
+		return nil
+	}
+	return fmt.Errorf("%w: mapping %q", admin.ErrNotFound, name)
+}
+
+// Tenants implements admin.Registry.
+func (r *registry) Tenants() []config.Tenant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]config.Tenant(nil), r.tenants...)
+}
+
+// CreateTenant implements admin.Registry.
+func (r *registry) CreateTenant(t config.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.tenants {
+		if other.Name == t.Name {
+			return fmt.Errorf("%w: tenant %q exists", admin.ErrConflict, t.Name)
+		}
+		if t.AdminToken != "" && other.AdminToken == t.AdminToken {
+			return fmt.Errorf("%w: admin_token is used by another tenant", admin.ErrConflict)
+		}
+	}
+	definition, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := r.store.SetStoredTenant(t.Name, string(definition)); err != nil {
+		return fmt.Errorf("failed to store tenant: %w", err)
+	}
+	r.tenants = append(r.tenants, t)
+	r.storedTenants[t.Name] = true
+	log.Printf("Registered tenant %s", t.Name)
+	return nil
+}
+
+// DeleteTenant implements admin.Registry.
+func (r *registry) DeleteTenant(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, t := range r.tenants {
+		if t.Name != name {
+			continue
+		}
+		if !r.storedTenants[name] {
+			return fmt.Errorf("%w: tenant %q is defined in the configuration", admin.ErrConflict, name)
+		}
+		for _, d := range r.definitions {
+			if d.Tenant == name {
+				return fmt.Errorf("%w: tenant %q still has mapping %q", admin.ErrConflict, name, d.Name)
+			}
+		}
+		if _, err := r.store.DeleteStoredTenant(name); err != nil {
+			return fmt.Errorf("failed to delete stored tenant: %w", err)
+		}
+		r.tenants = append(r.tenants[:i:i], r.tenants[i+1:]...)
+		delete(r.storedTenants, name)
+		delete(r.ytClients, name)
+		log.Printf("Removed tenant %s", name)
+		return nil
+	}
+	return fmt.Errorf("%w: tenant %q", admin.ErrNotFound, name)
+}
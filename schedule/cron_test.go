@@ -0,0 +1,39 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	from := time.Date(2026, 10, 16, 19, 50, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 7-19 * * MON-FRI", time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2026, 10, 16, 19, 51, 0, 0, time.UTC)},
+		{"0 9 1 * *", time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)},
+		{"30 8 * * 7", time.Date(2026, 10, 18, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"5,55 19 * * *", time.Date(2026, 10, 16, 19, 55, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		c, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.expr, err)
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next() = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * FOO *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"youtrack-calendar-sync/googlecalendar"
+)
+
+// Grant gives every share its role on the synced calendar, changing the
+// role of users and groups that already have access. It stops at the first
+// failure.
+func (s *Synchronizer) Grant(shares []CalendarShare) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.requireAuth(); err != nil {
+		return err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return err
+	}
+	for _, share := range shares {
+		log.Printf("Granting %s %s access to calendar %s\n", share.Email, share.Role, s.CalendarID)
+		if err := s.calendar().ShareCalendar(s.CalendarID, share.scopeType(), share.Email, share.Role); err != nil {
+			return fmt.Errorf("failed to grant %s access: %w", share.Email, err)
+		}
+	}
+	return nil
+}
+
+// Revoke removes the access of the users and groups of shares, whose roles
+// are ignored, to the synced calendar. It returns those that had no access.
+func (s *Synchronizer) Revoke(shares []CalendarShare) ([]CalendarShare, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.requireAuth(); err != nil {
+		return nil, err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return nil, err
+	}
+	var missing []CalendarShare
+	for _, share := range shares {
+		log.Printf("Revoking the access of %s to calendar %s\n", share.Email, s.CalendarID)
+		err := s.calendar().UnshareCalendar(s.CalendarID, share.scopeType(), share.Email)
+		if errors.Is(err, googlecalendar.ErrNotFound) {
+			missing = append(missing, share)
+		} else if err != nil {
+			return missing, fmt.Errorf("failed to revoke the access of %s: %w", share.Email, err)
+		}
+	}
+	return missing, nil
+}
+
+// Access lists the users and groups with access to the synced calendar.
+// Access granted to domains or the public is left out.
+func (s *Synchronizer) Access() ([]CalendarShare, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.requireAuth(); err != nil {
+		return nil, err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return nil, err
+	}
+	rules, err := s.calendar().CalendarACL(s.CalendarID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access to calendar %s: %w", s.CalendarID, err)
+	}
+	var shares []CalendarShare
+	for _, rule := range rules {
+		if rule.Scope == nil || rule.Scope.Type != "user" && rule.Scope.Type != "group" {
+			continue
+		}
+		shares = append(shares, CalendarShare{Email: rule.Scope.Value, Group: rule.Scope.Type == "group", Role: rule.Role})
+	}
+	return shares, nil
+}
@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/notify"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// MorningAgenda sends the synced issues due each day through Sink, with
+// the first pass after At.
+type MorningAgenda struct {
+	// At is the time of day after which the agenda is sent.
+	At time.Duration
+	// Location is the time zone of At and of the day; nil means the local
+	// time zone.
+	Location *time.Location
+	Sink     notify.Sink
+}
+
+// DefaultAgendaTime is the default of MorningAgenda.At.
+const DefaultAgendaTime = 8 * time.Hour
+
+// morningAgenda names the entry recording the last day the agenda was sent,
+// kept with the digest events.
+const morningAgenda = "morning-agenda"
+
+// sendMorningAgenda sends the agenda of today unless it was sent already
+// or it is not yet time. Days without synced issues due are skipped.
+func (s *Synchronizer) sendMorningAgenda() error {
+	loc := s.MorningAgenda.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	now := s.now().In(loc)
+	year, month, day := now.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	if now.Before(midnight.Add(s.MorningAgenda.At)) {
+		return nil
+	}
+	today := midnight.Format("2006-01-02")
+	sent, err := s.DB.GetDigestEvent(morningAgenda)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if sent.Digest == today {
+		return nil
+	}
+
+	query, err := s.IssueQuery()
+	if err != nil {
+		return err
+	}
+	issues, err := s.YouTrackClient.GetDueIssues(query, midnight, midnight.AddDate(0, 0, 1))
+	if err != nil {
+		return fmt.Errorf("failed to fetch today's YouTrack issues: %w", err)
+	}
+	var due []youtrack.Issue
+	for _, issue := range issues {
+		if issue.IsResolved() || rollupDay(issueDueDate(issue).In(loc)) != today {
+			continue
+		}
+		if _, err := s.DB.GetSyncItemByYTID(issue.ID); errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		due = append(due, issue)
+	}
+
+	if len(due) > 0 {
+		title, body := s.agendaContent(midnight, due)
+		log.Printf("Sending the morning agenda: %s\n", title)
+		if err := s.MorningAgenda.Sink.Notify(title, body); err != nil {
+			return err
+		}
+	}
+	sent.Digest = today
+	return s.DB.SaveDigestEvent(sent)
+}
+
+// agendaContent returns the title and plain text body of the agenda of the
+// given day listing the issues due.
+func (s *Synchronizer) agendaContent(day time.Time, due []youtrack.Issue) (string, string) {
+	sort.Slice(due, func(i, j int) bool {
+		if a, b := issueDueDate(due[i]), issueDueDate(due[j]); !a.Equal(b) {
+			return a.Before(b)
+		}
+		return due[i].ReadableID() < due[j].ReadableID()
+	})
+	lines := make([]string, 0, len(due))
+	for _, issue := range due {
+		id := issue.ReadableID()
+		line := fmt.Sprintf("%s %s", id, issue.Summary)
+		if dueDate := issueDueDate(issue).In(day.Location()); !isMidnight(dueDate) {
+			line = dueDate.Format("15:04") + " " + line
+		}
+		lines = append(lines, fmt.Sprintf("%s\n  %s/issue/%s", line, s.YouTrackClient.GetBaseURL(), id))
+	}
+	noun := "issues"
+	if len(due) == 1 {
+		noun = "issue"
+	}
+	return fmt.Sprintf("Due today, %s: %d %s", day.Format("Monday, January 2"), len(due), noun), strings.Join(lines, "\n")
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scope is a permission of an API token.
+type Scope string
+
+// Scopes of API tokens.
+const (
+	// ScopeReadStatus reads the status and registered mappings.
+	ScopeReadStatus Scope = "read-status"
+	// ScopeTriggerSync starts, pauses and resumes synchronization, and
+	// delivers webhooks.
+	ScopeTriggerSync Scope = "trigger-sync"
+	// ScopeManageMappings changes mappings and authorizes Google accounts.
+	ScopeManageMappings Scope = "manage-mappings"
+	// ScopeManageTenants lists, creates and deletes tenants.
+	ScopeManageTenants Scope = "manage-tenants"
+)
+
+var allScopes = []Scope{ScopeReadStatus, ScopeTriggerSync, ScopeManageMappings, ScopeManageTenants}
+
+// ParseScopes parses a comma-separated list of scopes.
+func ParseScopes(value string) ([]Scope, error) {
+	var scopes []Scope
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, scope := range allScopes {
+			if Scope(name) == scope {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown scope %q, expected %s, %s, %s or %s", name, ScopeReadStatus, ScopeTriggerSync, ScopeManageMappings, ScopeManageTenants)
+		}
+		scopes = append(scopes, Scope(name))
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("no scopes given")
+	}
+	return scopes, nil
+}
+
+// hashAPIToken returns the stored form of token. Tokens are random, so an
+// unsalted hash suffices to keep them out of the database.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a random API token called name with scopes and
+// returns it. Only its hash is stored, so it cannot be shown again.
+func (db *DB) CreateAPIToken(name string, scopes []Scope) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	query := "INSERT INTO api_tokens (name, token_hash, scopes, created_at) VALUES (?, ?, ?, ?)"
+	if _, err := db.exec(query, name, hashAPIToken(token), strings.Join(names, ","), db.now()); err != nil {
+		return "", fmt.Errorf("failed to store API token %s: %w", name, err)
+	}
+	return token, nil
+}
+
+// APITokenHasScope reports whether token is a stored API token with scope.
+func (db *DB) APITokenHasScope(token string, scope Scope) (bool, error) {
+	var scopes string
+	err := db.get("SELECT scopes FROM api_tokens WHERE token_hash = ?", []interface{}{hashAPIToken(token)}, &scopes)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up API token: %w", err)
+	}
+	for _, name := range strings.Split(scopes, ",") {
+		if Scope(name) == scope {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteAPIToken revokes the API token called name and reports whether it
+// existed.
+func (db *DB) DeleteAPIToken(name string) (bool, error) {
+	result, err := db.exec("DELETE FROM api_tokens WHERE name = ?", name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API token %s: %w", name, err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// CopySQLite copies the SQLite database file src into dst with the online
+// backup API, so the copy is consistent even while src is written to, and
+// dst is replaced page by page rather than by a file copy that could mix
+// with its journal.
+func CopySQLite(dst, src string) error {
+	ctx := context.Background()
+	srcDB, err := sql.Open("sqlite3", src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer srcDB.Close()
+	dstDB, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dst, err)
+	}
+	defer dstDB.Close()
+
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer srcConn.Close()
+	dstConn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dst, err)
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			backup, err := dstRaw.(*sqlite3.SQLiteConn).Backup("main", srcRaw.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup of %s: %w", src, err)
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to back up %s: %w", src, err)
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// CheckSQLite runs SQLite's integrity check on the database file at path.
+func CheckSQLite(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s is corrupt: %s", path, result)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"youtrack-calendar-sync/googlecalendar"
+)
+
+// CalendarSetup creates a dedicated calendar when the configured calendar
+// does not exist, so that it need not be created by hand and its ID looked
+// up. The created calendar is remembered and used from then on.
+type CalendarSetup struct {
+	// Name is the name of the created calendar.
+	Name string
+	// Shares lists the users the created calendar is shared with.
+	Shares []CalendarShare
+}
+
+// CalendarShare gives a user, or a Google Group, a role on a calendar.
+type CalendarShare struct {
+	Email string
+	// Group marks Email as the address of a Google Group.
+	Group bool
+	// Role is freeBusyReader, reader, writer or owner.
+	Role string
+}
+
+// calendarRoles are the roles a calendar can be shared with.
+var calendarRoles = []string{"freeBusyReader", "reader", "writer", "owner"}
+
+// groupPrefix marks the address of a Google Group in calendar shares.
+const groupPrefix = "group:"
+
+// ParseCalendarShares parses entries such as "alice@example.com",
+// "bob@example.com=writer" or "group:team@example.com=writer"; entries
+// without a role are readers.
+func ParseCalendarShares(entries []string) ([]CalendarShare, error) {
+	var shares []CalendarShare
+	for _, entry := range entries {
+		address, role, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		share := CalendarShare{Email: strings.TrimSpace(address), Role: "reader"}
+		if rest, group := strings.CutPrefix(share.Email, groupPrefix); group {
+			share.Email, share.Group = rest, true
+		}
+		if !strings.Contains(share.Email, "@") {
+			return nil, fmt.Errorf("invalid calendar share %q, expected an email address", entry)
+		}
+		if ok {
+			share.Role = ""
+			for _, known := range calendarRoles {
+				if strings.EqualFold(known, strings.TrimSpace(role)) {
+					share.Role = known
+				}
+			}
+			if share.Role == "" {
+				return nil, fmt.Errorf("invalid role %q for %s, expected one of %s", role, share.Email, strings.Join(calendarRoles, ", "))
+			}
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// String formats share as parsed by ParseCalendarShares.
+func (share CalendarShare) String() string {
+	s := share.Email + "=" + share.Role
+	if share.Group {
+		s = groupPrefix + s
+	}
+	return s
+}
+
+// scopeType returns the scope type of the access rule of share.
+func (share CalendarShare) scopeType() string {
+	if share.Group {
+		return "group"
+	}
+	return "user"
+}
+
+// ensureCalendar switches CalendarID to the calendar created in its place,
+// creating that calendar if neither exists. It looks once per process.
+func (s *Synchronizer) ensureCalendar() error {
+	if s.CalendarSetup == nil || s.calendarChecked {
+		return nil
+	}
+	configured := s.CalendarID
+	id, err := s.DB.GetCreatedCalendar(configured)
+	if errors.Is(err, ErrNotFound) {
+		id = configured
+	} else if err != nil {
+		return err
+	}
+	_, err = s.calendar().GetCalendar(id)
+	switch {
+	case errors.Is(err, googlecalendar.ErrNotFound):
+		if id, err = s.createCalendar(configured); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("failed to look up calendar %s: %w", id, err)
+	}
+	s.CalendarID, s.calendarChecked = id, true
+	return nil
+}
+
+// createCalendar creates and shares the calendar used in place of the
+// missing calendar configured, and returns its ID.
+func (s *Synchronizer) createCalendar(configured string) (string, error) {
+	log.Printf("Calendar %s not found; creating calendar %q\n", configured, s.CalendarSetup.Name)
+	cal, err := s.calendar().CreateCalendar(s.CalendarSetup.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create calendar %q: %w", s.CalendarSetup.Name, err)
+	}
+	if err := s.DB.SaveCreatedCalendar(configured, cal.Id); err != nil {
+		return "", err
+	}
+	for _, share := range s.CalendarSetup.Shares {
+		log.Printf("Sharing calendar %s with %s as %s\n", cal.Id, share.Email, share.Role)
+		if err := s.calendar().ShareCalendar(cal.Id, share.scopeType(), share.Email, share.Role); err != nil {
+			s.logError("Error sharing calendar %s with %s: %v\n", cal.Id, share.Email, err)
+		}
+	}
+	return cal.Id, nil
+}
@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"log"
+	"time"
+)
+
+// Clock tells the time to the synchronizer and its database, so that tests
+// can control it.
+type Clock interface {
+	// Now returns the current wall clock time.
+	Now() time.Time
+	// After sends the current time on the returned channel once d has
+	// passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// wallClockPoll is how often the sync loops compare the wall clock with the
+// time of their next pass. Their timers do not advance while the computer
+// sleeps, so without it a pass due during a sleep would only run once the
+// full wait had passed after waking up.
+const wallClockPoll = time.Minute
+
+func (s *Synchronizer) clock() Clock {
+	if s.Clock == nil {
+		return SystemClock
+	}
+	return s.Clock
+}
+
+// now returns the current time of Clock.
+func (s *Synchronizer) now() time.Time {
+	return s.clock().Now()
+}
+
+// jumpTolerance is how much further than a wait the wall clock may move
+// before the difference is taken as a sleep of the computer.
+const jumpTolerance = time.Minute
+
+// cursorOverlap is how much earlier than the newest update seen so far a
+// pass asks YouTrack for changes, to catch updates that YouTrack indexed
+// after that one although they happened before. Issues seen again are
+// skipped as unchanged by their update time.
+const cursorOverlap = 5 * time.Minute
+
+// catchUpOverlap replaces cursorOverlap for the first pass after a sleep,
+// as YouTrack may have been adjusted or restarted meanwhile.
+const catchUpOverlap = time.Hour
+
+// waitUntil returns at t by the wall clock, or false once Stop is called.
+// A wall clock that moves further than waited, as it does while the
+// computer sleeps, makes the next pass catch up, see catchUpOverlap.
+func (s *Synchronizer) waitUntil(t time.Time) bool {
+	for {
+		now := wall(s.now())
+		wait := wall(t).Sub(now)
+		if wait <= 0 {
+			return true
+		}
+		wait = min(wait, wallClockPoll)
+		select {
+		case <-s.clock().After(wait):
+		case <-s.stop:
+			return false
+		}
+		if jump := wall(s.now()).Sub(now) - wait; jump > jumpTolerance {
+			log.Printf("The clock moved %s further than expected, the computer presumably slept\n", jump.Round(time.Second))
+			s.catchingUp.Store(true)
+		}
+	}
+}
+
+// wall strips the monotonic clock reading of t, which stands still while
+// the computer sleeps, so that durations between times are measured by the
+// wall clock.
+func wall(t time.Time) time.Time {
+	return t.Round(0)
+}
+
+// catchUp logs the passes of schedule that were missed after due, e.g.
+// while the computer was asleep. A single pass makes up for all of them, as
+// every pass syncs all changes since the last one.
+func (s *Synchronizer) catchUp(schedule Schedule, due time.Time) {
+	if missed := missedActivations(schedule, wall(due), wall(s.now())); missed > 0 {
+		log.Printf("Missed %d scheduled synchronizations since %s, catching up\n", missed, due.Format(time.RFC3339))
+		s.catchingUp.Store(true)
+	}
+}
+
+// missedActivations counts the activations of schedule after due up to and
+// including now.
+func missedActivations(schedule Schedule, due, now time.Time) int {
+	if interval, ok := schedule.(every); ok {
+		// Short intervals would take long to count one by one.
+		return int(now.Sub(due) / time.Duration(interval))
+	}
+	missed := 0
+	for next := schedule.Next(due); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		missed++
+	}
+	return missed
+}
+
+// every is a Schedule activating an interval after the time it is asked
+// about.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// now returns the current time of the clock of db.
+func (db *DB) now() time.Time {
+	if db.clock == nil {
+		return time.Now()
+	}
+	return db.clock.Now()
+}
+
+// WithClock returns a copy of db that takes the times it records from clock.
+// The copy shares the connection and lock of db.
+func (db *DB) WithClock(clock Clock) *DB {
+	c := *db
+	c.clock = clock
+	return &c
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ConflictCheck determines what happens when the event of an issue lands on
+// a day that is booked with meetings.
+type ConflictCheck string
+
+const (
+	// ConflictCheckOff does not look at other events.
+	ConflictCheckOff ConflictCheck = "off"
+	// ConflictCheckWarn logs a warning.
+	ConflictCheckWarn ConflictCheck = "warn"
+	// ConflictCheckComment logs a warning and comments on the issue.
+	ConflictCheckComment ConflictCheck = "comment"
+)
+
+// ParseConflictCheck parses a ConflictCheck. An empty value yields
+// ConflictCheckOff.
+func ParseConflictCheck(value string) (ConflictCheck, error) {
+	switch check := ConflictCheck(strings.ToLower(strings.TrimSpace(value))); check {
+	case "":
+		return ConflictCheckOff, nil
+	case ConflictCheckOff, ConflictCheckWarn, ConflictCheckComment:
+		return check, nil
+	default:
+		return "", fmt.Errorf("unknown conflict check %q", value)
+	}
+}
+
+// checkConflicts reports the meetings on the day of the event just written
+// for the issue of item from draft. Meetings are the timed events that block
+// time and were not declined, other than the event itself and work blocks.
+// Conflicts are reported once; item records them until the day or the
+// number of meetings changes.
+func (s *Synchronizer) checkConflicts(item *SyncItem, draft *EventDraft) error {
+	if s.ConflictCheck == "" || s.ConflictCheck == ConflictCheckOff {
+		return nil
+	}
+	year, month, day := draft.Start.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	events, err := s.calendar().ListEvents(s.CalendarID, midnight, midnight.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+
+	meetings := 0
+	for _, event := range events {
+		if event.ID == item.GCalID.String || event.Status == "cancelled" || event.AllDay ||
+			event.Transparency == "transparent" || event.ResponseStatus == "declined" || s.isWorkBlock(event) {
+			continue
+		}
+		meetings++
+	}
+	if meetings == 0 {
+		item.ConflictWarning = sql.NullString{}
+		return nil
+	}
+	warning := fmt.Sprintf("%s %d", midnight.Format("2006-01-02"), meetings)
+	if item.ConflictWarning.Valid && item.ConflictWarning.String == warning {
+		return nil
+	}
+
+	noun := "meetings"
+	if meetings == 1 {
+		noun = "meeting"
+	}
+	message := fmt.Sprintf("Due date overlaps with %d %s that day", meetings, noun)
+	log.Printf("WARNING: YouTrack task %s: %s (%s)\n", item.YTID.String, message, midnight.Format("2006-01-02"))
+	if s.ConflictCheck == ConflictCheckComment {
+		if err := s.youtrack().AddComment(item.YTID.String, message+"."); err != nil {
+			return fmt.Errorf("failed to comment on meeting conflict: %w", err)
+		}
+	}
+	item.ConflictWarning = sql.NullString{String: warning, Valid: true}
+	return nil
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+)
+
+// EventCopies determines what happens to copies of synced events, such as
+// those made with "Duplicate" in Google Calendar.
+type EventCopies string
+
+const (
+	// EventCopiesSkip leaves copies alone.
+	EventCopiesSkip EventCopies = "skip"
+	// EventCopiesCreate creates an issue for each copy like for any new
+	// event.
+	EventCopiesCreate EventCopies = "create"
+)
+
+// ParseEventCopies parses an EventCopies. An empty value yields
+// EventCopiesSkip.
+func ParseEventCopies(value string) (EventCopies, error) {
+	switch copies := EventCopies(strings.ToLower(strings.TrimSpace(value))); copies {
+	case "":
+		return EventCopiesSkip, nil
+	case EventCopiesSkip, EventCopiesCreate:
+		return copies, nil
+	default:
+		return "", fmt.Errorf("unknown event copies setting %q", value)
+	}
+}
+
+// isCopy reports whether event, which is not linked, copies an event that
+// is: Google keeps the IssueIDProperty recorded by linkEvent on copies.
+func (s *Synchronizer) isCopy(event *googlecalendar.Event) (bool, error) {
+	if event.IssueID == "" {
+		return false, nil
+	}
+	item, err := s.DB.GetSyncItemByYTID(event.IssueID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	return item != nil && item.GCalID.String != event.ID, nil
+}
+
+// linkEvent records issueID on the event of item, see isCopy. The event
+// changes, so its update time is taken over into item.
+func (s *Synchronizer) linkEvent(item *SyncItem, issueID string) {
+	event, err := s.calendar().SetIssueID(s.CalendarID, item.GCalID.String, issueID)
+	if err != nil {
+		s.logError("Error recording YouTrack task %s on Google Calendar event %s: %v\n", issueID, item.GCalID.String, err)
+		return
+	}
+	if updated, err := time.Parse(time.RFC3339, event.Updated); err == nil {
+		item.GCalUpdatedAt = sql.NullTime{Time: updated, Valid: true}
+	}
+}
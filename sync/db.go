@@ -1,36 +1,117 @@
 package sync
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// DB represents the database connection.
+// ErrNotFound is returned when a looked up record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrStale is returned by UpdateSyncItem when the item was updated or
+// deleted by another sync since it was read.
+var ErrStale = errors.New("changed by another sync")
+
+// DB represents the database connection. It is safe for concurrent use.
 type DB struct {
 	*sql.DB
+	// postgres is set for remote PostgreSQL state; otherwise the database
+	// is a local SQLite file.
+	postgres bool
+	// mu serializes writes to SQLite, which fails concurrent ones with
+	// "database is locked". It is shared with the copies WithContext makes.
+	mu *gosync.RWMutex
+	// ctx bounds the queries, see WithContext.
+	ctx context.Context
+	// clock tells the times recorded by db; nil uses time.Now.
+	clock Clock
 }
 
-// NewDB creates a new database connection and initializes the schema.
+// NewDB creates a new database connection and initializes the schema. A
+// postgres:// or postgresql:// URL selects PostgreSQL; anything else is the
+// path of a SQLite database file.
 func NewDB(dataSourceName string) (*DB, error) {
-	db, err := sql.Open("sqlite3", dataSourceName)
+	postgres := IsRemoteDSN(dataSourceName)
+	driver := "sqlite3"
+	if postgres {
+		driver = "postgres"
+	}
+	sqlDB, err := sql.Open(driver, dataSourceName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-	if err := db.Ping(); err != nil {
+	if err := sqlDB.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	if err := createSchema(db); err != nil {
+	db := &DB{DB: sqlDB, postgres: postgres, mu: &gosync.RWMutex{}}
+	if err := db.createSchema(); err != nil {
 		return nil, fmt.Errorf("failed to create schema: %w", err)
 	}
+	if err := db.migrateSchema(); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return db, nil
+}
+
+// NewMappingDB opens the state of a named mapping, kept apart from other
+// mappings: a sibling SQLite file such as "sync-work.db", or a PostgreSQL
+// schema such as "mapping_work". An empty mapping opens dataSourceName itself.
+func NewMappingDB(dataSourceName, mapping string) (*DB, error) {
+	if mapping == "" {
+		return NewDB(dataSourceName)
+	}
+	if !IsRemoteDSN(dataSourceName) {
+		ext := filepath.Ext(dataSourceName)
+		return NewDB(strings.TrimSuffix(dataSourceName, ext) + "-" + mapping + ext)
+	}
+
+	u, err := url.Parse(dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+	}
+	schema := "mapping_" + strings.ReplaceAll(mapping, "-", "_")
+	base, err := sql.Open("postgres", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer base.Close()
+	if _, err := base.Exec("CREATE SCHEMA IF NOT EXISTS " + pq.QuoteIdentifier(schema)); err != nil {
+		return nil, fmt.Errorf("failed to create schema %s: %w", schema, err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return NewDB(u.String())
+}
+
+// IsRemoteDSN reports whether dataSourceName refers to a PostgreSQL server
+// rather than a local SQLite file.
+func IsRemoteDSN(dataSourceName string) bool {
+	return strings.HasPrefix(dataSourceName, "postgres://") || strings.HasPrefix(dataSourceName, "postgresql://")
+}
 
-	return &DB{db}, nil
+// Remote reports whether the state is kept on a PostgreSQL server.
+func (db *DB) Remote() bool {
+	return db.postgres
 }
 
-func createSchema(db *sql.DB) error {
+func (db *DB) createSchema() error {
 	query := `
 	CREATE TABLE IF NOT EXISTS sync_items (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -45,46 +126,457 @@ func createSchema(db *sql.DB) error {
 		gcal_sync_token TEXT,
 		yt_last_sync TIMESTAMP
 	);
+
+	CREATE TABLE IF NOT EXISTS oauth_tokens (
+		name TEXT PRIMARY KEY,
+		token TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS sync_metrics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recorded_at TIMESTAMP,
+		links INTEGER,
+		events INTEGER,
+		issues INTEGER,
+		broken INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS sync_pause (
+		id INTEGER PRIMARY KEY,
+		paused_at TIMESTAMP,
+		reason TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS planned_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		change TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS stored_tenants (
+		name TEXT PRIMARY KEY,
+		definition TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS stored_mappings (
+		name TEXT PRIMARY KEY,
+		definition TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		name TEXT PRIMARY KEY,
+		token_hash TEXT UNIQUE,
+		scopes TEXT,
+		created_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS work_blocks (
+		gcal_id TEXT PRIMARY KEY,
+		yt_id TEXT,
+		start_at TIMESTAMP,
+		end_at TIMESTAMP,
+		plan TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS rollups (
+		day TEXT PRIMARY KEY,
+		gcal_id TEXT,
+		digest TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS digest_events (
+		name TEXT PRIMARY KEY,
+		gcal_id TEXT,
+		digest TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS created_calendars (
+		configured_id TEXT PRIMARY KEY,
+		calendar_id TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS pending_creates (
+		source TEXT PRIMARY KEY,
+		idempotency_key TEXT,
+		created_at TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS journal (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target TEXT,
+		action TEXT,
+		item_id TEXT,
+		payload TEXT,
+		started_at TIMESTAMP,
+		owner TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		item_id TEXT,
+		payload TEXT,
+		queued_at TIMESTAMP,
+		since TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS push_channels (
+		id INTEGER PRIMARY KEY,
+		calendar_id TEXT,
+		channel_id TEXT,
+		resource_id TEXT,
+		token TEXT,
+		expiration TIMESTAMP
+	);
 	`
+	if db.postgres {
+		query = strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(query)
+	}
 	_, err := db.Exec(query)
 	return err
 }
 
+// columnMigration is a column added to a table after its initial release,
+// so databases created by older versions can be upgraded in place.
+type columnMigration struct {
+	column     string
+	definition string
+}
+
+// syncItemMigrations lists the columns added to sync_items.
+var syncItemMigrations = []columnMigration{
+	{"description_hash", "TEXT"},
+	{"response_status", "TEXT"},
+	{"dependency_warning", "TEXT"},
+	{"event_start", "TIMESTAMP"},
+	{"conflict_warning", "TEXT"},
+	{"yt_written_at", "TIMESTAMP"},
+	{"gcal_hash", "TEXT"},
+	{"yt_hash", "TEXT"},
+	{"version", "INTEGER NOT NULL DEFAULT 0"},
+	{"yt_readable_id", "TEXT"},
+}
+
+// journalMigrations lists the columns added to journal.
+var journalMigrations = []columnMigration{
+	{"owner", "TEXT"},
+}
+
+func (db *DB) migrateSchema() error {
+	if err := db.addColumns("sync_items", syncItemMigrations); err != nil {
+		return err
+	}
+	if err := db.addColumns("journal", journalMigrations); err != nil {
+		return err
+	}
+	if !db.postgres {
+		if err := db.normalizeUpdateTimes(); err != nil {
+			return fmt.Errorf("failed to convert update times to UTC: %w", err)
+		}
+	}
+	for _, column := range []string{"gcal_updated_at", "yt_updated_at"} {
+		if _, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS sync_items_%s ON sync_items (%s)", column, column)); err != nil {
+			return fmt.Errorf("failed to index %s: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// addColumns adds the columns of migrations that table lacks.
+func (db *DB) addColumns(table string, migrations []columnMigration) error {
+	existing, err := db.tableColumns(table)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if existing[m.column] {
+			continue
+		}
+		definition := m.definition
+		if db.postgres {
+			definition = strings.ReplaceAll(definition, "TIMESTAMP", "TIMESTAMPTZ")
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, m.column, definition)); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", m.column, err)
+		}
+	}
+	return nil
+}
+
+// normalizeUpdateTimes rewrites in UTC the update times of sync items that
+// older versions wrote in other zones. SQLite keeps times as text in the
+// zone they are written in, which only compares in SQL when it is UTC.
+func (db *DB) normalizeUpdateTimes() error {
+	type updateTimes struct {
+		id       int
+		gcal, yt sql.NullTime
+	}
+	rows, err := db.Query("SELECT id, gcal_updated_at, yt_updated_at FROM sync_items WHERE gcal_updated_at NOT LIKE '%+00:00' OR yt_updated_at NOT LIKE '%+00:00'")
+	if err != nil {
+		return err
+	}
+	var items []updateTimes
+	for rows.Next() {
+		var item updateTimes
+		if err := rows.Scan(&item.id, &item.gcal, &item.yt); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if _, err := db.Exec("UPDATE sync_items SET gcal_updated_at = ?, yt_updated_at = ? WHERE id = ?", utcTime(item.gcal), utcTime(item.yt), item.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// utcTime returns t in UTC, the zone update times are stored in.
+func utcTime(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = t.Time.UTC()
+	}
+	return t
+}
+
+func (db *DB) tableColumns(table string) (map[string]bool, error) {
+	if db.postgres {
+		return db.postgresTableColumns(table)
+	}
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+func (db *DB) postgresTableColumns(table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// rebind rewrites "?" placeholders into the numbered form PostgreSQL expects.
+func (db *DB) rebind(query string) string {
+	if !db.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// WithContext returns a copy of db whose queries are canceled with ctx.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+func (db *DB) context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+// lock locks db for writing or reading and returns the function unlocking
+// it. Only SQLite is locked; PostgreSQL handles concurrent callers itself.
+func (db *DB) lock(write bool) func() {
+	if db.postgres || db.mu == nil {
+		return func() {}
+	}
+	if write {
+		db.mu.Lock()
+		return db.mu.Unlock
+	}
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
+
+// exec runs a statement that writes.
+func (db *DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	defer db.lock(true)()
+	return db.ExecContext(db.context(), db.rebind(query), args...)
+}
+
+// get scans the single row query returns into dest. It returns ErrNotFound
+// when there is no row.
+func (db *DB) get(query string, args []interface{}, dest ...interface{}) error {
+	defer db.lock(false)()
+	err := db.QueryRowContext(db.context(), db.rebind(query), args...).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// insert runs an INSERT ... RETURNING id and returns the ID.
+func (db *DB) insert(query string, args ...interface{}) (int64, error) {
+	defer db.lock(true)()
+	var id int64
+	err := db.QueryRowContext(db.context(), db.rebind(query), args...).Scan(&id)
+	return id, err
+}
+
+// each calls scan for every row query returns.
+func (db *DB) each(query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	defer db.lock(false)()
+	rows, err := db.QueryContext(db.context(), db.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// inTx runs fn in a transaction, which is committed if fn succeeds. fn must
+// query through tx only, as db stays locked until it returns.
+func (db *DB) inTx(fn func(tx *sql.Tx) error) error {
+	defer db.lock(true)()
+	tx, err := db.BeginTx(db.context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// txExec runs a statement in tx.
+func (db *DB) txExec(tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(db.context(), db.rebind(query), args...)
+}
+
 // SyncItem represents a synchronized item between Google Calendar and YouTrack.
 type SyncItem struct {
-	ID              int
-	GCalID          sql.NullString
-	YTID            sql.NullString
-	GCalUpdatedAt   sql.NullTime
-	YTUpdatedAt     sql.NullTime
+	ID            int
+	GCalID        sql.NullString
+	YTID          sql.NullString
+	GCalUpdatedAt sql.NullTime
+	YTUpdatedAt   sql.NullTime
+	// DescriptionHash is the hash of the event description last generated for this item.
+	DescriptionHash sql.NullString
+	// ResponseStatus is the attendee response last written to the YouTrack issue.
+	ResponseStatus sql.NullString
+	// DependencyWarning identifies the dependency conflict last reported for
+	// the issue, so that it is reported once.
+	DependencyWarning sql.NullString
+	// EventStart is where the event was last placed from the issue. While
+	// the event stays there, its start is not written back as the due date.
+	EventStart sql.NullTime
+	// ConflictWarning identifies the meetings on the due date last reported
+	// for the issue, so that they are reported once.
+	ConflictWarning sql.NullString
+	// YTWrittenAt is when the synchronizer last wrote the issue from the
+	// event. Issue updates shortly after are echoes of that write.
+	YTWrittenAt sql.NullTime
+	// GCalHash and YTHash are the content hashes of the event and the
+	// issue at GCalUpdatedAt and YTUpdatedAt, see updatedSince.
+	GCalHash sql.NullString
+	YTHash   sql.NullString
+	// Version counts the updates of the item, so that UpdateSyncItem does
+	// not overwrite an update made since the item was read.
+	Version int
+	// YTReadableID is the readable ID of the issue, such as PRJ-123, as of
+	// its last sync. Webhooks and the CLI name issues by it, and a deleted
+	// issue can no longer be asked for its database ID.
+	YTReadableID sql.NullString
 }
 
+const syncItemColumns = "id, gcal_id, yt_id, gcal_updated_at, yt_updated_at, description_hash, response_status, dependency_warning, event_start, conflict_warning, yt_written_at, gcal_hash, yt_hash, version, yt_readable_id"
+
 // GetSyncItemByGCalID retrieves a SyncItem by the Google Calendar event ID.
+// It returns ErrNotFound when the event is not linked.
 func (db *DB) GetSyncItemByGCalID(gcalID string) (*SyncItem, error) {
-	query := "SELECT id, gcal_id, yt_id, gcal_updated_at, yt_updated_at FROM sync_items WHERE gcal_id = ?"
-	row := db.QueryRow(query, gcalID)
-	return scanSyncItem(row)
+	item, err := db.getSyncItem("gcal_id", gcalID)
+	if err != nil {
+		return nil, fmt.Errorf("sync item of event %s: %w", gcalID, err)
+	}
+	return item, nil
 }
 
-// GetSyncItemByYTID retrieves a SyncItem by the YouTrack issue ID.
+// GetSyncItemByYTID retrieves a SyncItem by the YouTrack issue ID or readable
+// ID. It returns ErrNotFound when the issue is not linked.
 func (db *DB) GetSyncItemByYTID(ytID string) (*SyncItem, error) {
-	query := "SELECT id, gcal_id, yt_id, gcal_updated_at, yt_updated_at FROM sync_items WHERE yt_id = ?"
-	row := db.QueryRow(query, ytID)
-	return scanSyncItem(row)
+	var item SyncItem
+	query := "SELECT " + syncItemColumns + " FROM sync_items WHERE yt_id = ? OR yt_readable_id = ? ORDER BY yt_id = ? DESC LIMIT 1"
+	if err := db.get(query, []interface{}{ytID, ytID, ytID}, item.fields()...); err != nil {
+		return nil, fmt.Errorf("sync item of issue %s: %w", ytID, err)
+	}
+	return &item, nil
 }
 
-// GetAllSyncItems retrieves all sync items from the database.
-func (db *DB) GetAllSyncItems() ([]*SyncItem, error) {
-	query := "SELECT id, gcal_id, yt_id, gcal_updated_at, yt_updated_at FROM sync_items"
-	rows, err := db.Query(query)
+// GetSyncItem retrieves a SyncItem by its ID. It returns ErrNotFound when
+// there is none.
+func (db *DB) GetSyncItem(id int) (*SyncItem, error) {
+	item, err := db.getSyncItem("id", id)
 	if err != nil {
+		return nil, fmt.Errorf("sync item %d: %w", id, err)
+	}
+	return item, nil
+}
+
+func (db *DB) getSyncItem(column string, id interface{}) (*SyncItem, error) {
+	var item SyncItem
+	query := "SELECT " + syncItemColumns + " FROM sync_items WHERE " + column + " = ?"
+	if err := db.get(query, []interface{}{id}, item.fields()...); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return &item, nil
+}
 
+// GetAllSyncItems retrieves all sync items from the database. Prefer
+// SyncItems, which reads them page by page, on large databases.
+func (db *DB) GetAllSyncItems() ([]*SyncItem, error) {
 	var items []*SyncItem
-	for rows.Next() {
-		item, err := scanSyncItem(rows)
+	for item, err := range db.SyncItems(SyncItemFilter{}) {
 		if err != nil {
 			return nil, err
 		}
@@ -93,91 +585,633 @@ func (db *DB) GetAllSyncItems() ([]*SyncItem, error) {
 	return items, nil
 }
 
-func scanSyncItem(row interface{ Scan(dest ...interface{}) error }) (*SyncItem, error) {
-	var item SyncItem
-	err := row.Scan(&item.ID, &item.GCalID, &item.YTID, &item.GCalUpdatedAt, &item.YTUpdatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+// syncItemPage is the number of sync items SyncItems reads at a time.
+const syncItemPage = 500
+
+// SyncItemFilter selects sync items; the zero filter selects all of them.
+// Items are kept per mapping already, see NewMappingDB.
+type SyncItemFilter struct {
+	// GCalIDs and YTIDs, unless nil, select the items linking one of the
+	// events or issues.
+	GCalIDs []string
+	YTIDs   []string
+	// UpdatedSince, unless zero, selects the items whose event or issue was
+	// last synced from an update at or after it.
+	UpdatedSince time.Time
+}
+
+// SyncItems returns the sync items matching filter in the order of their
+// IDs, reading syncItemPage of them at a time so that memory stays bounded.
+// The database is not locked between pages, so the caller may update or
+// delete items while iterating. Iteration stops at the first error.
+func (db *DB) SyncItems(filter SyncItemFilter) iter.Seq2[*SyncItem, error] {
+	return func(yield func(*SyncItem, error) bool) {
+		where, args := filter.where()
+		after := 0
+		for {
+			var page []*SyncItem
+			query := "SELECT " + syncItemColumns + " FROM sync_items WHERE id > ?" + where + " ORDER BY id LIMIT ?"
+			err := db.each(query, append(append([]interface{}{after}, args...), syncItemPage), func(rows *sql.Rows) error {
+				var item SyncItem
+				if err := rows.Scan(item.fields()...); err != nil {
+					return err
+				}
+				page = append(page, &item)
+				return nil
+			})
+			if err != nil {
+				yield(nil, fmt.Errorf("failed to list sync items: %w", err))
+				return
+			}
+			for _, item := range page {
+				after = item.ID
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if len(page) < syncItemPage {
+				return
+			}
 		}
-		return nil, err
 	}
-	return &item, nil
+}
+
+// where returns the SQL conditions of f, each preceded by AND, and their
+// arguments.
+func (f SyncItemFilter) where() (string, []interface{}) {
+	var where strings.Builder
+	var args []interface{}
+	for _, in := range []struct {
+		column string
+		ids    []string
+	}{{"gcal_id", f.GCalIDs}, {"yt_id", f.YTIDs}} {
+		if in.ids == nil {
+			continue
+		}
+		if len(in.ids) == 0 {
+			where.WriteString(" AND 1 = 0")
+			continue
+		}
+		where.WriteString(" AND " + in.column + " IN (?" + strings.Repeat(", ?", len(in.ids)-1) + ")")
+		for _, id := range in.ids {
+			args = append(args, id)
+		}
+	}
+	if !f.UpdatedSince.IsZero() {
+		// Update times are stored in UTC, see utcTime.
+		since := f.UpdatedSince.UTC()
+		where.WriteString(" AND (gcal_updated_at >= ? OR yt_updated_at >= ?)")
+		args = append(args, since, since)
+	}
+	return where.String(), args
+}
+
+// fields returns the fields of item in the order of syncItemColumns.
+func (item *SyncItem) fields() []interface{} {
+	return []interface{}{&item.ID, &item.GCalID, &item.YTID, &item.GCalUpdatedAt, &item.YTUpdatedAt, &item.DescriptionHash, &item.ResponseStatus, &item.DependencyWarning, &item.EventStart, &item.ConflictWarning, &item.YTWrittenAt, &item.GCalHash, &item.YTHash, &item.Version, &item.YTReadableID}
 }
 
 // CreateSyncItem creates a new sync item in the database.
 func (db *DB) CreateSyncItem(item *SyncItem) (int64, error) {
-	query := "INSERT INTO sync_items (gcal_id, yt_id, gcal_updated_at, yt_updated_at) VALUES (?, ?, ?, ?)"
-	result, err := db.Exec(query, item.GCalID, item.YTID, item.GCalUpdatedAt, item.YTUpdatedAt)
+	query := "INSERT INTO sync_items (gcal_id, yt_id, gcal_updated_at, yt_updated_at, description_hash, response_status, dependency_warning, event_start, conflict_warning, yt_written_at, gcal_hash, yt_hash, yt_readable_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id"
+	id, err := db.insert(query, item.GCalID, item.YTID, utcTime(item.GCalUpdatedAt), utcTime(item.YTUpdatedAt), item.DescriptionHash, item.ResponseStatus, item.DependencyWarning, item.EventStart, item.ConflictWarning, item.YTWrittenAt, item.GCalHash, item.YTHash, item.YTReadableID)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("failed to create sync item: %w", err)
 	}
-	return result.LastInsertId()
+	return id, nil
 }
 
-// UpdateSyncItem updates an existing sync item in the database.
+// UpdateSyncItem updates an existing sync item in the database if it is
+// still at item.Version, and advances the version. It returns ErrStale when
+// another sync, e.g. of a webhook, updated or deleted the item in between;
+// the caller should read it again rather than overwrite that update.
 func (db *DB) UpdateSyncItem(item *SyncItem) error {
-	query := "UPDATE sync_items SET gcal_id = ?, yt_id = ?, gcal_updated_at = ?, yt_updated_at = ? WHERE id = ?"
-	_, err := db.Exec(query, item.GCalID, item.YTID, item.GCalUpdatedAt, item.YTUpdatedAt, item.ID)
-	return err
+	query := "UPDATE sync_items SET gcal_id = ?, yt_id = ?, gcal_updated_at = ?, yt_updated_at = ?, description_hash = ?, response_status = ?, dependency_warning = ?, event_start = ?, conflict_warning = ?, yt_written_at = ?, gcal_hash = ?, yt_hash = ?, yt_readable_id = ?, version = version + 1 WHERE id = ? AND version = ?"
+	result, err := db.exec(query, item.GCalID, item.YTID, utcTime(item.GCalUpdatedAt), utcTime(item.YTUpdatedAt), item.DescriptionHash, item.ResponseStatus, item.DependencyWarning, item.EventStart, item.ConflictWarning, item.YTWrittenAt, item.GCalHash, item.YTHash, item.YTReadableID, item.ID, item.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update sync item %d: %w", item.ID, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update sync item %d: %w", item.ID, err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to update sync item %d: %w", item.ID, ErrStale)
+	}
+	item.Version++
+	return nil
 }
 
 // DeleteSyncItem deletes a sync item from the database.
 func (db *DB) DeleteSyncItem(id int) error {
-	query := "DELETE FROM sync_items WHERE id = ?"
-	_, err := db.Exec(query, id)
-	return err
+	if _, err := db.exec("DELETE FROM sync_items WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete sync item %d: %w", id, err)
+	}
+	return nil
 }
 
-// GetGCalSyncToken retrieves the Google Calendar sync token.
+// GetGCalSyncToken retrieves the Google Calendar sync token. It returns ""
+// before the first pass.
 func (db *DB) GetGCalSyncToken() (string, error) {
-	var token string
-	query := "SELECT gcal_sync_token FROM last_sync WHERE id = 1"
-	err := db.QueryRow(query).Scan(&token)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", nil
-		}
-		return "", err
+	var token sql.NullString
+	err := db.get("SELECT gcal_sync_token FROM last_sync WHERE id = 1", nil, &token)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("failed to get Google Calendar sync token: %w", err)
 	}
-	return token, nil
+	return token.String, nil
 }
 
 // SetGCalSyncToken sets the Google Calendar sync token.
 func (db *DB) SetGCalSyncToken(token string) error {
-	query := "INSERT OR REPLACE INTO last_sync (id, gcal_sync_token) VALUES (1, ?)"
-	_, err := db.Exec(query, token)
-	return err
+	query := "INSERT INTO last_sync (id, gcal_sync_token) VALUES (1, ?) ON CONFLICT (id) DO UPDATE SET gcal_sync_token = excluded.gcal_sync_token"
+	if _, err := db.exec(query, token); err != nil {
+		return fmt.Errorf("failed to set Google Calendar sync token: %w", err)
+	}
+	return nil
 }
 
-// GetYTLastSync retrieves the last YouTrack sync time.
+// GetYTLastSync retrieves the YouTrack cursor: the update time of the newest
+// change seen, by the YouTrack clock. It returns the zero time before any
+// change was seen.
 func (db *DB) GetYTLastSync() (time.Time, error) {
-	var lastSync time.Time
-	query := "SELECT yt_last_sync FROM last_sync WHERE id = 1"
-	err := db.QueryRow(query).Scan(&lastSync)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return time.Time{}, nil
-		}
-		return time.Time{}, err
+	var lastSync sql.NullTime
+	err := db.get("SELECT yt_last_sync FROM last_sync WHERE id = 1", nil, &lastSync)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return time.Time{}, fmt.Errorf("failed to get YouTrack last sync time: %w", err)
 	}
-	return lastSync, nil
+	return lastSync.Time, nil
 }
 
-// SetYTLastSync sets the last YouTrack sync time.
+// SetYTLastSync sets the YouTrack cursor, see GetYTLastSync.
 func (db *DB) SetYTLastSync(t time.Time) error {
-	query := "UPDATE last_sync SET yt_last_sync = ? WHERE id = 1"
-	res, err := db.Exec(query, t)
+	query := "INSERT INTO last_sync (id, yt_last_sync) VALUES (1, ?) ON CONFLICT (id) DO UPDATE SET yt_last_sync = excluded.yt_last_sync"
+	if _, err := db.exec(query, t); err != nil {
+		return fmt.Errorf("failed to set YouTrack last sync time: %w", err)
+	}
+	return nil
+}
+
+// ResetCursors discards the Google Calendar sync token and the YouTrack last
+// sync time, so the next pass lists both sides in full.
+func (db *DB) ResetCursors() error {
+	if _, err := db.exec("DELETE FROM last_sync"); err != nil {
+		return fmt.Errorf("failed to reset cursors: %w", err)
+	}
+	return nil
+}
+
+// snapshots numbers in-memory snapshot databases, which must be unique.
+var snapshots atomic.Int64
+
+// Snapshot copies the sync items and cursors into a private in-memory SQLite
+// database, so changes made through the copy never reach db.
+func (db *DB) Snapshot() (*DB, error) {
+	name := fmt.Sprintf("file:snapshot-%d?mode=memory&cache=shared", snapshots.Add(1))
+	snapshot, err := NewDB(name)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	rowsAffected, err := res.RowsAffected()
+
+	for item, err := range db.SyncItems(SyncItemFilter{}) {
+		if err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+		query := "INSERT INTO sync_items (" + syncItemColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		if _, err := snapshot.exec(query, item.fields()...); err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+	}
+
+	blocks, err := db.GetWorkBlocks()
 	if err != nil {
+		snapshot.Close()
+		return nil, err
+	}
+	for _, block := range blocks {
+		if err := snapshot.CreateWorkBlock(block); err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+	}
+
+	rollups, err := db.GetRollups()
+	if err != nil {
+		snapshot.Close()
+		return nil, err
+	}
+	for _, rollup := range rollups {
+		if err := snapshot.SaveRollup(rollup); err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+	}
+
+	err = db.each("SELECT configured_id, calendar_id FROM created_calendars", nil, func(rows *sql.Rows) error {
+		var configured, id string
+		if err := rows.Scan(&configured, &id); err != nil {
+			return err
+		}
+		return snapshot.SaveCreatedCalendar(configured, id)
+	})
+	if err != nil {
+		snapshot.Close()
+		return nil, err
+	}
+
+	digest, err := db.GetDigestEvent(weeklyDigest)
+	if err == nil {
+		err = snapshot.SaveDigestEvent(digest)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		snapshot.Close()
+		return nil, err
+	}
+
+	err = db.each("SELECT item_id, payload, queued_at, since FROM outbox ORDER BY id", nil, func(rows *sql.Rows) error {
+		var id, payload string
+		var queuedAt, since time.Time
+		if err := rows.Scan(&id, &payload, &queuedAt, &since); err != nil {
+			return err
+		}
+		_, err := snapshot.exec("INSERT INTO outbox (item_id, payload, queued_at, since) VALUES (?, ?, ?, ?)", id, payload, queuedAt, since)
 		return err
+	})
+	if err != nil {
+		snapshot.Close()
+		return nil, err
 	}
-	if rowsAffected == 0 {
-		query = "INSERT INTO last_sync (id, yt_last_sync) VALUES (1, ?)"
-		_, err = db.Exec(query, t)
+
+	token, err := db.GetGCalSyncToken()
+	if err == nil && token != "" {
+		err = snapshot.SetGCalSyncToken(token)
 	}
-	return err
-}
\ No newline at end of file
+	if err != nil {
+		snapshot.Close()
+		return nil, err
+	}
+	lastSync, err := db.GetYTLastSync()
+	if err == nil && !lastSync.IsZero() {
+		err = snapshot.SetYTLastSync(lastSync)
+	}
+	if err != nil {
+		snapshot.Close()
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetToken retrieves a stored OAuth token by name. It returns "" when none is
+// stored.
+func (db *DB) GetToken(name string) (string, error) {
+	var token string
+	err := db.get("SELECT token FROM oauth_tokens WHERE name = ?", []interface{}{name}, &token)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("failed to get token %s: %w", name, err)
+	}
+	return token, nil
+}
+
+// SetToken stores an OAuth token under name, replacing any previous one.
+func (db *DB) SetToken(name, token string) error {
+	query := "INSERT INTO oauth_tokens (name, token) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET token = excluded.token"
+	if _, err := db.exec(query, name, token); err != nil {
+		return fmt.Errorf("failed to store token %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetStoredTenants returns the definitions of the tenants registered at
+// runtime, ordered by name.
+func (db *DB) GetStoredTenants() ([]string, error) {
+	return db.storedDefinitions("stored_tenants")
+}
+
+// SetStoredTenant stores the definition of a tenant, replacing any previous one.
+func (db *DB) SetStoredTenant(name, definition string) error {
+	return db.setStoredDefinition("stored_tenants", name, definition)
+}
+
+// DeleteStoredTenant removes a stored tenant and reports whether it existed.
+func (db *DB) DeleteStoredTenant(name string) (bool, error) {
+	return db.deleteStoredDefinition("stored_tenants", name)
+}
+
+// GetStoredMappings returns the definitions of the mappings registered at
+// runtime, ordered by name.
+func (db *DB) GetStoredMappings() ([]string, error) {
+	return db.storedDefinitions("stored_mappings")
+}
+
+// SetStoredMapping stores the definition of a mapping, replacing any previous one.
+func (db *DB) SetStoredMapping(name, definition string) error {
+	return db.setStoredDefinition("stored_mappings", name, definition)
+}
+
+// DeleteStoredMapping removes a stored mapping and reports whether it existed.
+func (db *DB) DeleteStoredMapping(name string) (bool, error) {
+	return db.deleteStoredDefinition("stored_mappings", name)
+}
+
+func (db *DB) storedDefinitions(table string) ([]string, error) {
+	var definitions []string
+	err := db.each("SELECT definition FROM "+table+" ORDER BY name", nil, func(rows *sql.Rows) error {
+		var definition string
+		if err := rows.Scan(&definition); err != nil {
+			return err
+		}
+		definitions = append(definitions, definition)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", table, err)
+	}
+	return definitions, nil
+}
+
+func (db *DB) setStoredDefinition(table, name, definition string) error {
+	query := "INSERT INTO " + table + " (name, definition) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET definition = excluded.definition"
+	if _, err := db.exec(query, name, definition); err != nil {
+		return fmt.Errorf("failed to store %s in %s: %w", name, table, err)
+	}
+	return nil
+}
+
+func (db *DB) deleteStoredDefinition(table, name string) (bool, error) {
+	result, err := db.exec("DELETE FROM "+table+" WHERE name = ?", name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete %s from %s: %w", name, table, err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Pause is a pause of synchronization stored with the sync state.
+type Pause struct {
+	Since  time.Time
+	Reason string
+}
+
+// GetPause returns the stored pause. It returns ErrNotFound when
+// synchronization is not paused.
+func (db *DB) GetPause() (*Pause, error) {
+	var p Pause
+	if err := db.get("SELECT paused_at, reason FROM sync_pause WHERE id = 1", nil, &p.Since, &p.Reason); err != nil {
+		return nil, fmt.Errorf("pause: %w", err)
+	}
+	return &p, nil
+}
+
+// SetPause stores p, replacing any previous pause.
+func (db *DB) SetPause(p Pause) error {
+	query := "INSERT INTO sync_pause (id, paused_at, reason) VALUES (1, ?, ?) ON CONFLICT (id) DO UPDATE SET paused_at = excluded.paused_at, reason = excluded.reason"
+	if _, err := db.exec(query, p.Since, p.Reason); err != nil {
+		return fmt.Errorf("failed to store pause: %w", err)
+	}
+	return nil
+}
+
+// ClearPause removes the stored pause.
+func (db *DB) ClearPause() error {
+	if _, err := db.exec("DELETE FROM sync_pause"); err != nil {
+		return fmt.Errorf("failed to clear pause: %w", err)
+	}
+	return nil
+}
+
+// ReplacePlannedChanges stores changes as the writes planned while paused,
+// replacing those of the previous paused pass.
+func (db *DB) ReplacePlannedChanges(changes []Change) error {
+	err := db.inTx(func(tx *sql.Tx) error {
+		if _, err := db.txExec(tx, "DELETE FROM planned_changes"); err != nil {
+			return err
+		}
+		for _, c := range changes {
+			data, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+			if _, err := db.txExec(tx, "INSERT INTO planned_changes (change) VALUES (?)", string(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store planned changes: %w", err)
+	}
+	return nil
+}
+
+// PlannedChanges returns the writes planned by the last paused pass, in the
+// order they would have been made.
+func (db *DB) PlannedChanges() ([]Change, error) {
+	var changes []Change
+	err := db.each("SELECT change FROM planned_changes ORDER BY id", nil, func(rows *sql.Rows) error {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		var c Change
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			return err
+		}
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list planned changes: %w", err)
+	}
+	return changes, nil
+}
+
+// WorkBlock is an event placed by the planner to work on an issue.
+type WorkBlock struct {
+	GCalID string
+	YTID   string
+	Start  time.Time
+	End    time.Time
+	// Plan identifies the estimate and due date the block was planned for.
+	Plan string
+}
+
+// GetWorkBlocks returns all work blocks, grouped by issue and in
+// chronological order.
+func (db *DB) GetWorkBlocks() ([]WorkBlock, error) {
+	var blocks []WorkBlock
+	err := db.each("SELECT gcal_id, yt_id, start_at, end_at, plan FROM work_blocks ORDER BY yt_id, start_at", nil, func(rows *sql.Rows) error {
+		var b WorkBlock
+		if err := rows.Scan(&b.GCalID, &b.YTID, &b.Start, &b.End, &b.Plan); err != nil {
+			return err
+		}
+		blocks = append(blocks, b)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list work blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// IsWorkBlock reports whether the Google Calendar event gcalID is a work
+// block.
+func (db *DB) IsWorkBlock(gcalID string) (bool, error) {
+	var n int
+	if err := db.get("SELECT COUNT(*) FROM work_blocks WHERE gcal_id = ?", []interface{}{gcalID}, &n); err != nil {
+		return false, fmt.Errorf("failed to look up work block %s: %w", gcalID, err)
+	}
+	return n > 0, nil
+}
+
+// CreateWorkBlock stores a work block.
+func (db *DB) CreateWorkBlock(b WorkBlock) error {
+	query := "INSERT INTO work_blocks (gcal_id, yt_id, start_at, end_at, plan) VALUES (?, ?, ?, ?, ?)"
+	if _, err := db.exec(query, b.GCalID, b.YTID, b.Start, b.End, b.Plan); err != nil {
+		return fmt.Errorf("failed to store work block %s: %w", b.GCalID, err)
+	}
+	return nil
+}
+
+// DeleteWorkBlock removes the work block of the event gcalID.
+func (db *DB) DeleteWorkBlock(gcalID string) error {
+	if _, err := db.exec("DELETE FROM work_blocks WHERE gcal_id = ?", gcalID); err != nil {
+		return fmt.Errorf("failed to delete work block %s: %w", gcalID, err)
+	}
+	return nil
+}
+
+// RollupEvent is the all-day event listing the issues due on a day.
+type RollupEvent struct {
+	// Day is the date of the event, formatted as 2006-01-02.
+	Day    string
+	GCalID string
+	// Digest identifies the issues the event was last written for.
+	Digest string
+}
+
+// GetRollups returns all rollup events in chronological order.
+func (db *DB) GetRollups() ([]RollupEvent, error) {
+	var rollups []RollupEvent
+	err := db.each("SELECT day, gcal_id, digest FROM rollups ORDER BY day", nil, func(rows *sql.Rows) error {
+		var r RollupEvent
+		if err := rows.Scan(&r.Day, &r.GCalID, &r.Digest); err != nil {
+			return err
+		}
+		rollups = append(rollups, r)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rollup events: %w", err)
+	}
+	return rollups, nil
+}
+
+// IsRollup reports whether the Google Calendar event gcalID is a rollup
+// event.
+func (db *DB) IsRollup(gcalID string) (bool, error) {
+	var n int
+	if err := db.get("SELECT COUNT(*) FROM rollups WHERE gcal_id = ?", []interface{}{gcalID}, &n); err != nil {
+		return false, fmt.Errorf("failed to look up rollup event %s: %w", gcalID, err)
+	}
+	return n > 0, nil
+}
+
+// SaveRollup stores the rollup event of a day, replacing any earlier one.
+func (db *DB) SaveRollup(r RollupEvent) error {
+	query := "INSERT INTO rollups (day, gcal_id, digest) VALUES (?, ?, ?) ON CONFLICT (day) DO UPDATE SET gcal_id = excluded.gcal_id, digest = excluded.digest"
+	if _, err := db.exec(query, r.Day, r.GCalID, r.Digest); err != nil {
+		return fmt.Errorf("failed to store rollup event of %s: %w", r.Day, err)
+	}
+	return nil
+}
+
+// DeleteRollup removes the rollup event of day.
+func (db *DB) DeleteRollup(day string) error {
+	if _, err := db.exec("DELETE FROM rollups WHERE day = ?", day); err != nil {
+		return fmt.Errorf("failed to delete rollup event of %s: %w", day, err)
+	}
+	return nil
+}
+
+// DigestEvent is a recurring event whose description the synchronizer
+// regenerates, such as the weekly digest.
+type DigestEvent struct {
+	Name   string
+	GCalID string
+	// Digest identifies the content the event was last written with.
+	Digest string
+}
+
+// GetDigestEvent returns the digest event name, or ErrNotFound.
+func (db *DB) GetDigestEvent(name string) (DigestEvent, error) {
+	d := DigestEvent{Name: name}
+	if err := db.get("SELECT gcal_id, digest FROM digest_events WHERE name = ?", []interface{}{name}, &d.GCalID, &d.Digest); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return d, err
+		}
+		return d, fmt.Errorf("failed to get digest event %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// IsDigestEvent reports whether the Google Calendar event gcalID is a
+// digest event.
+func (db *DB) IsDigestEvent(gcalID string) (bool, error) {
+	var n int
+	if err := db.get("SELECT COUNT(*) FROM digest_events WHERE gcal_id = ?", []interface{}{gcalID}, &n); err != nil {
+		return false, fmt.Errorf("failed to look up digest event %s: %w", gcalID, err)
+	}
+	return n > 0, nil
+}
+
+// SaveDigestEvent stores a digest event, replacing any earlier one of the
+// same name.
+func (db *DB) SaveDigestEvent(d DigestEvent) error {
+	query := "INSERT INTO digest_events (name, gcal_id, digest) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET gcal_id = excluded.gcal_id, digest = excluded.digest"
+	if _, err := db.exec(query, d.Name, d.GCalID, d.Digest); err != nil {
+		return fmt.Errorf("failed to store digest event %s: %w", d.Name, err)
+	}
+	return nil
+}
+
+// GetCreatedCalendar returns the ID of the calendar created in place of the
+// configured calendar configuredID, or ErrNotFound.
+func (db *DB) GetCreatedCalendar(configuredID string) (string, error) {
+	var id string
+	if err := db.get("SELECT calendar_id FROM created_calendars WHERE configured_id = ?", []interface{}{configuredID}, &id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to get calendar created for %s: %w", configuredID, err)
+	}
+	return id, nil
+}
+
+// SaveCreatedCalendar records that the calendar calendarID was created in
+// place of the configured calendar configuredID.
+func (db *DB) SaveCreatedCalendar(configuredID, calendarID string) error {
+	query := "INSERT INTO created_calendars (configured_id, calendar_id) VALUES (?, ?) ON CONFLICT (configured_id) DO UPDATE SET calendar_id = excluded.calendar_id"
+	if _, err := db.exec(query, configuredID, calendarID); err != nil {
+		return fmt.Errorf("failed to store calendar created for %s: %w", configuredID, err)
+	}
+	return nil
+}
+
+// RecordMetrics stores the outcome of a drift check.
+func (db *DB) RecordMetrics(m Metrics) error {
+	query := "INSERT INTO sync_metrics (recorded_at, links, events, issues, broken) VALUES (?, ?, ?, ?, ?)"
+	if _, err := db.exec(query, m.RecordedAt, m.Links, m.Events, m.Issues, m.Broken); err != nil {
+		return fmt.Errorf("failed to record metrics: %w", err)
+	}
+	return nil
+}
+
+// LatestMetrics returns the most recently recorded metrics. It returns
+// ErrNotFound when no drift check ran yet.
+func (db *DB) LatestMetrics() (*Metrics, error) {
+	var m Metrics
+	query := "SELECT recorded_at, links, events, issues, broken FROM sync_metrics ORDER BY id DESC LIMIT 1"
+	if err := db.get(query, nil, &m.RecordedAt, &m.Links, &m.Events, &m.Issues, &m.Broken); err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// CurrentUser is the DefaultField value that stands for the owner of the
+// YouTrack token in user fields.
+const CurrentUser = "me"
+
+// DefaultField is a custom field value applied to issues created from events.
+type DefaultField struct {
+	Kind  string
+	Name  string
+	Value string
+}
+
+// ParseDefaultFields parses semicolon-separated "Name[:kind]=value" entries,
+// e.g. "Assignee=me;Subsystem=Ops;Priority:enum=Normal". The kind defaults to
+// user for Assignee, state for State and enum otherwise.
+func ParseDefaultFields(spec string) ([]DefaultField, error) {
+	var fields []DefaultField
+	for _, part := range strings.Split(spec, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid default field %q, expected Name[:kind]=value", part)
+		}
+		name, kind, _ := strings.Cut(key, ":")
+		field := DefaultField{Kind: strings.TrimSpace(kind), Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)}
+		if field.Kind == "" {
+			field.Kind = defaultFieldKind(field.Name)
+		}
+		if _, err := youtrack.NewCustomField(field.Kind, field.Name, field.Value); err != nil {
+			return nil, fmt.Errorf("invalid default field %q: %w", part, err)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func defaultFieldKind(name string) string {
+	switch name {
+	case "Assignee":
+		return youtrack.FieldKindUser
+	case "State":
+		return youtrack.FieldKindState
+	default:
+		return youtrack.FieldKindEnum
+	}
+}
+
+// applyDefaultFields adds DefaultFields to a draft, keeping any field the
+// draft already sets.
+func (s *Synchronizer) applyDefaultFields(draft *IssueDraft) error {
+	var fields []youtrack.CustomFieldWrapper
+	for _, def := range s.DefaultFields {
+		if hasField(draft.CustomFields, def.Name) {
+			continue
+		}
+		value := def.Value
+		if def.Kind == youtrack.FieldKindUser && value == CurrentUser {
+			login, err := s.currentUserLogin()
+			if err != nil {
+				return err
+			}
+			value = login
+		}
+		field, err := youtrack.NewCustomField(def.Kind, def.Name, value)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, field)
+	}
+	draft.CustomFields = append(fields, draft.CustomFields...)
+	return nil
+}
+
+// applyOrganizerAssignee sets the draft's Assignee to the event organizer
+// when AssignOrganizer is enabled, falling back to AssigneeFallback when the
+// organizer is not a YouTrack user.
+func (s *Synchronizer) applyOrganizerAssignee(event *googlecalendar.Event, draft *IssueDraft) error {
+	if !s.AssignOrganizer {
+		return nil
+	}
+	var login string
+	if event.Organizer != "" {
+		user, err := s.YouTrackClient.FindUserByEmail(event.Organizer)
+		if err != nil {
+			return fmt.Errorf("failed to look up organizer %s: %w", event.Organizer, err)
+		}
+		if user != nil {
+			login = user.Login
+		}
+	}
+	if login == "" {
+		login = s.AssigneeFallback
+	}
+	if login == CurrentUser {
+		var err error
+		if login, err = s.currentUserLogin(); err != nil {
+			return err
+		}
+	}
+	if login == "" {
+		return nil
+	}
+	field, _ := youtrack.NewCustomField(youtrack.FieldKindUser, "Assignee", login)
+	draft.CustomFields = append(draft.CustomFields, field)
+	return nil
+}
+
+// currentUserLogin returns the login of the token owner, fetched once.
+func (s *Synchronizer) currentUserLogin() (string, error) {
+	if s.currentUser == "" {
+		user, err := s.YouTrackClient.GetCurrentUser()
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve current user: %w", err)
+		}
+		s.currentUser = user.Login
+	}
+	return s.currentUser, nil
+}
+
+func hasField(fields []youtrack.CustomFieldWrapper, name string) bool {
+	for _, field := range fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
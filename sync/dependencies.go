@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DependencyCheck determines what happens when the due date an event gives
+// its issue comes before the due date of an issue it depends on.
+type DependencyCheck string
+
+const (
+	// DependencyCheckOff does not look at dependencies.
+	DependencyCheckOff DependencyCheck = "off"
+	// DependencyCheckWarn logs a warning.
+	DependencyCheckWarn DependencyCheck = "warn"
+	// DependencyCheckComment logs a warning and comments on the issue.
+	DependencyCheckComment DependencyCheck = "comment"
+)
+
+// ParseDependencyCheck parses a DependencyCheck. An empty value yields
+// DependencyCheckOff.
+func ParseDependencyCheck(value string) (DependencyCheck, error) {
+	switch check := DependencyCheck(strings.ToLower(strings.TrimSpace(value))); check {
+	case "":
+		return DependencyCheckOff, nil
+	case DependencyCheckOff, DependencyCheckWarn, DependencyCheckComment:
+		return check, nil
+	default:
+		return "", fmt.Errorf("unknown dependency check %q", value)
+	}
+}
+
+// checkDependencies reports the issues the issue of item depends on that are
+// due after dueDate, the due date just written from the calendar. A conflict
+// is reported once; item records it until the conflict changes or is gone.
+func (s *Synchronizer) checkDependencies(item *SyncItem, dueDate *time.Time) error {
+	if s.DependencyCheck == "" || s.DependencyCheck == DependencyCheckOff || dueDate == nil {
+		return nil
+	}
+	dependencies, err := s.YouTrackClient.GetDependencies(item.YTID.String)
+	if err != nil {
+		return err
+	}
+
+	var late []string
+	for _, dependency := range dependencies {
+		if dependency.IsResolved() {
+			continue
+		}
+		due := issueDueDate(dependency)
+		if !due.IsZero() && dueDate.Before(due) {
+			late = append(late, fmt.Sprintf("%s (due %s)", dependency.ReadableID(), due.Format("2006-01-02")))
+		}
+	}
+	if len(late) == 0 {
+		item.DependencyWarning = sql.NullString{}
+		return nil
+	}
+	warning := dueDate.Format(time.RFC3339) + " " + strings.Join(late, ", ")
+	if item.DependencyWarning.Valid && item.DependencyWarning.String == warning {
+		return nil
+	}
+
+	message := fmt.Sprintf("Due %s, before issues it depends on: %s", dueDate.Format("2006-01-02"), strings.Join(late, ", "))
+	log.Printf("WARNING: YouTrack task %s: %s\n", item.YTID.String, message)
+	if s.DependencyCheck == DependencyCheckComment {
+		if err := s.youtrack().AddComment(item.YTID.String, message+"."); err != nil {
+			return fmt.Errorf("failed to comment on dependency conflict: %w", err)
+		}
+	}
+	item.DependencyWarning = sql.NullString{String: warning, Valid: true}
+	return nil
+}
@@ -0,0 +1,178 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"os"
+	"regexp"
+	"strings"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// DefaultDescriptionTemplate renders the event description for a YouTrack issue.
+const DefaultDescriptionTemplate = `<a href="{{.URL}}">{{.ID}}</a>: {{.Summary}}<br>
+<b>Project:</b> {{.Project}}<br>
+{{- if .State}}
+<b>State:</b> {{.State}}<br>
+{{- end}}
+{{- if .Priority}}
+<b>Priority:</b> {{.Priority}}<br>
+{{- end}}
+{{- if .Assignee}}
+<b>Assignee:</b> {{.Assignee}}<br>
+{{- end}}`
+
+var defaultDescriptionTemplate = template.Must(template.New("description").Parse(DefaultDescriptionTemplate))
+
+// DescriptionData holds the issue fields available to the description template.
+type DescriptionData struct {
+	ID       string
+	URL      string
+	Summary  string
+	Project  string
+	State    string
+	Priority string
+	Assignee string
+	// Description is the issue description, converted from Markdown.
+	Description template.HTML
+}
+
+// LoadDescriptionTemplate parses an HTML template for event descriptions from
+// path. An empty path returns the default template.
+func LoadDescriptionTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return defaultDescriptionTemplate, nil
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read description template: %w", err)
+	}
+	tmpl, err := template.New("description").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse description template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// eventDescription renders the calendar event description for issue.
+func (s *Synchronizer) eventDescription(issue youtrack.Issue) (string, error) {
+	tmpl := s.DescriptionTemplate
+	if tmpl == nil {
+		tmpl = defaultDescriptionTemplate
+	}
+
+	data := DescriptionData{
+		ID:       issue.ReadableID(),
+		URL:      fmt.Sprintf("%s/issue/%s", s.YouTrackClient.GetBaseURL(), issue.ReadableID()),
+		Summary:  issue.Summary,
+		State:    issue.CustomFieldValue("State"),
+		Priority: issue.CustomFieldValue("Priority"),
+		Assignee: issue.CustomFieldValue("Assignee"),
+		// The conversion escapes the text, so it is safe as HTML.
+		Description: template.HTML(MarkdownToHTML(descriptionText(issue.Description))),
+	}
+	if issue.Project != nil {
+		data.Project = issue.Project.Name
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render description for issue %s: %w", issue.ID, err)
+	}
+	if !s.DescriptionSync {
+		return buf.String(), nil
+	}
+	text := MarkdownToHTML(descriptionText(issue.Description))
+	if text != "" {
+		text += "<br><br>"
+	}
+	return text + metadataMarker + "<br>" + buf.String(), nil
+}
+
+// metadataMarker separates the text of a description, which DescriptionSync
+// copies between the issue and the event, from the block the synchronizer
+// generates for either side.
+const metadataMarker = "-- sync metadata --"
+
+// descriptionText returns the part of description before its metadata
+// block, or all of it if it has none, without the breaks that end it.
+func descriptionText(description string) string {
+	if i := strings.LastIndex(description, metadataMarker); i >= 0 {
+		description = description[:i]
+	}
+	description = strings.TrimSpace(description)
+	return trailingBreaks.ReplaceAllString(description, "")
+}
+
+// trailingBreaks matches the line breaks that end a description.
+var trailingBreaks = regexp.MustCompile(`(?i)(\s|<br\s*/?>)+$`)
+
+// descriptionHash returns a stable fingerprint of a generated description.
+func descriptionHash(description string) string {
+	sum := sha256.Sum256([]byte(description))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueDescription builds the YouTrack issue description for a calendar event:
+// a link back to the event, followed by the conference join URL unless it is
+// written to ConferenceField instead, and links to the event's attachments.
+// With DescriptionSync, the text of the event description comes first.
+func (s *Synchronizer) issueDescription(event *googlecalendar.Event) string {
+	var b strings.Builder
+	if s.DescriptionSync {
+		if text := HTMLToMarkdown(descriptionText(event.Description)); text != "" {
+			b.WriteString(text + "\n\n")
+		}
+		b.WriteString(metadataMarker + "\n")
+	}
+	b.WriteString(event.HTMLLink)
+	if event.ConferenceURL != "" && s.ConferenceField == "" {
+		fmt.Fprintf(&b, "\n\nJoin: %s", event.ConferenceURL)
+	}
+	if len(event.Attachments) > 0 {
+		b.WriteString("\n\nAttachments:")
+		for _, attachment := range event.Attachments {
+			fmt.Fprintf(&b, "\n- [%s](%s)", attachment.Title, attachment.FileURL)
+		}
+	}
+	return b.String()
+}
+
+// provenanceComment returns the comment that tells where an issue created
+// from event came from.
+func (s *Synchronizer) provenanceComment(event *googlecalendar.Event) string {
+	link := event.HTMLLink
+	if event.Summary != "" && link != "" {
+		link = fmt.Sprintf("[%s](%s)", event.Summary, link)
+	}
+	return fmt.Sprintf("Created by gcal-sync from event %s on %s.", link, s.now().Format("2006-01-02"))
+}
+
+// addProvenanceComment comments on a newly created issue where it came from,
+// if ProvenanceComment is set.
+func (s *Synchronizer) addProvenanceComment(issueID string, event *googlecalendar.Event) error {
+	if !s.ProvenanceComment {
+		return nil
+	}
+	return s.youtrack().AddComment(issueID, s.provenanceComment(event))
+}
+
+// applyConferenceURL writes the event's conference join URL to ConferenceField
+// through yt.
+func (s *Synchronizer) applyConferenceURL(yt YTClient, issueID string, event *googlecalendar.Event) error {
+	if s.ConferenceField == "" || event.ConferenceURL == "" {
+		return nil
+	}
+	return yt.UpdateCustomFields(issueID, []youtrack.CustomFieldWrapper{
+		{
+			YouTrackType: youtrack.YouTrackType{Type: "SimpleIssueCustomField"},
+			Name:         s.ConferenceField,
+			Value:        event.ConferenceURL,
+		},
+	})
+}
@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// WeeklyDigest keeps a recurring Sunday-evening event whose description
+// lists the issues due the following week, grouped by day. The description
+// is regenerated on every pass.
+type WeeklyDigest struct {
+	// At is the time of day the event starts.
+	At time.Duration
+	// Location is the time zone of the event and of the days it lists; nil
+	// means the local time zone.
+	Location *time.Location
+}
+
+// DefaultDigestTime is the default of WeeklyDigest.At.
+const DefaultDigestTime = 18 * time.Hour
+
+const (
+	// weeklyDigest names the digest event of WeeklyDigest.
+	weeklyDigest = "weekly"
+	// digestLength is how long the digest event lasts.
+	digestLength = 30 * time.Minute
+	// digestRecurrence repeats the digest event every Sunday.
+	digestRecurrence = "RRULE:FREQ=WEEKLY;BYDAY=SU"
+)
+
+// writeWeeklyDigest creates the digest event or, when the issues due next
+// week changed, rewrites its summary and description.
+func (s *Synchronizer) writeWeeklyDigest() error {
+	loc := s.WeeklyDigest.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	now := s.now().In(loc)
+	days := (8 - int(now.Weekday())) % 7
+	if days == 0 {
+		days = 7
+	}
+	year, month, day := now.Date()
+	monday := time.Date(year, month, day+days, 0, 0, 0, 0, loc)
+
+	query, err := s.IssueQuery()
+	if err != nil {
+		return err
+	}
+	issues, err := s.YouTrackClient.GetDueIssues(query, monday, monday.AddDate(0, 0, 7))
+	if err != nil {
+		return fmt.Errorf("failed to fetch next week's YouTrack issues: %w", err)
+	}
+	due := make(map[string][]youtrack.Issue)
+	for _, issue := range issues {
+		if issue.IsResolved() || issue.IsDraft && !s.IncludeDrafts || s.skipsSubtask(issue) {
+			continue
+		}
+		d := rollupDay(issueDueDate(issue).In(loc))
+		due[d] = append(due[d], issue)
+	}
+	summary, description := s.digestContent(monday, due)
+	digest := descriptionHash(summary + "\n" + description)
+
+	stored, err := s.DB.GetDigestEvent(weeklyDigest)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if stored.GCalID != "" {
+		if stored.Digest == digest {
+			return nil
+		}
+		log.Printf("Updating weekly digest for the week of %s\n", monday.Format("2006-01-02"))
+		_, err := s.calendar().UpdateEvent(s.CalendarID, stored.GCalID, &summary, &description, nil, time.Time{}, time.Time{}, false, s.EventVisibility, "transparent")
+		if err == nil {
+			stored.Digest = digest
+			return s.DB.SaveDigestEvent(stored)
+		}
+		if !errors.Is(err, googlecalendar.ErrNotFound) {
+			return err
+		}
+	}
+
+	start := time.Date(year, month, day+days-1, 0, 0, 0, 0, loc).Add(s.WeeklyDigest.At)
+	end := start.Add(digestLength)
+	log.Printf("Creating weekly digest on Sundays at %s\n", start.Format("15:04"))
+	event, err := s.calendar().CreateEvent(s.CalendarID, "", summary, description, "", start, end, false, s.EventVisibility, "transparent")
+	if err != nil {
+		return err
+	}
+	if _, err := s.calendar().SetRecurrence(s.CalendarID, event.Id, start, end, []string{digestRecurrence}); err != nil {
+		if err := s.calendar().DeleteEvent(s.CalendarID, event.Id); err != nil {
+			s.logError("Error deleting weekly digest %s: %v\n", event.Id, err)
+		}
+		return err
+	}
+	return s.DB.SaveDigestEvent(DigestEvent{Name: weeklyDigest, GCalID: event.Id, Digest: digest})
+}
+
+// digestContent returns the summary and description of the digest of the
+// week starting monday, given the issues due on each of its days.
+func (s *Synchronizer) digestContent(monday time.Time, due map[string][]youtrack.Issue) (string, string) {
+	var count int
+	var sections []string
+	for d := monday; d.Before(monday.AddDate(0, 0, 7)); d = d.AddDate(0, 0, 1) {
+		issues := due[d.Format("2006-01-02")]
+		if len(issues) == 0 {
+			continue
+		}
+		sort.Slice(issues, func(i, j int) bool { return issues[i].ReadableID() < issues[j].ReadableID() })
+		lines := []string{"<b>" + d.Format("Monday, January 2") + "</b>"}
+		for _, issue := range issues {
+			lines = append(lines, s.issueLine(issue))
+		}
+		sections = append(sections, strings.Join(lines, "<br>"))
+		count += len(issues)
+	}
+	week := "Week of " + monday.Format("January 2")
+	switch count {
+	case 0:
+		return week + ": nothing due", "No issues are due next week."
+	case 1:
+		return week + ": 1 issue due", sections[0]
+	default:
+		return fmt.Sprintf("%s: %d issues due", week, count), strings.Join(sections, "<br><br>")
+	}
+}
+
+// isDigestEvent reports whether event is the digest event or one of its
+// occurrences, so that it does not become an issue of its own.
+func (s *Synchronizer) isDigestEvent(event *googlecalendar.Event) bool {
+	if s.WeeklyDigest == nil {
+		return false
+	}
+	for _, id := range []string{event.ID, event.RecurringEventID} {
+		if id == "" {
+			continue
+		}
+		digest, err := s.DB.IsDigestEvent(id)
+		if err != nil {
+			s.logError("Error looking up digest event %s: %v\n", id, err)
+			return true
+		}
+		if digest {
+			return true
+		}
+	}
+	return false
+}
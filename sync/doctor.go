@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Problems of a BrokenLink.
+const (
+	ProblemMissingEvent = "event missing"
+	ProblemMissingIssue = "issue missing"
+	ProblemMissingBoth  = "event and issue missing"
+)
+
+// BrokenLink is a sync item whose event, issue or both no longer exist.
+type BrokenLink struct {
+	Item    *SyncItem
+	Problem string
+}
+
+// Repair fixes a broken link found by Check. A link whose event and issue
+// are both gone is pruned; a missing event or issue is recreated from its
+// surviving counterpart and the link updated in place. It returns a
+// description of what was done.
+func (s *Synchronizer) Repair(link BrokenLink) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.startDryRun(); err != nil {
+		return "", err
+	}
+	if err := s.requireAuth(); err != nil {
+		return "", err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return "", err
+	}
+	if err := s.requireRunning(); err != nil {
+		return "", err
+	}
+
+	switch link.Problem {
+	case ProblemMissingEvent:
+		return s.recreateEvent(link.Item)
+	case ProblemMissingIssue:
+		return s.recreateIssue(link.Item)
+	default:
+		return s.prune(link.Item, "pruned the link")
+	}
+}
+
+func (s *Synchronizer) prune(item *SyncItem, action string) (string, error) {
+	if err := s.DB.DeleteSyncItem(item.ID); err != nil {
+		return "", fmt.Errorf("failed to delete sync item %d: %w", item.ID, err)
+	}
+	return action, nil
+}
+
+// recreateEvent creates a new event for the issue of item. Issues without a
+// due date have no event, so their link is pruned instead.
+func (s *Synchronizer) recreateEvent(item *SyncItem) (string, error) {
+	issue, err := s.YouTrackClient.GetIssue(item.YTID.String)
+	if err != nil {
+		return "", fmt.Errorf("failed to get issue %s: %w", item.YTID.String, err)
+	}
+	dueDate := issueDueDate(*issue)
+	if dueDate.IsZero() {
+		return s.prune(item, "pruned the link, the issue has no due date")
+	}
+	draft, err := s.eventDraft(*issue, dueDate)
+	if err != nil {
+		return "", err
+	}
+	if err := s.runEventHooks(true, issue, draft); err != nil {
+		return "", fmt.Errorf("sync hooks for %s: %w", issue.ID, err)
+	}
+	event, err := s.calendar().CreateEvent(s.CalendarID, "", draft.Summary, draft.Description, draft.Location, draft.Start, draft.End, draft.AllDay, draft.Visibility, draft.Transparency)
+	if err != nil {
+		return "", fmt.Errorf("failed to create event: %w", err)
+	}
+
+	updated, _ := time.Parse(time.RFC3339, event.Updated)
+	item.GCalID = sql.NullString{String: event.Id, Valid: true}
+	item.GCalUpdatedAt = sql.NullTime{Time: updated, Valid: true}
+	item.YTUpdatedAt = sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true}
+	item.DescriptionHash = sql.NullString{String: descriptionHash(draft.Description), Valid: true}
+	item.EventStart = draft.placedStart()
+	if err := s.applyColor(s.calendar(), item, "", draft.ColorID); err != nil {
+		log.Printf("Error coloring Google Calendar event %s: %v\n", event.Id, err)
+	}
+	if err := s.DB.UpdateSyncItem(item); err != nil {
+		return "", fmt.Errorf("failed to update sync item %d: %w", item.ID, err)
+	}
+	return "recreated event " + event.Id, nil
+}
+
+// recreateIssue creates a new issue in YouTrackProjectID for the event of
+// item, as if the event had just been added to the calendar.
+func (s *Synchronizer) recreateIssue(item *SyncItem) (string, error) {
+	event, err := s.calendar().GetEvent(s.CalendarID, item.GCalID.String)
+	if err != nil {
+		return "", fmt.Errorf("failed to get event %s: %w", item.GCalID.String, err)
+	}
+	draft := s.issueDraft(event)
+	if err := s.applyOrganizerAssignee(event, draft); err != nil {
+		return "", err
+	}
+	if err := s.applyDefaultFields(draft); err != nil {
+		return "", err
+	}
+	if err := s.runIssueHooks(true, event, draft); err != nil {
+		return "", fmt.Errorf("sync hooks for %s: %w", event.ID, err)
+	}
+	issue, err := s.youtrack().CreateIssue(s.YouTrackProjectID, draft.Summary, draft.Description, draft.DueDate, draft.CustomFields)
+	if err != nil {
+		return "", fmt.Errorf("failed to create issue: %w", err)
+	}
+	if err := s.addProvenanceComment(issue.ID, event); err != nil {
+		log.Printf("Error commenting on the origin of YouTrack task %s: %v\n", issue.ID, err)
+	}
+	s.addTags(s.youtrack(), issue.ID, append(slices.Clone(s.DefaultTags), draft.Tags...))
+
+	item.YTID = sql.NullString{String: issue.ID, Valid: true}
+	item.YTReadableID = readableID(*issue)
+	item.YTUpdatedAt = sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true}
+	item.GCalUpdatedAt = sql.NullTime{Time: event.Updated, Valid: true}
+	item.ResponseStatus = sql.NullString{}
+	if err := s.DB.UpdateSyncItem(item); err != nil {
+		return "", fmt.Errorf("failed to update sync item %d: %w", item.ID, err)
+	}
+	return "recreated issue " + issue.ReadableID(), nil
+}
@@ -0,0 +1,18 @@
+package sync
+
+import (
+	"time"
+)
+
+// DefaultEchoWindow is the default of EchoWindow.
+const DefaultEchoWindow = 30 * time.Second
+
+// isEcho reports whether an update at updated of an item the synchronizer
+// wrote at written is the echo of that write rather than a change to carry
+// over, i.e. whether it came within EchoWindow. Some setups report their
+// own writes as updates a little later, e.g. Google when it fills in
+// conference data, and carrying those over would ping-pong between both
+// sides.
+func (s *Synchronizer) isEcho(updated, written time.Time) bool {
+	return s.EchoWindow > 0 && !written.IsZero() && !updated.After(written.Add(s.EchoWindow))
+}
@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// ExprHook is a Hook running expr expressions (https://expr-lang.org), so that
+// rules can be configured without Go code. Issue expressions see the event as
+// event and the draft as draft, event expressions the issue as issue. An
+// expression returns nil to write the draft as is, "skip" to skip the item,
+// or a map of the draft fields to change:
+//
+//	lower(event.Summary) contains "incident" ? {type: "Bug", tags: ["ops"]} : nil
+//
+// Issue drafts take summary, description, type, fields (a map of enum
+// fields) and tags, which are added; event drafts take summary,
+// description, location, color, visibility and transparency.
+type ExprHook struct {
+	createIssue, updateIssue *vm.Program
+	createEvent, updateEvent *vm.Program
+}
+
+// ExprHookSources holds the expressions of an ExprHook; empty ones are
+// not run.
+type ExprHookSources struct {
+	CreateIssue string
+	UpdateIssue string
+	CreateEvent string
+	UpdateEvent string
+}
+
+// NewExprHook compiles sources, checking the fields they read. It returns
+// nil when all of them are empty.
+func NewExprHook(sources ExprHookSources) (*ExprHook, error) {
+	issueEnv := map[string]interface{}{"event": &googlecalendar.Event{}, "draft": &IssueDraft{}}
+	eventEnv := map[string]interface{}{"issue": &youtrack.Issue{}, "draft": &EventDraft{}}
+	h := &ExprHook{}
+	for _, p := range []struct {
+		name    string
+		source  string
+		env     map[string]interface{}
+		program **vm.Program
+	}{
+		{"create issue", sources.CreateIssue, issueEnv, &h.createIssue},
+		{"update issue", sources.UpdateIssue, issueEnv, &h.updateIssue},
+		{"create event", sources.CreateEvent, eventEnv, &h.createEvent},
+		{"update event", sources.UpdateEvent, eventEnv, &h.updateEvent},
+	} {
+		if strings.TrimSpace(p.source) == "" {
+			continue
+		}
+		program, err := expr.Compile(p.source, expr.Env(p.env))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s hook: %w", p.name, err)
+		}
+		*p.program = program
+	}
+	if *h == (ExprHook{}) {
+		return nil, nil
+	}
+	return h, nil
+}
+
+func (h *ExprHook) BeforeCreateIssue(event *googlecalendar.Event, draft *IssueDraft) error {
+	return runIssueExpr(h.createIssue, event, draft)
+}
+
+func (h *ExprHook) BeforeUpdateIssue(event *googlecalendar.Event, draft *IssueDraft) error {
+	return runIssueExpr(h.updateIssue, event, draft)
+}
+
+func (h *ExprHook) BeforeCreateEvent(issue *youtrack.Issue, draft *EventDraft) error {
+	return runEventExpr(h.createEvent, issue, draft)
+}
+
+func (h *ExprHook) BeforeUpdateEvent(issue *youtrack.Issue, draft *EventDraft) error {
+	return runEventExpr(h.updateEvent, issue, draft)
+}
+
+func runIssueExpr(program *vm.Program, event *googlecalendar.Event, draft *IssueDraft) error {
+	changes, err := runExpr(program, map[string]interface{}{"event": event, "draft": draft})
+	if err != nil {
+		return err
+	}
+	for key, value := range changes {
+		switch key {
+		case "summary":
+			err = exprString(key, value, &draft.Summary)
+		case "description":
+			err = exprString(key, value, &draft.Description)
+		case "type":
+			var issueType string
+			if err = exprString(key, value, &issueType); err == nil {
+				draft.setField(youtrack.EnumField("Type", issueType))
+			}
+		case "fields":
+			fields, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("hook result fields: expected a map, got %T", value)
+			}
+			for name, v := range fields {
+				var s string
+				if err = exprString("fields."+name, v, &s); err != nil {
+					break
+				}
+				draft.setField(youtrack.EnumField(name, s))
+			}
+		case "tags":
+			tags, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("hook result tags: expected a list, got %T", value)
+			}
+			for _, v := range tags {
+				var tag string
+				if err = exprString(key, v, &tag); err != nil {
+					break
+				}
+				draft.Tags = append(draft.Tags, tag)
+			}
+		default:
+			return fmt.Errorf("hook result: unknown issue field %q", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runEventExpr(program *vm.Program, issue *youtrack.Issue, draft *EventDraft) error {
+	changes, err := runExpr(program, map[string]interface{}{"issue": issue, "draft": draft})
+	if err != nil {
+		return err
+	}
+	for key, value := range changes {
+		fields := map[string]*string{
+			"summary":      &draft.Summary,
+			"description":  &draft.Description,
+			"location":     &draft.Location,
+			"color":        &draft.ColorID,
+			"visibility":   &draft.Visibility,
+			"transparency": &draft.Transparency,
+		}
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("hook result: unknown event field %q", key)
+		}
+		if err := exprString(key, value, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runExpr runs program, if any, and returns the changes it asks for. It
+// returns ErrSkip for "skip".
+func runExpr(program *vm.Program, env map[string]interface{}) (map[string]interface{}, error) {
+	if program == nil {
+		return nil, nil
+	}
+	result, err := expr.Run(program, env)
+	if err != nil {
+		return nil, fmt.Errorf("hook expression: %w", err)
+	}
+	switch result := result.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if result == "skip" {
+			return nil, ErrSkip
+		}
+	case map[string]interface{}:
+		return result, nil
+	}
+	return nil, fmt.Errorf("hook expression returned %v, expected nil, \"skip\" or a map", result)
+}
+
+func exprString(key string, value interface{}, dest *string) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("hook result %s: expected a string, got %T", key, value)
+	}
+	*dest = s
+	return nil
+}
+
+// setField sets field on d, replacing a value of the same field.
+func (d *IssueDraft) setField(field youtrack.CustomFieldWrapper) {
+	for i, f := range d.CustomFields {
+		if f.Name == field.Name {
+			d.CustomFields[i] = field
+			return
+		}
+	}
+	d.CustomFields = append(d.CustomFields, field)
+}
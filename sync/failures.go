@@ -0,0 +1,95 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"youtrack-calendar-sync/httpclient"
+)
+
+// ErrorAction is what the synchronizer does about a failed request.
+type ErrorAction string
+
+const (
+	// ErrorActionRetry ends the pass, leaving the rest to the next one: the
+	// service is rate limiting or failing, and further requests would fail
+	// as well.
+	ErrorActionRetry ErrorAction = "retry"
+	// ErrorActionReauth ends the pass: the credentials were rejected, so
+	// every request would fail until they are renewed.
+	ErrorActionReauth ErrorAction = "reauth"
+	// ErrorActionSkip skips the item, which no longer exists.
+	ErrorActionSkip ErrorAction = "skip"
+	// ErrorActionAlert records the failure for a person to look at and
+	// goes on with the next item; retrying the same request would not help.
+	ErrorActionAlert ErrorAction = "alert"
+)
+
+// ClassifyError returns what to do about err, going by the error types of
+// httpclient.APIError.
+func ClassifyError(err error) ErrorAction {
+	var authErr *httpclient.AuthError
+	var apiErr *httpclient.APIError
+	switch {
+	case errors.Is(err, ErrReauthRequired):
+		return ErrorActionReauth
+	case errors.Is(err, context.Canceled):
+		// Stop canceled the queries of the pass.
+		return ErrorActionRetry
+	case errors.As(err, &authErr):
+		// 403 denies a single request, e.g. writing to a calendar that is
+		// not shared for writing, rather than the credentials.
+		if authErr.Status == http.StatusForbidden {
+			return ErrorActionAlert
+		}
+		return ErrorActionReauth
+	case errors.As(err, new(*httpclient.RateLimitError)):
+		return ErrorActionRetry
+	case errors.As(err, new(*httpclient.CircuitOpenError)):
+		// The backend kept failing; the next pass probes it again.
+		return ErrorActionRetry
+	case errors.As(err, new(*httpclient.NotFoundError)):
+		return ErrorActionSkip
+	case errors.As(err, &apiErr) && apiErr.Status >= http.StatusInternalServerError:
+		return ErrorActionRetry
+	}
+	return ErrorActionAlert
+}
+
+// haltOn ends the current pass after err if ClassifyError tells so, see
+// halted. YouTrack being unreachable does not end it while its writes are
+// queued, see Outbox.
+func (s *Synchronizer) haltOn(err error) {
+	if s.halt != nil || s.youTrackDown(err) {
+		return
+	}
+	switch ClassifyError(err) {
+	case ErrorActionRetry, ErrorActionReauth:
+		s.halt = err
+	}
+}
+
+// halted returns the error that ends the current pass, or nil to go on.
+func (s *Synchronizer) halted() error {
+	if s.halt == nil {
+		return nil
+	}
+	return fmt.Errorf("synchronization stopped, the next pass retries: %w", s.halt)
+}
+
+// backOff waits for as long as a rate limit that ended the pass with err
+// asked, unless Stop is called first.
+func (s *Synchronizer) backOff(err error) {
+	var rateLimit *httpclient.RateLimitError
+	if !errors.As(err, &rateLimit) || rateLimit.RetryAfter <= 0 {
+		return
+	}
+	log.Printf("%s is rate limiting, waiting %s\n", rateLimit.Service, rateLimit.RetryAfter)
+	select {
+	case <-s.clock().After(rateLimit.RetryAfter):
+	case <-s.stop:
+	}
+}
@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// HolidayAction determines what happens to the events of issues due on a
+// holiday.
+type HolidayAction string
+
+const (
+	// HolidayActionFlag leaves the event on the holiday and notes it in the
+	// event description.
+	HolidayActionFlag HolidayAction = "flag"
+	// HolidayActionShift moves the event to the business day before, i.e.
+	// the last day that is neither a holiday nor on a weekend, and notes
+	// the actual deadline in the event description.
+	HolidayActionShift HolidayAction = "shift"
+)
+
+// ParseHolidayAction parses a HolidayAction. An empty value yields
+// HolidayActionFlag.
+func ParseHolidayAction(value string) (HolidayAction, error) {
+	switch action := HolidayAction(strings.ToLower(strings.TrimSpace(value))); action {
+	case "":
+		return HolidayActionFlag, nil
+	case HolidayActionFlag, HolidayActionShift:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown holiday action %q", value)
+	}
+}
+
+// maxHolidayShift bounds how many days an event is moved back, in case a
+// calendar marks every day as a holiday.
+const maxHolidayShift = 14
+
+// Holidays flags or shifts the events written from issues that fall on a
+// holiday of a holiday calendar, such as Google's public holiday calendar
+// "en.usa#holiday@group.v.calendar.google.com". Like with WorkingHours,
+// only the events move: the due dates of their issues are unchanged.
+type Holidays struct {
+	// CalendarID is the calendar whose all-day events are the holidays.
+	CalendarID string
+	Action     HolidayAction
+
+	mu gosync.Mutex
+	// years holds the holidays of the years read so far, by date. Holiday
+	// calendars are read once a year per process.
+	years map[int]map[string]string
+}
+
+// holiday returns the name of the holiday on the date of day, or "" if
+// there is none.
+func (s *Synchronizer) holiday(day time.Time) (string, error) {
+	h := s.Holidays
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	date := day.Format("2006-01-02")
+	if days, ok := h.years[day.Year()]; ok {
+		return days[date], nil
+	}
+
+	from := time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	events, err := s.calendar().ListEvents(h.CalendarID, from, from.AddDate(1, 0, 0))
+	if err != nil {
+		return "", fmt.Errorf("failed to read holidays from %s: %w", h.CalendarID, err)
+	}
+	days := make(map[string]string)
+	for _, event := range events {
+		if !event.AllDay || event.Status == "cancelled" {
+			continue
+		}
+		// The end of an all-day event is the day after its last.
+		for d := event.Start; d.Before(event.End) || d.Equal(event.Start); d = d.AddDate(0, 0, 1) {
+			days[d.Format("2006-01-02")] = event.Summary
+		}
+	}
+	if h.years == nil {
+		h.years = make(map[int]map[string]string)
+	}
+	h.years[day.Year()] = days
+	return days[date], nil
+}
+
+// placeOnBusinessDay applies Holidays to an event from start to end written
+// for an issue due at dueDate. It returns the start and end of the event,
+// shifted with HolidayActionShift, and the note to add to its description,
+// which is empty unless the event fell on a holiday.
+func (s *Synchronizer) placeOnBusinessDay(start, end, dueDate time.Time) (time.Time, time.Time, string, error) {
+	if s.Holidays == nil || s.Holidays.CalendarID == "" {
+		return start, end, "", nil
+	}
+	name, err := s.holiday(start)
+	if err != nil || name == "" {
+		return start, end, "", err
+	}
+	if s.Holidays.Action != HolidayActionShift {
+		return start, end, fmt.Sprintf("<br><i>Due on a holiday: %s.</i>", name), nil
+	}
+
+	shifted := start
+	for i := 0; i < maxHolidayShift; i++ {
+		shifted = shifted.AddDate(0, 0, -1)
+		if weekday := shifted.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+			continue
+		}
+		other, err := s.holiday(shifted)
+		if err != nil {
+			return start, end, "", err
+		}
+		if other == "" {
+			note := fmt.Sprintf("<br><i>Deadline: due %s, a holiday (%s), shown on the business day before.</i>", dueDate.Format("Mon Jan 2 2006"), name)
+			return shifted, shifted.Add(end.Sub(start)), note, nil
+		}
+	}
+	return start, end, fmt.Sprintf("<br><i>Due on a holiday: %s.</i>", name), nil
+}
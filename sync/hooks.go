@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// ErrSkip may be returned by a Hook to leave the item untouched for this pass.
+var ErrSkip = errors.New("skipped by hook")
+
+// IssueDraft holds the issue fields about to be written from a calendar event.
+type IssueDraft struct {
+	Summary     string
+	Description string
+	DueDate     *time.Time
+	// CustomFields are set when the issue is created; they are ignored on update.
+	CustomFields []youtrack.CustomFieldWrapper
+	// Tags are added to the issue, see TagSync.ParseHashtags.
+	Tags []string
+}
+
+// EventDraft holds the event fields about to be written from a YouTrack issue.
+type EventDraft struct {
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	// AllDay writes an all-day event covering the days of Start to End.
+	AllDay bool
+	// Visibility and Transparency are Google event settings; empty leaves
+	// them unchanged.
+	Visibility   string
+	Transparency string
+	// ColorID is the event color, see TagSync.Colors; empty leaves a color
+	// chosen by hand.
+	ColorID string
+	// Patch sets fields the draft has none for, such as reminders or guest
+	// permissions, once the event is written; see
+	// googlecalendar.Client.PatchEvent. Nil patches nothing.
+	Patch *calendar.Event
+}
+
+// placedStart returns the start of the event written from d as Google
+// reports it: all-day events start at midnight UTC, and timed events are
+// written to the second.
+func (d *EventDraft) placedStart() sql.NullTime {
+	start := d.Start.Truncate(time.Second)
+	if d.AllDay {
+		start, _ = time.Parse("2006-01-02", d.Start.Format("2006-01-02"))
+	}
+	return sql.NullTime{Time: start, Valid: true}
+}
+
+// applyPatch writes the Patch of draft to the event of item through gc.
+func (s *Synchronizer) applyPatch(gc GCalClient, item *SyncItem, draft *EventDraft) error {
+	if draft.Patch == nil {
+		return nil
+	}
+	event, err := gc.PatchEvent(s.CalendarID, item.GCalID.String, draft.Patch)
+	if err != nil || event == nil {
+		return err
+	}
+	if updated, err := time.Parse(time.RFC3339, event.Updated); err == nil {
+		item.GCalUpdatedAt = sql.NullTime{Time: updated, Valid: true}
+	}
+	return nil
+}
+
+// Hook lets callers transform items before the synchronizer writes them.
+// Hooks may read any field of an event from its Raw API event, and modify
+// the draft in place; returning ErrSkip skips the item and
+// any other error is logged and skips it as well.
+type Hook interface {
+	BeforeCreateIssue(event *googlecalendar.Event, draft *IssueDraft) error
+	BeforeCreateEvent(issue *youtrack.Issue, draft *EventDraft) error
+	BeforeUpdateIssue(event *googlecalendar.Event, draft *IssueDraft) error
+	BeforeUpdateEvent(issue *youtrack.Issue, draft *EventDraft) error
+}
+
+// HookFuncs adapts plain functions to the Hook interface. Nil functions are
+// no-ops.
+type HookFuncs struct {
+	CreateIssue func(event *googlecalendar.Event, draft *IssueDraft) error
+	CreateEvent func(issue *youtrack.Issue, draft *EventDraft) error
+	UpdateIssue func(event *googlecalendar.Event, draft *IssueDraft) error
+	UpdateEvent func(issue *youtrack.Issue, draft *EventDraft) error
+}
+
+func (h HookFuncs) BeforeCreateIssue(event *googlecalendar.Event, draft *IssueDraft) error {
+	if h.CreateIssue == nil {
+		return nil
+	}
+	return h.CreateIssue(event, draft)
+}
+
+func (h HookFuncs) BeforeCreateEvent(issue *youtrack.Issue, draft *EventDraft) error {
+	if h.CreateEvent == nil {
+		return nil
+	}
+	return h.CreateEvent(issue, draft)
+}
+
+func (h HookFuncs) BeforeUpdateIssue(event *googlecalendar.Event, draft *IssueDraft) error {
+	if h.UpdateIssue == nil {
+		return nil
+	}
+	return h.UpdateIssue(event, draft)
+}
+
+func (h HookFuncs) BeforeUpdateEvent(issue *youtrack.Issue, draft *EventDraft) error {
+	if h.UpdateEvent == nil {
+		return nil
+	}
+	return h.UpdateEvent(issue, draft)
+}
+
+// runIssueHooks runs the configured hooks for an issue draft in order,
+// stopping at the first error.
+func (s *Synchronizer) runIssueHooks(create bool, event *googlecalendar.Event, draft *IssueDraft) error {
+	for _, hook := range s.Hooks {
+		var err error
+		if create {
+			err = hook.BeforeCreateIssue(event, draft)
+		} else {
+			err = hook.BeforeUpdateIssue(event, draft)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runEventHooks runs the configured hooks for an event draft in order,
+// stopping at the first error.
+func (s *Synchronizer) runEventHooks(create bool, issue *youtrack.Issue, draft *EventDraft) error {
+	for _, hook := range s.Hooks {
+		var err error
+		if create {
+			err = hook.BeforeCreateEvent(issue, draft)
+		} else {
+			err = hook.BeforeUpdateEvent(issue, draft)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"strings"
+
+	"youtrack-calendar-sync/googlecalendar"
+)
+
+// IgnoredEvents selects events written by other automations, such as
+// Calendly, Zoom or another sync tool, so that they never become issues and
+// cannot start a loop between tools.
+type IgnoredEvents struct {
+	// Senders are emails, or domains such as @calendly.com, matched against
+	// the organizer and the creator of events.
+	Senders []string
+	// Properties are extended property keys, or key=value pairs, matched
+	// against the private and shared extended properties of events.
+	Properties []string
+}
+
+// matches reports whether event is ignored.
+func (ig *IgnoredEvents) matches(event *googlecalendar.Event) bool {
+	if ig == nil {
+		return false
+	}
+	for _, sender := range ig.Senders {
+		for _, email := range []string{event.Organizer, event.Creator} {
+			if email != "" && senderMatches(sender, email) {
+				return true
+			}
+		}
+	}
+	for _, property := range ig.Properties {
+		key, value, hasValue := strings.Cut(property, "=")
+		if actual, ok := event.Properties[key]; ok && (!hasValue || actual == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// senderMatches reports whether email is sender, or in the domain of a
+// sender starting with @.
+func senderMatches(sender, email string) bool {
+	if strings.HasPrefix(sender, "@") {
+		return strings.HasSuffix(strings.ToLower(email), strings.ToLower(sender))
+	}
+	return strings.EqualFold(sender, email)
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+)
+
+// ImportResult sums up an ImportEvents run.
+type ImportResult struct {
+	// Events is the number of events in the range, each occurrence of a
+	// recurring event counted on its own.
+	Events   int `json:"events"`
+	Imported int `json:"imported"`
+	// Skipped counts the events that were linked already or are left out
+	// of the sync, e.g. by EventMarker or IgnoredEvents.
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors"`
+}
+
+// ImportEvents creates an issue in the project projectID, or YouTrackProjectID
+// if empty, for every unlinked event that overlaps from to to, and links the
+// pairs. Recurring events are expanded into their occurrences, each of which
+// gets an issue of its own, and every issue is commented on with a link to
+// its event. Unlike a pass, it ignores StartDate and leaves the sync cursors
+// alone; linked events are not updated. progress, if not nil, is called after
+// each event with the number of events handled so far.
+func (s *Synchronizer) ImportEvents(from, to time.Time, projectID string, progress func(done, total int)) (ImportResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beginResult()
+	defer s.endResult()
+	result := ImportResult{Errors: []string{}}
+	if err := s.startDryRun(); err != nil {
+		return result, err
+	}
+	if err := s.requireAuth(); err != nil {
+		return result, err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return result, err
+	}
+	if err := s.requireRunning(); err != nil {
+		return result, err
+	}
+
+	events, err := s.calendar().ListEvents(s.CalendarID, from, to)
+	if err != nil {
+		return result, fmt.Errorf("failed to list Google Calendar events: %w", err)
+	}
+	result.Events = len(events)
+	log.Printf("Importing %d events from %s to %s\n", len(events), from.Format(time.DateOnly), to.Format(time.DateOnly))
+
+	defer func(projectID string, startDate time.Time, provenance bool) {
+		s.YouTrackProjectID, s.StartDate, s.ProvenanceComment = projectID, startDate, provenance
+	}(s.YouTrackProjectID, s.StartDate, s.ProvenanceComment)
+	if projectID != "" {
+		s.YouTrackProjectID = projectID
+	}
+	s.StartDate, s.ProvenanceComment = time.Time{}, true
+
+	for i, event := range events {
+		if err := s.importEvent(event, &result); err != nil {
+			return result, err
+		}
+		if progress != nil {
+			progress(i+1, len(events))
+		}
+	}
+	log.Printf("Imported %d of %d events, %d skipped, %d failed\n", result.Imported, result.Events, result.Skipped, len(result.Errors))
+	return result, nil
+}
+
+// importEvent creates and links the issue of event, unless it is linked
+// already, and records the outcome in result.
+func (s *Synchronizer) importEvent(event *googlecalendar.Event, result *ImportResult) error {
+	item, err := s.DB.GetSyncItemByGCalID(event.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get sync item for GCal event %s: %w", event.ID, err)
+	}
+	if item != nil {
+		result.Skipped++
+		return nil
+	}
+
+	created, failed := s.result.Counts.IssuesCreated, len(s.result.Errors)
+	if err := s.processGCalEvents([]*googlecalendar.Event{event}); err != nil {
+		return err
+	}
+	switch {
+	case s.result.Counts.IssuesCreated > created:
+		result.Imported++
+	case len(s.result.Errors) > failed:
+		result.Errors = append(result.Errors, s.result.Errors[failed:]...)
+	default:
+		result.Skipped++
+	}
+	return nil
+}
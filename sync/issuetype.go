@@ -0,0 +1,47 @@
+package sync
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"youtrack-calendar-sync/googlecalendar"
+)
+
+// IssueTypeRule selects the Type of issues created from events whose summary
+// matches Pattern.
+type IssueTypeRule struct {
+	Pattern *regexp.Regexp
+	Type    string
+}
+
+// ParseIssueTypeRules parses semicolon-separated "regexp=Type" rules, e.g.
+// "(?i)standup|sync=Meeting;(?i)incident=Bug". Rules are tried in order.
+func ParseIssueTypeRules(spec string) ([]IssueTypeRule, error) {
+	var rules []IssueTypeRule
+	for _, part := range strings.Split(spec, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		i := strings.LastIndex(part, "=")
+		if i <= 0 || i == len(part)-1 {
+			return nil, fmt.Errorf("invalid issue type rule %q, expected regexp=Type", part)
+		}
+		pattern, err := regexp.Compile(part[:i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid issue type rule %q: %w", part, err)
+		}
+		rules = append(rules, IssueTypeRule{Pattern: pattern, Type: strings.TrimSpace(part[i+1:])})
+	}
+	return rules, nil
+}
+
+// issueType returns the Type for an issue created from event.
+func (s *Synchronizer) issueType(event *googlecalendar.Event) string {
+	for _, rule := range s.IssueTypeRules {
+		if rule.Pattern.MatchString(event.Summary) {
+			return rule.Type
+		}
+	}
+	return s.IssueType
+}
@@ -0,0 +1,295 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Errors returned by EditItem for edits that contradict themselves, and by
+// EditItem and Link for linking an event or issue that belongs to another
+// item.
+var (
+	ErrInvalidEdit = errors.New("invalid edit")
+	ErrLinked      = errors.New("linked to another item")
+)
+
+// Sides of an item that ItemEdit.Win makes win.
+const (
+	WinYouTrack = "youtrack"
+	WinCalendar = "calendar"
+)
+
+// ItemInfo is the stored state of a sync item.
+type ItemInfo struct {
+	ID     int    `json:"id"`
+	GCalID string `json:"gcalId"`
+	YTID   string `json:"ytId"`
+	// GCalUpdatedAt and YTUpdatedAt are the update times of the event and
+	// the issue when they were last synced; nil makes the next sync carry
+	// that side over.
+	GCalUpdatedAt *time.Time `json:"gcalUpdatedAt,omitempty"`
+	YTUpdatedAt   *time.Time `json:"ytUpdatedAt,omitempty"`
+	YTWrittenAt   *time.Time `json:"ytWrittenAt,omitempty"`
+	EventStart    *time.Time `json:"eventStart,omitempty"`
+	Version       int        `json:"version"`
+}
+
+// ItemEdit repairs a single sync item, see EditItem.
+type ItemEdit struct {
+	// Unlink deletes the item, leaving its event and issue alone. A later
+	// change to either may then create a new counterpart for it.
+	Unlink bool `json:"unlink,omitempty"`
+	// GCalID and YTID, if set, link the item to another event or issue,
+	// given by its ID or readable ID.
+	GCalID string `json:"gcalId,omitempty"`
+	YTID   string `json:"ytId,omitempty"`
+	// Win, WinYouTrack or WinCalendar, overwrites the other side with the
+	// content of that side, whether or not it changed.
+	Win string `json:"win,omitempty"`
+}
+
+// info returns the state of item shown by ItemInfo.
+func (item *SyncItem) info() ItemInfo {
+	stamp := func(t sql.NullTime) *time.Time {
+		if !t.Valid {
+			return nil
+		}
+		return &t.Time
+	}
+	return ItemInfo{
+		ID:            item.ID,
+		GCalID:        item.GCalID.String,
+		YTID:          item.YTID.String,
+		GCalUpdatedAt: stamp(item.GCalUpdatedAt),
+		YTUpdatedAt:   stamp(item.YTUpdatedAt),
+		YTWrittenAt:   stamp(item.YTWrittenAt),
+		EventStart:    stamp(item.EventStart),
+		Version:       item.Version,
+	}
+}
+
+// Item returns the stored state of the sync item id, or ErrNotFound.
+func (s *Synchronizer) Item(id int) (ItemInfo, error) {
+	item, err := s.DB.GetSyncItem(id)
+	if err != nil {
+		return ItemInfo{}, err
+	}
+	return item.info(), nil
+}
+
+// EditItem applies edit to the sync item id and returns its new state,
+// which is empty once unlinked. Relinking checks that the event or issue
+// exists and resets the stamps of that side, so a pass does not take it as
+// synced. Neither the event nor the issue is written without Win.
+func (s *Synchronizer) EditItem(id int, edit ItemEdit) (ItemInfo, error) {
+	if edit.Win != "" && edit.Win != WinYouTrack && edit.Win != WinCalendar {
+		return ItemInfo{}, fmt.Errorf("%w: unknown side %q, expected %s or %s", ErrInvalidEdit, edit.Win, WinYouTrack, WinCalendar)
+	}
+	if !edit.Unlink && edit.GCalID == "" && edit.YTID == "" && edit.Win == "" {
+		return ItemInfo{}, fmt.Errorf("%w: set unlink, gcalId, ytId or win", ErrInvalidEdit)
+	}
+	if edit.Unlink && (edit.GCalID != "" || edit.YTID != "" || edit.Win != "") {
+		return ItemInfo{}, fmt.Errorf("%w: an unlinked item cannot be relinked or overwritten", ErrInvalidEdit)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.startDryRun(); err != nil {
+		return ItemInfo{}, err
+	}
+	item, err := s.DB.GetSyncItem(id)
+	if err != nil {
+		return ItemInfo{}, err
+	}
+	if edit.Unlink {
+		log.Printf("Unlinking event %s from YouTrack task %s\n", item.GCalID.String, item.YTID.String)
+		return ItemInfo{}, s.DB.DeleteSyncItem(item.ID)
+	}
+	if err := s.requireAuth(); err != nil {
+		return ItemInfo{}, err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return ItemInfo{}, err
+	}
+
+	if edit.YTID != "" || edit.GCalID != "" {
+		if err := s.relinkItem(item, edit.GCalID, edit.YTID); err != nil {
+			return ItemInfo{}, err
+		}
+	}
+	if edit.Win != "" {
+		if err := s.forceItem(item, edit.Win); err != nil {
+			return ItemInfo{}, err
+		}
+		if item, err = s.DB.GetSyncItem(id); err != nil {
+			return ItemInfo{}, err
+		}
+	}
+	return item.info(), nil
+}
+
+// Link links the issue ytID, given by its ID or readable ID, to the event
+// gcalID, neither of which may be linked yet, and returns the new item. Their
+// current update times are recorded, so neither side is written until one of
+// them changes.
+func (s *Synchronizer) Link(ytID, gcalID string) (ItemInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.startDryRun(); err != nil {
+		return ItemInfo{}, err
+	}
+	if err := s.requireAuth(); err != nil {
+		return ItemInfo{}, err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return ItemInfo{}, err
+	}
+	issue, err := s.unlinkedIssue(ytID)
+	if err != nil {
+		return ItemInfo{}, err
+	}
+	event, err := s.unlinkedEvent(gcalID)
+	if err != nil {
+		return ItemInfo{}, err
+	}
+
+	item := &SyncItem{
+		GCalID:        sql.NullString{String: event.ID, Valid: true},
+		YTID:          sql.NullString{String: issue.ID, Valid: true},
+		YTReadableID:  readableID(*issue),
+		GCalUpdatedAt: sql.NullTime{Time: event.Updated, Valid: true},
+		YTUpdatedAt:   sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true},
+	}
+	id, err := s.DB.CreateSyncItem(item)
+	if err != nil {
+		return ItemInfo{}, fmt.Errorf("failed to link event %s to issue %s: %w", event.ID, issue.ID, err)
+	}
+	item.ID = int(id)
+	log.Printf("Linked event %s to YouTrack task %s\n", event.ID, issue.ID)
+	return item.info(), nil
+}
+
+// relinkItem links item to the event gcalID and the issue ytID, those that
+// are set.
+func (s *Synchronizer) relinkItem(item *SyncItem, gcalID, ytID string) error {
+	if ytID != "" {
+		issue, err := s.unlinkedIssue(ytID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Relinking sync item %d from YouTrack task %s to %s\n", item.ID, item.YTID.String, issue.ID)
+		item.YTID = sql.NullString{String: issue.ID, Valid: true}
+		item.YTReadableID = readableID(*issue)
+		item.YTUpdatedAt, item.YTHash, item.YTWrittenAt = sql.NullTime{}, sql.NullString{}, sql.NullTime{}
+		item.ResponseStatus, item.DependencyWarning = sql.NullString{}, sql.NullString{}
+	}
+	if gcalID != "" {
+		event, err := s.unlinkedEvent(gcalID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Relinking sync item %d from event %s to %s\n", item.ID, item.GCalID.String, event.ID)
+		item.GCalID = sql.NullString{String: event.ID, Valid: true}
+		item.GCalUpdatedAt, item.GCalHash, item.EventStart = sql.NullTime{}, sql.NullString{}, sql.NullTime{}
+		item.DescriptionHash, item.ConflictWarning = sql.NullString{}, sql.NullString{}
+	}
+	return s.DB.UpdateSyncItem(item)
+}
+
+// unlinkedIssue returns the issue ytID, which must exist and have no sync
+// item.
+func (s *Synchronizer) unlinkedIssue(ytID string) (*youtrack.Issue, error) {
+	issue, err := s.YouTrackClient.GetIssue(ytID)
+	if errors.Is(err, youtrack.ErrNotFound) {
+		return nil, fmt.Errorf("issue %s: %w", ytID, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get issue %s: %w", ytID, err)
+	}
+	if err := s.requireUnlinked(s.DB.GetSyncItemByYTID(issue.ID)); err != nil {
+		return nil, fmt.Errorf("issue %s: %w", ytID, err)
+	}
+	return issue, nil
+}
+
+// unlinkedEvent returns the event gcalID, which must exist and have no sync
+// item.
+func (s *Synchronizer) unlinkedEvent(gcalID string) (*googlecalendar.Event, error) {
+	event, err := s.calendar().GetEvent(s.CalendarID, gcalID)
+	if errors.Is(err, googlecalendar.ErrNotFound) || err == nil && event.Status == "cancelled" {
+		return nil, fmt.Errorf("event %s: %w", gcalID, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get event %s: %w", gcalID, err)
+	}
+	if err := s.requireUnlinked(s.DB.GetSyncItemByGCalID(event.ID)); err != nil {
+		return nil, fmt.Errorf("event %s: %w", gcalID, err)
+	}
+	return event, nil
+}
+
+// requireUnlinked checks the result of looking up the sync item of the
+// event or issue to relink to, which must have none.
+func (s *Synchronizer) requireUnlinked(other *SyncItem, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w %d", ErrLinked, other.ID)
+}
+
+// forceItem writes the content of the side win of item to the other side,
+// as if only that side had changed since the last sync.
+func (s *Synchronizer) forceItem(item *SyncItem, win string) error {
+	if err := s.requireRunning(); err != nil {
+		return err
+	}
+	event, err := s.calendar().GetEvent(s.CalendarID, item.GCalID.String)
+	if err != nil {
+		return fmt.Errorf("failed to get event %s: %w", item.GCalID.String, err)
+	}
+	issue, err := s.YouTrackClient.GetIssue(item.YTID.String)
+	if err != nil {
+		return fmt.Errorf("failed to get issue %s: %w", item.YTID.String, err)
+	}
+
+	s.beginResult()
+	defer s.endResult()
+	// The description and the placement of the event are rewritten as well.
+	item.DescriptionHash = sql.NullString{}
+	if win == WinYouTrack {
+		item.GCalUpdatedAt = sql.NullTime{Time: event.Updated, Valid: true}
+		item.GCalHash = syncedHash(eventHash(event))
+		item.YTUpdatedAt, item.YTHash, item.YTWrittenAt = sql.NullTime{}, sql.NullString{}, sql.NullTime{}
+	} else {
+		item.YTUpdatedAt = sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true}
+		item.YTHash = syncedHash(issueHash(*issue))
+		item.GCalUpdatedAt, item.GCalHash, item.EventStart = sql.NullTime{}, sql.NullString{}, sql.NullTime{}
+	}
+	if err := s.DB.UpdateSyncItem(item); err != nil {
+		return err
+	}
+
+	log.Printf("Overwriting sync item %d from the %s side\n", item.ID, win)
+	if win == WinYouTrack {
+		err = s.processYTissues([]youtrack.Issue{*issue})
+	} else {
+		// The event may have been written by the synchronizer just before;
+		// it is copied over all the same.
+		event.WrittenAt = time.Time{}
+		err = s.processGCalEvents([]*googlecalendar.Event{event})
+	}
+	if err == nil && len(s.result.Errors) > 0 {
+		err = errors.New(strings.Join(s.result.Errors, "; "))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to overwrite sync item %d: %w", item.ID, err)
+	}
+	return nil
+}
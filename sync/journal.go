@@ -0,0 +1,379 @@
+package sync
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// journalInFlight bounds how long a journaled write can take, retries
+// included. Entries of other runs younger than it may belong to a write
+// still running in another process sharing the state.
+const journalInFlight = 10 * time.Minute
+
+// journalMaxAge bounds the age of the entries replayed. Older ones are
+// dropped, as the items they write have likely changed since.
+const journalMaxAge = 24 * time.Hour
+
+// JournalEntry is a write to Google Calendar or YouTrack that was started
+// but not seen to return. Entries left by a process that stopped during the
+// write are replayed, see recoverJournal.
+type JournalEntry struct {
+	ID     int64
+	Change Change
+	// Owner is the run of the synchronizer that started the write.
+	Owner     string
+	StartedAt time.Time
+}
+
+// newRunID returns a random ID for the journal entries of a run.
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// Any ID that is not reused will do.
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// BeginOperation records the intent of the run owner to make change and
+// returns the ID of its journal entry.
+func (db *DB) BeginOperation(owner string, change Change) (int64, error) {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return 0, err
+	}
+	query := "INSERT INTO journal (target, action, item_id, payload, started_at, owner) VALUES (?, ?, ?, ?, ?, ?) RETURNING id"
+	return db.insert(query, change.Target, change.Action, change.ID, string(payload), db.now().UTC(), owner)
+}
+
+// CompleteOperation removes the journal entry id once its write returned.
+func (db *DB) CompleteOperation(id int64) error {
+	_, err := db.exec("DELETE FROM journal WHERE id = ?", id)
+	return err
+}
+
+// IncompleteOperations returns the journal entries of other runs than
+// owner started before before, oldest first.
+func (db *DB) IncompleteOperations(owner string, before time.Time) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	query := "SELECT id, payload, COALESCE(owner, ''), started_at FROM journal WHERE COALESCE(owner, '') <> ? AND started_at < ? ORDER BY id"
+	err := db.each(query, []interface{}{owner, before.UTC()}, func(rows *sql.Rows) error {
+		var e JournalEntry
+		var payload string
+		if err := rows.Scan(&e.ID, &payload, &e.Owner, &e.StartedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(payload), &e.Change); err != nil {
+			return fmt.Errorf("journal entry %d: %w", e.ID, err)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// journal runs write, recording change in the journal for as long as it
+// has not returned, and then in the result if it succeeded. Creations set
+// the ID of change to that of the created item.
+func (s *Synchronizer) journal(change *Change, write func() error) error {
+	id, err := s.DB.BeginOperation(s.runID, *change)
+	if err != nil {
+		return fmt.Errorf("failed to journal %s %s: %w", change.Target, change.Action, err)
+	}
+	err = write()
+	if err := s.DB.CompleteOperation(id); err != nil {
+		log.Printf("Error completing journal entry %d: %v\n", id, err)
+	}
+	if err == nil {
+		s.recordOutcome(change.Target, change.Action, change.ID)
+	}
+	return err
+}
+
+// youtrack returns the YouTrack client, journaling its writes and queueing
+// them while YouTrack is unreachable, see Outbox.
+func (s *Synchronizer) youtrack() YTClient {
+	return queuedYouTrack{YTClient: journaledYouTrack{YTClient: s.YouTrackClient, s: s}, s: s}
+}
+
+// journaledCalendar journals the calendar writes of the synchronizer.
+type journaledCalendar struct {
+	GCalClient
+	s *Synchronizer
+}
+
+func (j journaledCalendar) CreateEvent(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (event *calendar.Event, err error) {
+	change := Change{Target: ChangeTargetGoogle, Action: "create", ID: eventID, CalendarID: calendarID, Summary: nonEmpty(summary)}
+	err = j.s.journal(&change, func() error {
+		event, err = j.GCalClient.CreateEvent(calendarID, eventID, summary, description, location, start, end, allDay, visibility, transparency)
+		if err == nil {
+			change.ID = event.Id
+		}
+		return err
+	})
+	return event, err
+}
+
+func (j journaledCalendar) UpdateEvent(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (event *calendar.Event, err error) {
+	change := Change{Target: ChangeTargetGoogle, Action: "update", ID: eventID, CalendarID: calendarID,
+		Summary: summary, Description: description, Location: location, Start: &start, End: &end,
+		AllDay: allDay, Visibility: visibility, Transparency: transparency}
+	err = j.s.journal(&change, func() error {
+		event, err = j.GCalClient.UpdateEvent(calendarID, eventID, summary, description, location, start, end, allDay, visibility, transparency)
+		return err
+	})
+	return event, err
+}
+
+func (j journaledCalendar) MoveEvent(calendarID, eventID, destinationCalendarID string) (event *calendar.Event, err error) {
+	change := Change{Target: ChangeTargetGoogle, Action: "move", ID: eventID, CalendarID: calendarID, Destination: destinationCalendarID}
+	err = j.s.journal(&change, func() error {
+		event, err = j.GCalClient.MoveEvent(calendarID, eventID, destinationCalendarID)
+		return err
+	})
+	return event, err
+}
+
+func (j journaledCalendar) SetColor(calendarID, eventID, colorID string) (event *calendar.Event, err error) {
+	change := Change{Target: ChangeTargetGoogle, Action: "color", ID: eventID, CalendarID: calendarID, Color: colorID}
+	err = j.s.journal(&change, func() error {
+		event, err = j.GCalClient.SetColor(calendarID, eventID, colorID)
+		return err
+	})
+	return event, err
+}
+
+func (j journaledCalendar) SetRecurrence(calendarID, eventID string, start, end time.Time, recurrence []string) (event *calendar.Event, err error) {
+	change := Change{Target: ChangeTargetGoogle, Action: "recur", ID: eventID, CalendarID: calendarID, Start: &start, End: &end, Recurrence: recurrence}
+	err = j.s.journal(&change, func() error {
+		event, err = j.GCalClient.SetRecurrence(calendarID, eventID, start, end, recurrence)
+		return err
+	})
+	return event, err
+}
+
+func (j journaledCalendar) PatchEvent(calendarID, eventID string, patch *calendar.Event) (event *calendar.Event, err error) {
+	change := Change{Target: ChangeTargetGoogle, Action: "patch", ID: eventID, CalendarID: calendarID, Patch: patch}
+	err = j.s.journal(&change, func() error {
+		event, err = j.GCalClient.PatchEvent(calendarID, eventID, patch)
+		return err
+	})
+	return event, err
+}
+
+func (j journaledCalendar) DeleteEvent(calendarID, eventID string) error {
+	change := Change{Target: ChangeTargetGoogle, Action: "delete", ID: eventID, CalendarID: calendarID}
+	return j.s.journal(&change, func() error {
+		return j.GCalClient.DeleteEvent(calendarID, eventID)
+	})
+}
+
+// journaledYouTrack journals the YouTrack writes of the synchronizer.
+type journaledYouTrack struct {
+	YTClient
+	s *Synchronizer
+}
+
+func (j journaledYouTrack) CreateIssue(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (issue *youtrack.Issue, err error) {
+	change := Change{Target: ChangeTargetYouTrack, Action: "create", ProjectID: projectID, Summary: nonEmpty(summary)}
+	err = j.s.journal(&change, func() error {
+		issue, err = j.YTClient.CreateIssue(projectID, summary, description, dueDate, fields)
+		if err == nil {
+			change.ID = issue.ID
+		}
+		return err
+	})
+	return issue, err
+}
+
+func (j journaledYouTrack) UpdateIssue(issueID string, summary, description *string, dueDate *time.Time) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "update", ID: issueID,
+		Summary: summary, Description: description, DueDate: dueDate}
+	return j.s.journal(&change, func() error {
+		return j.YTClient.UpdateIssue(issueID, summary, description, dueDate)
+	})
+}
+
+func (j journaledYouTrack) UpdateCustomFields(issueID string, fields []youtrack.CustomFieldWrapper) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "updateFields", ID: issueID, Fields: fields}
+	return j.s.journal(&change, func() error {
+		return j.YTClient.UpdateCustomFields(issueID, fields)
+	})
+}
+
+func (j journaledYouTrack) AddTag(issueID, tagName string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "addTag", ID: issueID, Tag: tagName}
+	return j.s.journal(&change, func() error {
+		return j.YTClient.AddTag(issueID, tagName)
+	})
+}
+
+func (j journaledYouTrack) LinkIssues(linkType, sourceID, targetID string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "link", ID: sourceID, LinkType: linkType, LinkedID: targetID}
+	return j.s.journal(&change, func() error {
+		return j.YTClient.LinkIssues(linkType, sourceID, targetID)
+	})
+}
+
+func (j journaledYouTrack) AddComment(issueID, text string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "comment", ID: issueID, Comment: text}
+	return j.s.journal(&change, func() error {
+		return j.YTClient.AddComment(issueID, text)
+	})
+}
+
+func (j journaledYouTrack) ApplyCommand(issueID, command string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "command", ID: issueID, Command: command}
+	return j.s.journal(&change, func() error {
+		return j.YTClient.ApplyCommand(issueID, command)
+	})
+}
+
+// recoverJournal replays the writes another run started but did not see
+// return, so that both sides end up as that run meant to leave them. Only
+// entries older than journalInFlight are replayed, so that the writes of
+// other processes sharing the state can finish, and those older than
+// journalMaxAge are dropped.
+// Updates, colors, recurrences, patches, moves, deletions, tags, links and
+// commands are made again, unless the event or issue was updated after the
+// write started: by the write itself, or by someone whose edit the replay
+// would overwrite. Creations are completed by their pending creations, see
+// PendingCreate, and comments are not repeated, as that could duplicate
+// them. Every entry is removed after its replay, failed replays being
+// logged.
+func (s *Synchronizer) recoverJournal() error {
+	now := s.now().UTC()
+	entries, err := s.DB.IncompleteOperations(s.runID, now.Add(-journalInFlight))
+	if err != nil {
+		return fmt.Errorf("failed to read the journal: %w", err)
+	}
+	for _, e := range entries {
+		c := e.Change
+		if now.Sub(e.StartedAt) > journalMaxAge {
+			log.Printf("Dropping %s %s of %s, interrupted at %s: too old to replay\n", c.Target, c.Action, c.ID, e.StartedAt.Format(time.RFC3339))
+		} else if err := s.replay(e); err != nil {
+			s.logError("Error replaying %s %s of %s: %v\n", c.Target, c.Action, c.ID, err)
+		}
+		if err := s.DB.CompleteOperation(e.ID); err != nil {
+			return fmt.Errorf("failed to complete journal entry %d: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// replay makes the change of e again, unless its item changed since.
+func (s *Synchronizer) replay(e JournalEntry) error {
+	c := e.Change
+	switch c.Action {
+	case "comment", "move":
+		// Neither overwrites the item; both check what was done below.
+	default:
+		changed, err := s.itemChangedSince(c, e.StartedAt)
+		if err != nil {
+			return err
+		}
+		if changed {
+			log.Printf("Not replaying %s %s of %s: changed since it was interrupted at %s\n", c.Target, c.Action, c.ID, e.StartedAt.Format(time.RFC3339))
+			return nil
+		}
+	}
+	log.Printf("Replaying %s %s of %s, interrupted at %s\n", c.Target, c.Action, c.ID, e.StartedAt.Format(time.RFC3339))
+	switch c.Target + " " + c.Action {
+	case ChangeTargetGoogle + " update":
+		_, err := s.calendar().UpdateEvent(c.CalendarID, c.ID, c.Summary, c.Description, c.Location, timeOrZero(c.Start), timeOrZero(c.End), c.AllDay, c.Visibility, c.Transparency)
+		if errors.Is(err, googlecalendar.ErrNotFound) {
+			return nil
+		}
+		return err
+	case ChangeTargetGoogle + " color":
+		_, err := s.calendar().SetColor(c.CalendarID, c.ID, c.Color)
+		if errors.Is(err, googlecalendar.ErrNotFound) {
+			return nil
+		}
+		return err
+	case ChangeTargetGoogle + " recur":
+		_, err := s.calendar().SetRecurrence(c.CalendarID, c.ID, timeOrZero(c.Start), timeOrZero(c.End), c.Recurrence)
+		if errors.Is(err, googlecalendar.ErrNotFound) {
+			return nil
+		}
+		return err
+	case ChangeTargetGoogle + " patch":
+		_, err := s.calendar().PatchEvent(c.CalendarID, c.ID, c.Patch)
+		if errors.Is(err, googlecalendar.ErrNotFound) {
+			return nil
+		}
+		return err
+	case ChangeTargetGoogle + " move":
+		if _, err := s.calendar().GetEvent(c.Destination, c.ID); err == nil {
+			return nil
+		}
+		_, err := s.calendar().MoveEvent(c.CalendarID, c.ID, c.Destination)
+		return err
+	case ChangeTargetGoogle + " delete":
+		if err := s.calendar().DeleteEvent(c.CalendarID, c.ID); !errors.Is(err, googlecalendar.ErrNotFound) {
+			return err
+		}
+		return nil
+	case ChangeTargetYouTrack + " comment":
+		log.Printf("Not repeating comment on YouTrack task %s; it may be missing: %s\n", c.ID, c.Comment)
+	case ChangeTargetYouTrack + " update", ChangeTargetYouTrack + " updateFields", ChangeTargetYouTrack + " addTag",
+		ChangeTargetYouTrack + " link", ChangeTargetYouTrack + " command":
+		return writeYouTrack(s.youtrack(), c)
+	}
+	return nil
+}
+
+// itemChangedSince reports whether the event or issue c writes was updated
+// after since. A missing item counts as changed, as there is nothing left
+// to write.
+func (s *Synchronizer) itemChangedSince(c Change, since time.Time) (bool, error) {
+	if c.Target == ChangeTargetYouTrack {
+		return s.changedSince(c.ID, since)
+	}
+	event, err := s.calendar().GetEvent(c.CalendarID, c.ID)
+	if errors.Is(err, googlecalendar.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return event.Updated.After(since), nil
+}
+
+// writeYouTrack makes the YouTrack change c, other than a creation, with
+// yt.
+func writeYouTrack(yt YTClient, c Change) error {
+	switch c.Action {
+	case "update":
+		return yt.UpdateIssue(c.ID, c.Summary, c.Description, c.DueDate)
+	case "updateFields":
+		return yt.UpdateCustomFields(c.ID, c.Fields)
+	case "addTag":
+		return yt.AddTag(c.ID, c.Tag)
+	case "link":
+		return yt.LinkIssues(c.LinkType, c.ID, c.LinkedID)
+	case "command":
+		return yt.ApplyCommand(c.ID, c.Command)
+	case "comment":
+		return yt.AddComment(c.ID, c.Comment)
+	}
+	return fmt.Errorf("unknown YouTrack action %q", c.Action)
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
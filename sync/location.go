@@ -0,0 +1,28 @@
+package sync
+
+import "youtrack-calendar-sync/youtrack"
+
+// issueLocation returns the location to write to the event of issue, or an
+// empty string when no LocationField is configured.
+func (s *Synchronizer) issueLocation(issue youtrack.Issue) string {
+	if s.LocationField == "" {
+		return ""
+	}
+	return issue.CustomFieldValue(s.LocationField)
+}
+
+// applyLocation writes an event location to LocationField on the issue
+// through yt. Empty locations are not written, mirroring how empty fields
+// are left untouched on events.
+func (s *Synchronizer) applyLocation(yt YTClient, issueID, location string) error {
+	if s.LocationField == "" || location == "" {
+		return nil
+	}
+	return yt.UpdateCustomFields(issueID, []youtrack.CustomFieldWrapper{
+		{
+			YouTrackType: youtrack.YouTrackType{Type: "SimpleIssueCustomField"},
+			Name:         s.LocationField,
+			Value:        location,
+		},
+	})
+}
@@ -0,0 +1,278 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Field names accepted by the managed-fields whitelist.
+const (
+	FieldSummary     = "summary"
+	FieldDescription = "description"
+	FieldDueDate     = "dueDate"
+	FieldStart       = "start"
+	FieldEnd         = "end"
+	FieldLocation    = "location"
+	FieldConference  = "conference"
+	FieldResponse    = "response"
+	FieldPriority    = "priority"
+	FieldState       = "state"
+	FieldTags        = "tags"
+	FieldColor       = "color"
+	FieldPatch       = "patch"
+)
+
+var (
+	youTrackFields = []string{FieldSummary, FieldDescription, FieldDueDate, FieldLocation, FieldConference, FieldResponse, FieldPriority, FieldState, FieldTags}
+	gcalFields     = []string{FieldSummary, FieldDescription, FieldStart, FieldEnd, FieldLocation, FieldColor, FieldPatch}
+)
+
+// ManagedFields restricts which fields the synchronizer may write when it
+// updates an existing item on either side. A nil set allows every field.
+type ManagedFields struct {
+	YouTrack map[string]bool
+	GCal     map[string]bool
+}
+
+// NewManagedFields builds a ManagedFields from lists of field names. An empty
+// list leaves that side unrestricted.
+func NewManagedFields(youTrack, gcal []string) (ManagedFields, error) {
+	yt, err := fieldSet(youTrack, youTrackFields)
+	if err != nil {
+		return ManagedFields{}, fmt.Errorf("invalid YouTrack managed fields: %w", err)
+	}
+	gc, err := fieldSet(gcal, gcalFields)
+	if err != nil {
+		return ManagedFields{}, fmt.Errorf("invalid Google Calendar managed fields: %w", err)
+	}
+	// An event is moved as a whole: writing only one end of it could leave
+	// the event ending before it starts.
+	if gc != nil && gc[FieldStart] != gc[FieldEnd] {
+		return ManagedFields{}, fmt.Errorf("invalid Google Calendar managed fields: %q and %q must be managed together", FieldStart, FieldEnd)
+	}
+	return ManagedFields{YouTrack: yt, GCal: gc}, nil
+}
+
+func fieldSet(names, allowed []string) (map[string]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !contains(allowed, name) {
+			return nil, fmt.Errorf("unknown field %q (allowed: %s)", name, strings.Join(allowed, ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsYouTrack reports whether the synchronizer may write field on YouTrack issues.
+func (m ManagedFields) AllowsYouTrack(field string) bool {
+	return m.YouTrack == nil || m.YouTrack[field]
+}
+
+// AllowsGCal reports whether the synchronizer may write field on calendar events.
+func (m ManagedFields) AllowsGCal(field string) bool {
+	return m.GCal == nil || m.GCal[field]
+}
+
+// managedYouTrack drops the writes to existing issues that the YouTrack
+// managed-fields whitelist does not allow, and records the fields it wrote.
+// Custom fields and commands are matched to whitelist fields by name, see
+// customFields; writes the whitelist does not cover pass unchanged.
+type managedYouTrack struct {
+	YTClient
+	s       *Synchronizer
+	written map[string]bool
+}
+
+// managedYouTrack returns the YouTrack client for updating existing issues.
+func (s *Synchronizer) managedYouTrack() managedYouTrack {
+	return managedYouTrack{YTClient: s.youtrack(), s: s, written: make(map[string]bool)}
+}
+
+// wrote reports whether field was written through m.
+func (m managedYouTrack) wrote(field string) bool {
+	return m.written[field]
+}
+
+func (m managedYouTrack) allows(field string) bool {
+	return field == "" || m.s.ManagedFields.AllowsYouTrack(field)
+}
+
+func (m managedYouTrack) UpdateIssue(issueID string, summary, description *string, dueDate *time.Time) error {
+	if !m.allows(FieldSummary) {
+		summary = nil
+	}
+	if !m.allows(FieldDescription) {
+		description = nil
+	}
+	if !m.allows(FieldDueDate) {
+		dueDate = nil
+	}
+	if err := m.YTClient.UpdateIssue(issueID, summary, description, dueDate); err != nil {
+		return err
+	}
+	m.written[FieldSummary] = m.written[FieldSummary] || summary != nil
+	m.written[FieldDescription] = m.written[FieldDescription] || description != nil
+	m.written[FieldDueDate] = m.written[FieldDueDate] || dueDate != nil
+	return nil
+}
+
+func (m managedYouTrack) UpdateCustomFields(issueID string, fields []youtrack.CustomFieldWrapper) error {
+	names := m.s.customFields()
+	var allowed []youtrack.CustomFieldWrapper
+	for _, f := range fields {
+		if m.allows(names[f.Name]) {
+			allowed = append(allowed, f)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	if err := m.YTClient.UpdateCustomFields(issueID, allowed); err != nil {
+		return err
+	}
+	for _, f := range allowed {
+		m.written[names[f.Name]] = true
+	}
+	return nil
+}
+
+func (m managedYouTrack) AddTag(issueID, tagName string) error {
+	if !m.allows(FieldTags) {
+		return nil
+	}
+	if err := m.YTClient.AddTag(issueID, tagName); err != nil {
+		return err
+	}
+	m.written[FieldTags] = true
+	return nil
+}
+
+// ApplyCommand applies command if the whitelist allows the field it sets,
+// the longest custom field name command starts with.
+func (m managedYouTrack) ApplyCommand(issueID, command string) error {
+	var name, field string
+	for n, f := range m.s.customFields() {
+		if len(n) > len(name) && strings.HasPrefix(command, n+" ") {
+			name, field = n, f
+		}
+	}
+	if !m.allows(field) {
+		return nil
+	}
+	if err := m.YTClient.ApplyCommand(issueID, command); err != nil {
+		return err
+	}
+	m.written[field] = true
+	return nil
+}
+
+// customFields maps the names of the custom fields the synchronizer writes
+// to existing issues to their whitelist fields. The due date wins over the
+// configured fields, and those over Priority and State, when names collide.
+func (s *Synchronizer) customFields() map[string]string {
+	fields := map[string]string{"Priority": FieldPriority, "State": FieldState}
+	if s.Response.Field != "" {
+		fields[s.Response.Field] = FieldResponse
+	}
+	if s.ConferenceField != "" {
+		fields[s.ConferenceField] = FieldConference
+	}
+	if s.LocationField != "" {
+		fields[s.LocationField] = FieldLocation
+	}
+	fields[noDueDate.Name] = FieldDueDate
+	return fields
+}
+
+// managedCalendar drops the writes to existing events that the Google
+// Calendar managed-fields whitelist does not allow, and records the fields
+// it wrote. Colors and patches it drops return a nil event.
+type managedCalendar struct {
+	GCalClient
+	s       *Synchronizer
+	written map[string]bool
+}
+
+// managedCalendar returns the calendar client for updating existing events.
+func (s *Synchronizer) managedCalendar() managedCalendar {
+	return managedCalendar{GCalClient: s.calendar(), s: s, written: make(map[string]bool)}
+}
+
+// wrote reports whether field was written through m.
+func (m managedCalendar) wrote(field string) bool {
+	return m.written[field]
+}
+
+func (m managedCalendar) allows(field string) bool {
+	return m.s.ManagedFields.AllowsGCal(field)
+}
+
+func (m managedCalendar) UpdateEvent(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	if !m.allows(FieldSummary) {
+		summary = nil
+	}
+	if !m.allows(FieldDescription) {
+		description = nil
+	}
+	if !m.allows(FieldLocation) {
+		location = nil
+	}
+	if !m.allows(FieldStart) {
+		start = time.Time{}
+	}
+	if !m.allows(FieldEnd) {
+		end = time.Time{}
+	}
+	event, err := m.GCalClient.UpdateEvent(calendarID, eventID, summary, description, location, start, end, allDay, visibility, transparency)
+	if err != nil {
+		return nil, err
+	}
+	m.written[FieldSummary] = m.written[FieldSummary] || summary != nil
+	m.written[FieldDescription] = m.written[FieldDescription] || description != nil
+	m.written[FieldLocation] = m.written[FieldLocation] || location != nil
+	m.written[FieldStart] = m.written[FieldStart] || !start.IsZero()
+	m.written[FieldEnd] = m.written[FieldEnd] || !end.IsZero()
+	return event, nil
+}
+
+func (m managedCalendar) SetColor(calendarID, eventID, colorID string) (*calendar.Event, error) {
+	if !m.allows(FieldColor) {
+		return nil, nil
+	}
+	event, err := m.GCalClient.SetColor(calendarID, eventID, colorID)
+	if err != nil {
+		return nil, err
+	}
+	m.written[FieldColor] = true
+	return event, nil
+}
+
+func (m managedCalendar) PatchEvent(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error) {
+	if !m.allows(FieldPatch) {
+		return nil, nil
+	}
+	event, err := m.GCalClient.PatchEvent(calendarID, eventID, patch)
+	if err != nil {
+		return nil, err
+	}
+	m.written[FieldPatch] = true
+	return event, nil
+}
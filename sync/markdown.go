@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The Markdown subset converted by MarkdownToHTML and HTMLToMarkdown:
+// line breaks, bulleted and numbered lists, bold, italic, code and links.
+// Both convert their own output back to the input, so text synced back and
+// forth keeps its form. Headings, which Google Calendar does not render,
+// become bold lines.
+var (
+	markdownLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	markdownNumber  = regexp.MustCompile(`^\d+[.)]\s+`)
+	markdownCode    = regexp.MustCompile("`([^`]+)`")
+	markdownBold    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markdownItalic  = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+
+	htmlBreak   = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlPara    = regexp.MustCompile(`(?i)<p(\s[^>]*)?>`)
+	htmlList    = regexp.MustCompile(`(?i)<(ul|ol)(\s[^>]*)?>`)
+	htmlOrdered = regexp.MustCompile(`(?is)<ol(\s[^>]*)?>(.*?)</ol>`)
+	htmlHeading = regexp.MustCompile(`(?is)<h[1-6](\s[^>]*)?>(.*?)</h[1-6]>`)
+	htmlItem    = regexp.MustCompile(`(?i)<li(\s[^>]*)?>`)
+	htmlLink    = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	htmlBold    = regexp.MustCompile(`(?is)<(b|strong)>(.*?)</(b|strong)>`)
+	htmlItalic  = regexp.MustCompile(`(?is)<(i|em)>(.*?)</(i|em)>`)
+	htmlCode    = regexp.MustCompile(`(?is)<code>(.*?)</code>`)
+	htmlTag     = regexp.MustCompile(`<[^>]+>`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// MarkdownToHTML converts the Markdown of a YouTrack description into the
+// HTML of a Google Calendar event description.
+func MarkdownToHTML(md string) string {
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(md), "\r\n", "\n"), "\n")
+	var b strings.Builder
+	list := ""
+	for i, line := range lines {
+		item, kind := listItem(line)
+		switch {
+		case kind != list && list != "":
+			b.WriteString("</" + list + ">")
+		case kind == "" && i > 0:
+			b.WriteString("<br>")
+		}
+		if kind != list && kind != "" {
+			b.WriteString("<" + kind + ">")
+		}
+		list = kind
+		switch {
+		case kind != "":
+			b.WriteString("<li>" + markdownInline(item) + "</li>")
+		case markdownHeading.MatchString(line):
+			b.WriteString("<b>" + markdownInline(markdownHeading.FindStringSubmatch(line)[1]) + "</b>")
+		default:
+			b.WriteString(markdownInline(line))
+		}
+	}
+	if list != "" {
+		b.WriteString("</" + list + ">")
+	}
+	return b.String()
+}
+
+// listItem returns the text of a list line and the HTML element of its
+// list, "ul" or "ol", or "" for other lines.
+func listItem(line string) (string, string) {
+	for _, bullet := range []string{"- ", "* "} {
+		if item, ok := strings.CutPrefix(line, bullet); ok {
+			return item, "ul"
+		}
+	}
+	if number := markdownNumber.FindString(line); number != "" {
+		return line[len(number):], "ol"
+	}
+	return "", ""
+}
+
+func markdownInline(text string) string {
+	text = html.EscapeString(text)
+	text = markdownLink.ReplaceAllStringFunc(text, func(link string) string {
+		m := markdownLink.FindStringSubmatch(link)
+		if !safeURL(html.UnescapeString(m[2])) {
+			return m[1]
+		}
+		return `<a href="` + m[2] + `">` + m[1] + "</a>"
+	})
+	text = markdownCode.ReplaceAllString(text, "<code>$1</code>")
+	text = markdownBold.ReplaceAllString(text, "<b>$1</b>")
+	return markdownItalic.ReplaceAllString(text, "<i>$1</i>")
+}
+
+// HTMLToMarkdown converts the HTML of a Google Calendar event description,
+// or its plain text, into Markdown for a YouTrack description. Markup
+// outside the supported subset is dropped, keeping its text.
+func HTMLToMarkdown(h string) string {
+	h = strings.ReplaceAll(h, "\r\n", "\n")
+	h = htmlBreak.ReplaceAllString(h, "\n")
+	h = htmlPara.ReplaceAllString(h, "")
+	h = strings.NewReplacer("</p>", "\n\n", "</P>", "\n\n", "</li>", "\n", "</LI>", "\n").Replace(h)
+	h = htmlOrdered.ReplaceAllStringFunc(h, func(list string) string {
+		n := 0
+		return htmlItem.ReplaceAllStringFunc(list, func(string) string {
+			n++
+			return strconv.Itoa(n) + ". "
+		})
+	})
+	h = htmlHeading.ReplaceAllString(h, "\n**$2**\n")
+	h = htmlList.ReplaceAllString(h, "\n")
+	h = htmlItem.ReplaceAllString(h, "- ")
+	h = htmlLink.ReplaceAllStringFunc(h, func(link string) string {
+		m := htmlLink.FindStringSubmatch(link)
+		href, text := m[1], htmlTag.ReplaceAllString(m[2], "")
+		if !safeURL(html.UnescapeString(href)) {
+			return text
+		}
+		if text == href {
+			// Google links bare URLs itself.
+			return href
+		}
+		return "[" + text + "](" + href + ")"
+	})
+	h = htmlBold.ReplaceAllString(h, "**$2**")
+	h = htmlItalic.ReplaceAllString(h, "*$2*")
+	h = htmlCode.ReplaceAllString(h, "`$1`")
+	h = htmlTag.ReplaceAllString(h, "")
+	h = strings.ReplaceAll(html.UnescapeString(h), "\u00a0", " ")
+	return strings.TrimSpace(blankLines.ReplaceAllString(h, "\n\n"))
+}
+
+// safeURL reports whether links to rawURL may be written, keeping scripts
+// out of the descriptions on either side.
+func safeURL(rawURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
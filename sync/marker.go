@@ -0,0 +1,40 @@
+package sync
+
+import "strings"
+
+// EventMarker is a prefix and suffix, such as "📌 ", that mark the summary
+// of events written by the synchronizer. When set, events without it are
+// never turned into issues, so events created by hand are left alone; an
+// event can still be synced by adding the marker to it.
+type EventMarker struct {
+	Prefix string
+	Suffix string
+}
+
+// enabled reports whether a marker is configured.
+func (m EventMarker) enabled() bool {
+	return m.Prefix != "" || m.Suffix != ""
+}
+
+// marks reports whether summary carries the marker. Without a marker every
+// summary is marked.
+func (m EventMarker) marks(summary string) bool {
+	return strings.HasPrefix(summary, m.Prefix) && strings.HasSuffix(summary[len(m.Prefix):], m.Suffix)
+}
+
+// apply adds the marker to summary unless it carries it already.
+func (m EventMarker) apply(summary string) string {
+	if !m.enabled() || m.marks(summary) {
+		return summary
+	}
+	return m.Prefix + summary + m.Suffix
+}
+
+// strip removes the marker from summary, so that it does not end up in the
+// issue summary.
+func (m EventMarker) strip(summary string) string {
+	if !m.enabled() || !m.marks(summary) {
+		return summary
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(summary, m.Prefix), m.Suffix)
+}
@@ -0,0 +1,160 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Metrics counts the items a mapping manages on each side. Every sync item
+// links an event to an issue, so both counts should equal Links; a broken
+// link usually means a deletion was missed or an item was duplicated and
+// its original deleted.
+type Metrics struct {
+	RecordedAt time.Time `json:"recordedAt"`
+	// Links is the number of sync items.
+	Links int `json:"links"`
+	// Events and Issues count the linked events and issues that still exist.
+	Events int `json:"events"`
+	Issues int `json:"issues"`
+	// Broken counts the links missing their event, their issue or both.
+	Broken int `json:"broken"`
+}
+
+// Drift returns the number of broken links.
+func (m Metrics) Drift() int {
+	return m.Broken
+}
+
+// CollectMetrics checks every sync item against both APIs and records the
+// resulting counts. It makes two requests per item.
+func (s *Synchronizer) CollectMetrics() (Metrics, error) {
+	m, _, err := s.Check()
+	return m, err
+}
+
+// Check verifies every sync item against both APIs, records the resulting
+// metrics and returns the broken links. It makes two requests per item.
+func (s *Synchronizer) Check() (Metrics, []BrokenLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.requireAuth(); err != nil {
+		return Metrics{}, nil, err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return Metrics{}, nil, err
+	}
+	return s.check()
+}
+
+func (s *Synchronizer) check() (Metrics, []BrokenLink, error) {
+	m := Metrics{RecordedAt: s.now()}
+	var broken []BrokenLink
+	for item, err := range s.DB.SyncItems(SyncItemFilter{}) {
+		if err != nil {
+			return Metrics{}, nil, fmt.Errorf("failed to get sync items: %w", err)
+		}
+		m.Links++
+		eventExists, err := s.eventExists(item.GCalID.String)
+		if err != nil {
+			return Metrics{}, nil, err
+		}
+		issueExists, err := s.issueExists(item.YTID.String)
+		if err != nil {
+			return Metrics{}, nil, err
+		}
+		if eventExists {
+			m.Events++
+		}
+		if issueExists {
+			m.Issues++
+		}
+		switch {
+		case !eventExists && !issueExists:
+			broken = append(broken, BrokenLink{Item: item, Problem: ProblemMissingBoth})
+		case !eventExists:
+			broken = append(broken, BrokenLink{Item: item, Problem: ProblemMissingEvent})
+		case !issueExists:
+			broken = append(broken, BrokenLink{Item: item, Problem: ProblemMissingIssue})
+		}
+	}
+	m.Broken = len(broken)
+
+	if err := s.DB.RecordMetrics(m); err != nil {
+		return Metrics{}, nil, fmt.Errorf("failed to record metrics: %w", err)
+	}
+	s.metricsMu.Lock()
+	s.metrics = &m
+	s.metricsMu.Unlock()
+	return m, broken, nil
+}
+
+// eventExists reports whether a linked event is still in the calendar.
+func (s *Synchronizer) eventExists(eventID string) (bool, error) {
+	if eventID == "" {
+		return false, nil
+	}
+	event, err := s.calendar().GetEvent(s.CalendarID, eventID)
+	if errors.Is(err, googlecalendar.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get event %s: %w", eventID, err)
+	}
+	return event.Status != "cancelled", nil
+}
+
+// issueExists reports whether a linked issue still exists in YouTrack.
+func (s *Synchronizer) issueExists(issueID string) (bool, error) {
+	if issueID == "" {
+		return false, nil
+	}
+	_, err := s.YouTrackClient.GetIssue(issueID)
+	if errors.Is(err, youtrack.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get issue %s: %w", issueID, err)
+	}
+	return true, nil
+}
+
+// checkDrift collects metrics when DriftCheckInterval has passed since the
+// last check, and warns when the drift exceeds DriftThreshold.
+func (s *Synchronizer) checkDrift() {
+	latest, err := s.DB.LatestMetrics()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error reading metrics: %v\n", err)
+		return
+	}
+	if latest != nil && s.now().Sub(latest.RecordedAt) < s.DriftCheckInterval {
+		s.metricsMu.Lock()
+		s.metrics = latest
+		s.metricsMu.Unlock()
+		return
+	}
+	m, _, err := s.check()
+	if err != nil {
+		log.Printf("Error checking drift: %v\n", err)
+		return
+	}
+	if m.Drift() > s.DriftThreshold {
+		log.Printf("WARNING: %d of %d links are broken (%d events, %d issues found); run the doctor command to investigate\n",
+			m.Broken, m.Links, m.Events, m.Issues)
+	}
+}
+
+// Drifting returns the last collected metrics and whether their drift
+// exceeds DriftThreshold. It reports false while drift checks are disabled.
+func (s *Synchronizer) Drifting() (Metrics, bool) {
+	s.metricsMu.Lock()
+	defer s.metricsMu.Unlock()
+	if s.metrics == nil || s.DriftThreshold <= 0 {
+		return Metrics{}, false
+	}
+	return *s.metrics, s.metrics.Drift() > s.DriftThreshold
+}
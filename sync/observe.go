@@ -0,0 +1,251 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	gosync "sync"
+	"time"
+
+	"youtrack-calendar-sync/youtrack"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Change targets.
+const (
+	ChangeTargetYouTrack = "youtrack"
+	ChangeTargetGoogle   = "google"
+)
+
+// Change is a write the synchronizer would have made, reported in observe
+// mode instead of being performed. Its Summary, Description and Location are
+// nil when not written, and empty when an update clears them.
+type Change struct {
+	Time time.Time `json:"time"`
+	// Mapping names the mapping the change belongs to, if any.
+	Mapping string `json:"mapping,omitempty"`
+	Target  string `json:"target"`
+	// Action is create, update, color, recur, patch, updateFields, addTag, link,
+	// comment, command, move, delete, createCalendar, share or unshare.
+	Action      string                        `json:"action"`
+	ID          string                        `json:"id,omitempty"`
+	ProjectID   string                        `json:"projectId,omitempty"`
+	CalendarID  string                        `json:"calendarId,omitempty"`
+	Summary     *string                       `json:"summary,omitempty"`
+	Description *string                       `json:"description,omitempty"`
+	Location    *string                       `json:"location,omitempty"`
+	Start       *time.Time                    `json:"start,omitempty"`
+	End         *time.Time                    `json:"end,omitempty"`
+	DueDate     *time.Time                    `json:"dueDate,omitempty"`
+	Fields      []youtrack.CustomFieldWrapper `json:"fields,omitempty"`
+	Tag         string                        `json:"tag,omitempty"`
+	Destination string                        `json:"destination,omitempty"`
+	// LinkType and LinkedID describe a link from the issue ID to LinkedID.
+	LinkType string `json:"linkType,omitempty"`
+	LinkedID string `json:"linkedId,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+	Command  string `json:"command,omitempty"`
+	// AllDay, Visibility and Transparency are set on written events.
+	AllDay       bool   `json:"allDay,omitempty"`
+	Visibility   string `json:"visibility,omitempty"`
+	Transparency string `json:"transparency,omitempty"`
+	// Color is the color set on an event, empty for that of its calendar.
+	Color string `json:"color,omitempty"`
+	// Recurrence lists the RRULE lines an event is made to repeat by.
+	Recurrence []string `json:"recurrence,omitempty"`
+	// Patch holds the fields patched onto an event.
+	Patch *calendar.Event `json:"patch,omitempty"`
+	// Scope, Email and Role describe the sharing of a calendar with a user
+	// or group.
+	Scope string `json:"scope,omitempty"`
+	Email string `json:"email,omitempty"`
+	Role  string `json:"role,omitempty"`
+}
+
+// ChangeFeed writes changes as newline-delimited JSON.
+type ChangeFeed struct {
+	mapping string
+	mu      *gosync.Mutex
+	enc     *json.Encoder
+	// created numbers the placeholder IDs of items that were not created.
+	created int
+}
+
+// NewChangeFeed creates a feed writing to w.
+func NewChangeFeed(w io.Writer) *ChangeFeed {
+	return &ChangeFeed{mu: &gosync.Mutex{}, enc: json.NewEncoder(w)}
+}
+
+// ForMapping returns a feed that shares f's output and labels its changes
+// with mapping.
+func (f *ChangeFeed) ForMapping(mapping string) *ChangeFeed {
+	return &ChangeFeed{mapping: mapping, mu: f.mu, enc: f.enc}
+}
+
+func (f *ChangeFeed) record(c Change) error {
+	c.Time = time.Now()
+	c.Mapping = f.mapping
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enc.Encode(c)
+}
+
+// placeholderID names an item that would have been created.
+func (f *ChangeFeed) placeholderID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created++
+	return fmt.Sprintf("observed-%d", f.created)
+}
+
+// Observe switches s to read-only observation: issues and events are still
+// fetched and compared, but every write is reported to feed instead, and the
+// sync state is replaced by an in-memory copy so it is left untouched too.
+func (s *Synchronizer) Observe(feed *ChangeFeed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.observe(feed)
+}
+
+// startDryRun switches s to observation if WithDryRun asked for it and it
+// has not happened yet.
+func (s *Synchronizer) startDryRun() error {
+	if s.dryRun == nil {
+		return nil
+	}
+	if err := s.observe(s.dryRun); err != nil {
+		return err
+	}
+	s.dryRun = nil
+	return nil
+}
+
+func (s *Synchronizer) observe(feed *ChangeFeed) error {
+	snapshot, err := s.DB.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to copy sync state: %w", err)
+	}
+	s.DB = snapshot.WithClock(s.DB.clock)
+	s.GoogleCalendarClient = observedCalendar{GCalClient: s.GoogleCalendarClient, feed: feed}
+	s.YouTrackClient = observedYouTrack{YTClient: s.YouTrackClient, feed: feed}
+	return nil
+}
+
+// observedCalendar reports calendar writes instead of performing them.
+type observedCalendar struct {
+	GCalClient
+	feed *ChangeFeed
+}
+
+func (o observedCalendar) CreateEvent(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	id := o.feed.placeholderID()
+	err := o.feed.record(Change{Target: ChangeTargetGoogle, Action: "create", ID: id, CalendarID: calendarID,
+		Summary: nonEmpty(summary), Description: nonEmpty(description), Location: nonEmpty(location), Start: &start, End: &end,
+		AllDay: allDay, Visibility: visibility, Transparency: transparency})
+	return &calendar.Event{Id: id, Summary: summary, Updated: time.Now().Format(time.RFC3339)}, err
+}
+
+func (o observedCalendar) UpdateEvent(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	err := o.feed.record(Change{Target: ChangeTargetGoogle, Action: "update", ID: eventID, CalendarID: calendarID,
+		Summary: summary, Description: description, Location: location, Start: &start, End: &end,
+		AllDay: allDay, Visibility: visibility, Transparency: transparency})
+	event := &calendar.Event{Id: eventID, Updated: time.Now().Format(time.RFC3339)}
+	if summary != nil {
+		event.Summary = *summary
+	}
+	return event, err
+}
+
+func (o observedCalendar) MoveEvent(calendarID, eventID, destinationCalendarID string) (*calendar.Event, error) {
+	err := o.feed.record(Change{Target: ChangeTargetGoogle, Action: "move", ID: eventID, CalendarID: calendarID, Destination: destinationCalendarID})
+	return &calendar.Event{Id: eventID}, err
+}
+
+// SetIssueID is bookkeeping that follows the creation of a link, so it is
+// skipped without being reported.
+func (o observedCalendar) SetIssueID(calendarID, eventID, issueID string) (*calendar.Event, error) {
+	return &calendar.Event{Id: eventID}, nil
+}
+
+func (o observedCalendar) SetColor(calendarID, eventID, colorID string) (*calendar.Event, error) {
+	err := o.feed.record(Change{Target: ChangeTargetGoogle, Action: "color", ID: eventID, CalendarID: calendarID, Color: colorID})
+	return &calendar.Event{Id: eventID, ColorId: colorID}, err
+}
+
+func (o observedCalendar) SetRecurrence(calendarID, eventID string, start, end time.Time, recurrence []string) (*calendar.Event, error) {
+	err := o.feed.record(Change{Target: ChangeTargetGoogle, Action: "recur", ID: eventID, CalendarID: calendarID, Start: &start, End: &end, Recurrence: recurrence})
+	return &calendar.Event{Id: eventID, Recurrence: recurrence}, err
+}
+
+func (o observedCalendar) PatchEvent(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error) {
+	err := o.feed.record(Change{Target: ChangeTargetGoogle, Action: "patch", ID: eventID, CalendarID: calendarID, Patch: patch})
+	event := *patch
+	event.Id = eventID
+	return &event, err
+}
+
+func (o observedCalendar) CreateCalendar(summary string) (*calendar.Calendar, error) {
+	id := o.feed.placeholderID()
+	err := o.feed.record(Change{Target: ChangeTargetGoogle, Action: "createCalendar", ID: id, Summary: nonEmpty(summary)})
+	return &calendar.Calendar{Id: id, Summary: summary}, err
+}
+
+func (o observedCalendar) ShareCalendar(calendarID, scopeType, address, role string) error {
+	return o.feed.record(Change{Target: ChangeTargetGoogle, Action: "share", CalendarID: calendarID, Scope: scopeType, Email: address, Role: role})
+}
+
+func (o observedCalendar) UnshareCalendar(calendarID, scopeType, address string) error {
+	return o.feed.record(Change{Target: ChangeTargetGoogle, Action: "unshare", CalendarID: calendarID, Scope: scopeType, Email: address})
+}
+
+func (o observedCalendar) DeleteEvent(calendarID, eventID string) error {
+	return o.feed.record(Change{Target: ChangeTargetGoogle, Action: "delete", ID: eventID, CalendarID: calendarID})
+}
+
+// observedYouTrack reports YouTrack writes instead of performing them.
+type observedYouTrack struct {
+	YTClient
+	feed *ChangeFeed
+}
+
+func (o observedYouTrack) CreateIssue(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+	id := o.feed.placeholderID()
+	err := o.feed.record(Change{Target: ChangeTargetYouTrack, Action: "create", ID: id, ProjectID: projectID,
+		Summary: nonEmpty(summary), Description: nonEmpty(description), DueDate: dueDate, Fields: fields})
+	return &youtrack.Issue{ID: id, IDReadable: id, Summary: summary, Description: description}, err
+}
+
+func (o observedYouTrack) UpdateIssue(issueID string, summary, description *string, dueDate *time.Time) error {
+	return o.feed.record(Change{Target: ChangeTargetYouTrack, Action: "update", ID: issueID,
+		Summary: summary, Description: description, DueDate: dueDate})
+}
+
+func (o observedYouTrack) UpdateCustomFields(issueID string, fields []youtrack.CustomFieldWrapper) error {
+	return o.feed.record(Change{Target: ChangeTargetYouTrack, Action: "updateFields", ID: issueID, Fields: fields})
+}
+
+func (o observedYouTrack) AddTag(issueID, tagName string) error {
+	return o.feed.record(Change{Target: ChangeTargetYouTrack, Action: "addTag", ID: issueID, Tag: tagName})
+}
+
+func (o observedYouTrack) LinkIssues(linkType, sourceID, targetID string) error {
+	return o.feed.record(Change{Target: ChangeTargetYouTrack, Action: "link", ID: sourceID, LinkType: linkType, LinkedID: targetID})
+}
+
+func (o observedYouTrack) AddComment(issueID, text string) error {
+	return o.feed.record(Change{Target: ChangeTargetYouTrack, Action: "comment", ID: issueID, Comment: text})
+}
+
+func (o observedYouTrack) ApplyCommand(issueID, command string) error {
+	return o.feed.record(Change{Target: ChangeTargetYouTrack, Action: "command", ID: issueID, Command: command})
+}
+
+// nonEmpty returns a pointer to s, or nil when s is empty, for the texts of
+// created items.
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"html/template"
+	"time"
+)
+
+// Option configures a Synchronizer created by NewSynchronizer. Settings
+// without an option are set on the exported fields afterwards.
+type Option func(*Synchronizer)
+
+// WithProject creates the issues of new events in the YouTrack project
+// projectID.
+func WithProject(projectID string) Option {
+	return func(s *Synchronizer) {
+		s.YouTrackProjectID = projectID
+	}
+}
+
+// WithQueryProject syncs the issues of query, a project or a comma
+// separated list of projects, see YouTrackQueryProjectID.
+func WithQueryProject(query string) Option {
+	return func(s *Synchronizer) {
+		s.YouTrackQueryProjectID = query
+	}
+}
+
+// WithCalendar syncs the Google calendar calendarID.
+func WithCalendar(calendarID string) Option {
+	return func(s *Synchronizer) {
+		s.CalendarID = calendarID
+	}
+}
+
+// WithDryRun makes the synchronizer observe rather than write: from its
+// first pass on, writes are reported to feed, see Observe.
+func WithDryRun(feed *ChangeFeed) Option {
+	return func(s *Synchronizer) {
+		s.dryRun = feed
+	}
+}
+
+// WithClock replaces SystemClock for the synchronizer and the times its
+// database records, e.g. to test time dependent behavior.
+func WithClock(clock Clock) Option {
+	return func(s *Synchronizer) {
+		s.Clock = clock
+		if s.DB != nil {
+			s.DB = s.DB.WithClock(clock)
+		}
+	}
+}
+
+// WithConcurrency lets up to n requests of a pass run in parallel, see
+// Concurrency.
+func WithConcurrency(n int) Option {
+	return func(s *Synchronizer) {
+		s.Concurrency = n
+	}
+}
+
+// Filters select the issues and events that are synced.
+type Filters struct {
+	// IncludeDrafts and IncludeResolved sync draft and resolved issues,
+	// which are skipped by default.
+	IncludeDrafts   bool
+	IncludeResolved bool
+	// SkippedEventTypes replaces DefaultSkippedEventTypes unless nil.
+	SkippedEventTypes []string
+	// IgnoredEvents selects events of other automations, if set.
+	IgnoredEvents *IgnoredEvents
+	// StartDate, unless zero, leaves out older items, see
+	// Synchronizer.StartDate.
+	StartDate time.Time
+}
+
+// WithFilters applies filters.
+func WithFilters(filters Filters) Option {
+	return func(s *Synchronizer) {
+		s.IncludeDrafts = filters.IncludeDrafts
+		s.IncludeResolved = filters.IncludeResolved
+		if filters.SkippedEventTypes != nil {
+			s.SkippedEventTypes = EventTypeSet(filters.SkippedEventTypes)
+		}
+		s.IgnoredEvents = filters.IgnoredEvents
+		s.StartDate = filters.StartDate
+	}
+}
+
+// Templates render the text of written items; nil templates keep the
+// defaults.
+type Templates struct {
+	// Description renders event descriptions, see LoadDescriptionTemplate.
+	Description *template.Template
+}
+
+// WithTemplates applies templates.
+func WithTemplates(templates Templates) Option {
+	return func(s *Synchronizer) {
+		s.DescriptionTemplate = templates.Description
+	}
+}
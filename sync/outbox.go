@@ -0,0 +1,355 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/httpclient"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Outbox queues the YouTrack writes of passes made while YouTrack is
+// unreachable, such as during the maintenance window of a self-hosted
+// instance, instead of failing them. Google Calendar is synced as usual,
+// and the first pass that reaches YouTrack again makes the queued writes
+// before anything else.
+//
+// Issues cannot be created without YouTrack, so their creation is left
+// pending and repeated from the event once YouTrack is back.
+type Outbox struct {
+	// MaxAge is how long queued writes are kept; older ones are dropped
+	// instead of made.
+	MaxAge time.Duration
+}
+
+// DefaultOutboxMaxAge is the default of Outbox.MaxAge.
+const DefaultOutboxMaxAge = 72 * time.Hour
+
+// ErrYouTrackUnreachable is returned for issues that could not be created
+// while YouTrack was unreachable, see Outbox.
+var ErrYouTrackUnreachable = errors.New("YouTrack is unreachable, retrying once it is back")
+
+// QueuedWrite is a YouTrack write queued while YouTrack was unreachable.
+type QueuedWrite struct {
+	ID       int64
+	Change   Change
+	QueuedAt time.Time
+	// Since is when the issue was last known to be unchanged in YouTrack;
+	// later updates conflict with the write.
+	Since time.Time
+}
+
+// QueueWrite adds change to the outbox, see QueuedWrite for since.
+func (db *DB) QueueWrite(change Change, since time.Time) error {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO outbox (item_id, payload, queued_at, since) VALUES (?, ?, ?, ?)"
+	if _, err := db.exec(query, change.ID, string(payload), db.now().UTC(), since.UTC()); err != nil {
+		return fmt.Errorf("failed to queue %s of YouTrack task %s: %w", change.Action, change.ID, err)
+	}
+	return nil
+}
+
+// QueuedWrites returns the writes in the outbox, oldest first.
+func (db *DB) QueuedWrites() ([]QueuedWrite, error) {
+	var writes []QueuedWrite
+	err := db.each("SELECT id, payload, queued_at, since FROM outbox ORDER BY id", nil, func(rows *sql.Rows) error {
+		var w QueuedWrite
+		var payload string
+		if err := rows.Scan(&w.ID, &payload, &w.QueuedAt, &w.Since); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(payload), &w.Change); err != nil {
+			return fmt.Errorf("queued write %d: %w", w.ID, err)
+		}
+		writes = append(writes, w)
+		return nil
+	})
+	return writes, err
+}
+
+// DeleteQueuedWrite removes the write id from the outbox.
+func (db *DB) DeleteQueuedWrite(id int64) error {
+	_, err := db.exec("DELETE FROM outbox WHERE id = ?", id)
+	return err
+}
+
+// youTrackUnreachable reports whether err shows YouTrack to be down rather
+// than to reject the request: the connection failed or timed out, or a
+// gateway in front of YouTrack answered in its place.
+func youTrackUnreachable(err error) bool {
+	var netErr net.Error
+	var apiErr *httpclient.APIError
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &netErr):
+		return true
+	case errors.As(err, &apiErr) && apiErr.Service == "youtrack":
+		switch apiErr.Status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+// youTrackDown reports whether err shows YouTrack to be unreachable while
+// Outbox is set. The YouTrack writes that follow are then queued until the
+// next pass.
+func (s *Synchronizer) youTrackDown(err error) bool {
+	if s.Outbox == nil || !youTrackUnreachable(err) {
+		return false
+	}
+	if s.ytDown.CompareAndSwap(false, true) {
+		log.Printf("YouTrack is unreachable, queueing its writes until it is back: %v\n", err)
+	}
+	return true
+}
+
+// queue adds change to the outbox and the current result.
+func (s *Synchronizer) queue(change Change) error {
+	if err := s.DB.QueueWrite(change, s.unchangedSince(change.ID)); err != nil {
+		return err
+	}
+	log.Printf("Queued %s of YouTrack task %s\n", change.Action, change.ID)
+	s.result.Queued++
+	return nil
+}
+
+// queuedYouTrack queues the YouTrack writes of the synchronizer while
+// YouTrack is unreachable, see Outbox.
+type queuedYouTrack struct {
+	YTClient
+	s *Synchronizer
+}
+
+// write makes change with write unless YouTrack is known to be down, and
+// queues it if YouTrack turns out to be. Comments that failed are not
+// queued, as YouTrack may have received them.
+func (q queuedYouTrack) write(change Change, write func() error) error {
+	if q.s.ytDown.Load() {
+		return q.s.queue(change)
+	}
+	err := write()
+	if !q.s.youTrackDown(err) || change.Action == "comment" {
+		return err
+	}
+	return q.s.queue(change)
+}
+
+func (q queuedYouTrack) CreateIssue(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+	if !q.s.ytDown.Load() {
+		issue, err := q.YTClient.CreateIssue(projectID, summary, description, dueDate, fields)
+		if !q.s.youTrackDown(err) {
+			return issue, err
+		}
+	}
+	// The creation stays pending, see PendingCreate; the entry only has the
+	// flush repeat pending creations.
+	if err := q.s.queue(Change{Target: ChangeTargetYouTrack, Action: "create", ProjectID: projectID, Summary: nonEmpty(summary)}); err != nil {
+		return nil, err
+	}
+	return nil, ErrYouTrackUnreachable
+}
+
+func (q queuedYouTrack) UpdateIssue(issueID string, summary, description *string, dueDate *time.Time) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "update", ID: issueID,
+		Summary: summary, Description: description, DueDate: dueDate}
+	return q.write(change, func() error {
+		return q.YTClient.UpdateIssue(issueID, summary, description, dueDate)
+	})
+}
+
+func (q queuedYouTrack) UpdateCustomFields(issueID string, fields []youtrack.CustomFieldWrapper) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "updateFields", ID: issueID, Fields: fields}
+	return q.write(change, func() error {
+		return q.YTClient.UpdateCustomFields(issueID, fields)
+	})
+}
+
+func (q queuedYouTrack) AddTag(issueID, tagName string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "addTag", ID: issueID, Tag: tagName}
+	return q.write(change, func() error {
+		return q.YTClient.AddTag(issueID, tagName)
+	})
+}
+
+func (q queuedYouTrack) LinkIssues(linkType, sourceID, targetID string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "link", ID: sourceID, LinkType: linkType, LinkedID: targetID}
+	return q.write(change, func() error {
+		return q.YTClient.LinkIssues(linkType, sourceID, targetID)
+	})
+}
+
+func (q queuedYouTrack) AddComment(issueID, text string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "comment", ID: issueID, Comment: text}
+	return q.write(change, func() error {
+		return q.YTClient.AddComment(issueID, text)
+	})
+}
+
+func (q queuedYouTrack) ApplyCommand(issueID, command string) error {
+	change := Change{Target: ChangeTargetYouTrack, Action: "command", ID: issueID, Command: command}
+	return q.write(change, func() error {
+		return q.YTClient.ApplyCommand(issueID, command)
+	})
+}
+
+// flushOutbox makes the queued writes, oldest first, and then repeats the
+// issue creations left pending while YouTrack was unreachable. Writes
+// older than MaxAge are dropped, as are those to issues changed in
+// YouTrack since they were queued: the change made in YouTrack is newer
+// and is synced to the event instead. If YouTrack is still unreachable,
+// the rest stays queued.
+func (s *Synchronizer) flushOutbox() error {
+	writes, err := s.DB.QueuedWrites()
+	if err != nil {
+		return fmt.Errorf("failed to read the outbox: %w", err)
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	log.Printf("Flushing %d YouTrack writes queued while YouTrack was unreachable\n", len(writes))
+	maxAge := s.Outbox.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultOutboxMaxAge
+	}
+	yt := journaledYouTrack{YTClient: s.YouTrackClient, s: s}
+	changed := make(map[string]bool)
+	var creations []int64
+	for _, w := range writes {
+		c := w.Change
+		switch {
+		case c.Action == "create":
+			creations = append(creations, w.ID)
+			continue
+		case s.now().Sub(w.QueuedAt) > maxAge:
+			s.logError("Dropping %s of YouTrack task %s queued at %s, which is older than %s\n", c.Action, c.ID, w.QueuedAt.Format(time.RFC3339), maxAge)
+		default:
+			conflict, checked := changed[c.ID]
+			if !checked {
+				conflict, err = s.changedSince(c.ID, w.Since)
+				if s.youTrackDown(err) {
+					return nil
+				}
+				if err != nil {
+					s.logError("Error checking YouTrack task %s for changes: %v\n", c.ID, err)
+					continue
+				}
+				changed[c.ID] = conflict
+			}
+			if conflict {
+				log.Printf("Dropping queued %s of YouTrack task %s, which changed in YouTrack since\n", c.Action, c.ID)
+				break
+			}
+			err := writeYouTrack(yt, c)
+			if s.youTrackDown(err) {
+				return nil
+			}
+			if err != nil {
+				s.logError("Error making queued %s of YouTrack task %s: %v\n", c.Action, c.ID, err)
+			} else {
+				s.markYouTrackWritten(c.ID)
+			}
+		}
+		if err := s.DB.DeleteQueuedWrite(w.ID); err != nil {
+			return fmt.Errorf("failed to remove queued write %d: %w", w.ID, err)
+		}
+	}
+	if len(creations) == 0 {
+		return nil
+	}
+	if err := s.retryPendingIssues(); err != nil {
+		return err
+	}
+	for _, id := range creations {
+		if err := s.DB.DeleteQueuedWrite(id); err != nil {
+			return fmt.Errorf("failed to remove queued write %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// unchangedSince returns when the issue issueID was last known to be
+// unchanged: its update time last synced, or the end of the echo window of
+// the last write to it, whichever is later, as in isEcho. Going by YouTrack
+// times where it can, the conflict check is not thrown by clocks that
+// differ between YouTrack and here.
+func (s *Synchronizer) unchangedSince(issueID string) time.Time {
+	item, err := s.DB.GetSyncItemByYTID(issueID)
+	if err != nil || !item.YTUpdatedAt.Valid {
+		return s.now()
+	}
+	since := item.YTUpdatedAt.Time
+	if written := item.YTWrittenAt.Time.Add(s.EchoWindow); item.YTWrittenAt.Valid && written.After(since) {
+		since = written
+	}
+	return since
+}
+
+// changedSince reports whether the issue issueID was updated after t or no
+// longer exists.
+func (s *Synchronizer) changedSince(issueID string, t time.Time) (bool, error) {
+	issue, err := s.YouTrackClient.GetIssue(issueID)
+	if errors.As(err, new(*httpclient.NotFoundError)) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.UnixMilli(issue.Updated).After(t), nil
+}
+
+// markYouTrackWritten records a write to the issue issueID on its sync
+// item, so that the update it causes is taken as an echo, see isEcho.
+func (s *Synchronizer) markYouTrackWritten(issueID string) {
+	item, err := s.DB.GetSyncItemByYTID(issueID)
+	if err != nil {
+		return
+	}
+	item.YTWrittenAt = sql.NullTime{Time: s.now(), Valid: true}
+	if err := s.DB.UpdateSyncItem(item); err != nil {
+		s.logError("Error updating sync item: %v\n", err)
+	}
+}
+
+// retryPendingIssues repeats the pending issue creations of events of the
+// synced calendar, from the events as they are now.
+func (s *Synchronizer) retryPendingIssues() error {
+	sources, err := s.DB.PendingSources()
+	if err != nil {
+		return err
+	}
+	var events []*googlecalendar.Event
+	for _, source := range sources {
+		eventID, ok := strings.CutPrefix(source, eventSource(""))
+		if !ok {
+			continue
+		}
+		event, err := s.calendar().GetEvent(s.CalendarID, eventID)
+		if errors.Is(err, googlecalendar.ErrNotFound) {
+			if err := s.DB.FinishCreate(source); err != nil {
+				s.logError("Error forgetting creation for deleted event %s: %v\n", eventID, err)
+			}
+			continue
+		}
+		if err != nil {
+			s.logError("Error fetching Google Calendar event %s: %v\n", eventID, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return s.processGCalEvents(events)
+}
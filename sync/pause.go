@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrPaused is returned by operations that write while synchronization is
+// paused.
+var ErrPaused = errors.New("synchronization is paused, resume it first")
+
+// ErrPausedByConfig is returned by Resume when the configuration pauses
+// synchronization.
+var ErrPausedByConfig = errors.New("synchronization is paused by the configuration")
+
+// PauseState describes whether and why synchronization is paused.
+type PauseState struct {
+	Paused bool       `json:"paused"`
+	Since  *time.Time `json:"since,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+	// Configured is set when the configuration pauses synchronization, so
+	// that it cannot be resumed at runtime.
+	Configured bool `json:"configured,omitempty"`
+	// PlannedChanges counts the writes the last paused pass would have made.
+	PlannedChanges int `json:"plannedChanges"`
+}
+
+// Pause stops all writes to Google Calendar, YouTrack and the sync state
+// until Resume is called. The pause is stored with the sync state, so it
+// also holds for other processes sharing it and across restarts. While
+// paused, Sync still fetches and compares both sides but only records the
+// changes it would make, see PlannedChanges; the cursors stay where they
+// are, so the first pass after Resume applies everything that was queued.
+func (s *Synchronizer) Pause(reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.DB.SetPause(Pause{Since: s.now(), Reason: reason}); err != nil {
+		return fmt.Errorf("failed to store pause: %w", err)
+	}
+	log.Printf("Synchronization paused: %s", reason)
+	return nil
+}
+
+// Resume lifts a pause set by Pause and discards the planned changes, which
+// the next pass makes for real.
+func (s *Synchronizer) Resume() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Paused {
+		return ErrPausedByConfig
+	}
+	if err := s.DB.ClearPause(); err != nil {
+		return fmt.Errorf("failed to clear pause: %w", err)
+	}
+	if err := s.DB.ReplacePlannedChanges(nil); err != nil {
+		return fmt.Errorf("failed to discard planned changes: %w", err)
+	}
+	log.Println("Synchronization resumed")
+	return nil
+}
+
+// PauseState reports whether synchronization is paused.
+func (s *Synchronizer) PauseState() (PauseState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := PauseState{Configured: s.Paused}
+	pause, err := s.DB.GetPause()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return state, fmt.Errorf("failed to read pause: %w", err)
+	}
+	if pause != nil {
+		state.Since = &pause.Since
+		state.Reason = pause.Reason
+	}
+	state.Paused = s.Paused || pause != nil
+	if state.Paused {
+		changes, err := s.DB.PlannedChanges()
+		if err != nil {
+			return state, fmt.Errorf("failed to read planned changes: %w", err)
+		}
+		state.PlannedChanges = len(changes)
+	}
+	return state, nil
+}
+
+// PlannedChanges returns the writes the last pass made while paused would
+// have made.
+func (s *Synchronizer) PlannedChanges() ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.DB.PlannedChanges()
+}
+
+// paused reports whether the configuration or a stored pause pauses
+// synchronization.
+func (s *Synchronizer) paused() (bool, error) {
+	if s.Paused {
+		return true, nil
+	}
+	pause, err := s.DB.GetPause()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, fmt.Errorf("failed to read pause: %w", err)
+	}
+	return pause != nil, nil
+}
+
+// requireRunning fails with ErrPaused while synchronization is paused.
+func (s *Synchronizer) requireRunning() error {
+	paused, err := s.paused()
+	if err != nil {
+		return err
+	}
+	if paused {
+		return ErrPaused
+	}
+	return nil
+}
+
+// plan runs a pass like Observe, against a copy of the sync state, and
+// stores the changes it would have made as the planned changes.
+func (s *Synchronizer) plan() error {
+	log.Println("Synchronization is paused, recording planned changes only")
+	s.result.Paused = true
+	snapshot, err := s.DB.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to copy sync state: %w", err)
+	}
+	defer snapshot.Close()
+
+	var out bytes.Buffer
+	feed := NewChangeFeed(&out)
+	db, gcal, yt := s.DB, s.GoogleCalendarClient, s.YouTrackClient
+	// A drift check would count the placeholders of planned items as broken.
+	threshold := s.DriftThreshold
+	s.DB, s.DriftThreshold = snapshot, 0
+	s.GoogleCalendarClient = observedCalendar{GCalClient: gcal, feed: feed}
+	s.YouTrackClient = observedYouTrack{YTClient: yt, feed: feed}
+	err = s.pass()
+	s.DB, s.DriftThreshold = db, threshold
+	s.GoogleCalendarClient, s.YouTrackClient = gcal, yt
+	if err != nil {
+		return err
+	}
+
+	var changes []Change
+	for dec := json.NewDecoder(&out); dec.More(); {
+		var c Change
+		if err := dec.Decode(&c); err != nil {
+			return fmt.Errorf("failed to decode planned change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	if err := s.DB.ReplacePlannedChanges(changes); err != nil {
+		return fmt.Errorf("failed to store planned changes: %w", err)
+	}
+	log.Printf("Recorded %d planned changes", len(changes))
+	return nil
+}
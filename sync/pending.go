@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// PendingCreate is a creation the synchronizer started but has not linked
+// yet. It is recorded before the item is created, so that a creation that
+// was interrupted after the item was created, but before it was linked, is
+// completed instead of repeated.
+type PendingCreate struct {
+	// Source identifies what the item is created for, see eventSource and
+	// issueSource.
+	Source string
+	// Key is the ID requested for the created event; it is empty for
+	// issues, for which YouTrack offers no such key.
+	Key       string
+	CreatedAt time.Time
+	// Resumed is set when an earlier attempt recorded the creation.
+	Resumed bool
+}
+
+func eventSource(eventID string) string { return "event:" + eventID }
+func issueSource(issueID string) string { return "issue:" + issueID }
+
+// BeginCreate returns the pending creation of source, recording it with a
+// new key if there is none.
+func (db *DB) BeginCreate(source string) (*PendingCreate, error) {
+	p := &PendingCreate{Source: source}
+	err := db.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(db.context(), db.rebind("SELECT idempotency_key, created_at FROM pending_creates WHERE source = ?"), source).Scan(&p.Key, &p.CreatedAt)
+		if err == nil {
+			p.Resumed = true
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if strings.HasPrefix(source, "issue:") {
+			// Google accepts lowercase letters a-v and digits in event IDs,
+			// which covers hex.
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			p.Key = hex.EncodeToString(b)
+		}
+		p.CreatedAt = db.now().UTC()
+		_, err = db.txExec(tx, "INSERT INTO pending_creates (source, idempotency_key, created_at) VALUES (?, ?, ?)", p.Source, p.Key, p.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record creation for %s: %w", source, err)
+	}
+	return p, nil
+}
+
+// FinishCreate forgets the pending creation of source once its item is
+// linked.
+func (db *DB) FinishCreate(source string) error {
+	if _, err := db.exec("DELETE FROM pending_creates WHERE source = ?", source); err != nil {
+		return fmt.Errorf("failed to finish creation for %s: %w", source, err)
+	}
+	return nil
+}
+
+// PendingSources returns the sources of the pending creations.
+func (db *DB) PendingSources() ([]string, error) {
+	var sources []string
+	err := db.each("SELECT source FROM pending_creates ORDER BY created_at", nil, func(rows *sql.Rows) error {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return err
+		}
+		sources = append(sources, source)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending creations: %w", err)
+	}
+	return sources, nil
+}
+
+// IsPendingEvent reports whether eventID was requested for an event of a
+// pending creation, which is linked once the creation completes.
+func (db *DB) IsPendingEvent(eventID string) (bool, error) {
+	var n int
+	if err := db.get("SELECT COUNT(*) FROM pending_creates WHERE idempotency_key = ?", []interface{}{eventID}, &n); err != nil {
+		return false, fmt.Errorf("failed to look up pending event %s: %w", eventID, err)
+	}
+	return n > 0, nil
+}
+
+// createEvent creates the event of draft for the pending creation p, or
+// returns the event an interrupted attempt created.
+func (s *Synchronizer) createEvent(p *PendingCreate, draft *EventDraft) (id string, updated time.Time, err error) {
+	created, err := s.calendar().CreateEvent(s.CalendarID, p.Key, draft.Summary, draft.Description, draft.Location, draft.Start, draft.End, draft.AllDay, draft.Visibility, draft.Transparency)
+	if errors.Is(err, googlecalendar.ErrExists) {
+		event, err := s.calendar().GetEvent(s.CalendarID, p.Key)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to fetch event %s created by an earlier attempt: %w", p.Key, err)
+		}
+		log.Printf("Linking Google Calendar event %s created by an interrupted earlier attempt\n", event.ID)
+		return event.ID, event.Updated, nil
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	updated, _ = time.Parse(time.RFC3339, created.Updated)
+	return created.Id, updated, nil
+}
+
+// interruptedIssue returns the issue an interrupted attempt of the pending
+// creation p created for event, or nil if it created none. It looks for an
+// issue written since the attempt began that is not linked yet and whose
+// description holds the link to the event, which is where issues created
+// from events start.
+func (s *Synchronizer) interruptedIssue(p *PendingCreate, event *googlecalendar.Event, draft *IssueDraft) (*youtrack.Issue, error) {
+	if !p.Resumed {
+		return nil, nil
+	}
+	// Allow for clocks that differ between YouTrack and here.
+	issues, err := s.YouTrackClient.GetUpdatedIssues(s.YouTrackProjectID, p.CreatedAt.Add(-time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	for i, issue := range issues {
+		if event.HTMLLink != "" && !strings.Contains(issue.Description, event.HTMLLink) {
+			continue
+		}
+		if event.HTMLLink == "" && issue.Summary != draft.Summary {
+			continue
+		}
+		linked, err := s.DB.GetSyncItemByYTID(issue.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if linked == nil {
+			return &issues[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,247 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Planner places work blocks for upcoming issues into free calendar time
+// before they are due. An unresolved issue is planned once it is due within
+// Horizon and has an estimate; its blocks are replanned when the estimate or
+// due date changes, and those that have not started are removed once the
+// issue is resolved or no longer due in time.
+type Planner struct {
+	// EstimateField is the period custom field holding the estimate.
+	EstimateField string
+	// Horizon is how far ahead issues are planned.
+	Horizon time.Duration
+	// BlockLength is the longest a single work block lasts.
+	BlockLength time.Duration
+}
+
+// Defaults of Planner.Horizon and Planner.BlockLength.
+const (
+	DefaultPlanHorizon     = 14 * 24 * time.Hour
+	DefaultWorkBlockLength = 2 * time.Hour
+)
+
+const (
+	// minWorkBlock is the shortest free slot a block is placed in, unless
+	// less work remains.
+	minWorkBlock = 30 * time.Minute
+	// planStep rounds the earliest start of work blocks up.
+	planStep = 15 * time.Minute
+)
+
+// defaultPlanHours are the hours work blocks are placed in without
+// WorkingHours.
+var defaultPlanHours = WorkingHours{Start: 9 * time.Hour, End: 17 * time.Hour, SkipWeekends: true}
+
+// plannedWork is an issue that needs work blocks.
+type plannedWork struct {
+	issue    youtrack.Issue
+	due      time.Time
+	estimate time.Duration
+	plan     string
+}
+
+// planWork places work blocks for the issues due within the horizon, earliest
+// due date first, and removes the blocks of issues that no longer need them.
+func (s *Synchronizer) planWork() error {
+	horizon, length := s.Planner.Horizon, s.Planner.BlockLength
+	if horizon <= 0 {
+		horizon = DefaultPlanHorizon
+	}
+	if length <= 0 {
+		length = DefaultWorkBlockLength
+	}
+	now := s.now()
+	query, err := s.IssueQuery()
+	if err != nil {
+		return err
+	}
+	issues, err := s.YouTrackClient.GetDueIssues(query, now, now.Add(horizon))
+	if err != nil {
+		return fmt.Errorf("failed to fetch upcoming YouTrack issues: %w", err)
+	}
+	blocks, err := s.DB.GetWorkBlocks()
+	if err != nil {
+		return fmt.Errorf("failed to get work blocks: %w", err)
+	}
+	planned := make(map[string][]WorkBlock)
+	for _, block := range blocks {
+		planned[block.YTID] = append(planned[block.YTID], block)
+	}
+
+	var work []plannedWork
+	current := make(map[string]bool)
+	for _, issue := range issues {
+		due, estimate := issueDueDate(issue), issue.Period(s.Planner.EstimateField)
+		if issue.IsResolved() || estimate <= 0 || !due.After(now) {
+			continue
+		}
+		plan := fmt.Sprintf("%s %s", estimate, due.Format(time.RFC3339))
+		if upToDate(planned[issue.ID], plan) {
+			current[issue.ID] = true
+			continue
+		}
+		work = append(work, plannedWork{issue: issue, due: due, estimate: estimate, plan: plan})
+	}
+	for id, blocks := range planned {
+		if !current[id] {
+			s.dropWorkBlocks(blocks, now)
+		}
+	}
+	if len(work) == 0 {
+		return nil
+	}
+
+	sort.Slice(work, func(i, j int) bool { return work[i].due.Before(work[j].due) })
+	from := now.Truncate(planStep)
+	if from.Before(now) {
+		from = from.Add(planStep)
+	}
+	busy, err := s.calendar().FreeBusy([]string{s.CalendarID}, from, work[len(work)-1].due)
+	if err != nil {
+		return fmt.Errorf("failed to query free time: %w", err)
+	}
+	hours := defaultPlanHours
+	if s.WorkingHours != nil {
+		hours = *s.WorkingHours
+	}
+	for _, w := range work {
+		slots := placeWork(from, w.due, w.estimate, busy, hours, length)
+		var placed time.Duration
+		for _, slot := range slots {
+			placed += slot.End.Sub(slot.Start)
+		}
+		if placed < w.estimate {
+			log.Printf("WARNING: YouTrack task %s: only %s of its %s estimate fit before it is due\n", w.issue.ReadableID(), placed, w.estimate)
+		}
+		for i, slot := range slots {
+			if err := s.createWorkBlock(w, slot, i+1, len(slots)); err != nil {
+				s.logError("Error creating work block for YouTrack task %s: %v\n", w.issue.ID, err)
+				continue
+			}
+			busy = append(busy, slot)
+		}
+	}
+	return nil
+}
+
+// upToDate reports whether blocks were planned for plan.
+func upToDate(blocks []WorkBlock, plan string) bool {
+	for _, block := range blocks {
+		if block.Plan == plan {
+			return true
+		}
+	}
+	return false
+}
+
+// dropWorkBlocks deletes the events of blocks that have not started and
+// forgets blocks that are over; blocks in progress are left until they end.
+func (s *Synchronizer) dropWorkBlocks(blocks []WorkBlock, now time.Time) {
+	for _, block := range blocks {
+		switch {
+		case block.Start.After(now):
+			log.Printf("Deleting work block %s of YouTrack task %s\n", block.GCalID, block.YTID)
+			if err := s.calendar().DeleteEvent(s.CalendarID, block.GCalID); err != nil && !errors.Is(err, googlecalendar.ErrNotFound) {
+				s.logError("Error deleting work block %s: %v\n", block.GCalID, err)
+				continue
+			}
+		case block.End.After(now):
+			continue
+		}
+		if err := s.DB.DeleteWorkBlock(block.GCalID); err != nil {
+			s.logError("Error deleting work block %s: %v\n", block.GCalID, err)
+		}
+	}
+}
+
+// createWorkBlock writes the n-th of count work blocks of w to the calendar.
+func (s *Synchronizer) createWorkBlock(w plannedWork, slot googlecalendar.Busy, n, count int) error {
+	id := w.issue.ReadableID()
+	summary := fmt.Sprintf("Work block: %s %s", id, w.issue.Summary)
+	description := fmt.Sprintf(`Planned work on <a href="%s/issue/%s">%s</a>, due %s.<br>Block %d of %d for an estimate of %s.`,
+		s.YouTrackClient.GetBaseURL(), id, id, w.due.Format("Mon Jan 2 2006 15:04"), n, count, w.estimate)
+	log.Printf("Creating work block for YouTrack task %s: %s to %s\n", id, slot.Start.Format(time.RFC3339), slot.End.Format(time.RFC3339))
+	event, err := s.calendar().CreateEvent(s.CalendarID, "", summary, description, "", slot.Start, slot.End, false, s.EventVisibility, "opaque")
+	if err != nil {
+		return err
+	}
+	return s.DB.CreateWorkBlock(WorkBlock{GCalID: event.Id, YTID: w.issue.ID, Start: slot.Start, End: slot.End, Plan: w.plan})
+}
+
+// isWorkBlock reports whether event was placed by the planner, so that it
+// does not become an issue of its own.
+func (s *Synchronizer) isWorkBlock(event *googlecalendar.Event) bool {
+	if s.Planner == nil {
+		return false
+	}
+	block, err := s.DB.IsWorkBlock(event.ID)
+	if err != nil {
+		s.logError("Error looking up work block %s: %v\n", event.ID, err)
+		return true
+	}
+	return block
+}
+
+// placeWork returns free slots between from and until, within hours, that
+// add up to estimate where possible, earliest first. Slots last at most
+// length and at least minWorkBlock, unless less work remains.
+func placeWork(from, until time.Time, estimate time.Duration, busy []googlecalendar.Busy, hours WorkingHours, length time.Duration) []googlecalendar.Busy {
+	busy = append([]googlecalendar.Busy(nil), busy...)
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+
+	var slots []googlecalendar.Busy
+	remaining := estimate
+	fill := func(start, end time.Time) {
+		for remaining > 0 && end.Sub(start) >= min(remaining, minWorkBlock) {
+			d := min(end.Sub(start), length, remaining)
+			slots = append(slots, googlecalendar.Busy{Start: start, End: start.Add(d)})
+			start, remaining = start.Add(d), remaining-d
+		}
+	}
+
+	year, month, day := from.Date()
+	for midnight := time.Date(year, month, day, 0, 0, 0, 0, from.Location()); remaining > 0 && midnight.Before(until); midnight = midnight.AddDate(0, 0, 1) {
+		if hours.SkipWeekends && (midnight.Weekday() == time.Saturday || midnight.Weekday() == time.Sunday) {
+			continue
+		}
+		start := maxTime(midnight.Add(hours.Start), from)
+		end := minTime(midnight.Add(hours.End), until)
+		for _, b := range busy {
+			if !b.End.After(start) {
+				continue
+			}
+			if !b.Start.Before(end) {
+				break
+			}
+			fill(start, b.Start)
+			start = maxTime(start, b.End)
+		}
+		fill(start, end)
+	}
+	return slots
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,262 @@
+package sync
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+)
+
+// PushNotifications keeps a Google push notification channel open for the
+// synced calendar, so that its changes are synced when Google announces
+// them rather than on the next periodic pass. See StartPushChannelLoop.
+type PushNotifications struct {
+	// Address is the public HTTPS URL Google posts the notifications to,
+	// which passes them to PushNotification.
+	Address string
+	// TTL is how long channels are requested for; Google may grant less.
+	// Zero keeps Google's default of a week.
+	TTL time.Duration
+	// RenewBefore is how long before it expires a channel is replaced.
+	RenewBefore time.Duration
+}
+
+// DefaultPushRenewBefore is the default of PushNotifications.RenewBefore.
+const DefaultPushRenewBefore = time.Hour
+
+// pushRetry is how long after a failed renewal it is tried again.
+const pushRetry = time.Minute
+
+// PushChannelStatus describes the health of the push notification channel
+// of a synchronizer.
+type PushChannelStatus struct {
+	ChannelID  string    `json:"channelId,omitempty"`
+	Expiration time.Time `json:"expiration,omitempty"`
+	// Healthy is set while an open channel is not about to expire, i.e.
+	// the last renewal, if due, succeeded.
+	Healthy  bool `json:"healthy"`
+	Renewals int  `json:"renewals"`
+	// Notifications counts the notifications received since the start.
+	Notifications    int       `json:"notifications"`
+	LastNotification time.Time `json:"lastNotification,omitempty"`
+	LastError        string    `json:"lastError,omitempty"`
+}
+
+// PushChannel is the stored state of an open push notification channel.
+type PushChannel struct {
+	CalendarID string
+	ID         string
+	ResourceID string
+	// Token authenticates the notifications of the channel.
+	Token      string
+	Expiration time.Time
+}
+
+// GetPushChannel returns the open push notification channel, or
+// ErrNotFound.
+func (db *DB) GetPushChannel() (*PushChannel, error) {
+	var c PushChannel
+	query := "SELECT calendar_id, channel_id, resource_id, token, expiration FROM push_channels WHERE id = 1"
+	if err := db.get(query, nil, &c.CalendarID, &c.ID, &c.ResourceID, &c.Token, &c.Expiration); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get push channel: %w", err)
+	}
+	return &c, nil
+}
+
+// SavePushChannel stores c, replacing the previous channel.
+func (db *DB) SavePushChannel(c PushChannel) error {
+	query := "INSERT INTO push_channels (id, calendar_id, channel_id, resource_id, token, expiration) VALUES (1, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT (id) DO UPDATE SET calendar_id = excluded.calendar_id, channel_id = excluded.channel_id, resource_id = excluded.resource_id, token = excluded.token, expiration = excluded.expiration"
+	if _, err := db.exec(query, c.CalendarID, c.ID, c.ResourceID, c.Token, c.Expiration); err != nil {
+		return fmt.Errorf("failed to store push channel %s: %w", c.ID, err)
+	}
+	return nil
+}
+
+// DeletePushChannel removes the stored channel.
+func (db *DB) DeletePushChannel() error {
+	if _, err := db.exec("DELETE FROM push_channels"); err != nil {
+		return fmt.Errorf("failed to delete push channel: %w", err)
+	}
+	return nil
+}
+
+// StartPushChannelLoop opens the push notification channel, or takes over
+// the one left open by an earlier process, and replaces it RenewBefore its
+// expiration until Stop is called.
+func (s *Synchronizer) StartPushChannelLoop() {
+	for {
+		expiration, err := s.RenewPushChannel()
+		next := expiration.Add(-s.PushNotifications.RenewBefore)
+		// A failed renewal, or a channel shorter than RenewBefore, is
+		// retried a minute later.
+		if err != nil {
+			log.Printf("Error renewing push channel: %v\n", err)
+		}
+		if retry := s.now().Add(pushRetry); err != nil || next.Before(retry) {
+			next = retry
+		}
+		if !s.waitUntil(next) {
+			return
+		}
+	}
+}
+
+// RenewPushChannel opens a push notification channel for the calendar
+// unless the stored one is still open beyond RenewBefore, and returns the
+// expiration of the open channel. A replaced channel is stopped.
+func (s *Synchronizer) RenewPushChannel() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiration, err := s.renewPushChannel()
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	if err != nil {
+		s.pushStatus.LastError = err.Error()
+	}
+	s.pushStatus.Healthy = s.now().Before(s.pushStatus.Expiration.Add(-s.PushNotifications.RenewBefore))
+	return expiration, err
+}
+
+func (s *Synchronizer) renewPushChannel() (time.Time, error) {
+	if err := s.requireAuth(); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return time.Time{}, err
+	}
+	old, err := s.DB.GetPushChannel()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return time.Time{}, err
+	}
+	if old != nil && old.CalendarID == s.CalendarID && s.now().Before(old.Expiration.Add(-s.PushNotifications.RenewBefore)) {
+		s.setPushChannel(old, false)
+		return old.Expiration, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return time.Time{}, err
+	}
+	id, token := hex.EncodeToString(b[:16]), hex.EncodeToString(b[16:])
+	opened, err := s.calendar().WatchEvents(s.CalendarID, id, s.PushNotifications.Address, token, s.PushNotifications.TTL)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open push channel: %w", err)
+	}
+	channel := &PushChannel{CalendarID: s.CalendarID, ID: opened.ID, ResourceID: opened.ResourceID, Token: token, Expiration: opened.Expiration}
+	if err := s.DB.SavePushChannel(*channel); err != nil {
+		// Unrecorded, the channel could never be stopped.
+		if err := s.calendar().StopChannel(opened.ID, opened.ResourceID); err != nil {
+			log.Printf("Error stopping push channel %s: %v\n", opened.ID, err)
+		}
+		return time.Time{}, err
+	}
+	log.Printf("Opened push channel %s for calendar %s until %s\n", channel.ID, s.CalendarID, channel.Expiration.Format(time.RFC3339))
+	s.setPushChannel(channel, true)
+	if old != nil {
+		s.stopPushChannel(old)
+	}
+	return channel.Expiration, nil
+}
+
+// setPushChannel records channel as the open channel in the status.
+func (s *Synchronizer) setPushChannel(channel *PushChannel, renewed bool) {
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	s.pushStatus.ChannelID = channel.ID
+	s.pushStatus.Expiration = channel.Expiration
+	s.pushStatus.LastError = ""
+	s.pushToken = channel.Token
+	if renewed {
+		s.pushStatus.Renewals++
+	}
+}
+
+// stopPushChannel stops a channel, logging failures: left open, it expires
+// on its own, and its notifications are ignored.
+func (s *Synchronizer) stopPushChannel(channel *PushChannel) {
+	err := s.calendar().StopChannel(channel.ID, channel.ResourceID)
+	if err != nil && !errors.Is(err, googlecalendar.ErrNotFound) {
+		log.Printf("Error stopping push channel %s: %v\n", channel.ID, err)
+		return
+	}
+	log.Printf("Stopped push channel %s\n", channel.ID)
+}
+
+// StopPushChannel stops the open push notification channel, e.g. on
+// shutdown, so that Google does not keep notifying an address that no
+// longer answers.
+func (s *Synchronizer) StopPushChannel() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel, err := s.DB.GetPushChannel()
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.stopPushChannel(channel)
+	if err := s.DB.DeletePushChannel(); err != nil {
+		return err
+	}
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	s.pushStatus.ChannelID = ""
+	s.pushStatus.Expiration = time.Time{}
+	s.pushStatus.Healthy = false
+	s.pushToken = ""
+	return nil
+}
+
+// PushNotification handles a notification of the channel channelID carrying
+// token, with the resource state Google sends in X-Goog-Resource-State. It
+// reports whether the channel is the open channel of s; if so, a change
+// starts a pass in the background, unless one is already waiting to start.
+func (s *Synchronizer) PushNotification(channelID, token, state string) bool {
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	if s.PushNotifications == nil || channelID == "" || channelID != s.pushStatus.ChannelID {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(s.pushToken), []byte(token)) != 1 {
+		return false
+	}
+	s.pushStatus.Notifications++
+	s.pushStatus.LastNotification = s.now()
+	// The first notification of a channel only confirms it was opened.
+	if state == "sync" || !s.pushQueued.CompareAndSwap(false, true) {
+		return true
+	}
+	go func() {
+		// Changes announced from now on need another pass.
+		s.mu.Lock()
+		s.pushQueued.Store(false)
+		s.mu.Unlock()
+		if _, err := s.Sync(); err != nil {
+			log.Printf("Error on synchronization started by push channel %s: %v\n", channelID, err)
+		}
+	}()
+	return true
+}
+
+// PushChannelStatus returns the state of the push notification channel,
+// or nil without PushNotifications.
+func (s *Synchronizer) PushChannelStatus() *PushChannelStatus {
+	if s.PushNotifications == nil {
+		return nil
+	}
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	status := s.pushStatus
+	status.Healthy = status.Healthy && s.now().Before(status.Expiration)
+	return &status
+}
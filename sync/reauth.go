@@ -0,0 +1,232 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// ErrReauthRequired is returned once Google rejected the refresh token: no
+// further calendar requests are made until Reauthorized is called.
+var ErrReauthRequired = errors.New("google authorization expired or was revoked, re-authorize to resume")
+
+// AuthError returns the error that made Google authorization fail, or nil
+// while authorization is valid.
+func (s *Synchronizer) AuthError() error {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return s.authErr
+}
+
+// Reauthorized replaces the calendar client with one holding a fresh token
+// and resumes synchronization.
+func (s *Synchronizer) Reauthorized(client GCalClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	s.GoogleCalendarClient = client
+	if s.authErr != nil {
+		log.Println("Google authorization renewed, resuming synchronization")
+	}
+	s.authErr = nil
+}
+
+// AwaitAuthorization pauses s as if Google had rejected its token with err,
+// until Reauthorized is called. It is used for mappings whose account has
+// not been authorized yet.
+func (s *Synchronizer) AwaitAuthorization(err error) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	s.authErr = err
+}
+
+// requireAuth fails fast while authorization is invalid.
+func (s *Synchronizer) requireAuth() error {
+	if err := s.AuthError(); err != nil {
+		return fmt.Errorf("%w: %v", ErrReauthRequired, err)
+	}
+	return nil
+}
+
+// checkAuth records a revoked token and notifies OnReauthRequired the first
+// time it is seen. Other errors are returned unchanged.
+func (s *Synchronizer) checkAuth(err error) error {
+	if !googlecalendar.IsTokenRevoked(err) {
+		return err
+	}
+	s.authMu.Lock()
+	first := s.authErr == nil
+	if first {
+		s.authErr = err
+	}
+	s.authMu.Unlock()
+
+	if first {
+		log.Printf("Google authorization expired or was revoked, pausing synchronization: %v", err)
+		if s.OnReauthRequired != nil {
+			s.OnReauthRequired(err)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrReauthRequired, err)
+}
+
+// googleClient returns the calendar client of s to the passes of other
+// mappings, which run while Reauthorized may replace it.
+func (s *Synchronizer) googleClient() GCalClient {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return s.GoogleCalendarClient
+}
+
+// calendar returns the calendar client guarded against a revoked token,
+// journaling its writes.
+func (s *Synchronizer) calendar() GCalClient {
+	return journaledCalendar{GCalClient: authGuard{GCalClient: s.GoogleCalendarClient, s: s}, s: s}
+}
+
+// authGuard refuses calendar requests, in particular deletions and moves,
+// once authorization failed, and detects the failure on every response.
+type authGuard struct {
+	GCalClient
+	s *Synchronizer
+}
+
+func (g authGuard) FetchEvents(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, "", err
+	}
+	events, token, err := g.GCalClient.FetchEvents(calendarID, syncToken)
+	return events, token, g.s.checkAuth(err)
+}
+
+func (g authGuard) GetEvent(calendarID, eventID string) (*googlecalendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.GetEvent(calendarID, eventID)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) CreateEvent(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.CreateEvent(calendarID, eventID, summary, description, location, start, end, allDay, visibility, transparency)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) UpdateEvent(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.UpdateEvent(calendarID, eventID, summary, description, location, start, end, allDay, visibility, transparency)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) MoveEvent(calendarID, eventID, destinationCalendarID string) (*calendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.MoveEvent(calendarID, eventID, destinationCalendarID)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) SetIssueID(calendarID, eventID, issueID string) (*calendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.SetIssueID(calendarID, eventID, issueID)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) SetColor(calendarID, eventID, colorID string) (*calendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.SetColor(calendarID, eventID, colorID)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) SetRecurrence(calendarID, eventID string, start, end time.Time, recurrence []string) (*calendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.SetRecurrence(calendarID, eventID, start, end, recurrence)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) PatchEvent(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	event, err := g.GCalClient.PatchEvent(calendarID, eventID, patch)
+	return event, g.s.checkAuth(err)
+}
+
+func (g authGuard) DeleteEvent(calendarID, eventID string) error {
+	if err := g.s.requireAuth(); err != nil {
+		return err
+	}
+	return g.s.checkAuth(g.GCalClient.DeleteEvent(calendarID, eventID))
+}
+
+func (g authGuard) FreeBusy(calendarIDs []string, from, to time.Time) ([]googlecalendar.Busy, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	busy, err := g.GCalClient.FreeBusy(calendarIDs, from, to)
+	return busy, g.s.checkAuth(err)
+}
+
+func (g authGuard) ListEvents(calendarID string, from, to time.Time) ([]*googlecalendar.Event, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	events, err := g.GCalClient.ListEvents(calendarID, from, to)
+	return events, g.s.checkAuth(err)
+}
+
+func (g authGuard) GetCalendar(calendarID string) (*calendar.Calendar, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	cal, err := g.GCalClient.GetCalendar(calendarID)
+	return cal, g.s.checkAuth(err)
+}
+
+func (g authGuard) CreateCalendar(summary string) (*calendar.Calendar, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	cal, err := g.GCalClient.CreateCalendar(summary)
+	return cal, g.s.checkAuth(err)
+}
+
+func (g authGuard) ShareCalendar(calendarID, scopeType, address, role string) error {
+	if err := g.s.requireAuth(); err != nil {
+		return err
+	}
+	return g.s.checkAuth(g.GCalClient.ShareCalendar(calendarID, scopeType, address, role))
+}
+
+func (g authGuard) UnshareCalendar(calendarID, scopeType, address string) error {
+	if err := g.s.requireAuth(); err != nil {
+		return err
+	}
+	return g.s.checkAuth(g.GCalClient.UnshareCalendar(calendarID, scopeType, address))
+}
+
+func (g authGuard) CalendarACL(calendarID string) ([]*calendar.AclRule, error) {
+	if err := g.s.requireAuth(); err != nil {
+		return nil, err
+	}
+	rules, err := g.GCalClient.CalendarACL(calendarID)
+	return rules, g.s.checkAuth(err)
+}
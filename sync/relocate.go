@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// SetSiblings replaces Siblings once a running pass has finished.
+func (s *Synchronizer) SetSiblings(siblings []*Synchronizer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Siblings = siblings
+}
+
+// relocate takes over the event of issue from the sibling whose query the
+// issue left, for instance after it moved to another project or assignee,
+// and returns the sync item linking it on the calendar of s. Events are
+// moved when both mappings use the same Google account; otherwise the old
+// event is deleted and nil is returned, so that a new one is created. It
+// returns nil when no sibling synced the issue.
+//
+// The item of the sibling is deleted before the event leaves its calendar,
+// so that the sibling does not take the event's disappearance for a
+// deletion of the issue.
+func (s *Synchronizer) relocate(issue youtrack.Issue) (*SyncItem, error) {
+	observed, observing := s.GoogleCalendarClient.(observedCalendar)
+	client := s.GoogleCalendarClient
+	if observing {
+		client = observed.GCalClient
+	}
+
+	for _, sibling := range s.Siblings {
+		old, err := sibling.DB.GetSyncItemByYTID(issue.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to get sync item of mapping with calendar %s: %w", sibling.CalendarID, err)
+		}
+		if old == nil || !old.GCalID.Valid {
+			continue
+		}
+		query, err := sibling.IssueQuery()
+		if err != nil {
+			return nil, err
+		}
+		matches, err := sibling.YouTrackClient.MatchesQuery(query, issue.ReadableID())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check query of mapping with calendar %s: %w", sibling.CalendarID, err)
+		}
+		if matches {
+			// The issue belongs to both mappings.
+			continue
+		}
+
+		log.Printf("Moving Google Calendar event %s of YouTrack task %s from calendar %s to %s\n", old.GCalID.String, issue.ReadableID(), sibling.CalendarID, s.CalendarID)
+		// An observed pass reports the changes but leaves the sibling's state alone.
+		if !observing {
+			if err := sibling.DB.DeleteSyncItem(old.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete sync item of mapping with calendar %s: %w", sibling.CalendarID, err)
+			}
+		}
+		from := sibling.googleClient()
+		if from != client {
+			if observing {
+				from = observedCalendar{GCalClient: from, feed: observed.feed}
+			}
+			err := authGuard{GCalClient: from, s: sibling}.DeleteEvent(sibling.CalendarID, old.GCalID.String)
+			if err != nil && !errors.Is(err, googlecalendar.ErrNotFound) {
+				return nil, s.restoreSyncItem(sibling, old, fmt.Errorf("failed to delete event from calendar %s: %w", sibling.CalendarID, err))
+			}
+			return nil, nil
+		}
+
+		event, err := s.calendar().MoveEvent(sibling.CalendarID, old.GCalID.String, s.CalendarID)
+		if err != nil {
+			return nil, s.restoreSyncItem(sibling, old, fmt.Errorf("failed to move event to calendar %s: %w", s.CalendarID, err))
+		}
+		// Without an update time the issue is written to the event right
+		// away, with the settings of this mapping.
+		updatedTime, _ := time.Parse(time.RFC3339, event.Updated)
+		item := &SyncItem{
+			GCalID:        sql.NullString{String: event.Id, Valid: true},
+			YTID:          sql.NullString{String: issue.ID, Valid: true},
+			YTReadableID:  readableID(issue),
+			GCalUpdatedAt: sql.NullTime{Time: updatedTime, Valid: event.Updated != ""},
+		}
+		id, err := s.DB.CreateSyncItem(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sync item: %w", err)
+		}
+		item.ID = int(id)
+		return item, nil
+	}
+	return nil, nil
+}
+
+// restoreSyncItem puts back the item of sibling that relocate deleted before
+// failing with err.
+func (s *Synchronizer) restoreSyncItem(sibling *Synchronizer, item *SyncItem, err error) error {
+	if _, observing := s.GoogleCalendarClient.(observedCalendar); observing {
+		return err
+	}
+	if _, restoreErr := sibling.DB.CreateSyncItem(item); restoreErr != nil {
+		return fmt.Errorf("%w; failed to restore sync item: %v", err, restoreErr)
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/youtrack"
+)
+
+// ResolvedAction determines what happens to the calendar event of an
+// already-synced issue once the issue is resolved.
+type ResolvedAction string
+
+const (
+	// ResolvedActionStop stops updating the event, which keeps the content
+	// it had when the issue was resolved.
+	ResolvedActionStop ResolvedAction = "stop"
+	// ResolvedActionNone keeps updating the event like any other issue.
+	ResolvedActionNone ResolvedAction = "none"
+	// ResolvedActionDelete deletes the event and forgets the pairing.
+	ResolvedActionDelete ResolvedAction = "delete"
+	// ResolvedActionDone prefixes the event summary with DoneSummaryPrefix.
+	ResolvedActionDone ResolvedAction = "done"
+	// ResolvedActionShorten ends the event on the day the issue was resolved.
+	ResolvedActionShorten ResolvedAction = "shorten"
+	// ResolvedActionArchive moves the event to the archive calendar and forgets the pairing.
+	ResolvedActionArchive ResolvedAction = "archive"
+)
+
+// DoneSummaryPrefix marks the summary of events whose issue has been resolved.
+const DoneSummaryPrefix = "✔ "
+
+// ParseResolvedAction parses a ResolvedAction. An empty value yields ResolvedActionStop.
+func ParseResolvedAction(value string) (ResolvedAction, error) {
+	switch action := ResolvedAction(strings.ToLower(strings.TrimSpace(value))); action {
+	case "":
+		return ResolvedActionStop, nil
+	case ResolvedActionStop, ResolvedActionNone, ResolvedActionDelete, ResolvedActionDone, ResolvedActionShorten, ResolvedActionArchive:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown resolved action %q", value)
+	}
+}
+
+// handleResolvedIssue applies the configured ResolvedAction to the event
+// paired with a resolved issue. An unset ResolvedAction is ResolvedActionStop.
+func (s *Synchronizer) handleResolvedIssue(issue youtrack.Issue, syncItem *SyncItem) error {
+	eventID := syncItem.GCalID.String
+	switch s.ResolvedAction {
+	case ResolvedActionDelete:
+		log.Printf("YouTrack task '%s' was resolved. Deleting Google Calendar event %s.", issue.Summary, eventID)
+		if err := s.calendar().DeleteEvent(s.CalendarID, eventID); err != nil {
+			return fmt.Errorf("failed to delete event %s: %w", eventID, err)
+		}
+		return s.DB.DeleteSyncItem(syncItem.ID)
+	case ResolvedActionArchive:
+		log.Printf("YouTrack task '%s' was resolved. Moving Google Calendar event %s to %s.", issue.Summary, eventID, s.ArchiveCalendarID)
+		if s.ArchiveCalendarID == "" {
+			return fmt.Errorf("no archive calendar configured for event %s", eventID)
+		}
+		if _, err := s.calendar().MoveEvent(s.CalendarID, eventID, s.ArchiveCalendarID); err != nil {
+			return fmt.Errorf("failed to move event %s to archive calendar: %w", eventID, err)
+		}
+		return s.DB.DeleteSyncItem(syncItem.ID)
+	case ResolvedActionDone:
+		log.Printf("YouTrack task '%s' was resolved. Marking Google Calendar event %s as done.", issue.Summary, eventID)
+		summary := issue.Summary
+		if !strings.HasPrefix(summary, DoneSummaryPrefix) {
+			summary = DoneSummaryPrefix + summary
+		}
+		summary = s.EventMarker.apply(summary)
+		if _, err := s.managedCalendar().UpdateEvent(s.CalendarID, eventID, &summary, nil, nil, time.Time{}, time.Time{}, false, "", ""); err != nil {
+			return fmt.Errorf("failed to mark event %s as done: %w", eventID, err)
+		}
+	case ResolvedActionShorten:
+		start, end, allDay := s.eventTimes(issueDueDate(issue), s.eventDuration(issue))
+		if syncItem.EventStart.Valid {
+			start, end = syncItem.EventStart.Time, syncItem.EventStart.Time.Add(end.Sub(start))
+		}
+		// Only the end moves; an issue resolved before the event starts
+		// leaves it at its shortest.
+		resolved := time.UnixMilli(issue.Resolved)
+		if resolved.Before(start) {
+			resolved = start
+		}
+		if resolved.Before(end) {
+			log.Printf("YouTrack task '%s' was resolved. Shortening Google Calendar event %s.", issue.Summary, eventID)
+			if _, err := s.managedCalendar().UpdateEvent(s.CalendarID, eventID, nil, nil, nil, time.Time{}, resolved, allDay, "", ""); err != nil {
+				return fmt.Errorf("failed to shorten event %s: %w", eventID, err)
+			}
+		}
+	case ResolvedActionNone:
+		return nil
+	default:
+		log.Printf("YouTrack task '%s' was resolved. No longer updating Google Calendar event %s.", issue.Summary, eventID)
+	}
+
+	syncItem.YTUpdatedAt = sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true}
+	syncItem.YTHash = syncedHash(issueHash(issue))
+	return s.DB.UpdateSyncItem(syncItem)
+}
@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Attendee response statuses reported by Google Calendar.
+const (
+	ResponseAccepted    = "accepted"
+	ResponseDeclined    = "declined"
+	ResponseTentative   = "tentative"
+	ResponseNeedsAction = "needsAction"
+)
+
+// ResponsePolicy maps the user's own attendee response on an event onto the
+// linked YouTrack issue. The zero value does nothing.
+type ResponsePolicy struct {
+	// Field is the enum custom field that receives the response.
+	Field string
+	// Values translates response statuses into Field values; statuses
+	// without an entry are written as-is.
+	Values map[string]string
+	// DeclinedPriority is written to the Priority field when the event is declined.
+	DeclinedPriority string
+	// DeclinedClearsDueDate clears the issue due date when the event is declined.
+	DeclinedClearsDueDate bool
+	// States translates response statuses into State values, which are set
+	// with a YouTrack command so that the workflow of the project applies,
+	// e.g. tentative to Waiting. Statuses without an entry leave the state.
+	States map[string]string
+	// Declined selects how declined events are synced; empty syncs them
+	// like others.
+	Declined DeclinedAction
+}
+
+// DeclinedAction selects how events the user declined are synced.
+type DeclinedAction string
+
+const (
+	// DeclinedActionNone syncs declined events like others.
+	DeclinedActionNone DeclinedAction = "none"
+	// DeclinedActionSkip creates no issues for declined events. Events
+	// declined after their issue was created keep syncing.
+	DeclinedActionSkip DeclinedAction = "skip"
+	// DeclinedActionCancel treats declined events as cancelled: they create
+	// no issues, and once the event of an issue is declined, the response
+	// is written to the issue, which then loses its due date and its link
+	// to the event.
+	DeclinedActionCancel DeclinedAction = "cancel"
+)
+
+// ParseDeclinedAction parses a DeclinedAction. An empty value yields
+// DeclinedActionNone.
+func ParseDeclinedAction(value string) (DeclinedAction, error) {
+	switch action := DeclinedAction(strings.ToLower(strings.TrimSpace(value))); action {
+	case "":
+		return DeclinedActionNone, nil
+	case DeclinedActionNone, DeclinedActionSkip, DeclinedActionCancel:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown declined action %q", value)
+	}
+}
+
+// skipsCreation reports whether an event with the response status creates
+// no issue.
+func (p ResponsePolicy) skipsCreation(status string) bool {
+	return status == ResponseDeclined && (p.Declined == DeclinedActionSkip || p.Declined == DeclinedActionCancel)
+}
+
+// cancels reports whether an event with the response status is treated as
+// cancelled.
+func (p ResponsePolicy) cancels(status string) bool {
+	return status == ResponseDeclined && p.Declined == DeclinedActionCancel
+}
+
+// noDueDate clears the due date of an issue.
+var noDueDate = youtrack.CustomFieldWrapper{
+	YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"},
+	Name:         "Due Date",
+}
+
+// clearsDueDate reports whether the issue due date should be withheld for status.
+func (p ResponsePolicy) clearsDueDate(status string) bool {
+	return p.DeclinedClearsDueDate && status == ResponseDeclined
+}
+
+// applyResponse writes the attendee response to the issue paired with item
+// when it differs from the last response recorded for that item.
+func (s *Synchronizer) applyResponse(item *SyncItem, status string) error {
+	if status == "" || (item.ResponseStatus.Valid && item.ResponseStatus.String == status) {
+		return nil
+	}
+
+	var fields []youtrack.CustomFieldWrapper
+	if s.Response.Field != "" {
+		value := status
+		if mapped, ok := s.Response.Values[status]; ok {
+			value = mapped
+		}
+		fields = append(fields, youtrack.EnumField(s.Response.Field, value))
+	}
+	if status == ResponseDeclined {
+		if s.Response.DeclinedPriority != "" {
+			fields = append(fields, youtrack.EnumField("Priority", s.Response.DeclinedPriority))
+		}
+		if s.Response.clearsDueDate(status) {
+			fields = append(fields, noDueDate)
+		}
+	}
+
+	yt := s.managedYouTrack()
+	if len(fields) > 0 {
+		if err := yt.UpdateCustomFields(item.YTID.String, fields); err != nil {
+			return err
+		}
+	}
+	if state, ok := s.Response.States[status]; ok {
+		if err := yt.ApplyCommand(item.YTID.String, youtrack.FieldCommand("State", state)); err != nil {
+			return err
+		}
+	}
+	item.ResponseStatus = sql.NullString{String: status, Valid: true}
+	return nil
+}
@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// RunResult summarizes a synchronization pass.
+type RunResult struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// Paused is set when synchronization was paused, so that the pass only
+	// planned the writes it reports.
+	Paused bool   `json:"paused,omitempty"`
+	Counts Counts `json:"counts"`
+	// Items lists the writes of the pass in the order they were made.
+	Items []ItemOutcome `json:"items"`
+	// Errors lists the per-item failures that were logged and skipped.
+	Errors []string `json:"errors"`
+	// Queued counts the YouTrack writes queued while YouTrack was
+	// unreachable, see Outbox.
+	Queued int `json:"queued,omitempty"`
+}
+
+// Counts tallies the writes of a pass by kind. Moves, tags, links and
+// comments count as updates.
+type Counts struct {
+	EventsCreated int `json:"eventsCreated"`
+	EventsUpdated int `json:"eventsUpdated"`
+	EventsDeleted int `json:"eventsDeleted"`
+	IssuesCreated int `json:"issuesCreated"`
+	IssuesUpdated int `json:"issuesUpdated"`
+	Failed        int `json:"failed"`
+}
+
+// Plus returns the sum of c and o, e.g. to total the passes of several
+// mappings.
+func (c Counts) Plus(o Counts) Counts {
+	return Counts{
+		EventsCreated: c.EventsCreated + o.EventsCreated,
+		EventsUpdated: c.EventsUpdated + o.EventsUpdated,
+		EventsDeleted: c.EventsDeleted + o.EventsDeleted,
+		IssuesCreated: c.IssuesCreated + o.IssuesCreated,
+		IssuesUpdated: c.IssuesUpdated + o.IssuesUpdated,
+		Failed:        c.Failed + o.Failed,
+	}
+}
+
+// ItemOutcome is a write made to an event or issue.
+type ItemOutcome struct {
+	// Target is ChangeTargetGoogle or ChangeTargetYouTrack.
+	Target string `json:"target"`
+	// Action is the action of the write, as in Change.
+	Action string `json:"action"`
+	// ID is the event or issue written, as created for creations.
+	ID string `json:"id"`
+}
+
+// Failed reports whether any item failed during the pass.
+func (r RunResult) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+func (r RunResult) clone() RunResult {
+	r.Items = append([]ItemOutcome{}, r.Items...)
+	r.Errors = append([]string{}, r.Errors...)
+	return r
+}
+
+// LastResult returns the result of the most recent Sync, SyncIssue or SyncEvent.
+func (s *Synchronizer) LastResult() RunResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.result.clone()
+}
+
+func (s *Synchronizer) beginResult() {
+	s.result = RunResult{Started: s.now(), Items: []ItemOutcome{}, Errors: []string{}}
+	s.halt = nil
+}
+
+func (s *Synchronizer) endResult() {
+	s.result.Duration = s.now().Sub(s.result.Started)
+}
+
+// recordOutcome records a write that succeeded in the current result.
+func (s *Synchronizer) recordOutcome(target, action, id string) {
+	s.result.Items = append(s.result.Items, ItemOutcome{Target: target, Action: action, ID: id})
+	counts := &s.result.Counts
+	switch {
+	case target == ChangeTargetGoogle && action == "create":
+		counts.EventsCreated++
+	case target == ChangeTargetGoogle && action == "delete":
+		counts.EventsDeleted++
+	case target == ChangeTargetGoogle:
+		counts.EventsUpdated++
+	case action == "create":
+		counts.IssuesCreated++
+	default:
+		counts.IssuesUpdated++
+	}
+}
+
+// logError logs a per-item failure and records it in the current result.
+// An error among args that ends the pass is noted, see haltOn.
+func (s *Synchronizer) logError(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	s.result.Errors = append(s.result.Errors, strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+	s.result.Counts.Failed++
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			s.haltOn(err)
+		}
+	}
+}
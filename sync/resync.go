@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Resync discards the sync cursors and reconciles every upcoming event with
+// every issue of the query project or saved search. Unlinked events and issues that match
+// by summary and date are linked with their current update times instead of
+// being created again; everything else is synced as in a regular pass.
+func (s *Synchronizer) Resync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beginResult()
+	defer s.endResult()
+	if err := s.startDryRun(); err != nil {
+		return err
+	}
+	if err := s.requireAuth(); err != nil {
+		return err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return err
+	}
+	if err := s.requireRunning(); err != nil {
+		return err
+	}
+
+	log.Println("Starting full resynchronization...")
+	if err := s.DB.ResetCursors(); err != nil {
+		return fmt.Errorf("failed to reset sync cursors: %w", err)
+	}
+
+	gcalEvents, newGCalSyncToken, err := s.calendar().FetchEvents(s.CalendarID, "")
+	if err != nil {
+		return fmt.Errorf("failed to fetch Google Calendar events: %w", err)
+	}
+	query, err := s.IssueQuery()
+	if err != nil {
+		return err
+	}
+	ytIssues, err := s.YouTrackClient.GetUpdatedIssues(s.fetchQuery(query), time.Unix(0, 0))
+	if err != nil {
+		return fmt.Errorf("failed to fetch YouTrack issues: %w", err)
+	}
+	ytIssues = s.withoutDrafts(ytIssues)
+
+	linked, err := s.linkMatches(gcalEvents, ytIssues)
+	if err != nil {
+		return err
+	}
+	log.Printf("Linked %d existing event and issue pairs.\n", linked)
+
+	if err := s.processGCalEvents(gcalEvents); err != nil {
+		return err
+	}
+	if err := s.processYTissues(ytIssues); err != nil {
+		return err
+	}
+	if err := s.handleDeletions(gcalEvents); err != nil {
+		return err
+	}
+
+	if newGCalSyncToken != "" {
+		if err := s.DB.SetGCalSyncToken(newGCalSyncToken); err != nil {
+			s.logError("Error setting Google Calendar sync token: %v\n", err)
+		}
+	}
+	var latest int64
+	for _, issue := range ytIssues {
+		latest = max(latest, issue.Updated)
+	}
+	if latest > 0 {
+		if err := s.DB.SetYTLastSync(time.UnixMilli(latest)); err != nil {
+			s.logError("Error setting YouTrack last sync time: %v\n", err)
+		}
+	}
+
+	log.Println("Full resynchronization finished.")
+	return nil
+}
+
+// linkMatches links every unlinked event to an unlinked issue with the same
+// summary whose due date is within a day of the event start, and returns
+// the number of links created.
+func (s *Synchronizer) linkMatches(events []*googlecalendar.Event, issues []youtrack.Issue) (int, error) {
+	var candidates []youtrack.Issue
+	for _, issue := range issues {
+		if issueDueDate(issue).IsZero() {
+			continue
+		}
+		item, err := s.DB.GetSyncItemByYTID(issue.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, fmt.Errorf("failed to get sync item for YouTrack issue %s: %w", issue.ID, err)
+		}
+		if item == nil {
+			candidates = append(candidates, issue)
+		}
+	}
+
+	linked := 0
+	for _, event := range events {
+		if event.Status == "cancelled" || len(candidates) == 0 || !s.EventMarker.marks(event.Summary) || s.isWorkBlock(event) {
+			continue
+		}
+		item, err := s.DB.GetSyncItemByGCalID(event.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, fmt.Errorf("failed to get sync item for GCal event %s: %w", event.ID, err)
+		}
+		if item != nil {
+			continue
+		}
+		for i, issue := range candidates {
+			if !s.matches(event, issue) {
+				continue
+			}
+			if _, err := s.DB.CreateSyncItem(&SyncItem{
+				GCalID:        sql.NullString{String: event.ID, Valid: true},
+				YTID:          sql.NullString{String: issue.ID, Valid: true},
+				YTReadableID:  readableID(issue),
+				GCalUpdatedAt: sql.NullTime{Time: event.Updated, Valid: true},
+				YTUpdatedAt:   sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true},
+			}); err != nil {
+				return 0, fmt.Errorf("failed to link event %s to issue %s: %w", event.ID, issue.ID, err)
+			}
+			candidates = append(candidates[:i], candidates[i+1:]...)
+			linked++
+			break
+		}
+	}
+	return linked, nil
+}
+
+// matches reports whether issue is the counterpart of event.
+func (s *Synchronizer) matches(event *googlecalendar.Event, issue youtrack.Issue) bool {
+	summary := stripSubtaskPrefix(s.EventMarker.strip(event.Summary))
+	if strings.TrimSpace(summary) != strings.TrimSpace(issue.Summary) {
+		return false
+	}
+	offset := s.eventDueDate(event).Sub(issueDueDate(issue))
+	return offset > -24*time.Hour && offset < 24*time.Hour
+}
@@ -0,0 +1,181 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// Rollup replaces the events of issues with one all-day event per day,
+// titled "Deadlines: PRJ-1, PRJ-2 (+3 more)" and listing the issues due that
+// day in its description. Issues already linked to an event keep it.
+type Rollup struct {
+	// Horizon is how far ahead days are rolled up.
+	Horizon time.Duration
+	// TitleIssues is how many issues the title names before "(+n more)".
+	TitleIssues int
+}
+
+// Defaults of Rollup.Horizon and Rollup.TitleIssues.
+const (
+	DefaultRollupHorizon     = 14 * 24 * time.Hour
+	DefaultRollupTitleIssues = 3
+)
+
+// rollUpDeadlines writes the rollup events of the days within the horizon,
+// deletes those of days no longer due any issue, and forgets past days.
+func (s *Synchronizer) rollUpDeadlines() error {
+	horizon, titled := s.Rollup.Horizon, s.Rollup.TitleIssues
+	if horizon <= 0 {
+		horizon = DefaultRollupHorizon
+	}
+	if titled <= 0 {
+		titled = DefaultRollupTitleIssues
+	}
+	now := s.now()
+	today := now.Format("2006-01-02")
+	query, err := s.IssueQuery()
+	if err != nil {
+		return err
+	}
+	year, month, day := now.Date()
+	issues, err := s.YouTrackClient.GetDueIssues(query, time.Date(year, month, day, 0, 0, 0, 0, now.Location()), now.Add(horizon))
+	if err != nil {
+		return fmt.Errorf("failed to fetch upcoming YouTrack issues: %w", err)
+	}
+	rollups, err := s.DB.GetRollups()
+	if err != nil {
+		return err
+	}
+
+	due := make(map[string][]youtrack.Issue)
+	for _, issue := range issues {
+		if issue.IsResolved() || issue.IsDraft && !s.IncludeDrafts || s.skipsSubtask(issue) {
+			continue
+		}
+		if _, err := s.DB.GetSyncItemByYTID(issue.ID); err == nil {
+			continue
+		} else if !errors.Is(err, ErrNotFound) {
+			s.logError("Error getting sync item for YouTrack issue %s: %v\n", issue.ID, err)
+			continue
+		}
+		if d := rollupDay(issueDueDate(issue)); d >= today {
+			due[d] = append(due[d], issue)
+		}
+	}
+
+	written := make(map[string]RollupEvent)
+	for _, r := range rollups {
+		switch {
+		case r.Day < today:
+			if err := s.DB.DeleteRollup(r.Day); err != nil {
+				s.logError("Error forgetting rollup event of %s: %v\n", r.Day, err)
+			}
+		case len(due[r.Day]) == 0:
+			log.Printf("Deleting rollup event of %s\n", r.Day)
+			if err := s.calendar().DeleteEvent(s.CalendarID, r.GCalID); err != nil && !errors.Is(err, googlecalendar.ErrNotFound) {
+				s.logError("Error deleting rollup event of %s: %v\n", r.Day, err)
+				continue
+			}
+			if err := s.DB.DeleteRollup(r.Day); err != nil {
+				s.logError("Error deleting rollup event of %s: %v\n", r.Day, err)
+			}
+		default:
+			written[r.Day] = r
+		}
+	}
+
+	days := make([]string, 0, len(due))
+	for d := range due {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+	for _, d := range days {
+		if err := s.writeRollup(d, due[d], written[d], titled); err != nil {
+			s.logError("Error writing rollup event of %s: %v\n", d, err)
+		}
+	}
+	return nil
+}
+
+// writeRollup creates or updates the rollup event of day for issues, unless
+// it was last written for the same issues.
+func (s *Synchronizer) writeRollup(day string, issues []youtrack.Issue, current RollupEvent, titled int) error {
+	sort.Slice(issues, func(i, j int) bool { return issues[i].ReadableID() < issues[j].ReadableID() })
+	summary, description := s.rollupContent(issues, titled)
+	digest := descriptionHash(summary + "\n" + description)
+	if current.Digest == digest {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return err
+	}
+	if current.GCalID != "" {
+		log.Printf("Updating rollup event of %s\n", day)
+		_, err := s.calendar().UpdateEvent(s.CalendarID, current.GCalID, &summary, &description, nil, date, date, true, s.EventVisibility, "transparent")
+		if err == nil {
+			return s.DB.SaveRollup(RollupEvent{Day: day, GCalID: current.GCalID, Digest: digest})
+		}
+		if !errors.Is(err, googlecalendar.ErrNotFound) {
+			return err
+		}
+	}
+	log.Printf("Creating rollup event of %s\n", day)
+	event, err := s.calendar().CreateEvent(s.CalendarID, "", summary, description, "", date, date, true, s.EventVisibility, "transparent")
+	if err != nil {
+		return err
+	}
+	return s.DB.SaveRollup(RollupEvent{Day: day, GCalID: event.Id, Digest: digest})
+}
+
+// rollupContent returns the summary naming the first titled of issues and
+// the description linking all of them.
+func (s *Synchronizer) rollupContent(issues []youtrack.Issue, titled int) (string, string) {
+	var ids, lines []string
+	for _, issue := range issues {
+		ids = append(ids, issue.ReadableID())
+		lines = append(lines, s.issueLine(issue))
+	}
+	summary := "Deadlines: " + strings.Join(ids[:min(titled, len(ids))], ", ")
+	if len(ids) > titled {
+		summary += fmt.Sprintf(" (+%d more)", len(ids)-titled)
+	}
+	return summary, strings.Join(lines, "<br>")
+}
+
+// issueLine returns the link to issue followed by its summary, as HTML.
+func (s *Synchronizer) issueLine(issue youtrack.Issue) string {
+	id := issue.ReadableID()
+	return fmt.Sprintf(`<a href="%s/issue/%s">%s</a> %s`, s.YouTrackClient.GetBaseURL(), id, id, html.EscapeString(issue.Summary))
+}
+
+// rollupDay returns the day due falls on, as 2006-01-02. Date-only due dates
+// are midnight UTC and keep their date.
+func rollupDay(due time.Time) string {
+	if hour, minute, second := due.UTC().Clock(); hour == 0 && minute == 0 && second == 0 {
+		due = due.UTC()
+	}
+	return due.Format("2006-01-02")
+}
+
+// isRollup reports whether event is a rollup event, so that it does not
+// become an issue of its own.
+func (s *Synchronizer) isRollup(event *googlecalendar.Event) bool {
+	if s.Rollup == nil {
+		return false
+	}
+	rollup, err := s.DB.IsRollup(event.ID)
+	if err != nil {
+		s.logError("Error looking up rollup event %s: %v\n", event.ID, err)
+		return true
+	}
+	return rollup
+}
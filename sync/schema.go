@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"youtrack-calendar-sync/youtrack"
+)
+
+// ErrSchemaMismatch is returned by ValidateFields when the project lacks a
+// field the synchronizer writes or has it with an incompatible type.
+var ErrSchemaMismatch = errors.New("project does not match the configuration")
+
+// fieldTypesByKind lists the YouTrack field type IDs that accept values
+// written with each custom field kind.
+var fieldTypesByKind = map[string][]string{
+	youtrack.FieldKindEnum:      {"enum[1]"},
+	youtrack.FieldKindMultiEnum: {"enum[*]"},
+	youtrack.FieldKindState:     {"state[1]"},
+	youtrack.FieldKindUser:      {"user[1]"},
+	youtrack.FieldKindString:    {"string"},
+	youtrack.FieldKindText:      {"text"},
+}
+
+// requiredFields returns the custom fields the synchronizer writes with the
+// current configuration, mapped to the field types they must have.
+func (s *Synchronizer) requiredFields() map[string][]string {
+	required := map[string][]string{
+		"Due Date": {"date", "date and time"},
+	}
+	if s.Response.Field != "" {
+		required[s.Response.Field] = fieldTypesByKind[youtrack.FieldKindEnum]
+	}
+	if s.Response.DeclinedPriority != "" {
+		required["Priority"] = fieldTypesByKind[youtrack.FieldKindEnum]
+	}
+	if s.ConferenceField != "" {
+		required[s.ConferenceField] = fieldTypesByKind[youtrack.FieldKindString]
+	}
+	if s.LocationField != "" {
+		required[s.LocationField] = fieldTypesByKind[youtrack.FieldKindString]
+	}
+	if s.IssueType != "" || len(s.IssueTypeRules) > 0 {
+		required["Type"] = fieldTypesByKind[youtrack.FieldKindEnum]
+	}
+	if s.AssignOrganizer {
+		required["Assignee"] = fieldTypesByKind[youtrack.FieldKindUser]
+	}
+	for _, def := range s.DefaultFields {
+		required[def.Name] = fieldTypesByKind[def.Kind]
+	}
+	return required
+}
+
+// ValidateFields checks that every custom field the synchronizer writes exists
+// in the YouTrack project with a compatible type, so misconfiguration fails at
+// startup rather than as rejected updates during sync. Only a mismatch wraps
+// ErrSchemaMismatch; the schema may also be unreadable, as the endpoint is
+// restricted to project admins, or YouTrack unreachable.
+func (s *Synchronizer) ValidateFields() error {
+	fields, err := s.YouTrackClient.GetProjectCustomFields(s.YouTrackProjectID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch custom fields of project %s: %w", s.YouTrackProjectID, err)
+	}
+	types := make(map[string]string, len(fields))
+	for _, field := range fields {
+		types[field.Name()] = field.FieldType()
+	}
+
+	var problems []string
+	for name, allowed := range s.requiredFields() {
+		fieldType, ok := types[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("custom field %q does not exist", name))
+		} else if !contains(allowed, fieldType) {
+			problems = append(problems, fmt.Sprintf("custom field %q has type %s, expected %s", name, fieldType, strings.Join(allowed, " or ")))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("project %s: %w: %s", s.YouTrackProjectID, ErrSchemaMismatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// DefaultClockSkew is the default of ClockSkew.
+const DefaultClockSkew = 2 * time.Second
+
+// updatedSince reports whether an item updated at updated changed since it
+// was last synced at synced. Update times within ClockSkew of the sync are
+// too close to order, as the clocks of Google, YouTrack and the
+// synchronizer may differ by seconds; for those, hash, the content hash of
+// the item now, is compared to stored, its hash at the sync. Without a hash,
+// an update within the window counts as changed unless it is the synced one
+// itself, so that the caller fetches the item to compare; a missing stored
+// hash falls back to the update times.
+func (s *Synchronizer) updatedSince(updated, synced time.Time, hash string, stored sql.NullString) bool {
+	switch {
+	case s.ClockSkew <= 0 || updated.After(synced.Add(s.ClockSkew)):
+		return updated.After(synced)
+	case !updated.After(synced.Add(-s.ClockSkew)):
+		return false
+	case hash == "":
+		return !updated.Equal(synced)
+	case !stored.Valid:
+		return updated.After(synced)
+	default:
+		return hash != stored.String
+	}
+}
+
+// eventHash returns the content hash of the synced fields of event.
+func eventHash(event *googlecalendar.Event) string {
+	return contentHash(struct {
+		Summary, Description, Location       string
+		Start, End                           time.Time
+		AllDay                               bool
+		Status, ResponseStatus, Transparency string
+		ConferenceURL, ColorID               string
+	}{
+		event.Summary, event.Description, event.Location,
+		event.Start, event.End,
+		event.AllDay,
+		event.Status, event.ResponseStatus, event.Transparency,
+		event.ConferenceURL, event.ColorID,
+	})
+}
+
+// issueHash returns the content hash of issue, its update time left out.
+func issueHash(issue youtrack.Issue) string {
+	issue.Updated = 0
+	return contentHash(issue)
+}
+
+// contentHash hashes the JSON encoding of v.
+func contentHash(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// syncedHash returns hash as a stored content hash.
+func syncedHash(hash string) sql.NullString {
+	return sql.NullString{String: hash, Valid: hash != ""}
+}
@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// SubtaskMode determines how issues that are subtasks of another issue
+// appear in the calendar.
+type SubtaskMode string
+
+const (
+	// SubtaskModeEvent syncs subtasks like any other issue.
+	SubtaskModeEvent SubtaskMode = "event"
+	// SubtaskModePrefix prefixes the event summary of subtasks with
+	// SubtaskSummaryPrefix.
+	SubtaskModePrefix SubtaskMode = "prefix"
+	// SubtaskModeSkip gives subtasks no events.
+	SubtaskModeSkip SubtaskMode = "skip"
+)
+
+// SubtaskSummaryPrefix marks the summary of events whose issue is a subtask.
+const SubtaskSummaryPrefix = "↳ "
+
+// SubtaskLinkType is the YouTrack link type relating a parent to its subtasks.
+const SubtaskLinkType = "Subtask"
+
+// ParseSubtaskMode parses a SubtaskMode. An empty value yields SubtaskModeEvent.
+func ParseSubtaskMode(value string) (SubtaskMode, error) {
+	switch mode := SubtaskMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return SubtaskModeEvent, nil
+	case SubtaskModeEvent, SubtaskModePrefix, SubtaskModeSkip:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown subtask mode %q", value)
+	}
+}
+
+// skipsSubtask reports whether issue gets no event because it is a subtask.
+func (s *Synchronizer) skipsSubtask(issue youtrack.Issue) bool {
+	return s.SubtaskMode == SubtaskModeSkip && issue.IsSubtask()
+}
+
+// subtaskSummary returns the event summary of issue, prefixed when it is a
+// subtask and SubtaskMode asks for it.
+func (s *Synchronizer) subtaskSummary(issue youtrack.Issue) string {
+	if s.SubtaskMode == SubtaskModePrefix && issue.IsSubtask() {
+		return SubtaskSummaryPrefix + issue.Summary
+	}
+	return issue.Summary
+}
+
+// stripSubtaskPrefix removes SubtaskSummaryPrefix from an event summary, so
+// that it does not end up in the issue summary.
+func stripSubtaskPrefix(summary string) string {
+	return strings.TrimPrefix(summary, SubtaskSummaryPrefix)
+}
+
+// linkRecurringInstance makes the issue created for a modified occurrence
+// of a recurring event a subtask of the issue of its series. Occurrences
+// whose series is not synced are left unlinked.
+func (s *Synchronizer) linkRecurringInstance(event *googlecalendar.Event, issueID string) {
+	if !s.LinkRecurringInstances || event.RecurringEventID == "" {
+		return
+	}
+	parent, err := s.DB.GetSyncItemByGCalID(event.RecurringEventID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		s.logError("Error getting sync item for GCal event %s: %v\n", event.RecurringEventID, err)
+		return
+	}
+	if parent == nil || !parent.YTID.Valid {
+		log.Printf("Recurring event %s of %s is not synced; leaving YouTrack task %s unlinked.\n", event.RecurringEventID, event.ID, issueID)
+		return
+	}
+	if err := s.youtrack().LinkIssues(SubtaskLinkType, parent.YTID.String, issueID); err != nil {
+		s.logError("Error linking YouTrack task %s to %s: %v\n", issueID, parent.YTID.String, err)
+	}
+}
@@ -1,14 +1,28 @@
 package sync
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	gosync "sync"
 	"testing"
 	"time"
 
+	"youtrack-calendar-sync/fake"
 	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/httpclient"
 	"youtrack-calendar-sync/youtrack"
 
+	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -20,7 +34,7 @@ func setupTest(t *testing.T) (*DB, *mockGCalClient, *mockYTClient, *Synchronizer
 	gcalClient := &mockGCalClient{}
 	ytClient := &mockYTClient{}
 
-	s := NewSynchronizer(gcalClient, ytClient, db, "yt-project", "yt-query-project", "gcal-calendar")
+	s := NewSynchronizer(gcalClient, ytClient, db, WithProject("yt-project"), WithQueryProject("yt-query-project"), WithCalendar("gcal-calendar"))
 
 	cleanup := func() {
 		cleanupDB()
@@ -111,6 +125,259 @@ func TestDBUpdateAndDelete(t *testing.T) {
 	}
 }
 
+func TestDBStoredMappings(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for name, definition := range map[string]string{"work": `{"name":"work"}`, "home": `{"name":"home"}`} {
+		if err := db.SetStoredMapping(name, definition); err != nil {
+			t.Fatalf("SetStoredMapping() error = %v", err)
+		}
+	}
+	if err := db.SetStoredMapping("work", `{"name":"work","disabled":true}`); err != nil {
+		t.Fatalf("SetStoredMapping() error = %v", err)
+	}
+	definitions, err := db.GetStoredMappings()
+	if err != nil {
+		t.Fatalf("GetStoredMappings() error = %v", err)
+	}
+	if want := []string{`{"name":"home"}`, `{"name":"work","disabled":true}`}; !reflect.DeepEqual(definitions, want) {
+		t.Errorf("Expected %q, got %q", want, definitions)
+	}
+
+	if deleted, err := db.DeleteStoredMapping("home"); err != nil || !deleted {
+		t.Fatalf("DeleteStoredMapping() = %v, %v", deleted, err)
+	}
+	if deleted, err := db.DeleteStoredMapping("home"); err != nil || deleted {
+		t.Errorf("Expected a second deletion to find nothing, got %v, %v", deleted, err)
+	}
+	if tenants, err := db.GetStoredTenants(); err != nil || len(tenants) != 0 {
+		t.Errorf("Expected no stored tenants, got %q, %v", tenants, err)
+	}
+}
+
+func TestDBAPITokens(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	token, err := db.CreateAPIToken("ci", []Scope{ScopeReadStatus, ScopeTriggerSync})
+	if err != nil {
+		t.Fatalf("CreateAPIToken() error = %v", err)
+	}
+	var stored int
+	if err := db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE token_hash = ?", token).Scan(&stored); err != nil || stored != 0 {
+		t.Errorf("Expected the token to be stored hashed, got %d, %v", stored, err)
+	}
+	for scope, want := range map[Scope]bool{ScopeReadStatus: true, ScopeTriggerSync: true, ScopeManageMappings: false} {
+		if ok, err := db.APITokenHasScope(token, scope); err != nil || ok != want {
+			t.Errorf("APITokenHasScope(%s) = %v, %v, want %v", scope, ok, err, want)
+		}
+	}
+	if ok, err := db.APITokenHasScope("other", ScopeReadStatus); err != nil || ok {
+		t.Errorf("Expected an unknown token to have no scope, got %v, %v", ok, err)
+	}
+	if _, err := db.CreateAPIToken("ci", []Scope{ScopeReadStatus}); err == nil {
+		t.Error("Expected a duplicate name to fail")
+	}
+
+	if deleted, err := db.DeleteAPIToken("ci"); err != nil || !deleted {
+		t.Fatalf("DeleteAPIToken() = %v, %v", deleted, err)
+	}
+	if ok, err := db.APITokenHasScope(token, ScopeReadStatus); err != nil || ok {
+		t.Errorf("Expected a revoked token to have no scope, got %v, %v", ok, err)
+	}
+
+	if _, err := ParseScopes("read-status,admin"); err == nil {
+		t.Error("Expected an unknown scope to fail")
+	}
+	if scopes, err := ParseScopes("read-status, manage-mappings"); err != nil || !reflect.DeepEqual(scopes, []Scope{ScopeReadStatus, ScopeManageMappings}) {
+		t.Errorf("ParseScopes() = %v, %v", scopes, err)
+	}
+}
+
+func TestCopySQLite(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(filepath.Join(dir, "sync.db"))
+	if err != nil {
+		t.Fatalf("NewDB() error = %v", err)
+	}
+	defer db.Close()
+	if err := db.SetGCalSyncToken("cursor"); err != nil {
+		t.Fatalf("SetGCalSyncToken() error = %v", err)
+	}
+
+	// The copy is taken while db stays open, and replaces existing state.
+	copied, err := NewDB(filepath.Join(dir, "copy.db"))
+	if err != nil {
+		t.Fatalf("NewDB() error = %v", err)
+	}
+	copied.SetGCalSyncToken("stale")
+	copied.Close()
+	if err := CopySQLite(filepath.Join(dir, "copy.db"), filepath.Join(dir, "sync.db")); err != nil {
+		t.Fatalf("CopySQLite() error = %v", err)
+	}
+	copied, err = NewDB(filepath.Join(dir, "copy.db"))
+	if err != nil {
+		t.Fatalf("NewDB() error = %v", err)
+	}
+	defer copied.Close()
+	if token, err := copied.GetGCalSyncToken(); err != nil || token != "cursor" {
+		t.Errorf("Expected the copied cursor, got %q, %v", token, err)
+	}
+	if err := CheckSQLite(filepath.Join(dir, "copy.db")); err != nil {
+		t.Errorf("CheckSQLite() error = %v", err)
+	}
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database, but long enough to look like a header of one"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSQLite(garbage); err == nil {
+		t.Error("Expected a corrupt file to fail the check")
+	}
+}
+
+func TestDBPendingCreates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	first, err := db.BeginCreate(issueSource("PRJ-1"))
+	if err != nil {
+		t.Fatalf("BeginCreate() error = %v", err)
+	}
+	if first.Resumed || len(first.Key) != 32 {
+		t.Errorf("Expected a new creation with an event ID, got %+v", first)
+	}
+	again, err := db.BeginCreate(issueSource("PRJ-1"))
+	if err != nil {
+		t.Fatalf("BeginCreate() error = %v", err)
+	}
+	if !again.Resumed || again.Key != first.Key {
+		t.Errorf("Expected the creation to resume with key %s, got %+v", first.Key, again)
+	}
+	if p, _ := db.BeginCreate(eventSource("event1")); p == nil || p.Key != "" {
+		t.Errorf("Expected no key for the creation of an issue, got %+v", p)
+	}
+
+	if err := db.FinishCreate(issueSource("PRJ-1")); err != nil {
+		t.Fatalf("FinishCreate() error = %v", err)
+	}
+	if p, _ := db.BeginCreate(issueSource("PRJ-1")); p == nil || p.Resumed || p.Key == first.Key {
+		t.Errorf("Expected a finished creation to start over, got %+v", p)
+	}
+}
+
+func TestDBJournal(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	due := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	first, err := db.BeginOperation("earlier", Change{Target: ChangeTargetYouTrack, Action: "update", ID: "PRJ-1", Summary: nonEmpty("Budget"), DueDate: &due})
+	if err != nil {
+		t.Fatalf("BeginOperation() error = %v", err)
+	}
+	second, err := db.BeginOperation("earlier", Change{Target: ChangeTargetGoogle, Action: "delete", ID: "event1", CalendarID: "primary"})
+	if err != nil {
+		t.Fatalf("BeginOperation() error = %v", err)
+	}
+	if err := db.CompleteOperation(second); err != nil {
+		t.Fatalf("CompleteOperation() error = %v", err)
+	}
+
+	entries, err := db.IncompleteOperations("current", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("IncompleteOperations() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != first || entries[0].Owner != "earlier" || textOf(entries[0].Change.Summary) != "Budget" || !entries[0].Change.DueDate.Equal(due) {
+		t.Errorf("Expected only the incomplete update, got %+v", entries)
+	}
+	if entries, _ := db.IncompleteOperations("current", time.Now().Add(-time.Minute)); len(entries) != 0 {
+		t.Errorf("Expected no entries started before the cutoff, got %+v", entries)
+	}
+	if entries, _ := db.IncompleteOperations("earlier", time.Now().Add(time.Minute)); len(entries) != 0 {
+		t.Errorf("Expected no entries of the run itself, got %+v", entries)
+	}
+}
+
+func TestDBConcurrentWrites(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var wg gosync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			item := &SyncItem{GCalID: sql.NullString{String: fmt.Sprintf("event%d", i), Valid: true}}
+			if _, err := db.CreateSyncItem(item); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := db.BeginCreate(eventSource(fmt.Sprintf("event%d", i))); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Concurrent write failed: %v", err)
+	}
+	if items, err := db.GetAllSyncItems(); err != nil || len(items) != 20 {
+		t.Errorf("Expected 20 sync items, got %d (error %v)", len(items), err)
+	}
+}
+
+func TestDBNotFound(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := db.GetSyncItemByGCalID("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSyncItemByGCalID() error = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetSyncItemByYTID("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSyncItemByYTID() error = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetPause(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPause() error = %v, want ErrNotFound", err)
+	}
+	if _, err := db.LatestMetrics(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LatestMetrics() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDBWithContext(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.WithContext(ctx).GetAllSyncItems(); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetAllSyncItems() error = %v, want context.Canceled", err)
+	}
+	if _, err := db.GetAllSyncItems(); err != nil {
+		t.Errorf("Expected db itself to be unaffected, got %v", err)
+	}
+}
+
+func TestDBWithClock(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	clock := newFakeClock(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC))
+	if _, err := db.WithClock(clock).BeginOperation("earlier", Change{Target: ChangeTargetGoogle, Action: "delete", ID: "event1"}); err != nil {
+		t.Fatalf("BeginOperation() error = %v", err)
+	}
+	entries, err := db.IncompleteOperations("current", clock.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("IncompleteOperations() error = %v", err)
+	}
+	if len(entries) != 1 || !entries[0].StartedAt.Equal(clock.Now()) {
+		t.Errorf("Expected the entry to be started at the time of the clock, got %+v", entries)
+	}
+}
+
 func TestSyncTokens(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -143,49 +410,266 @@ func TestSyncTokens(t *testing.T) {
 	}
 }
 
+func TestTokens(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	token, err := db.GetToken("google")
+	if err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if token != "" {
+		t.Errorf("Expected no token, got '%s'", token)
+	}
+
+	for _, value := range []string{`{"access_token":"a"}`, `{"access_token":"b"}`} {
+		if err := db.SetToken("google", value); err != nil {
+			t.Fatalf("SetToken() error = %v", err)
+		}
+	}
+	token, err = db.GetToken("google")
+	if err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if token != `{"access_token":"b"}` {
+		t.Errorf("Expected the latest token, got '%s'", token)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE sync_items SET gcal_id = ?, yt_id = ? WHERE id = ?"
+	if got := (&DB{}).rebind(query); got != query {
+		t.Errorf("Expected SQLite query to be unchanged, got '%s'", got)
+	}
+	want := "UPDATE sync_items SET gcal_id = $1, yt_id = $2 WHERE id = $3"
+	if got := (&DB{postgres: true}).rebind(query); got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+}
+
+func TestIsRemoteDSN(t *testing.T) {
+	for dsn, want := range map[string]bool{
+		"data/sync.db":                         false,
+		"file:sync.db?cache=shared":            false,
+		"postgres://user:pass@db/sync":         true,
+		"postgresql://db/sync?sslmode=disable": true,
+	} {
+		if got := IsRemoteDSN(dsn); got != want {
+			t.Errorf("IsRemoteDSN(%q) = %v, want %v", dsn, got, want)
+		}
+	}
+}
+
+func TestNewMappingDB(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "sync.db")
+	db, err := NewMappingDB(base, "work")
+	if err != nil {
+		t.Fatalf("NewMappingDB() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "sync-work.db")); err != nil {
+		t.Errorf("Expected mapping database sync-work.db, got %v", err)
+	}
+	if _, err := os.Stat(base); !os.IsNotExist(err) {
+		t.Errorf("Expected the default database to be left alone, got %v", err)
+	}
+}
+
 type mockGCalClient struct {
-	fetchEventsFunc func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error)
-	createEventFunc func(calendarID, summary, description string, start, end time.Time) (*calendar.Event, error)
-	updateEventFunc func(calendarID, eventID, summary, description string, start, end time.Time) (*calendar.Event, error)
-	deleteEventFunc func(calendarID, eventID string) error
+	fetchEventsFunc     func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error)
+	getEventFunc        func(calendarID, eventID string) (*googlecalendar.Event, error)
+	createEventFunc     func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error)
+	updateEventFunc     func(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error)
+	moveEventFunc       func(calendarID, eventID, destinationCalendarID string) (*calendar.Event, error)
+	setIssueIDFunc      func(calendarID, eventID, issueID string) (*calendar.Event, error)
+	setColorFunc        func(calendarID, eventID, colorID string) (*calendar.Event, error)
+	setRecurrenceFunc   func(calendarID, eventID string, start, end time.Time, recurrence []string) (*calendar.Event, error)
+	patchEventFunc      func(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error)
+	deleteEventFunc     func(calendarID, eventID string) error
+	freeBusyFunc        func(calendarIDs []string, from, to time.Time) ([]googlecalendar.Busy, error)
+	listEventsFunc      func(calendarID string, from, to time.Time) ([]*googlecalendar.Event, error)
+	getCalendarFunc     func(calendarID string) (*calendar.Calendar, error)
+	createCalendarFunc  func(summary string) (*calendar.Calendar, error)
+	shareCalendarFunc   func(calendarID, scopeType, address, role string) error
+	unshareCalendarFunc func(calendarID, scopeType, address string) error
+	calendarACLFunc     func(calendarID string) ([]*calendar.AclRule, error)
+	watchEventsFunc     func(calendarID, id, address, token string, ttl time.Duration) (*googlecalendar.Channel, error)
+	stopChannelFunc     func(id, resourceID string) error
 }
 
 func (m *mockGCalClient) FetchEvents(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
 	return m.fetchEventsFunc(calendarID, syncToken)
 }
-func (m *mockGCalClient) CreateEvent(calendarID, summary, description string, start, end time.Time) (*calendar.Event, error) {
-	return m.createEventFunc(calendarID, summary, description, start, end)
+func (m *mockGCalClient) GetEvent(calendarID, eventID string) (*googlecalendar.Event, error) {
+	return m.getEventFunc(calendarID, eventID)
+}
+func (m *mockGCalClient) CreateEvent(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	return m.createEventFunc(calendarID, eventID, summary, description, location, start, end, allDay, visibility, transparency)
 }
-func (m *mockGCalClient) UpdateEvent(calendarID, eventID, summary, description string, start, end time.Time) (*calendar.Event, error) {
-	return m.updateEventFunc(calendarID, eventID, summary, description, start, end)
+func (m *mockGCalClient) UpdateEvent(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+	return m.updateEventFunc(calendarID, eventID, summary, description, location, start, end, allDay, visibility, transparency)
+}
+func (m *mockGCalClient) MoveEvent(calendarID, eventID, destinationCalendarID string) (*calendar.Event, error) {
+	return m.moveEventFunc(calendarID, eventID, destinationCalendarID)
+}
+func (m *mockGCalClient) SetIssueID(calendarID, eventID, issueID string) (*calendar.Event, error) {
+	if m.setIssueIDFunc == nil {
+		return &calendar.Event{Id: eventID}, nil
+	}
+	return m.setIssueIDFunc(calendarID, eventID, issueID)
+}
+func (m *mockGCalClient) SetColor(calendarID, eventID, colorID string) (*calendar.Event, error) {
+	return m.setColorFunc(calendarID, eventID, colorID)
+}
+func (m *mockGCalClient) SetRecurrence(calendarID, eventID string, start, end time.Time, recurrence []string) (*calendar.Event, error) {
+	return m.setRecurrenceFunc(calendarID, eventID, start, end, recurrence)
+}
+func (m *mockGCalClient) PatchEvent(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error) {
+	return m.patchEventFunc(calendarID, eventID, patch)
 }
 func (m *mockGCalClient) DeleteEvent(calendarID, eventID string) error {
 	return m.deleteEventFunc(calendarID, eventID)
 }
+func (m *mockGCalClient) FreeBusy(calendarIDs []string, from, to time.Time) ([]googlecalendar.Busy, error) {
+	return m.freeBusyFunc(calendarIDs, from, to)
+}
+func (m *mockGCalClient) GetCalendar(calendarID string) (*calendar.Calendar, error) {
+	return m.getCalendarFunc(calendarID)
+}
+func (m *mockGCalClient) CreateCalendar(summary string) (*calendar.Calendar, error) {
+	return m.createCalendarFunc(summary)
+}
+func (m *mockGCalClient) ShareCalendar(calendarID, scopeType, address, role string) error {
+	return m.shareCalendarFunc(calendarID, scopeType, address, role)
+}
+func (m *mockGCalClient) UnshareCalendar(calendarID, scopeType, address string) error {
+	return m.unshareCalendarFunc(calendarID, scopeType, address)
+}
+func (m *mockGCalClient) CalendarACL(calendarID string) ([]*calendar.AclRule, error) {
+	return m.calendarACLFunc(calendarID)
+}
+func (m *mockGCalClient) ListEvents(calendarID string, from, to time.Time) ([]*googlecalendar.Event, error) {
+	return m.listEventsFunc(calendarID, from, to)
+}
+func (m *mockGCalClient) WatchEvents(calendarID, id, address, token string, ttl time.Duration) (*googlecalendar.Channel, error) {
+	return m.watchEventsFunc(calendarID, id, address, token, ttl)
+}
+func (m *mockGCalClient) StopChannel(id, resourceID string) error {
+	return m.stopChannelFunc(id, resourceID)
+}
 
 type mockYTClient struct {
 	getUpdatedIssuesFunc   func(projectID string, since time.Time) ([]youtrack.Issue, error)
-	createIssueFunc        func(projectID, summary, description string, dueDate *time.Time) (*youtrack.Issue, error)
-	updateIssueFunc        func(issueID, summary, description string, dueDate *time.Time) error
+	getIssuesFunc          func(issueIDs []string) ([]youtrack.Issue, error)
+	getIssueFunc           func(issueID string) (*youtrack.Issue, error)
+	getDueIssuesFunc       func(projectID string, from, to time.Time) ([]youtrack.Issue, error)
+	matchesQueryFunc       func(projectID, issueID string) (bool, error)
+	createIssueFunc        func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error)
+	updateIssueFunc        func(issueID string, summary, description *string, dueDate *time.Time) error
+	updateCustomFieldsFunc func(issueID string, fields []youtrack.CustomFieldWrapper) error
+	getIssueStampsFunc     func(projectID string, since time.Time) ([]youtrack.Issue, error)
 	getDeletedIssueIDsFunc func(projectID string, since time.Time) ([]string, error)
 	getBaseURLFunc         func() string
+	getCurrentUserFunc     func() (*youtrack.User, error)
+	addTagFunc             func(issueID, tagName string) error
+	findUserByEmailFunc    func(email string) (*youtrack.User, error)
+	getProjectFieldsFunc   func(projectID string) ([]youtrack.ProjectCustomField, error)
+	getSavedQueryFunc      func(name string) (*youtrack.SavedQuery, error)
+	linkIssuesFunc         func(linkType, sourceID, targetID string) error
+	getDependenciesFunc    func(issueID string) ([]youtrack.Issue, error)
+	addCommentFunc         func(issueID, text string) error
+	applyCommandFunc       func(issueID, command string) error
 }
 
 func (m *mockYTClient) GetUpdatedIssues(projectID string, since time.Time) ([]youtrack.Issue, error) {
 	return m.getUpdatedIssuesFunc(projectID, since)
 }
-func (m *mockYTClient) CreateIssue(projectID, summary, description string, dueDate *time.Time) (*youtrack.Issue, error) {
-	return m.createIssueFunc(projectID, summary, description, dueDate)
+func (m *mockYTClient) GetIssues(issueIDs []string) ([]youtrack.Issue, error) {
+	return m.getIssuesFunc(issueIDs)
+}
+func (m *mockYTClient) GetIssue(issueID string) (*youtrack.Issue, error) {
+	return m.getIssueFunc(issueID)
 }
-func (m *mockYTClient) UpdateIssue(issueID, summary, description string, dueDate *time.Time) error {
+func (m *mockYTClient) GetDueIssues(projectID string, from, to time.Time) ([]youtrack.Issue, error) {
+	return m.getDueIssuesFunc(projectID, from, to)
+}
+func (m *mockYTClient) MatchesQuery(projectID, issueID string) (bool, error) {
+	return m.matchesQueryFunc(projectID, issueID)
+}
+func (m *mockYTClient) CreateIssue(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+	return m.createIssueFunc(projectID, summary, description, dueDate, fields)
+}
+func (m *mockYTClient) UpdateIssue(issueID string, summary, description *string, dueDate *time.Time) error {
 	return m.updateIssueFunc(issueID, summary, description, dueDate)
 }
-func (m *mockYTClient) GetDeletedIssueIDs(projectID string, since time.Time) ([]string, error) {
-	return m.getDeletedIssueIDsFunc(projectID, since)
+func (m *mockYTClient) UpdateCustomFields(issueID string, fields []youtrack.CustomFieldWrapper) error {
+	return m.updateCustomFieldsFunc(issueID, fields)
+}
+
+// ChangeFeed reports the issues of getUpdatedIssuesFunc as updated and those
+// of getDeletedIssueIDsFunc as deleted.
+func (m *mockYTClient) ChangeFeed(projectID string, since time.Time) (*youtrack.Changes, error) {
+	updated, err := m.getUpdatedIssuesFunc(projectID, since)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := m.getDeletedIssueIDsFunc(projectID, since)
+	if err != nil {
+		return nil, err
+	}
+	return &youtrack.Changes{Updated: updated, Deleted: deleted, Latest: latestUpdate(updated)}, nil
+}
+func (m *mockYTClient) ChangeFeedStamps(projectID string, since time.Time) (*youtrack.Changes, error) {
+	stamps, err := m.getIssueStampsFunc(projectID, since)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := m.getDeletedIssueIDsFunc(projectID, since)
+	if err != nil {
+		return nil, err
+	}
+	return &youtrack.Changes{Updated: stamps, Deleted: deleted, Latest: latestUpdate(stamps)}, nil
+}
+
+func latestUpdate(issues []youtrack.Issue) int64 {
+	var latest int64
+	for _, issue := range issues {
+		latest = max(latest, issue.Updated)
+	}
+	return latest
 }
 func (m *mockYTClient) GetBaseURL() string {
 	return m.getBaseURLFunc()
 }
+func (m *mockYTClient) GetCurrentUser() (*youtrack.User, error) {
+	return m.getCurrentUserFunc()
+}
+func (m *mockYTClient) FindUserByEmail(email string) (*youtrack.User, error) {
+	return m.findUserByEmailFunc(email)
+}
+func (m *mockYTClient) GetProjectCustomFields(projectID string) ([]youtrack.ProjectCustomField, error) {
+	return m.getProjectFieldsFunc(projectID)
+}
+func (m *mockYTClient) AddTag(issueID, tagName string) error {
+	return m.addTagFunc(issueID, tagName)
+}
+func (m *mockYTClient) GetSavedQuery(name string) (*youtrack.SavedQuery, error) {
+	return m.getSavedQueryFunc(name)
+}
+func (m *mockYTClient) LinkIssues(linkType, sourceID, targetID string) error {
+	return m.linkIssuesFunc(linkType, sourceID, targetID)
+}
+func (m *mockYTClient) GetDependencies(issueID string) ([]youtrack.Issue, error) {
+	return m.getDependenciesFunc(issueID)
+}
+func (m *mockYTClient) AddComment(issueID, text string) error {
+	return m.addCommentFunc(issueID, text)
+}
+func (m *mockYTClient) ApplyCommand(issueID, command string) error {
+	return m.applyCommandFunc(issueID, command)
+}
 
 func TestSync_NewGCalEventCreatesYTIssue(t *testing.T) {
 	db, gcalClient, ytClient, s, cleanup := setupTest(t)
@@ -196,7 +680,7 @@ func TestSync_NewGCalEventCreatesYTIssue(t *testing.T) {
 			{ID: "gcal-1", Summary: "New GCal Event", Updated: time.Now()},
 		}, "new-gcal-token", nil
 	}
-	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time) (*youtrack.Issue, error) {
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
 		return &youtrack.Issue{ID: "new-yt-issue"}, nil
 	}
 	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
@@ -206,7 +690,7 @@ func TestSync_NewGCalEventCreatesYTIssue(t *testing.T) {
 		return nil, nil
 	}
 
-	err := s.Sync()
+	_, err := s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -230,7 +714,7 @@ func TestSync_NewYTIssueCreatesGCalEvent(t *testing.T) {
 			}},
 		}, nil
 	}
-	gcalClient.createEventFunc = func(calendarID, summary, description string, start, end time.Time) (*calendar.Event, error) {
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
 		return &calendar.Event{Id: "new-gcal-event"}, nil
 	}
 	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
@@ -243,7 +727,7 @@ func TestSync_NewYTIssueCreatesGCalEvent(t *testing.T) {
 		return "http://youtrack.example.com"
 	}
 
-	err := s.Sync()
+	_, err := s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -265,7 +749,7 @@ func TestSync_NewYTIssueWithoutDueDateDoesNotCreateGCalEvent(t *testing.T) {
 			{ID: "yt-1", Summary: "New YT Issue", Updated: time.Now().UnixMilli()},
 		}, nil
 	}
-	gcalClient.createEventFunc = func(calendarID, summary, description string, start, end time.Time) (*calendar.Event, error) {
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
 		t.Error("CreateEvent should not be called")
 		return nil, nil
 	}
@@ -276,17 +760,13 @@ func TestSync_NewYTIssueWithoutDueDateDoesNotCreateGCalEvent(t *testing.T) {
 		return nil, nil
 	}
 
-	err := s.Sync()
+	_, err := s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
 
-	item, err := db.GetSyncItemByYTID("yt-1")
-	if err != nil {
-		t.Fatalf("GetSyncItemByYTID() error = %v", err)
-	}
-	if item != nil {
-		t.Error("Expected no sync item to be created")
+	if _, err := db.GetSyncItemByYTID("yt-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected no sync item to be created, got error %v", err)
 	}
 }
 func TestSync_UpdateGCalEventUpdatesYTIssue(t *testing.T) {
@@ -309,8 +789,8 @@ func TestSync_UpdateGCalEventUpdatesYTIssue(t *testing.T) {
 		}, "new-gcal-token", nil
 	}
 	var updatedSummary string
-	ytClient.updateIssueFunc = func(issueID, summary, description string, dueDate *time.Time) error {
-		updatedSummary = summary
+	ytClient.updateIssueFunc = func(issueID string, summary, description *string, dueDate *time.Time) error {
+		updatedSummary = textOf(summary)
 		return nil
 	}
 	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
@@ -320,7 +800,7 @@ func TestSync_UpdateGCalEventUpdatesYTIssue(t *testing.T) {
 		return nil, nil
 	}
 
-	err = s.Sync()
+	_, err = s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -351,8 +831,8 @@ func TestSync_UpdateYTIssueUpdatesGCalEvent(t *testing.T) {
 		}, nil
 	}
 	var updatedSummary string
-	gcalClient.updateEventFunc = func(calendarID, eventID, summary, description string, start, end time.Time) (*calendar.Event, error) {
-		updatedSummary = summary
+	gcalClient.updateEventFunc = func(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		updatedSummary = textOf(summary)
 		return &calendar.Event{}, nil
 	}
 	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
@@ -365,7 +845,7 @@ func TestSync_UpdateYTIssueUpdatesGCalEvent(t *testing.T) {
 		return "http://youtrack.example.com"
 	}
 
-	err = s.Sync()
+	_, err = s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -392,9 +872,11 @@ func TestSync_CancelledGCalEventUpdatesYTIssue(t *testing.T) {
 		}, "new-gcal-token", nil
 	}
 	var dueDateCleared bool
-	ytClient.updateIssueFunc = func(issueID, summary, description string, dueDate *time.Time) error {
-		if dueDate == nil {
-			dueDateCleared = true
+	ytClient.updateCustomFieldsFunc = func(issueID string, fields []youtrack.CustomFieldWrapper) error {
+		for _, field := range fields {
+			if field.Name == "Due Date" && field.Value == nil {
+				dueDateCleared = true
+			}
 		}
 		return nil
 	}
@@ -405,7 +887,7 @@ func TestSync_CancelledGCalEventUpdatesYTIssue(t *testing.T) {
 		return nil, nil
 	}
 
-	err = s.Sync()
+	_, err = s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -413,12 +895,8 @@ func TestSync_CancelledGCalEventUpdatesYTIssue(t *testing.T) {
 	if !dueDateCleared {
 		t.Errorf("Expected YouTrack issue due date to be cleared, but it was not")
 	}
-	item, err := db.GetSyncItemByGCalID("gcal-1")
-	if err != nil {
-		t.Fatalf("GetSyncItemByGCalID() error = %v", err)
-	}
-	if item != nil {
-		t.Error("Expected sync item to be deleted")
+	if _, err := db.GetSyncItemByGCalID("gcal-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected sync item to be deleted, got error %v", err)
 	}
 }
 func TestSync_DeletedYTIssueDeletesGCalEvent(t *testing.T) {
@@ -450,7 +928,7 @@ func TestSync_DeletedYTIssueDeletesGCalEvent(t *testing.T) {
 		return nil, nil
 	}
 
-	err = s.Sync()
+	_, err = s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -458,12 +936,8 @@ func TestSync_DeletedYTIssueDeletesGCalEvent(t *testing.T) {
 	if !eventDeleted {
 		t.Errorf("Expected GCal event to be deleted, but it was not")
 	}
-	item, err := db.GetSyncItemByYTID("yt-1")
-	if err != nil {
-		t.Fatalf("GetSyncItemByYTID() error = %v", err)
-	}
-	if item != nil {
-		t.Error("Expected sync item to be deleted")
+	if _, err := db.GetSyncItemByYTID("yt-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected sync item to be deleted, got error %v", err)
 	}
 }
 func TestSync_UpdatesTokensAndTimestamps(t *testing.T) {
@@ -473,14 +947,16 @@ func TestSync_UpdatesTokensAndTimestamps(t *testing.T) {
 	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
 		return nil, "new-gcal-token", nil
 	}
+	// The cursor follows the newest update seen, not the clock.
+	updated := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
 	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
-		return nil, nil
+		return []youtrack.Issue{{ID: "yt-1", Summary: "No due date", Updated: updated.UnixMilli()}}, nil
 	}
 	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
 		return nil, nil
 	}
 
-	err := s.Sync()
+	_, err := s.Sync()
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -497,8 +973,8 @@ func TestSync_UpdatesTokensAndTimestamps(t *testing.T) {
 	if err != nil {
 		t.Fatalf("GetYTLastSync() error = %v", err)
 	}
-	if ytLastSync.IsZero() {
-		t.Errorf("Expected YT last sync time to be updated")
+	if !ytLastSync.Equal(updated) {
+		t.Errorf("Expected the YouTrack cursor to be the update time %v, got %v", updated, ytLastSync)
 	}
 }
 func TestSync_NoChanges(t *testing.T) {
@@ -514,17 +990,4982 @@ func TestSync_NoChanges(t *testing.T) {
 	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
 		return nil, nil
 	}
-	gcalClient.createEventFunc = func(calendarID, summary, description string, start, end time.Time) (*calendar.Event, error) {
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
 		t.Error("CreateEvent should not be called")
 		return nil, nil
 	}
-	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time) (*youtrack.Issue, error) {
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
 		t.Error("CreateIssue should not be called")
 		return nil, nil
 	}
 
-	err := s.Sync()
+	_, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+}
+func TestSync_ManagedFieldsRestrictYTUpdate(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	managed, err := NewManagedFields([]string{FieldDueDate}, nil)
+	if err != nil {
+		t.Fatalf("NewManagedFields() error = %v", err)
+	}
+	s.ManagedFields = managed
+
+	updatedTime := time.Now()
+	_, err = db.CreateSyncItem(&SyncItem{
+		GCalID:        sql.NullString{String: "gcal-1", Valid: true},
+		YTID:          sql.NullString{String: "yt-1", Valid: true},
+		GCalUpdatedAt: sql.NullTime{Time: updatedTime.Add(-time.Hour), Valid: true},
+	})
 	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Renamed GCal Event", HTMLLink: "link", Start: updatedTime, Updated: updatedTime},
+		}, "new-gcal-token", nil
+	}
+	var gotSummary, gotDescription *string
+	var gotDueDate *time.Time
+	ytClient.updateIssueFunc = func(issueID string, summary, description *string, dueDate *time.Time) error {
+		gotSummary, gotDescription, gotDueDate = summary, description, dueDate
+		return nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
-}
\ No newline at end of file
+
+	if gotSummary != nil || gotDescription != nil {
+		t.Errorf("Expected summary and description to be withheld, got %q and %q", textOf(gotSummary), textOf(gotDescription))
+	}
+	if gotDueDate == nil || !gotDueDate.Equal(updatedTime) {
+		t.Errorf("Expected due date to be written, got %v", gotDueDate)
+	}
+}
+
+func TestManagedClients(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	managed, err := NewManagedFields([]string{FieldDueDate}, []string{FieldSummary})
+	if err != nil {
+		t.Fatalf("NewManagedFields() error = %v", err)
+	}
+	s.ManagedFields = managed
+	s.ConferenceField = "Meeting"
+
+	var written []string
+	ytClient.updateCustomFieldsFunc = func(issueID string, fields []youtrack.CustomFieldWrapper) error {
+		for _, f := range fields {
+			written = append(written, f.Name)
+		}
+		return nil
+	}
+	ytClient.applyCommandFunc = func(issueID, command string) error {
+		written = append(written, command)
+		return nil
+	}
+	ytClient.addTagFunc = func(issueID, tagName string) error {
+		written = append(written, tagName)
+		return nil
+	}
+	gcalClient.updateEventFunc = func(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		written = append(written, textOf(summary), textOf(description))
+		return &calendar.Event{Id: eventID}, nil
+	}
+	gcalClient.setColorFunc = func(calendarID, eventID, colorID string) (*calendar.Event, error) {
+		written = append(written, colorID)
+		return &calendar.Event{Id: eventID}, nil
+	}
+	gcalClient.patchEventFunc = func(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error) {
+		written = append(written, "patch")
+		return &calendar.Event{Id: eventID}, nil
+	}
+
+	yt := s.managedYouTrack()
+	fields := []youtrack.CustomFieldWrapper{youtrack.EnumField("Priority", "Minor"), noDueDate,
+		{YouTrackType: youtrack.YouTrackType{Type: "SimpleIssueCustomField"}, Name: "Meeting", Value: "https://meet.example.com"}}
+	if err := yt.UpdateCustomFields("yt-1", fields); err != nil {
+		t.Fatalf("UpdateCustomFields() error = %v", err)
+	}
+	if err := yt.ApplyCommand("yt-1", youtrack.FieldCommand("State", "Won't fix")); err != nil {
+		t.Fatalf("ApplyCommand() error = %v", err)
+	}
+	if err := yt.AddTag("yt-1", "meeting"); err != nil {
+		t.Fatalf("AddTag() error = %v", err)
+	}
+	if !yt.wrote(FieldDueDate) || yt.wrote(FieldPriority) || yt.wrote(FieldConference) {
+		t.Errorf("Expected only the due date to be written, got %v", yt.written)
+	}
+
+	gc := s.managedCalendar()
+	summary, description := "Standup", "Daily"
+	if _, err := gc.UpdateEvent("gcal-calendar", "gcal-1", &summary, &description, nil, time.Time{}, time.Time{}, false, "", ""); err != nil {
+		t.Fatalf("UpdateEvent() error = %v", err)
+	}
+	item := &SyncItem{GCalID: sql.NullString{String: "gcal-1", Valid: true}}
+	if err := s.applyColor(gc, item, "", "5"); err != nil {
+		t.Errorf("applyColor() error = %v", err)
+	}
+	if err := s.applyPatch(gc, item, &EventDraft{Patch: &calendar.Event{Transparency: "transparent"}}); err != nil {
+		t.Errorf("applyPatch() error = %v", err)
+	}
+	if !gc.wrote(FieldSummary) || gc.wrote(FieldDescription) || gc.wrote(FieldColor) {
+		t.Errorf("Expected only the summary to be written, got %v", gc.written)
+	}
+
+	if want := []string{"Due Date", "Standup", "<nil>"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("Expected writes %q, got %q", want, written)
+	}
+}
+
+func TestNewManagedFields_UnknownField(t *testing.T) {
+	if _, err := NewManagedFields([]string{"assignee"}, nil); err == nil {
+		t.Error("Expected an error for an unknown YouTrack field")
+	}
+	if _, err := NewManagedFields(nil, []string{FieldDueDate}); err == nil {
+		t.Error("Expected an error for a field not writable on Google Calendar")
+	}
+	if _, err := NewManagedFields(nil, []string{FieldSummary, FieldStart}); err == nil {
+		t.Error("Expected an error for start managed without end")
+	}
+	if _, err := NewManagedFields(nil, []string{FieldStart, FieldEnd}); err != nil {
+		t.Errorf("NewManagedFields() error = %v", err)
+	}
+}
+
+func TestEventDescription(t *testing.T) {
+	_, _, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+
+	description, err := s.eventDescription(youtrack.Issue{
+		ID:         "2-1",
+		IDReadable: "PRJ-1",
+		Summary:    "Ship it",
+		Project:    &youtrack.Project{Name: "Project"},
+		CustomFields: []youtrack.CustomField{
+			{Name: "State", Value: map[string]interface{}{"name": "Open"}},
+			{Name: "Priority", Value: map[string]interface{}{"name": "Major"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("eventDescription() error = %v", err)
+	}
+
+	for _, want := range []string{`<a href="http://youtrack.example.com/issue/PRJ-1">PRJ-1</a>`, "Project:</b> Project", "State:</b> Open", "Priority:</b> Major"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("Expected description to contain %q, got %q", want, description)
+		}
+	}
+	if strings.Contains(description, "Assignee") {
+		t.Errorf("Expected unset assignee to be omitted, got %q", description)
+	}
+}
+
+func TestEventDescription_Markdown(t *testing.T) {
+	_, _, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+	s.DescriptionTemplate = template.Must(template.New("description").Parse("{{.Description}}"))
+
+	description, err := s.eventDescription(youtrack.Issue{
+		ID:          "2-1",
+		Description: "## Notes\nSee [docs](https://example.com/docs) or [this](javascript:void) <b>now</b>",
+	})
+	if err != nil {
+		t.Fatalf("eventDescription() error = %v", err)
+	}
+	want := `<b>Notes</b><br>See <a href="https://example.com/docs">docs</a> or this &lt;b&gt;now&lt;/b&gt;`
+	if description != want {
+		t.Errorf("eventDescription() = %q, want %q", description, want)
+	}
+}
+
+func TestSync_UnchangedDescriptionIsNotRewritten(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+	issue := youtrack.Issue{ID: "yt-1", Summary: "YT Issue", Updated: time.Now().UnixMilli(), CustomFields: []youtrack.CustomField{
+		{Name: "Due Date", Value: float64(time.Now().UnixMilli())},
+	}}
+	description, err := s.eventDescription(issue)
+	if err != nil {
+		t.Fatalf("eventDescription() error = %v", err)
+	}
+	_, err = db.CreateSyncItem(&SyncItem{
+		GCalID:          sql.NullString{String: "gcal-1", Valid: true},
+		YTID:            sql.NullString{String: "yt-1", Valid: true},
+		YTUpdatedAt:     sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+		DescriptionHash: sql.NullString{String: descriptionHash(description), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{issue}, nil
+	}
+	gotDescription := "unset"
+	gcalClient.updateEventFunc = func(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		gotDescription = textOf(description)
+		return &calendar.Event{}, nil
+	}
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "new-gcal-token", nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if gotDescription != "<nil>" {
+		t.Errorf("Expected unchanged description to be skipped, got %q", gotDescription)
+	}
+}
+
+func TestSync_ResolvedAndDraftIssuesAreSkipped(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	dueDate := []youtrack.CustomField{{Name: "Due Date", Value: float64(time.Now().UnixMilli())}}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{
+			{ID: "yt-1", Summary: "Resolved", Updated: time.Now().UnixMilli(), Resolved: time.Now().UnixMilli(), CustomFields: dueDate},
+			{ID: "yt-2", Summary: "Draft", Updated: time.Now().UnixMilli(), IsDraft: true, CustomFields: dueDate},
+		}, nil
+	}
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		t.Errorf("CreateEvent should not be called for %q", summary)
+		return &calendar.Event{}, nil
+	}
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "new-gcal-token", nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+}
+
+func TestSync_ResolvedIssueDeletesEvent(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.ResolvedAction = ResolvedActionDelete
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:      sql.NullString{String: "gcal-1", Valid: true},
+		YTID:        sql.NullString{String: "yt-1", Valid: true},
+		YTUpdatedAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{
+			{ID: "yt-1", Summary: "Done", Updated: time.Now().UnixMilli(), Resolved: time.Now().UnixMilli()},
+		}, nil
+	}
+	var deletedEventID string
+	gcalClient.deleteEventFunc = func(calendarID, eventID string) error {
+		deletedEventID = eventID
+		return nil
+	}
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "new-gcal-token", nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if deletedEventID != "gcal-1" {
+		t.Errorf("Expected event gcal-1 to be deleted, got %q", deletedEventID)
+	}
+	if _, err := db.GetSyncItemByYTID("yt-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected sync item to be deleted, got error %v", err)
+	}
+}
+
+func TestParseResolvedAction(t *testing.T) {
+	if action, err := ParseResolvedAction(""); err != nil || action != ResolvedActionStop {
+		t.Errorf("Expected empty value to parse as %q, got %q (%v)", ResolvedActionStop, action, err)
+	}
+	if action, err := ParseResolvedAction("Shorten"); err != nil || action != ResolvedActionShorten {
+		t.Errorf("Expected %q, got %q (%v)", ResolvedActionShorten, action, err)
+	}
+	if _, err := ParseResolvedAction("rename"); err == nil {
+		t.Error("Expected an error for an unknown action")
+	}
+}
+
+func TestSync_ResolvedIssueArchivesEvent(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.ResolvedAction = ResolvedActionArchive
+	s.ArchiveCalendarID = "gcal-archive"
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:      sql.NullString{String: "gcal-1", Valid: true},
+		YTID:        sql.NullString{String: "yt-1", Valid: true},
+		YTUpdatedAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{
+			{ID: "yt-1", Summary: "Done", Updated: time.Now().UnixMilli(), Resolved: time.Now().UnixMilli()},
+		}, nil
+	}
+	var movedTo string
+	gcalClient.moveEventFunc = func(calendarID, eventID, destinationCalendarID string) (*calendar.Event, error) {
+		movedTo = destinationCalendarID
+		return &calendar.Event{Id: eventID}, nil
+	}
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "new-gcal-token", nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if movedTo != "gcal-archive" {
+		t.Errorf("Expected event to be moved to gcal-archive, got %q", movedTo)
+	}
+	if _, err := db.GetSyncItemByYTID("yt-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected sync item to be deleted, got error %v", err)
+	}
+}
+
+func TestSync_ResolvedIssuesAreLeftOutOfTheFetch(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:      sql.NullString{String: "gcal-1", Valid: true},
+		YTID:        sql.NullString{String: "yt-1", Valid: true},
+		YTUpdatedAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	var gotQuery string
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		gotQuery = projectID
+		// Resolved during the period, which the feed reports all the same.
+		return []youtrack.Issue{
+			{ID: "yt-1", Summary: "Done", Updated: time.Now().UnixMilli(), Resolved: time.Now().UnixMilli()},
+		}, nil
+	}
+	gcalClient.updateEventFunc = func(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		t.Errorf("Expected the event of the resolved issue not to be updated, got %q", textOf(summary))
+		return &calendar.Event{Id: eventID}, nil
+	}
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "new-gcal-token", nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if gotQuery != "project:yt-query-project #Unresolved" {
+		t.Errorf("Expected resolved issues to be left out of the query, got %q", gotQuery)
+	}
+	item, err := db.GetSyncItemByYTID("yt-1")
+	if err != nil {
+		t.Fatalf("Expected the sync item to be kept, got error %v", err)
+	}
+	if !item.YTHash.Valid {
+		t.Error("Expected the resolved issue to be recorded as synced")
+	}
+}
+
+func TestSync_ResolvedIssueShortensEventEnd(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.ResolvedAction = ResolvedActionShorten
+	s.EventTiming = EventTimingTimed
+	s.EventTime = 9 * time.Hour
+	s.EventDuration = 4 * time.Hour
+
+	due := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	resolved := due.Add(11 * time.Hour)
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:      sql.NullString{String: "gcal-1", Valid: true},
+		YTID:        sql.NullString{String: "yt-1", Valid: true},
+		YTUpdatedAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{{
+			ID: "yt-1", Summary: "Done", Updated: time.Now().UnixMilli(), Resolved: resolved.UnixMilli(),
+			CustomFields: []youtrack.CustomField{{Name: "Due Date", Value: float64(due.UnixMilli())}},
+		}}, nil
+	}
+	var gotStart, gotEnd time.Time
+	gcalClient.updateEventFunc = func(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		gotStart, gotEnd = start, end
+		return &calendar.Event{Id: eventID}, nil
+	}
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "new-gcal-token", nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if !gotStart.IsZero() {
+		t.Errorf("Expected the start of the event to be kept, got %v", gotStart)
+	}
+	if !gotEnd.Equal(resolved) {
+		t.Errorf("Expected the event to end at %v, got %v", resolved, gotEnd)
+	}
+}
+
+func TestSync_SkippedEventTypesDoNotCreateYTIssues(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Focus", EventType: googlecalendar.EventTypeFocusTime, Updated: time.Now()},
+			{ID: "gcal-2", Summary: "Home", EventType: googlecalendar.EventTypeWorkingLocation, Updated: time.Now()},
+			{ID: "gcal-3", Summary: "Meeting", EventType: googlecalendar.EventTypeDefault, Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	var created []string
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		created = append(created, summary)
+		return &youtrack.Issue{ID: "yt-" + summary}, nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(created) != 1 || created[0] != "Meeting" {
+		t.Errorf("Expected only the default event to create an issue, got %v", created)
+	}
+}
+
+func TestSync_DeclinedEventLowersPriorityAndClearsDueDate(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.Response = ResponsePolicy{
+		Field:                 "RSVP",
+		Values:                map[string]string{ResponseDeclined: "No"},
+		DeclinedPriority:      "Minor",
+		DeclinedClearsDueDate: true,
+	}
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:         sql.NullString{String: "gcal-1", Valid: true},
+		YTID:           sql.NullString{String: "yt-1", Valid: true},
+		GCalUpdatedAt:  sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+		ResponseStatus: sql.NullString{String: ResponseAccepted, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Meeting", Start: time.Now(), Updated: time.Now(), ResponseStatus: ResponseDeclined},
+		}, "new-gcal-token", nil
+	}
+	var gotDueDate *time.Time
+	ytClient.updateIssueFunc = func(issueID string, summary, description *string, dueDate *time.Time) error {
+		gotDueDate = dueDate
+		return nil
+	}
+	var gotFields []youtrack.CustomFieldWrapper
+	ytClient.updateCustomFieldsFunc = func(issueID string, fields []youtrack.CustomFieldWrapper) error {
+		gotFields = fields
+		return nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if gotDueDate != nil {
+		t.Errorf("Expected the due date to be withheld, got %v", gotDueDate)
+	}
+	if len(gotFields) != 3 {
+		t.Fatalf("Expected 3 custom field updates, got %+v", gotFields)
+	}
+	if gotFields[0].Name != "RSVP" || gotFields[0].Value != (youtrack.NamedValue{Name: "No"}) {
+		t.Errorf("Unexpected response field update: %+v", gotFields[0])
+	}
+	if gotFields[1].Name != "Priority" || gotFields[1].Value != (youtrack.NamedValue{Name: "Minor"}) {
+		t.Errorf("Unexpected priority update: %+v", gotFields[1])
+	}
+	if gotFields[2].Name != "Due Date" || gotFields[2].Value != nil {
+		t.Errorf("Expected the due date to be cleared, got %+v", gotFields[2])
+	}
+	item, err := db.GetSyncItemByYTID("yt-1")
+	if err != nil {
+		t.Fatalf("GetSyncItemByYTID() error = %v", err)
+	}
+	if item.ResponseStatus.String != ResponseDeclined {
+		t.Errorf("Expected response %q to be recorded, got %q", ResponseDeclined, item.ResponseStatus.String)
+	}
+}
+
+func TestSync_ResponseSetsIssueState(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.Response = ResponsePolicy{States: map[string]string{ResponseTentative: "Waiting", ResponseDeclined: "Won't do"}}
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:         sql.NullString{String: "gcal-1", Valid: true},
+		YTID:           sql.NullString{String: "yt-1", Valid: true},
+		GCalUpdatedAt:  sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+		ResponseStatus: sql.NullString{String: ResponseAccepted, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	response := ResponseDeclined
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Meeting", Start: time.Now(), Updated: time.Now(), ResponseStatus: response},
+		}, "new-gcal-token", nil
+	}
+	ytClient.updateIssueFunc = func(issueID string, summary, description *string, dueDate *time.Time) error {
+		return nil
+	}
+	ytClient.updateCustomFieldsFunc = func(issueID string, fields []youtrack.CustomFieldWrapper) error {
+		t.Errorf("Expected no custom field update, got %+v", fields)
+		return nil
+	}
+	var commands []string
+	ytClient.applyCommandFunc = func(issueID, command string) error {
+		commands = append(commands, issueID+": "+command)
+		return nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	// An unchanged response is not applied again, and one without a state
+	// leaves the state alone.
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	response = ResponseAccepted
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if want := []string{"yt-1: State {Won't do}"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("Commands = %q, want %q", commands, want)
+	}
+}
+
+func TestSync_DeclinedEventIsCancelled(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.Response = ResponsePolicy{States: map[string]string{ResponseDeclined: "Won't do"}, Declined: DeclinedActionCancel}
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:        sql.NullString{String: "gcal-1", Valid: true},
+		YTID:          sql.NullString{String: "yt-1", Valid: true},
+		GCalUpdatedAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Meeting", Start: time.Now(), Updated: time.Now(), ResponseStatus: ResponseDeclined},
+			{ID: "gcal-2", Summary: "Invite", Start: time.Now(), Updated: time.Now(), ResponseStatus: ResponseDeclined},
+		}, "new-gcal-token", nil
+	}
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		t.Errorf("Expected no issue for a declined event, got %q", summary)
+		return &youtrack.Issue{ID: "yt-2"}, nil
+	}
+	var updates []string
+	ytClient.updateCustomFieldsFunc = func(issueID string, fields []youtrack.CustomFieldWrapper) error {
+		for _, field := range fields {
+			updates = append(updates, fmt.Sprintf("%s %s = %v", issueID, field.Name, field.Value))
+		}
+		return nil
+	}
+	var commands []string
+	ytClient.applyCommandFunc = func(issueID, command string) error {
+		commands = append(commands, issueID+": "+command)
+		return nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if want := []string{"yt-1 Due Date = <nil>"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("Expected only the due date to be cleared, got %q", updates)
+	}
+	if want := []string{"yt-1: State {Won't do}"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("Commands = %q, want %q", commands, want)
+	}
+	if _, err := db.GetSyncItemByGCalID("gcal-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected sync item to be deleted, got error %v", err)
+	}
+}
+
+func TestParseDeclinedAction(t *testing.T) {
+	if action, err := ParseDeclinedAction(""); err != nil || action != DeclinedActionNone {
+		t.Errorf("Expected empty value to parse as %q, got %q (%v)", DeclinedActionNone, action, err)
+	}
+	if action, err := ParseDeclinedAction("Skip"); err != nil || action != DeclinedActionSkip {
+		t.Errorf("Expected %q, got %q (%v)", DeclinedActionSkip, action, err)
+	}
+	if _, err := ParseDeclinedAction("delete"); err == nil {
+		t.Error("Expected an error for an unknown action")
+	}
+}
+
+func TestSync_ConferenceURLIsAddedToIssueDescription(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Standup", HTMLLink: "https://calendar/event", ConferenceURL: "https://meet.google.com/abc", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	var gotDescription string
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		gotDescription = description
+		return &youtrack.Issue{ID: "yt-1"}, nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if !strings.Contains(gotDescription, "https://calendar/event") || !strings.Contains(gotDescription, "Join: https://meet.google.com/abc") {
+		t.Errorf("Expected description to link the event and the meeting, got %q", gotDescription)
+	}
+}
+
+func TestSync_LocationFieldSyncsBothWays(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.LocationField = "Room"
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:        sql.NullString{String: "gcal-1", Valid: true},
+		YTID:          sql.NullString{String: "yt-1", Valid: true},
+		GCalUpdatedAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Review", Location: "Room 4", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	ytClient.updateIssueFunc = func(issueID string, summary, description *string, dueDate *time.Time) error {
+		return nil
+	}
+	var gotField youtrack.CustomFieldWrapper
+	ytClient.updateCustomFieldsFunc = func(issueID string, fields []youtrack.CustomFieldWrapper) error {
+		gotField = fields[0]
+		return nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{
+			{ID: "yt-2", Summary: "Offsite", Updated: time.Now().UnixMilli(), CustomFields: []youtrack.CustomField{
+				{Name: "Due Date", Value: float64(time.Now().UnixMilli())},
+				{Name: "Room", Value: "Lobby"},
+			}},
+		}, nil
+	}
+	var gotLocation string
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		gotLocation = location
+		return &calendar.Event{Id: "gcal-2"}, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if gotField.Name != "Room" || gotField.Value != "Room 4" {
+		t.Errorf("Expected event location to be written to Room, got %+v", gotField)
+	}
+	if gotLocation != "Lobby" {
+		t.Errorf("Expected issue location 'Lobby' on the new event, got %q", gotLocation)
+	}
+}
+
+func TestIssueDescription_ListsAttachments(t *testing.T) {
+	s := &Synchronizer{}
+	description := s.issueDescription(&googlecalendar.Event{
+		HTMLLink: "https://calendar/event",
+		Attachments: []googlecalendar.Attachment{
+			{Title: "Agenda", FileURL: "https://drive.google.com/file/d/agenda"},
+		},
+	})
+
+	want := "https://calendar/event\n\nAttachments:\n- [Agenda](https://drive.google.com/file/d/agenda)"
+	if description != want {
+		t.Errorf("Expected description %q, got %q", want, description)
+	}
+}
+
+func TestSyncIssue_UpdatesSingleIssue(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:      sql.NullString{String: "gcal-1", Valid: true},
+		YTID:        sql.NullString{String: "yt-1", Valid: true},
+		YTUpdatedAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	ytClient.getIssueFunc = func(issueID string) (*youtrack.Issue, error) {
+		return &youtrack.Issue{ID: "yt-1", Summary: "Renamed", Updated: time.Now().UnixMilli()}, nil
+	}
+	ytClient.matchesQueryFunc = func(projectID, issueID string) (bool, error) {
+		return true, nil
+	}
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+	var gotSummary string
+	gcalClient.updateEventFunc = func(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		gotSummary = textOf(summary)
+		return &calendar.Event{Id: eventID}, nil
+	}
+
+	if err := s.SyncIssue("PRJ-1"); err != nil {
+		t.Fatalf("SyncIssue() error = %v", err)
+	}
+	if gotSummary != "Renamed" {
+		t.Errorf("Expected event summary 'Renamed', got %q", gotSummary)
+	}
+}
+
+func TestSyncIssue_SkipsIssueOutsideQuery(t *testing.T) {
+	_, _, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.SavedSearch = "My deadlines"
+
+	ytClient.getSavedQueryFunc = func(name string) (*youtrack.SavedQuery, error) {
+		return &youtrack.SavedQuery{Name: name, Query: "project: PRJ #Unresolved"}, nil
+	}
+	ytClient.getIssueFunc = func(issueID string) (*youtrack.Issue, error) {
+		return &youtrack.Issue{
+			ID:           "2-1",
+			IDReadable:   "PRJ-1",
+			Summary:      "Excluded",
+			Updated:      time.Now().UnixMilli(),
+			CustomFields: []youtrack.CustomField{{Name: "Due Date", Value: float64(time.Now().UnixMilli())}},
+		}, nil
+	}
+	var gotQuery, gotIssue string
+	ytClient.matchesQueryFunc = func(projectID, issueID string) (bool, error) {
+		gotQuery, gotIssue = projectID, issueID
+		return false, nil
+	}
+
+	// The mock calendar has no createEventFunc, so creating an event panics.
+	if err := s.SyncIssue("PRJ-1"); err != nil {
+		t.Fatalf("SyncIssue() error = %v", err)
+	}
+	if gotQuery != "(project: PRJ #Unresolved)" || gotIssue != "PRJ-1" {
+		t.Errorf("Expected issue PRJ-1 to be checked against the saved search, got %q and %q", gotIssue, gotQuery)
+	}
+}
+
+func TestSyncIssue_DeletedIssueByReadableID(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID:       sql.NullString{String: "gcal-1", Valid: true},
+		YTID:         sql.NullString{String: "2-17", Valid: true},
+		YTReadableID: sql.NullString{String: "PRJ-1", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	ytClient.getIssueFunc = func(issueID string) (*youtrack.Issue, error) {
+		return nil, youtrack.ErrNotFound
+	}
+	var deleted string
+	gcalClient.deleteEventFunc = func(calendarID, eventID string) error {
+		deleted = eventID
+		return nil
+	}
+
+	if err := s.SyncIssue("PRJ-1"); err != nil {
+		t.Fatalf("SyncIssue() error = %v", err)
+	}
+	if deleted != "gcal-1" {
+		t.Errorf("Expected event gcal-1 to be deleted, got %q", deleted)
+	}
+	if _, err := db.GetSyncItemByGCalID("gcal-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected sync item to be deleted, got error %v", err)
+	}
+}
+
+func TestSyncEvent_MissingEventClearsIssueDueDate(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	_, err := db.CreateSyncItem(&SyncItem{
+		GCalID: sql.NullString{String: "gcal-1", Valid: true},
+		YTID:   sql.NullString{String: "yt-1", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+
+	gcalClient.getEventFunc = func(calendarID, eventID string) (*googlecalendar.Event, error) {
+		return nil, googlecalendar.ErrNotFound
+	}
+	var updatedIssueID string
+	ytClient.updateCustomFieldsFunc = func(issueID string, fields []youtrack.CustomFieldWrapper) error {
+		if len(fields) == 1 && fields[0].Name == "Due Date" && fields[0].Value == nil {
+			updatedIssueID = issueID
+		}
+		return nil
+	}
+
+	if err := s.SyncEvent("gcal-1"); err != nil {
+		t.Fatalf("SyncEvent() error = %v", err)
+	}
+	if updatedIssueID != "yt-1" {
+		t.Errorf("Expected issue yt-1 to be updated, got %q", updatedIssueID)
+	}
+	if _, err := db.GetSyncItemByGCalID("gcal-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected sync item to be deleted, got error %v", err)
+	}
+}
+
+func TestSync_HooksTransformAndSkipItems(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.Hooks = []Hook{HookFuncs{
+		CreateIssue: func(event *googlecalendar.Event, draft *IssueDraft) error {
+			if strings.Contains(event.Summary, "private") {
+				return ErrSkip
+			}
+			draft.Summary = "[Meeting] " + draft.Summary
+			return nil
+		},
+	}}
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Planning", Updated: time.Now()},
+			{ID: "gcal-2", Summary: "private lunch", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	var created []string
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		created = append(created, summary)
+		return &youtrack.Issue{ID: "yt-" + summary}, nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(created) != 1 || created[0] != "[Meeting] Planning" {
+		t.Errorf("Expected only the transformed planning issue, got %v", created)
+	}
+}
+
+func TestExprHook(t *testing.T) {
+	hook, err := NewExprHook(ExprHookSources{
+		CreateIssue: `event.Summary contains "private" ? "skip" : lower(event.Summary) contains "incident" ? {type: "Bug", tags: ["ops"]} : nil`,
+		UpdateEvent: `{summary: "[" + issue.IDReadable + "] " + draft.Summary}`,
+	})
+	if err != nil {
+		t.Fatalf("NewExprHook() error = %v", err)
+	}
+
+	draft := &IssueDraft{Summary: "Incident review", CustomFields: []youtrack.CustomFieldWrapper{youtrack.EnumField("Type", "Task")}}
+	if err := hook.BeforeCreateIssue(&googlecalendar.Event{Summary: "Incident review"}, draft); err != nil {
+		t.Fatalf("BeforeCreateIssue() error = %v", err)
+	}
+	if len(draft.CustomFields) != 1 || draft.CustomFields[0].Value != (youtrack.NamedValue{Name: "Bug"}) {
+		t.Errorf("Expected the type to be replaced by Bug, got %+v", draft.CustomFields)
+	}
+	if !reflect.DeepEqual(draft.Tags, []string{"ops"}) {
+		t.Errorf("Expected tag ops, got %v", draft.Tags)
+	}
+
+	draft = &IssueDraft{Summary: "Standup"}
+	if err := hook.BeforeCreateIssue(&googlecalendar.Event{Summary: "Standup"}, draft); err != nil || len(draft.CustomFields) != 0 {
+		t.Errorf("Expected nil to leave the draft alone, got %+v (%v)", draft, err)
+	}
+	if err := hook.BeforeCreateIssue(&googlecalendar.Event{Summary: "private"}, &IssueDraft{}); !errors.Is(err, ErrSkip) {
+		t.Errorf("Expected skip to return ErrSkip, got %v", err)
+	}
+	if err := hook.BeforeUpdateIssue(&googlecalendar.Event{Summary: "private"}, &IssueDraft{}); err != nil {
+		t.Errorf("Expected no update issue hook, got %v", err)
+	}
+
+	eventDraft := &EventDraft{Summary: "Release"}
+	if err := hook.BeforeUpdateEvent(&youtrack.Issue{IDReadable: "PRJ-1"}, eventDraft); err != nil {
+		t.Fatalf("BeforeUpdateEvent() error = %v", err)
+	}
+	if eventDraft.Summary != "[PRJ-1] Release" {
+		t.Errorf("Expected summary '[PRJ-1] Release', got %q", eventDraft.Summary)
+	}
+
+	if _, err := NewExprHook(ExprHookSources{CreateEvent: "event.Summary"}); err == nil {
+		t.Error("Expected an error for an event expression reading an event")
+	}
+	if hook, err := NewExprHook(ExprHookSources{}); hook != nil || err != nil {
+		t.Errorf("Expected no hook without expressions, got %v (%v)", hook, err)
+	}
+	hook, _ = NewExprHook(ExprHookSources{CreateEvent: `{start: "tomorrow"}`})
+	if err := hook.BeforeCreateEvent(&youtrack.Issue{}, &EventDraft{}); err == nil {
+		t.Error("Expected an error for an unknown event field")
+	}
+}
+
+func TestIssueTypeRules(t *testing.T) {
+	rules, err := ParseIssueTypeRules("(?i)standup|sync=Meeting; (?i)incident=Bug")
+	if err != nil {
+		t.Fatalf("ParseIssueTypeRules() error = %v", err)
+	}
+	s := &Synchronizer{IssueType: "Task", IssueTypeRules: rules}
+
+	tests := map[string]string{
+		"Daily Standup":       "Meeting",
+		"Incident review":     "Bug",
+		"Write release notes": "Task",
+	}
+	for summary, want := range tests {
+		draft := s.issueDraft(&googlecalendar.Event{Summary: summary})
+		if len(draft.CustomFields) != 1 || draft.CustomFields[0].Value != (youtrack.NamedValue{Name: want}) {
+			t.Errorf("Expected %q to create a %s, got %+v", summary, want, draft.CustomFields)
+		}
+	}
+
+	if _, err := ParseIssueTypeRules("Meeting"); err == nil {
+		t.Error("Expected an error for a rule without a type")
+	}
+}
+
+func TestSync_DefaultFieldsAndTagsApplyToCreatedIssues(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	var err error
+	s.DefaultFields, err = ParseDefaultFields("Assignee=me; Subsystem=Ops")
+	if err != nil {
+		t.Fatalf("ParseDefaultFields() error = %v", err)
+	}
+	s.DefaultTags = []string{"calendar"}
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Planning", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	ytClient.getCurrentUserFunc = func() (*youtrack.User, error) {
+		return &youtrack.User{Login: "jane"}, nil
+	}
+	var gotFields []youtrack.CustomFieldWrapper
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		gotFields = fields
+		return &youtrack.Issue{ID: "yt-1"}, nil
+	}
+	var gotTags []string
+	ytClient.addTagFunc = func(issueID, tagName string) error {
+		gotTags = append(gotTags, tagName)
+		return nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(gotFields) != 2 {
+		t.Fatalf("Expected 2 default fields, got %+v", gotFields)
+	}
+	if gotFields[0].Type != "SingleUserIssueCustomField" || gotFields[0].Value != (youtrack.UserValue{Login: "jane"}) {
+		t.Errorf("Expected Assignee to resolve to the current user, got %+v", gotFields[0])
+	}
+	if gotFields[1].Type != "SingleEnumIssueCustomField" || gotFields[1].Value != (youtrack.NamedValue{Name: "Ops"}) {
+		t.Errorf("Unexpected Subsystem field: %+v", gotFields[1])
+	}
+	if len(gotTags) != 1 || gotTags[0] != "calendar" {
+		t.Errorf("Expected the calendar tag, got %v", gotTags)
+	}
+}
+
+func TestSync_MinAttendees(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.MinAttendees = 3
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "One on one", Attendees: 2, Updated: time.Now()},
+			{ID: "gcal-2", Summary: "Planning", Attendees: 3, Updated: time.Now()},
+			{ID: "gcal-3", Summary: "Focus", OrganizedBySelf: true, Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	var created []string
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		created = append(created, summary)
+		return &youtrack.Issue{ID: fmt.Sprintf("yt-%d", len(created))}, nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if want := []string{"Planning", "Focus"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("Expected issues for %v, got %v", want, created)
+	}
+}
+
+func TestSync_ProvenanceComment(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.ProvenanceComment = true
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Planning", HTMLLink: "https://calendar.google.com/event?eid=1", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		return &youtrack.Issue{ID: "yt-1"}, nil
+	}
+	ytClient.updateIssueFunc = func(issueID string, summary, description *string, dueDate *time.Time) error {
+		return nil
+	}
+	comments := map[string][]string{}
+	ytClient.addCommentFunc = func(issueID, text string) error {
+		comments[issueID] = append(comments[issueID], text)
+		return nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	want := "Created by gcal-sync from event [Planning](https://calendar.google.com/event?eid=1) on " + time.Now().Format("2006-01-02") + "."
+	if len(comments["yt-1"]) != 1 || comments["yt-1"][0] != want {
+		t.Errorf("Expected the comment %q, got %q", want, comments["yt-1"])
+	}
+
+	// Issues are commented on once, when they are created.
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if len(comments["yt-1"]) != 1 {
+		t.Errorf("Expected a single comment, got %q", comments["yt-1"])
+	}
+}
+
+func TestSync_TagHashtagsAndColors(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+	ytServer.AddTag("urgent")
+	ytServer.AddTag("Needs review")
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.Tags = TagSync{Hashtags: []string{"urgent"}, Colors: map[string]string{"urgent": "11"}, ParseHashtags: true}
+	s.EchoWindow = 0
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Release", Tags: []youtrack.Tag{{Name: "urgent"}}, CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	item, _ := db.GetSyncItemByYTID(issue.ID)
+	event := gcalServer.Event("primary", item.GCalID.String)
+	if event.Summary != "Release #urgent" || event.ColorId != "11" {
+		t.Fatalf("Expected a tomato event with the hashtag, got %q in color %q", event.Summary, event.ColorId)
+	}
+
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) { e.Summary = "Release 2 #urgent #Needs_review" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := ytServer.Issue(issue.ID).Summary; got != "Release 2" {
+		t.Errorf("Expected the hashtags to be left out of the issue summary, got %q", got)
+	}
+	if got := ytServer.Tags(issue.ID); !reflect.DeepEqual(got, []string{"urgent", "Needs review"}) {
+		t.Errorf("Expected the hashtag to add its tag, got %v", got)
+	}
+
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Tags = i.Tags[1:] })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	event = gcalServer.Event("primary", event.Id)
+	if event.Summary != "Release 2" || event.ColorId != "" {
+		t.Errorf("Expected the event to lose the hashtag and color of the removed tag, got %q in color %q", event.Summary, event.ColorId)
+	}
+}
+
+func TestTagSync_SplitSummary(t *testing.T) {
+	tags := TagSync{Hashtags: []string{"urgent"}, Colors: map[string]string{"On Call": "3"}}
+	for _, tt := range []struct {
+		parse   bool
+		summary string
+		want    string
+		tags    []string
+	}{
+		{false, "Release #urgent", "Release", nil},
+		{false, "Release #other", "Release #other", nil},
+		{false, "Fix #12 #urgent", "Fix #12", nil},
+		{true, "Release #other #URGENT #on_call", "Release", []string{"other", "urgent", "On Call"}},
+		{true, "Release #2", "Release #2", nil},
+		{true, "#urgent", "#urgent", nil},
+	} {
+		tags.ParseHashtags = tt.parse
+		summary, got := tags.splitSummary(tt.summary)
+		if summary != tt.want || !reflect.DeepEqual(got, tt.tags) {
+			t.Errorf("splitSummary(%q) = %q, %v, want %q, %v", tt.summary, summary, got, tt.want, tt.tags)
+		}
+	}
+}
+
+func TestParseTagColors(t *testing.T) {
+	colors, err := ParseTagColors("urgent=Tomato; On Call = 3")
+	if err != nil {
+		t.Fatalf("ParseTagColors() error = %v", err)
+	}
+	if want := map[string]string{"urgent": "11", "On Call": "3"}; !reflect.DeepEqual(colors, want) {
+		t.Errorf("ParseTagColors() = %v, want %v", colors, want)
+	}
+	for _, spec := range []string{"urgent", "urgent=pink", "urgent=12", "=tomato"} {
+		if _, err := ParseTagColors(spec); err == nil {
+			t.Errorf("ParseTagColors(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestEventDraft_DurationByPriorityAndType(t *testing.T) {
+	_, _, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	ytClient.getBaseURLFunc = func() string { return "https://youtrack.example.com" }
+	s.EventTiming = EventTimingTimed
+	s.EventDuration = 45 * time.Minute
+	var err error
+	if s.PriorityDurations, err = ParseEventDurations("Critical=2h; show-stopper = 3h"); err != nil {
+		t.Fatalf("ParseEventDurations() error = %v", err)
+	}
+	if s.TypeDurations, err = ParseEventDurations("Bug=30m"); err != nil {
+		t.Fatalf("ParseEventDurations() error = %v", err)
+	}
+
+	field := func(name, value string) youtrack.CustomField {
+		return youtrack.CustomField{Name: name, Value: youtrack.NamedValue{Name: value}}
+	}
+	dueDate := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	for _, tt := range []struct {
+		fields []youtrack.CustomField
+		want   time.Duration
+	}{
+		{nil, 45 * time.Minute},
+		{[]youtrack.CustomField{field("Priority", "critical")}, 2 * time.Hour},
+		{[]youtrack.CustomField{field("Priority", "Show-stopper"), field("Type", "Bug")}, 3 * time.Hour},
+		{[]youtrack.CustomField{field("Priority", "Normal"), field("Type", "Bug")}, 30 * time.Minute},
+	} {
+		draft, err := s.eventDraft(youtrack.Issue{ID: "2-1", Summary: "Task", CustomFields: tt.fields}, dueDate)
+		if err != nil {
+			t.Fatalf("eventDraft() error = %v", err)
+		}
+		if got := draft.End.Sub(draft.Start); got != tt.want {
+			t.Errorf("Event of %v lasts %s, want %s", tt.fields, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"Critical", "Critical=soon", "Critical=-1h", "=2h"} {
+		if _, err := ParseEventDurations(spec); err == nil {
+			t.Errorf("ParseEventDurations(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestApplyOrganizerAssignee(t *testing.T) {
+	_, _, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.AssignOrganizer = true
+	s.AssigneeFallback = "triage"
+	s.DefaultFields = []DefaultField{{Kind: youtrack.FieldKindUser, Name: "Assignee", Value: "nobody"}}
+
+	ytClient.findUserByEmailFunc = func(email string) (*youtrack.User, error) {
+		if email == "jane@example.com" {
+			return &youtrack.User{Login: "jane", Email: email}, nil
+		}
+		return nil, nil
+	}
+
+	tests := map[string]string{
+		"jane@example.com":     "jane",
+		"external@example.org": "triage",
+	}
+	for organizer, want := range tests {
+		draft := &IssueDraft{}
+		if err := s.applyOrganizerAssignee(&googlecalendar.Event{Organizer: organizer}, draft); err != nil {
+			t.Fatalf("applyOrganizerAssignee() error = %v", err)
+		}
+		if err := s.applyDefaultFields(draft); err != nil {
+			t.Fatalf("applyDefaultFields() error = %v", err)
+		}
+		if len(draft.CustomFields) != 1 || draft.CustomFields[0].Value != (youtrack.UserValue{Login: want}) {
+			t.Errorf("Expected organizer %s to assign %s, got %+v", organizer, want, draft.CustomFields)
+		}
+	}
+}
+
+func projectField(name, fieldType string) youtrack.ProjectCustomField {
+	var field youtrack.ProjectCustomField
+	field.Field.Name = name
+	field.Field.FieldType.ID = fieldType
+	return field
+}
+
+func TestValidateFields(t *testing.T) {
+	_, _, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.LocationField = "Room"
+	s.IssueType = "Meeting"
+
+	ytClient.getProjectFieldsFunc = func(projectID string) ([]youtrack.ProjectCustomField, error) {
+		return []youtrack.ProjectCustomField{
+			projectField("Due Date", "date"),
+			projectField("Room", "enum[1]"),
+		}, nil
+	}
+
+	err := s.ValidateFields()
+	if err == nil {
+		t.Fatal("Expected a validation error")
+	}
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Expected ErrSchemaMismatch, got %v", err)
+	}
+	for _, want := range []string{`"Room" has type enum[1], expected string`, `"Type" does not exist`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got %v", want, err)
+		}
+	}
+
+	s.LocationField = ""
+	s.IssueType = ""
+	if err := s.ValidateFields(); err != nil {
+		t.Errorf("Expected a matching schema to validate, got %v", err)
+	}
+
+	ytClient.getProjectFieldsFunc = func(projectID string) ([]youtrack.ProjectCustomField, error) {
+		return nil, errors.New("403 Forbidden")
+	}
+	if err := s.ValidateFields(); err == nil || errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Expected an unreadable schema not to be a mismatch, got %v", err)
+	}
+}
+
+func TestSync_ResultRecordsItemFailures(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Planning", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		return nil, errors.New("boom")
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	result := s.LastResult()
+	if !result.Failed() || len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "boom") {
+		t.Errorf("Expected the failed create to be recorded, got %+v", result.Errors)
+	}
+}
+
+func TestSync_RevokedTokenPausesSync(t *testing.T) {
+	_, gcalClient, _, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	fetches := 0
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		fetches++
+		return nil, "", fmt.Errorf("unable to retrieve events from calendar: %w", &oauth2.RetrieveError{ErrorCode: "invalid_grant"})
+	}
+	notified := 0
+	s.OnReauthRequired = func(err error) { notified++ }
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Sync(); !errors.Is(err, ErrReauthRequired) {
+			t.Fatalf("Expected ErrReauthRequired, got %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected calendar requests to stop after the failure, got %d fetches", fetches)
+	}
+	if notified != 1 {
+		t.Errorf("Expected a single notification, got %d", notified)
+	}
+	if s.AuthError() == nil {
+		t.Error("Expected AuthError to report the revoked token")
+	}
+
+	renewed := &mockGCalClient{fetchEventsFunc: func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "token", nil
+	}}
+	s.Reauthorized(renewed)
+	if s.AuthError() != nil {
+		t.Errorf("Expected Reauthorized to clear the error, got %v", s.AuthError())
+	}
+}
+
+func TestDB_SnapshotCopiesSyncItems(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	item := &SyncItem{
+		GCalID:            sql.NullString{String: "gcal-1", Valid: true},
+		YTID:              sql.NullString{String: "yt-1", Valid: true},
+		DependencyWarning: sql.NullString{String: "warning", Valid: true},
+	}
+	if _, err := db.CreateSyncItem(item); err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	defer snapshot.Close()
+	copied, err := snapshot.GetSyncItemByGCalID("gcal-1")
+	if err != nil || copied == nil {
+		t.Fatalf("Expected the item in the snapshot, got %v, %v", copied, err)
+	}
+	if copied.YTID.String != "yt-1" || copied.DependencyWarning.String != "warning" {
+		t.Errorf("Unexpected copy: %+v", copied)
+	}
+}
+
+func TestDB_UpdateSyncItemRejectsStaleItems(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := db.CreateSyncItem(&SyncItem{
+		GCalID: sql.NullString{String: "gcal-1", Valid: true},
+		YTID:   sql.NullString{String: "yt-1", Valid: true},
+	}); err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+	loop, _ := db.GetSyncItemByGCalID("gcal-1")
+	webhook, _ := db.GetSyncItemByGCalID("gcal-1")
+
+	webhook.ResponseStatus = sql.NullString{String: "accepted", Valid: true}
+	if err := db.UpdateSyncItem(webhook); err != nil {
+		t.Fatalf("UpdateSyncItem() error = %v", err)
+	}
+	if webhook.Version != 1 {
+		t.Errorf("Expected version 1 after the update, got %d", webhook.Version)
+	}
+	loop.ConflictWarning = sql.NullString{String: "meeting", Valid: true}
+	if err := db.UpdateSyncItem(loop); !errors.Is(err, ErrStale) {
+		t.Fatalf("Expected ErrStale for the item read before the update, got %v", err)
+	}
+
+	stored, _ := db.GetSyncItemByGCalID("gcal-1")
+	if stored.ResponseStatus.String != "accepted" || stored.ConflictWarning.Valid {
+		t.Errorf("Expected the first update to be kept, got %+v", stored)
+	}
+	stored.ConflictWarning = sql.NullString{String: "meeting", Valid: true}
+	if err := db.UpdateSyncItem(stored); err != nil {
+		t.Errorf("Expected the item read again to update, got %v", err)
+	}
+}
+
+func TestDB_SyncItemsFiltersAndPages(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	synced := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < syncItemPage+1; i++ {
+		if _, err := db.CreateSyncItem(&SyncItem{
+			GCalID:        sql.NullString{String: fmt.Sprintf("gcal-%d", i), Valid: true},
+			YTID:          sql.NullString{String: fmt.Sprintf("yt-%d", i), Valid: true},
+			GCalUpdatedAt: sql.NullTime{Time: synced.Add(time.Duration(i) * time.Minute), Valid: true},
+		}); err != nil {
+			t.Fatalf("CreateSyncItem() error = %v", err)
+		}
+	}
+
+	collect := func(filter SyncItemFilter) []string {
+		t.Helper()
+		var ids []string
+		for item, err := range db.SyncItems(filter) {
+			if err != nil {
+				t.Fatalf("SyncItems() error = %v", err)
+			}
+			ids = append(ids, item.GCalID.String)
+		}
+		return ids
+	}
+	if got := collect(SyncItemFilter{GCalIDs: []string{"gcal-3", "gcal-500", "gcal-missing"}}); !reflect.DeepEqual(got, []string{"gcal-3", "gcal-500"}) {
+		t.Errorf("Expected the items of the events, got %v", got)
+	}
+	if got := collect(SyncItemFilter{YTIDs: []string{}}); len(got) != 0 {
+		t.Errorf("Expected an empty ID set to select nothing, got %v", got)
+	}
+	if got := collect(SyncItemFilter{UpdatedSince: synced.Add(499 * time.Minute)}); !reflect.DeepEqual(got, []string{"gcal-499", "gcal-500"}) {
+		t.Errorf("Expected the items updated since, got %v", got)
+	}
+
+	// Times written in other zones compare as times: 14:00+02:00 is 12:00 UTC.
+	berlin := time.FixedZone("CEST", 2*60*60)
+	if _, err := db.CreateSyncItem(&SyncItem{
+		GCalID:      sql.NullString{String: "gcal-zoned", Valid: true},
+		YTUpdatedAt: sql.NullTime{Time: synced.Add(600 * time.Minute).In(berlin), Valid: true},
+	}); err != nil {
+		t.Fatalf("CreateSyncItem() error = %v", err)
+	}
+	// Older versions stored the zone they were given.
+	if _, err := db.Exec("INSERT INTO sync_items (gcal_id, gcal_updated_at) VALUES (?, ?)", "gcal-legacy", synced.Add(30*time.Minute).In(berlin)); err != nil {
+		t.Fatalf("Failed to insert a legacy item: %v", err)
+	}
+	if err := db.migrateSchema(); err != nil {
+		t.Fatalf("migrateSchema() error = %v", err)
+	}
+	if got := collect(SyncItemFilter{UpdatedSince: synced.Add(500 * time.Minute).In(berlin)}); !reflect.DeepEqual(got, []string{"gcal-500", "gcal-zoned"}) {
+		t.Errorf("Expected the items updated since across zones, got %v", got)
+	}
+	if got := collect(SyncItemFilter{GCalIDs: []string{"gcal-legacy"}, UpdatedSince: synced.Add(31 * time.Minute)}); len(got) != 0 {
+		t.Errorf("Expected the legacy item to compare in UTC, got %v", got)
+	}
+	if got := collect(SyncItemFilter{GCalIDs: []string{"gcal-legacy"}, UpdatedSince: synced.Add(30 * time.Minute)}); !reflect.DeepEqual(got, []string{"gcal-legacy"}) {
+		t.Errorf("Expected the legacy item to be updated since, got %v", got)
+	}
+	if _, err := db.Exec("DELETE FROM sync_items WHERE gcal_id IN ('gcal-zoned', 'gcal-legacy')"); err != nil {
+		t.Fatalf("Failed to delete the zoned items: %v", err)
+	}
+
+	// Items can be deleted while iterating across pages.
+	seen := 0
+	for item, err := range db.SyncItems(SyncItemFilter{}) {
+		if err != nil {
+			t.Fatalf("SyncItems() error = %v", err)
+		}
+		seen++
+		if err := db.DeleteSyncItem(item.ID); err != nil {
+			t.Fatalf("DeleteSyncItem() error = %v", err)
+		}
+	}
+	if seen != syncItemPage+1 {
+		t.Errorf("Expected %d items over two pages, got %d", syncItemPage+1, seen)
+	}
+	if items, _ := db.GetAllSyncItems(); len(items) != 0 {
+		t.Errorf("Expected every item deleted, got %d", len(items))
+	}
+}
+
+func TestSync_ObserveReportsChangesWithoutWriting(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "Planning", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		t.Error("Expected no event to be created in observe mode")
+		return nil, errors.New("unexpected write")
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{
+			{ID: "yt-1", Summary: "New YT Issue", Updated: time.Now().UnixMilli(), CustomFields: []youtrack.CustomField{
+				{Name: "Due Date", Value: float64(time.Now().UnixMilli())},
+			}},
+		}, nil
+	}
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		t.Error("Expected no issue to be created in observe mode")
+		return nil, errors.New("unexpected write")
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+
+	var out strings.Builder
+	if err := s.Observe(NewChangeFeed(&out).ForMapping("work")); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	var changes []Change
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var change Change
+		if err := json.Unmarshal([]byte(line), &change); err != nil {
+			t.Fatalf("Invalid change line %q: %v", line, err)
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d: %s", len(changes), out.String())
+	}
+	if c := changes[0]; c.Target != ChangeTargetYouTrack || c.Action != "create" || textOf(c.Summary) != "Planning" || c.Mapping != "work" {
+		t.Errorf("Unexpected first change %+v", c)
+	}
+	if c := changes[1]; c.Target != ChangeTargetGoogle || c.Action != "create" || textOf(c.Summary) != "New YT Issue" {
+		t.Errorf("Unexpected second change %+v", c)
+	}
+
+	items, err := db.GetAllSyncItems()
+	if err != nil {
+		t.Fatalf("GetAllSyncItems() error = %v", err)
+	}
+	if len(items) != 0 {
+		t.Errorf("Expected the sync state to be untouched, got %d items", len(items))
+	}
+	if token, _ := db.GetGCalSyncToken(); token != "" {
+		t.Errorf("Expected the sync token to be untouched, got %q", token)
+	}
+}
+
+func TestSync_ReplaysRecordedFixtures(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ytHTTPClient, err := httpclient.New(httpclient.Options{Replay: filepath.Join("testdata", "replay", "youtrack.json")})
+	if err != nil {
+		t.Fatalf("Failed to load YouTrack fixture: %v", err)
+	}
+	gcalHTTPClient, err := httpclient.New(httpclient.Options{Replay: filepath.Join("testdata", "replay", "google.json")})
+	if err != nil {
+		t.Fatalf("Failed to load Google fixture: %v", err)
+	}
+	ytClient := youtrack.NewClient("https://youtrack.example.com", "token")
+	ytClient.HTTPClient = ytHTTPClient
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalHTTPClient)
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "replay"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+
+	s := NewSynchronizer(gcalClient, ytClient, db, WithProject("yt-project"), WithQueryProject("yt-query-project"), WithCalendar("gcal-calendar"))
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result := s.LastResult(); len(result.Errors) > 0 {
+		t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+	}
+
+	fromEvent, err := db.GetSyncItemByGCalID("evt-1")
+	if err != nil || fromEvent == nil {
+		t.Fatalf("Expected a sync item for the recorded event, got %v (%v)", fromEvent, err)
+	}
+	if fromEvent.YTID.String != "2-2" {
+		t.Errorf("Expected the event to be linked to the created issue, got %q", fromEvent.YTID.String)
+	}
+	fromIssue, err := db.GetSyncItemByYTID("2-1")
+	if err != nil || fromIssue == nil {
+		t.Fatalf("Expected a sync item for the recorded issue, got %v (%v)", fromIssue, err)
+	}
+	if fromIssue.GCalID.String != "evt-2" {
+		t.Errorf("Expected the issue to be linked to the created event, got %q", fromIssue.GCalID.String)
+	}
+	if token, _ := db.GetGCalSyncToken(); token != "sync-token-1" {
+		t.Errorf("Expected the recorded sync token to be stored, got %q", token)
+	}
+}
+
+func TestSync_AgainstFakeServers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	ytClient := youtrack.NewClient(ytServer.URL, "token")
+	s := NewSynchronizer(gcalClient, ytClient, db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Team sync",
+		Start:   &calendar.EventDateTime{Date: tomorrow},
+		End:     &calendar.EventDateTime{Date: tomorrow},
+	})
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{
+		Summary:      "Write report",
+		CustomFields: []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}},
+	})
+
+	sync := func() {
+		t.Helper()
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if result := s.LastResult(); len(result.Errors) > 0 {
+			t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+		}
+	}
+
+	// Both sides get a counterpart of the other's new item.
+	sync()
+	if issues := ytServer.Issues(); len(issues) != 2 || issues[1].Summary != "Team sync" {
+		t.Fatalf("Expected an issue to be created for the event, got %+v", issues)
+	}
+	events := gcalServer.Events("primary")
+	if len(events) != 2 || events[1].Summary != "Write report" {
+		t.Fatalf("Expected an event to be created for the issue, got %d events", len(events))
+	}
+	fromEvent, _ := db.GetSyncItemByGCalID(event.Id)
+	if fromEvent == nil {
+		t.Fatal("Expected the event to be linked")
+	}
+	fromIssue, _ := db.GetSyncItemByYTID(issue.ID)
+	if fromIssue == nil || fromIssue.GCalID.String != events[1].Id {
+		t.Fatalf("Expected the issue to be linked to the created event, got %+v", fromIssue)
+	}
+
+	// A repeated pass creates no duplicates.
+	sync()
+	if got := len(ytServer.Issues()); got != 2 {
+		t.Errorf("Expected no new issues, got %d", got)
+	}
+	if got := len(gcalServer.Events("primary")); got != 2 {
+		t.Errorf("Expected no new events, got %d", got)
+	}
+
+	// Edits propagate in both directions.
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) { e.Summary = "Team sync (moved)" })
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Summary = "Write final report" })
+	sync()
+	if got := ytServer.Issue(fromEvent.YTID.String).Summary; got != "Team sync (moved)" {
+		t.Errorf("Expected the event edit to reach YouTrack, got %q", got)
+	}
+	if got := gcalServer.Event("primary", fromIssue.GCalID.String).Summary; got != "Write final report" {
+		t.Errorf("Expected the issue edit to reach Google Calendar, got %q", got)
+	}
+
+	// An expired sync token falls back to a full listing without duplicates.
+	gcalServer.ExpireSyncTokens()
+	sync()
+	if got := len(ytServer.Issues()); got != 2 {
+		t.Errorf("Expected no new issues after a full listing, got %d", got)
+	}
+}
+
+func TestSync_QueriesSeveralProjects(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ, OPS"), WithCalendar("primary"))
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	due := []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}}
+	ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Write report", CustomFields: due})
+	ytServer.AddIssue("OPS", youtrack.Issue{Summary: "Rotate keys", CustomFields: due})
+	ytServer.AddIssue("HOME", youtrack.Issue{Summary: "Water plants", CustomFields: due})
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Team sync",
+		Start:   &calendar.EventDateTime{Date: tomorrow},
+		End:     &calendar.EventDateTime{Date: tomorrow},
+	})
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	var summaries []string
+	for _, event := range gcalServer.Events("primary") {
+		summaries = append(summaries, event.Summary)
+	}
+	sort.Strings(summaries)
+	if want := []string{"Rotate keys", "Team sync", "Write report"}; !reflect.DeepEqual(summaries, want) {
+		t.Errorf("Expected events %v, got %v", want, summaries)
+	}
+	for _, issue := range ytServer.Issues() {
+		if issue.Summary == "Team sync" && issue.Project.ID != "PRJ" {
+			t.Errorf("Expected the issue of the event in PRJ, got %s", issue.Project.ID)
+		}
+	}
+}
+
+func TestSync_IgnoresItemsBeforeStartDate(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.StartDate = time.Now().AddDate(0, 0, 5)
+
+	for _, days := range []int{2, 10} {
+		date := time.Now().AddDate(0, 0, days).Truncate(24 * time.Hour)
+		ytServer.AddIssue("PRJ", youtrack.Issue{Summary: fmt.Sprintf("Issue in %d days", days), CustomFields: []youtrack.CustomField{
+			{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(date.UnixMilli())},
+		}})
+		gcalServer.AddEvent("primary", &calendar.Event{
+			Summary: fmt.Sprintf("Event in %d days", days),
+			Start:   &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+			End:     &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+		})
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	var events, issues []string
+	for _, event := range gcalServer.Events("primary") {
+		events = append(events, event.Summary)
+	}
+	for _, issue := range ytServer.Issues() {
+		issues = append(issues, issue.Summary)
+	}
+	sort.Strings(events)
+	sort.Strings(issues)
+	if want := []string{"Event in 10 days", "Event in 2 days", "Issue in 10 days"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+	if want := []string{"Event in 10 days", "Issue in 10 days", "Issue in 2 days"}; !reflect.DeepEqual(issues, want) {
+		t.Errorf("Expected issues %v, got %v", want, issues)
+	}
+}
+
+func TestSync_OnlyManagesMarkedEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.EventMarker = EventMarker{Prefix: "📌 ", Suffix: " [YT]"}
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Truncate(24 * time.Hour)
+	ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Write report", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(tomorrow.UnixMilli())},
+	}})
+	for _, summary := range []string{"Lunch", "📌 Team sync [YT]"} {
+		gcalServer.AddEvent("primary", &calendar.Event{
+			Summary: summary,
+			Start:   &calendar.EventDateTime{Date: tomorrow.Format("2006-01-02")},
+			End:     &calendar.EventDateTime{Date: tomorrow.Format("2006-01-02")},
+		})
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	var events, issues []string
+	for _, event := range gcalServer.Events("primary") {
+		events = append(events, event.Summary)
+	}
+	for _, issue := range ytServer.Issues() {
+		issues = append(issues, issue.Summary)
+	}
+	sort.Strings(events)
+	sort.Strings(issues)
+	if want := []string{"Lunch", "📌 Team sync [YT]", "📌 Write report [YT]"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+	if want := []string{"Team sync", "Write report"}; !reflect.DeepEqual(issues, want) {
+		t.Errorf("Expected issues %v, got %v", want, issues)
+	}
+}
+
+func TestSync_SetsVisibilityAndTransparencyOfEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.EventVisibility = "private"
+	if s.EventTransparency, err = ParseTransparency("free"); err != nil {
+		t.Fatalf("ParseTransparency() error = %v", err)
+	}
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Placeholder", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	item, _ := db.GetSyncItemByYTID(issue.ID)
+	event := gcalServer.Event("primary", item.GCalID.String)
+	if event.Visibility != "private" || event.Transparency != "transparent" {
+		t.Fatalf("Expected a private, free event, got visibility %q and transparency %q", event.Visibility, event.Transparency)
+	}
+
+	s.EventTransparency = "opaque"
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Summary = "Placeholder (edited)" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := gcalServer.Event("primary", item.GCalID.String).Transparency; got != "opaque" {
+		t.Errorf("Expected the update to make the event busy, got transparency %q", got)
+	}
+}
+
+func TestSync_EventTiming(t *testing.T) {
+	day := time.Now().AddDate(0, 0, 3)
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	afternoon := midnight.Add(14*time.Hour + 30*time.Minute)
+
+	tests := []struct {
+		timing    EventTiming
+		due       time.Time
+		wantStart *calendar.EventDateTime
+		wantEnd   *calendar.EventDateTime
+	}{
+		{EventTimingAllDay, afternoon,
+			&calendar.EventDateTime{Date: midnight.Format("2006-01-02")},
+			&calendar.EventDateTime{Date: midnight.AddDate(0, 0, 1).Format("2006-01-02")}},
+		{EventTimingTimed, afternoon,
+			&calendar.EventDateTime{DateTime: midnight.Add(8 * time.Hour).Format(time.RFC3339)},
+			&calendar.EventDateTime{DateTime: midnight.Add(9*time.Hour + 30*time.Minute).Format(time.RFC3339)}},
+		{EventTimingAuto, afternoon,
+			&calendar.EventDateTime{DateTime: afternoon.Format(time.RFC3339)},
+			&calendar.EventDateTime{DateTime: afternoon.Add(90 * time.Minute).Format(time.RFC3339)}},
+		{EventTimingAuto, midnight,
+			&calendar.EventDateTime{Date: midnight.Format("2006-01-02")},
+			&calendar.EventDateTime{Date: midnight.AddDate(0, 0, 1).Format("2006-01-02")}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.timing), func(t *testing.T) {
+			db, cleanup := setupTestDB(t)
+			defer cleanup()
+			gcalServer := fake.NewCalendar()
+			defer gcalServer.Close()
+			ytServer := fake.NewYouTrack()
+			defer ytServer.Close()
+
+			ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+			gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+			if err != nil {
+				t.Fatalf("Failed to create Google Calendar client: %v", err)
+			}
+			s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+			s.EventTiming = tt.timing
+			s.EventTime = 8 * time.Hour
+			s.EventDuration = 90 * time.Minute
+
+			issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Deadline", CustomFields: []youtrack.CustomField{
+				{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(tt.due.UnixMilli())},
+			}})
+			if _, err := s.Sync(); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			item, _ := db.GetSyncItemByYTID(issue.ID)
+			event := gcalServer.Event("primary", item.GCalID.String)
+			if !reflect.DeepEqual(event.Start, tt.wantStart) || !reflect.DeepEqual(event.End, tt.wantEnd) {
+				t.Errorf("Expected %+v to %+v, got %+v to %+v", tt.wantStart, tt.wantEnd, event.Start, event.End)
+			}
+		})
+	}
+}
+
+func TestSync_SnapsEventsIntoWorkingHours(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.EventTiming = EventTimingAuto
+	s.WorkingHours, err = ParseWorkingHours("09:00-17:00")
+	if err != nil {
+		t.Fatalf("ParseWorkingHours() error = %v", err)
+	}
+	s.WorkingHours.SkipWeekends = true
+	// The event is edited right after it was written.
+	s.EchoWindow = 0
+
+	today := time.Now()
+	saturday := time.Date(today.Year(), today.Month(), today.Day()+7+int(time.Saturday-today.Weekday()), 15, 0, 0, 0, time.Local)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Report", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(saturday.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	item, _ := db.GetSyncItemByYTID(issue.ID)
+	event := gcalServer.Event("primary", item.GCalID.String)
+	friday := time.Date(saturday.Year(), saturday.Month(), saturday.Day()-1, 16, 0, 0, 0, time.Local)
+	if event.Start.DateTime != friday.Format(time.RFC3339) || event.End.DateTime != friday.Add(time.Hour).Format(time.RFC3339) {
+		t.Errorf("Expected the event on Friday 16:00 to 17:00, got %+v to %+v", event.Start, event.End)
+	}
+	if !strings.Contains(event.Description, "Deadline: due "+saturday.Format("Mon Jan 2 2006 15:04")) {
+		t.Errorf("Expected the description to mark the event as a deadline, got %q", event.Description)
+	}
+
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) { e.Summary = "Quarterly report" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	got := ytServer.Issue(issue.ID)
+	if got.Summary != "Quarterly report" {
+		t.Errorf("Expected the summary to sync, got %q", got.Summary)
+	}
+	if due := issueDueDate(*got); !due.Equal(saturday) {
+		t.Errorf("Expected the due date to stay %v, got %v", saturday, due)
+	}
+}
+
+func TestSync_DescriptionSync(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.DescriptionSync = true
+	// Both sides are edited right after they were written.
+	s.EchoWindow = 0
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Planning", Description: "Agenda:\n- **Budget**", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	item, _ := db.GetSyncItemByYTID(issue.ID)
+	event := gcalServer.Event("primary", item.GCalID.String)
+	if want := "Agenda:<ul><li><b>Budget</b></li></ul><br><br>" + metadataMarker + "<br><a href="; !strings.HasPrefix(event.Description, want) {
+		t.Fatalf("Expected the event description to start with %q, got %q", want, event.Description)
+	}
+
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) {
+		e.Description = strings.Replace(e.Description, "</ul>", "<li>Hiring</li></ul>", 1)
+	})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	want := "Agenda:\n- **Budget**\n- Hiring\n\n" + metadataMarker + "\n" + event.HtmlLink
+	if got := ytServer.Issue(issue.ID).Description; got != want {
+		t.Errorf("Expected the edit to reach the issue as %q, got %q", want, got)
+	}
+
+	// Edits of other fields leave the description alone.
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) { e.Summary = "Planning (moved)" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := ytServer.Issue(issue.ID).Description; got != want {
+		t.Errorf("Expected the description to stay %q, got %q", want, got)
+	}
+
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) {
+		i.Description = strings.Replace(i.Description, "Hiring", "[Hiring](https://example.com/jobs)", 1)
+	})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	event = gcalServer.Event("primary", event.Id)
+	if want := `<li><a href="https://example.com/jobs">Hiring</a></li>`; !strings.Contains(event.Description, want) {
+		t.Errorf("Expected the issue edit to reach the event as %q, got %q", want, event.Description)
+	}
+	if n := strings.Count(event.Description, metadataMarker); n != 1 {
+		t.Errorf("Expected a single metadata block, got %d in %q", n, event.Description)
+	}
+}
+
+func TestMarkdownHTML(t *testing.T) {
+	for _, tt := range []struct {
+		markdown string
+		html     string
+	}{
+		{"Plain text", "Plain text"},
+		{"First line\nSecond line\n\nNew paragraph", "First line<br>Second line<br><br>New paragraph"},
+		{"**Bold**, *italic* and `code`", "<b>Bold</b>, <i>italic</i> and <code>code</code>"},
+		{"See [the doc](https://example.com/a?b=1&c=2) & more", `See <a href="https://example.com/a?b=1&amp;c=2">the doc</a> &amp; more`},
+		{"Items:\n- one\n- two\nAfter", "Items:<ul><li>one</li><li>two</li></ul>After"},
+		{"Steps:\n1. one\n2. two\nDone", "Steps:<ol><li>one</li><li>two</li></ol>Done"},
+		{"1 < 2 > 0", "1 &lt; 2 &gt; 0"},
+	} {
+		if got := MarkdownToHTML(tt.markdown); got != tt.html {
+			t.Errorf("MarkdownToHTML(%q) = %q, want %q", tt.markdown, got, tt.html)
+		}
+		if got := HTMLToMarkdown(tt.html); got != tt.markdown {
+			t.Errorf("HTMLToMarkdown(%q) = %q, want %q", tt.html, got, tt.markdown)
+		}
+	}
+
+	// Descriptions written in Google Calendar
+	for _, tt := range []struct {
+		html     string
+		markdown string
+	}{
+		{"<p>One</p><p>Two&nbsp;words</p>", "One\n\nTwo words"},
+		{`Link: <a href="https://example.com">https://example.com</a>`, "Link: https://example.com"},
+		{"<u>Underlined</u> <strong>strong</strong>", "Underlined **strong**"},
+		{"Plain text\nwith lines", "Plain text\nwith lines"},
+		{"<h2>Agenda</h2>Intro", "**Agenda**\nIntro"},
+		{`<a href="javascript:alert(1)">Click</a> <script>alert(1)</script>`, "Click alert(1)"},
+	} {
+		if got := HTMLToMarkdown(tt.html); got != tt.markdown {
+			t.Errorf("HTMLToMarkdown(%q) = %q, want %q", tt.html, got, tt.markdown)
+		}
+	}
+}
+
+func TestPlaceWork(t *testing.T) {
+	monday := time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)
+	at := func(day int, hour, minute int) time.Time {
+		return monday.AddDate(0, 0, day).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	hours := WorkingHours{Start: 9 * time.Hour, End: 17 * time.Hour, SkipWeekends: true}
+
+	tests := []struct {
+		name        string
+		from, until time.Time
+		estimate    time.Duration
+		busy        []googlecalendar.Busy
+		want        []googlecalendar.Busy
+	}{
+		{"around busy time", at(0, 8, 0), at(2, 12, 0), 5 * time.Hour,
+			[]googlecalendar.Busy{{Start: at(0, 11, 0), End: at(0, 16, 45)}, {Start: at(0, 9, 0), End: at(0, 10, 0)}},
+			[]googlecalendar.Busy{{Start: at(0, 10, 0), End: at(0, 11, 0)}, {Start: at(1, 9, 0), End: at(1, 11, 0)}, {Start: at(1, 11, 0), End: at(1, 13, 0)}}},
+		{"over the weekend", at(4, 16, 0), at(7, 11, 0), 3 * time.Hour, nil,
+			[]googlecalendar.Busy{{Start: at(4, 16, 0), End: at(4, 17, 0)}, {Start: at(7, 9, 0), End: at(7, 11, 0)}}},
+		{"not enough time", at(0, 15, 0), at(0, 18, 0), 4 * time.Hour, nil,
+			[]googlecalendar.Busy{{Start: at(0, 15, 0), End: at(0, 17, 0)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := placeWork(tt.from, tt.until, tt.estimate, tt.busy, hours, 2*time.Hour)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("placeWork() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSync_PlansWorkBlocks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.EventTransparency = "transparent"
+	s.Planner = &Planner{EstimateField: "Estimation", Horizon: DefaultPlanHorizon, BlockLength: 2 * time.Hour}
+	s.WorkingHours = &WorkingHours{Start: 9 * time.Hour, End: 17 * time.Hour, SkipWeekends: true}
+
+	today := time.Now()
+	due := time.Date(today.Year(), today.Month(), today.Day()+7, 17, 0, 0, 0, time.Local)
+	estimate := func(minutes int) youtrack.CustomField {
+		return youtrack.CustomField{YouTrackType: youtrack.YouTrackType{Type: "PeriodIssueCustomField"}, Name: "Estimation", Value: youtrack.PeriodValue{Minutes: minutes}}
+	}
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Report", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(due.UnixMilli())},
+		estimate(180),
+	}})
+
+	workBlocks := func() []*calendar.Event {
+		var blocks []*calendar.Event
+		for _, event := range gcalServer.Events("primary") {
+			if strings.HasPrefix(event.Summary, "Work block: ") {
+				blocks = append(blocks, event)
+			}
+		}
+		return blocks
+	}
+	planned := func() time.Duration {
+		var total time.Duration
+		for _, block := range workBlocks() {
+			start, _ := time.Parse(time.RFC3339, block.Start.DateTime)
+			end, _ := time.Parse(time.RFC3339, block.End.DateTime)
+			local := start.In(time.Local)
+			midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+			if start.Before(midnight.Add(9*time.Hour)) || end.After(midnight.Add(17*time.Hour)) || end.After(due) ||
+				local.Weekday() == time.Saturday || local.Weekday() == time.Sunday {
+				t.Errorf("Expected work blocks within working hours before the due date, got %s to %s", block.Start.DateTime, block.End.DateTime)
+			}
+			if !strings.Contains(block.Description, "/issue/"+issue.IDReadable) || block.Transparency != "opaque" {
+				t.Errorf("Expected a busy block linking to the issue, got %+v", block)
+			}
+			total += end.Sub(start)
+		}
+		return total
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	if got := planned(); got != 3*time.Hour {
+		t.Errorf("Expected 3h of work blocks, got %v", got)
+	}
+	if got := len(ytServer.Issues()); got != 1 {
+		t.Errorf("Expected work blocks not to become issues, got %d issues", got)
+	}
+
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.CustomFields[1] = estimate(60) })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := planned(); got != time.Hour {
+		t.Errorf("Expected the changed estimate to be replanned as 1h, got %v", got)
+	}
+
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Resolved = time.Now().UnixMilli() })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if blocks := workBlocks(); len(blocks) != 0 {
+		t.Errorf("Expected the blocks of the resolved issue to be deleted, got %d", len(blocks))
+	}
+}
+
+func TestSync_RollsUpDeadlines(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.Rollup = &Rollup{Horizon: DefaultRollupHorizon}
+
+	today := time.Now().UTC()
+	busy := time.Date(today.Year(), today.Month(), today.Day()+3, 0, 0, 0, 0, time.UTC)
+	quiet := busy.AddDate(0, 0, 2)
+	dueOn := func(day time.Time, summary string) youtrack.Issue {
+		return ytServer.AddIssue("PRJ", youtrack.Issue{Summary: summary, CustomFields: []youtrack.CustomField{
+			{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(day.UnixMilli())},
+		}})
+	}
+	for _, summary := range []string{"Draft", "Review", "Publish", "Announce"} {
+		dueOn(busy, summary)
+	}
+	lone := dueOn(quiet, "Invoice <ACME>")
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	events := gcalServer.Events("primary")
+	if len(events) != 2 {
+		t.Fatalf("Expected one rollup event per day, got %d events", len(events))
+	}
+	byDay := make(map[string]*calendar.Event)
+	for _, event := range events {
+		byDay[event.Start.Date] = event
+	}
+	first := byDay[busy.Format("2006-01-02")]
+	if first == nil || first.Summary != "Deadlines: PRJ-1, PRJ-2, PRJ-3 (+1 more)" || !strings.Contains(first.Description, "/issue/PRJ-4") {
+		t.Errorf("Expected an all-day event listing the four issues, got %+v", first)
+	}
+	second := byDay[quiet.Format("2006-01-02")]
+	if second == nil || second.Summary != "Deadlines: PRJ-5" || !strings.Contains(second.Description, "Invoice &lt;ACME&gt;") {
+		t.Errorf("Expected an all-day event for the single issue, got %+v", second)
+	}
+	if got := len(ytServer.Issues()); got != 5 {
+		t.Errorf("Expected rollup events not to become issues, got %d issues", got)
+	}
+
+	ytServer.ModifyIssue(lone.ID, func(i *youtrack.Issue) { i.Resolved = time.Now().UnixMilli() })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if events := gcalServer.Events("primary"); len(events) != 1 || events[0].Id != first.Id {
+		t.Errorf("Expected only the rollup event of the busy day to remain, got %d events", len(events))
+	}
+}
+
+func TestSync_WeeklyDigest(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.WeeklyDigest = &WeeklyDigest{At: DefaultDigestTime, Location: time.UTC}
+
+	now := time.Now().UTC()
+	days := (8 - int(now.Weekday())) % 7
+	if days == 0 {
+		days = 7
+	}
+	monday := time.Date(now.Year(), now.Month(), now.Day()+days, 0, 0, 0, 0, time.UTC)
+	dueOn := func(day time.Time, summary string) {
+		ytServer.AddIssue("PRJ", youtrack.Issue{Summary: summary, CustomFields: []youtrack.CustomField{
+			{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(day.UnixMilli())},
+		}})
+	}
+	dueOn(monday.AddDate(0, 0, 1), "Review")
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	var digests []*calendar.Event
+	for _, event := range gcalServer.Events("primary") {
+		if strings.HasPrefix(event.Summary, "Week of ") {
+			digests = append(digests, event)
+		}
+	}
+	if len(digests) != 1 {
+		t.Fatalf("Expected one digest event, got %d", len(digests))
+	}
+	digest := digests[0]
+	if want := monday.AddDate(0, 0, -1).Add(18 * time.Hour).Format(time.RFC3339); digest.Start.DateTime != want || digest.Start.TimeZone != "UTC" {
+		t.Errorf("Expected the digest to start at %s UTC, got %+v", want, digest.Start)
+	}
+	if len(digest.Recurrence) != 1 || digest.Recurrence[0] != "RRULE:FREQ=WEEKLY;BYDAY=SU" {
+		t.Errorf("Expected the digest to recur on Sundays, got %v", digest.Recurrence)
+	}
+	if !strings.HasSuffix(digest.Summary, ": 1 issue due") || !strings.Contains(digest.Description, monday.AddDate(0, 0, 1).Format("Monday, January 2")) {
+		t.Errorf("Expected the digest to list the issue under its day, got %q: %q", digest.Summary, digest.Description)
+	}
+	if got := len(ytServer.Issues()); got != 1 {
+		t.Errorf("Expected the digest not to become an issue, got %d issues", got)
+	}
+
+	dueOn(monday.AddDate(0, 0, 4), "Ship")
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	updated := gcalServer.Event("primary", digest.Id)
+	if !strings.HasSuffix(updated.Summary, ": 2 issues due") || !strings.Contains(updated.Description, "/issue/PRJ-2") {
+		t.Errorf("Expected the digest to be regenerated with both issues, got %q: %q", updated.Summary, updated.Description)
+	}
+}
+
+func TestSync_CreatesMissingCalendar(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	shares, err := ParseCalendarShares([]string{"alice@example.com", "bob@example.com=Writer"})
+	if err != nil {
+		t.Fatalf("ParseCalendarShares() error = %v", err)
+	}
+	newSynchronizer := func() *Synchronizer {
+		s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("youtrack"))
+		s.CalendarSetup = &CalendarSetup{Name: "YouTrack", Shares: shares}
+		return s
+	}
+	due := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+	ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Report", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(due.UnixMilli())},
+	}})
+
+	if _, err := newSynchronizer().Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	calendars := gcalServer.Calendars()
+	if len(calendars) != 1 {
+		t.Fatalf("Expected one calendar to be created, got %v", calendars)
+	}
+	var created string
+	for id, summary := range calendars {
+		if summary != "YouTrack" {
+			t.Errorf("Expected the calendar to be named YouTrack, got %q", summary)
+		}
+		created = id
+	}
+	if events := gcalServer.Events(created); len(events) != 1 || events[0].Summary != "Report" {
+		t.Errorf("Expected the issue's event in the created calendar, got %d events", len(events))
+	}
+	var rules []string
+	for _, rule := range gcalServer.ACL(created) {
+		rules = append(rules, rule.Scope.Value+"="+rule.Role)
+	}
+	if want := []string{"alice@example.com=reader", "bob@example.com=writer"}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("Expected the calendar to be shared as %v, got %v", want, rules)
+	}
+
+	s := newSynchronizer()
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := len(gcalServer.Calendars()); got != 1 || s.CalendarID != created {
+		t.Errorf("Expected a restarted synchronizer to reuse %s, got %s and %d calendars", created, s.CalendarID, got)
+	}
+}
+
+func TestParseCalendarShares(t *testing.T) {
+	if _, err := ParseCalendarShares([]string{"alice"}); err == nil {
+		t.Error("Expected an error for an entry without an email address")
+	}
+	if _, err := ParseCalendarShares([]string{"alice@example.com=editor"}); err == nil {
+		t.Error("Expected an error for an unknown role")
+	}
+	shares, err := ParseCalendarShares([]string{"alice@example.com=freebusyreader", "group:team@example.com=writer"})
+	if err != nil || len(shares) != 2 || shares[0].Role != "freeBusyReader" || !shares[1].Group || shares[1].Email != "team@example.com" {
+		t.Errorf("ParseCalendarShares() = %+v, %v", shares, err)
+	}
+	if got := shares[1].String(); got != "group:team@example.com=writer" {
+		t.Errorf("String() = %q, want the parsed form", got)
+	}
+}
+
+func TestSync_CalendarAccess(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	access := func() []string {
+		shares, err := s.Access()
+		if err != nil {
+			t.Fatalf("Access() error = %v", err)
+		}
+		var got []string
+		for _, share := range shares {
+			got = append(got, share.String())
+		}
+		return got
+	}
+	grant := func(entries ...string) {
+		shares, err := ParseCalendarShares(entries)
+		if err != nil {
+			t.Fatalf("ParseCalendarShares() error = %v", err)
+		}
+		if err := s.Grant(shares); err != nil {
+			t.Fatalf("Grant() error = %v", err)
+		}
+	}
+
+	grant("alice@example.com", "group:team@example.com=writer")
+	if got, want := access(), []string{"alice@example.com=reader", "group:team@example.com=writer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Access() = %v, want %v", got, want)
+	}
+	grant("alice@example.com=writer")
+	if got, want := access(), []string{"group:team@example.com=writer", "alice@example.com=writer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected granting again to change the role, got %v", got)
+	}
+
+	shares, _ := ParseCalendarShares([]string{"alice@example.com", "bob@example.com"})
+	missing, err := s.Revoke(shares)
+	if err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if len(missing) != 1 || missing[0].Email != "bob@example.com" {
+		t.Errorf("Expected bob@example.com to be reported without access, got %v", missing)
+	}
+	if got, want := access(), []string{"group:team@example.com=writer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Access() after revoking = %v, want %v", got, want)
+	}
+}
+
+func TestSync_HooksReadAndPatchRawEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	reminders := &calendar.EventReminders{
+		Overrides:       []*calendar.EventReminder{{Method: "popup", Minutes: 30}},
+		ForceSendFields: []string{"UseDefault"},
+	}
+	s.Hooks = []Hook{HookFuncs{
+		CreateIssue: func(event *googlecalendar.Event, draft *IssueDraft) error {
+			if event.Raw.Source != nil {
+				draft.Description += "\n\nSource: " + event.Raw.Source.Url
+			}
+			return nil
+		},
+		CreateEvent: func(issue *youtrack.Issue, draft *EventDraft) error {
+			draft.Patch = &calendar.Event{Reminders: reminders}
+			return nil
+		},
+	}}
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Vendor call",
+		Start:   &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:     &calendar.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+		Source:  &calendar.EventSource{Title: "CRM", Url: "https://crm.example.com/calls/7"},
+	})
+	due := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Renew contract", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(start.AddDate(0, 0, 2).UnixMilli())},
+	}})
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	var found bool
+	for _, issue := range ytServer.Issues() {
+		if issue.Summary == "Vendor call" {
+			found = strings.Contains(issue.Description, "Source: https://crm.example.com/calls/7")
+		}
+	}
+	if !found {
+		t.Errorf("Expected the issue of the event to link its source, got %+v", ytServer.Issues())
+	}
+	item, err := db.GetSyncItemByYTID(due.ID)
+	if err != nil {
+		t.Fatalf("Expected the due issue to get an event: %v", err)
+	}
+	event := gcalServer.Event("primary", item.GCalID.String)
+	if event.Reminders == nil || event.Reminders.UseDefault || len(event.Reminders.Overrides) != 1 || event.Reminders.Overrides[0].Minutes != 30 {
+		t.Errorf("Expected the patched reminders on the event, got %+v", event.Reminders)
+	}
+	if event.Summary != "Renew contract" {
+		t.Errorf("Expected the patch to keep the written summary, got %q", event.Summary)
+	}
+}
+
+func TestSync_QueuesYouTrackWritesWhileUnreachable(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	// The clock lags, so that YouTrack edits come after the queued writes.
+	clock := newFakeClock(time.Now().Add(-time.Hour))
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"), WithClock(clock))
+	s.Outbox = &Outbox{}
+	// Edits here follow writes faster than any echo could.
+	s.EchoWindow = 0
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+	addEvent := func(summary string) *calendar.Event {
+		return gcalServer.AddEvent("primary", &calendar.Event{
+			Summary: summary,
+			Start:   &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+			End:     &calendar.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+		})
+	}
+	standup, review := addEvent("Standup"), addEvent("Review")
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	issueOf := func(event *calendar.Event) *youtrack.Issue {
+		item, err := db.GetSyncItemByGCalID(event.Id)
+		if err != nil {
+			t.Fatalf("Expected event %s to be linked: %v", event.Summary, err)
+		}
+		return ytServer.Issue(item.YTID.String)
+	}
+	standupID, reviewID := issueOf(standup).ID, issueOf(review).ID
+
+	ytServer.SetUnavailable(true)
+	gcalServer.ModifyEvent("primary", standup.Id, func(e *calendar.Event) { e.Summary = "Standup (moved)" })
+	gcalServer.ModifyEvent("primary", review.Id, func(e *calendar.Event) { e.Summary = "Review v2" })
+	retro := addEvent("Retro")
+	result, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() while YouTrack is unreachable error = %v", err)
+	}
+	if result.Queued != 3 {
+		t.Errorf("Expected two updates and a creation to be queued, got %d", result.Queued)
+	}
+	if got := ytServer.Issue(standupID).Summary; got != "Standup" {
+		t.Errorf("Expected no write to reach YouTrack, got summary %q", got)
+	}
+
+	ytServer.SetUnavailable(false)
+	ytServer.ModifyIssue(reviewID, func(issue *youtrack.Issue) { issue.Summary = "Review (renamed in YouTrack)" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() once YouTrack is back error = %v", err)
+	}
+	if got := ytServer.Issue(standupID).Summary; got != "Standup (moved)" {
+		t.Errorf("Expected the queued update to be made, got summary %q", got)
+	}
+	if got := ytServer.Issue(reviewID).Summary; got != "Review (renamed in YouTrack)" {
+		t.Errorf("Expected the queued update of an issue changed since to be dropped, got summary %q", got)
+	}
+	if got := gcalServer.Event("primary", review.Id).Summary; got != "Review (renamed in YouTrack)" {
+		t.Errorf("Expected the YouTrack change to reach the event, got summary %q", got)
+	}
+	if issueOf(retro).Summary != "Retro" {
+		t.Errorf("Expected the issue of the event added meanwhile to be created, got %+v", issueOf(retro))
+	}
+	if writes, _ := db.QueuedWrites(); len(writes) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v", writes)
+	}
+
+	ytServer.SetUnavailable(true)
+	gcalServer.ModifyEvent("primary", standup.Id, func(e *calendar.Event) { e.Summary = "Standup (stale)" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() while YouTrack is unreachable error = %v", err)
+	}
+	ytServer.SetUnavailable(false)
+	clock.Advance(DefaultOutboxMaxAge + time.Hour)
+	result, err = s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() once YouTrack is back error = %v", err)
+	}
+	if got := ytServer.Issue(standupID).Summary; got != "Standup (moved)" {
+		t.Errorf("Expected the write older than the maximum age to be dropped, got summary %q", got)
+	}
+	if !strings.Contains(strings.Join(result.Errors, "\n"), "update of YouTrack task "+standupID+" queued at") {
+		t.Errorf("Expected the dropped write to be reported, got %v", result.Errors)
+	}
+}
+
+func TestSync_ChangeFeedReportsResolvedAndDeletedIssues(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	searches := &countingTransport{substring: "updated:"}
+	ytClient := youtrack.NewClient(ytServer.URL, "token")
+	ytClient.HTTPClient = &http.Client{Transport: searches}
+	s := NewSynchronizer(gcalClient, ytClient, db, WithProject("PRJ"), WithQueryProject("project: PRJ #Unresolved"), WithCalendar("primary"))
+	s.ResolvedAction = ResolvedActionDelete
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	due := []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}}
+	resolved := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Resolve me", CustomFields: due})
+	deleted := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Delete me", CustomFields: due})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := len(gcalServer.Events("primary")); got != 2 {
+		t.Fatalf("Expected 2 events, got %d", got)
+	}
+
+	ytServer.ModifyIssue(resolved.ID, func(i *youtrack.Issue) { i.Resolved = time.Now().UnixMilli() })
+	ytServer.DeleteIssue(deleted.ID)
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if searches.count != 0 {
+		t.Errorf("Expected the changes to be read from the feed rather than searched, got %d searches", searches.count)
+	}
+	if got := len(gcalServer.Events("primary")); got != 0 {
+		t.Errorf("Expected the events of the resolved and the deleted issue to be removed, got %d", got)
+	}
+}
+
+func TestSync_YouTrackCursorFollowsObservedUpdates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	// The clock of the synchronizer runs ahead of YouTrack's, so a cursor
+	// taken from it would skip the edit below.
+	clock := newFakeClock(time.Now().Add(10 * time.Minute))
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"), WithClock(clock))
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Draft", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if cursor, _ := db.GetYTLastSync(); !cursor.Equal(time.UnixMilli(issue.Updated)) {
+		t.Errorf("Expected the cursor to be the update time of the issue, got %v", cursor)
+	}
+
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Summary = "Final" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	item, err := db.GetSyncItemByYTID(issue.ID)
+	if err != nil {
+		t.Fatalf("Expected the issue to be linked: %v", err)
+	}
+	if got := gcalServer.Event("primary", item.GCalID.String).Summary; got != "Final" {
+		t.Errorf("Expected the edit to reach the calendar, got %q", got)
+	}
+
+	// The overlap reads the edit again; it is not applied twice.
+	before := gcalServer.Event("primary", item.GCalID.String).Updated
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := gcalServer.Event("primary", item.GCalID.String).Updated; got != before {
+		t.Errorf("Expected the event not to be rewritten by the overlap, updated %s -> %s", before, got)
+	}
+}
+
+func TestSync_ClockSkewComparesContent(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Draft", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	item, err := db.GetSyncItemByYTID(issue.ID)
+	if err != nil {
+		t.Fatalf("Expected the issue to be linked: %v", err)
+	}
+
+	// An edit stamped a second before the last sync, by a clock behind.
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Summary = "Final" })
+	edited := ytServer.Issue(issue.ID)
+	item.YTUpdatedAt = sql.NullTime{Time: time.UnixMilli(edited.Updated).Add(time.Second), Valid: true}
+	if err := db.UpdateSyncItem(item); err != nil {
+		t.Fatalf("UpdateSyncItem() error = %v", err)
+	}
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := gcalServer.Event("primary", item.GCalID.String).Summary; got != "Final" {
+		t.Errorf("Expected the edit within the skew to reach the calendar, got %q", got)
+	}
+
+	// The same content stamped a second after the sync is not applied twice.
+	item, _ = db.GetSyncItemByYTID(issue.ID)
+	item.YTUpdatedAt = sql.NullTime{Time: time.UnixMilli(edited.Updated).Add(-time.Second), Valid: true}
+	if err := db.UpdateSyncItem(item); err != nil {
+		t.Fatalf("UpdateSyncItem() error = %v", err)
+	}
+	before := gcalServer.Event("primary", item.GCalID.String).Updated
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := gcalServer.Event("primary", item.GCalID.String).Updated; got != before {
+		t.Errorf("Expected the unchanged issue not to be written again, updated %s -> %s", before, got)
+	}
+
+	// Beyond the skew, update times are compared as they are.
+	s.ClockSkew = 0
+	item, _ = db.GetSyncItemByYTID(issue.ID)
+	item.YTUpdatedAt = sql.NullTime{Time: time.UnixMilli(edited.Updated).Add(-time.Second), Valid: true}
+	if err := db.UpdateSyncItem(item); err != nil {
+		t.Fatalf("UpdateSyncItem() error = %v", err)
+	}
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := gcalServer.Event("primary", item.GCalID.String).Updated; got == before {
+		t.Errorf("Expected a later update time to be carried over without ClockSkew")
+	}
+}
+
+func TestSync_FlagsAndShiftsEventsOnHolidays(t *testing.T) {
+	for _, tt := range []struct {
+		action   HolidayAction
+		wantDay  int
+		wantNote string
+	}{
+		{HolidayActionFlag, 0, "Due on a holiday: Founders' Day."},
+		{HolidayActionShift, -1, "a holiday (Founders' Day), shown on the business day before."},
+	} {
+		t.Run(string(tt.action), func(t *testing.T) {
+			db, cleanup := setupTestDB(t)
+			defer cleanup()
+			gcalServer := fake.NewCalendar()
+			defer gcalServer.Close()
+			ytServer := fake.NewYouTrack()
+			defer ytServer.Close()
+
+			ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+			gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+			if err != nil {
+				t.Fatalf("Failed to create Google Calendar client: %v", err)
+			}
+			s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+			s.EventTiming = EventTimingTimed
+			s.Holidays = &Holidays{CalendarID: "holidays", Action: tt.action}
+
+			// A Wednesday at least a week ahead, so the day before is a
+			// business day.
+			day := time.Now().AddDate(0, 0, 7)
+			for day.Weekday() != time.Wednesday {
+				day = day.AddDate(0, 0, 1)
+			}
+			date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+			gcalServer.AddEvent("holidays", &calendar.Event{
+				Summary: "Founders' Day",
+				Start:   &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+				End:     &calendar.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+			})
+			issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Release", CustomFields: []youtrack.CustomField{
+				{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(date.UnixMilli())},
+			}})
+			if _, err := s.Sync(); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+
+			item, err := db.GetSyncItemByYTID(issue.ID)
+			if err != nil {
+				t.Fatalf("Expected the issue to be linked: %v", err)
+			}
+			event := gcalServer.Event("primary", item.GCalID.String)
+			want := date.AddDate(0, 0, tt.wantDay).Add(DefaultEventTime)
+			if start, _ := time.Parse(time.RFC3339, event.Start.DateTime); !start.Equal(want) {
+				t.Errorf("Expected the event to start %v, got %v", want, start)
+			}
+			if !strings.Contains(event.Description, tt.wantNote) {
+				t.Errorf("Expected the description to note the holiday, got %q", event.Description)
+			}
+			if dueDate := issueDueDate(*ytServer.Issue(issue.ID)); !dueDate.Equal(date) {
+				t.Errorf("Expected the due date to stay %v, got %v", date, dueDate)
+			}
+		})
+	}
+}
+
+// recordingSink records the notifications sent through it.
+type recordingSink struct {
+	titles, bodies []string
+}
+
+func (r *recordingSink) Notify(title, body string) error {
+	r.titles, r.bodies = append(r.titles, title), append(r.bodies, body)
+	return nil
+}
+
+func TestSync_SendsMorningAgendaOnce(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	clock := newFakeClock(today.Add(7 * time.Hour))
+	sink := &recordingSink{}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"), WithClock(clock))
+	s.MorningAgenda = &MorningAgenda{At: DefaultAgendaTime, Location: time.UTC, Sink: sink}
+
+	dueAt := func(due time.Time, summary string, resolved int64) youtrack.Issue {
+		return ytServer.AddIssue("PRJ", youtrack.Issue{Summary: summary, Resolved: resolved, CustomFields: []youtrack.CustomField{
+			{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(due.UnixMilli())},
+		}})
+	}
+	demo := dueAt(today.Add(14*time.Hour), "Demo", 0)
+	ship := dueAt(today, "Ship", 0)
+	dueAt(today, "Done already", today.UnixMilli())
+	dueAt(today.AddDate(0, 0, 1), "Tomorrow", 0)
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if len(sink.titles) != 0 {
+		t.Fatalf("Expected no agenda before 8:00, got %v", sink.titles)
+	}
+
+	clock.Advance(2 * time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	if len(sink.titles) != 1 {
+		t.Fatalf("Expected one agenda, got %v", sink.titles)
+	}
+	if want := "Due today, " + today.Format("Monday, January 2") + ": 2 issues"; sink.titles[0] != want {
+		t.Errorf("Expected title %q, got %q", want, sink.titles[0])
+	}
+	lines := strings.Split(sink.bodies[0], "\n")
+	if len(lines) != 4 || lines[0] != ship.ReadableID()+" Ship" || lines[2] != "14:00 "+demo.ReadableID()+" Demo" ||
+		lines[1] != "  "+ytServer.URL+"/issue/"+ship.ReadableID() {
+		t.Errorf("Unexpected agenda %q", sink.bodies[0])
+	}
+}
+
+func TestSync_RenewsAndStopsPushChannel(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	push := &PushNotifications{Address: "https://sync.example.com/hooks/google", TTL: 24 * time.Hour, RenewBefore: time.Hour}
+	newSynchronizer := func(clock Clock) *Synchronizer {
+		s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"), WithClock(clock))
+		s.PushNotifications = push
+		return s
+	}
+	clock := newFakeClock(time.Now())
+	s := newSynchronizer(clock)
+
+	if _, err := s.RenewPushChannel(); err != nil {
+		t.Fatalf("RenewPushChannel() error = %v", err)
+	}
+	channels := gcalServer.Channels()
+	if len(channels) != 1 || channels[0].Address != push.Address {
+		t.Fatalf("Expected one channel to %s, got %+v", push.Address, channels)
+	}
+	first, err := db.GetPushChannel()
+	if err != nil {
+		t.Fatalf("Expected the channel to be stored: %v", err)
+	}
+	if status := s.PushChannelStatus(); !status.Healthy || status.ChannelID != first.ID || status.Renewals != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if _, err := s.RenewPushChannel(); err != nil || len(gcalServer.Channels()) != 1 {
+		t.Errorf("Expected the open channel to be kept, got %d channels, error %v", len(gcalServer.Channels()), err)
+	}
+
+	// Notifications need the token of the open channel; the first one only
+	// confirms the channel.
+	if s.PushNotification(first.ID, "forged", "exists") {
+		t.Error("Expected a notification with the wrong token to be rejected")
+	}
+	if !s.PushNotification(first.ID, first.Token, "sync") {
+		t.Error("Expected the notification of the channel to be accepted")
+	}
+
+	// Within RenewBefore of the expiration, the channel is replaced.
+	clock.Advance(23*time.Hour + time.Minute)
+	if _, err := s.RenewPushChannel(); err != nil {
+		t.Fatalf("RenewPushChannel() error = %v", err)
+	}
+	second, _ := db.GetPushChannel()
+	channels = gcalServer.Channels()
+	if len(channels) != 1 || channels[0].Id != second.ID || second.ID == first.ID {
+		t.Fatalf("Expected the channel to be replaced, got %+v", channels)
+	}
+	if s.PushNotification(first.ID, first.Token, "exists") {
+		t.Error("Expected notifications of the replaced channel to be ignored")
+	}
+
+	// A restart takes the stored channel over. The fake expires channels
+	// by the time of the test, which the clock of s ran ahead of.
+	clock = newFakeClock(time.Now())
+	s = newSynchronizer(clock)
+	if _, err := s.RenewPushChannel(); err != nil {
+		t.Fatalf("RenewPushChannel() error = %v", err)
+	}
+	if status := s.PushChannelStatus(); status.ChannelID != second.ID || status.Renewals != 0 || !status.Healthy {
+		t.Errorf("Expected the stored channel to be taken over, got %+v", status)
+	}
+	gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Pushed",
+		Start:   &calendar.EventDateTime{DateTime: clock.Now().Add(time.Hour).Format(time.RFC3339)},
+		End:     &calendar.EventDateTime{DateTime: clock.Now().Add(2 * time.Hour).Format(time.RFC3339)},
+	})
+	if !s.PushNotification(second.ID, second.Token, "exists") {
+		t.Fatal("Expected the notification of the channel to be accepted")
+	}
+	for i := 0; s.LastResult().Started.IsZero(); i++ {
+		if i == 100 {
+			t.Fatal("Expected the notification to start a pass")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if status := s.PushChannelStatus(); status.Notifications != 1 || status.LastNotification.IsZero() {
+		t.Errorf("Expected the notification to be counted, got %+v", status)
+	}
+
+	if err := s.StopPushChannel(); err != nil {
+		t.Fatalf("StopPushChannel() error = %v", err)
+	}
+	if channels := gcalServer.Channels(); len(channels) != 0 {
+		t.Errorf("Expected the channel to be stopped, got %+v", channels)
+	}
+	if _, err := db.GetPushChannel(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the stored channel to be removed, got %v", err)
+	}
+	if status := s.PushChannelStatus(); status.Healthy || status.ChannelID != "" {
+		t.Errorf("Unexpected status after stopping %+v", status)
+	}
+}
+
+func TestSync_EditItemRelinksAndOverwrites(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	due := []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}}
+	report := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Write report", CustomFields: due})
+	review := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Review report", CustomFields: due})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	item, err := db.GetSyncItemByYTID(report.ID)
+	if err != nil {
+		t.Fatalf("Expected a sync item for %s: %v", report.ID, err)
+	}
+	if info, err := s.Item(item.ID); err != nil || info.GCalID != item.GCalID.String || info.YTID != report.ID {
+		t.Errorf("Item() = %+v, %v", info, err)
+	}
+
+	if _, err := s.EditItem(item.ID, ItemEdit{Unlink: true, Win: WinCalendar}); !errors.Is(err, ErrInvalidEdit) {
+		t.Errorf("Expected ErrInvalidEdit, got %v", err)
+	}
+	if _, err := s.EditItem(item.ID, ItemEdit{YTID: review.ReadableID()}); !errors.Is(err, ErrLinked) {
+		t.Errorf("Expected ErrLinked for an issue of another item, got %v", err)
+	}
+	if _, err := s.EditItem(item.ID, ItemEdit{YTID: "PRJ-99"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown issue, got %v", err)
+	}
+
+	// The item is moved to an issue of its own, and the event takes it over.
+	draft := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Draft report", CustomFields: due})
+	info, err := s.EditItem(item.ID, ItemEdit{YTID: draft.ReadableID(), Win: WinYouTrack})
+	if err != nil {
+		t.Fatalf("EditItem() error = %v", err)
+	}
+	if info.YTID != draft.ID || info.YTUpdatedAt == nil {
+		t.Errorf("Expected the item synced with %s, got %+v", draft.ID, info)
+	}
+	if event := gcalServer.Event("primary", info.GCalID); event == nil || event.Summary != "Draft report" {
+		t.Errorf("Expected the event to be overwritten by the issue, got %+v", event)
+	}
+	if issue := ytServer.Issue(report.ID); issue == nil || issue.Summary != "Write report" {
+		t.Errorf("Expected the unlinked issue to be left alone, got %+v", issue)
+	}
+
+	// Forcing the calendar side copies the event even when both changed.
+	gcalServer.ModifyEvent("primary", info.GCalID, func(e *calendar.Event) { e.Summary = "Draft the report" })
+	ytServer.ModifyIssue(draft.ID, func(issue *youtrack.Issue) { issue.Summary = "Outline report" })
+	if _, err := s.EditItem(item.ID, ItemEdit{Win: WinCalendar}); err != nil {
+		t.Fatalf("EditItem() error = %v", err)
+	}
+	if issue := ytServer.Issue(draft.ID); issue.Summary != "Draft the report" {
+		t.Errorf("Expected the issue to be overwritten by the event, got %q", issue.Summary)
+	}
+
+	if info, err := s.EditItem(item.ID, ItemEdit{Unlink: true}); err != nil || info != (ItemInfo{}) {
+		t.Fatalf("EditItem() = %+v, %v", info, err)
+	}
+	if _, err := s.Item(item.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the item to be removed, got %v", err)
+	}
+	if gcalServer.Event("primary", info.GCalID) == nil {
+		t.Error("Expected the event to be kept")
+	}
+}
+
+func TestSync_LinkPairsExistingItems(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	// Neither the summaries nor the dates match, so no heuristic pairs them.
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Quarterly report", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+	start := time.Now().AddDate(0, 0, 5).Truncate(time.Hour)
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Report review",
+		Start:   &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:     &calendar.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+	})
+
+	if _, err := s.Link(issue.ReadableID(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown event, got %v", err)
+	}
+	info, err := s.Link(issue.ReadableID(), event.Id)
+	if err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	if info.YTID != issue.ID || info.GCalID != event.Id || info.ID == 0 {
+		t.Errorf("Unexpected item %+v", info)
+	}
+	if _, err := s.Link(issue.ReadableID(), event.Id); !errors.Is(err, ErrLinked) {
+		t.Errorf("Expected ErrLinked for a linked pair, got %v", err)
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if events := gcalServer.Events("primary"); len(events) != 1 || events[0].Summary != "Report review" {
+		t.Errorf("Expected the linked event to be left alone, got %+v", events)
+	}
+	if issues := ytServer.Issues(); len(issues) != 1 || issues[0].Summary != "Quarterly report" {
+		t.Errorf("Expected the linked issue to be left alone, got %+v", issues)
+	}
+}
+
+func TestSync_ImportEventsCreatesIssuesForPastEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.StartDate = time.Now()
+
+	addEvent := func(summary string, daysAgo int, series string) *calendar.Event {
+		start := time.Now().AddDate(0, 0, -daysAgo).Truncate(time.Hour)
+		return gcalServer.AddEvent("primary", &calendar.Event{
+			Summary:          summary,
+			RecurringEventId: series,
+			HtmlLink:         "https://calendar.google.com/calendar/event?eid=" + strings.ToLower(summary),
+			Start:            &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+			End:              &calendar.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+		})
+	}
+	kickoff := addEvent("Kickoff", 20, "")
+	addEvent("Retro", 14, "retro")
+	addEvent("Retro", 7, "retro")
+	addEvent("Offsite", 60, "")
+
+	var progress []int
+	result, err := s.ImportEvents(time.Now().AddDate(0, 0, -30), time.Now(), "OPS", func(done, total int) {
+		progress = append(progress, done, total)
+	})
+	if err != nil {
+		t.Fatalf("ImportEvents() error = %v", err)
+	}
+	if result.Events != 3 || result.Imported != 3 || result.Skipped != 0 || len(result.Errors) != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if want := []int{1, 3, 2, 3, 3, 3}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("Expected progress %v, got %v", want, progress)
+	}
+	var summaries []string
+	for _, issue := range ytServer.Issues() {
+		if issue.Project.ID != "OPS" {
+			t.Errorf("Expected issue %s in OPS, got %s", issue.ID, issue.Project.ID)
+		}
+		summaries = append(summaries, issue.Summary)
+	}
+	sort.Strings(summaries)
+	if want := []string{"Kickoff", "Retro", "Retro"}; !reflect.DeepEqual(summaries, want) {
+		t.Errorf("Expected issues %v, got %v", want, summaries)
+	}
+	item, err := db.GetSyncItemByGCalID(kickoff.Id)
+	if err != nil {
+		t.Fatalf("Expected the event to be linked: %v", err)
+	}
+	if comments := ytServer.Comments(item.YTID.String); len(comments) != 1 || !strings.Contains(comments[0], "[Kickoff]("+kickoff.HtmlLink+")") {
+		t.Errorf("Expected a comment linking the event, got %q", comments)
+	}
+	if s.YouTrackProjectID != "PRJ" || s.ProvenanceComment || s.StartDate.IsZero() {
+		t.Error("Expected the settings of the synchronizer to be restored")
+	}
+
+	// Linked events are skipped by a second import.
+	result, err = s.ImportEvents(time.Now().AddDate(0, 0, -30), time.Now(), "", nil)
+	if err != nil {
+		t.Fatalf("ImportEvents() error = %v", err)
+	}
+	if result.Imported != 0 || result.Skipped != 3 || len(ytServer.Issues()) != 3 {
+		t.Errorf("Expected nothing to be imported again, got %+v", result)
+	}
+}
+
+func TestSync_CommentsOnMeetingConflicts(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.ConflictCheck = ConflictCheckComment
+
+	day := time.Now().AddDate(0, 0, 3)
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	meeting := func(summary string, hour int, modify func(*calendar.Event)) {
+		event := &calendar.Event{
+			Summary: summary,
+			Start:   &calendar.EventDateTime{DateTime: midnight.Add(time.Duration(hour) * time.Hour).Format(time.RFC3339)},
+			End:     &calendar.EventDateTime{DateTime: midnight.Add(time.Duration(hour+1) * time.Hour).Format(time.RFC3339)},
+		}
+		if modify != nil {
+			modify(event)
+		}
+		gcalServer.AddEvent("primary", event)
+	}
+	meeting("Standup", 9, nil)
+	meeting("Review", 14, nil)
+	meeting("Lunch", 12, func(e *calendar.Event) { e.Transparency = "transparent" })
+	meeting("Offsite", 16, func(e *calendar.Event) {
+		e.Attendees = []*calendar.EventAttendee{{Email: "me@example.com", Self: true, ResponseStatus: "declined"}}
+	})
+	gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Holiday",
+		Start:   &calendar.EventDateTime{Date: midnight.Format("2006-01-02")},
+		End:     &calendar.EventDateTime{Date: midnight.AddDate(0, 0, 1).Format("2006-01-02")},
+	})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Release", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(midnight.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	want := []string{"Due date overlaps with 2 meetings that day."}
+	if got := ytServer.Comments(issue.ID); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected comments %q, got %q", want, got)
+	}
+
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Summary = "Release 2.0" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := ytServer.Comments(issue.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected an unchanged conflict to be reported once, got %q", got)
+	}
+
+	meeting("Retro", 15, nil)
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) { i.Summary = "Release 2.0.1" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	want = append(want, "Due date overlaps with 3 meetings that day.")
+	if got := ytServer.Comments(issue.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected comments %q, got %q", want, got)
+	}
+}
+
+func TestSync_MovesEventsBetweenMappings(t *testing.T) {
+	dbA, cleanupA := setupTestDB(t)
+	defer cleanupA()
+	dbB, cleanupB := setupTestDB(t)
+	defer cleanupB()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	ytClient := youtrack.NewClient(ytServer.URL, "token")
+	a := NewSynchronizer(gcalClient, ytClient, dbA, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("a"))
+	b := NewSynchronizer(gcalClient, ytClient, dbB, WithProject("OPS"), WithQueryProject("OPS"), WithCalendar("b"))
+	a.Siblings, b.Siblings = []*Synchronizer{b}, []*Synchronizer{a}
+	syncAll := func() {
+		t.Helper()
+		for _, s := range []*Synchronizer{a, b} {
+			if _, err := s.Sync(); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+		}
+	}
+
+	due := time.Now().AddDate(0, 0, 5).Truncate(time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Rotate keys", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(due.UnixMilli())},
+	}})
+	syncAll()
+	events := gcalServer.Events("a")
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event on calendar a, got %d", len(events))
+	}
+	eventID := events[0].Id
+
+	ytServer.ModifyIssue(issue.ID, func(i *youtrack.Issue) {
+		i.Project = &youtrack.Project{YouTrackType: youtrack.YouTrackType{Type: "Project"}, ID: "OPS", ShortName: "OPS"}
+		i.IDReadable = "OPS-1"
+		i.Summary = "Rotate API keys"
+	})
+	syncAll()
+	syncAll()
+
+	if events := gcalServer.Events("a"); len(events) != 0 {
+		t.Errorf("Expected the event to leave calendar a, got %d events", len(events))
+	}
+	events = gcalServer.Events("b")
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event on calendar b, got %d", len(events))
+	}
+	if events[0].Id != eventID || events[0].Summary != "Rotate API keys" {
+		t.Errorf("Expected event %s to be moved and updated, got %s %q", eventID, events[0].Id, events[0].Summary)
+	}
+	if item, _ := dbA.GetSyncItemByYTID(issue.ID); item != nil {
+		t.Errorf("Expected the sync item of mapping a to be deleted, got %+v", item)
+	}
+	if item, _ := dbB.GetSyncItemByYTID(issue.ID); item == nil || item.GCalID.String != eventID {
+		t.Errorf("Expected mapping b to link event %s, got %+v", eventID, item)
+	}
+	if ytServer.Issue(issue.ID) == nil {
+		t.Error("Expected the moved event to leave the issue alone")
+	}
+}
+
+func TestSync_AllDayDatesWestOfUTC(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	local := time.Local
+	time.Local = newYork
+	defer func() { time.Local = local }()
+
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	day := time.Now().AddDate(0, 0, 3)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Offsite",
+		Start:   &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+		End:     &calendar.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+	})
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Release", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(date.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	// An all-day event becomes a date-only due date at midnight UTC.
+	item, _ := db.GetSyncItemByGCalID(event.Id)
+	if item == nil {
+		t.Fatal("Expected the event to be linked")
+	}
+	if dueDate := issueDueDate(*ytServer.Issue(item.YTID.String)); !dueDate.Equal(date) {
+		t.Errorf("Expected the due date %v, got %v", date, dueDate)
+	}
+
+	// A date-only due date at midnight UTC stays on its date, although
+	// that is the previous evening locally.
+	item, _ = db.GetSyncItemByYTID(issue.ID)
+	want := &calendar.EventDateTime{Date: date.Format("2006-01-02")}
+	if created := gcalServer.Event("primary", item.GCalID.String); !reflect.DeepEqual(created.Start, want) {
+		t.Errorf("Expected an all-day event starting %+v, got %+v", want, created.Start)
+	}
+}
+
+func TestSync_DueDateFromEventEnd(t *testing.T) {
+	if boundary, err := ParseDueDateBoundary(""); err != nil || boundary != DueDateStart {
+		t.Errorf("Expected empty value to parse as %q, got %q (%v)", DueDateStart, boundary, err)
+	}
+	if _, err := ParseDueDateBoundary("middle"); err == nil {
+		t.Error("Expected an error for an unknown boundary")
+	}
+
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.DueDateBoundary = DueDateEnd
+	s.EventTiming = EventTimingAuto
+	s.EventDuration = 90 * time.Minute
+
+	day := time.Now().AddDate(0, 0, 3)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	afternoon := time.Date(day.Year(), day.Month(), day.Day(), 14, 0, 0, 0, time.Local)
+	// The end date of an all-day event is exclusive: this one lasts three
+	// days.
+	allDay := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Conference",
+		Start:   &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+		End:     &calendar.EventDateTime{Date: date.AddDate(0, 0, 3).Format("2006-01-02")},
+	})
+	timed := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Review",
+		Start:   &calendar.EventDateTime{DateTime: afternoon.Format(time.RFC3339)},
+		End:     &calendar.EventDateTime{DateTime: afternoon.Add(2 * time.Hour).Format(time.RFC3339)},
+	})
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Handover", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(afternoon.UnixMilli())},
+	}})
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		event *calendar.Event
+		want  time.Time
+	}{
+		{allDay, date.AddDate(0, 0, 2)},
+		{timed, afternoon.Add(2 * time.Hour)},
+	} {
+		item, _ := db.GetSyncItemByGCalID(tt.event.Id)
+		if item == nil {
+			t.Fatalf("Expected %q to be linked", tt.event.Summary)
+		}
+		if dueDate := issueDueDate(*ytServer.Issue(item.YTID.String)); !dueDate.Equal(tt.want) {
+			t.Errorf("Expected %q to be due %v, got %v", tt.event.Summary, tt.want, dueDate)
+		}
+	}
+
+	// Timed events written from issues end at the due time.
+	item, _ := db.GetSyncItemByYTID(issue.ID)
+	event := gcalServer.Event("primary", item.GCalID.String)
+	want := &calendar.EventDateTime{DateTime: afternoon.Format(time.RFC3339)}
+	if !reflect.DeepEqual(event.End, want) {
+		t.Errorf("Expected the event to end %+v, got %+v", want, event.End)
+	}
+}
+
+func TestSync_SkipsCopiesOfSyncedEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Planning",
+		Start:   &calendar.EventDateTime{Date: tomorrow},
+		End:     &calendar.EventDateTime{Date: tomorrow},
+	})
+	sync := func() {
+		t.Helper()
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if result := s.LastResult(); len(result.Errors) > 0 {
+			t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+		}
+	}
+	sync()
+	item, _ := db.GetSyncItemByGCalID(event.Id)
+	if item == nil {
+		t.Fatal("Expected the event to be linked")
+	}
+	linked := gcalServer.Event("primary", event.Id)
+	if linked.ExtendedProperties == nil || linked.ExtendedProperties.Private[googlecalendar.IssueIDProperty] != item.YTID.String {
+		t.Fatalf("Expected the event to record issue %s, got %+v", item.YTID.String, linked.ExtendedProperties)
+	}
+
+	// Duplicating the event in Google Calendar copies its properties.
+	copied := *linked
+	copied.Id = ""
+	copied.Summary = "Planning (copy)"
+	duplicate := gcalServer.AddEvent("primary", &copied)
+	sync()
+	if issues := ytServer.Issues(); len(issues) != 1 {
+		t.Fatalf("Expected the copy to be skipped, got issues %+v", issues)
+	}
+
+	s.EventCopies = EventCopiesCreate
+	gcalServer.ModifyEvent("primary", duplicate.Id, func(e *calendar.Event) { e.Summary = "Planning, part 2" })
+	sync()
+	if issues := ytServer.Issues(); len(issues) != 2 || issues[1].Summary != "Planning, part 2" {
+		t.Fatalf("Expected an issue to be created for the copy, got %+v", issues)
+	}
+	item, _ = db.GetSyncItemByGCalID(duplicate.Id)
+	if item == nil || gcalServer.Event("primary", duplicate.Id).ExtendedProperties.Private[googlecalendar.IssueIDProperty] != item.YTID.String {
+		t.Errorf("Expected the copy to be linked to its own issue, got %+v", item)
+	}
+}
+
+func TestSync_IgnoresEventsOfOtherAutomations(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.IgnoredEvents = &IgnoredEvents{
+		Senders:    []string{"@calendly.com", "bot@example.com"},
+		Properties: []string{"zoomMeetingId", "origin=other-sync"},
+	}
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	add := func(summary string, modify func(*calendar.Event)) {
+		event := &calendar.Event{
+			Summary: summary,
+			Start:   &calendar.EventDateTime{Date: tomorrow},
+			End:     &calendar.EventDateTime{Date: tomorrow},
+		}
+		modify(event)
+		gcalServer.AddEvent("primary", event)
+	}
+	add("Booked via Calendly", func(e *calendar.Event) {
+		e.Organizer = &calendar.EventOrganizer{Email: "Notifications@Calendly.com"}
+	})
+	add("Created by a bot", func(e *calendar.Event) {
+		e.Creator = &calendar.EventCreator{Email: "bot@example.com"}
+	})
+	add("Zoom meeting", func(e *calendar.Event) {
+		e.ExtendedProperties = &calendar.EventExtendedProperties{Shared: map[string]string{"zoomMeetingId": "123"}}
+	})
+	add("Other sync", func(e *calendar.Event) {
+		e.ExtendedProperties = &calendar.EventExtendedProperties{Private: map[string]string{"origin": "other-sync"}}
+	})
+	add("Own event", func(e *calendar.Event) {
+		e.Organizer = &calendar.EventOrganizer{Email: "me@example.com"}
+		e.ExtendedProperties = &calendar.EventExtendedProperties{Private: map[string]string{"origin": "mine"}}
+	})
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if issues := ytServer.Issues(); len(issues) != 1 || issues[0].Summary != "Own event" {
+		t.Errorf("Expected only the own event to become an issue, got %+v", issues)
+	}
+}
+
+func TestSync_SuppressesEchoesOfOwnWrites(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	sync := func() {
+		t.Helper()
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if result := s.LastResult(); len(result.Errors) > 0 {
+			t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+		}
+	}
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Retro",
+		Start:   &calendar.EventDateTime{Date: tomorrow},
+		End:     &calendar.EventDateTime{Date: tomorrow},
+	})
+	sync()
+	item, _ := db.GetSyncItemByGCalID(event.Id)
+	if item == nil || !item.YTWrittenAt.Valid {
+		t.Fatalf("Expected the write of the issue to be recorded, got %+v", item)
+	}
+
+	// The event is edited: the issue follows, but the update of the issue
+	// that causes does not go back to the event.
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) { e.Summary = "Sprint retro" })
+	sync()
+	if got := ytServer.Issue(item.YTID.String); got.Summary != "Sprint retro" {
+		t.Fatalf("Expected the summary to sync, got %q", got.Summary)
+	}
+	updated := gcalServer.Event("primary", event.Id).Updated
+	sync()
+	if got := gcalServer.Event("primary", event.Id).Updated; got != updated {
+		t.Errorf("Expected the echo of the issue update to be ignored, but the event was written at %s", got)
+	}
+
+	// Likewise for an issue edited later than the echo window.
+	item, _ = db.GetSyncItemByGCalID(event.Id)
+	item.YTWrittenAt.Time = item.YTWrittenAt.Time.Add(-time.Hour)
+	if err := db.UpdateSyncItem(item); err != nil {
+		t.Fatalf("UpdateSyncItem() error = %v", err)
+	}
+	ytServer.ModifyIssue(item.YTID.String, func(issue *youtrack.Issue) { issue.Summary = "Team retro" })
+	sync()
+	written := gcalServer.Event("primary", event.Id)
+	if written.Summary != "Team retro" || written.ExtendedProperties.Private[googlecalendar.WrittenAtProperty] == "" {
+		t.Fatalf("Expected the event to be written and marked, got %q (%+v)", written.Summary, written.ExtendedProperties)
+	}
+	issueUpdated := ytServer.Issue(item.YTID.String).Updated
+	sync()
+	if got := ytServer.Issue(item.YTID.String).Updated; got != issueUpdated {
+		t.Errorf("Expected the echo of the event update to be ignored, but the issue was written at %d", got)
+	}
+}
+
+func TestSync_CompletesInterruptedCreates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	// An earlier attempt created the event of an issue and the issue of an
+	// event, and stopped before linking either.
+	day := time.Now().AddDate(0, 0, 3)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Budget", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(date.UnixMilli())},
+	}})
+	toEvent, err := db.BeginCreate(issueSource(issue.ID))
+	if err != nil {
+		t.Fatalf("BeginCreate() error = %v", err)
+	}
+	gcalServer.AddEvent("primary", &calendar.Event{
+		Id:      toEvent.Key,
+		Summary: "Budget",
+		Start:   &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+		End:     &calendar.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+	})
+
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary:  "Offsite",
+		HtmlLink: "https://calendar.google.com/event?eid=offsite",
+		Start:    &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+		End:      &calendar.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+	})
+	if _, err := db.BeginCreate(eventSource(event.Id)); err != nil {
+		t.Fatalf("BeginCreate() error = %v", err)
+	}
+	fromEvent := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Offsite", Description: event.HtmlLink})
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result := s.LastResult(); len(result.Errors) > 0 {
+		t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+	}
+	if events := gcalServer.Events("primary"); len(events) != 2 {
+		t.Errorf("Expected no event to be created again, got %d events", len(events))
+	}
+	if issues := ytServer.Issues(); len(issues) != 2 {
+		t.Errorf("Expected no issue to be created again, got %+v", issues)
+	}
+	if item, _ := db.GetSyncItemByYTID(issue.ID); item == nil || item.GCalID.String != toEvent.Key {
+		t.Errorf("Expected the issue to be linked to event %s, got %+v", toEvent.Key, item)
+	}
+	if item, _ := db.GetSyncItemByGCalID(event.Id); item == nil || item.YTID.String != fromEvent.ID {
+		t.Errorf("Expected the event to be linked to issue %s, got %+v", fromEvent.ID, item)
+	}
+	if p, _ := db.BeginCreate(issueSource(issue.ID)); p.Resumed {
+		t.Error("Expected the creation to be finished")
+	}
+}
+
+func TestSync_ReplaysInterruptedWrites(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+
+	// An earlier process stopped while deleting an event, renaming an issue
+	// and commenting on it. The synchronizer starts an hour later, and
+	// another process sharing the state is renaming an issue right now.
+	day := time.Now().AddDate(0, 0, 3)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Cancelled",
+		Start:   &calendar.EventDateTime{Date: date.Format("2006-01-02")},
+		End:     &calendar.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")},
+	})
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Budget"})
+	edited := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Retro"})
+	stale := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Offsite"})
+	running := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Hiring"})
+	clock := newFakeClock(time.Now().Add(time.Hour))
+	for _, e := range []struct {
+		owner   string
+		started time.Time
+		change  Change
+	}{
+		{"earlier", time.Now(), Change{Target: ChangeTargetGoogle, Action: "delete", ID: event.Id, CalendarID: "primary"}},
+		{"earlier", time.Now(), Change{Target: ChangeTargetYouTrack, Action: "update", ID: issue.ID, Summary: nonEmpty("Budget 2025")}},
+		{"earlier", time.Now(), Change{Target: ChangeTargetYouTrack, Action: "comment", ID: issue.ID, Comment: "Conflict"}},
+		{"earlier", time.Now(), Change{Target: ChangeTargetYouTrack, Action: "update", ID: edited.ID, Summary: nonEmpty("Retro 1")}},
+		{"earlier", time.Now().Add(-journalMaxAge), Change{Target: ChangeTargetYouTrack, Action: "update", ID: stale.ID, Summary: nonEmpty("Offsite 2023")}},
+		{"other", clock.Now(), Change{Target: ChangeTargetYouTrack, Action: "update", ID: running.ID, Summary: nonEmpty("Hiring 2025")}},
+	} {
+		if _, err := db.WithClock(newFakeClock(e.started)).BeginOperation(e.owner, e.change); err != nil {
+			t.Fatalf("BeginOperation() error = %v", err)
+		}
+	}
+	// Someone renamed an issue after the write to it was interrupted.
+	ytServer.ModifyIssue(edited.ID, func(i *youtrack.Issue) { i.Summary = "Retro 2" })
+
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"), WithClock(clock))
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result := s.LastResult(); len(result.Errors) > 0 {
+		t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+	}
+	if item, _ := db.GetSyncItemByGCalID(event.Id); item != nil {
+		t.Errorf("Expected the deletion to be replayed, got %+v", item)
+	}
+	for _, e := range gcalServer.Events("primary") {
+		if e.Id == event.Id {
+			t.Error("Expected the deletion to be replayed")
+		}
+	}
+	for id, want := range map[string]string{issue.ID: "Budget 2025", edited.ID: "Retro 2", stale.ID: "Offsite", running.ID: "Hiring"} {
+		if got := ytServer.Issue(id); got == nil || got.Summary != want {
+			t.Errorf("Expected issue %s to be %q, got %+v", id, want, got)
+		}
+	}
+	entries, _ := db.IncompleteOperations(s.runID, clock.Now().Add(time.Minute))
+	if len(entries) != 1 || entries[0].Owner != "other" {
+		t.Errorf("Expected only the write in flight to be left, got %+v", entries)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		want   ErrorAction
+	}{
+		{http.StatusUnauthorized, ErrorActionReauth},
+		{http.StatusForbidden, ErrorActionAlert},
+		{http.StatusTooManyRequests, ErrorActionRetry},
+		{http.StatusNotFound, ErrorActionSkip},
+		{http.StatusBadRequest, ErrorActionAlert},
+		{http.StatusServiceUnavailable, ErrorActionRetry},
+	} {
+		err := fmt.Errorf("wrapped: %w", httpclient.NewAPIError("youtrack", "update issue", tc.status, nil, "", nil))
+		if got := ClassifyError(err); got != tc.want {
+			t.Errorf("ClassifyError(%d) = %s, want %s", tc.status, got, tc.want)
+		}
+	}
+	if got := ClassifyError(errors.New("connection reset")); got != ErrorActionAlert {
+		t.Errorf("ClassifyError() = %s for an unknown error, want %s", got, ErrorActionAlert)
+	}
+}
+
+func TestSync_StopsPassWhenRateLimited(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "First", Updated: time.Now()},
+			{ID: "gcal-2", Summary: "Second", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	calls := 0
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		calls++
+		return nil, httpclient.NewAPIError("youtrack", "create issue", http.StatusTooManyRequests, nil, "slow down", nil)
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	_, err := s.Sync()
+	if !errors.As(err, new(*httpclient.RateLimitError)) {
+		t.Fatalf("Expected the pass to end with the rate limit, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected no request after the rate limit, got %d", calls)
+	}
+	if token, _ := db.GetGCalSyncToken(); token != "" {
+		t.Errorf("Expected the sync token to be kept for the retry, got %q", token)
+	}
+}
+
+func TestSync_StopCancelsQueriesOfPass(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		go s.Stop()
+		<-s.ctx.Done()
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "First", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		t.Error("Expected no issue to be created after Stop")
+		return &youtrack.Issue{ID: "new-yt-issue"}, nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the pass to end with context.Canceled, got %v", err)
+	}
+	if _, err := s.DB.GetAllSyncItems(); err != nil {
+		t.Errorf("Expected queries outside a pass to work after Stop, got %v", err)
+	}
+	if token, _ := db.GetGCalSyncToken(); token != "" {
+		t.Errorf("Expected the sync token to be kept for the retry, got %q", token)
+	}
+}
+
+func TestSync_ReturnsRunResult(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return []*googlecalendar.Event{
+			{ID: "gcal-1", Summary: "New GCal Event", Updated: time.Now()},
+		}, "new-gcal-token", nil
+	}
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		return &calendar.Event{Id: "new-gcal-event"}, nil
+	}
+	ytClient.createIssueFunc = func(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error) {
+		return &youtrack.Issue{ID: "new-yt-issue"}, nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{
+			{ID: "yt-1", Summary: "New YT Issue", Updated: time.Now().UnixMilli(), CustomFields: []youtrack.CustomField{
+				{Name: "Due Date", Value: float64(time.Now().UnixMilli())},
+			}},
+		}, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+
+	result, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Counts.IssuesCreated != 1 || result.Counts.EventsCreated != 1 || result.Counts.Failed != 0 {
+		t.Errorf("Expected an issue and an event to be created, got %+v", result.Counts)
+	}
+	want := []ItemOutcome{
+		{Target: ChangeTargetYouTrack, Action: "create", ID: "new-yt-issue"},
+		{Target: ChangeTargetGoogle, Action: "create", ID: "new-gcal-event"},
+	}
+	if !reflect.DeepEqual(result.Items, want) {
+		t.Errorf("Items = %+v, want %+v", result.Items, want)
+	}
+	if result.Started.IsZero() || result.Duration <= 0 {
+		t.Errorf("Expected the pass to be timed, got %+v", result)
+	}
+	if last := s.LastResult(); !reflect.DeepEqual(last, result) {
+		t.Errorf("LastResult() = %+v, want %+v", last, result)
+	}
+}
+
+func TestNewSynchronizer_Options(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	tmpl, err := LoadDescriptionTemplate("")
+	if err != nil {
+		t.Fatalf("LoadDescriptionTemplate() error = %v", err)
+	}
+	s := NewSynchronizer(&mockGCalClient{}, &mockYTClient{}, db,
+		WithProject("PRJ"),
+		WithQueryProject("PRJ, OPS"),
+		WithCalendar("team"),
+		WithClock(newFakeClock(now)),
+		WithConcurrency(4),
+		WithFilters(Filters{IncludeResolved: true, SkippedEventTypes: []string{}, StartDate: now}),
+		WithTemplates(Templates{Description: tmpl}),
+	)
+
+	if s.YouTrackProjectID != "PRJ" || s.YouTrackQueryProjectID != "PRJ, OPS" || s.CalendarID != "team" {
+		t.Errorf("Unexpected projects and calendar %q, %q, %q", s.YouTrackProjectID, s.YouTrackQueryProjectID, s.CalendarID)
+	}
+	if got := s.now(); !got.Equal(now) {
+		t.Errorf("now() = %v, want %v", got, now)
+	}
+	if s.Concurrency != 4 {
+		t.Errorf("Concurrency = %d, want 4", s.Concurrency)
+	}
+	if !s.IncludeResolved || s.IncludeDrafts || len(s.SkippedEventTypes) != 0 || !s.StartDate.Equal(now) {
+		t.Errorf("Expected the filters to be applied, got resolved %v, drafts %v, skipped %v, start %v", s.IncludeResolved, s.IncludeDrafts, s.SkippedEventTypes, s.StartDate)
+	}
+	if s.DescriptionTemplate != tmpl {
+		t.Error("Expected the description template to be applied")
+	}
+	if s.EventTiming != EventTimingAllDay || s.EchoWindow != DefaultEchoWindow {
+		t.Error("Expected options to keep the defaults they do not set")
+	}
+}
+
+func TestSync_DryRun(t *testing.T) {
+	db, gcalClient, ytClient, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	var out strings.Builder
+	clock := newFakeClock(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC))
+	s := NewSynchronizer(gcalClient, ytClient, db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"), WithClock(clock), WithDryRun(NewChangeFeed(&out)))
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "new-gcal-token", nil
+	}
+	gcalClient.createEventFunc = func(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error) {
+		t.Error("Expected no event to be created in a dry run")
+		return nil, errors.New("unexpected write")
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return []youtrack.Issue{
+			{ID: "yt-1", Summary: "New YT Issue", Updated: clock.Now().UnixMilli(), CustomFields: []youtrack.CustomField{
+				{Name: "Due Date", Value: float64(clock.Now().UnixMilli())},
+			}},
+		}, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+	ytClient.getBaseURLFunc = func() string {
+		return "http://youtrack.example.com"
+	}
+
+	// The issue is updated again between the passes.
+	for i := 0; i < 2; i++ {
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		clock.Advance(time.Hour)
+	}
+	// The second pass runs against the copy of the sync state the first
+	// one wrote to, so it sees the event it would have created.
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"action":"create"`) || !strings.Contains(lines[1], `"action":"update"`) {
+		t.Errorf("Expected a create and then an update to be reported, got %s", out.String())
+	}
+	if token, _ := db.GetGCalSyncToken(); token != "" {
+		t.Errorf("Expected the sync state to be untouched, got token %q", token)
+	}
+}
+
+func TestSync_FetchesConcurrently(t *testing.T) {
+	_, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.Concurrency = 3
+
+	// Each fetch waits for the other to start, which only happens when
+	// they run in parallel. The YouTrack change feed is a single fetch.
+	var started gosync.WaitGroup
+	started.Add(2)
+	wait := func() error {
+		started.Done()
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("fetches did not run in parallel")
+		}
+	}
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "", wait()
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, wait()
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+}
+
+func TestMissedActivations(t *testing.T) {
+	due := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name     string
+		schedule Schedule
+		now      time.Time
+		want     int
+	}{
+		{"on time", every(time.Hour), due, 0},
+		{"interval", every(time.Hour), due.Add(150 * time.Minute), 2},
+		{"schedule", dailyAt(9), due.Add(72 * time.Hour), 3},
+		{"schedule before next", dailyAt(9), due.Add(23 * time.Hour), 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missedActivations(tt.schedule, due, tt.now); got != tt.want {
+				t.Errorf("missedActivations() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartSyncLoop_CatchesUpAfterSleep(t *testing.T) {
+	db, gcalClient, ytClient, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	clock := newFakeClock(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC))
+	s := NewSynchronizer(gcalClient, ytClient, db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"), WithClock(clock))
+	lastSync := clock.Now().Add(-time.Hour)
+	if err := db.SetYTLastSync(lastSync); err != nil {
+		t.Fatalf("SetYTLastSync() error = %v", err)
+	}
+	passes := make(chan time.Time, 10)
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		passes <- clock.Now()
+		return nil, "", nil
+	}
+	var since []time.Time
+	ytClient.getUpdatedIssuesFunc = func(projectID string, from time.Time) ([]youtrack.Issue, error) {
+		since = append(since, from)
+		// The newest update seen becomes the cursor of the next pass.
+		updated := time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC)
+		return []youtrack.Issue{{ID: "yt-1", Summary: "No due date", Updated: updated.UnixMilli()}}, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.StartSyncLoop(time.Hour)
+		close(done)
+	}()
+	defer func() {
+		s.Stop()
+		<-done
+	}()
+
+	// The computer sleeps through three passes: the timer of the loop does
+	// not fire, but the wall clock moves on.
+	<-clock.waiting
+	clock.Advance(3 * time.Hour)
+	select {
+	case at := <-passes:
+		if want := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC); !at.Equal(want) {
+			t.Errorf("Expected the pass to run on waking up at %v, got %v", want, at)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a pass after waking up")
+	}
+	<-clock.waiting
+	select {
+	case <-passes:
+		t.Error("Expected a single pass to catch up with the missed ones")
+	default:
+	}
+	if got := s.LastResult(); !got.Started.Equal(clock.Now()) {
+		t.Errorf("Expected the pass to be timed by the clock, got %v", got.Started)
+	}
+	if want := lastSync.Add(-catchUpOverlap); len(since) != 1 || !since[0].Equal(want) {
+		t.Errorf("Expected the catch-up pass to ask YouTrack for updates since %v, got %v", want, since)
+	}
+
+	// A shorter sleep misses no pass, but still widens the window of the
+	// next one.
+	clock.Advance(10 * time.Minute)
+	<-clock.waiting
+	clock.Advance(50 * time.Minute)
+	select {
+	case <-passes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the next pass to run on schedule")
+	}
+	<-clock.waiting
+	if want := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC); len(since) != 2 || !since[1].Equal(want) {
+		t.Errorf("Expected the next pass to ask YouTrack for updates since %v, got %v", want, since)
+	}
+}
+
+func TestSync_UsesSavedSearch(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.SavedSearch = "On call"
+
+	if _, err := s.Sync(); err == nil || !strings.Contains(err.Error(), `saved search "On call"`) {
+		t.Fatalf("Expected an unknown saved search to fail the sync, got %v", err)
+	}
+
+	ytServer.AddSavedQuery("On call", "project: OPS")
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	due := []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}}
+	ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Write report", CustomFields: due})
+	ytServer.AddIssue("OPS", youtrack.Issue{Summary: "Rotate keys", CustomFields: due})
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	events := gcalServer.Events("primary")
+	if len(events) != 1 || events[0].Summary != "Rotate keys" {
+		t.Errorf("Expected only the issue of the saved search to get an event, got %d events", len(events))
+	}
+}
+
+func TestSync_Subtasks(t *testing.T) {
+	for _, tt := range []struct {
+		mode   SubtaskMode
+		events []string
+	}{
+		{SubtaskModeEvent, []string{"Release", "Write notes"}},
+		{SubtaskModePrefix, []string{"Release", SubtaskSummaryPrefix + "Write notes"}},
+		{SubtaskModeSkip, []string{"Release"}},
+	} {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			db, cleanup := setupTestDB(t)
+			defer cleanup()
+			gcalServer := fake.NewCalendar()
+			defer gcalServer.Close()
+			ytServer := fake.NewYouTrack()
+			defer ytServer.Close()
+
+			ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+			gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+			if err != nil {
+				t.Fatalf("Failed to create Google Calendar client: %v", err)
+			}
+			s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+			s.SubtaskMode = tt.mode
+
+			dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+			due := []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}}
+			parent := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Release", CustomFields: due})
+			ytServer.AddIssue("PRJ", youtrack.Issue{
+				Summary:      "Write notes",
+				CustomFields: due,
+				Parent:       &youtrack.IssueLink{Issues: []youtrack.Issue{{ID: parent.ID}}},
+			})
+
+			if _, err := s.Sync(); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			var summaries []string
+			for _, event := range gcalServer.Events("primary") {
+				summaries = append(summaries, event.Summary)
+			}
+			if !reflect.DeepEqual(summaries, tt.events) {
+				t.Errorf("Expected events %v, got %v", tt.events, summaries)
+			}
+
+			// Editing a prefixed event keeps the prefix out of the issue.
+			for _, event := range gcalServer.Events("primary") {
+				gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) { e.Location = "Room 1" })
+			}
+			if _, err := s.Sync(); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			for _, issue := range ytServer.Issues() {
+				if strings.HasPrefix(issue.Summary, SubtaskSummaryPrefix) {
+					t.Errorf("Expected no prefix in issue summaries, got %q", issue.Summary)
+				}
+			}
+		})
+	}
+}
+
+func TestSync_LinksRecurringInstancesToSeries(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.LinkRecurringInstances = true
+
+	start := time.Now().AddDate(0, 0, 1).Truncate(time.Hour)
+	series := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary:    "Weekly review",
+		Start:      &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:        &calendar.EventDateTime{DateTime: start.Add(time.Hour).Format(time.RFC3339)},
+		Recurrence: []string{"RRULE:FREQ=WEEKLY"},
+	})
+	moved := start.AddDate(0, 0, 8)
+	instance := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary:          "Weekly review (moved)",
+		Start:            &calendar.EventDateTime{DateTime: moved.Format(time.RFC3339)},
+		End:              &calendar.EventDateTime{DateTime: moved.Add(time.Hour).Format(time.RFC3339)},
+		RecurringEventId: series.Id,
+	})
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result := s.LastResult(); len(result.Errors) > 0 {
+		t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+	}
+	seriesItem, _ := db.GetSyncItemByGCalID(series.Id)
+	instanceItem, _ := db.GetSyncItemByGCalID(instance.Id)
+	if seriesItem == nil || instanceItem == nil {
+		t.Fatal("Expected both events to be synced")
+	}
+	child := ytServer.Issue(instanceItem.YTID.String)
+	if !child.IsSubtask() || child.Parent.Issues[0].ID != seriesItem.YTID.String {
+		t.Errorf("Expected the issue of the occurrence to be a subtask of %s, got %+v", seriesItem.YTID.String, child.Parent)
+	}
+}
+
+func TestSync_CommentsOnDependencyConflicts(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.DependencyCheck = DependencyCheckComment
+
+	day := func(days int) string { return time.Now().AddDate(0, 0, days).Format("2006-01-02") }
+	dueDate, _ := time.ParseInLocation("2006-01-02", day(5), time.Local)
+	dependency := ytServer.AddIssue("PRJ", youtrack.Issue{
+		Summary:      "Order parts",
+		CustomFields: []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}},
+	})
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Assemble",
+		Start:   &calendar.EventDateTime{Date: day(7)},
+		End:     &calendar.EventDateTime{Date: day(7)},
+	})
+	sync := func() {
+		t.Helper()
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if result := s.LastResult(); len(result.Errors) > 0 {
+			t.Fatalf("Expected a clean sync, got errors %v", result.Errors)
+		}
+	}
+	sync()
+	item, _ := db.GetSyncItemByGCalID(event.Id)
+	if item == nil {
+		t.Fatal("Expected the event to be synced")
+	}
+	ytServer.AddDependency(item.YTID.String, dependency.ID)
+
+	// Moving the event before its dependency is flagged once.
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) {
+		e.Start = &calendar.EventDateTime{Date: day(2)}
+		e.End = &calendar.EventDateTime{Date: day(2)}
+	})
+	sync()
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) { e.Location = "Workshop" })
+	sync()
+	comments := ytServer.Comments(item.YTID.String)
+	if len(comments) != 1 || !strings.Contains(comments[0], dependency.IDReadable) {
+		t.Fatalf("Expected one comment naming %s, got %q", dependency.IDReadable, comments)
+	}
+
+	// Moving it after the dependency resolves the conflict.
+	gcalServer.ModifyEvent("primary", event.Id, func(e *calendar.Event) {
+		e.Start = &calendar.EventDateTime{Date: day(6)}
+		e.End = &calendar.EventDateTime{Date: day(6)}
+	})
+	sync()
+	if item, _ = db.GetSyncItemByGCalID(event.Id); item.DependencyWarning.Valid {
+		t.Errorf("Expected the warning to be cleared, got %q", item.DependencyWarning.String)
+	}
+	if got := len(ytServer.Comments(item.YTID.String)); got != 1 {
+		t.Errorf("Expected no further comments, got %d", got)
+	}
+}
+
+// countingTransport counts the requests whose query contains a substring.
+type countingTransport struct {
+	substring string
+	count     int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Query().Get("query"), c.substring) {
+		c.count++
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSync_LightPollingFetchesOnlyChangedIssues(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	details := &countingTransport{substring: "issue id:"}
+	ytClient := youtrack.NewClient(ytServer.URL, "token")
+	ytClient.HTTPClient = &http.Client{Transport: details}
+	ytClient.PageSize = 2
+	s := NewSynchronizer(gcalClient, ytClient, db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+	s.LightPolling = true
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	due := []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}}
+	var issues []youtrack.Issue
+	for _, summary := range []string{"One", "Two", "Three"} {
+		issues = append(issues, ytServer.AddIssue("PRJ", youtrack.Issue{Summary: summary, CustomFields: due}))
+	}
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := len(gcalServer.Events("primary")); got != 3 {
+		t.Fatalf("Expected 3 events, got %d", got)
+	}
+	if details.count != 2 {
+		t.Errorf("Expected the details of 3 issues in 2 batches, got %d requests", details.count)
+	}
+
+	details.count = 0
+	ytServer.ModifyIssue(issues[1].ID, func(i *youtrack.Issue) { i.Summary = "Two (edited)" })
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if details.count != 1 {
+		t.Errorf("Expected one detail request for the edited issue, got %d", details.count)
+	}
+	item, _ := db.GetSyncItemByYTID(issues[1].ID)
+	if got := gcalServer.Event("primary", item.GCalID.String).Summary; got != "Two (edited)" {
+		t.Errorf("Expected the edit to reach the calendar, got %q", got)
+	}
+}
+
+func TestSync_PauseRecordsPlannedChangesUntilResumed(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	if err := s.Pause("migration"); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{Summary: "Migrate", CustomFields: []youtrack.CustomField{
+		{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())},
+	}})
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Sync(); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	if got := len(gcalServer.Events("primary")); got != 0 {
+		t.Fatalf("Expected no events while paused, got %d", got)
+	}
+	if item, _ := db.GetSyncItemByYTID(issue.ID); item != nil {
+		t.Errorf("Expected no sync item while paused, got %+v", item)
+	}
+	if lastSync, _ := db.GetYTLastSync(); !lastSync.IsZero() {
+		t.Errorf("Expected the cursor to stay unset while paused, got %v", lastSync)
+	}
+	state, err := s.PauseState()
+	if err != nil {
+		t.Fatalf("PauseState() error = %v", err)
+	}
+	if !state.Paused || state.Reason != "migration" || state.PlannedChanges != 1 {
+		t.Fatalf("Expected one planned change of the last paused pass, got %+v", state)
+	}
+	changes, _ := s.PlannedChanges()
+	if changes[0].Target != ChangeTargetGoogle || changes[0].Action != "create" || textOf(changes[0].Summary) != "Migrate" {
+		t.Errorf("Expected a planned event creation, got %+v", changes[0])
+	}
+	if err := s.SyncIssue(issue.ID); !errors.Is(err, ErrPaused) {
+		t.Errorf("Expected SyncIssue to be refused while paused, got %v", err)
+	}
+
+	if err := s.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := len(gcalServer.Events("primary")); got != 1 {
+		t.Errorf("Expected the queued event after resuming, got %d events", got)
+	}
+	if changes, _ := s.PlannedChanges(); len(changes) != 0 {
+		t.Errorf("Expected the planned changes to be discarded, got %d", len(changes))
+	}
+
+	s.Paused = true
+	if err := s.Resume(); !errors.Is(err, ErrPausedByConfig) {
+		t.Errorf("Expected a configured pause not to be resumable, got %v", err)
+	}
+}
+
+func TestCollectMetrics_CountsBrokenLinks(t *testing.T) {
+	db, gcalClient, ytClient, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	for i := 1; i <= 3; i++ {
+		db.CreateSyncItem(&SyncItem{
+			GCalID: sql.NullString{String: fmt.Sprintf("evt-%d", i), Valid: true},
+			YTID:   sql.NullString{String: fmt.Sprintf("yt-%d", i), Valid: true},
+		})
+	}
+	var eventRequests int
+	gcalClient.getEventFunc = func(calendarID, eventID string) (*googlecalendar.Event, error) {
+		eventRequests++
+		if eventID == "evt-2" {
+			return &googlecalendar.Event{ID: eventID, Status: "cancelled"}, nil
+		}
+		return &googlecalendar.Event{ID: eventID, Status: "confirmed"}, nil
+	}
+	ytClient.getIssueFunc = func(issueID string) (*youtrack.Issue, error) {
+		if issueID == "yt-3" {
+			return nil, youtrack.ErrNotFound
+		}
+		return &youtrack.Issue{ID: issueID}, nil
+	}
+
+	m, err := s.CollectMetrics()
+	if err != nil {
+		t.Fatalf("CollectMetrics() error = %v", err)
+	}
+	if m.Links != 3 || m.Events != 2 || m.Issues != 2 || m.Drift() != 2 {
+		t.Errorf("Expected 3 links, 2 events, 2 issues and a drift of 2, got %+v", m)
+	}
+	latest, err := db.LatestMetrics()
+	if err != nil || latest == nil || latest.Broken != 2 {
+		t.Fatalf("Expected the metrics to be recorded, got %+v (%v)", latest, err)
+	}
+	if _, drifting := s.Drifting(); drifting {
+		t.Error("Expected no drift alert while the drift check is disabled")
+	}
+
+	// After a full pass, the check runs once per interval.
+	gcalClient.fetchEventsFunc = func(calendarID, syncToken string) ([]*googlecalendar.Event, string, error) {
+		return nil, "sync-token", nil
+	}
+	ytClient.getUpdatedIssuesFunc = func(projectID string, since time.Time) ([]youtrack.Issue, error) {
+		return nil, nil
+	}
+	ytClient.getDeletedIssueIDsFunc = func(projectID string, since time.Time) ([]string, error) {
+		return nil, nil
+	}
+	s.DriftThreshold = 1
+	s.DriftCheckInterval = time.Hour
+	eventRequests = 0
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if eventRequests != 0 {
+		t.Errorf("Expected the recent metrics to be reused, got %d event requests", eventRequests)
+	}
+	if m, drifting := s.Drifting(); !drifting || m.Drift() != 2 {
+		t.Errorf("Expected a drift alert above the threshold, got %+v (%v)", m, drifting)
+	}
+
+	s.DriftCheckInterval = 0
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if eventRequests != 3 {
+		t.Errorf("Expected a new check once the interval passed, got %d event requests", eventRequests)
+	}
+}
+
+func TestRepair_RecreatesMissingItemsAndPrunesDeadLinks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	link := func(summary string) *SyncItem {
+		event := gcalServer.AddEvent("primary", &calendar.Event{
+			Summary: summary,
+			Start:   &calendar.EventDateTime{Date: dueDate.Format("2006-01-02")},
+			End:     &calendar.EventDateTime{Date: dueDate.AddDate(0, 0, 1).Format("2006-01-02")},
+		})
+		issue := ytServer.AddIssue("PRJ", youtrack.Issue{
+			Summary:      summary,
+			CustomFields: []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}},
+		})
+		item := &SyncItem{
+			GCalID: sql.NullString{String: event.Id, Valid: true},
+			YTID:   sql.NullString{String: issue.ID, Valid: true},
+		}
+		id, err := db.CreateSyncItem(item)
+		if err != nil {
+			t.Fatalf("CreateSyncItem() error = %v", err)
+		}
+		item.ID = int(id)
+		return item
+	}
+	intact := link("Intact")
+	lostEvent := link("Lost event")
+	lostIssue := link("Lost issue")
+	lostBoth := link("Lost both")
+	gcalServer.DeleteEvent("primary", lostEvent.GCalID.String)
+	ytServer.DeleteIssue(lostIssue.YTID.String)
+	gcalServer.DeleteEvent("primary", lostBoth.GCalID.String)
+	ytServer.DeleteIssue(lostBoth.YTID.String)
+
+	m, broken, err := s.Check()
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if m.Links != 4 || m.Events != 2 || m.Issues != 2 || len(broken) != 3 {
+		t.Fatalf("Expected 3 broken links of 4, got %+v and %d broken", m, len(broken))
+	}
+	problems := map[int]string{}
+	for _, link := range broken {
+		problems[link.Item.ID] = link.Problem
+		if _, err := s.Repair(link); err != nil {
+			t.Errorf("Repair(%s) error = %v", link.Problem, err)
+		}
+	}
+	if problems[lostEvent.ID] != ProblemMissingEvent || problems[lostIssue.ID] != ProblemMissingIssue || problems[lostBoth.ID] != ProblemMissingBoth {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	if _, ok := problems[intact.ID]; ok {
+		t.Error("Expected the intact link not to be reported")
+	}
+
+	item, _ := db.GetSyncItemByYTID(lostEvent.YTID.String)
+	if item == nil || item.GCalID.String == lostEvent.GCalID.String {
+		t.Fatalf("Expected a new event to be linked, got %+v", item)
+	}
+	if event := gcalServer.Event("primary", item.GCalID.String); event == nil || event.Summary != "Lost event" {
+		t.Errorf("Expected the event to be recreated from the issue, got %+v", event)
+	}
+	item, _ = db.GetSyncItemByGCalID(lostIssue.GCalID.String)
+	if item == nil || item.YTID.String == lostIssue.YTID.String {
+		t.Fatalf("Expected a new issue to be linked, got %+v", item)
+	}
+	if issue := ytServer.Issue(item.YTID.String); issue == nil || issue.Summary != "Lost issue" {
+		t.Errorf("Expected the issue to be recreated from the event, got %+v", issue)
+	}
+	if item, _ := db.GetSyncItemByGCalID(lostBoth.GCalID.String); item != nil {
+		t.Error("Expected the dead link to be pruned")
+	}
+
+	m, broken, err = s.Check()
+	if err != nil || m.Drift() != 0 || len(broken) != 0 {
+		t.Errorf("Expected no drift after the repair, got %+v (%v)", m, err)
+	}
+}
+
+func TestResync_LinksMatchingPairsWithoutDuplicates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gcalServer := fake.NewCalendar()
+	defer gcalServer.Close()
+	ytServer := fake.NewYouTrack()
+	defer ytServer.Close()
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, gcalServer.Client())
+	gcalClient, err := googlecalendar.NewClient(ctx, &oauth2.Token{AccessToken: "fake"}, &oauth2.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create Google Calendar client: %v", err)
+	}
+	s := NewSynchronizer(gcalClient, youtrack.NewClient(ytServer.URL, "token"), db, WithProject("PRJ"), WithQueryProject("PRJ"), WithCalendar("primary"))
+
+	// The state was lost, but both sides still hold a synced pair.
+	dueDate := time.Now().AddDate(0, 0, 3).Truncate(24 * time.Hour)
+	event := gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Write report",
+		Start:   &calendar.EventDateTime{Date: dueDate.Format("2006-01-02")},
+		End:     &calendar.EventDateTime{Date: dueDate.AddDate(0, 0, 1).Format("2006-01-02")},
+	})
+	issue := ytServer.AddIssue("PRJ", youtrack.Issue{
+		Summary:      "Write report",
+		CustomFields: []youtrack.CustomField{{YouTrackType: youtrack.YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: float64(dueDate.UnixMilli())}},
+	})
+	// An unrelated new event is still created as an issue.
+	gcalServer.AddEvent("primary", &calendar.Event{
+		Summary: "Team sync",
+		Start:   &calendar.EventDateTime{Date: dueDate.Format("2006-01-02")},
+		End:     &calendar.EventDateTime{Date: dueDate.AddDate(0, 0, 1).Format("2006-01-02")},
+	})
+	db.SetGCalSyncToken("stale")
+
+	if err := s.Resync(); err != nil {
+		t.Fatalf("Resync() error = %v", err)
+	}
+	if result := s.LastResult(); len(result.Errors) > 0 {
+		t.Fatalf("Expected a clean resync, got errors %v", result.Errors)
+	}
+
+	item, _ := db.GetSyncItemByGCalID(event.Id)
+	if item == nil || item.YTID.String != issue.ID {
+		t.Fatalf("Expected the existing pair to be linked, got %+v", item)
+	}
+	if !item.YTUpdatedAt.Time.Equal(time.UnixMilli(issue.Updated)) {
+		t.Errorf("Expected the link to carry the issue's update time, got %s", item.YTUpdatedAt.Time)
+	}
+	if got := len(gcalServer.Events("primary")); got != 2 {
+		t.Errorf("Expected no duplicate events, got %d events", got)
+	}
+	issues := ytServer.Issues()
+	if len(issues) != 2 || issues[1].Summary != "Team sync" {
+		t.Errorf("Expected only the unrelated event to become an issue, got %+v", issues)
+	}
+	if token, _ := db.GetGCalSyncToken(); token == "stale" || token == "" {
+		t.Errorf("Expected the stale sync token to be replaced, got %q", token)
+	}
+}
+
+// fakeClock is a Clock that only moves when advanced.
+// textOf returns the text s points to, or "<nil>".
+func textOf(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+type fakeClock struct {
+	mu     gosync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	// waiting receives whenever After is called with a positive duration.
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waiting: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), c: ch})
+	c.waiting <- struct{}{}
+	return ch
+}
+
+// Advance moves the clock by d, firing the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.c <- c.now
+	}
+	c.timers = pending
+}
+
+// dailyAt is a Schedule activating daily at hour UTC.
+type dailyAt int
+
+func (h dailyAt) Next(t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), int(h), 0, 0, 0, time.UTC)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -1,9 +1,15 @@
 package sync
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"html/template"
 	"log"
+	"slices"
+	gosync "sync"
+	"sync/atomic"
 	"time"
 
 	"youtrack-calendar-sync/googlecalendar"
@@ -15,141 +21,826 @@ import (
 // GCalClient defines the interface for Google Calendar client operations.
 type GCalClient interface {
 	FetchEvents(calendarID, syncToken string) ([]*googlecalendar.Event, string, error)
-	CreateEvent(calendarID, summary, description string, start, end time.Time) (*calendar.Event, error)
-	UpdateEvent(calendarID, eventID, summary, description string, start, end time.Time) (*calendar.Event, error)
+	GetEvent(calendarID, eventID string) (*googlecalendar.Event, error)
+	CreateEvent(calendarID, eventID, summary, description, location string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error)
+	UpdateEvent(calendarID, eventID string, summary, description, location *string, start, end time.Time, allDay bool, visibility, transparency string) (*calendar.Event, error)
+	MoveEvent(calendarID, eventID, destinationCalendarID string) (*calendar.Event, error)
+	SetIssueID(calendarID, eventID, issueID string) (*calendar.Event, error)
+	SetColor(calendarID, eventID, colorID string) (*calendar.Event, error)
+	SetRecurrence(calendarID, eventID string, start, end time.Time, recurrence []string) (*calendar.Event, error)
+	PatchEvent(calendarID, eventID string, patch *calendar.Event) (*calendar.Event, error)
 	DeleteEvent(calendarID, eventID string) error
+	FreeBusy(calendarIDs []string, from, to time.Time) ([]googlecalendar.Busy, error)
+	ListEvents(calendarID string, from, to time.Time) ([]*googlecalendar.Event, error)
+	GetCalendar(calendarID string) (*calendar.Calendar, error)
+	CreateCalendar(summary string) (*calendar.Calendar, error)
+	ShareCalendar(calendarID, scopeType, address, role string) error
+	UnshareCalendar(calendarID, scopeType, address string) error
+	CalendarACL(calendarID string) ([]*calendar.AclRule, error)
+	WatchEvents(calendarID, id, address, token string, ttl time.Duration) (*googlecalendar.Channel, error)
+	StopChannel(id, resourceID string) error
 }
 
 // YTClient defines the interface for YouTrack client operations.
 type YTClient interface {
 	GetUpdatedIssues(projectID string, since time.Time) ([]youtrack.Issue, error)
-	CreateIssue(projectID, summary, description string, dueDate *time.Time) (*youtrack.Issue, error)
-	UpdateIssue(issueID, summary, description string, dueDate *time.Time) error
-	GetDeletedIssueIDs(projectID string, since time.Time) ([]string, error)
+	GetIssues(issueIDs []string) ([]youtrack.Issue, error)
+	GetIssue(issueID string) (*youtrack.Issue, error)
+	GetDueIssues(projectID string, from, to time.Time) ([]youtrack.Issue, error)
+	MatchesQuery(projectID, issueID string) (bool, error)
+	CreateIssue(projectID, summary, description string, dueDate *time.Time, fields []youtrack.CustomFieldWrapper) (*youtrack.Issue, error)
+	UpdateIssue(issueID string, summary, description *string, dueDate *time.Time) error
+	UpdateCustomFields(issueID string, fields []youtrack.CustomFieldWrapper) error
+	// ChangeFeed returns the issues created, updated and deleted since the
+	// given time in one feed.
+	ChangeFeed(projectID string, since time.Time) (*youtrack.Changes, error)
+	ChangeFeedStamps(projectID string, since time.Time) (*youtrack.Changes, error)
+	GetCurrentUser() (*youtrack.User, error)
+	FindUserByEmail(email string) (*youtrack.User, error)
+	GetProjectCustomFields(projectID string) ([]youtrack.ProjectCustomField, error)
+	AddTag(issueID, tagName string) error
+	GetSavedQuery(name string) (*youtrack.SavedQuery, error)
+	LinkIssues(linkType, sourceID, targetID string) error
+	GetDependencies(issueID string) ([]youtrack.Issue, error)
+	AddComment(issueID, text string) error
+	ApplyCommand(issueID, command string) error
 	GetBaseURL() string
 }
 
 // Synchronizer handles the synchronization between Google Calendar and YouTrack.
 type Synchronizer struct {
-	GoogleCalendarClient GCalClient
-	YouTrackClient       YTClient
-	DB                   *DB
-	YouTrackProjectID    string
+	GoogleCalendarClient   GCalClient
+	YouTrackClient         YTClient
+	DB                     *DB
+	YouTrackProjectID      string
 	YouTrackQueryProjectID string
-	CalendarID           string
+	// SavedSearch names a YouTrack saved search that selects the synced
+	// issues instead of YouTrackQueryProjectID. It is resolved on every
+	// pass, so edits made in YouTrack apply to the next sync.
+	SavedSearch   string
+	CalendarID    string
+	ManagedFields ManagedFields
+	// DescriptionTemplate renders event descriptions; nil uses the default template.
+	DescriptionTemplate *template.Template
+	// DescriptionSync copies the text of descriptions both ways, converting
+	// between Markdown and HTML. The synchronizer's own content follows the
+	// text in a metadata block, see metadataMarker.
+	DescriptionSync bool
+	// IncludeDrafts syncs draft issues, which are skipped by default.
+	IncludeDrafts bool
+	// IncludeResolved creates events for issues that are already resolved.
+	IncludeResolved bool
+	// ResolvedAction is applied to synced events once their issue is resolved.
+	ResolvedAction ResolvedAction
+	// ArchiveCalendarID receives the events moved by ResolvedActionArchive.
+	ArchiveCalendarID string
+	// SubtaskMode determines how subtasks appear in the calendar.
+	SubtaskMode SubtaskMode
+	// LinkRecurringInstances makes the issues of modified occurrences of a
+	// recurring event subtasks of the issue of the series.
+	LinkRecurringInstances bool
+	// LightPolling asks YouTrack only for the IDs and update times of
+	// updated issues, and fetches the details of those that changed since
+	// they were last synced.
+	LightPolling bool
+	// DependencyCheck reports due dates written from the calendar that come
+	// before the due date of an issue the issue depends on.
+	DependencyCheck DependencyCheck
+	// ConflictCheck reports events written from issues on days that are
+	// booked with meetings.
+	ConflictCheck ConflictCheck
+	// EventTiming makes events written from issues all-day or timed, in
+	// which case timed events start at EventTime after midnight and last
+	// EventDuration.
+	EventTiming   EventTiming
+	EventTime     time.Duration
+	EventDuration time.Duration
+	// PriorityDurations and TypeDurations override EventDuration for the
+	// issues of a priority or type, see ParseEventDurations. The priority
+	// takes precedence.
+	PriorityDurations map[string]time.Duration
+	TypeDurations     map[string]time.Duration
+	// DueDateBoundary selects the start or end of events as the due date.
+	DueDateBoundary DueDateBoundary
+	// EventCopies determines whether copies of synced events get issues.
+	EventCopies EventCopies
+	// EchoWindow is how long after the synchronizer wrote an item updates
+	// to it are taken as echoes of that write, see isEcho. Zero disables
+	// echo suppression.
+	EchoWindow time.Duration
+	// ClockSkew is how far apart update times may be and still be too
+	// close to order, see updatedSince. Zero compares them exactly.
+	ClockSkew time.Duration
+	// WorkingHours, if set, moves timed events written from issues into
+	// the working day.
+	WorkingHours *WorkingHours
+	// Holidays, if set, flags or moves the events written from issues that
+	// fall on a holiday.
+	Holidays *Holidays
+	// Planner, if set, places work blocks for upcoming issues into free
+	// calendar time within WorkingHours.
+	Planner *Planner
+	// Rollup, if set, lists the deadlines of unlinked issues in one
+	// all-day event per day instead of creating an event for each.
+	Rollup *Rollup
+	// CalendarSetup, if set, creates a calendar in place of CalendarID when
+	// that does not exist, see ensureCalendar.
+	CalendarSetup *CalendarSetup
+	// WeeklyDigest, if set, keeps a Sunday-evening event listing the
+	// issues due the following week.
+	WeeklyDigest *WeeklyDigest
+	// MorningAgenda, if set, sends the synced issues due each day.
+	MorningAgenda *MorningAgenda
+	// Outbox, if set, queues YouTrack writes while YouTrack is unreachable
+	// and makes them once it is back.
+	Outbox *Outbox
+	// EventVisibility and EventTransparency are set on events written from
+	// issues, see ParseVisibility and ParseTransparency; empty leaves the
+	// calendar defaults.
+	EventVisibility   string
+	EventTransparency string
+	// EventMarker marks the summary of written events; when set, events
+	// without it are not synced.
+	EventMarker EventMarker
+	// StartDate, unless zero, leaves out unlinked events that start and
+	// issues that are due before it, so that a new mapping does not import
+	// the history of either side.
+	StartDate time.Time
+	// Paused keeps synchronization paused whatever the pause stored with
+	// the sync state says, see Pause.
+	Paused bool
+	// SkippedEventTypes lists Google event types that never become issues.
+	SkippedEventTypes map[string]bool
+	// MinAttendees, if positive, leaves events with fewer guests out of
+	// issue creation, unless the user organizes them.
+	MinAttendees int
+	// IgnoredEvents, if set, selects events of other automations that never
+	// become issues.
+	IgnoredEvents *IgnoredEvents
+	// Response writes the user's own attendee response back to YouTrack.
+	Response ResponsePolicy
+	// ConferenceField is the text custom field that receives the event's
+	// conference join URL. When empty the URL is appended to the issue description.
+	ConferenceField string
+	// LocationField is the text custom field mirrored with the event location.
+	LocationField string
+	// Hooks transform items before they are written, in order.
+	Hooks []Hook
+	// IssueType is the Type of issues created from events unless one of
+	// IssueTypeRules matches; empty leaves the project default.
+	IssueType      string
+	IssueTypeRules []IssueTypeRule
+	// DefaultFields and DefaultTags are applied to issues created from events.
+	DefaultFields []DefaultField
+	DefaultTags   []string
+	// Tags shows the tags of issues on their events.
+	Tags TagSync
+	// AssignOrganizer assigns issues created from events to the YouTrack user
+	// whose email matches the event organizer, or to AssigneeFallback.
+	AssignOrganizer  bool
+	AssigneeFallback string
+	// ProvenanceComment comments on issues created from events which event
+	// they came from, see provenanceComment.
+	ProvenanceComment bool
+	// OnReauthRequired is called once when Google rejects the refresh token.
+	OnReauthRequired func(err error)
+	// DriftThreshold enables a drift check after full passes, at most once
+	// per DriftCheckInterval, warning when more links are broken.
+	DriftThreshold     int
+	DriftCheckInterval time.Duration
+	// Clock tells the time; nil uses SystemClock. WithClock sets it on the
+	// database as well.
+	Clock Clock
+	// Concurrency is how many requests of a pass may run in parallel, such
+	// as the fetches of both sides at its start; zero or one runs them one
+	// after the other.
+	Concurrency int
+	// Siblings are the synchronizers of the other mappings. An issue that
+	// leaves the query of a sibling for that of s has its event moved from
+	// the sibling's calendar instead of getting a second one.
+	Siblings []*Synchronizer
+	// PushNotifications, if set, syncs the changes of the calendar as Google
+	// announces them, see StartPushChannelLoop.
+	PushNotifications *PushNotifications
+
+	// mu serializes full and targeted sync passes.
+	mu gosync.Mutex
+	// currentUser caches the login of the YouTrack token owner.
+	currentUser string
+	// result collects the outcome of the current or last pass.
+	result RunResult
+	// halt is the failure that ends the current pass, see haltOn.
+	halt error
+	// authErr records a revoked Google token, guarded by authMu so it can
+	// be read while a pass is running.
+	authMu  gosync.Mutex
+	authErr error
+	// metrics holds the last drift check, guarded by metricsMu.
+	metricsMu gosync.Mutex
+	metrics   *Metrics
+	// stop is closed by Stop to end the sync loop.
+	stop     chan struct{}
+	stopOnce gosync.Once
+	// ctx is canceled by Stop, ending the queries of a running pass.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// dryRun receives the writes of every pass once set by WithDryRun, see
+	// Observe.
+	dryRun *ChangeFeed
+	// calendarChecked is set once CalendarSetup has resolved CalendarID.
+	calendarChecked bool
+	// catchingUp widens the YouTrack window of the next pass, see
+	// waitUntil.
+	catchingUp atomic.Bool
+	// ytDown is set from when YouTrack is found unreachable until the next
+	// pass, see youTrackDown.
+	ytDown atomic.Bool
+	// runID identifies the journal entries of the synchronizer among those
+	// of earlier processes and of others sharing the state, see
+	// recoverJournal.
+	runID string
+	// pushStatus and pushToken describe the open push channel, guarded by
+	// pushMu. pushQueued is set while a pass started by a notification
+	// waits to run.
+	pushMu     gosync.Mutex
+	pushStatus PushChannelStatus
+	pushToken  string
+	pushQueued atomic.Bool
 }
 
-// NewSynchronizer creates a new Synchronizer instance.
-func NewSynchronizer(
-	googleClient GCalClient,
-	youtrackClient YTClient,
-	db *DB,
-	youtrackProjectID, youtrackQueryProjectID, calendarID string,
-) *Synchronizer {
-	return &Synchronizer{
+// IssueQuery returns the projects or query fragment selecting the synced
+// issues, resolving SavedSearch when it is set.
+func (s *Synchronizer) IssueQuery() (string, error) {
+	if s.SavedSearch == "" {
+		return s.YouTrackQueryProjectID, nil
+	}
+	saved, err := s.YouTrackClient.GetSavedQuery(s.SavedSearch)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve saved search %q: %w", s.SavedSearch, err)
+	}
+	// The parentheses keep the terms appended to the query from binding
+	// to only part of it.
+	return "(" + saved.Query + ")", nil
+}
+
+// fetchChanges returns the issues of query created, updated or deleted
+// since the given time from the YouTrack change feed. With LightPolling,
+// the feed holds only the update times, and the details are fetched for the
+// issues whose update time is newer than their sync item's; the others hold
+// no changes to sync and are left out.
+func (s *Synchronizer) fetchChanges(query string, since time.Time) (*youtrack.Changes, error) {
+	query = s.fetchQuery(query)
+	if !s.LightPolling {
+		changes, err := s.YouTrackClient.ChangeFeed(query, since)
+		if err != nil {
+			return nil, err
+		}
+		changes.Created, changes.Updated = s.withoutDrafts(changes.Created), s.withoutDrafts(changes.Updated)
+		return changes, nil
+	}
+	changes, err := s.YouTrackClient.ChangeFeedStamps(query, since)
+	if err != nil {
+		return nil, err
+	}
+	stamps := changes.Issues()
+	changes.Created, changes.Updated = nil, nil
+	var changed []string
+	for _, stamp := range stamps {
+		item, err := s.DB.GetSyncItemByYTID(stamp.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to get sync item for YouTrack issue %s: %w", stamp.ID, err)
+		}
+		if item != nil && !s.updatedSince(time.UnixMilli(stamp.Updated), item.YTUpdatedAt.Time, "", item.YTHash) {
+			continue
+		}
+		changed = append(changed, stamp.ReadableID())
+	}
+	if len(changed) == 0 {
+		return changes, nil
+	}
+	log.Printf("%d of %d updated YouTrack issues changed since their last sync.\n", len(changed), len(stamps))
+	issues, err := s.YouTrackClient.GetIssues(changed)
+	if err != nil {
+		return nil, err
+	}
+	changes.Updated = s.withoutDrafts(issues)
+	return changes, nil
+}
+
+// fetchQuery returns query restricted to unresolved issues unless
+// IncludeResolved is set. ChangeFeed still reports the issues resolved in the
+// period it reads, so that ResolvedAction is applied to them.
+func (s *Synchronizer) fetchQuery(query string) string {
+	if s.IncludeResolved {
+		return query
+	}
+	return youtrack.ProjectQuery(query) + " #Unresolved"
+}
+
+// withoutDrafts returns issues without the drafts unless IncludeDrafts is set.
+func (s *Synchronizer) withoutDrafts(issues []youtrack.Issue) []youtrack.Issue {
+	if s.IncludeDrafts {
+		return issues
+	}
+	return slices.DeleteFunc(issues, func(issue youtrack.Issue) bool { return issue.IsDraft })
+}
+
+// DefaultSkippedEventTypes are the event types that are not synced unless
+// configured otherwise: they describe availability rather than work.
+var DefaultSkippedEventTypes = []string{
+	googlecalendar.EventTypeFocusTime,
+	googlecalendar.EventTypeOutOfOffice,
+	googlecalendar.EventTypeWorkingLocation,
+}
+
+// NewSynchronizer creates a new Synchronizer instance configured by opts.
+func NewSynchronizer(googleClient GCalClient, youtrackClient YTClient, db *DB, opts ...Option) *Synchronizer {
+	s := &Synchronizer{
 		GoogleCalendarClient: googleClient,
 		YouTrackClient:       youtrackClient,
 		DB:                   db,
-		YouTrackProjectID:    youtrackProjectID,
-		YouTrackQueryProjectID: youtrackQueryProjectID,
-		CalendarID:           calendarID,
+		SkippedEventTypes:    EventTypeSet(DefaultSkippedEventTypes),
+		EventTiming:          EventTimingAllDay,
+		EventTime:            DefaultEventTime,
+		EventDuration:        DefaultEventDuration,
+		DueDateBoundary:      DueDateStart,
+		EventCopies:          EventCopiesSkip,
+		EchoWindow:           DefaultEchoWindow,
+		ClockSkew:            DefaultClockSkew,
+		stop:                 make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.runID = newRunID()
+	return s
+}
+
+// EventTypeSet converts a list of event types into a set for SkippedEventTypes.
+func EventTypeSet(types []string) map[string]bool {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return set
+}
+
+// Sync performs a one-time synchronization and returns what it did. The
+// result is returned along with an error that ended the pass early.
+func (s *Synchronizer) Sync() (RunResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beginResult()
+	err := s.startDryRun()
+	if err == nil {
+		defer s.bindDB()()
+		err = s.syncOnce()
 	}
+	s.endResult()
+	return s.result.clone(), err
 }
 
-// Sync performs a one-time synchronization.
-func (s *Synchronizer) Sync() error {
+func (s *Synchronizer) syncOnce() error {
+	if err := s.requireAuth(); err != nil {
+		return err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return err
+	}
+	paused, err := s.paused()
+	if err != nil {
+		return err
+	}
+	if paused {
+		return s.plan()
+	}
+	return s.pass()
+}
+
+// pass runs a synchronization pass.
+func (s *Synchronizer) pass() error {
 	log.Println("Starting synchronization...")
 
+	if err := s.recoverJournal(); err != nil {
+		return err
+	}
+	s.ytDown.Store(false)
+	if s.Outbox != nil {
+		if err := s.flushOutbox(); err != nil {
+			return err
+		}
+	}
+
 	gcalSyncToken, err := s.DB.GetGCalSyncToken()
 	if err != nil {
 		return fmt.Errorf("failed to get Google Calendar sync token: %w", err)
 	}
-	ytLastSync, err := s.DB.GetYTLastSync()
+	// The cursor is the newest change seen rather than the time of the
+	// last pass, so that changes made while a pass runs are not skipped.
+	ytCursor, err := s.DB.GetYTLastSync()
 	if err != nil {
 		return fmt.Errorf("failed to get YouTrack last sync time: %w", err)
 	}
-	if ytLastSync.IsZero() {
-		ytLastSync = time.Now().Add(-30 * 24 * time.Hour)
+	catchingUp := s.catchingUp.Swap(false)
+	var ytSince time.Time
+	switch {
+	case ytCursor.IsZero():
+		ytSince = s.now().Add(-30 * 24 * time.Hour)
+	case catchingUp:
+		ytSince = ytCursor.Add(-catchUpOverlap)
+		log.Printf("Catching up with YouTrack updates since %s\n", ytSince.Format(time.RFC3339))
+	default:
+		ytSince = ytCursor.Add(-cursorOverlap)
 	}
 
-	gcalEvents, newGCalSyncToken, err := s.GoogleCalendarClient.FetchEvents(s.CalendarID, gcalSyncToken)
-	if err != nil {
-		return fmt.Errorf("failed to fetch Google Calendar events: %w", err)
-	}
-	ytIssues, err := s.YouTrackClient.GetUpdatedIssues(s.YouTrackQueryProjectID, ytLastSync)
-	if err != nil {
-		return fmt.Errorf("failed to fetch YouTrack issues: %w", err)
+	query, err := s.IssueQuery()
+	if err != nil && !s.youTrackDown(err) {
+		return err
 	}
-	ytDeletedIssueIDs, err := s.YouTrackClient.GetDeletedIssueIDs(s.YouTrackQueryProjectID, ytLastSync)
+	var (
+		gcalEvents       []*googlecalendar.Event
+		newGCalSyncToken string
+		ytChanges        = &youtrack.Changes{}
+	)
+	err = s.parallel(
+		func() (err error) {
+			gcalEvents, newGCalSyncToken, err = s.calendar().FetchEvents(s.CalendarID, gcalSyncToken)
+			if err != nil {
+				return fmt.Errorf("failed to fetch Google Calendar events: %w", err)
+			}
+			return nil
+		},
+		func() (err error) {
+			if s.ytDown.Load() {
+				return nil
+			}
+			changes, err := s.fetchChanges(query, ytSince)
+			if err != nil && !s.youTrackDown(err) {
+				return fmt.Errorf("failed to fetch YouTrack changes: %w", err)
+			}
+			if err == nil {
+				ytChanges = changes
+			}
+			return nil
+		},
+	)
 	if err != nil {
-		return fmt.Errorf("failed to fetch deleted YouTrack issue IDs: %w", err)
+		return err
 	}
 
 	if err := s.processGCalEvents(gcalEvents); err != nil {
 		return err
 	}
-	if err := s.processYTissues(ytIssues); err != nil {
+	if err := s.processYTissues(ytChanges.Issues()); err != nil {
 		return err
 	}
 	if err := s.handleDeletions(gcalEvents); err != nil {
 		return err
 	}
-	if err := s.processYTDeletions(ytDeletedIssueIDs); err != nil {
+	if err := s.processYTDeletions(ytChanges.Deleted); err != nil {
+		return err
+	}
+	// The passes below read YouTrack, which the next pass does again.
+	down := s.ytDown.Load()
+	if s.Planner != nil && !down {
+		if err := s.planWork(); err != nil {
+			s.logError("Error planning work blocks: %v\n", err)
+		}
+	}
+	if s.Rollup != nil && !down {
+		if err := s.rollUpDeadlines(); err != nil {
+			s.logError("Error rolling up deadlines: %v\n", err)
+		}
+	}
+	if s.WeeklyDigest != nil && !down {
+		if err := s.writeWeeklyDigest(); err != nil {
+			s.logError("Error writing weekly digest: %v\n", err)
+		}
+	}
+	if s.MorningAgenda != nil && !down {
+		if err := s.sendMorningAgenda(); err != nil {
+			s.logError("Error sending morning agenda: %v\n", err)
+		}
+	}
+	if err := s.halted(); err != nil {
 		return err
 	}
 
 	if newGCalSyncToken != "" && newGCalSyncToken != gcalSyncToken {
 		if err := s.DB.SetGCalSyncToken(newGCalSyncToken); err != nil {
-			log.Printf("Error setting Google Calendar sync token: %v\n", err)
+			s.logError("Error setting Google Calendar sync token: %v\n", err)
 		}
 	}
-	if err := s.DB.SetYTLastSync(time.Now()); err != nil {
-		log.Printf("Error setting YouTrack last sync time: %v\n", err)
+	if s.ytDown.Load() {
+		log.Printf("Synchronization finished without YouTrack; %d writes are queued for it.\n", s.result.Queued)
+		return nil
+	}
+	if latest := time.UnixMilli(ytChanges.Latest); ytChanges.Latest > 0 && latest.After(ytCursor) {
+		if err := s.DB.SetYTLastSync(latest); err != nil {
+			s.logError("Error setting YouTrack last sync time: %v\n", err)
+		}
+	}
+	if s.DriftThreshold > 0 {
+		s.checkDrift()
 	}
 
 	log.Println("Synchronization finished.")
 	return nil
 }
 
+// parallel runs fns, up to Concurrency at a time, and returns the error of
+// the first one that failed, in the order given. Without concurrency it
+// stops at the first error.
+func (s *Synchronizer) parallel(fns ...func() error) error {
+	if s.Concurrency <= 1 {
+		for _, fn := range fns {
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, len(fns))
+	slots := make(chan struct{}, s.Concurrency)
+	var wg gosync.WaitGroup
+	for i, fn := range fns {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = fn()
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncIssue reconciles a single YouTrack issue, given by its ID or readable
+// ID, with its calendar event without running a full pass. A missing issue
+// is treated as deleted, and one outside IssueQuery is left alone.
+func (s *Synchronizer) SyncIssue(issueID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beginResult()
+	defer s.endResult()
+	if err := s.startDryRun(); err != nil {
+		return err
+	}
+	defer s.bindDB()()
+	if err := s.requireAuth(); err != nil {
+		return err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return err
+	}
+	if err := s.requireRunning(); err != nil {
+		return err
+	}
+
+	issue, err := s.YouTrackClient.GetIssue(issueID)
+	if errors.Is(err, youtrack.ErrNotFound) {
+		return s.processYTDeletions([]string{issueID})
+	} else if err != nil {
+		return fmt.Errorf("failed to fetch YouTrack issue %s: %w", issueID, err)
+	}
+	if len(s.withoutDrafts([]youtrack.Issue{*issue})) == 0 {
+		return nil
+	}
+	// Webhooks are routed by project only, while the query or saved search
+	// may select fewer of its issues.
+	query, err := s.IssueQuery()
+	if err != nil {
+		return err
+	}
+	if query != "" {
+		matches, err := s.YouTrackClient.MatchesQuery(query, issue.ReadableID())
+		if err != nil {
+			return fmt.Errorf("failed to check query for YouTrack issue %s: %w", issueID, err)
+		}
+		if !matches {
+			log.Printf("Skipping YouTrack task %s, which is not selected by the query of the mapping\n", issue.ReadableID())
+			return nil
+		}
+	}
+	return s.processYTissues([]youtrack.Issue{*issue})
+}
+
+// SyncEvent reconciles a single Google Calendar event with its issue without
+// running a full pass. A missing event is treated as cancelled.
+func (s *Synchronizer) SyncEvent(eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.beginResult()
+	defer s.endResult()
+	if err := s.startDryRun(); err != nil {
+		return err
+	}
+	defer s.bindDB()()
+	if err := s.requireAuth(); err != nil {
+		return err
+	}
+	if err := s.ensureCalendar(); err != nil {
+		return err
+	}
+	if err := s.requireRunning(); err != nil {
+		return err
+	}
+
+	event, err := s.calendar().GetEvent(s.CalendarID, eventID)
+	if errors.Is(err, googlecalendar.ErrNotFound) {
+		event = &googlecalendar.Event{ID: eventID, Status: "cancelled"}
+	} else if err != nil {
+		return fmt.Errorf("failed to fetch Google Calendar event %s: %w", eventID, err)
+	}
+	events := []*googlecalendar.Event{event}
+	if err := s.processGCalEvents(events); err != nil {
+		return err
+	}
+	return s.handleDeletions(events)
+}
+
 func (s *Synchronizer) processGCalEvents(events []*googlecalendar.Event) error {
 	for _, event := range events {
-		if event.Status == "cancelled" {
+		if err := s.halted(); err != nil {
+			return err
+		}
+		if event.Status == "cancelled" || s.Response.cancels(event.ResponseStatus) {
+			// Both are unlinked by handleDeletions.
+			continue
+		}
+		if s.SkippedEventTypes[event.EventType] {
 			continue
 		}
 
 		syncItem, err := s.DB.GetSyncItemByGCalID(event.ID)
-		if err != nil {
-			log.Printf("Error getting sync item for GCal event %s: %v\n", event.ID, err)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			s.logError("Error getting sync item for GCal event %s: %v\n", event.ID, err)
 			continue
 		}
 
+		if syncItem == nil && (s.beforeStart(event.Start) || !s.EventMarker.marks(event.Summary) || s.isWorkBlock(event) || s.isRollup(event) || s.isDigestEvent(event) || s.IgnoredEvents.matches(event) || s.fewAttendees(event) || s.Response.skipsCreation(event.ResponseStatus)) {
+			continue
+		}
+		if syncItem == nil {
+			// An interrupted creation left this event for its issue.
+			pending, err := s.DB.IsPendingEvent(event.ID)
+			if err != nil {
+				s.logError("Error checking pending creations for GCal event %s: %v\n", event.ID, err)
+				continue
+			}
+			if pending {
+				continue
+			}
+		}
+		if syncItem == nil && s.EventCopies != EventCopiesCreate {
+			copied, err := s.isCopy(event)
+			if err != nil {
+				s.logError("Error checking whether GCal event %s is a copy: %v\n", event.ID, err)
+				continue
+			}
+			if copied {
+				log.Printf("Skipping Google Calendar event %s (%s), a copy of the event of YouTrack task %s\n", event.Summary, event.ID, event.IssueID)
+				continue
+			}
+		}
 		if syncItem == nil {
 			log.Printf("Creating YouTrack task for new Google Calendar event: %s (%s)\n", event.Summary, event.ID)
-			issue, err := s.YouTrackClient.CreateIssue(s.YouTrackProjectID, event.Summary, event.HTMLLink, &event.Start)
+			draft := s.issueDraft(event)
+			if err := s.applyOrganizerAssignee(event, draft); err != nil {
+				s.logError("Error creating YouTrack task: %v\n", err)
+				continue
+			}
+			if err := s.applyDefaultFields(draft); err != nil {
+				s.logError("Error creating YouTrack task: %v\n", err)
+				continue
+			}
+			if err := s.runIssueHooks(true, event, draft); err != nil {
+				s.logHookError(event.ID, err)
+				continue
+			}
+			pending, err := s.DB.BeginCreate(eventSource(event.ID))
+			if err != nil {
+				s.logError("Error creating YouTrack task: %v\n", err)
+				continue
+			}
+			issue, err := s.interruptedIssue(pending, event, draft)
 			if err != nil {
-				log.Printf("Error creating YouTrack task: %v\n", err)
+				s.logError("Error looking for the YouTrack task of an interrupted attempt: %v\n", err)
+				continue
+			}
+			if issue != nil {
+				log.Printf("Linking YouTrack task %s created by an interrupted earlier attempt\n", issue.ID)
+			} else if issue, err = s.youtrack().CreateIssue(s.YouTrackProjectID, draft.Summary, draft.Description, draft.DueDate, draft.CustomFields); err != nil {
+				s.logError("Error creating YouTrack task: %v\n", err)
 				continue
+			} else if err := s.addProvenanceComment(issue.ID, event); err != nil {
+				s.logError("Error commenting on the origin of YouTrack task %s: %v\n", issue.ID, err)
 			}
-			_, err = s.DB.CreateSyncItem(&SyncItem{
+			s.addTags(s.youtrack(), issue.ID, append(slices.Clone(s.DefaultTags), draft.Tags...))
+			s.linkRecurringInstance(event, issue.ID)
+			item := &SyncItem{
 				GCalID:        sql.NullString{String: event.ID, Valid: true},
 				YTID:          sql.NullString{String: issue.ID, Valid: true},
+				YTReadableID:  readableID(*issue),
 				GCalUpdatedAt: sql.NullTime{Time: event.Updated, Valid: true},
 				YTUpdatedAt:   sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true},
-			})
+				GCalHash:      syncedHash(eventHash(event)),
+				YTHash:        syncedHash(issueHash(*issue)),
+			}
+			s.linkEvent(item, issue.ID)
+			if err := s.applyResponse(item, event.ResponseStatus); err != nil {
+				s.logError("Error writing attendee response to YouTrack task %s: %v\n", issue.ID, err)
+			}
+			if err := s.applyConferenceURL(s.youtrack(), issue.ID, event); err != nil {
+				s.logError("Error writing conference link to YouTrack task %s: %v\n", issue.ID, err)
+			}
+			if err := s.applyLocation(s.youtrack(), issue.ID, event.Location); err != nil {
+				s.logError("Error writing location to YouTrack task %s: %v\n", issue.ID, err)
+			}
+			if err := s.checkDependencies(item, draft.DueDate); err != nil {
+				s.logError("Error checking dependencies of YouTrack task %s: %v\n", issue.ID, err)
+			}
+			item.YTWrittenAt = sql.NullTime{Time: s.now(), Valid: true}
+			_, err = s.DB.CreateSyncItem(item)
 			if err != nil {
-				log.Printf("Error creating sync item: %v\n", err)
+				s.logError("Error creating sync item: %v\n", err)
+			} else if err := s.DB.FinishCreate(pending.Source); err != nil {
+				s.logError("Error finishing creation of YouTrack task %s: %v\n", issue.ID, err)
 			}
 		} else {
 			// Existing item, check for updates and conflicts
-			if event.Updated.After(syncItem.GCalUpdatedAt.Time) {
+			hash := eventHash(event)
+			changed := s.updatedSince(event.Updated, syncItem.GCalUpdatedAt.Time, hash, syncItem.GCalHash)
+			if changed && s.isEcho(event.Updated, event.WrittenAt) {
+				log.Printf("Google Calendar event '%s' was updated by the synchronizer's own write. Not updating YouTrack.", event.Summary)
+				syncItem.GCalUpdatedAt = sql.NullTime{Time: event.Updated, Valid: true}
+				syncItem.GCalHash = syncedHash(hash)
+				if err := s.DB.UpdateSyncItem(syncItem); err != nil {
+					s.logError("Error updating sync item: %v\n", err)
+				}
+			} else if changed {
 				log.Printf("Google Calendar event '%s' was updated. Updating YouTrack.", event.Summary)
-				err := s.YouTrackClient.UpdateIssue(syncItem.YTID.String, event.Summary, event.HTMLLink, &event.Start)
+				draft := s.issueDraft(event)
+				if syncItem.EventStart.Valid && event.Start.Equal(syncItem.EventStart.Time) {
+					// The event was not moved, so its start may differ from
+					// the due date, e.g. within WorkingHours.
+					draft.DueDate = nil
+				}
+				editedText := !s.DescriptionSync || !syncItem.DescriptionHash.Valid ||
+					descriptionHash(event.Description) != syncItem.DescriptionHash.String
+				if !editedText {
+					// The event has the description last written from the
+					// issue, so there is no text to copy back.
+					draft.Description = ""
+				}
+				if err := s.runIssueHooks(false, event, draft); err != nil {
+					s.logHookError(event.ID, err)
+					continue
+				}
+				// YouTrack issues cannot do without a summary.
+				var summary, description *string
+				if draft.Summary != "" {
+					summary = &draft.Summary
+				}
+				if editedText || draft.Description != "" {
+					description = &draft.Description
+				}
+				yt := s.managedYouTrack()
+				err := yt.UpdateIssue(syncItem.YTID.String, summary, description, draft.DueDate)
 				if err != nil {
-					log.Printf("Error updating YouTrack task %s: %v\n", syncItem.YTID.String, err)
+					s.logError("Error updating YouTrack task %s: %v\n", syncItem.YTID.String, err)
+				} else if s.DescriptionSync && editedText && yt.wrote(FieldDescription) {
+					syncItem.DescriptionHash = sql.NullString{String: descriptionHash(event.Description), Valid: true}
+				}
+				if err == nil {
+					s.addTags(yt, syncItem.YTID.String, draft.Tags)
+				}
+				if err == nil && yt.wrote(FieldDueDate) {
+					if err := s.checkDependencies(syncItem, draft.DueDate); err != nil {
+						s.logError("Error checking dependencies of YouTrack task %s: %v\n", syncItem.YTID.String, err)
+					}
+				}
+				if err := s.applyResponse(syncItem, event.ResponseStatus); err != nil {
+					s.logError("Error writing attendee response to YouTrack task %s: %v\n", syncItem.YTID.String, err)
+				}
+				if err := s.applyConferenceURL(yt, syncItem.YTID.String, event); err != nil {
+					s.logError("Error writing conference link to YouTrack task %s: %v\n", syncItem.YTID.String, err)
+				}
+				if err := s.applyLocation(yt, syncItem.YTID.String, event.Location); err != nil {
+					s.logError("Error writing location to YouTrack task %s: %v\n", syncItem.YTID.String, err)
 				}
 				syncItem.GCalUpdatedAt = sql.NullTime{Time: event.Updated, Valid: true}
+				syncItem.GCalHash = syncedHash(hash)
+				syncItem.YTWrittenAt = sql.NullTime{Time: s.now(), Valid: true}
 				if err := s.DB.UpdateSyncItem(syncItem); err != nil {
-					log.Printf("Error updating sync item: %v\n", err)
+					s.logError("Error updating sync item: %v\n", err)
 				}
 			}
 		}
@@ -159,53 +850,159 @@ func (s *Synchronizer) processGCalEvents(events []*googlecalendar.Event) error {
 
 func (s *Synchronizer) processYTissues(issues []youtrack.Issue) error {
 	for _, issue := range issues {
+		if err := s.halted(); err != nil {
+			return err
+		}
+		if s.skipsSubtask(issue) {
+			continue
+		}
+
 		syncItem, err := s.DB.GetSyncItemByYTID(issue.ID)
-		if err != nil {
-			log.Printf("Error getting sync item for YouTrack issue %s: %v\n", issue.ID, err)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			s.logError("Error getting sync item for YouTrack issue %s: %v\n", issue.ID, err)
 			continue
 		}
 
-		var dueDate time.Time
-		for _, cf := range issue.CustomFields {
-			if cf.Name == "Due Date" {
-				if val, ok := cf.Value.(float64); ok {
-					dueDate = time.UnixMilli(int64(val))
+		if issue.IsResolved() {
+			if syncItem == nil && !s.IncludeResolved {
+				continue
+			}
+			if syncItem != nil && s.ResolvedAction != ResolvedActionNone {
+				if s.updatedSince(time.UnixMilli(issue.Updated), syncItem.YTUpdatedAt.Time, issueHash(issue), syncItem.YTHash) {
+					if err := s.handleResolvedIssue(issue, syncItem); err != nil {
+						s.logError("Error handling resolved YouTrack issue %s: %v\n", issue.ID, err)
+					}
 				}
+				continue
+			}
+		}
+
+		dueDate := issueDueDate(issue)
+
+		if syncItem == nil && !dueDate.IsZero() && len(s.Siblings) > 0 {
+			if syncItem, err = s.relocate(issue); err != nil {
+				s.logError("Error moving Google Calendar event of YouTrack task %s: %v\n", issue.ID, err)
 			}
 		}
 
+		if syncItem == nil && s.Rollup != nil {
+			continue
+		}
+
 		if syncItem == nil {
-			if !dueDate.IsZero() {
+			if !dueDate.IsZero() && !s.beforeStart(dueDate) {
 				log.Printf("Creating Google Calendar event for new YouTrack task: %s (%s)\n", issue.Summary, issue.ID)
-				description := fmt.Sprintf("YouTrack Issue: %s/issue/%s", s.YouTrackClient.GetBaseURL(), issue.ID)
-				event, err := s.GoogleCalendarClient.CreateEvent(s.CalendarID, issue.Summary, description, dueDate, dueDate.Add(time.Hour))
+				draft, err := s.eventDraft(issue, dueDate)
+				if err != nil {
+					s.logError("Error creating Google Calendar event: %v\n", err)
+					continue
+				}
+				if err := s.runEventHooks(true, &issue, draft); err != nil {
+					s.logHookError(issue.ID, err)
+					continue
+				}
+				pending, err := s.DB.BeginCreate(issueSource(issue.ID))
+				if err != nil {
+					s.logError("Error creating Google Calendar event: %v\n", err)
+					continue
+				}
+				eventID, updatedTime, err := s.createEvent(pending, draft)
 				if err != nil {
-					log.Printf("Error creating Google Calendar event: %v\n", err)
+					s.logError("Error creating Google Calendar event: %v\n", err)
 					continue
 				}
-				updatedTime, _ := time.Parse(time.RFC3339, event.Updated)
-				_, err = s.DB.CreateSyncItem(&SyncItem{
-					GCalID:        sql.NullString{String: event.Id, Valid: true},
-					YTID:          sql.NullString{String: issue.ID, Valid: true},
-					GCalUpdatedAt: sql.NullTime{Time: updatedTime, Valid: true},
-					YTUpdatedAt:   sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true},
-				})
+				item := &SyncItem{
+					GCalID:          sql.NullString{String: eventID, Valid: true},
+					YTID:            sql.NullString{String: issue.ID, Valid: true},
+					YTReadableID:    readableID(issue),
+					GCalUpdatedAt:   sql.NullTime{Time: updatedTime, Valid: true},
+					YTUpdatedAt:     sql.NullTime{Time: time.UnixMilli(issue.Updated), Valid: true},
+					YTHash:          syncedHash(issueHash(issue)),
+					DescriptionHash: sql.NullString{String: descriptionHash(draft.Description), Valid: true},
+					EventStart:      draft.placedStart(),
+				}
+				s.linkEvent(item, issue.ID)
+				if err := s.applyColor(s.calendar(), item, "", draft.ColorID); err != nil {
+					s.logError("Error coloring Google Calendar event %s: %v\n", eventID, err)
+				}
+				if err := s.applyPatch(s.calendar(), item, draft); err != nil {
+					s.logError("Error patching Google Calendar event %s: %v\n", eventID, err)
+				}
+				if err := s.checkConflicts(item, draft); err != nil {
+					s.logError("Error checking meeting conflicts of YouTrack task %s: %v\n", issue.ID, err)
+				}
+				_, err = s.DB.CreateSyncItem(item)
 				if err != nil {
-					log.Printf("Error creating sync item: %v\n", err)
+					s.logError("Error creating sync item: %v\n", err)
+				} else if err := s.DB.FinishCreate(pending.Source); err != nil {
+					s.logError("Error finishing creation of Google Calendar event %s: %v\n", eventID, err)
 				}
 			}
 		} else {
+			if id := readableID(issue); id.Valid && id != syncItem.YTReadableID {
+				// Items linked before readable IDs were kept, and issues
+				// moved to another project, get the current one.
+				syncItem.YTReadableID = id
+				if err := s.DB.UpdateSyncItem(syncItem); err != nil {
+					s.logError("Error updating sync item: %v\n", err)
+					continue
+				}
+			}
 			issueUpdatedTime := time.UnixMilli(issue.Updated)
-			if issueUpdatedTime.After(syncItem.YTUpdatedAt.Time) {
+			issueContent := issueHash(issue)
+			changed := s.updatedSince(issueUpdatedTime, syncItem.YTUpdatedAt.Time, issueContent, syncItem.YTHash)
+			if changed && s.isEcho(issueUpdatedTime, syncItem.YTWrittenAt.Time) {
+				log.Printf("YouTrack task '%s' was updated by the synchronizer's own write. Not updating Google Calendar.", issue.Summary)
+				syncItem.YTUpdatedAt = sql.NullTime{Time: issueUpdatedTime, Valid: true}
+				syncItem.YTHash = syncedHash(issueContent)
+				if err := s.DB.UpdateSyncItem(syncItem); err != nil {
+					s.logError("Error updating sync item: %v\n", err)
+				}
+			} else if changed {
 				log.Printf("YouTrack task '%s' was updated. Updating Google Calendar.", issue.Summary)
-				description := fmt.Sprintf("YouTrack Issue: %s/issue/%s", s.YouTrackClient.GetBaseURL(), issue.ID)
-				_, err := s.GoogleCalendarClient.UpdateEvent(s.CalendarID, syncItem.GCalID.String, issue.Summary, description, dueDate, dueDate.Add(time.Hour))
+				draft, err := s.eventDraft(issue, dueDate)
 				if err != nil {
-					log.Printf("Error updating Google Calendar event %s: %v\n", syncItem.GCalID.String, err)
+					s.logError("Error updating Google Calendar event %s: %v\n", syncItem.GCalID.String, err)
+					continue
+				}
+				if err := s.runEventHooks(false, &issue, draft); err != nil {
+					s.logHookError(issue.ID, err)
+					continue
+				}
+				// Only rewrite the description when the fields it is built from changed.
+				var description, location *string
+				hash := descriptionHash(draft.Description)
+				if !syncItem.DescriptionHash.Valid || syncItem.DescriptionHash.String != hash {
+					description = &draft.Description
+				}
+				if s.LocationField != "" || draft.Location != "" {
+					location = &draft.Location
+				}
+				gc := s.managedCalendar()
+				event, err := gc.UpdateEvent(s.CalendarID, syncItem.GCalID.String, &draft.Summary, description, location, draft.Start, draft.End, draft.AllDay, draft.Visibility, draft.Transparency)
+				if err != nil {
+					s.logError("Error updating Google Calendar event %s: %v\n", syncItem.GCalID.String, err)
+				} else {
+					if err := s.applyColor(gc, syncItem, event.ColorId, draft.ColorID); err != nil {
+						s.logError("Error coloring Google Calendar event %s: %v\n", syncItem.GCalID.String, err)
+					}
+					if err := s.applyPatch(gc, syncItem, draft); err != nil {
+						s.logError("Error patching Google Calendar event %s: %v\n", syncItem.GCalID.String, err)
+					}
 				}
 				syncItem.YTUpdatedAt = sql.NullTime{Time: issueUpdatedTime, Valid: true}
+				syncItem.YTHash = syncedHash(issueContent)
+				if gc.wrote(FieldDescription) {
+					syncItem.DescriptionHash = sql.NullString{String: hash, Valid: true}
+				}
+				if gc.wrote(FieldStart) {
+					syncItem.EventStart = draft.placedStart()
+					if err := s.checkConflicts(syncItem, draft); err != nil {
+						s.logError("Error checking meeting conflicts of YouTrack task %s: %v\n", issue.ID, err)
+					}
+				}
 				if err := s.DB.UpdateSyncItem(syncItem); err != nil {
-					log.Printf("Error updating sync item: %v\n", err)
+					s.logError("Error updating sync item: %v\n", err)
 				}
 			}
 		}
@@ -213,65 +1010,214 @@ func (s *Synchronizer) processYTissues(issues []youtrack.Issue) error {
 	return nil
 }
 
-func (s *Synchronizer) handleDeletions(gcalEvents []*googlecalendar.Event) error {
-	allDbItems, err := s.DB.GetAllSyncItems()
+// issueDueDate returns the Due Date of issue, or the zero time when unset.
+func issueDueDate(issue youtrack.Issue) time.Time {
+	var dueDate time.Time
+	for _, cf := range issue.CustomFields {
+		if cf.Name == "Due Date" {
+			if val, ok := cf.Value.(float64); ok {
+				dueDate = time.UnixMilli(int64(val))
+			}
+		}
+	}
+	return dueDate
+}
+
+// readableID returns the readable ID of issue as kept in SyncItem.YTReadableID.
+func readableID(issue youtrack.Issue) sql.NullString {
+	return sql.NullString{String: issue.IDReadable, Valid: issue.IDReadable != ""}
+}
+
+// beforeStart reports whether t is before StartDate.
+func (s *Synchronizer) beforeStart(t time.Time) bool {
+	return !s.StartDate.IsZero() && t.Before(s.StartDate)
+}
+
+// fewAttendees reports whether event has fewer guests than MinAttendees and
+// is organized by someone else.
+func (s *Synchronizer) fewAttendees(event *googlecalendar.Event) bool {
+	return event.Attendees < s.MinAttendees && !event.OrganizedBySelf
+}
+
+// issueDraft builds the issue fields written for event.
+func (s *Synchronizer) issueDraft(event *googlecalendar.Event) *IssueDraft {
+	dueDate := s.eventDueDate(event)
+	summary, tags := s.Tags.splitSummary(s.EventMarker.strip(event.Summary))
+	draft := &IssueDraft{
+		Summary:     stripSubtaskPrefix(summary),
+		Description: s.issueDescription(event),
+		DueDate:     &dueDate,
+		Tags:        tags,
+	}
+	if s.Response.clearsDueDate(event.ResponseStatus) {
+		draft.DueDate = nil
+	}
+	if issueType := s.issueType(event); issueType != "" {
+		draft.CustomFields = append(draft.CustomFields, youtrack.EnumField("Type", issueType))
+	}
+	return draft
+}
+
+// eventDraft builds the event fields written for issue.
+func (s *Synchronizer) eventDraft(issue youtrack.Issue, dueDate time.Time) (*EventDraft, error) {
+	description, err := s.eventDescription(issue)
 	if err != nil {
-		return fmt.Errorf("failed to get all sync items: %w", err)
+		return nil, err
+	}
+	start, end, allDay := s.eventTimes(dueDate, s.eventDuration(issue))
+	if !allDay && s.WorkingHours != nil {
+		if snapped := s.WorkingHours.snap(start, end.Sub(start)); !snapped.Equal(start) {
+			start, end = snapped, snapped.Add(end.Sub(start))
+			description += deadlineNote(dueDate)
+		}
 	}
+	start, end, note, err := s.placeOnBusinessDay(start, end, dueDate)
+	if err != nil {
+		return nil, err
+	}
+	description += note
+	return &EventDraft{
+		Summary:      s.EventMarker.apply(s.Tags.summary(s.subtaskSummary(issue), issue)),
+		Description:  description,
+		Location:     s.issueLocation(issue),
+		Start:        start,
+		End:          end,
+		AllDay:       allDay,
+		Visibility:   s.EventVisibility,
+		Transparency: s.EventTransparency,
+		ColorID:      s.Tags.color(issue),
+	}, nil
+}
+
+// logHookError reports why a hook stopped an item from being written.
+func (s *Synchronizer) logHookError(id string, err error) {
+	if errors.Is(err, ErrSkip) {
+		log.Printf("Skipping %s: %v\n", id, err)
+		return
+	}
+	s.logError("Error running sync hooks for %s: %v\n", id, err)
+}
 
+func (s *Synchronizer) handleDeletions(gcalEvents []*googlecalendar.Event) error {
+	// Only the items of cancelled or declined events are looked up.
 	gcalEventMap := make(map[string]*googlecalendar.Event)
+	var ids []string
 	for _, event := range gcalEvents {
-		gcalEventMap[event.ID] = event
+		if event.Status == "cancelled" || s.Response.cancels(event.ResponseStatus) {
+			gcalEventMap[event.ID] = event
+			ids = append(ids, event.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
 	}
 
-	for _, item := range allDbItems {
-		if item.GCalID.Valid {
-			event, exists := gcalEventMap[item.GCalID.String]
-			if exists && event.Status == "cancelled" {
-				log.Printf("Google Calendar event %s was cancelled. Deleting sync item and updating YouTrack.", item.GCalID.String)
-				err := s.YouTrackClient.UpdateIssue(item.YTID.String, "", "", nil) // Remove due date
-				if err != nil {
-					log.Printf("Error updating YouTrack issue %s: %v\n", item.YTID.String, err)
-				}
-				if err := s.DB.DeleteSyncItem(item.ID); err != nil {
-					log.Printf("Error deleting sync item %d: %v\n", item.ID, err)
-				}
+	for item, err := range s.DB.SyncItems(SyncItemFilter{GCalIDs: ids}) {
+		if err != nil {
+			return fmt.Errorf("failed to get sync items: %w", err)
+		}
+		if err := s.halted(); err != nil {
+			return err
+		}
+		event := gcalEventMap[item.GCalID.String]
+		if event.Status == "cancelled" {
+			log.Printf("Google Calendar event %s was cancelled. Deleting sync item and updating YouTrack.", item.GCalID.String)
+		} else {
+			log.Printf("Google Calendar event %s was declined. Deleting sync item and updating YouTrack.", item.GCalID.String)
+			if err := s.applyResponse(item, event.ResponseStatus); err != nil {
+				s.logError("Error writing attendee response to YouTrack task %s: %v\n", item.YTID.String, err)
 			}
 		}
+		if err := s.managedYouTrack().UpdateCustomFields(item.YTID.String, []youtrack.CustomFieldWrapper{noDueDate}); err != nil {
+			s.logError("Error removing due date of YouTrack issue %s: %v\n", item.YTID.String, err)
+		}
+		if err := s.DB.DeleteSyncItem(item.ID); err != nil {
+			s.logError("Error deleting sync item %d: %v\n", item.ID, err)
+		}
 	}
 	return nil
 }
 
 func (s *Synchronizer) processYTDeletions(deletedYTIDs []string) error {
 	for _, ytID := range deletedYTIDs {
+		if err := s.halted(); err != nil {
+			return err
+		}
 		syncItem, err := s.DB.GetSyncItemByYTID(ytID)
-		if err != nil {
-			log.Printf("Error getting sync item for YouTrack issue %s: %v\n", ytID, err)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			s.logError("Error getting sync item for YouTrack issue %s: %v\n", ytID, err)
 			continue
 		}
 
 		if syncItem != nil && syncItem.GCalID.Valid {
 			log.Printf("YouTrack issue %s was deleted. Deleting Google Calendar event %s.", ytID, syncItem.GCalID.String)
-			err := s.GoogleCalendarClient.DeleteEvent(s.CalendarID, syncItem.GCalID.String)
+			err := s.calendar().DeleteEvent(s.CalendarID, syncItem.GCalID.String)
 			if err != nil {
-				log.Printf("Error deleting Google Calendar event %s: %v\n", syncItem.GCalID.String, err)
+				s.logError("Error deleting Google Calendar event %s: %v\n", syncItem.GCalID.String, err)
 			}
 			if err := s.DB.DeleteSyncItem(syncItem.ID); err != nil {
-				log.Printf("Error deleting sync item %d: %v\n", syncItem.ID, err)
+				s.logError("Error deleting sync item %d: %v\n", syncItem.ID, err)
 			}
 		}
 	}
 	return nil
 }
 
-// StartSyncLoop starts a periodic synchronization loop.
+// StartSyncLoop starts a periodic synchronization loop. It returns once
+// Stop is called.
 func (s *Synchronizer) StartSyncLoop(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	s.StartScheduledSyncLoop(every(interval))
+}
+
+// Stop ends the sync loop of s, cancels the database queries of a running
+// pass and waits for it to end.
+func (s *Synchronizer) Stop() {
+	s.stopOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+}
+
+// bindDB binds the queries of s to its lifetime, so that Stop cancels them,
+// until the returned function is called. It is called with s.mu held.
+func (s *Synchronizer) bindDB() func() {
+	if s.ctx == nil {
+		return func() {}
+	}
+	db := s.DB
+	s.DB = db.WithContext(s.ctx)
+	return func() { s.DB = db }
+}
 
-	for range ticker.C {
-		if err := s.Sync(); err != nil {
+// Schedule reports when the next synchronization is due.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero time
+	// if there is none.
+	Next(t time.Time) time.Time
+}
+
+// StartScheduledSyncLoop synchronizes at every activation of schedule. It
+// returns when the schedule has no further activations or Stop is called.
+func (s *Synchronizer) StartScheduledSyncLoop(schedule Schedule) {
+	for {
+		next := schedule.Next(s.now())
+		if next.IsZero() {
+			log.Println("Sync schedule has no further activations, stopping")
+			return
+		}
+		if !s.waitUntil(next) {
+			return
+		}
+		s.catchUp(schedule, next)
+		if _, err := s.Sync(); err != nil {
 			log.Printf("Error during synchronization loop: %v\n", err)
+			s.backOff(err)
 		}
 	}
 }
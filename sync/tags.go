@@ -0,0 +1,194 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/youtrack"
+)
+
+// TagSync shows the tags of issues on their events, as hashtags ending the
+// event summary or as the event color, and reads hashtags back into tags.
+type TagSync struct {
+	// Hashtags lists the tags appended to event summaries as "#tag", spaces
+	// in their names becoming underscores. Their hashtags are left out of
+	// issue summaries.
+	Hashtags []string
+	// Colors maps tags to event colors, see ParseTagColors. An event takes
+	// the color of the first tag of its issue that has one.
+	Colors map[string]string
+	// ParseHashtags adds the tags named by the hashtags that end an event
+	// summary to its issue, leaving them out of the issue summary.
+	ParseHashtags bool
+}
+
+// EventColors maps the names of the Google Calendar event colors to their
+// IDs.
+var EventColors = map[string]string{
+	"lavender":  "1",
+	"sage":      "2",
+	"grape":     "3",
+	"flamingo":  "4",
+	"banana":    "5",
+	"tangerine": "6",
+	"peacock":   "7",
+	"graphite":  "8",
+	"blueberry": "9",
+	"basil":     "10",
+	"tomato":    "11",
+}
+
+// ParseTagColors parses semicolon-separated "tag=color" entries, the color
+// being one of EventColors or its ID, e.g. "urgent=tomato;ops=7".
+func ParseTagColors(spec string) (map[string]string, error) {
+	colors := make(map[string]string)
+	for _, part := range strings.Split(spec, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		tag, color, ok := strings.Cut(part, "=")
+		if tag = strings.TrimSpace(tag); !ok || tag == "" {
+			return nil, fmt.Errorf("invalid tag color %q, expected tag=color", part)
+		}
+		color = strings.ToLower(strings.TrimSpace(color))
+		if id, ok := EventColors[color]; ok {
+			color = id
+		} else if n, err := strconv.Atoi(color); err != nil || n < 1 || n > len(EventColors) {
+			return nil, fmt.Errorf("invalid color %q for tag %q, expected a color name or 1 to %d", color, tag, len(EventColors))
+		}
+		colors[tag] = color
+	}
+	return colors, nil
+}
+
+// hashtagPattern matches a hashtag that may name a tag; numbers such as
+// "#12" are left to the summary.
+var hashtagPattern = regexp.MustCompile(`^#[\p{L}_][\p{L}\p{N}_-]*$`)
+
+// hashtag returns the hashtag of the tag name.
+func hashtag(name string) string {
+	return "#" + strings.ReplaceAll(name, " ", "_")
+}
+
+// summary appends the hashtags of the tags of issue listed in Hashtags to
+// summary.
+func (t TagSync) summary(summary string, issue youtrack.Issue) string {
+	for _, name := range issue.TagNames() {
+		if t.listed(name) {
+			summary += " " + hashtag(name)
+		}
+	}
+	return summary
+}
+
+// listed reports whether the tag name is one of Hashtags.
+func (t TagSync) listed(name string) bool {
+	for _, listed := range t.Hashtags {
+		if strings.EqualFold(listed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSummary removes the hashtags of tags that end summary and, with
+// ParseHashtags, returns the tags they name. A summary of hashtags only is
+// kept whole.
+func (t TagSync) splitSummary(summary string) (string, []string) {
+	var tags []string
+	for {
+		rest, word := cutLastWord(summary)
+		if rest == "" || !hashtagPattern.MatchString(word) {
+			break
+		}
+		name := t.tagName(word)
+		if !t.ParseHashtags && !t.listed(name) {
+			break
+		}
+		tags = append([]string{name}, tags...)
+		summary = rest
+	}
+	if !t.ParseHashtags {
+		return summary, nil
+	}
+	return summary, tags
+}
+
+// cutLastWord splits the last space-separated word off s.
+func cutLastWord(s string) (rest, word string) {
+	s = strings.TrimRight(s, " ")
+	i := strings.LastIndex(s, " ")
+	if i < 0 {
+		return "", s
+	}
+	return strings.TrimRight(s[:i], " "), s[i+1:]
+}
+
+// tagName returns the tag named by a hashtag: the tag of Hashtags or Colors
+// it is the hashtag of, or else its text with underscores as spaces.
+func (t TagSync) tagName(tag string) string {
+	for _, name := range t.Hashtags {
+		if strings.EqualFold(hashtag(name), tag) {
+			return name
+		}
+	}
+	for name := range t.Colors {
+		if strings.EqualFold(hashtag(name), tag) {
+			return name
+		}
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(tag, "#"), "_", " ")
+}
+
+// color returns the color of the first tag of issue that has one, or empty.
+func (t TagSync) color(issue youtrack.Issue) string {
+	for _, name := range issue.TagNames() {
+		for tag, color := range t.Colors {
+			if strings.EqualFold(tag, name) {
+				return color
+			}
+		}
+	}
+	return ""
+}
+
+// isTagColor reports whether colorID is the color of a tag.
+func (t TagSync) isTagColor(colorID string) bool {
+	for _, color := range t.Colors {
+		if color == colorID {
+			return true
+		}
+	}
+	return false
+}
+
+// applyColor gives the event of item the color colorID, unless it has it
+// already. Without a tag color the event is reset to the color of its
+// calendar, unless its color was chosen by hand. The event changes, so its
+// update time is taken over into item, unless gc dropped the write.
+func (s *Synchronizer) applyColor(gc GCalClient, item *SyncItem, current, colorID string) error {
+	if colorID == current || colorID == "" && !s.Tags.isTagColor(current) {
+		return nil
+	}
+	event, err := gc.SetColor(s.CalendarID, item.GCalID.String, colorID)
+	if err != nil || event == nil {
+		return err
+	}
+	if updated, err := time.Parse(time.RFC3339, event.Updated); err == nil {
+		item.GCalUpdatedAt = sql.NullTime{Time: updated, Valid: true}
+	}
+	return nil
+}
+
+// addTags adds tags to the issue issueID through yt.
+func (s *Synchronizer) addTags(yt YTClient, issueID string, tags []string) {
+	for _, tag := range tags {
+		if err := yt.AddTag(issueID, tag); err != nil {
+			s.logError("Error tagging YouTrack task %s with %q: %v\n", issueID, tag, err)
+		}
+	}
+}
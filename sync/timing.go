@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/youtrack"
+)
+
+// EventTiming determines whether events written from issues are all-day or
+// timed.
+type EventTiming string
+
+const (
+	// EventTimingAllDay writes all-day events on the due date.
+	EventTimingAllDay EventTiming = "allday"
+	// EventTimingTimed writes events starting at EventTime on the due date
+	// and lasting EventDuration.
+	EventTimingTimed EventTiming = "timed"
+	// EventTimingAuto writes all-day events for due dates without a time of
+	// day, i.e. at midnight, and events starting at the due time otherwise.
+	EventTimingAuto EventTiming = "auto"
+)
+
+// DueDateBoundary determines which end of an event written to YouTrack
+// becomes the due date.
+type DueDateBoundary string
+
+const (
+	// DueDateStart writes the start of the event as the due date.
+	DueDateStart DueDateBoundary = "start"
+	// DueDateEnd writes the end of the event as the due date, i.e. the last
+	// day of an all-day event, and places timed events written from issues
+	// so that they end at the due time.
+	DueDateEnd DueDateBoundary = "end"
+)
+
+// Defaults of EventTime and EventDuration.
+const (
+	DefaultEventTime     = 9 * time.Hour
+	DefaultEventDuration = time.Hour
+)
+
+// ParseEventTiming parses an EventTiming. An empty value yields
+// EventTimingAllDay.
+func ParseEventTiming(value string) (EventTiming, error) {
+	switch timing := EventTiming(strings.ToLower(strings.TrimSpace(value))); timing {
+	case "":
+		return EventTimingAllDay, nil
+	case EventTimingAllDay, EventTimingTimed, EventTimingAuto:
+		return timing, nil
+	default:
+		return "", fmt.Errorf("unknown event timing %q", value)
+	}
+}
+
+// ParseDueDateBoundary parses a DueDateBoundary. An empty value yields
+// DueDateStart.
+func ParseDueDateBoundary(value string) (DueDateBoundary, error) {
+	switch boundary := DueDateBoundary(strings.ToLower(strings.TrimSpace(value))); boundary {
+	case "":
+		return DueDateStart, nil
+	case DueDateStart, DueDateEnd:
+		return boundary, nil
+	default:
+		return "", fmt.Errorf("unknown due date boundary %q", value)
+	}
+}
+
+// ParseTimeOfDay parses a local time of day such as 09:00 into the time
+// since midnight. An empty value yields DefaultEventTime.
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultEventTime, nil
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("expected a time of day such as 09:00, got %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseEventDurations parses semicolon-separated "value=duration" entries
+// mapping the values of an issue field to event durations, e.g.
+// "Critical=2h;Minor=30m". Values are matched regardless of case.
+func ParseEventDurations(spec string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, part := range strings.Split(spec, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		value, duration, ok := strings.Cut(part, "=")
+		if value = strings.TrimSpace(value); !ok || value == "" {
+			return nil, fmt.Errorf("invalid event duration %q, expected value=duration", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid event duration %q for %q, expected a positive duration such as 2h", strings.TrimSpace(duration), value)
+		}
+		durations[strings.ToLower(value)] = d
+	}
+	return durations, nil
+}
+
+// eventDuration returns how long the timed event of issue lasts: the
+// duration of its priority in PriorityDurations, else of its type in
+// TypeDurations, else EventDuration.
+func (s *Synchronizer) eventDuration(issue youtrack.Issue) time.Duration {
+	for _, by := range []struct {
+		field     string
+		durations map[string]time.Duration
+	}{{"Priority", s.PriorityDurations}, {"Type", s.TypeDurations}} {
+		if d, ok := by.durations[strings.ToLower(issue.CustomFieldValue(by.field))]; ok {
+			return d
+		}
+	}
+	if s.EventDuration <= 0 {
+		return DefaultEventDuration
+	}
+	return s.EventDuration
+}
+
+// eventTimes returns the start and end of the event of an issue due at
+// dueDate lasting duration, when timed, and whether it is an all-day event.
+func (s *Synchronizer) eventTimes(dueDate time.Time, duration time.Duration) (start, end time.Time, allDay bool) {
+	switch {
+	case s.EventTiming == EventTimingTimed:
+		year, month, day := dueDate.Date()
+		start = time.Date(year, month, day, 0, 0, 0, 0, dueDate.Location()).Add(s.EventTime)
+		return start, start.Add(duration), false
+	case s.EventTiming == EventTimingAuto && !isMidnight(dueDate):
+		if s.DueDateBoundary == DueDateEnd {
+			return dueDate.Add(-duration), dueDate, false
+		}
+		return dueDate, dueDate.Add(duration), false
+	default:
+		// A date-only due date written from an all-day event falls at
+		// midnight UTC, which is the previous day west of UTC.
+		if h, m, sec := dueDate.Clock(); (h != 0 || m != 0 || sec != 0) && isMidnight(dueDate) {
+			dueDate = dueDate.UTC()
+		}
+		return dueDate, dueDate.Add(time.Hour), true
+	}
+}
+
+// eventDueDate returns the due date written for event: the start or, with
+// DueDateEnd, the end of a timed event, or midnight UTC of the first or last
+// day of an all-day event.
+func (s *Synchronizer) eventDueDate(event *googlecalendar.Event) time.Time {
+	boundary := event.Start
+	if s.DueDateBoundary == DueDateEnd && !event.End.IsZero() {
+		boundary = event.End
+		if event.AllDay && event.End.After(event.Start) {
+			// The end of an all-day event is the day after its last.
+			boundary = event.End.AddDate(0, 0, -1)
+		}
+	}
+	if !event.AllDay {
+		return boundary
+	}
+	year, month, day := boundary.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// isMidnight reports whether t has no time of day, locally or in UTC, where
+// all-day events and date-only due dates fall.
+func isMidnight(t time.Time) bool {
+	for _, t := range []time.Time{t, t.UTC()} {
+		if hour, minute, second := t.Clock(); hour == 0 && minute == 0 && second == 0 {
+			return true
+		}
+	}
+	return false
+}
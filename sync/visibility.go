@@ -0,0 +1,34 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseVisibility parses the Google visibility of events written from
+// issues: default, public, private or confidential. An empty value yields
+// "", leaving the calendar default.
+func ParseVisibility(value string) (string, error) {
+	switch visibility := strings.ToLower(strings.TrimSpace(value)); visibility {
+	case "", "default", "public", "private", "confidential":
+		return visibility, nil
+	default:
+		return "", fmt.Errorf("unknown event visibility %q", value)
+	}
+}
+
+// ParseTransparency parses whether events written from issues block time:
+// busy (or Google's opaque) or free (transparent). An empty value yields "",
+// leaving the calendar default.
+func ParseTransparency(value string) (string, error) {
+	switch transparency := strings.ToLower(strings.TrimSpace(value)); transparency {
+	case "":
+		return "", nil
+	case "busy", "opaque":
+		return "opaque", nil
+	case "free", "transparent":
+		return "transparent", nil
+	default:
+		return "", fmt.Errorf("unknown event transparency %q", value)
+	}
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WorkingHours confines timed events written from issues to the working
+// day. Only the events move: the due dates of their issues are unchanged.
+type WorkingHours struct {
+	// Start and End are the local times of day, since midnight, between
+	// which events are placed.
+	Start time.Duration
+	End   time.Duration
+	// SkipWeekends moves events from Saturday and Sunday to the end of the
+	// Friday before.
+	SkipWeekends bool
+}
+
+// ParseWorkingHours parses working hours such as 09:00-17:00. An empty
+// value yields nil, leaving events where their due date puts them.
+func ParseWorkingHours(value string) (*WorkingHours, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("expected working hours such as 09:00-17:00, got %q", value)
+	}
+	start, err := ParseTimeOfDay(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := ParseTimeOfDay(to)
+	if err != nil {
+		return nil, err
+	}
+	if end <= start {
+		return nil, fmt.Errorf("working hours %q end before they start", value)
+	}
+	return &WorkingHours{Start: start, End: end}, nil
+}
+
+// snap returns the start of an event lasting duration that begins at start,
+// moved into the working hours: events outside them are moved to their
+// beginning or, so that they end in time, their end.
+func (w *WorkingHours) snap(start time.Time, duration time.Duration) time.Time {
+	year, month, day := start.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, start.Location())
+	offset := start.Sub(midnight)
+
+	if w.SkipWeekends {
+		for midnight.Weekday() == time.Saturday || midnight.Weekday() == time.Sunday {
+			midnight = midnight.AddDate(0, 0, -1)
+			offset = w.End
+		}
+	}
+	if offset+duration > w.End {
+		offset = w.End - duration
+	}
+	if offset < w.Start {
+		offset = w.Start
+	}
+	return midnight.Add(offset)
+}
+
+// deadlineNote marks the description of an event that was moved into the
+// working hours, telling when the issue is actually due.
+func deadlineNote(dueDate time.Time) string {
+	return fmt.Sprintf("<br><i>Deadline: due %s, shown within working hours.</i>", dueDate.Format("Mon Jan 2 2006 15:04"))
+}
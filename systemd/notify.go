@@ -0,0 +1,57 @@
+// Package systemd implements the sd_notify protocol used by Type=notify
+// services and the service watchdog.
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notification states understood by systemd.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Enabled reports whether the process was started with a notification socket.
+func Enabled() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+// Notify sends state, e.g. Ready or "STATUS=...", to the service manager. It
+// is a no-op when the process is not running under systemd.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading "@" denotes an abstract socket, which the net package maps.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Status formats a STATUS= notification.
+func Status(text string) string {
+	return "STATUS=" + text
+}
+
+// WatchdogInterval returns the watchdog timeout configured with WatchdogSec=,
+// or zero when the watchdog is disabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,62 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() error = %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	if err := Notify(Status("Last sync ok")); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got := string(buf[:n]); got != "STATUS=Last sync ok" {
+		t.Errorf("expected 'STATUS=Last sync ok', got '%s'", got)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if Enabled() {
+		t.Error("expected notifications to be disabled")
+	}
+	if err := Notify(Ready); err != nil {
+		t.Errorf("Notify() error = %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if got := WatchdogInterval(); got != 30*time.Second {
+		t.Errorf("expected 30s, got %s", got)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if got := WatchdogInterval(); got != 0 {
+		t.Errorf("expected watchdog of another process to be ignored, got %s", got)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "")
+	t.Setenv("WATCHDOG_PID", "")
+	if got := WatchdogInterval(); got != 0 {
+		t.Errorf("expected disabled watchdog, got %s", got)
+	}
+}
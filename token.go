@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/oauth2"
+
+	"youtrack-calendar-sync/config"
+	"youtrack-calendar-sync/googlecalendar"
+	"youtrack-calendar-sync/sync"
+)
+
+// googleTokenName identifies the token of a Google account in remote state.
+func googleTokenName(account string) string {
+	if account == "" {
+		return "google"
+	}
+	return "google-" + account
+}
+
+// googleToken returns the OAuth token of a Google account from the
+// environment, from remote state when db is not nil, or from tokenFile, in
+// that order. When none is stored yet it runs the web flow and stores the
+// result where it will be looked up.
+//
+// Replayed requests never reach Google, so a placeholder token is used and
+// no credentials are needed.
+func googleToken(ctx context.Context, gcalConfig *oauth2.Config, cfg *config.Config, account string, db *sync.DB, tokenFile string) (*oauth2.Token, error) {
+	token, err := storedGoogleToken(cfg, account, db, tokenFile)
+	if err != nil || token != nil {
+		return token, err
+	}
+
+	if account != "" {
+		log.Printf("Authorize the Google account for %q", account)
+	}
+	if cfg.GoogleAuthFlow == "device" {
+		token, err = googlecalendar.GetTokenFromDevice(ctx, gcalConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error getting Google Calendar token from device: %w", err)
+		}
+	} else {
+		token, err = googlecalendar.GetTokenFromWeb(ctx, gcalConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error getting Google Calendar token from web: %w", err)
+		}
+	}
+	return token, saveGoogleToken(account, db, tokenFile, token)
+}
+
+// storedGoogleToken is googleToken without the web flow: it returns nil
+// when no token of account is stored.
+func storedGoogleToken(cfg *config.Config, account string, db *sync.DB, tokenFile string) (*oauth2.Token, error) {
+	if cfg.HTTPReplayDir != "" {
+		return &oauth2.Token{AccessToken: "replay", TokenType: "Bearer"}, nil
+	}
+	if value, ok := cfg.GoogleTokens[account]; ok {
+		token := &oauth2.Token{}
+		if err := json.Unmarshal([]byte(value), token); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", config.AccountTokenEnv(account), err)
+		}
+		return token, nil
+	}
+
+	if db != nil {
+		stored, err := db.GetToken(googleTokenName(account))
+		if err != nil {
+			return nil, fmt.Errorf("error loading Google Calendar token: %w", err)
+		}
+		if stored == "" {
+			return nil, nil
+		}
+		token := &oauth2.Token{}
+		if err := json.Unmarshal([]byte(stored), token); err != nil {
+			return nil, fmt.Errorf("error loading Google Calendar token: %w", err)
+		}
+		return token, nil
+	}
+
+	if _, err := os.Stat(tokenFile); os.IsNotExist(err) {
+		return nil, nil
+	}
+	token, err := googlecalendar.LoadToken(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading Google Calendar token: %w", err)
+	}
+	return token, nil
+}
+
+// saveGoogleToken stores the token of a Google account in remote state when
+// db is not nil, or in tokenFile.
+func saveGoogleToken(account string, db *sync.DB, tokenFile string, token *oauth2.Token) error {
+	if db == nil {
+		if err := googlecalendar.SaveToken(tokenFile, token); err != nil {
+			return fmt.Errorf("error saving Google Calendar token: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := db.SetToken(googleTokenName(account), string(data)); err != nil {
+		return fmt.Errorf("error saving Google Calendar token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// startTracing sets up the global tracer provider to export the spans of API
+// requests over OTLP/HTTP. The exporter reads the endpoint, headers and
+// protocol options from the standard OTEL_EXPORTER_OTLP_* variables, and the
+// service name from OTEL_SERVICE_NAME. The returned function flushes the
+// spans that are not exported yet.
+func startTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
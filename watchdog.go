@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"youtrack-calendar-sync/sync"
+	"youtrack-calendar-sync/systemd"
+)
+
+// statusInterval is how often STATUS= is refreshed when the watchdog is off.
+const statusInterval = time.Minute
+
+// startWatchdog reports the last sync to systemd and, when WatchdogSec= is
+// set, sends heartbeats. LastResult waits for an in-flight sync, so a hung
+// sync stops the heartbeats and systemd restarts the service. mappings
+// returns the running mappings, which change with the admin API.
+func startWatchdog(mappings func() []*mapping) {
+	if !systemd.Enabled() {
+		return
+	}
+	interval := systemd.WatchdogInterval() / 2
+	watchdog := interval > 0
+	if !watchdog {
+		interval = statusInterval
+	}
+
+	go func() {
+		for {
+			states := systemd.Status(mappingsStatus(mappings()))
+			if watchdog {
+				states += "\n" + systemd.Watchdog
+			}
+			if err := systemd.Notify(states); err != nil {
+				log.Printf("Error notifying systemd: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// mappingsStatus describes the last sync of every mapping.
+func mappingsStatus(mappings []*mapping) string {
+	if len(mappings) == 1 {
+		return mappingStatus(mappings[0])
+	}
+	statuses := make([]string, len(mappings))
+	for i, m := range mappings {
+		statuses[i] = m.label() + ": " + mappingStatus(m)
+	}
+	return strings.Join(statuses, "; ")
+}
+
+// mappingStatus describes the last sync of m, or that it is paused until
+// its Google account is authorized again, and any excessive drift.
+func mappingStatus(m *mapping) string {
+	if m.synchronizer.AuthError() != nil {
+		return "Paused, Google re-authorization required"
+	}
+	status := syncStatus(m.synchronizer.LastResult())
+	if pause, err := m.synchronizer.PauseState(); err == nil && pause.Paused {
+		status = fmt.Sprintf("Paused, %d planned changes; %s", pause.PlannedChanges, status)
+	}
+	if metrics, drifting := m.synchronizer.Drifting(); drifting {
+		status += fmt.Sprintf(", %d broken links, run doctor", metrics.Drift())
+	}
+	return status
+}
+
+// syncStatus describes a sync result for the STATUS= line.
+func syncStatus(result sync.RunResult) string {
+	if result.Started.IsZero() {
+		return "Waiting for the first synchronization"
+	}
+	return fmt.Sprintf("Last sync %s, took %s, %d failed items",
+		result.Started.Format(time.RFC3339), result.Duration.Round(time.Millisecond), len(result.Errors))
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GooglePath is the endpoint Google posts the notifications of push
+// channels to.
+const GooglePath = "/hooks/google"
+
+// ChannelSyncer syncs the changes Google announces through its push
+// notification channel.
+type ChannelSyncer interface {
+	// PushNotification reports whether channelID and token identify the
+	// channel of the syncer, which then handles the notification.
+	PushNotification(channelID, token, state string) bool
+}
+
+// GoogleHandler routes push notifications to the synchronizer owning the
+// channel, authenticated by the token Google sends back with each of them.
+type GoogleHandler struct {
+	Syncers []ChannelSyncer
+}
+
+// ServeHTTP handles POST /hooks/google. Notifications carry no body, only
+// X-Goog-* headers. Those of unknown channels get 404.
+func (h *GoogleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	channelID := r.Header.Get("X-Goog-Channel-ID")
+	token := r.Header.Get("X-Goog-Channel-Token")
+	state := r.Header.Get("X-Goog-Resource-State")
+	for _, syncer := range h.Syncers {
+		if syncer.PushNotification(channelID, token, state) {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+	http.Error(w, "unknown channel", http.StatusNotFound)
+}
+
+// URL returns the URL of the endpoint path of the webhook server reachable
+// at baseURL, which may end with the path already.
+func URL(baseURL, path string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("expected the http or https URL of the webhook server, got %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), path) + path
+	return u.String(), nil
+}
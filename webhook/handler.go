@@ -0,0 +1,190 @@
+// Package webhook receives change notifications from YouTrack workflows and
+// triggers targeted synchronization of the affected issue.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	gosync "sync"
+
+	"youtrack-calendar-sync/sync"
+)
+
+// Path is the endpoint YouTrack workflows post issue changes to.
+const Path = "/hooks/youtrack"
+
+// SignatureHeader carries the hex-encoded HMAC-SHA256 of the request body,
+// keyed with the shared secret and prefixed with "sha256=".
+const SignatureHeader = "X-YouTrack-Signature"
+
+// maxBodySize bounds the notification payload.
+const maxBodySize = 1 << 20
+
+// maxConcurrentSyncs bounds the issue syncs started by notifications that
+// run at once.
+const maxConcurrentSyncs = 4
+
+// Payload is the JSON body of a notification.
+type Payload struct {
+	// Project is the short name of the issue's project, used for routing.
+	Project string `json:"project"`
+	// IssueID is the readable or database ID of the changed issue.
+	IssueID string `json:"issueId"`
+}
+
+// IssueSyncer reconciles a single issue.
+type IssueSyncer interface {
+	SyncIssue(issueID string) error
+}
+
+// APITokens checks the scopes of API tokens.
+type APITokens interface {
+	APITokenHasScope(token string, scope sync.Scope) (bool, error)
+}
+
+// Handler verifies notifications and routes them to the synchronizers
+// responsible for the issue's project.
+type Handler struct {
+	Secret   []byte
+	Projects map[string][]IssueSyncer
+	// APITokens, if set, also accepts unsigned notifications carrying an
+	// API token with the trigger-sync scope as "Authorization: Bearer".
+	APITokens APITokens
+
+	// slots holds a value for each running sync.
+	slots chan struct{}
+	mu    gosync.Mutex
+	// pending holds the issue syncs started and not finished, true when
+	// another notification arrived meanwhile.
+	pending map[pendingSync]bool
+}
+
+// pendingSync is the sync of an issue by the index-th syncer of project.
+type pendingSync struct {
+	project string
+	index   int
+	issueID string
+}
+
+// NewHandler creates a Handler with no registered projects.
+func NewHandler(secret string) *Handler {
+	return &Handler{
+		Secret:   []byte(secret),
+		Projects: make(map[string][]IssueSyncer),
+		slots:    make(chan struct{}, maxConcurrentSyncs),
+		pending:  make(map[pendingSync]bool),
+	}
+}
+
+// Register routes notifications for project to syncer. A project may be
+// registered by several syncers, which are all notified.
+func (h *Handler) Register(project string, syncer IssueSyncer) {
+	h.Projects[project] = append(h.Projects[project], syncer)
+}
+
+// ServeHTTP handles POST /hooks/youtrack. The sync itself runs in the
+// background so the calling workflow is not held up.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if !h.validSignature(body, r.Header.Get(SignatureHeader)) && !h.validToken(r) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.IssueID == "" {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	syncers, ok := h.Projects[payload.Project]
+	if !ok {
+		http.Error(w, "unknown project", http.StatusNotFound)
+		return
+	}
+
+	for i, syncer := range syncers {
+		h.startSync(pendingSync{project: payload.Project, index: i, issueID: payload.IssueID}, syncer)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startSync runs the sync of p with syncer in the background. Notifications
+// arriving while it waits or runs are coalesced into a single sync after it.
+func (h *Handler) startSync(p pendingSync, syncer IssueSyncer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, started := h.pending[p]; started {
+		h.pending[p] = true
+		return
+	}
+	h.pending[p] = false
+	go func() {
+		for {
+			h.slots <- struct{}{}
+			err := syncer.SyncIssue(p.issueID)
+			<-h.slots
+			if err != nil {
+				log.Printf("Error syncing YouTrack issue %s from webhook: %v\n", p.issueID, err)
+			}
+			h.mu.Lock()
+			again := h.pending[p]
+			if again {
+				h.pending[p] = false
+			} else {
+				delete(h.pending, p)
+			}
+			h.mu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// validSignature reports whether signature is the HMAC of body under the secret.
+func (h *Handler) validSignature(body []byte, signature string) bool {
+	if len(h.Secret) == 0 {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, Sign(h.Secret, body))
+}
+
+// validToken reports whether r carries an API token allowed to trigger syncs.
+func (h *Handler) validToken(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if h.APITokens == nil || token == "" {
+		return false
+	}
+	ok, err := h.APITokens.APITokenHasScope(token, sync.ScopeTriggerSync)
+	if err != nil {
+		log.Printf("Error checking API token: %v\n", err)
+	}
+	return ok
+}
+
+// Sign returns the HMAC-SHA256 of body keyed with secret.
+func Sign(secret, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"youtrack-calendar-sync/sync"
+)
+
+type fakeSyncer chan string
+
+func (f fakeSyncer) SyncIssue(issueID string) error {
+	f <- issueID
+	return nil
+}
+
+func newRequest(body, signature string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, Path, bytes.NewBufferString(body))
+	req.Header.Set(SignatureHeader, signature)
+	return req
+}
+
+func TestHandler_RoutesSignedNotification(t *testing.T) {
+	synced := make(fakeSyncer, 1)
+	h := NewHandler("secret")
+	h.Register("PRJ", synced)
+
+	body := `{"project":"PRJ","issueId":"PRJ-12"}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest(body, "sha256="+hex.EncodeToString(Sign([]byte("secret"), []byte(body)))))
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	if issueID := <-synced; issueID != "PRJ-12" {
+		t.Errorf("Expected PRJ-12 to be synced, got %q", issueID)
+	}
+}
+
+func TestHandler_CoalescesNotifications(t *testing.T) {
+	synced := make(fakeSyncer)
+	h := NewHandler("secret")
+	h.Register("PRJ", synced)
+
+	body := `{"project":"PRJ","issueId":"PRJ-12"}`
+	signature := "sha256=" + hex.EncodeToString(Sign([]byte("secret"), []byte(body)))
+	// The first sync blocks on synced while the others arrive.
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRequest(body, signature))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-synced:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected sync %d to run", i+1)
+		}
+	}
+	select {
+	case <-synced:
+		t.Error("Expected the notifications made during a sync to be coalesced into one")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHandler_RejectsBadSignature(t *testing.T) {
+	h := NewHandler("secret")
+	h.Register("PRJ", make(fakeSyncer, 1))
+
+	body := `{"project":"PRJ","issueId":"PRJ-12"}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest(body, "sha256="+hex.EncodeToString(Sign([]byte("other"), []byte(body)))))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+type fakeAPITokens map[string]sync.Scope
+
+func (f fakeAPITokens) APITokenHasScope(token string, scope sync.Scope) (bool, error) {
+	return f[token] == scope, nil
+}
+
+func TestHandler_AcceptsAPIToken(t *testing.T) {
+	synced := make(fakeSyncer, 1)
+	h := NewHandler("secret")
+	h.APITokens = fakeAPITokens{"trigger": sync.ScopeTriggerSync, "reader": sync.ScopeReadStatus}
+	h.Register("PRJ", synced)
+
+	body := `{"project":"PRJ","issueId":"PRJ-12"}`
+	for token, want := range map[string]int{"reader": http.StatusUnauthorized, "trigger": http.StatusAccepted} {
+		req := newRequest(body, "")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Expected status %d with token %s, got %d", want, token, rec.Code)
+		}
+	}
+	if issueID := <-synced; issueID != "PRJ-12" {
+		t.Errorf("Expected PRJ-12 to be synced, got %q", issueID)
+	}
+}
+
+func TestHandler_UnknownProject(t *testing.T) {
+	h := NewHandler("secret")
+
+	body := `{"project":"OTHER","issueId":"OTHER-1"}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest(body, "sha256="+hex.EncodeToString(Sign([]byte("secret"), []byte(body)))))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestWriteWorkflow(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteWorkflow(&buf, "https://sync.example.com/base/", `se"cret`); err != nil {
+		t.Fatalf("WriteWorkflow() error = %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Expected a ZIP archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		files[f.Name] = string(data)
+	}
+	if !strings.Contains(files[WorkflowName+"/package.json"], `"name": "youtrack-calendar-sync"`) {
+		t.Errorf("Unexpected manifest %q", files[WorkflowName+"/package.json"])
+	}
+	script := files[WorkflowName+"/sync-changes.js"]
+	for _, want := range []string{`const ENDPOINT = "https://sync.example.com/base/hooks/youtrack";`, `const SECRET = "se\"cret";`, `"X-YouTrack-Signature"`} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected the script to contain %s", want)
+		}
+	}
+
+	// The script signs like Sign.
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "workflow.js"), []byte(script), 0600)
+	os.WriteFile(filepath.Join(dir, "sign.js"), []byte(`
+const Module = require('module');
+const load = Module.prototype.require;
+Module.prototype.require = function (name) {
+  return name.startsWith('@jetbrains/') ? {Issue: {onChange: (rule) => rule}} : load.apply(this, arguments);
+};
+process.stdout.write(require('./workflow.js').hmacSha256('se"cret', '{"project":"PRJ","issueId":"PRJ-12"}'));
+`), 0600)
+	out, err := exec.Command(node, filepath.Join(dir, "sign.js")).Output()
+	if err != nil {
+		t.Fatalf("Failed to run the script: %v", err)
+	}
+	if want := hex.EncodeToString(Sign([]byte(`se"cret`), []byte(`{"project":"PRJ","issueId":"PRJ-12"}`))); string(out) != want {
+		t.Errorf("Script signature = %s, want %s", out, want)
+	}
+}
+
+func TestWriteWorkflow_RejectsBadURLs(t *testing.T) {
+	for _, baseURL := range []string{"", "sync.example.com", "ftp://sync.example.com"} {
+		if err := WriteWorkflow(io.Discard, baseURL, "secret"); err == nil {
+			t.Errorf("WriteWorkflow(%q) succeeded, want an error", baseURL)
+		}
+	}
+}
+
+type channelSyncer struct {
+	id, token string
+	states    []string
+}
+
+func (c *channelSyncer) PushNotification(channelID, token, state string) bool {
+	if channelID != c.id || token != c.token {
+		return false
+	}
+	c.states = append(c.states, state)
+	return true
+}
+
+func TestGoogleHandler_RoutesByChannel(t *testing.T) {
+	a, b := &channelSyncer{id: "a", token: "ta"}, &channelSyncer{id: "b", token: "tb"}
+	h := &GoogleHandler{Syncers: []ChannelSyncer{a, b}}
+	notify := func(channelID, token string) int {
+		req := httptest.NewRequest(http.MethodPost, GooglePath, nil)
+		req.Header.Set("X-Goog-Channel-ID", channelID)
+		req.Header.Set("X-Goog-Channel-Token", token)
+		req.Header.Set("X-Goog-Resource-State", "exists")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := notify("b", "tb"); code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", code)
+	}
+	if code := notify("b", "ta"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the wrong token, got %d", code)
+	}
+	if len(a.states) != 0 || len(b.states) != 1 || b.states[0] != "exists" {
+		t.Errorf("Unexpected notifications %v %v", a.states, b.states)
+	}
+}
+
+func TestURL_AppendsPath(t *testing.T) {
+	for _, baseURL := range []string{"https://sync.example.com", "https://sync.example.com/", "https://sync.example.com/hooks/google"} {
+		if got, err := URL(baseURL, GooglePath); err != nil || got != "https://sync.example.com/hooks/google" {
+			t.Errorf("URL(%q) = %q, %v", baseURL, got, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// WorkflowName is the name of the YouTrack workflow written by
+// WriteWorkflow, and of its directory in the package.
+const WorkflowName = "youtrack-calendar-sync"
+
+// workflowScript is an on-change rule posting the changed issue to the
+// webhook, signed like Sign. YouTrack workflows have no crypto module, so
+// the script brings its own HMAC-SHA256.
+var workflowScript = template.Must(template.New("workflow").Parse(`// Notifies youtrack-calendar-sync of issue changes, so that they reach
+// Google Calendar without waiting for the next periodic pass.
+// Generated by "youtrack-calendar-sync workflow"; regenerate it to change
+// the endpoint or the secret.
+const entities = require('@jetbrains/youtrack-scripting-api/entities');
+const http = require('@jetbrains/youtrack-scripting-api/http');
+
+const ENDPOINT = {{.Endpoint}};
+const SECRET = {{.Secret}};
+
+const K = [
+  0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+  0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+  0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+  0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+  0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+  0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+  0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+  0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2
+];
+
+function utf8(text) {
+  const bytes = [];
+  const encoded = unescape(encodeURIComponent(text));
+  for (let i = 0; i < encoded.length; i++) {
+    bytes.push(encoded.charCodeAt(i));
+  }
+  return bytes;
+}
+
+function sha256(bytes) {
+  const h = [0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19];
+  const length = bytes.length;
+  const data = bytes.concat([0x80]);
+  while (data.length % 64 !== 56) {
+    data.push(0);
+  }
+  const bits = length * 8;
+  data.push(0, 0, 0, Math.floor(bits / 0x100000000) & 0xff, (bits >>> 24) & 0xff, (bits >>> 16) & 0xff, (bits >>> 8) & 0xff, bits & 0xff);
+  const w = new Array(64);
+  for (let offset = 0; offset < data.length; offset += 64) {
+    for (let i = 0; i < 16; i++) {
+      const j = offset + i * 4;
+      w[i] = (data[j] << 24) | (data[j + 1] << 16) | (data[j + 2] << 8) | data[j + 3];
+    }
+    for (let i = 16; i < 64; i++) {
+      const s0 = ror(w[i - 15], 7) ^ ror(w[i - 15], 18) ^ (w[i - 15] >>> 3);
+      const s1 = ror(w[i - 2], 17) ^ ror(w[i - 2], 19) ^ (w[i - 2] >>> 10);
+      w[i] = (w[i - 16] + s0 + w[i - 7] + s1) | 0;
+    }
+    let [a, b, c, d, e, f, g, hh] = h;
+    for (let i = 0; i < 64; i++) {
+      const t1 = (hh + (ror(e, 6) ^ ror(e, 11) ^ ror(e, 25)) + ((e & f) ^ (~e & g)) + K[i] + w[i]) | 0;
+      const t2 = ((ror(a, 2) ^ ror(a, 13) ^ ror(a, 22)) + ((a & b) ^ (a & c) ^ (b & c))) | 0;
+      hh = g; g = f; f = e; e = (d + t1) | 0;
+      d = c; c = b; b = a; a = (t1 + t2) | 0;
+    }
+    [a, b, c, d, e, f, g, hh].forEach((v, i) => { h[i] = (h[i] + v) | 0; });
+  }
+  const digest = [];
+  h.forEach((v) => digest.push((v >>> 24) & 0xff, (v >>> 16) & 0xff, (v >>> 8) & 0xff, v & 0xff));
+  return digest;
+}
+
+function ror(x, n) {
+  return (x >>> n) | (x << (32 - n));
+}
+
+function hmacSha256(secret, message) {
+  let key = utf8(secret);
+  if (key.length > 64) {
+    key = sha256(key);
+  }
+  while (key.length < 64) {
+    key.push(0);
+  }
+  const inner = sha256(key.map((b) => b ^ 0x36).concat(utf8(message)));
+  return sha256(key.map((b) => b ^ 0x5c).concat(inner))
+    .map((b) => (b < 16 ? '0' : '') + b.toString(16)).join('');
+}
+
+exports.hmacSha256 = hmacSha256;
+
+exports.rule = entities.Issue.onChange({
+  title: 'Sync changes to Google Calendar',
+  guard: (ctx) => ctx.issue.isReported,
+  action: (ctx) => {
+    const body = JSON.stringify({project: ctx.issue.project.shortName, issueId: ctx.issue.id});
+    const connection = new http.Connection(ENDPOINT, null, 2000);
+    connection.addHeader('Content-Type', 'application/json');
+    connection.addHeader({{.Header}}, 'sha256=' + hmacSha256(SECRET, body));
+    const response = connection.postSync('', [], body);
+    if (!response.isSuccess) {
+      console.warn('youtrack-calendar-sync did not accept the change of ' + ctx.issue.id + ': ' + response.code + ' ' + response.response);
+    }
+  },
+  requirements: {}
+});
+`))
+
+// WriteWorkflow writes a YouTrack workflow package, a ZIP archive to import
+// under Administration > Workflows, whose rule posts every change of an
+// issue to the webhook of the synchronizer served at baseURL, signed with
+// secret. The workflow still has to be attached to the synced projects.
+func WriteWorkflow(w io.Writer, baseURL, secret string) error {
+	endpoint, err := URL(baseURL, Path)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return fmt.Errorf("the webhook secret is empty")
+	}
+	literal := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+	var script strings.Builder
+	if err := workflowScript.Execute(&script, map[string]string{
+		"Endpoint": literal(endpoint),
+		"Secret":   literal(secret),
+		"Header":   literal(SignatureHeader),
+	}); err != nil {
+		return err
+	}
+	manifest, err := json.MarshalIndent(map[string]string{
+		"name":        WorkflowName,
+		"title":       "YouTrack to Google Calendar sync",
+		"version":     "1.0.0",
+		"description": "Notifies youtrack-calendar-sync of issue changes through its webhook.",
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range []struct{ name, content string }{
+		{"package.json", string(manifest) + "\n"},
+		{"sync-changes.js", script.String()},
+	} {
+		f, err := archive.Create(WorkflowName + "/" + file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, file.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,191 @@
+package youtrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Activity categories read by ChangeFeed. Comments are left out: their
+// target is the comment rather than the issue, and they change nothing that
+// is synced.
+const (
+	CategoryIssueCreated  = "IssueCreatedCategory"
+	CategoryIssueResolved = "IssueResolvedCategory"
+	CategoryIssueDeleted  = "IssueDeletedCategory"
+	changeCategories      = CategoryIssueCreated + "," + CategoryIssueResolved + "," + CategoryIssueDeleted +
+		",CustomFieldCategory,SummaryCategory,DescriptionCategory,TagsCategory,LinksCategory,ProjectCategory,IssueVisibilityCategory"
+)
+
+// Changes are the issues of a query that changed in a period, as read from
+// the activities of the issues.
+type Changes struct {
+	// Created are the issues created in the period, Updated those created
+	// before and changed in it. Both hold the issues as they are now.
+	Created []Issue
+	Updated []Issue
+	// Resolved are the IDs of the issues among Created and Updated that
+	// were resolved in the period.
+	Resolved []string
+	// Deleted are the IDs of the issues deleted in the period, which are
+	// the database IDs, like Issue.ID, rather than the readable ones.
+	Deleted []string
+	// Latest is the time of the newest activity read, in Unix
+	// milliseconds by the YouTrack clock, or zero without any.
+	Latest int64
+}
+
+// Issues returns Created and Updated.
+func (c *Changes) Issues() []Issue {
+	return append(append([]Issue{}, c.Created...), c.Updated...)
+}
+
+// activity is an entry of the activities API whose target is an issue.
+type activity struct {
+	Timestamp int64 `json:"timestamp"`
+	Category  struct {
+		ID string `json:"id"`
+	} `json:"category"`
+	Target Issue `json:"target"`
+}
+
+// unresolvedTerm matches the query terms that exclude resolved issues.
+var unresolvedTerm = regexp.MustCompile(`(?i)State:\s*-Resolved|#Unresolved`)
+
+// ChangeFeed returns the issues of projectID, see ProjectQuery, that were
+// created, updated or deleted since the given time, reading the activities
+// of the issues page by page instead of searching for each kind of change.
+//
+// Issues resolved in the period are reported even when projectID excludes
+// resolved issues, such as "#Unresolved", so that the resolution is not
+// mistaken for the issue leaving the query unchanged.
+func (c *Client) ChangeFeed(projectID string, since time.Time) (*Changes, error) {
+	return c.changeFeed(projectID, since, c.issueFields())
+}
+
+// ChangeFeedStamps is ChangeFeed returning only the ID, readable ID, update
+// and resolution time of each issue, to tell which issues need fetching.
+func (c *Client) ChangeFeedStamps(projectID string, since time.Time) (*Changes, error) {
+	return c.changeFeed(projectID, since, stampFields+",resolved")
+}
+
+// changeFeed is ChangeFeed requesting the given fields of the issues.
+func (c *Client) changeFeed(projectID string, since time.Time, fields string) (*Changes, error) {
+	query := ProjectQuery(projectID)
+	excludesResolved := unresolvedTerm.MatchString(query)
+	if excludesResolved {
+		query = strings.Join(strings.Fields(unresolvedTerm.ReplaceAllString(query, "")), " ")
+	}
+	activities, err := c.activities(changeCategories, query, since, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// The last activity of an issue tells whether it still exists; the
+	// others whether it was created or resolved in the period.
+	type change struct {
+		issue                   Issue
+		created, resolved, gone bool
+	}
+	feed := &Changes{}
+	var order []string
+	changes := make(map[string]*change)
+	for _, a := range activities {
+		feed.Latest = max(feed.Latest, a.Timestamp)
+		id := a.Target.ID
+		if id == "" {
+			continue
+		}
+		ch, ok := changes[id]
+		if !ok {
+			ch = &change{}
+			changes[id] = ch
+			order = append(order, id)
+		}
+		switch a.Category.ID {
+		case CategoryIssueCreated:
+			ch.created, ch.gone = true, false
+		case CategoryIssueResolved:
+			ch.resolved = true
+		case CategoryIssueDeleted:
+			ch.gone = true
+			continue
+		}
+		ch.issue = a.Target
+	}
+
+	for _, id := range order {
+		ch := changes[id]
+		switch {
+		case ch.gone:
+			feed.Deleted = append(feed.Deleted, id)
+			continue
+		case excludesResolved && ch.issue.IsResolved() && !ch.resolved:
+			// Resolved before the period; outside the query.
+			continue
+		case ch.created:
+			feed.Created = append(feed.Created, ch.issue)
+		default:
+			feed.Updated = append(feed.Updated, ch.issue)
+		}
+		if ch.resolved && ch.issue.IsResolved() {
+			feed.Resolved = append(feed.Resolved, id)
+		}
+	}
+	return feed, nil
+}
+
+// activities returns the activities of categories on the issues matching
+// query since the given time, oldest first, following the cursor of the
+// activities page API. fields selects the fields of the target issues.
+func (c *Client) activities(categories, query string, since time.Time, fields string) ([]activity, error) {
+	var activities []activity
+	cursor := ""
+	for {
+		params := url.Values{}
+		params.Set("categories", categories)
+		params.Set("issueQuery", query)
+		params.Set("start", fmt.Sprint(since.UnixMilli()))
+		params.Set("fields", "afterCursor,hasAfter,activities(timestamp,category(id),target("+fields+"))")
+		params.Set("$top", fmt.Sprint(c.pageSize()))
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/activitiesPage?%s", c.BaseURL, apiPath, params.Encode()), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		var page struct {
+			Activities  []activity `json:"activities"`
+			AfterCursor string     `json:"afterCursor"`
+			HasAfter    bool       `json:"hasAfter"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, apiError("read issue activities", resp, respBody)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		activities = append(activities, page.Activities...)
+		if !page.HasAfter || page.AfterCursor == "" || page.AfterCursor == cursor {
+			return activities, nil
+		}
+		cursor = page.AfterCursor
+	}
+}
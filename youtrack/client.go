@@ -8,13 +8,25 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 	"time"
+
+	"youtrack-calendar-sync/httpclient"
 )
 
+// ErrNotFound is wrapped by the errors of requests for missing items.
 var ErrNotFound = errors.New("not found")
 
 const (
 	apiPath = "/api"
+	// stampFields is the fields parameter of GetUpdatedIssueStamps.
+	stampFields = "id,idReadable,updated"
+	// DefaultPageSize is the number of issues requested at a time.
+	DefaultPageSize = 100
+	// DefaultIssueFields is the fields parameter used whenever issues are
+	// fetched, unless Client.IssueFields overrides it.
+	DefaultIssueFields = "id,idReadable,summary,description,updated,resolved,isDraft,project(id,name,shortName),customFields(id,name,value($type,name,login,value,minutes)),parent(issues(id,idReadable)),tags(name)"
 )
 
 // Client wraps the YouTrack HTTP client.
@@ -22,6 +34,11 @@ type Client struct {
 	BaseURL    string
 	Token      string
 	HTTPClient *http.Client
+	// IssueFields replaces DefaultIssueFields. The synchronizer needs at
+	// least the fields of issues it reads.
+	IssueFields string
+	// PageSize is the $top of issue searches; zero uses DefaultPageSize.
+	PageSize int
 }
 
 // NewClient creates a new YouTrack API client.
@@ -33,21 +50,47 @@ func NewClient(baseURL, token string) *Client {
 	}
 }
 
+// apiError returns the error for resp, see httpclient.APIError. Errors for
+// missing items wrap ErrNotFound.
+func apiError(op string, resp *http.Response, body []byte) error {
+	err := httpclient.ResponseError("youtrack", op, resp, body)
+	var notFound *httpclient.NotFoundError
+	if errors.As(err, &notFound) {
+		notFound.Err = ErrNotFound
+	}
+	return err
+}
+
 func (c *Client) GetBaseURL() string {
 	return c.BaseURL
 }
 
-// CreateIssue creates a new YouTrack issue.
-func (c *Client) CreateIssue(projectID, summary, description string, dueDate *time.Time) (*Issue, error) {
+func (c *Client) issueFields() string {
+	if c.IssueFields != "" {
+		return c.IssueFields
+	}
+	return DefaultIssueFields
+}
+
+func (c *Client) pageSize() int {
+	if c.PageSize > 0 {
+		return c.PageSize
+	}
+	return DefaultPageSize
+}
+
+// CreateIssue creates a new YouTrack issue with the given additional custom fields.
+func (c *Client) CreateIssue(projectID, summary, description string, dueDate *time.Time, fields []CustomFieldWrapper) (*Issue, error) {
 	issue := IssueWrapper{
 		YouTrackType: YouTrackType{Type: "Issue"},
 		Summary:      summary,
 		Description:  description,
 		Project:      &Project{YouTrackType: YouTrackType{Type: "Project"}, ID: projectID},
+		CustomFields: append([]CustomFieldWrapper{}, fields...),
 	}
 
 	if dueDate != nil {
-		issue.CustomFields = append(issue.CustomFields, CustomField{
+		issue.CustomFields = append(issue.CustomFields, CustomFieldWrapper{
 			YouTrackType: YouTrackType{Type: "DateIssueCustomField"},
 			Name:         "Due Date", // Assuming "Due Date" is the name of your custom field
 			Value:        dueDate.UnixMilli(),
@@ -75,7 +118,7 @@ func (c *Client) CreateIssue(projectID, summary, description string, dueDate *ti
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to create issue, status: %s, body: %s", resp.Status, respBody)
+		return nil, apiError("create issue", resp, respBody)
 	}
 
 	var createdIssue Issue
@@ -86,16 +129,21 @@ func (c *Client) CreateIssue(projectID, summary, description string, dueDate *ti
 }
 
 // UpdateIssue updates an existing YouTrack issue.
-func (c *Client) UpdateIssue(issueID, summary, description string, dueDate *time.Time) error {
-	updates := map[string]interface{}{
-		"summary":     summary,
-		"description": description,
+// Nil fields are left unchanged; an empty description clears it.
+func (c *Client) UpdateIssue(issueID string, summary, description *string, dueDate *time.Time) error {
+	updates := map[string]interface{}{}
+	if summary != nil {
+		updates["summary"] = *summary
+	}
+	if description != nil {
+		updates["description"] = *description
 	}
 
 	if dueDate != nil {
 		updates["customFields"] = []CustomFieldWrapper{
 			{
 				YouTrackType: YouTrackType{Type: "DateIssueCustomField"},
+				Name:         "Due Date",
 				Value:        dueDate.UnixMilli(),
 			},
 		}
@@ -120,19 +168,47 @@ func (c *Client) UpdateIssue(issueID, summary, description string, dueDate *time
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return ErrNotFound
-	} else if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to update issue, status: %s, body: %s", resp.Status, respBody)
+		return apiError("update issue", resp, respBody)
 	}
 	return nil
 }
 
-// GetIssueBySummary searches for a YouTrack issue by its summary.
-func (c *Client) GetIssueBySummary(projectID, summary string) (*Issue, error) {
-	query := url.QueryEscape(fmt.Sprintf("project:%s summary:\"%s\" State: -Resolved", projectID, summary))
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/issues?query=%s&fields=id,idReadable,summary,description,project(id,name,shortName),customFields(id,name,value($type,name,value))", c.BaseURL, apiPath, query), nil)
+// UpdateCustomFields sets the given custom fields on an existing YouTrack issue.
+// A nil Value clears the field.
+func (c *Client) UpdateCustomFields(issueID string, fields []CustomFieldWrapper) error {
+	body, err := json.Marshal(map[string]interface{}{"customFields": fields})
+	if err != nil {
+		return fmt.Errorf("failed to marshal custom fields: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s%s/issues/%s", c.BaseURL, apiPath, issueID), bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return apiError("update custom fields", resp, respBody)
+	}
+	return nil
+}
+
+// GetIssue fetches a single YouTrack issue by its database or readable ID,
+// with the same fields as the other issue queries. It returns ErrNotFound
+// when the issue does not exist or is not visible to the token owner.
+func (c *Client) GetIssue(issueID string) (*Issue, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/issues/%s?fields=%s", c.BaseURL, apiPath, url.PathEscape(issueID), c.issueFields()), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -147,26 +223,46 @@ func (c *Client) GetIssueBySummary(projectID, summary string) (*Issue, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get issue by summary, status: %s, body: %s", resp.Status, respBody)
+		return nil, apiError("get issue", resp, respBody)
 	}
 
-	var issues []Issue
-	if err := json.NewDecoder(resp.Body).Decode(&issues); err != nil {
+	var issue Issue
+	if err := json.NewDecoder(resp.Body).Decode(&issue); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	return &issue, nil
+}
 
-	if len(issues) > 0 {
-		return &issues[0], nil
+// GetCurrentUser fetches the user that owns the API token.
+func (c *Client) GetCurrentUser() (*User, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/users/me?fields=id,login", c.BaseURL, apiPath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	return nil, nil // No issue found
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, apiError("get current user", resp, respBody)
+	}
+
+	var user User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &user, nil
 }
 
-// GetUpdatedIssues fetches issues updated since a given time.
-func (c *Client) GetUpdatedIssues(projectID string, since time.Time) ([]Issue, error) {
-	query := url.QueryEscape(fmt.Sprintf("project:%s updated: %s .. {now}", projectID, since.Format("2006-01-02T15:04:05")))
-	url := fmt.Sprintf("%s%s/issues?query=%s&fields=id,idReadable,summary,description,updated,project(id,name,shortName),customFields(id,name,value($type,name,value))", c.BaseURL, apiPath, query)
-	fmt.Printf("Fetching updated issues with query: %s\n", url)
-	req, err := http.NewRequest("GET", url, nil)
+// GetProjectCustomFields fetches the custom field schema of a project.
+func (c *Client) GetProjectCustomFields(projectID string) ([]ProjectCustomField, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/admin/projects/%s/customFields?fields=field(name,fieldType(id))&$top=-1", c.BaseURL, apiPath, url.PathEscape(projectID)), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -181,23 +277,455 @@ func (c *Client) GetUpdatedIssues(projectID string, since time.Time) ([]Issue, e
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get updated issues, status: %s, body: %s", resp.Status, respBody)
+		return nil, apiError("get project custom fields", resp, respBody)
+	}
+
+	var fields []ProjectCustomField
+	if err := json.NewDecoder(resp.Body).Decode(&fields); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return fields, nil
+}
+
+// FindUserByEmail returns the user with the given email address, or nil if
+// there is none.
+func (c *Client) FindUserByEmail(email string) (*User, error) {
+	query := url.QueryEscape(email)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/users?query=%s&fields=id,login,email", c.BaseURL, apiPath, query), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, apiError("search users", resp, respBody)
+	}
+
+	var users []User
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	for i := range users {
+		if strings.EqualFold(users[i].Email, email) {
+			return &users[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// DependsOn is how the "Depend" link type reads from the dependent issue.
+const DependsOn = "depends on"
+
+// GetDependencies returns the issues issueID depends on, with their custom
+// fields.
+func (c *Client) GetDependencies(issueID string) ([]Issue, error) {
+	fields := "direction,linkType(name,sourceToTarget,targetToSource),issues(id,idReadable,summary,resolved,customFields(id,name,value($type,name,login,value)))"
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/issues/%s/links?fields=%s", c.BaseURL, apiPath, issueID, fields), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, apiError("get issue links", resp, respBody)
+	}
+
+	var links []IssueLink
+	if err := json.NewDecoder(resp.Body).Decode(&links); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	var dependencies []Issue
+	for i := range links {
+		if strings.EqualFold(links[i].Verb(), DependsOn) {
+			dependencies = append(dependencies, links[i].Issues...)
+		}
+	}
+	return dependencies, nil
+}
+
+// AddComment posts a comment to an issue.
+func (c *Client) AddComment(issueID, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to marshal comment: %w", err)
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s%s/issues/%s/comments?fields=id", c.BaseURL, apiPath, issueID), bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return apiError("add comment", resp, respBody)
+	}
+	return nil
+}
+
+// ApplyCommand applies a YouTrack command, such as "State {In Progress}",
+// to an issue. Commands run workflow rules like edits in YouTrack do, so
+// state machines allow only their own transitions.
+func (c *Client) ApplyCommand(issueID, command string) error {
+	body, err := json.Marshal(map[string]any{
+		"query":  command,
+		"issues": []map[string]string{{"idReadable": issueID}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+	req, err := http.NewRequest("POST", c.BaseURL+apiPath+"/commands", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return apiError("apply command", resp, respBody)
+	}
+	return nil
+}
+
+// LinkIssues adds a link of the named type from sourceID to targetID. For a
+// directed type the target is on the inward side; "Subtask" makes targetID a
+// subtask of sourceID.
+func (c *Client) LinkIssues(linkType, sourceID, targetID string) error {
+	types, err := c.getIssueLinkTypes()
+	if err != nil {
+		return err
+	}
+	var linkID string
+	for _, t := range types {
+		if strings.EqualFold(t.Name, linkType) {
+			// Links of an issue are addressed by type ID, suffixed with
+			// "s" for the outward side of directed types.
+			linkID = t.ID
+			if t.Directed {
+				linkID += "s"
+			}
+			break
+		}
+	}
+	if linkID == "" {
+		return fmt.Errorf("link type %q: %w", linkType, ErrNotFound)
+	}
+
+	body, err := json.Marshal(Issue{ID: targetID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal issue: %w", err)
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s%s/issues/%s/links/%s/issues?fields=id", c.BaseURL, apiPath, sourceID, linkID), bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return apiError("link issues", resp, respBody)
+	}
+	return nil
+}
+
+func (c *Client) getIssueLinkTypes() ([]IssueLinkType, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/issueLinkTypes?fields=id,name,directed", c.BaseURL, apiPath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, apiError("get issue link types", resp, respBody)
+	}
+
+	var types []IssueLinkType
+	if err := json.NewDecoder(resp.Body).Decode(&types); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return types, nil
+}
+
+// GetSavedQuery returns the saved search visible to the token owner with the
+// given name, or ErrNotFound.
+func (c *Client) GetSavedQuery(name string) (*SavedQuery, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/savedQueries?fields=id,name,query&$top=-1", c.BaseURL, apiPath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, apiError("get saved searches", resp, respBody)
+	}
+
+	var queries []SavedQuery
+	if err := json.NewDecoder(resp.Body).Decode(&queries); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	for i := range queries {
+		if queries[i].Name == name {
+			return &queries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("saved search %q: %w", name, ErrNotFound)
+}
+
+// AddTag adds the existing tag with the given name to an issue.
+func (c *Client) AddTag(issueID, tagName string) error {
+	query := url.QueryEscape(tagName)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/tags?query=%s&fields=id,name", c.BaseURL, apiPath, query), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return apiError("get tags", resp, respBody)
+	}
+
+	var tags []Tag
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	var tag *Tag
+	for i := range tags {
+		if tags[i].Name == tagName {
+			tag = &tags[i]
+			break
+		}
+	}
+	if tag == nil {
+		return fmt.Errorf("tag %q: %w", tagName, ErrNotFound)
+	}
+
+	body, err := json.Marshal(Tag{ID: tag.ID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal tag: %w", err)
+	}
+	req, err = http.NewRequest("POST", fmt.Sprintf("%s%s/issues/%s/tags", c.BaseURL, apiPath, issueID), bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err = c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return apiError("add tag", resp, respBody)
+	}
+	return nil
+}
+
+// ProjectQuery returns the search term selecting the issues of projects,
+// which is a project ID, a comma-separated list of them or a raw query
+// fragment such as "project: A, B" or "(#Unresolved)" that is used
+// unchanged.
+func ProjectQuery(projects string) string {
+	projects = strings.TrimSpace(projects)
+	if strings.Contains(projects, ":") || strings.HasPrefix(projects, "(") {
+		return projects
+	}
+	names := splitProjects(projects)
+	if len(names) == 1 {
+		return "project:" + names[0]
+	}
+	return "project: " + strings.Join(names, ", ")
+}
+
+// projectTerm matches the project term of a query and its list of values.
+var projectTerm = regexp.MustCompile(`project:\s*([^\s,()]+(?:\s*,\s*[^\s,()]+)*)`)
+
+// QueryProjects returns the projects named by the project term of
+// ProjectQuery(projects). It returns nil for a raw fragment without one.
+func QueryProjects(projects string) []string {
+	m := projectTerm.FindStringSubmatch(ProjectQuery(projects))
+	if m == nil {
+		return nil
+	}
+	return splitProjects(m[1])
+}
+
+func splitProjects(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GetIssueBySummary searches for a YouTrack issue by its summary.
+func (c *Client) GetIssueBySummary(projectID, summary string) (*Issue, error) {
+	query := url.QueryEscape(fmt.Sprintf("project:%s summary:\"%s\" State: -Resolved", projectID, summary))
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s/issues?query=%s&fields=%s", c.BaseURL, apiPath, query, c.issueFields()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, apiError("get issue by summary", resp, respBody)
 	}
 
 	var issues []Issue
 	if err := json.NewDecoder(resp.Body).Decode(&issues); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+
+	if len(issues) > 0 {
+		return &issues[0], nil
+	}
+	return nil, nil // No issue found
+}
+
+// GetUpdatedIssues fetches issues updated since a given time. projectID
+// may select several projects, see ProjectQuery.
+func (c *Client) GetUpdatedIssues(projectID string, since time.Time) ([]Issue, error) {
+	return c.searchIssues(updatedQuery(projectID, since), c.issueFields())
+}
+
+// GetUpdatedIssueStamps is GetUpdatedIssues returning only the ID, readable
+// ID and update time of each issue, to tell which issues need fetching.
+func (c *Client) GetUpdatedIssueStamps(projectID string, since time.Time) ([]Issue, error) {
+	return c.searchIssues(updatedQuery(projectID, since), stampFields)
+}
+
+// GetIssues fetches the issues with the given readable IDs, PageSize at a
+// time. Unknown IDs are left out.
+func (c *Client) GetIssues(issueIDs []string) ([]Issue, error) {
+	var issues []Issue
+	for start := 0; start < len(issueIDs); start += c.pageSize() {
+		end := min(start+c.pageSize(), len(issueIDs))
+		page, err := c.searchIssuePage("issue id: "+strings.Join(issueIDs[start:end], ", "), c.issueFields(), 0)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page...)
+	}
 	return issues, nil
 }
 
-// GetDeletedIssueIDs fetches the IDs of issues that have been deleted since a given time.
-func (c *Client) GetDeletedIssueIDs(projectID string, since time.Time) ([]string, error) {
-	// YouTrack API doesn't directly support querying for deleted issues.
-	// A common workaround is to use the activities API.
-	// This is a simplified example; a robust implementation might need to handle pagination.
-	query := url.QueryEscape(fmt.Sprintf("project:%s", projectID))
-	url := fmt.Sprintf("%s%s/activities?categories=IssueDeletedCategory&author=me&since=%d&query=%s", c.BaseURL, apiPath, since.UnixMilli(), query)
+// GetDueIssues returns the unresolved issues of projectID that are due
+// between the days of from and to, inclusive.
+func (c *Client) GetDueIssues(projectID string, from, to time.Time) ([]Issue, error) {
+	query := fmt.Sprintf("%s #Unresolved Due Date: %s .. %s", ProjectQuery(projectID), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	return c.searchIssues(query, c.issueFields())
+}
+
+// MatchesQuery reports whether the issue with the readable ID issueID is
+// among the issues of projectID, see ProjectQuery.
+func (c *Client) MatchesQuery(projectID, issueID string) (bool, error) {
+	issues, err := c.searchIssuePage(fmt.Sprintf("%s issue id: %s", ProjectQuery(projectID), issueID), "id", 0)
+	if err != nil {
+		return false, err
+	}
+	return len(issues) > 0, nil
+}
+
+func updatedQuery(projectID string, since time.Time) string {
+	return fmt.Sprintf("%s updated: %s .. {now}", ProjectQuery(projectID), since.Format("2006-01-02T15:04:05"))
+}
+
+// searchIssues returns every issue matching query, requesting PageSize
+// issues at a time.
+func (c *Client) searchIssues(query, fields string) ([]Issue, error) {
+	var issues []Issue
+	for skip := 0; ; skip += c.pageSize() {
+		page, err := c.searchIssuePage(query, fields, skip)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, page...)
+		if len(page) < c.pageSize() {
+			return issues, nil
+		}
+	}
+}
+
+// searchIssuePage returns up to PageSize issues matching query, skipping
+// the first skip.
+func (c *Client) searchIssuePage(query, fields string, skip int) ([]Issue, error) {
+	url := fmt.Sprintf("%s%s/issues?query=%s&fields=%s&$top=%d&$skip=%d", c.BaseURL, apiPath, url.QueryEscape(query), fields, c.pageSize(), skip)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -213,18 +741,23 @@ func (c *Client) GetDeletedIssueIDs(projectID string, since time.Time) ([]string
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get deleted issues, status: %s, body: %s", resp.Status, respBody)
+		return nil, apiError("search issues", resp, respBody)
 	}
 
-	var activities []struct {
-		Target struct {
-			ID string `json:"idReadable"`
-		} `json:"target"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&activities); err != nil {
+	var issues []Issue
+	if err := json.NewDecoder(resp.Body).Decode(&issues); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	return issues, nil
+}
 
+// GetDeletedIssueIDs returns the IDs of the issues of projectID deleted since
+// the given time, by anyone, from their deletion activities.
+func (c *Client) GetDeletedIssueIDs(projectID string, since time.Time) ([]string, error) {
+	activities, err := c.activities(CategoryIssueDeleted, ProjectQuery(projectID), since, "id,idReadable")
+	if err != nil {
+		return nil, err
+	}
 	var deletedIDs []string
 	for _, activity := range activities {
 		deletedIDs = append(deletedIDs, activity.Target.ID)
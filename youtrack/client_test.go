@@ -2,11 +2,16 @@ package youtrack
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
+
+	"youtrack-calendar-sync/httpclient"
 )
 
 func newTestClient(serverURL string) *Client {
@@ -28,7 +33,7 @@ func TestCreateIssue(t *testing.T) {
 
 	client := newTestClient(server.URL)
 	dueDate := time.Now()
-	issue, err := client.CreateIssue("project-id", "New Issue", "Description", &dueDate)
+	issue, err := client.CreateIssue("project-id", "New Issue", "Description", &dueDate, []CustomFieldWrapper{EnumField("Type", "Meeting")})
 	if err != nil {
 		t.Fatalf("CreateIssue() error = %v", err)
 	}
@@ -39,20 +44,35 @@ func TestCreateIssue(t *testing.T) {
 }
 
 func TestUpdateIssue(t *testing.T) {
+	var body map[string]interface{}
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			t.Errorf("Expected 'POST' request, got '%s'", r.Method)
 		}
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer server.Close()
 
 	client := newTestClient(server.URL)
+	summary, description := "Updated Issue", "Description"
 	dueDate := time.Now()
-	err := client.UpdateIssue("issue-id", "Updated Issue", "Description", &dueDate)
+	err := client.UpdateIssue("issue-id", &summary, &description, &dueDate)
 	if err != nil {
 		t.Fatalf("UpdateIssue() error = %v", err)
 	}
+	if body["summary"] != summary || body["description"] != description || body["customFields"] == nil {
+		t.Errorf("Expected every field to be written, got %v", body)
+	}
+
+	description = ""
+	if err := client.UpdateIssue("issue-id", nil, &description, nil); err != nil {
+		t.Fatalf("UpdateIssue() error = %v", err)
+	}
+	if _, ok := body["summary"]; ok || body["description"] != "" || body["customFields"] != nil {
+		t.Errorf("Expected only the description to be cleared, got %v", body)
+	}
 }
 
 func TestGetIssueBySummary(t *testing.T) {
@@ -105,12 +125,32 @@ func TestUpdateIssue_NotFound(t *testing.T) {
 	defer server.Close()
 
 	client := newTestClient(server.URL)
-	err := client.UpdateIssue("non-existent-issue", "Summary", "Description", nil)
-	if err != ErrNotFound {
+	summary := "Summary"
+	err := client.UpdateIssue("non-existent-issue", &summary, nil, nil)
+	if !errors.Is(err, ErrNotFound) {
 		t.Errorf("Expected ErrNotFound, got %v", err)
 	}
 }
 
+func TestUpdateIssue_RateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	summary := "Summary"
+	err := client.UpdateIssue("PRJ-1", &summary, nil, nil)
+	var rateLimit *httpclient.RateLimitError
+	if !errors.As(err, &rateLimit) || rateLimit.RetryAfter != 30*time.Second || rateLimit.Service != "youtrack" {
+		t.Errorf("Expected a rate limit error asking to wait 30s, got %#v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("Expected a rate limit not to be reported as not found")
+	}
+}
+
 func TestGetIssueBySummary_NotFound(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -126,4 +166,541 @@ func TestGetIssueBySummary_NotFound(t *testing.T) {
 	if issue != nil {
 		t.Errorf("Expected no issue to be found, but got one: %+v", issue)
 	}
-}
\ No newline at end of file
+}
+
+func TestUpdateCustomFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected 'POST' request, got '%s'", r.Method)
+		}
+		if r.URL.Path != "/api/issues/issue-id" {
+			t.Errorf("Expected to request '/api/issues/issue-id', got: %s", r.URL.Path)
+		}
+		var body struct {
+			CustomFields []map[string]interface{} `json:"customFields"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode request body: %v", err)
+		}
+		if len(body.CustomFields) != 2 {
+			t.Fatalf("Expected 2 custom fields, got %d", len(body.CustomFields))
+		}
+		if body.CustomFields[0]["name"] != "Priority" || body.CustomFields[0]["$type"] != "SingleEnumIssueCustomField" {
+			t.Errorf("Unexpected priority field: %v", body.CustomFields[0])
+		}
+		if value, ok := body.CustomFields[1]["value"]; !ok || value != nil {
+			t.Errorf("Expected due date to be cleared with a null value, got %v", body.CustomFields[1])
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	err := client.UpdateCustomFields("issue-id", []CustomFieldWrapper{
+		{YouTrackType: YouTrackType{Type: "SingleEnumIssueCustomField"}, Name: "Priority", Value: NamedValue{Name: "Minor"}},
+		{YouTrackType: YouTrackType{Type: "DateIssueCustomField"}, Name: "Due Date", Value: nil},
+	})
+	if err != nil {
+		t.Fatalf("UpdateCustomFields() error = %v", err)
+	}
+}
+
+func TestGetIssue(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		if r.URL.Path != "/api/issues/PRJ-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&Issue{ID: "2-1", IDReadable: "PRJ-1", Summary: "Found"})
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	issue, err := client.GetIssue("PRJ-1")
+	if err != nil {
+		t.Fatalf("GetIssue() error = %v", err)
+	}
+	if issue.ID != "2-1" || issue.Summary != "Found" {
+		t.Errorf("Unexpected issue: %+v", issue)
+	}
+
+	if _, err := client.GetIssue("PRJ-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing issue, got %v", err)
+	}
+	if _, err := client.GetIssue("PRJ-1/comments"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing issue, got %v", err)
+	}
+	if path != "/api/issues/PRJ-1%2Fcomments" {
+		t.Errorf("Expected the issue ID to be escaped, got path %s", path)
+	}
+}
+
+func TestNewCustomField(t *testing.T) {
+	tests := []struct {
+		kind, value string
+		wantType    string
+		wantValue   string
+	}{
+		{FieldKindEnum, "Normal", "SingleEnumIssueCustomField", `{"name":"Normal"}`},
+		{FieldKindMultiEnum, "a|b", "MultiEnumIssueCustomField", `[{"name":"a"},{"name":"b"}]`},
+		{FieldKindState, "Open", "StateIssueCustomField", `{"name":"Open"}`},
+		{FieldKindUser, "jane", "SingleUserIssueCustomField", `{"login":"jane"}`},
+		{FieldKindString, "x", "SimpleIssueCustomField", `"x"`},
+		{FieldKindText, "x", "TextIssueCustomField", `{"text":"x"}`},
+	}
+	for _, tt := range tests {
+		field, err := NewCustomField(tt.kind, "Field", tt.value)
+		if err != nil {
+			t.Fatalf("NewCustomField(%q) error = %v", tt.kind, err)
+		}
+		value, _ := json.Marshal(field.Value)
+		if field.Type != tt.wantType || string(value) != tt.wantValue {
+			t.Errorf("NewCustomField(%q) = %s %s, want %s %s", tt.kind, field.Type, value, tt.wantType, tt.wantValue)
+		}
+	}
+
+	if _, err := NewCustomField("period", "Field", "1h"); err == nil {
+		t.Error("Expected an error for an unknown kind")
+	}
+}
+
+func TestFindUserByEmail(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/users" {
+			t.Errorf("Expected to request '/api/users', got: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]User{
+			{Login: "jane.doe", Email: "jane.doe@example.com"},
+			{Login: "jane", Email: "Jane@example.com"},
+		})
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	user, err := client.FindUserByEmail("jane@example.com")
+	if err != nil {
+		t.Fatalf("FindUserByEmail() error = %v", err)
+	}
+	if user == nil || user.Login != "jane" {
+		t.Errorf("Expected user jane, got %+v", user)
+	}
+}
+
+func TestCustomFieldDecoding(t *testing.T) {
+	data := `{"customFields":[
+		{"$type":"SingleEnumIssueCustomField","name":"Priority","value":{"$type":"EnumBundleElement","name":"Major"}},
+		{"$type":"StateIssueCustomField","name":"State","value":{"$type":"StateBundleElement","name":"Open"}},
+		{"$type":"SingleUserIssueCustomField","name":"Assignee","value":{"$type":"User","login":"jane","name":"Jane Doe"}},
+		{"$type":"DateIssueCustomField","name":"Due Date","value":1700000000000},
+		{"$type":"SingleEnumIssueCustomField","name":"Type","value":null},
+		{"$type":"PeriodIssueCustomField","name":"Estimation","value":{"$type":"PeriodValue","minutes":150,"presentation":"2h 30m"}}
+	]}`
+	var issue Issue
+	if err := json.Unmarshal([]byte(data), &issue); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if v, ok := issue.CustomFields[0].Value.(NamedValue); !ok || v.Name != "Major" {
+		t.Errorf("Expected enum value Major, got %#v", issue.CustomFields[0].Value)
+	}
+	if v, ok := issue.CustomFields[1].Value.(NamedValue); !ok || v.Name != "Open" {
+		t.Errorf("Expected state value Open, got %#v", issue.CustomFields[1].Value)
+	}
+	if v, ok := issue.CustomFields[2].Value.(UserValue); !ok || v.Login != "jane" {
+		t.Errorf("Expected user jane, got %#v", issue.CustomFields[2].Value)
+	}
+	if v, ok := issue.CustomFields[3].Value.(float64); !ok || v != 1700000000000 {
+		t.Errorf("Expected a numeric due date, got %#v", issue.CustomFields[3].Value)
+	}
+	if issue.CustomFields[4].Value != nil {
+		t.Errorf("Expected an unset enum to be nil, got %#v", issue.CustomFields[4].Value)
+	}
+
+	if got := issue.CustomFieldValue("Assignee"); got != "Jane Doe" {
+		t.Errorf("Expected Assignee display value 'Jane Doe', got %q", got)
+	}
+	if got := issue.CustomFieldValue("State"); got != "Open" {
+		t.Errorf("Expected State display value 'Open', got %q", got)
+	}
+	if got := issue.Period("Estimation"); got != 150*time.Minute {
+		t.Errorf("Expected an estimation of 2h30m, got %v", got)
+	}
+}
+
+func TestGetProjectCustomFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/admin/projects/PRJ/customFields" {
+			t.Errorf("Expected to request '/api/admin/projects/PRJ/customFields', got: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"$type":"DateProjectCustomField","field":{"name":"Due Date","fieldType":{"id":"date"}}}]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	fields, err := client.GetProjectCustomFields("PRJ")
+	if err != nil {
+		t.Fatalf("GetProjectCustomFields() error = %v", err)
+	}
+	if len(fields) != 1 || fields[0].Name() != "Due Date" || fields[0].FieldType() != "date" {
+		t.Errorf("Unexpected fields: %+v", fields)
+	}
+}
+
+func TestProjectQuery(t *testing.T) {
+	tests := []struct {
+		projects string
+		query    string
+		names    []string
+	}{
+		{"OPS", "project:OPS", []string{"OPS"}},
+		{"OPS, INFRA", "project: OPS, INFRA", []string{"OPS", "INFRA"}},
+		{"OPS,INFRA,", "project: OPS, INFRA", []string{"OPS", "INFRA"}},
+		{"project: OPS, INFRA #Unresolved", "project: OPS, INFRA #Unresolved", []string{"OPS", "INFRA"}},
+		{"tag: calendar", "tag: calendar", nil},
+		{"(project: OPS or #Urgent)", "(project: OPS or #Urgent)", []string{"OPS"}},
+	}
+	for _, tt := range tests {
+		if got := ProjectQuery(tt.projects); got != tt.query {
+			t.Errorf("ProjectQuery(%q) = %q, want %q", tt.projects, got, tt.query)
+		}
+		if got := QueryProjects(tt.projects); fmt.Sprint(got) != fmt.Sprint(tt.names) {
+			t.Errorf("QueryProjects(%q) = %v, want %v", tt.projects, got, tt.names)
+		}
+	}
+}
+
+func TestGetUpdatedIssues_SeveralProjects(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	since := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	if _, err := client.GetUpdatedIssues("OPS,INFRA", since); err != nil {
+		t.Fatalf("GetUpdatedIssues() error = %v", err)
+	}
+	if want := "project: OPS, INFRA updated: 2024-05-01T08:00:00 .. {now}"; query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+}
+
+func TestGetSavedQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/savedQueries" {
+			t.Errorf("Expected to request '/api/savedQueries', got: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":"7-1","name":"Unassigned","query":"Assignee: Unassigned"},{"id":"7-2","name":"On call","query":"project: OPS #Unresolved"}]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	saved, err := client.GetSavedQuery("On call")
+	if err != nil {
+		t.Fatalf("GetSavedQuery() error = %v", err)
+	}
+	if saved.Query != "project: OPS #Unresolved" {
+		t.Errorf("Unexpected saved query: %+v", saved)
+	}
+	if _, err := client.GetSavedQuery("Missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown saved search, got %v", err)
+	}
+}
+
+func TestLinkIssues(t *testing.T) {
+	var linked string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/issueLinkTypes":
+			fmt.Fprint(w, `[{"id":"82-1","name":"Relates","directed":false},{"id":"82-0","name":"Subtask","directed":true}]`)
+		case "/api/issues/PRJ-1/links/82-0s/issues":
+			var target Issue
+			json.NewDecoder(r.Body).Decode(&target)
+			linked = target.ID
+			fmt.Fprint(w, `{"id":"2-2"}`)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	if err := client.LinkIssues("subtask", "PRJ-1", "2-2"); err != nil {
+		t.Fatalf("LinkIssues() error = %v", err)
+	}
+	if linked != "2-2" {
+		t.Errorf("Expected 2-2 to be linked, got %q", linked)
+	}
+	if err := client.LinkIssues("Duplicate", "PRJ-1", "2-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown link type, got %v", err)
+	}
+}
+
+func TestGetDependencies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/issues/PRJ-1/links" {
+			t.Errorf("Expected to request '/api/issues/PRJ-1/links', got: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[
+			{"direction":"OUTWARD","linkType":{"name":"Depend","sourceToTarget":"depends on","targetToSource":"is required for"},"issues":[{"id":"2-2","idReadable":"PRJ-2"}]},
+			{"direction":"INWARD","linkType":{"name":"Depend","sourceToTarget":"depends on","targetToSource":"is required for"},"issues":[{"id":"2-3","idReadable":"PRJ-3"}]},
+			{"direction":"INWARD","linkType":{"name":"Blocks","sourceToTarget":"blocks","targetToSource":"depends on"},"issues":[{"id":"2-4","idReadable":"PRJ-4"}]}
+		]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	dependencies, err := client.GetDependencies("PRJ-1")
+	if err != nil {
+		t.Fatalf("GetDependencies() error = %v", err)
+	}
+	if len(dependencies) != 2 || dependencies[0].IDReadable != "PRJ-2" || dependencies[1].IDReadable != "PRJ-4" {
+		t.Errorf("Expected PRJ-2 and PRJ-4, got %+v", dependencies)
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	var text string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/issues/PRJ-1/comments" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var comment struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&comment)
+		text = comment.Text
+		fmt.Fprint(w, `{"id":"4-1"}`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	if err := client.AddComment("PRJ-1", "Hello"); err != nil {
+		t.Fatalf("AddComment() error = %v", err)
+	}
+	if text != "Hello" {
+		t.Errorf("Expected the comment text to be sent, got %q", text)
+	}
+}
+
+func TestApplyCommand(t *testing.T) {
+	var command struct {
+		Query  string `json:"query"`
+		Issues []struct {
+			IDReadable string `json:"idReadable"`
+		} `json:"issues"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/commands" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&command)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	if err := client.ApplyCommand("PRJ-1", FieldCommand("State", "Won't do")); err != nil {
+		t.Fatalf("ApplyCommand() error = %v", err)
+	}
+	if command.Query != "State {Won't do}" || len(command.Issues) != 1 || command.Issues[0].IDReadable != "PRJ-1" {
+		t.Errorf("Unexpected command %+v", command)
+	}
+	if got := FieldCommand("State", "Waiting"); got != "State Waiting" {
+		t.Errorf("FieldCommand() = %q, want %q", got, "State Waiting")
+	}
+}
+
+func TestGetUpdatedIssues_Paginates(t *testing.T) {
+	all := []Issue{{ID: "2-1"}, {ID: "2-2"}, {ID: "2-3"}}
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var skip, top int
+		fmt.Sscan(r.URL.Query().Get("$skip"), &skip)
+		fmt.Sscan(r.URL.Query().Get("$top"), &top)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(all[min(skip, len(all)):min(skip+top, len(all))])
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	client.PageSize = 2
+	issues, err := client.GetUpdatedIssues("PRJ", time.Now())
+	if err != nil {
+		t.Fatalf("GetUpdatedIssues() error = %v", err)
+	}
+	if len(issues) != 3 || requests != 2 {
+		t.Errorf("Expected 3 issues in 2 requests, got %d in %d", len(issues), requests)
+	}
+}
+
+func TestGetUpdatedIssueStamps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fields := r.URL.Query().Get("fields"); fields != "id,idReadable,updated" {
+			t.Errorf("Expected only stamp fields, got %q", fields)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":"2-1","idReadable":"PRJ-1","updated":1700000000000}]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	stamps, err := client.GetUpdatedIssueStamps("PRJ", time.Now())
+	if err != nil {
+		t.Fatalf("GetUpdatedIssueStamps() error = %v", err)
+	}
+	if len(stamps) != 1 || stamps[0].Updated != 1700000000000 {
+		t.Errorf("Unexpected stamps: %+v", stamps)
+	}
+}
+
+func TestGetIssues_BatchesIDs(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		if fields := r.URL.Query().Get("fields"); fields != "id,summary" {
+			t.Errorf("Expected the configured fields, got %q", fields)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":"2-1"}]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	client.PageSize = 2
+	client.IssueFields = "id,summary"
+	issues, err := client.GetIssues([]string{"PRJ-1", "PRJ-2", "PRJ-3"})
+	if err != nil {
+		t.Fatalf("GetIssues() error = %v", err)
+	}
+	if len(issues) != 2 {
+		t.Errorf("Expected one issue per batch, got %d", len(issues))
+	}
+	if want := []string{"issue id: PRJ-1, PRJ-2", "issue id: PRJ-3"}; fmt.Sprint(queries) != fmt.Sprint(want) {
+		t.Errorf("queries = %q, want %q", queries, want)
+	}
+}
+
+func TestGetDueIssues(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	from := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	if _, err := client.GetDueIssues("PRJ", from, from.AddDate(0, 0, 14)); err != nil {
+		t.Fatalf("GetDueIssues() error = %v", err)
+	}
+	if want := "project:PRJ #Unresolved Due Date: 2024-05-01 .. 2024-05-15"; query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+}
+
+func TestMatchesQuery(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(query, "PRJ-1") {
+			fmt.Fprint(w, `[{"id":"2-1"}]`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	matches, err := client.MatchesQuery("(Assignee: me)", "PRJ-1")
+	if err != nil {
+		t.Fatalf("MatchesQuery() error = %v", err)
+	}
+	if !matches {
+		t.Error("MatchesQuery() = false, want true")
+	}
+	if want := "(Assignee: me) issue id: PRJ-1"; query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+	if matches, err := client.MatchesQuery("PRJ", "PRJ-2"); err != nil || matches {
+		t.Errorf("MatchesQuery() = %v, %v, want false", matches, err)
+	}
+}
+
+func TestChangeFeed(t *testing.T) {
+	pages := map[string]string{
+		"": `{"activities":[
+			{"timestamp":1,"category":{"id":"IssueCreatedCategory"},"target":{"id":"2-1","idReadable":"PRJ-1","updated":1}},
+			{"timestamp":2,"category":{"id":"SummaryCategory"},"target":{"id":"2-2","idReadable":"PRJ-2","updated":2}},
+			{"timestamp":3,"category":{"id":"IssueResolvedCategory"},"target":{"id":"2-3","idReadable":"PRJ-3","updated":3,"resolved":3}}
+		],"afterCursor":"c1","hasAfter":true}`,
+		"c1": `{"activities":[
+			{"timestamp":4,"category":{"id":"CustomFieldCategory"},"target":{"id":"2-4","idReadable":"PRJ-4","updated":4,"resolved":1}},
+			{"timestamp":5,"category":{"id":"IssueDeletedCategory"},"target":{"id":"2-2","idReadable":"PRJ-2"}}
+		],"afterCursor":"c2","hasAfter":false}`,
+	}
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/activitiesPage" {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+		queries = append(queries, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, pages[r.URL.Query().Get("cursor")])
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	changes, err := client.ChangeFeed("project: PRJ #Unresolved", time.UnixMilli(1000))
+	if err != nil {
+		t.Fatalf("ChangeFeed() error = %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("Expected 2 pages, got %d requests", len(queries))
+	}
+	if got := queries[0].Get("issueQuery"); got != "project: PRJ" {
+		t.Errorf("Expected the query without the unresolved term, got %q", got)
+	}
+	if got := queries[0].Get("start"); got != "1000" {
+		t.Errorf("Expected the activities since 1000, got %q", got)
+	}
+	if !strings.Contains(queries[0].Get("categories"), "IssueDeletedCategory") {
+		t.Errorf("Expected deletions to be requested, got %q", queries[0].Get("categories"))
+	}
+	ids := func(issues []Issue) string {
+		var ids []string
+		for _, issue := range issues {
+			ids = append(ids, issue.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+	// PRJ-2 was deleted after its update; PRJ-4 was resolved before the
+	// period and is outside the query.
+	if got := ids(changes.Created); got != "2-1" {
+		t.Errorf("Created = %s", got)
+	}
+	if got := ids(changes.Updated); got != "2-3" {
+		t.Errorf("Updated = %s", got)
+	}
+	if got := strings.Join(changes.Resolved, ","); got != "2-3" {
+		t.Errorf("Resolved = %s", got)
+	}
+	if got := strings.Join(changes.Deleted, ","); got != "2-2" {
+		t.Errorf("Deleted = %s", got)
+	}
+}
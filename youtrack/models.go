@@ -1,5 +1,12 @@
 package youtrack
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
 // Issue represents a YouTrack issue.
 type Issue struct {
 	ID           string        `json:"id,omitempty"`
@@ -7,11 +14,52 @@ type Issue struct {
 	Summary      string        `json:"summary,omitempty"`
 	Description  string        `json:"description,omitempty"`
 	Updated      int64         `json:"updated,omitempty"`
+	Resolved     int64         `json:"resolved,omitempty"` // Unix timestamp in milliseconds, zero while unresolved
+	IsDraft      bool          `json:"isDraft,omitempty"`
 	Project      *Project      `json:"project,omitempty"`
 	CustomFields []CustomField `json:"customFields,omitempty"`
+	// Parent links a subtask to its parent issue.
+	Parent *IssueLink `json:"parent,omitempty"`
+	Tags   []Tag      `json:"tags,omitempty"`
 	// Add other fields as needed for synchronization
 }
 
+// IssueLink lists the issues linked to an issue by one link type, in one
+// direction.
+type IssueLink struct {
+	// Direction is OUTWARD when the issue is the source of the link,
+	// INWARD when it is the target and BOTH for undirected links.
+	Direction string         `json:"direction,omitempty"`
+	LinkType  *IssueLinkType `json:"linkType,omitempty"`
+	Issues    []Issue        `json:"issues,omitempty"`
+}
+
+// Verb returns how the link reads from the issue it belongs to, such as
+// "depends on" or "is required for".
+func (l *IssueLink) Verb() string {
+	if l.LinkType == nil {
+		return ""
+	}
+	if l.Direction == "INWARD" {
+		return l.LinkType.TargetToSource
+	}
+	return l.LinkType.SourceToTarget
+}
+
+// IsSubtask reports whether the issue has a parent issue.
+func (i *Issue) IsSubtask() bool {
+	return i.Parent != nil && len(i.Parent.Issues) > 0
+}
+
+// IssueLinkType is a kind of link between issues, such as "Subtask".
+type IssueLinkType struct {
+	ID             string `json:"id,omitempty"`
+	Name           string `json:"name,omitempty"`
+	Directed       bool   `json:"directed,omitempty"`
+	SourceToTarget string `json:"sourceToTarget,omitempty"`
+	TargetToSource string `json:"targetToSource,omitempty"`
+}
+
 // Project represents a YouTrack project.
 type Project struct {
 	YouTrackType
@@ -28,6 +76,50 @@ type CustomField struct {
 	Value interface{} `json:"value,omitempty"` // Value can be string, int, object, etc.
 }
 
+// UnmarshalJSON decodes the value of enum and state fields into a NamedValue,
+// of user fields into a UserValue and of period fields into a PeriodValue,
+// based on the field's $type. Other values, and unset ones, are decoded
+// generically.
+func (cf *CustomField) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		YouTrackType
+		ID    string          `json:"id,omitempty"`
+		Name  string          `json:"name,omitempty"`
+		Value json.RawMessage `json:"value,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	cf.YouTrackType, cf.ID, cf.Name, cf.Value = raw.YouTrackType, raw.ID, raw.Name, nil
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil
+	}
+
+	switch raw.Type {
+	case "SingleEnumIssueCustomField", "StateIssueCustomField", "StateMachineIssueCustomField":
+		var v NamedValue
+		if err := json.Unmarshal(raw.Value, &v); err != nil {
+			return fmt.Errorf("failed to decode %s value: %w", cf.Name, err)
+		}
+		cf.Value = v
+	case "SingleUserIssueCustomField":
+		var v UserValue
+		if err := json.Unmarshal(raw.Value, &v); err != nil {
+			return fmt.Errorf("failed to decode %s value: %w", cf.Name, err)
+		}
+		cf.Value = v
+	case "PeriodIssueCustomField":
+		var v PeriodValue
+		if err := json.Unmarshal(raw.Value, &v); err != nil {
+			return fmt.Errorf("failed to decode %s value: %w", cf.Name, err)
+		}
+		cf.Value = v
+	default:
+		return json.Unmarshal(raw.Value, &cf.Value)
+	}
+	return nil
+}
+
 // DateCustomField represents a custom field of type date.
 type DateCustomField struct {
 	ID    string `json:"id,omitempty"`
@@ -56,14 +148,197 @@ type YouTrackType struct {
 // IssueWrapper is used for creating issues with a specific $type
 type IssueWrapper struct {
 	YouTrackType
-	Summary      string        `json:"summary"`
-	Description  string        `json:"description"`
-	Project      *Project      `json:"project"`
-	CustomFields []CustomField `json:"customFields,omitempty"`
+	Summary      string               `json:"summary"`
+	Description  string               `json:"description"`
+	Project      *Project             `json:"project"`
+	CustomFields []CustomFieldWrapper `json:"customFields,omitempty"`
 }
 
 // CustomFieldWrapper is used for updating custom fields with a specific $type
 type CustomFieldWrapper struct {
 	YouTrackType
+	Name  string      `json:"name,omitempty"`
 	Value interface{} `json:"value"`
 }
+
+// NamedValue is the value of enum, state and user custom fields, which are
+// referenced by name when written.
+type NamedValue struct {
+	Name string `json:"name"`
+}
+
+// UserValue is the value of user custom fields. Only Login is needed when
+// writing; Name is the full name reported by YouTrack.
+type UserValue struct {
+	Login string `json:"login"`
+	Name  string `json:"name,omitempty"`
+}
+
+// PeriodValue is the value of period custom fields, such as estimations.
+type PeriodValue struct {
+	Minutes      int    `json:"minutes"`
+	Presentation string `json:"presentation,omitempty"`
+}
+
+// TextValue is the value of text custom fields.
+type TextValue struct {
+	Text string `json:"text"`
+}
+
+// User represents a YouTrack user.
+type User struct {
+	ID    string `json:"id,omitempty"`
+	Login string `json:"login,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// SavedQuery is a saved search.
+type SavedQuery struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Query string `json:"query,omitempty"`
+}
+
+// ProjectCustomField describes a custom field attached to a project.
+type ProjectCustomField struct {
+	Field struct {
+		Name      string `json:"name"`
+		FieldType struct {
+			// ID is the field type, e.g. "date", "enum[1]", "enum[*]",
+			// "state[1]", "user[1]", "string" or "text".
+			ID string `json:"id"`
+		} `json:"fieldType"`
+	} `json:"field"`
+}
+
+// Name returns the field name.
+func (f ProjectCustomField) Name() string {
+	return f.Field.Name
+}
+
+// FieldType returns the field type ID.
+func (f ProjectCustomField) FieldType() string {
+	return f.Field.FieldType.ID
+}
+
+// Tag represents a YouTrack tag.
+type Tag struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// TagNames returns the names of the tags of the issue.
+func (i Issue) TagNames() []string {
+	names := make([]string, 0, len(i.Tags))
+	for _, tag := range i.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// Custom field kinds accepted by NewCustomField.
+const (
+	FieldKindEnum      = "enum"
+	FieldKindMultiEnum = "multienum"
+	FieldKindState     = "state"
+	FieldKindUser      = "user"
+	FieldKindString    = "string"
+	FieldKindText      = "text"
+)
+
+// NewCustomField returns a custom field of the given kind set to value, using
+// the $type and value shape YouTrack expects for that kind. Multi-enum values
+// are separated by "|".
+func NewCustomField(kind, name, value string) (CustomFieldWrapper, error) {
+	switch kind {
+	case FieldKindEnum:
+		return EnumField(name, value), nil
+	case FieldKindMultiEnum:
+		var values []NamedValue
+		for _, v := range strings.Split(value, "|") {
+			values = append(values, NamedValue{Name: strings.TrimSpace(v)})
+		}
+		return CustomFieldWrapper{YouTrackType: YouTrackType{Type: "MultiEnumIssueCustomField"}, Name: name, Value: values}, nil
+	case FieldKindState:
+		return CustomFieldWrapper{YouTrackType: YouTrackType{Type: "StateIssueCustomField"}, Name: name, Value: NamedValue{Name: value}}, nil
+	case FieldKindUser:
+		return CustomFieldWrapper{YouTrackType: YouTrackType{Type: "SingleUserIssueCustomField"}, Name: name, Value: UserValue{Login: value}}, nil
+	case FieldKindString:
+		return CustomFieldWrapper{YouTrackType: YouTrackType{Type: "SimpleIssueCustomField"}, Name: name, Value: value}, nil
+	case FieldKindText:
+		return CustomFieldWrapper{YouTrackType: YouTrackType{Type: "TextIssueCustomField"}, Name: name, Value: TextValue{Text: value}}, nil
+	default:
+		return CustomFieldWrapper{}, fmt.Errorf("unknown custom field kind %q", kind)
+	}
+}
+
+// EnumField returns a single-value enum custom field set to value.
+func EnumField(name, value string) CustomFieldWrapper {
+	return CustomFieldWrapper{
+		YouTrackType: YouTrackType{Type: "SingleEnumIssueCustomField"},
+		Name:         name,
+		Value:        NamedValue{Name: value},
+	}
+}
+
+// FieldCommand returns the command setting the named field to value,
+// enclosing values with spaces in braces as commands require.
+func FieldCommand(name, value string) string {
+	if strings.ContainsAny(value, " \t") {
+		value = "{" + value + "}"
+	}
+	return name + " " + value
+}
+
+// CustomFieldValue returns a display string for the named custom field, or an
+// empty string if the issue has no such field or it is unset. Enum, state and
+// user values are reported by their name.
+func (i *Issue) CustomFieldValue(name string) string {
+	for _, cf := range i.CustomFields {
+		if cf.Name != name {
+			continue
+		}
+		switch v := cf.Value.(type) {
+		case string:
+			return v
+		case NamedValue:
+			return v.Name
+		case UserValue:
+			if v.Name != "" {
+				return v.Name
+			}
+			return v.Login
+		case map[string]interface{}:
+			if n, ok := v["name"].(string); ok {
+				return n
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// Period returns the value of the named period custom field, or zero if the
+// issue has no such field or it is unset.
+func (i *Issue) Period(name string) time.Duration {
+	for _, cf := range i.CustomFields {
+		if v, ok := cf.Value.(PeriodValue); ok && cf.Name == name {
+			return time.Duration(v.Minutes) * time.Minute
+		}
+	}
+	return 0
+}
+
+// IsResolved reports whether the issue is in a resolved state.
+func (i *Issue) IsResolved() bool {
+	return i.Resolved != 0
+}
+
+// ReadableID returns the human-readable issue ID (e.g. "PRJ-12"), falling back
+// to the database ID when it is not available.
+func (i *Issue) ReadableID() string {
+	if i.IDReadable != "" {
+		return i.IDReadable
+	}
+	return i.ID
+}